@@ -191,6 +191,42 @@ func NewWithMeta(metric string, dimensions map[string]string, meta map[interface
 	}
 }
 
+// WithDim sets the dimension key to value, returning dp so calls can be chained, like
+// New(...).WithDim(k, v).WithTime(t).  The dimensions are copied first, so maps shared with other
+// datapoints aren't changed.
+func (dp *Datapoint) WithDim(key string, value string) *Datapoint {
+	dp.Dimensions = AddMaps(dp.Dimensions, map[string]string{key: value})
+	return dp
+}
+
+// WithDims is like WithDim for each of dims
+func (dp *Datapoint) WithDims(dims map[string]string) *Datapoint {
+	if len(dims) == 0 {
+		return dp
+	}
+	merged := make(map[string]string, len(dp.Dimensions)+len(dims))
+	for k, v := range dp.Dimensions {
+		merged[k] = v
+	}
+	for k, v := range dims {
+		merged[k] = v
+	}
+	dp.Dimensions = merged
+	return dp
+}
+
+// WithTime sets the timestamp, returning dp so calls can be chained
+func (dp *Datapoint) WithTime(t time.Time) *Datapoint {
+	dp.Timestamp = t
+	return dp
+}
+
+// WithMetricType sets the metric type, returning dp so calls can be chained
+func (dp *Datapoint) WithMetricType(metricType MetricType) *Datapoint {
+	dp.MetricType = metricType
+	return dp
+}
+
 // AddMaps adds two maps of dimensions and returns a new map of dimensions that is a + b.  Note that
 // b takes precedent.  Works with nil or empty a/b maps.  Does not modify either map, but may return
 // a or b if the other is empty.
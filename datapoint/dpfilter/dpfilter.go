@@ -0,0 +1,256 @@
+// Package dpfilter drops, renames and relabels datapoints with composable rules before they leave the
+// process, to scrub PII from dimensions and keep their cardinality in check.
+package dpfilter
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"sync"
+	"sync/atomic"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/event"
+	"github.com/signalfx/golib/v3/sfxclient"
+	"github.com/signalfx/golib/v3/trace"
+)
+
+// OverflowValue is the value CapCardinality gives a dimension past its limit
+const OverflowValue = "other"
+
+// A Rule transforms a datapoint, returning nil to drop it.  Rules must not change the datapoint or its
+// dimensions, which can be shared, but return a changed copy instead.
+type Rule interface {
+	Apply(dp *datapoint.Datapoint) *datapoint.Datapoint
+}
+
+// RuleFunc is a func that is a Rule
+type RuleFunc func(dp *datapoint.Datapoint) *datapoint.Datapoint
+
+// Apply calls f
+func (f RuleFunc) Apply(dp *datapoint.Datapoint) *datapoint.Datapoint {
+	return f(dp)
+}
+
+// withDimensions returns a copy of dp with the dimensions dims
+func withDimensions(dp *datapoint.Datapoint, dims map[string]string) *datapoint.Datapoint {
+	ret := *dp
+	ret.Dimensions = dims
+	return &ret
+}
+
+// copyDimensions returns a copy of dims that can be changed
+func copyDimensions(dims map[string]string) map[string]string {
+	ret := make(map[string]string, len(dims))
+	for k, v := range dims {
+		ret[k] = v
+	}
+	return ret
+}
+
+// DropMetrics drops datapoints with metric names matching re
+func DropMetrics(re *regexp.Regexp) Rule {
+	return RuleFunc(func(dp *datapoint.Datapoint) *datapoint.Datapoint {
+		if re.MatchString(dp.Metric) {
+			return nil
+		}
+		return dp
+	})
+}
+
+// KeepMetrics drops datapoints with metric names that don't match re
+func KeepMetrics(re *regexp.Regexp) Rule {
+	return RuleFunc(func(dp *datapoint.Datapoint) *datapoint.Datapoint {
+		if !re.MatchString(dp.Metric) {
+			return nil
+		}
+		return dp
+	})
+}
+
+// RenameMetrics replaces the matches of re in metric names with replacement, which can refer to
+// submatches like regexp.ReplaceAllString's
+func RenameMetrics(re *regexp.Regexp, replacement string) Rule {
+	return RuleFunc(func(dp *datapoint.Datapoint) *datapoint.Datapoint {
+		metric := re.ReplaceAllString(dp.Metric, replacement)
+		if metric == dp.Metric {
+			return dp
+		}
+		ret := *dp
+		ret.Metric = metric
+		return &ret
+	})
+}
+
+// AddDimensions sets dims on every datapoint, replacing dimensions of the same name
+func AddDimensions(dims map[string]string) Rule {
+	return RuleFunc(func(dp *datapoint.Datapoint) *datapoint.Datapoint {
+		if len(dims) == 0 {
+			return dp
+		}
+		merged := copyDimensions(dp.Dimensions)
+		for k, v := range dims {
+			merged[k] = v
+		}
+		return withDimensions(dp, merged)
+	})
+}
+
+// RemoveDimensions removes the dimensions keys
+func RemoveDimensions(keys ...string) Rule {
+	return RuleFunc(func(dp *datapoint.Datapoint) *datapoint.Datapoint {
+		var dims map[string]string
+		for _, k := range keys {
+			if _, exists := dp.Dimensions[k]; !exists {
+				continue
+			}
+			if dims == nil {
+				dims = copyDimensions(dp.Dimensions)
+			}
+			delete(dims, k)
+		}
+		if dims == nil {
+			return dp
+		}
+		return withDimensions(dp, dims)
+	})
+}
+
+// HashDimensions replaces the values of the dimensions keys with the first 16 hex characters of the
+// SHA-256 of salt and the value, so series stay distinct without sending the values
+func HashDimensions(salt string, keys ...string) Rule {
+	return RuleFunc(func(dp *datapoint.Datapoint) *datapoint.Datapoint {
+		var dims map[string]string
+		for _, k := range keys {
+			v, exists := dp.Dimensions[k]
+			if !exists {
+				continue
+			}
+			if dims == nil {
+				dims = copyDimensions(dp.Dimensions)
+			}
+			sum := sha256.Sum256([]byte(salt + v))
+			dims[k] = hex.EncodeToString(sum[:8])
+		}
+		if dims == nil {
+			return dp
+		}
+		return withDimensions(dp, dims)
+	})
+}
+
+// CardinalityCap is a Rule that lets the dimension Key have at most Limit distinct values.  Values seen
+// after the limit is reached are replaced with OverflowValue.
+type CardinalityCap struct {
+	Key   string
+	Limit int
+
+	mu         sync.Mutex
+	seen       map[string]struct{}
+	overflowed int64
+}
+
+// CapCardinality creates a CardinalityCap of the dimension key
+func CapCardinality(key string, limit int) *CardinalityCap {
+	return &CardinalityCap{
+		Key:   key,
+		Limit: limit,
+		seen:  make(map[string]struct{}),
+	}
+}
+
+// Apply replaces the dimension's value with OverflowValue if it's a new one past the limit
+func (c *CardinalityCap) Apply(dp *datapoint.Datapoint) *datapoint.Datapoint {
+	v, exists := dp.Dimensions[c.Key]
+	if !exists {
+		return dp
+	}
+	c.mu.Lock()
+	_, seen := c.seen[v]
+	if !seen && len(c.seen) < c.Limit {
+		c.seen[v] = struct{}{}
+		seen = true
+	}
+	c.mu.Unlock()
+	if seen {
+		return dp
+	}
+	atomic.AddInt64(&c.overflowed, 1)
+	dims := copyDimensions(dp.Dimensions)
+	dims[c.Key] = OverflowValue
+	return withDimensions(dp, dims)
+}
+
+// Datapoints returns how many datapoints had the dimension replaced
+func (c *CardinalityCap) Datapoints() []*datapoint.Datapoint {
+	return []*datapoint.Datapoint{
+		sfxclient.Cumulative("total_dpfilter_cardinality_overflows", map[string]string{"dimension": c.Key}, atomic.LoadInt64(&c.overflowed)),
+	}
+}
+
+// Filter applies rules to datapoints in order, stopping at the first that drops a datapoint
+type Filter struct {
+	rules   []Rule
+	dropped int64
+}
+
+var _ sfxclient.Collector = &Filter{}
+
+// New creates a Filter applying rules in order
+func New(rules ...Rule) *Filter {
+	return &Filter{rules: rules}
+}
+
+// Apply returns points with the rules applied, without changing points or the datapoints in it
+func (f *Filter) Apply(points []*datapoint.Datapoint) []*datapoint.Datapoint {
+	ret := make([]*datapoint.Datapoint, 0, len(points))
+	for _, dp := range points {
+		for _, r := range f.rules {
+			if dp = r.Apply(dp); dp == nil {
+				break
+			}
+		}
+		if dp != nil {
+			ret = append(ret, dp)
+		}
+	}
+	if dropped := len(points) - len(ret); dropped > 0 {
+		atomic.AddInt64(&f.dropped, int64(dropped))
+	}
+	return ret
+}
+
+// Datapoints returns how many datapoints the filter dropped
+func (f *Filter) Datapoints() []*datapoint.Datapoint {
+	return []*datapoint.Datapoint{
+		sfxclient.Cumulative("total_dpfilter_dropped", nil, atomic.LoadInt64(&f.dropped)),
+	}
+}
+
+// Middleware applies the filter to the datapoints sent to next.  Events and spans go through unchanged.
+func (f *Filter) Middleware() sfxclient.Middleware {
+	return func(next sfxclient.FullSink) sfxclient.FullSink {
+		return &filterSink{filter: f, next: next}
+	}
+}
+
+type filterSink struct {
+	filter *Filter
+	next   sfxclient.FullSink
+}
+
+func (s *filterSink) AddDatapoints(ctx context.Context, points []*datapoint.Datapoint) error {
+	if points = s.filter.Apply(points); len(points) == 0 {
+		return nil
+	}
+	return s.next.AddDatapoints(ctx, points)
+}
+
+func (s *filterSink) AddEvents(ctx context.Context, events []*event.Event) error {
+	return s.next.AddEvents(ctx, events)
+}
+
+func (s *filterSink) AddSpans(ctx context.Context, spans []*trace.Span) error {
+	return s.next.AddSpans(ctx, spans)
+}
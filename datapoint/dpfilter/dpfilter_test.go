@@ -0,0 +1,102 @@
+package dpfilter
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/datapoint/dptest"
+	"github.com/signalfx/golib/v3/event"
+	"github.com/signalfx/golib/v3/sfxclient"
+	"github.com/signalfx/golib/v3/trace"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRules(t *testing.T) {
+	Convey("filter rules", t, func() {
+		dims := map[string]string{"host": "a", "user": "bob@example.com"}
+		dp := sfxclient.Gauge("http.requests", dims, 1)
+		apply := func(r Rule) *datapoint.Datapoint {
+			ret := r.Apply(dp)
+			So(dims, ShouldResemble, map[string]string{"host": "a", "user": "bob@example.com"})
+			So(dp.Metric, ShouldEqual, "http.requests")
+			return ret
+		}
+		Convey("should drop and keep by metric", func() {
+			So(apply(DropMetrics(regexp.MustCompile(`^http\.`))), ShouldBeNil)
+			So(apply(DropMetrics(regexp.MustCompile(`^grpc\.`))), ShouldEqual, dp)
+			So(apply(KeepMetrics(regexp.MustCompile(`^grpc\.`))), ShouldBeNil)
+			So(apply(KeepMetrics(regexp.MustCompile(`^http\.`))), ShouldEqual, dp)
+		})
+		Convey("should rename metrics", func() {
+			So(apply(RenameMetrics(regexp.MustCompile(`^http\.(.*)`), "web.$1")).Metric, ShouldEqual, "web.requests")
+			So(apply(RenameMetrics(regexp.MustCompile(`^grpc`), "rpc")), ShouldEqual, dp)
+		})
+		Convey("should add, remove and hash dimensions", func() {
+			So(apply(AddDimensions(map[string]string{"host": "b", "env": "prod"})).Dimensions, ShouldResemble,
+				map[string]string{"host": "b", "env": "prod", "user": "bob@example.com"})
+			So(apply(AddDimensions(nil)), ShouldEqual, dp)
+			So(apply(RemoveDimensions("user", "missing")).Dimensions, ShouldResemble, map[string]string{"host": "a"})
+			So(apply(RemoveDimensions("missing")), ShouldEqual, dp)
+			hashed := apply(HashDimensions("salt", "user", "missing")).Dimensions
+			So(hashed["host"], ShouldEqual, "a")
+			So(len(hashed["user"]), ShouldEqual, 16)
+			So(hashed["user"], ShouldNotEqual, apply(HashDimensions("pepper", "user")).Dimensions["user"])
+			So(hashed["user"], ShouldEqual, apply(HashDimensions("salt", "user")).Dimensions["user"])
+			So(apply(HashDimensions("salt", "missing")), ShouldEqual, dp)
+		})
+		Convey("should cap cardinality", func() {
+			c := CapCardinality("host", 2)
+			for _, host := range []string{"a", "b", "a", "c"} {
+				got := c.Apply(sfxclient.Gauge("m", map[string]string{"host": host}, 1))
+				expected := host
+				if host == "c" {
+					expected = OverflowValue
+				}
+				So(got.Dimensions["host"], ShouldEqual, expected)
+			}
+			So(c.Apply(sfxclient.Gauge("m", nil, 1)).Dimensions, ShouldBeNil)
+			So(c.Datapoints()[0].Value, ShouldResemble, datapoint.NewIntValue(1))
+		})
+	})
+}
+
+func TestFilter(t *testing.T) {
+	Convey("a filter", t, func() {
+		f := New(
+			DropMetrics(regexp.MustCompile(`^debug\.`)),
+			RemoveDimensions("user"),
+			RuleFunc(func(dp *datapoint.Datapoint) *datapoint.Datapoint {
+				So(dp.Dimensions["user"], ShouldEqual, "")
+				return dp
+			}),
+		)
+		points := []*datapoint.Datapoint{
+			sfxclient.Gauge("debug.x", nil, 1),
+			sfxclient.Gauge("requests", map[string]string{"user": "bob"}, 1),
+		}
+		Convey("should apply rules in order", func() {
+			got := f.Apply(points)
+			So(len(got), ShouldEqual, 1)
+			So(got[0].Dimensions, ShouldResemble, map[string]string{})
+			So(points[1].Dimensions, ShouldResemble, map[string]string{"user": "bob"})
+			So(f.Datapoints()[0].Value, ShouldResemble, datapoint.NewIntValue(1))
+		})
+		Convey("should be sink middleware", func() {
+			next := dptest.NewBasicSink()
+			next.Resize(1)
+			sink := sfxclient.Chain(next, f.Middleware())
+			ctx := context.Background()
+			So(sink.AddDatapoints(ctx, points), ShouldBeNil)
+			So(len(<-next.PointsChan), ShouldEqual, 1)
+			So(sink.AddDatapoints(ctx, points[:1]), ShouldBeNil)
+			So(len(next.PointsChan), ShouldEqual, 0)
+			So(sink.AddEvents(ctx, []*event.Event{event.New("e", event.USERDEFINED, nil, time.Time{})}), ShouldBeNil)
+			So(next.NextEvent().EventType, ShouldEqual, "e")
+			So(sink.AddSpans(ctx, []*trace.Span{{ID: "s"}}), ShouldBeNil)
+			So(next.NextSpan().ID, ShouldEqual, "s")
+		})
+	})
+}
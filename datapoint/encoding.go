@@ -0,0 +1,137 @@
+package datapoint
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/signalfx/golib/v3/errors"
+)
+
+// JSONLEncoder writes datapoints as JSON Lines: each datapoint on a line of its own, as the JSON a
+// Datapoint marshals to and unmarshals from
+type JSONLEncoder struct {
+	enc *json.Encoder
+}
+
+// NewJSONLEncoder creates an encoder writing to w
+func NewJSONLEncoder(w io.Writer) *JSONLEncoder {
+	return &JSONLEncoder{enc: json.NewEncoder(w)}
+}
+
+// Encode writes dps to the encoder's writer
+func (e *JSONLEncoder) Encode(dps ...*Datapoint) error {
+	for _, dp := range dps {
+		if err := e.enc.Encode(dp); err != nil {
+			return errors.Annotatef(err, "cannot encode datapoint %s", dp.Metric)
+		}
+	}
+	return nil
+}
+
+// MarshalJSONL returns dps as JSON Lines
+func MarshalJSONL(dps []*Datapoint) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := NewJSONLEncoder(&buf).Encode(dps...); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// The columns every CSV written by a CSVEncoder starts with
+var csvColumns = []string{"metric", "metric_type", "value", "timestamp"}
+
+// csvOtherDimensions is the column holding the dimensions without a column of their own
+const csvOtherDimensions = "other_dimensions"
+
+// CSVEncoder writes datapoints as CSV with a header row.  The columns are the metric, the metric type
+// named like "cumulative counter", the value, the timestamp in RFC 3339 format, empty if there isn't one,
+// then a column for each of its dimensions.  The last column, other_dimensions, is a JSON object of the
+// dimensions a datapoint has that don't have a column.
+type CSVEncoder struct {
+	w             *csv.Writer
+	dimensions    []string
+	hasColumn     map[string]bool
+	headerWritten bool
+	record        []string
+}
+
+// NewCSVEncoder creates an encoder writing to w with the dimension columns dimensions
+func NewCSVEncoder(w io.Writer, dimensions []string) *CSVEncoder {
+	hasColumn := make(map[string]bool, len(dimensions))
+	for _, d := range dimensions {
+		hasColumn[d] = true
+	}
+	return &CSVEncoder{
+		w:          csv.NewWriter(w),
+		dimensions: dimensions,
+		hasColumn:  hasColumn,
+		record:     make([]string, 0, len(csvColumns)+len(dimensions)+1),
+	}
+}
+
+// Encode writes dps to the encoder's writer, after the header row if nothing has been written yet
+func (e *CSVEncoder) Encode(dps ...*Datapoint) error {
+	if !e.headerWritten {
+		header := append(append(append(make([]string, 0, cap(e.record)), csvColumns...), e.dimensions...), csvOtherDimensions)
+		if err := e.w.Write(header); err != nil {
+			return errors.Annotate(err, "cannot write CSV header")
+		}
+		e.headerWritten = true
+	}
+	for _, dp := range dps {
+		if err := e.w.Write(e.toRecord(dp)); err != nil {
+			return errors.Annotatef(err, "cannot encode datapoint %s", dp.Metric)
+		}
+	}
+	e.w.Flush()
+	return errors.Annotate(e.w.Error(), "cannot write CSV")
+}
+
+func (e *CSVEncoder) toRecord(dp *Datapoint) []string {
+	value := ""
+	if dp.Value != nil {
+		value = dp.Value.String()
+	}
+	timestamp := ""
+	if !dp.Timestamp.IsZero() {
+		timestamp = dp.Timestamp.Format(time.RFC3339Nano)
+	}
+	record := append(e.record[:0], dp.Metric, dp.MetricType.String(), value, timestamp)
+	var others map[string]string
+	for _, d := range e.dimensions {
+		record = append(record, dp.Dimensions[d])
+	}
+	for k, v := range dp.Dimensions {
+		if !e.hasColumn[k] {
+			if others == nil {
+				others = make(map[string]string)
+			}
+			others[k] = v
+		}
+	}
+	other := ""
+	if others != nil {
+		// a map of strings always marshals
+		b, _ := json.Marshal(others)
+		other = string(b)
+	}
+	return append(record, other)
+}
+
+// MarshalCSV returns dps as CSV, with a column for every dimension any of them has, in order
+func MarshalCSV(dps []*Datapoint) ([]byte, error) {
+	keys := make(map[string]struct{})
+	for _, dp := range dps {
+		for k := range dp.Dimensions {
+			keys[k] = struct{}{}
+		}
+	}
+	var buf bytes.Buffer
+	if err := NewCSVEncoder(&buf, SortedKeys(keys)).Encode(dps...); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,72 @@
+package datapoint
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// failingWriter fails every write
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestEncoding(t *testing.T) {
+	Convey("a batch of datapoints", t, func() {
+		now := time.Date(2021, 6, 1, 12, 0, 0, 500, time.UTC)
+		dps := []*Datapoint{
+			New("requests", map[string]string{"host": "a", "az": "1a"}, NewIntValue(3), Counter, now),
+			New("ratio", map[string]string{"host": "b,c"}, NewFloatValue(0.5), Gauge, time.Time{}),
+			New("state", nil, NewStringValue("up"), Enum, now),
+		}
+		Convey("should marshal to JSON lines that unmarshal", func() {
+			b, err := MarshalJSONL(dps)
+			So(err, ShouldBeNil)
+			scanner := bufio.NewScanner(bytes.NewReader(b))
+			var got []*Datapoint
+			for scanner.Scan() {
+				var dp Datapoint
+				So(json.Unmarshal(scanner.Bytes(), &dp), ShouldBeNil)
+				got = append(got, &dp)
+			}
+			So(len(got), ShouldEqual, 3)
+			So(got[0].Dimensions, ShouldResemble, dps[0].Dimensions)
+			So(got[0].Value, ShouldResemble, NewIntValue(3))
+			So(got[0].MetricType, ShouldEqual, Counter)
+			So(got[0].Timestamp.Equal(now), ShouldBeTrue)
+			So(got[1].Value, ShouldResemble, NewFloatValue(0.5))
+			So(got[2].Value, ShouldResemble, NewStringValue("up"))
+		})
+		Convey("should marshal to CSV with a column per dimension", func() {
+			b, err := MarshalCSV(dps)
+			So(err, ShouldBeNil)
+			So(string(b), ShouldEqual, "metric,metric_type,value,timestamp,az,host,other_dimensions\n"+
+				"requests,cumulative counter,3,2021-06-01T12:00:00.0000005Z,1a,a,\n"+
+				"ratio,gauge,0.5,,,\"b,c\",\n"+
+				"state,enum,up,2021-06-01T12:00:00.0000005Z,,,\n")
+		})
+		Convey("should stream CSV with other dimensions as JSON", func() {
+			var buf bytes.Buffer
+			e := NewCSVEncoder(&buf, []string{"host"})
+			So(e.Encode(dps[0]), ShouldBeNil)
+			So(e.Encode(dps[2]), ShouldBeNil)
+			So(buf.String(), ShouldEqual, "metric,metric_type,value,timestamp,host,other_dimensions\n"+
+				"requests,cumulative counter,3,2021-06-01T12:00:00.0000005Z,a,\"{\"\"az\"\":\"\"1a\"\"}\"\n"+
+				"state,enum,up,2021-06-01T12:00:00.0000005Z,,\n")
+		})
+		Convey("should return write errors", func() {
+			So(NewCSVEncoder(failingWriter{}, nil).Encode(dps...), ShouldNotBeNil)
+			So(NewJSONLEncoder(failingWriter{}).Encode(dps...), ShouldNotBeNil)
+			_, err := MarshalJSONL([]*Datapoint{New("nan", nil, NewFloatValue(math.NaN()), Gauge, now)})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,20 @@
+package datapoint
+
+import "sort"
+
+// SortedKeys returns the keys of m in order, for iterating dimensions or properties the same way every time
+func SortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// RangeSorted calls f with each key and value of m in key order
+func RangeSorted[V any](m map[string]V, f func(key string, value V)) {
+	for _, k := range SortedKeys(m) {
+		f(k, m[k])
+	}
+}
@@ -0,0 +1,24 @@
+package datapoint
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSortedKeys(t *testing.T) {
+	Convey("maps", t, func() {
+		dims := map[string]string{"b": "2", "c": "3", "a": "1"}
+		Convey("should have sorted keys", func() {
+			So(SortedKeys(dims), ShouldResemble, []string{"a", "b", "c"})
+			So(SortedKeys(map[string]interface{}{}), ShouldBeEmpty)
+		})
+		Convey("should range in key order", func() {
+			var values []string
+			RangeSorted(dims, func(k, v string) {
+				values = append(values, k+v)
+			})
+			So(values, ShouldResemble, []string{"a1", "b2", "c3"})
+		})
+	})
+}
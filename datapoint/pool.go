@@ -0,0 +1,33 @@
+package datapoint
+
+import "sync"
+
+var datapointPool = sync.Pool{
+	New: func() interface{} {
+		return &Datapoint{Meta: map[interface{}]interface{}{}}
+	},
+}
+
+// Get returns an empty datapoint, with empty Meta like New makes, that may be reused from earlier calls to
+// Put.  Programs making many short lived datapoints can use it to allocate less.
+func Get() *Datapoint {
+	return datapointPool.Get().(*Datapoint)
+}
+
+// Put empties dp and keeps it to be returned by Get.  Nothing may use dp after, so only put datapoints
+// that have been sent and that no sink has kept, like one buffering them.  The dimensions of dp aren't
+// reused, since they're often shared with other datapoints.
+func Put(dp *Datapoint) {
+	if dp == nil {
+		return
+	}
+	meta := dp.Meta
+	for k := range meta {
+		delete(meta, k)
+	}
+	if meta == nil {
+		meta = map[interface{}]interface{}{}
+	}
+	*dp = Datapoint{Meta: meta}
+	datapointPool.Put(dp)
+}
@@ -0,0 +1,57 @@
+package datapoint
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPool(t *testing.T) {
+	Convey("pooled datapoints", t, func() {
+		dp := Get()
+		So(dp.Meta, ShouldNotBeNil)
+		So(dp.Metric, ShouldEqual, "")
+		dp.Metric = "m"
+		dp.Dimensions = map[string]string{"host": "a"}
+		dp.Value = NewIntValue(1)
+		dp.SetProperty("k", "v")
+		dp.Timestamp = time.Unix(1, 0)
+		Convey("should come back empty", func() {
+			dims := dp.Dimensions
+			Put(dp)
+			So(*dp, ShouldResemble, Datapoint{Meta: map[interface{}]interface{}{}})
+			So(dims, ShouldResemble, map[string]string{"host": "a"})
+		})
+		Convey("should take datapoints without meta, or none", func() {
+			dp.Meta = nil
+			Put(dp)
+			So(dp.Meta, ShouldNotBeNil)
+			Put(nil)
+		})
+	})
+}
+
+// benchmarkDatapoint keeps the compiler from optimizing away the allocations benchmarked
+var benchmarkDatapoint *Datapoint
+
+func BenchmarkNew(b *testing.B) {
+	dims := map[string]string{"host": "a"}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		benchmarkDatapoint = New("m", dims, NewIntValue(1), Gauge, time.Time{})
+	}
+}
+
+func BenchmarkGetPut(b *testing.B) {
+	dims := map[string]string{"host": "a"}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		dp := Get()
+		dp.Metric = "m"
+		dp.Dimensions = dims
+		dp.Value = NewIntValue(1)
+		benchmarkDatapoint = dp
+		Put(dp)
+	}
+}
@@ -0,0 +1,191 @@
+package datapoint
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// temporalitySeries is the state kept for one time series by a temporality converter
+type temporalitySeries struct {
+	value    Value
+	lastSeen time.Time
+}
+
+// temporalityState is the per time series state of DeltaToCumulative and CumulativeToDelta
+type temporalityState struct {
+	mu     sync.Mutex
+	series map[string]*temporalitySeries
+}
+
+// seriesKey identifies the time series of dp by its metric and dimensions.  The metric type isn't part of
+// it, since converting changes it.
+func seriesKey(dp *Datapoint) string {
+	var b strings.Builder
+	b.WriteString(dp.Metric)
+	RangeSorted(dp.Dimensions, func(key string, value string) {
+		b.WriteByte(0)
+		b.WriteString(key)
+		b.WriteByte('=')
+		b.WriteString(value)
+	})
+	return b.String()
+}
+
+// lookup returns the state of the series of dp, creating it if it's new.  s.mu must be held.
+func (s *temporalityState) lookup(dp *Datapoint) (series *temporalitySeries, isNew bool) {
+	key := seriesKey(dp)
+	if series = s.series[key]; series != nil {
+		return series, false
+	}
+	if s.series == nil {
+		s.series = make(map[string]*temporalitySeries)
+	}
+	series = &temporalitySeries{}
+	s.series[key] = series
+	return series, true
+}
+
+// Forget drops the state of every time series last seen before the given time, so series that stopped
+// reporting don't use memory forever, and returns how many were dropped.  Series that report again start
+// over as if they were new.
+func (s *temporalityState) Forget(before time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dropped := 0
+	for key, series := range s.series {
+		if series.lastSeen.Before(before) {
+			delete(s.series, key)
+			dropped++
+		}
+	}
+	return dropped
+}
+
+// Len returns how many time series have state kept
+func (s *temporalityState) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.series)
+}
+
+// seenAt is when dp was seen: its timestamp, or now if it has none
+func seenAt(dp *Datapoint) time.Time {
+	if dp.Timestamp.IsZero() {
+		return time.Now()
+	}
+	return dp.Timestamp
+}
+
+// addValues returns a + sign*b, which stays an integer if both are.  ok is false if either isn't a number.
+func addValues(a, b Value, sign int64) (sum Value, ok bool) {
+	if ai, isInt := a.(IntValue); isInt {
+		if bi, isInt := b.(IntValue); isInt {
+			return NewIntValue(ai.Int() + sign*bi.Int()), true
+		}
+	}
+	af, aok := numericValue(a)
+	bf, bok := numericValue(b)
+	if !aok || !bok {
+		return nil, false
+	}
+	return NewFloatValue(af + float64(sign)*bf), true
+}
+
+// numericValue returns v as a float, if it's a number
+func numericValue(v Value) (float64, bool) {
+	switch n := v.(type) {
+	case IntValue:
+		return float64(n.Int()), true
+	case FloatValue:
+		return n.Float(), true
+	}
+	return 0, false
+}
+
+// DeltaToCumulative turns Count datapoints, which are the change since the last report, into Counter
+// datapoints, which are a running total, for backends that only take cumulative counters.  It keeps a
+// total per time series and is safe to use from multiple goroutines.
+type DeltaToCumulative struct {
+	temporalityState
+}
+
+// Convert returns the cumulative counter dp adds up to.  Datapoints that aren't a numeric Count are
+// returned unchanged.  dp itself isn't changed.  A negative delta, which a delta counter can only send
+// after something upstream restarted, starts the total over from it, since the total it was added to no
+// longer means anything.
+func (c *DeltaToCumulative) Convert(dp *Datapoint) *Datapoint {
+	if dp.MetricType != Count {
+		return dp
+	}
+	if _, ok := numericValue(dp.Value); !ok {
+		return dp
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	series, isNew := c.lookup(dp)
+	total := dp.Value
+	if !isNew {
+		if delta, _ := numericValue(dp.Value); delta >= 0 {
+			total, _ = addValues(series.value, dp.Value, 1)
+		}
+	}
+	series.value = total
+	series.lastSeen = seenAt(dp)
+	return NewWithMeta(dp.Metric, dp.Dimensions, dp.Meta, total, Counter, dp.Timestamp)
+}
+
+// ConvertAll returns each of dps converted
+func (c *DeltaToCumulative) ConvertAll(dps []*Datapoint) []*Datapoint {
+	ret := make([]*Datapoint, 0, len(dps))
+	for _, dp := range dps {
+		ret = append(ret, c.Convert(dp))
+	}
+	return ret
+}
+
+// CumulativeToDelta turns Counter datapoints, which are a running total, into Count datapoints, which are
+// the change since the last report, for backends that only take deltas.  It keeps the last total per time
+// series and is safe to use from multiple goroutines.
+type CumulativeToDelta struct {
+	temporalityState
+}
+
+// Convert returns the change in the counter since the last datapoint of its time series, or nil for the
+// first one seen, since there's nothing to take it from.  Datapoints that aren't a numeric Counter are
+// returned unchanged.  dp itself isn't changed.  A total lower than the last means the counter was reset,
+// usually because what sends it restarted, so the total itself is the change since the reset.
+func (c *CumulativeToDelta) Convert(dp *Datapoint) *Datapoint {
+	if dp.MetricType != Counter {
+		return dp
+	}
+	total, ok := numericValue(dp.Value)
+	if !ok {
+		return dp
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	series, isNew := c.lookup(dp)
+	last := series.value
+	series.value = dp.Value
+	series.lastSeen = seenAt(dp)
+	if isNew {
+		return nil
+	}
+	delta := dp.Value
+	if lastTotal, _ := numericValue(last); total >= lastTotal {
+		delta, _ = addValues(dp.Value, last, -1)
+	}
+	return NewWithMeta(dp.Metric, dp.Dimensions, dp.Meta, delta, Count, dp.Timestamp)
+}
+
+// ConvertAll returns each of dps converted, leaving out the first of each time series
+func (c *CumulativeToDelta) ConvertAll(dps []*Datapoint) []*Datapoint {
+	ret := make([]*Datapoint, 0, len(dps))
+	for _, dp := range dps {
+		if converted := c.Convert(dp); converted != nil {
+			ret = append(ret, converted)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,78 @@
+package datapoint
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTemporality(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	dims := map[string]string{"host": "a"}
+	point := func(metric string, value Value, mt MetricType) *Datapoint {
+		return New(metric, dims, value, mt, now)
+	}
+	Convey("converting deltas to cumulative counters", t, func() {
+		c := &DeltaToCumulative{}
+		Convey("should keep a running total per series", func() {
+			got := c.ConvertAll([]*Datapoint{
+				point("hits", NewIntValue(2), Count),
+				point("hits", NewIntValue(3), Count),
+				New("hits", map[string]string{"host": "b"}, NewIntValue(1), Count, now),
+				point("hits", NewFloatValue(.5), Count),
+			})
+			So(got[0].Value, ShouldResemble, NewIntValue(2))
+			So(got[0].MetricType, ShouldEqual, Counter)
+			So(got[1].Value, ShouldResemble, NewIntValue(5))
+			So(got[2].Value, ShouldResemble, NewIntValue(1))
+			So(got[3].Value, ShouldResemble, NewFloatValue(5.5))
+			So(got[3].Dimensions, ShouldResemble, dims)
+			So(c.Len(), ShouldEqual, 2)
+		})
+		Convey("should start over after a negative delta", func() {
+			c.Convert(point("hits", NewIntValue(10), Count))
+			So(c.Convert(point("hits", NewIntValue(-4), Count)).Value, ShouldResemble, NewIntValue(-4))
+			So(c.Convert(point("hits", NewIntValue(1), Count)).Value, ShouldResemble, NewIntValue(-3))
+		})
+		Convey("should leave everything else alone", func() {
+			gauge := point("load", NewIntValue(1), Gauge)
+			So(c.Convert(gauge), ShouldEqual, gauge)
+			str := point("hits", NewStringValue("x"), Count)
+			So(c.Convert(str), ShouldEqual, str)
+			So(c.Len(), ShouldEqual, 0)
+		})
+	})
+	Convey("converting cumulative counters to deltas", t, func() {
+		c := &CumulativeToDelta{}
+		Convey("should send the change since the last total", func() {
+			got := c.ConvertAll([]*Datapoint{
+				point("hits", NewIntValue(10), Counter),
+				point("hits", NewIntValue(15), Counter),
+				point("hits", NewFloatValue(15.5), Counter),
+				point("hits", NewIntValue(20), Counter),
+			})
+			So(len(got), ShouldEqual, 3)
+			So(got[0].Value, ShouldResemble, NewIntValue(5))
+			So(got[0].MetricType, ShouldEqual, Count)
+			So(got[1].Value, ShouldResemble, NewFloatValue(.5))
+			So(got[2].Value, ShouldResemble, NewFloatValue(4.5))
+		})
+		Convey("should treat a lower total as a reset", func() {
+			So(c.Convert(point("hits", NewIntValue(10), Counter)), ShouldBeNil)
+			So(c.Convert(point("hits", NewIntValue(3), Counter)).Value, ShouldResemble, NewIntValue(3))
+			So(c.Convert(point("hits", NewIntValue(7), Counter)).Value, ShouldResemble, NewIntValue(4))
+		})
+		Convey("should forget series that stopped reporting", func() {
+			c.Convert(point("hits", NewIntValue(10), Counter))
+			c.Convert(New("hits", nil, NewIntValue(1), Counter, time.Time{}))
+			So(c.Forget(now.Add(time.Second)), ShouldEqual, 1)
+			So(c.Len(), ShouldEqual, 1)
+			So(c.Convert(point("hits", NewIntValue(12), Counter)), ShouldBeNil)
+		})
+		Convey("should leave everything else alone", func() {
+			gauge := point("load", NewIntValue(1), Gauge)
+			So(c.Convert(gauge), ShouldEqual, gauge)
+		})
+	})
+}
@@ -0,0 +1,93 @@
+package datapoint
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// The limits SignalFx ingest puts on datapoints.  Datapoints past them are dropped.
+const (
+	MaxMetricNameLength     = 256
+	MaxDimensionNameLength  = 128
+	MaxDimensionValueLength = 256
+	MaxDimensions           = 36
+)
+
+// reservedDimensionPrefix starts dimension names SignalFx keeps for itself
+const reservedDimensionPrefix = "sf_"
+
+// ValidationError lists every way a datapoint breaks the limits of SignalFx ingest
+type ValidationError struct {
+	Metric   string
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid datapoint %q: %s", e.Metric, strings.Join(e.Problems, "; "))
+}
+
+// NewValidated creates a new datapoint like New, returning a *ValidationError instead if SignalFx ingest
+// would drop it
+func NewValidated(metric string, dimensions map[string]string, value Value, metricType MetricType, timestamp time.Time) (*Datapoint, error) {
+	dp := New(metric, dimensions, value, metricType, timestamp)
+	if err := dp.Validate(); err != nil {
+		return nil, err
+	}
+	return dp, nil
+}
+
+// Validate returns a *ValidationError listing what about dp SignalFx ingest would drop it for, or nil if
+// nothing.  Metric names must be at most MaxMetricNameLength characters.  Dimension names must start with
+// a letter, have only letters, digits, underscores and hyphens, be at most MaxDimensionNameLength
+// characters and not start with sf_.  Dimension values must be at most MaxDimensionValueLength characters.
+func (dp *Datapoint) Validate() error {
+	var problems []string
+	switch n := utf8.RuneCountInString(dp.Metric); {
+	case n == 0:
+		problems = append(problems, "metric name is empty")
+	case n > MaxMetricNameLength:
+		problems = append(problems, fmt.Sprintf("metric name is %d characters, over the limit of %d", n, MaxMetricNameLength))
+	}
+	if len(dp.Dimensions) > MaxDimensions {
+		problems = append(problems, fmt.Sprintf("has %d dimensions, over the limit of %d", len(dp.Dimensions), MaxDimensions))
+	}
+	RangeSorted(dp.Dimensions, func(key string, value string) {
+		if problem := dimensionNameProblem(key); problem != "" {
+			problems = append(problems, fmt.Sprintf("dimension name %q %s", key, problem))
+		}
+		if n := utf8.RuneCountInString(value); n > MaxDimensionValueLength {
+			problems = append(problems, fmt.Sprintf("dimension %q value is %d characters, over the limit of %d", key, n, MaxDimensionValueLength))
+		}
+	})
+	if dp.Value == nil {
+		problems = append(problems, "has no value")
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return &ValidationError{Metric: dp.Metric, Problems: problems}
+}
+
+func dimensionNameProblem(key string) string {
+	if key == "" {
+		return "is empty"
+	}
+	if n := utf8.RuneCountInString(key); n > MaxDimensionNameLength {
+		return fmt.Sprintf("is %d characters, over the limit of %d", n, MaxDimensionNameLength)
+	}
+	if strings.HasPrefix(key, reservedDimensionPrefix) {
+		return "starts with the reserved prefix " + reservedDimensionPrefix
+	}
+	for i, r := range key {
+		letter := (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+		if i == 0 && !letter {
+			return "must start with a letter"
+		}
+		if !letter && !(r >= '0' && r <= '9') && r != '_' && r != '-' {
+			return fmt.Sprintf("has the invalid character %q", r)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,73 @@
+package datapoint
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBuilder(t *testing.T) {
+	Convey("a datapoint built fluently", t, func() {
+		shared := map[string]string{"host": "a"}
+		now := time.Unix(1600000000, 0)
+		dp := New("requests", shared, NewIntValue(1), Gauge, time.Time{}).
+			WithDim("region", "us").
+			WithDims(map[string]string{"host": "b", "az": "1a"}).
+			WithTime(now).
+			WithMetricType(Counter)
+		So(dp.Dimensions, ShouldResemble, map[string]string{"host": "b", "region": "us", "az": "1a"})
+		So(dp.Timestamp, ShouldEqual, now)
+		So(dp.MetricType, ShouldEqual, Counter)
+		So(shared, ShouldResemble, map[string]string{"host": "a"})
+		So(New("m", nil, nil, Gauge, now).WithDims(nil).Dimensions, ShouldBeNil)
+		So(New("m", nil, nil, Gauge, now).WithDim("k", "v").Dimensions, ShouldResemble, map[string]string{"k": "v"})
+	})
+}
+
+func TestValidate(t *testing.T) {
+	Convey("validating datapoints", t, func() {
+		Convey("should pass ones SignalFx takes", func() {
+			dp, err := NewValidated("requests", map[string]string{"host": "a", "Host-2_b": ""}, NewIntValue(1), Gauge, time.Time{})
+			So(err, ShouldBeNil)
+			So(dp.Metric, ShouldEqual, "requests")
+		})
+		Convey("should list every problem", func() {
+			dims := map[string]string{
+				"":                       "v",
+				"1host":                  "v",
+				"sf_metric":              "v",
+				"has space":              "v",
+				strings.Repeat("k", 129): "v",
+				"long":                   strings.Repeat("é", 257),
+			}
+			dp, err := NewValidated(strings.Repeat("m", 257), dims, nil, Gauge, time.Time{})
+			So(dp, ShouldBeNil)
+			verr, ok := err.(*ValidationError)
+			So(ok, ShouldBeTrue)
+			So(verr.Problems, ShouldResemble, []string{
+				"metric name is 257 characters, over the limit of 256",
+				`dimension name "" is empty`,
+				`dimension name "1host" must start with a letter`,
+				`dimension name "has space" has the invalid character ' '`,
+				`dimension name "` + strings.Repeat("k", 129) + `" is 129 characters, over the limit of 128`,
+				`dimension "long" value is 257 characters, over the limit of 256`,
+				`dimension name "sf_metric" starts with the reserved prefix sf_`,
+				"has no value",
+			})
+			So(err.Error(), ShouldStartWith, `invalid datapoint "mmm`)
+			So(err.Error(), ShouldEndWith, "; has no value")
+		})
+		Convey("should catch empty names and too many dimensions", func() {
+			dp := New("", nil, NewIntValue(1), Gauge, time.Time{})
+			for i := 0; i <= MaxDimensions; i++ {
+				dp.WithDim("d"+strings.Repeat("x", i), "v")
+			}
+			So(dp.Validate().(*ValidationError).Problems, ShouldResemble, []string{
+				"metric name is empty",
+				"has 37 dimensions, over the limit of 36",
+			})
+		})
+	})
+}
@@ -70,3 +70,65 @@ func (wireVal strWire) String() string {
 func NewStringValue(val string) StringValue {
 	return strWire(val)
 }
+
+// HistogramValue are values that are a distribution of observations over explicit buckets.  Bucket i
+// counts the observations greater than bound i-1 and at most bound i, so there's one more count than
+// there are bounds, the last counting those greater than every bound.
+type HistogramValue interface {
+	Value
+	Bounds() []float64
+	Counts() []uint64
+	Sum() float64
+	Count() uint64
+}
+
+type histogramWire struct {
+	bounds []float64
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func (wireVal *histogramWire) Bounds() []float64 {
+	return wireVal.bounds
+}
+
+func (wireVal *histogramWire) Counts() []uint64 {
+	return wireVal.counts
+}
+
+func (wireVal *histogramWire) Sum() float64 {
+	return wireVal.sum
+}
+
+func (wireVal *histogramWire) Count() uint64 {
+	return wireVal.count
+}
+
+func (wireVal *histogramWire) String() string {
+	return fmt.Sprintf("histogram[count=%d sum=%s bounds=%v counts=%v]", wireVal.count,
+		strconv.FormatFloat(wireVal.sum, 'f', -1, 64), wireVal.bounds, wireVal.counts)
+}
+
+// NewHistogramValue creates new datapoint value is a histogram of observations summing to sum, counted in
+// the buckets bounds delimit.  It errors unless the bounds are increasing and there's one more count than
+// there are bounds.
+func NewHistogramValue(bounds []float64, counts []uint64, sum float64) (HistogramValue, error) {
+	if len(counts) != len(bounds)+1 {
+		return nil, fmt.Errorf("histogram has %d bounds so needs %d counts, not %d", len(bounds), len(bounds)+1, len(counts))
+	}
+	for i := 1; i < len(bounds); i++ {
+		if !(bounds[i] > bounds[i-1]) {
+			return nil, fmt.Errorf("histogram bounds must increase, but %v doesn't", bounds)
+		}
+	}
+	ret := &histogramWire{
+		bounds: append([]float64(nil), bounds...),
+		counts: append([]uint64(nil), counts...),
+		sum:    sum,
+	}
+	for _, c := range counts {
+		ret.count += c
+	}
+	return ret, nil
+}
@@ -24,3 +24,22 @@ func TestStrWire(t *testing.T) {
 	iv := NewStringValue("val")
 	assert.Equal(t, iv.String(), "val")
 }
+
+func TestHistogramWire(t *testing.T) {
+	bounds := []float64{1, 5}
+	hv, err := NewHistogramValue(bounds, []uint64{2, 3, 1}, 12.5)
+	assert.NoError(t, err)
+	bounds[0] = 100
+	assert.Equal(t, []float64{1, 5}, hv.Bounds())
+	assert.Equal(t, []uint64{2, 3, 1}, hv.Counts())
+	assert.Equal(t, uint64(6), hv.Count())
+	assert.Equal(t, 12.5, hv.Sum())
+	assert.Equal(t, "histogram[count=6 sum=12.5 bounds=[1 5] counts=[2 3 1]]", hv.String())
+
+	_, err = NewHistogramValue(nil, []uint64{1}, 0)
+	assert.NoError(t, err)
+	_, err = NewHistogramValue([]float64{1}, []uint64{1}, 0)
+	assert.Error(t, err)
+	_, err = NewHistogramValue([]float64{2, 1}, []uint64{1, 1, 1}, 0)
+	assert.Error(t, err)
+}
@@ -0,0 +1,142 @@
+package dataunit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rate represents an amount of data per unit of time, stored as bytes per second.  Rates can be
+// added, subtracted, scaled and compared with the usual operators.
+type Rate float64
+
+// Common rate units
+const (
+	BytePerSecond     Rate = 1
+	KilobytePerSecond      = Rate(Kilobyte) * BytePerSecond
+	MegabytePerSecond      = Rate(Megabyte) * BytePerSecond
+	GigabytePerSecond      = Rate(Gigabyte) * BytePerSecond
+)
+
+// NewRate returns the rate of transferring size every per
+func NewRate(size Size, per time.Duration) Rate {
+	if per <= 0 {
+		return Rate(math.Inf(1))
+	}
+	return Rate(float64(size) / per.Seconds())
+}
+
+// BytesPerSecond returns the rate as a float64 of bytes per second
+func (r Rate) BytesPerSecond() float64 {
+	return float64(r)
+}
+
+// Per returns how much data is transferred at this rate over d
+func (r Rate) Per(d time.Duration) Size {
+	return Size(float64(r) * d.Seconds())
+}
+
+// TimeFor returns how long transferring size takes at this rate
+func (r Rate) TimeFor(size Size) time.Duration {
+	if r <= 0 {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration(float64(size) / float64(r) * float64(time.Second))
+}
+
+var sizeSuffixes = []struct {
+	suffix string
+	size   Size
+}{
+	// longest suffixes first so "MiB" isn't matched as "B"
+	{"KiB", Kilobyte}, {"MiB", Megabyte}, {"GiB", Gigabyte}, {"TiB", Terabyte}, {"PiB", Petabyte}, {"EiB", Exabyte},
+	{"KB", Kilobyte}, {"MB", Megabyte}, {"GB", Gigabyte}, {"TB", Terabyte}, {"PB", Petabyte}, {"EB", Exabyte},
+	{"K", Kilobyte}, {"M", Megabyte}, {"G", Gigabyte}, {"T", Terabyte}, {"P", Petabyte}, {"E", Exabyte},
+	{"B", Byte},
+}
+
+// parseSize parses strings like "10MiB" or "1.5 GB".  All units are powers of 1024, matching Size.
+func parseSize(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	mult := Byte
+	for _, suffix := range sizeSuffixes {
+		if strings.HasSuffix(s, suffix.suffix) {
+			s = strings.TrimSpace(strings.TrimSuffix(s, suffix.suffix))
+			mult = suffix.size
+			break
+		}
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	return f * float64(mult), nil
+}
+
+var perUnits = map[string]time.Duration{
+	"ns": time.Nanosecond, "us": time.Microsecond, "ms": time.Millisecond,
+	"s": time.Second, "sec": time.Second, "m": time.Minute, "min": time.Minute, "h": time.Hour,
+}
+
+// ParseRate parses rates like "10MiB/s", "512KB/100ms" or "1G/min".  Size units are powers of 1024
+// and the time unit can be any time.ParseDuration string, or a bare unit like "s", "min" or "h".
+func ParseRate(s string) (Rate, error) {
+	parts := strings.SplitN(s, "/", 2)
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("invalid rate %q: missing /", s)
+	}
+	size, err := parseSize(parts[0])
+	if err != nil {
+		return 0, fmt.Errorf("invalid rate %q: %s", s, err)
+	}
+	denom := strings.TrimSpace(parts[1])
+	per, exists := perUnits[denom]
+	if !exists {
+		if per, err = time.ParseDuration(denom); err != nil {
+			return 0, fmt.Errorf("invalid rate %q: %s", s, err)
+		}
+	}
+	if per <= 0 {
+		return 0, fmt.Errorf("invalid rate %q: duration must be positive", s)
+	}
+	return Rate(size / per.Seconds()), nil
+}
+
+// String formats the rate per second using the largest unit that keeps the value at least 1,
+// rounded to two decimals, for example "10MiB/s"
+func (r Rate) String() string {
+	units := []struct {
+		suffix string
+		rate   Rate
+	}{
+		{"EiB", Rate(Exabyte)}, {"PiB", Rate(Petabyte)}, {"TiB", Rate(Terabyte)},
+		{"GiB", GigabytePerSecond}, {"MiB", MegabytePerSecond}, {"KiB", KilobytePerSecond},
+	}
+	for _, u := range units {
+		if math.Abs(float64(r)) >= float64(u.rate) {
+			return formatRounded(float64(r/u.rate)) + u.suffix + "/s"
+		}
+	}
+	return formatRounded(float64(r)) + "B/s"
+}
+
+func formatRounded(f float64) string {
+	return strconv.FormatFloat(math.Round(f*100)/100, 'f', -1, 64)
+}
+
+// MarshalText formats the rate like String so rates can be used in config files
+func (r Rate) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// UnmarshalText parses the rate with ParseRate
+func (r *Rate) UnmarshalText(text []byte) error {
+	parsed, err := ParseRate(string(text))
+	if err != nil {
+		return err
+	}
+	*r = parsed
+	return nil
+}
@@ -0,0 +1,100 @@
+package dataunit
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Rate
+		wantErr bool
+	}{
+		{in: "10MiB/s", want: 10 * MegabytePerSecond},
+		{in: "10MB/s", want: 10 * MegabytePerSecond},
+		{in: "1.5 KiB / s", want: 1.5 * KilobytePerSecond},
+		{in: "512KB/500ms", want: 1024 * KilobytePerSecond},
+		{in: "60G/min", want: GigabytePerSecond},
+		{in: "3600B/h", want: BytePerSecond},
+		{in: "100/s", want: 100 * BytePerSecond},
+		{in: "2T/2s", want: Rate(Terabyte)},
+		{in: "10MiB", wantErr: true},
+		{in: "fastMiB/s", wantErr: true},
+		{in: "10MiB/fortnight", wantErr: true},
+		{in: "10MiB/-1s", wantErr: true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseRate(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseRate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRate_String(t *testing.T) {
+	tests := []struct {
+		r    Rate
+		want string
+	}{
+		{r: 10 * MegabytePerSecond, want: "10MiB/s"},
+		{r: 1.5 * KilobytePerSecond, want: "1.5KiB/s"},
+		{r: 100, want: "100B/s"},
+		{r: GigabytePerSecond / 3, want: "341.33MiB/s"},
+		{r: 2 * Rate(Terabyte), want: "2TiB/s"},
+	}
+	for _, tt := range tests {
+		if got := tt.r.String(); got != tt.want {
+			t.Errorf("Rate.String() = %v, want %v", got, tt.want)
+		}
+	}
+}
+
+func TestRate_Arithmetic(t *testing.T) {
+	r := NewRate(10*Megabyte, 2*time.Second)
+	if r != 5*MegabytePerSecond {
+		t.Errorf("NewRate() = %v", r)
+	}
+	if got := r.Per(time.Minute); got != 300*Megabyte {
+		t.Errorf("Rate.Per() = %v", got)
+	}
+	if got := r.TimeFor(Gigabyte); got != 204800*time.Millisecond {
+		t.Errorf("Rate.TimeFor() = %v", got)
+	}
+	if got := Rate(0).TimeFor(Byte); got != time.Duration(math.MaxInt64) {
+		t.Errorf("Rate.TimeFor() = %v", got)
+	}
+	if !math.IsInf(float64(NewRate(Byte, 0)), 1) {
+		t.Error("expected infinite rate")
+	}
+	if r+r != 10*MegabytePerSecond || r*2 <= r || r.BytesPerSecond() != 5*1024*1024 {
+		t.Error("unexpected arithmetic")
+	}
+}
+
+func TestRate_Text(t *testing.T) {
+	var conf struct {
+		Limit Rate `json:"limit"`
+	}
+	if err := json.Unmarshal([]byte(`{"limit":"2MiB/s"}`), &conf); err != nil {
+		t.Fatal(err)
+	}
+	if conf.Limit != 2*MegabytePerSecond {
+		t.Errorf("unmarshaled %v", conf.Limit)
+	}
+	b, err := json.Marshal(conf)
+	if err != nil || string(b) != `{"limit":"2MiB/s"}` {
+		t.Errorf("marshaled %s %v", b, err)
+	}
+	if err := json.Unmarshal([]byte(`{"limit":"fast"}`), &conf); err == nil {
+		t.Error("expected an error")
+	}
+}
@@ -0,0 +1,215 @@
+package distconf
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/signalfx/golib/v3/log"
+)
+
+// DefaultHistorySize is how many changes a Distconf remembers for its Handler
+var DefaultHistorySize = 128
+
+// RedactedValue replaces the values of secret config variables
+const RedactedValue = "<redacted>"
+
+// defaultSource is the source of variables no backing has a value for
+const defaultSource = "default"
+
+// DefaultRedact redacts keys that look like they hold secrets, like db.password or api_token
+func DefaultRedact(key string) bool {
+	key = strings.ToLower(key)
+	for _, secret := range []string{"password", "passwd", "secret", "token", "credential", "private_key", "apikey", "api_key"} {
+		if strings.Contains(key, secret) {
+			return true
+		}
+	}
+	return false
+}
+
+// Change is a change to a config variable's value, or an update of it that was rejected
+type Change struct {
+	Key      string      `json:"key"`
+	Time     time.Time   `json:"time"`
+	OldValue interface{} `json:"old_value"`
+	NewValue interface{} `json:"new_value"`
+	Source   string      `json:"source"`
+	Rejected string      `json:"rejected,omitempty"`
+}
+
+// VarState is the effective state of a config variable
+type VarState struct {
+	DistInfo
+	Value  interface{} `json:"value"`
+	Source string      `json:"source"`
+}
+
+// State is the effective state of a Distconf: every registered variable and its recent changes, oldest first
+type State struct {
+	Vars    map[string]VarState `json:"vars"`
+	History []Change            `json:"history"`
+}
+
+// named is implemented by backings to name themselves as the source of values
+type named interface {
+	name() string
+}
+
+func (p *envDisco) name() string {
+	return "env"
+}
+
+func (p *envPrefixDisco) name() string {
+	return "env:" + strings.TrimSuffix(p.prefix, "_")
+}
+
+func (p *cmdDisco) name() string {
+	return "cmd"
+}
+
+func (p *propertyFileDisco) name() string {
+	return "ini:" + p.filename
+}
+
+func (m *memConfig) name() string {
+	return "mem"
+}
+
+func (back *zkConfig) name() string {
+	return "zk"
+}
+
+func (v *vaultConfig) name() string {
+	return "vault"
+}
+
+func (f *fileConfig) name() string {
+	return "file:" + strings.Join(f.filenames, ",")
+}
+
+func readerName(r Reader) string {
+	if n, ok := r.(named); ok {
+		return n.name()
+	}
+	return fmt.Sprintf("%T", r)
+}
+
+// isSecret returns true if the value of key from source mustn't be shown.  Values from Vault are always
+// secret.
+func (c *Distconf) isSecret(key string, source string) bool {
+	return source == "vault" || (c.Redact != nil && c.Redact(key))
+}
+
+// redact returns value, or RedactedValue if it's a secret
+func (c *Distconf) redact(key string, source string, value interface{}) interface{} {
+	if c.isSecret(key, source) {
+		return RedactedValue
+	}
+	return value
+}
+
+// recordUpdate remembers the source of key's value, and the change if its value changed or the update was
+// rejected
+func (c *Distconf) recordUpdate(key string, source string, oldValue interface{}, configVar configVariable, err error) {
+	c.auditMutex.Lock()
+	defer c.auditMutex.Unlock()
+	change := Change{
+		Key:      key,
+		OldValue: c.redact(key, c.sources[key], oldValue),
+		Source:   source,
+	}
+	if err != nil {
+		// rejections quote the value
+		change.Rejected = c.redact(key, source, err.Error()).(string)
+	} else {
+		newValue := configVar.GenericGet()
+		prevSource, seen := c.sources[key]
+		c.sources[key] = source
+		if seen && prevSource == source && reflect.DeepEqual(oldValue, newValue) {
+			return
+		}
+		if !seen {
+			// the first read isn't a change, unless a backing had a value
+			if source == defaultSource {
+				return
+			}
+			change.OldValue = c.redact(key, defaultSource, oldValue)
+		}
+		change.NewValue = c.redact(key, source, newValue)
+	}
+	if c.HistorySize <= 0 {
+		return
+	}
+	change.Time = c.now()
+	if len(c.history) < c.HistorySize {
+		c.history = append(c.history, change)
+		return
+	}
+	c.history[c.historyNext%len(c.history)] = change
+	c.historyNext = (c.historyNext + 1) % len(c.history)
+}
+
+func (c *Distconf) now() time.Time {
+	if c.timeNow == nil {
+		return time.Now()
+	}
+	return c.timeNow()
+}
+
+// State returns every registered variable, with its value redacted if it's a secret, and the recent changes
+func (c *Distconf) State() State {
+	c.varsMutex.Lock()
+	vars := make(map[string]configVariable, len(c.registeredVars))
+	for k, v := range c.registeredVars {
+		vars[k] = v.distvar
+	}
+	c.varsMutex.Unlock()
+
+	c.infoMutex.RLock()
+	infos := make(map[string]DistInfo, len(c.distInfos))
+	for k, v := range c.distInfos {
+		infos[k] = v
+	}
+	c.infoMutex.RUnlock()
+
+	c.auditMutex.Lock()
+	defer c.auditMutex.Unlock()
+	ret := State{
+		Vars:    make(map[string]VarState, len(vars)),
+		History: make([]Change, 0, len(c.history)),
+	}
+	for k, v := range vars {
+		source, ok := c.sources[k]
+		if !ok {
+			source = defaultSource
+		}
+		info := infos[k]
+		info.DefaultValue = c.redact(k, "", v.GenericGetDefault())
+		info.DistType = v.Type()
+		ret.Vars[k] = VarState{
+			DistInfo: info,
+			Value:    c.redact(k, source, v.GenericGet()),
+			Source:   source,
+		}
+	}
+	ret.History = append(ret.History, c.history[c.historyNext:]...)
+	ret.History = append(ret.History, c.history[:c.historyNext]...)
+	return ret
+}
+
+// Handler returns an HTTP handler, for a debug server like httpdebug's, that responds with the State as
+// JSON
+func (c *Distconf) Handler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(rw)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(c.State()); err != nil {
+			c.Logger.Log(log.Err, err, "unable to write distconf state")
+		}
+	})
+}
@@ -0,0 +1,102 @@
+package distconf
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/signalfx/golib/v3/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDistconfState(t *testing.T) {
+	memConf, conf := makeConf()
+	defer conf.Close()
+	now := time.Unix(1600000000, 0)
+	conf.timeNow = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+
+	port := conf.Int("port", 80, Max(int64(65535)))
+	conf.Str("db.password", "hunter2")
+	log.IfErr(log.Panic, memConf.Write("port", []byte("8080")))
+	log.IfErr(log.Panic, memConf.Write("port", []byte("99999")))
+	log.IfErr(log.Panic, memConf.Write("db.password", []byte("correct horse")))
+	log.IfErr(log.Panic, memConf.Write("port", nil))
+	assert.Equal(t, int64(80), port.Get())
+	log.IfErr(log.Panic, memConf.Write("port", []byte("8081")))
+
+	state := conf.State()
+	assert.Equal(t, int64(8081), state.Vars["port"].Value)
+	assert.Equal(t, "mem", state.Vars["port"].Source)
+	assert.Equal(t, int64(80), state.Vars["port"].DefaultValue)
+	assert.Equal(t, IntType, state.Vars["port"].DistType)
+	assert.NotEmpty(t, state.Vars["port"].File)
+	assert.Equal(t, RedactedValue, state.Vars["db.password"].Value)
+	assert.Equal(t, RedactedValue, state.Vars["db.password"].DefaultValue)
+
+	require.Len(t, state.History, 5)
+	assert.Equal(t, Change{Key: "port", Time: time.Unix(1600000001, 0), OldValue: int64(80), NewValue: int64(8080), Source: "mem"}, state.History[0])
+	assert.Equal(t, "port", state.History[1].Key)
+	assert.Contains(t, state.History[1].Rejected, "99999 is above the maximum")
+	assert.Equal(t, int64(8080), state.History[1].OldValue)
+	assert.Equal(t, Change{Key: "db.password", Time: time.Unix(1600000003, 0), OldValue: RedactedValue, NewValue: RedactedValue, Source: "mem"}, state.History[2])
+	assert.Equal(t, Change{Key: "port", Time: time.Unix(1600000004, 0), OldValue: int64(8080), NewValue: int64(80), Source: "default"}, state.History[3])
+	assert.Equal(t, int64(8081), state.History[4].NewValue)
+
+	// the history is a ring
+	conf.HistorySize = 5
+	log.IfErr(log.Panic, memConf.Write("port", []byte("8082")))
+	log.IfErr(log.Panic, memConf.Write("port", []byte("8083")))
+	state = conf.State()
+	require.Len(t, state.History, 5)
+	assert.Equal(t, "db.password", state.History[0].Key)
+	assert.Equal(t, int64(8083), state.History[4].NewValue)
+	assert.True(t, state.History[3].Time.Before(state.History[4].Time))
+
+	conf.HistorySize = 0
+	log.IfErr(log.Panic, memConf.Write("port", []byte("8084")))
+	assert.Equal(t, int64(8083), conf.State().History[4].NewValue)
+}
+
+func TestDistconfStateSecrets(t *testing.T) {
+	memConf, conf := makeConf()
+	defer conf.Close()
+	c := log.NewChannelLogger(10, nil)
+	conf.Logger = c
+	conf.Int("api_token", 0)
+	log.IfErr(log.Panic, memConf.Write("api_token", []byte("s3cr3t")))
+	logged := <-c.Out
+	assert.NotContains(t, logged, "s3cr3t")
+	assert.Contains(t, conf.State().History[0].Rejected, RedactedValue)
+
+	assert.True(t, DefaultRedact("DB_PASSWORD"))
+	assert.False(t, DefaultRedact("db.host"))
+	assert.Equal(t, "vault", readerName(&vaultConfig{}))
+	assert.Equal(t, "ini:a.ini", readerName(&propertyFileDisco{filename: "a.ini"}))
+	assert.Equal(t, "*distconf.allErrorBacking", readerName(&allErrorBacking{}))
+}
+
+func TestDistconfHandler(t *testing.T) {
+	memConf, conf := makeConf()
+	defer conf.Close()
+	conf.Str("name", "a")
+	log.IfErr(log.Panic, memConf.Write("name", []byte("b")))
+
+	rw := httptest.NewRecorder()
+	conf.Handler().ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/debug/distconf", nil))
+	assert.Equal(t, "application/json", rw.Header().Get("Content-Type"))
+	var state struct {
+		Vars    map[string]map[string]interface{} `json:"vars"`
+		History []map[string]interface{}          `json:"history"`
+	}
+	require.NoError(t, json.Unmarshal(rw.Body.Bytes(), &state))
+	assert.Equal(t, "b", state.Vars["name"]["value"])
+	assert.Equal(t, "mem", state.Vars["name"]["source"])
+	assert.Equal(t, "a", state.Vars["name"]["default_value"])
+	assert.Equal(t, "b", state.History[0]["new_value"])
+}
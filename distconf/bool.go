@@ -4,6 +4,8 @@ import (
 	"strconv"
 	"sync"
 	"sync/atomic"
+
+	"github.com/signalfx/golib/v3/errors"
 )
 
 // BoolWatch is executed if registered on a Bool variable any time the Bool contents change
@@ -35,7 +37,7 @@ func (s *boolConf) Update(newValue []byte) error {
 	} else {
 		newValueStr := string(newValue)
 		if parsedBool, err := strconv.ParseBool(newValueStr); err != nil {
-			atomic.StoreInt32(&s.currentVal, s.defaultVal)
+			return errors.Annotatef(err, "unable to parse bool %s", newValueStr)
 		} else if parsedBool {
 			atomic.StoreInt32(&s.currentVal, 1)
 		} else {
@@ -0,0 +1,103 @@
+package distconf
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/signalfx/golib/v3/errors"
+)
+
+// Constraint checks a new value of a config variable, returning why it isn't allowed
+type Constraint[T any] func(value T) error
+
+// ConstraintError is returned when an update breaks a variable's constraints.  The variable keeps its
+// previous value.
+type ConstraintError struct {
+	Value  string
+	Reason error
+}
+
+func (e *ConstraintError) Error() string {
+	return fmt.Sprintf("rejected %q: %s", e.Value, e.Reason)
+}
+
+type bound interface {
+	~int64 | ~float64
+}
+
+// Min rejects values below min
+func Min[T bound](min T) Constraint[T] {
+	return func(value T) error {
+		if value < min {
+			return errors.Errorf("%v is below the minimum %v", value, min)
+		}
+		return nil
+	}
+}
+
+// Max rejects values above max
+func Max[T bound](max T) Constraint[T] {
+	return func(value T) error {
+		if value > max {
+			return errors.Errorf("%v is above the maximum %v", value, max)
+		}
+		return nil
+	}
+}
+
+type sized interface {
+	~string | ~[]string
+}
+
+// MinLen rejects strings, or lists, shorter than min
+func MinLen[T sized](min int) Constraint[T] {
+	return func(value T) error {
+		if len(value) < min {
+			return errors.Errorf("length %d is below the minimum %d", len(value), min)
+		}
+		return nil
+	}
+}
+
+// MaxLen rejects strings, or lists, longer than max
+func MaxLen[T sized](max int) Constraint[T] {
+	return func(value T) error {
+		if len(value) > max {
+			return errors.Errorf("length %d is above the maximum %d", len(value), max)
+		}
+		return nil
+	}
+}
+
+// OneOf rejects strings other than values
+func OneOf(values ...string) Constraint[string] {
+	return func(value string) error {
+		for _, v := range values {
+			if v == value {
+				return nil
+			}
+		}
+		return errors.Errorf("%s is not one of %s", value, strings.Join(values, ", "))
+	}
+}
+
+// Matches rejects strings that don't match re
+func Matches(re *regexp.Regexp) Constraint[string] {
+	return func(value string) error {
+		if !re.MatchString(value) {
+			return errors.Errorf("%s does not match %s", value, re)
+		}
+		return nil
+	}
+}
+
+// checkConstraints returns a ConstraintError for the first constraint value breaks
+func checkConstraints[T any](constraints []Constraint[T], raw []byte, value T) error {
+	for _, c := range constraints {
+		if err := c(value); err != nil {
+			return &ConstraintError{Value: string(raw), Reason: err}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package distconf
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/signalfx/golib/v3/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConstraints(t *testing.T) {
+	assert.NoError(t, Min(int64(1))(1))
+	assert.Error(t, Min(int64(1))(0))
+	assert.NoError(t, Max(1.5)(1.5))
+	assert.Error(t, Max(1.5)(2))
+	assert.Error(t, Min(time.Second)(time.Millisecond))
+	assert.NoError(t, OneOf("a", "b")("b"))
+	assert.EqualError(t, OneOf("a", "b")("c"), "c is not one of a, b")
+	assert.NoError(t, Matches(regexp.MustCompile("^[a-z]+$"))("abc"))
+	assert.Error(t, Matches(regexp.MustCompile("^[a-z]+$"))("ABC"))
+	assert.NoError(t, MinLen[string](1)("a"))
+	assert.EqualError(t, MinLen[string](1)(""), "length 0 is below the minimum 1")
+	assert.NoError(t, MaxLen[[]string](1)([]string{"a"}))
+	assert.Error(t, MaxLen[[]string](1)([]string{"a", "b"}))
+
+	err := checkConstraints([]Constraint[int64]{Min(int64(0)), Max(int64(10))}, []byte("11"), 11)
+	assert.EqualError(t, err, `rejected "11": 11 is above the maximum 10`)
+	assert.NoError(t, checkConstraints([]Constraint[int64]{Min(int64(0)), Max(int64(10))}, []byte("5"), 5))
+}
+
+func TestDistconfConstraints(t *testing.T) {
+	memConf, conf := makeConf()
+	defer conf.Close()
+
+	i := conf.Int("int", 5, Min(int64(1)), Max(int64(10)))
+	f := conf.Float("float", 0.5, Min(0.0), Max(1.0))
+	d := conf.Duration("duration", time.Second, Min(time.Millisecond))
+	s := conf.Str("str", "info", OneOf("debug", "info", "warn"))
+
+	log.IfErr(log.Panic, memConf.Write("int", []byte("7")))
+	log.IfErr(log.Panic, memConf.Write("int", []byte("11")))
+	assert.Equal(t, int64(7), i.Get())
+
+	log.IfErr(log.Panic, memConf.Write("float", []byte("-1")))
+	assert.Equal(t, 0.5, f.Get())
+
+	log.IfErr(log.Panic, memConf.Write("duration", []byte("1us")))
+	assert.Equal(t, time.Second, d.Get())
+	log.IfErr(log.Panic, memConf.Write("duration", []byte("2s")))
+	assert.Equal(t, time.Second*2, d.Get())
+
+	log.IfErr(log.Panic, memConf.Write("str", []byte("trace")))
+	assert.Equal(t, "info", s.Get())
+	log.IfErr(log.Panic, memConf.Write("str", []byte("warn")))
+	assert.Equal(t, "warn", s.Get())
+
+	// unparsable values are rejected too
+	log.IfErr(log.Panic, memConf.Write("duration", []byte("soon")))
+	assert.Equal(t, time.Second*2, d.Get())
+	log.IfErr(log.Panic, memConf.Write("int", []byte("lots")))
+	assert.Equal(t, int64(7), i.Get())
+
+	b := conf.Bool("bool", false)
+	log.IfErr(log.Panic, memConf.Write("bool", []byte("true")))
+	log.IfErr(log.Panic, memConf.Write("bool", []byte("maybe")))
+	assert.True(t, b.Get())
+
+	hosts := conf.StringSlice("hosts", []string{"a"}, MinLen[[]string](1))
+	log.IfErr(log.Panic, memConf.Write("hosts", []byte("b,c")))
+	log.IfErr(log.Panic, memConf.Write("hosts", []byte("[]")))
+	assert.Equal(t, []string{"b", "c"}, hosts.Get())
+
+	j := conf.JSON("json", &testJSONConf{Retries: 1}, func(value interface{}) error {
+		if value.(*testJSONConf).Retries < 0 {
+			return errNope
+		}
+		return nil
+	})
+	log.IfErr(log.Panic, memConf.Write("json", []byte(`{"retries": -1}`)))
+	assert.Equal(t, 1, j.Get().(*testJSONConf).Retries)
+	log.IfErr(log.Panic, memConf.Write("json", []byte(`{"retries": 2}`)))
+	assert.Equal(t, 2, j.Get().(*testJSONConf).Retries)
+
+	// removing a value still goes back to the default
+	log.IfErr(log.Panic, memConf.Write("int", nil))
+	assert.Equal(t, int64(5), i.Get())
+
+	assert.Equal(t, `{"bool":1,"duration":2,"float":1,"hosts":1,"int":2,"json":1,"str":1}`, conf.Rejected().String())
+}
@@ -3,10 +3,12 @@ package distconf
 import (
 	"expvar"
 	"math"
+	"reflect"
 	"runtime"
 	"sync"
 	"time"
 
+	"github.com/signalfx/golib/v3/errors"
 	"github.com/signalfx/golib/v3/log"
 	"github.com/signalfx/golib/v3/logkey"
 )
@@ -16,14 +18,30 @@ var DefaultLogger = log.Logger(log.DefaultLogger.CreateChild())
 
 // Distconf gets configuration data from the first backing that has it
 type Distconf struct {
-	Logger  log.Logger
-	readers []Reader
+	Logger log.Logger
+	// Redact returns true for keys whose values are secrets, that State and Handler don't show
+	Redact func(key string) bool
+	// HistorySize is how many changes State and Handler remember
+	HistorySize int
+	readers     []Reader
 
 	varsMutex      sync.Mutex
 	infoMutex      sync.RWMutex
 	registeredVars map[string]*registeredVariableTracker
 	distInfos      map[string]DistInfo
 	callerFunc     func(int) (uintptr, string, int, bool)
+
+	rejectedMutex sync.Mutex
+	rejected      map[string]int64
+
+	auditMutex  sync.Mutex
+	sources     map[string]string
+	history     []Change
+	historyNext int
+	timeNow     func() time.Time
+
+	overrideMutex sync.Mutex
+	overrides     map[string]*override
 }
 
 type registeredVariableTracker struct {
@@ -35,9 +53,14 @@ type registeredVariableTracker struct {
 func New(readers []Reader) *Distconf {
 	return &Distconf{
 		Logger:         DefaultLogger,
+		Redact:         DefaultRedact,
+		HistorySize:    DefaultHistorySize,
 		readers:        readers,
 		registeredVars: make(map[string]*registeredVariableTracker),
 		distInfos:      make(map[string]DistInfo),
+		rejected:       make(map[string]int64),
+		sources:        make(map[string]string),
+		overrides:      make(map[string]*override),
 	}
 }
 
@@ -70,6 +93,10 @@ const (
 	DurationType
 	// IntType is type Int
 	IntType
+	// StringSliceType is type StringSlice
+	StringSliceType
+	// JSONType is type JSON
+	JSONType
 )
 
 // DistInfo is useful to unmarshal/marshal the Info expvar
@@ -136,11 +163,29 @@ func (c *Distconf) Info() expvar.Var {
 	})
 }
 
-// Int object that can be referenced to get integer values from a backing config
-func (c *Distconf) Int(key string, defaultVal int64) *Int {
+// Rejected returns an expvar variable that shows how many updates of each configuration variable were
+// rejected for being unparsable or breaking its constraints.  Rejected updates are logged, and the
+// variable keeps its previous value.
+func (c *Distconf) Rejected() expvar.Var {
+	return expvar.Func(func() interface{} {
+		c.rejectedMutex.Lock()
+		defer c.rejectedMutex.Unlock()
+
+		m := make(map[string]int64, len(c.rejected))
+		for k, v := range c.rejected {
+			m[k] = v
+		}
+		return m
+	})
+}
+
+// Int object that can be referenced to get integer values from a backing config.  Updates that break a
+// constraint, like Min or Max, are rejected and the previous value is kept.
+func (c *Distconf) Int(key string, defaultVal int64, constraints ...Constraint[int64]) *Int {
 	c.grabInfo(key)
 	s := &intConf{
-		defaultVal: defaultVal,
+		defaultVal:  defaultVal,
+		constraints: constraints,
 		Int: Int{
 			currentVal: defaultVal,
 		},
@@ -154,11 +199,13 @@ func (c *Distconf) Int(key string, defaultVal int64) *Int {
 	return &ret.Int
 }
 
-// Float object that can be referenced to get float values from a backing config
-func (c *Distconf) Float(key string, defaultVal float64) *Float {
+// Float object that can be referenced to get float values from a backing config.  Updates that break a
+// constraint, like Min or Max, are rejected and the previous value is kept.
+func (c *Distconf) Float(key string, defaultVal float64, constraints ...Constraint[float64]) *Float {
 	c.grabInfo(key)
 	s := &floatConf{
-		defaultVal: defaultVal,
+		defaultVal:  defaultVal,
+		constraints: constraints,
 		Float: Float{
 			currentVal: math.Float64bits(defaultVal),
 		},
@@ -172,11 +219,13 @@ func (c *Distconf) Float(key string, defaultVal float64) *Float {
 	return &ret.Float
 }
 
-// Str object that can be referenced to get string values from a backing config
-func (c *Distconf) Str(key string, defaultVal string) *Str {
+// Str object that can be referenced to get string values from a backing config.  Updates that break a
+// constraint, like OneOf or Matches, are rejected and the previous value is kept.
+func (c *Distconf) Str(key string, defaultVal string, constraints ...Constraint[string]) *Str {
 	c.grabInfo(key)
 	s := &strConf{
-		defaultVal: defaultVal,
+		defaultVal:  defaultVal,
+		constraints: constraints,
 	}
 	s.currentVal.Store(defaultVal)
 	// Note: in race conditions 's' may not be the thing actually returned
@@ -213,15 +262,16 @@ func (c *Distconf) Bool(key string, defaultVal bool) *Bool {
 	return &ret.Bool
 }
 
-// Duration returns a duration object that calls ParseDuration() on the given key
-func (c *Distconf) Duration(key string, defaultVal time.Duration) *Duration {
+// Duration returns a duration object that calls ParseDuration() on the given key.  Updates that break a
+// constraint, like Min or Max, are rejected and the previous value is kept.
+func (c *Distconf) Duration(key string, defaultVal time.Duration, constraints ...Constraint[time.Duration]) *Duration {
 	c.grabInfo(key)
 	s := &durationConf{
-		defaultVal: defaultVal,
+		defaultVal:  defaultVal,
+		constraints: constraints,
 		Duration: Duration{
 			currentVal: defaultVal.Nanoseconds(),
 		},
-		logger: log.NewContext(c.Logger).With(logkey.DistconfKey, key),
 	}
 	// Note: in race conditions 's' may not be the thing actually returned
 	ret, okCast := c.createOrGet(key, s).(*durationConf)
@@ -232,6 +282,51 @@ func (c *Distconf) Duration(key string, defaultVal time.Duration) *Duration {
 	return &ret.Duration
 }
 
+// StringSlice object that can be referenced to get lists of strings from a backing config.  Values are a
+// JSON list of strings or comma separated.  Updates that break a constraint are rejected and the previous
+// value is kept.
+func (c *Distconf) StringSlice(key string, defaultVal []string, constraints ...Constraint[[]string]) *StringSlice {
+	c.grabInfo(key)
+	s := &stringSliceConf{
+		defaultVal:  defaultVal,
+		constraints: constraints,
+	}
+	s.currentVal.Store(defaultVal)
+	// Note: in race conditions 's' may not be the thing actually returned
+	ret, okCast := c.createOrGet(key, s).(*stringSliceConf)
+	if !okCast {
+		c.Logger.Log(logkey.DistconfKey, key, "Registering key with multiple types!  FIX ME!!!!")
+		return nil
+	}
+	return &ret.StringSlice
+}
+
+// JSON object that can be referenced to get values unmarshalled from JSON in a backing config.
+// defaultVal must be a pointer, like &MyConfig{...}, and each change is unmarshalled into a new value of
+// the same type.  Unparsable updates, and ones that break a constraint, are rejected and the previous value
+// is kept.  Constraints are given the new value as a pointer of the default's type.
+func (c *Distconf) JSON(key string, defaultVal interface{}, constraints ...Constraint[interface{}]) *JSON {
+	valueType := reflect.TypeOf(defaultVal)
+	if valueType == nil || valueType.Kind() != reflect.Ptr {
+		c.Logger.Log(logkey.DistconfKey, key, "JSON config defaults must be pointers!  FIX ME!!!!")
+		return nil
+	}
+	c.grabInfo(key)
+	s := &jsonConf{
+		defaultVal:  defaultVal,
+		valueType:   valueType.Elem(),
+		constraints: constraints,
+	}
+	s.currentVal.Store(jsonHolder{defaultVal})
+	// Note: in race conditions 's' may not be the thing actually returned
+	ret, okCast := c.createOrGet(key, s).(*jsonConf)
+	if !okCast || ret.valueType != s.valueType {
+		c.Logger.Log(logkey.DistconfKey, key, "Registering key with multiple types!  FIX ME!!!!")
+		return nil
+	}
+	return &ret.JSON
+}
+
 // Close this config framework's readers.  Config variable results are undefined after this call.
 func (c *Distconf) Close() {
 	c.varsMutex.Lock()
@@ -241,7 +336,13 @@ func (c *Distconf) Close() {
 	}
 }
 
-func (c *Distconf) refresh(key string, configVar configVariable) bool {
+// refresh updates configVar from the override of key, or else the first backing with a value for it,
+// returning true if the value can change later and the error if the update was rejected
+func (c *Distconf) refresh(key string, configVar configVariable) (bool, error) {
+	if value, ok := c.overrideValue(key); ok {
+		// the backings are used again when the override is cleared, so any of them changing matters
+		return c.hasDynamicReader(), c.update(key, overrideSource, value, configVar)
+	}
 	dynamicReadersOnPath := false
 	for _, backing := range c.readers {
 		if !dynamicReadersOnPath {
@@ -257,20 +358,48 @@ func (c *Distconf) refresh(key string, configVar configVariable) bool {
 			continue
 		}
 		if v != nil {
-			e = configVar.Update(v)
-			if e != nil {
-				c.Logger.Log(logkey.DistconfKey, key, log.Err, e, "Invalid config bytes")
-			}
-			return dynamicReadersOnPath
+			return dynamicReadersOnPath, c.update(key, readerName(backing), v, configVar)
 		}
 	}
 
-	if e := configVar.Update(nil); e != nil {
+	oldValue := configVar.GenericGet()
+	e := configVar.Update(nil)
+	c.recordUpdate(key, defaultSource, oldValue, configVar, e)
+	if e != nil {
 		c.Logger.Log(log.Err, e, "Unable to set bytes to nil/clear")
 	}
 
 	// If this is false, then the variable is fixed and can never change
-	return dynamicReadersOnPath
+	return dynamicReadersOnPath, nil
+}
+
+// update sets configVar to the value of key from source, counting and logging the update if it's rejected
+func (c *Distconf) update(key string, source string, v []byte, configVar configVariable) error {
+	oldValue := configVar.GenericGet()
+	e := configVar.Update(v)
+	c.recordUpdate(key, source, oldValue, configVar, e)
+	if e == nil {
+		return nil
+	}
+	c.rejectedMutex.Lock()
+	c.rejected[key]++
+	c.rejectedMutex.Unlock()
+	newVal := string(v)
+	if c.isSecret(key, source) {
+		// errors quote the value
+		newVal, e = RedactedValue, errors.New("invalid secret value")
+	}
+	c.Logger.Log(logkey.DistconfKey, key, logkey.DistconfNewVal, newVal, log.Err, e, "Invalid config bytes")
+	return e
+}
+
+func (c *Distconf) hasDynamicReader() bool {
+	for _, backing := range c.readers {
+		if _, ok := backing.(Dynamic); ok {
+			return true
+		}
+	}
+	return false
 }
 
 func (c *Distconf) watch(key string, _ configVariable) {
@@ -297,7 +426,7 @@ func (c *Distconf) createOrGet(key string, defaultVar configVariable) configVari
 	c.varsMutex.Unlock()
 
 	rv.hasInitialized.Do(func() {
-		dynamicOnPath := c.refresh(key, rv.distvar)
+		dynamicOnPath, _ := c.refresh(key, rv.distvar)
 		if dynamicOnPath {
 			c.watch(key, rv.distvar)
 		}
@@ -313,7 +442,7 @@ func (c *Distconf) onBackingChange(key string) {
 		c.Logger.Log(logkey.DistconfKey, key, "Backing callback on variable that doesn't exist")
 		return
 	}
-	c.refresh(key, m.distvar)
+	_, _ = c.refresh(key, m.distvar)
 }
 
 // Reader can get a []byte value for a config key
@@ -173,9 +173,9 @@ func TestDistconfDuration(t *testing.T) {
 	var nilDuration *Duration
 	assert.Equal(t, nilDuration, conf.Duration("testval_other", 0))
 
-	// update to invalid
+	// update to invalid keeps the previous value
 	log.IfErr(log.Panic, memConf.Write("testval", []byte("abcd")))
-	assert.Equal(t, time.Second, val.Get())
+	assert.Equal(t, time.Millisecond*10, val.Get())
 
 	// update to nil
 	log.IfErr(log.Panic, memConf.Write("testval", nil))
@@ -221,6 +221,85 @@ func TestDistconfBool(t *testing.T) {
 	assert.Contains(t, conf.Var().String(), "testval")
 }
 
+func TestDistconfStringSlice(t *testing.T) {
+	memConf, conf := makeConf()
+	defer conf.Close()
+	// default
+	val := conf.StringSlice("testval", []string{"a"})
+	assert.Equal(t, []string{"a"}, val.Get())
+	totalWatches := 0
+	val.Watch(func(_ *StringSlice, oldValue []string) {
+		totalWatches++
+	})
+
+	// update comma separated
+	log.IfErr(log.Panic, memConf.Write("testval", []byte(" b, c,,")))
+	assert.Equal(t, []string{"b", "c"}, val.Get())
+
+	// update JSON, to the same value
+	log.IfErr(log.Panic, memConf.Write("testval", []byte(`["b", "c"]`)))
+	assert.Equal(t, []string{"b", "c"}, val.Get())
+
+	// update to invalid
+	log.IfErr(log.Panic, memConf.Write("testval", []byte(`["b"`)))
+	assert.Equal(t, []string{"b", "c"}, val.Get())
+
+	// check already registered
+	var nilSlice *StringSlice
+	conf.Str("testval_other2", "moo")
+	assert.Equal(t, nilSlice, conf.StringSlice("testval_other2", nil))
+
+	// update to nil
+	log.IfErr(log.Panic, memConf.Write("testval", nil))
+	assert.Equal(t, []string{"a"}, val.Get())
+
+	assert.Equal(t, 2, totalWatches)
+	assert.Contains(t, conf.Var().String(), "testval")
+}
+
+type testJSONConf struct {
+	Hosts   []string `json:"hosts"`
+	Retries int      `json:"retries"`
+}
+
+func TestDistconfJSON(t *testing.T) {
+	memConf, conf := makeConf()
+	defer conf.Close()
+	// default
+	def := &testJSONConf{Retries: 1}
+	val := conf.JSON("testval", def)
+	assert.Equal(t, def, val.Get())
+	var olds []interface{}
+	val.Watch(func(_ *JSON, oldValue interface{}) {
+		olds = append(olds, oldValue)
+	})
+
+	// update valid
+	log.IfErr(log.Panic, memConf.Write("testval", []byte(`{"hosts": ["a"], "retries": 3}`)))
+	assert.Equal(t, &testJSONConf{Hosts: []string{"a"}, Retries: 3}, val.Get())
+	assert.Equal(t, &testJSONConf{Retries: 1}, def)
+
+	// update to the same bytes
+	log.IfErr(log.Panic, memConf.Write("testval", []byte(`{"hosts": ["a"], "retries": 3}`)))
+
+	// update to invalid
+	log.IfErr(log.Panic, memConf.Write("testval", []byte(`{"retries": "many"}`)))
+	assert.Equal(t, 3, val.Get().(*testJSONConf).Retries)
+
+	// update to nil
+	log.IfErr(log.Panic, memConf.Write("testval", nil))
+	assert.Equal(t, def, val.Get())
+	assert.Equal(t, []interface{}{def, &testJSONConf{Hosts: []string{"a"}, Retries: 3}}, olds)
+
+	// check already registered, and defaults that aren't pointers
+	var nilJSON *JSON
+	assert.Equal(t, nilJSON, conf.JSON("testval", &struct{}{}))
+	assert.Equal(t, nilJSON, conf.JSON("testval_other", testJSONConf{}))
+	conf.Str("testval_other", "moo")
+	assert.Equal(t, nilJSON, conf.JSON("testval_other", def))
+	assert.Contains(t, conf.Var().String(), "testval")
+}
+
 func TestDistconfErrorBackings(t *testing.T) {
 	conf := New([]Reader{&allErrorBacking{}})
 
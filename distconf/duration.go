@@ -5,8 +5,7 @@ import (
 	"sync/atomic"
 	"time"
 
-	"github.com/signalfx/golib/v3/log"
-	"github.com/signalfx/golib/v3/logkey"
+	"github.com/signalfx/golib/v3/errors"
 )
 
 // DurationWatch is executed if registered on a Duration variable any time the contents change
@@ -14,8 +13,8 @@ type DurationWatch func(duration *Duration, oldValue time.Duration)
 
 type durationConf struct {
 	Duration
-	defaultVal time.Duration
-	logger     log.Logger
+	defaultVal  time.Duration
+	constraints []Constraint[time.Duration]
 }
 
 // Duration is a duration type config inside a Config.
@@ -43,11 +42,12 @@ func (s *durationConf) Update(newValue []byte) error {
 	} else {
 		newValDuration, err := time.ParseDuration(string(newValue))
 		if err != nil {
-			s.logger.Log(log.Err, err, logkey.DistconfNewVal, string(newValue), "Invalid duration string")
-			atomic.StoreInt64(&s.currentVal, int64(s.defaultVal))
-		} else {
-			atomic.StoreInt64(&s.currentVal, int64(newValDuration))
+			return errors.Annotatef(err, "unable to parse duration %s", newValue)
 		}
+		if err := checkConstraints(s.constraints, newValue, newValDuration); err != nil {
+			return err
+		}
+		atomic.StoreInt64(&s.currentVal, int64(newValDuration))
 	}
 	if oldValue != s.Get() {
 		for _, w := range s.watches {
@@ -1,6 +1,17 @@
 package distconf
 
-import "os"
+import (
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/signalfx/golib/v3/errors"
+	"github.com/signalfx/golib/v3/log"
+	"github.com/signalfx/golib/v3/logkey"
+	"github.com/signalfx/golib/v3/pointer"
+)
 
 type envDisco struct {
 	noopCloser
@@ -25,3 +36,194 @@ func EnvLoader() BackingLoader {
 		return Env(), nil
 	})
 }
+
+// EnvPrefixConfig configures an environment variable backing
+type EnvPrefixConfig struct {
+	// Files are environment files, of KEY=VALUE lines, read on top of the process's environment.  Later
+	// files override earlier ones.
+	Files []string
+	// RefreshInterval is how often the environment is read again.  Zero only reads it again on a signal.
+	RefreshInterval *time.Duration
+	// ReloadSignals read the environment again when the process gets them, like syscall.SIGHUP.  None by
+	// default: listening for a signal changes what it does to the whole process, like SIGHUP no longer
+	// terminating it, so it's up to the caller to opt in.
+	ReloadSignals []os.Signal
+	Logger        log.Logger
+}
+
+// DefaultEnvPrefixConfig is used for any unset environment config parameter
+var DefaultEnvPrefixConfig = &EnvPrefixConfig{
+	RefreshInterval: pointer.Duration(0),
+	Logger:          DefaultLogger,
+}
+
+type envPrefixDisco struct {
+	conf       EnvPrefixConfig
+	prefix     string
+	logger     log.Logger
+	callbacks  callbackMap
+	signals    chan os.Signal
+	shouldQuit chan struct{}
+	done       chan struct{}
+	closeOnce  sync.Once
+
+	mu     sync.RWMutex
+	values map[string][]byte
+}
+
+// EnvPrefix creates a backing that reads the environment variables starting with prefix and an underscore,
+// as keys in lower case with the underscores replaced by dots, so with the prefix APP, APP_DB_HOST is the
+// key db.host.  Double underscores are kept as one, so APP_MAX__CONNS is the key max_conns.  Environment
+// files, like the ones service managers are given, are read on top of the environment, and read again every
+// RefreshInterval or on one of the ReloadSignals, if they're set, calling the changed keys' watches.
+func EnvPrefix(prefix string, conf *EnvPrefixConfig) (Reader, error) {
+	cfg := pointer.FillDefaultFrom(conf, DefaultEnvPrefixConfig).(*EnvPrefixConfig)
+	prefix = strings.TrimSuffix(prefix, "_")
+	if prefix == "" {
+		return nil, errors.New("environment backing needs a prefix")
+	}
+	ret := &envPrefixDisco{
+		conf:   *cfg,
+		prefix: prefix + "_",
+		logger: log.NewContext(cfg.Logger).With(logkey.DistconfBacking, "env"),
+		callbacks: callbackMap{
+			callbacks: make(map[string][]backingCallbackFunction),
+		},
+		signals:    make(chan os.Signal, 1),
+		shouldQuit: make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	values, err := ret.read()
+	if err != nil {
+		return nil, err
+	}
+	ret.values = values
+	if len(cfg.ReloadSignals) > 0 {
+		signal.Notify(ret.signals, cfg.ReloadSignals...)
+	}
+	go ret.refreshLoop()
+	return ret, nil
+}
+
+// EnvPrefixLoader is a loading helper for EnvPrefix config variables
+func EnvPrefixLoader(prefix string, conf *EnvPrefixConfig) BackingLoader {
+	return BackingLoaderFunc(func() (Reader, error) {
+		return EnvPrefix(prefix, conf)
+	})
+}
+
+// Get returns the value of the environment variable for key
+func (p *envPrefixDisco) Get(key string) ([]byte, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.values[key], nil
+}
+
+// Watch calls callback when the value of key changes
+func (p *envPrefixDisco) Watch(key string, callback backingCallbackFunction) error {
+	p.callbacks.add(key, callback)
+	return nil
+}
+
+// Close stops reading the environment again
+func (p *envPrefixDisco) Close() {
+	p.closeOnce.Do(func() {
+		signal.Stop(p.signals)
+		close(p.shouldQuit)
+	})
+	<-p.done
+}
+
+func (p *envPrefixDisco) refreshLoop() {
+	defer close(p.done)
+	var tick <-chan time.Time
+	if *p.conf.RefreshInterval > 0 {
+		ticker := time.NewTicker(*p.conf.RefreshInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-p.shouldQuit:
+			return
+		case <-tick:
+			p.refresh()
+		case <-p.signals:
+			p.refresh()
+		}
+	}
+}
+
+// refresh reads the environment again and calls the watches of the keys that changed
+func (p *envPrefixDisco) refresh() {
+	values, err := p.read()
+	if err != nil {
+		p.logger.Log(log.Err, err, "unable to refresh environment")
+		return
+	}
+	p.mu.Lock()
+	old := p.values
+	p.values = values
+	p.mu.Unlock()
+	p.callbacks.changed(old, values)
+}
+
+// read returns the keys of the prefixed variables in the environment and environment files
+func (p *envPrefixDisco) read() (map[string][]byte, error) {
+	values := make(map[string][]byte)
+	p.add(values, os.Environ())
+	for _, filename := range p.conf.Files {
+		lines, err := readEnvFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		p.add(values, lines)
+	}
+	return values, nil
+}
+
+// add adds the prefixed KEY=VALUE variables in env to values
+func (p *envPrefixDisco) add(values map[string][]byte, env []string) {
+	for _, kv := range env {
+		name, value, ok := strings.Cut(kv, "=")
+		if !ok || !strings.HasPrefix(name, p.prefix) || len(name) == len(p.prefix) {
+			continue
+		}
+		parts := strings.Split(strings.ToLower(name[len(p.prefix):]), "__")
+		for i := range parts {
+			parts[i] = strings.ReplaceAll(parts[i], "_", ".")
+		}
+		key := strings.Join(parts, "_")
+		if value == "" {
+			delete(values, key)
+			continue
+		}
+		values[key] = []byte(value)
+	}
+}
+
+// readEnvFile returns the KEY=VALUE lines of an environment file.  Blank lines and # comments are skipped,
+// an export before the name is allowed, and quotes around the value are removed.
+func readEnvFile(filename string) ([]string, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Annotatef(err, "Unable to open file %s", filename)
+	}
+	var ret []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		ret = append(ret, strings.TrimSpace(name)+"="+value)
+	}
+	return ret, nil
+}
@@ -2,10 +2,12 @@ package distconf
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/signalfx/golib/v3/log"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestEnvConf(t *testing.T) {
@@ -21,3 +23,49 @@ func TestEnvConf(t *testing.T) {
 	assert.Equal(t, []byte("abc"), b)
 	e.Close()
 }
+
+func TestEnvPrefix(t *testing.T) {
+	t.Setenv("TESTENVPREFIX_DB_HOST", "localhost")
+	t.Setenv("TESTENVPREFIX_MAX__CONNS", "10")
+	t.Setenv("TESTENVPREFIX_", "ignored")
+	filename := filepath.Join(t.TempDir(), "env")
+	require.NoError(t, os.WriteFile(filename, []byte(`
+# comment
+export TESTENVPREFIX_DB_PORT="5432"
+TESTENVPREFIX_DB_HOST = 'db'
+not a variable
+OTHER_VALUE=1
+`), 0600))
+
+	e, err := EnvPrefixLoader("TESTENVPREFIX_", &EnvPrefixConfig{Files: []string{filename}}).Get()
+	require.NoError(t, err)
+	defer e.Close()
+	for key, expected := range map[string]string{"db.host": "db", "db.port": "5432", "max_conns": "10", "value": "", "": ""} {
+		b, err := e.Get(key)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, string(b), key)
+	}
+	assert.Equal(t, "env:TESTENVPREFIX", readerName(e))
+	// signals are opt in, since listening for them changes what they do to the process
+	assert.Empty(t, e.(*envPrefixDisco).conf.ReloadSignals)
+
+	t.Setenv("TESTENVPREFIX_MAX__CONNS", "20")
+	require.NoError(t, os.WriteFile(filename, []byte("TESTENVPREFIX_DB_HOST=\n"), 0600))
+	conf := New([]Reader{e})
+	conns := conf.Int("max_conns", 0)
+	host := conf.Str("db.host", "none")
+	e.(*envPrefixDisco).refresh()
+	assert.Equal(t, int64(20), conns.Get())
+	assert.Equal(t, "none", host.Get())
+
+	require.NoError(t, os.Remove(filename))
+	e.(*envPrefixDisco).refresh()
+	assert.Equal(t, int64(20), conns.Get())
+}
+
+func TestEnvPrefixErrors(t *testing.T) {
+	_, err := EnvPrefix("_", nil)
+	assert.Error(t, err)
+	_, err = EnvPrefix("TESTENVPREFIXERRORS", &EnvPrefixConfig{Files: []string{filepath.Join(t.TempDir(), "missing")}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,37 @@
+//go:build !windows
+// +build !windows
+
+package distconf
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/signalfx/golib/v3/pointer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvPrefixReload(t *testing.T) {
+	t.Setenv("TESTENVPREFIXRELOAD_VALUE", "one")
+	e, err := EnvPrefix("TESTENVPREFIXRELOAD", &EnvPrefixConfig{RefreshInterval: pointer.Duration(time.Hour), ReloadSignals: []os.Signal{syscall.SIGHUP}})
+	require.NoError(t, err)
+	defer e.Close()
+	conf := New([]Reader{e})
+	val := conf.Str("value", "")
+	changed := make(chan string, 1)
+	val.Watch(func(str *Str, oldValue string) {
+		changed <- oldValue
+	})
+	t.Setenv("TESTENVPREFIXRELOAD_VALUE", "two")
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGHUP))
+	select {
+	case old := <-changed:
+		assert.Equal(t, "one", old)
+		assert.Equal(t, "two", val.Get())
+	case <-time.After(time.Second * 5):
+		t.Fatal("SIGHUP never read the environment again")
+	}
+}
@@ -0,0 +1,378 @@
+package distconf
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/signalfx/golib/v3/errors"
+	"github.com/signalfx/golib/v3/log"
+	"github.com/signalfx/golib/v3/logkey"
+	"github.com/signalfx/golib/v3/pointer"
+	"gopkg.in/yaml.v3"
+)
+
+// FileConfig configures a file backing
+type FileConfig struct {
+	// Format is yaml, toml or json.  If empty, it's guessed from each file's extension.
+	Format *string
+	// HotReload reloads the files when they change
+	HotReload *bool
+	// PollInterval is how often the files are checked for changes when their directories can't be watched,
+	// like when a directory doesn't exist yet
+	PollInterval *time.Duration
+	// IgnoreMissing skips files that don't exist, so optional override files can be layered on top
+	IgnoreMissing *bool
+	Logger        log.Logger
+}
+
+// DefaultFileConfig is used for any unset file config parameter
+var DefaultFileConfig = &FileConfig{
+	Format:        pointer.String(""),
+	HotReload:     pointer.Bool(true),
+	PollInterval:  pointer.Duration(time.Second * 5),
+	IgnoreMissing: pointer.Bool(false),
+	Logger:        DefaultLogger,
+}
+
+// fileStamp is what's checked to see if a file changed
+type fileStamp struct {
+	exists  bool
+	modTime time.Time
+	size    int64
+}
+
+type fileConfig struct {
+	conf       FileConfig
+	filenames  []string
+	logger     log.Logger
+	callbacks  callbackMap
+	shouldQuit chan struct{}
+	done       chan struct{}
+	closeOnce  sync.Once
+
+	mu     sync.RWMutex
+	values map[string][]byte
+	stamps []fileStamp
+}
+
+// File creates a backing that reads YAML, TOML or JSON files.  Nested keys are flattened with dots, so
+//
+//	db:
+//	  host: localhost
+//
+// is the key db.host, and db itself is the JSON object {"host":"localhost"}.  Lists are JSON arrays, which
+// StringSlice and JSON variables read.  Files are layered: keys in later files override the same keys in
+// earlier ones.  With HotReload, the files' directories are watched with fsnotify, so files that are
+// replaced rather than written to are seen too, and the files are reloaded and the changed keys' watches
+// called when they change.  A file that no longer parses is logged and its old values kept.
+func File(conf *FileConfig, filenames ...string) (Reader, error) {
+	cfg := pointer.FillDefaultFrom(conf, DefaultFileConfig).(*FileConfig)
+	if len(filenames) == 0 {
+		return nil, errors.New("file backing needs at least one file")
+	}
+	ret := &fileConfig{
+		conf:      *cfg,
+		filenames: filenames,
+		logger:    log.NewContext(cfg.Logger).With(logkey.DistconfBacking, "file"),
+		callbacks: callbackMap{
+			callbacks: make(map[string][]backingCallbackFunction),
+		},
+		shouldQuit: make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	ret.stamps = ret.stat()
+	values, err := ret.load()
+	if err != nil {
+		return nil, err
+	}
+	ret.values = values
+	if !*cfg.HotReload {
+		close(ret.done)
+		return ret, nil
+	}
+	watcher, err := ret.newWatcher()
+	if err != nil {
+		ret.logger.Log(log.Err, err, "unable to watch config files, polling them instead")
+		go ret.pollLoop()
+		return ret, nil
+	}
+	go ret.watchLoop(watcher)
+	return ret, nil
+}
+
+// FileLoader is a loading helper for file config variables
+func FileLoader(conf *FileConfig, filenames ...string) BackingLoader {
+	return BackingLoaderFunc(func() (Reader, error) {
+		return File(conf, filenames...)
+	})
+}
+
+// Get returns the value of key in the last file that has it
+func (f *fileConfig) Get(key string) ([]byte, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.values[key], nil
+}
+
+// Watch calls callback when the value of key changes
+func (f *fileConfig) Watch(key string, callback backingCallbackFunction) error {
+	f.callbacks.add(key, callback)
+	return nil
+}
+
+// Close stops checking the files for changes
+func (f *fileConfig) Close() {
+	f.closeOnce.Do(func() {
+		close(f.shouldQuit)
+	})
+	<-f.done
+}
+
+// newWatcher watches the directory of each file
+func (f *fileConfig) newWatcher() (*fsnotify.Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, errors.Annotate(err, "cannot create file watcher")
+	}
+	for _, filename := range f.filenames {
+		dir := filepath.Dir(filename)
+		if err := watcher.Add(dir); err != nil {
+			_ = watcher.Close()
+			return nil, errors.Annotatef(err, "cannot watch directory %s", dir)
+		}
+	}
+	return watcher, nil
+}
+
+func (f *fileConfig) watchLoop(watcher *fsnotify.Watcher) {
+	defer close(f.done)
+	defer func() {
+		_ = watcher.Close()
+	}()
+	watched := make(map[string]bool, len(f.filenames))
+	for _, filename := range f.filenames {
+		watched[filepath.Clean(filename)] = true
+	}
+	for {
+		select {
+		case <-f.shouldQuit:
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if watched[filepath.Clean(event.Name)] {
+				f.update(f.stat())
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			f.logger.Log(log.Err, err, "error watching config files")
+		}
+	}
+}
+
+func (f *fileConfig) pollLoop() {
+	defer close(f.done)
+	for {
+		select {
+		case <-f.shouldQuit:
+			return
+		case <-time.After(*f.conf.PollInterval):
+			f.reload()
+		}
+	}
+}
+
+// reload loads the files again if any of them changed
+func (f *fileConfig) reload() {
+	stamps := f.stat()
+	f.mu.RLock()
+	changed := !fileStampsEqual(stamps, f.stamps)
+	f.mu.RUnlock()
+	if changed {
+		f.update(stamps)
+	}
+}
+
+// update loads the files again, and calls the watches of the keys that changed
+func (f *fileConfig) update(stamps []fileStamp) {
+	values, err := f.load()
+	f.mu.Lock()
+	// remember the stamps even if the files don't parse, so a broken file is only logged once
+	f.stamps = stamps
+	old := f.values
+	if err == nil {
+		f.values = values
+	}
+	f.mu.Unlock()
+	if err != nil {
+		f.logger.Log(log.Err, err, "unable to reload config files")
+		return
+	}
+	f.callbacks.changed(old, values)
+}
+
+func (f *fileConfig) stat() []fileStamp {
+	stamps := make([]fileStamp, len(f.filenames))
+	for i, filename := range f.filenames {
+		if info, err := os.Stat(filename); err == nil {
+			stamps[i] = fileStamp{exists: true, modTime: info.ModTime(), size: info.Size()}
+		}
+	}
+	return stamps
+}
+
+func fileStampsEqual(a []fileStamp, b []fileStamp) bool {
+	for i := range a {
+		if a[i].exists != b[i].exists || !a[i].modTime.Equal(b[i].modTime) || a[i].size != b[i].size {
+			return false
+		}
+	}
+	return true
+}
+
+// load reads and merges every file, then flattens them into keys
+func (f *fileConfig) load() (map[string][]byte, error) {
+	merged := make(map[string]interface{})
+	for _, filename := range f.filenames {
+		tree, err := f.parseFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		mergeTree(merged, tree)
+	}
+	values := make(map[string][]byte)
+	if err := flattenTree(values, "", merged); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+func (f *fileConfig) parseFile(filename string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) && *f.conf.IgnoreMissing {
+			return nil, nil
+		}
+		return nil, errors.Annotatef(err, "Unable to open file %s", filename)
+	}
+	format := *f.conf.Format
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(filename)), ".")
+	}
+	var tree map[string]interface{}
+	switch format {
+	case "yaml", "yml":
+		err = yaml.Unmarshal(data, &tree)
+	case "toml":
+		tree, err = parseTOML(data)
+	case "json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		err = dec.Decode(&tree)
+	default:
+		return nil, fmt.Errorf("unknown format of file %s", filename)
+	}
+	if err != nil {
+		return nil, errors.Annotatef(err, "cannot parse file %s", filename)
+	}
+	return tree, nil
+}
+
+// mergeTree merges src into dst.  Tables in both are merged, anything else in src replaces what's in dst.
+func mergeTree(dst map[string]interface{}, src map[string]interface{}) {
+	for key, value := range src {
+		srcTable, srcIsTable := normalizeTree(value).(map[string]interface{})
+		dstTable, dstIsTable := dst[key].(map[string]interface{})
+		if srcIsTable && dstIsTable {
+			mergeTree(dstTable, srcTable)
+			continue
+		}
+		if srcIsTable {
+			// copied, so merging later files into it doesn't change src
+			copied := make(map[string]interface{}, len(srcTable))
+			mergeTree(copied, srcTable)
+			dst[key] = copied
+			continue
+		}
+		dst[key] = normalizeTree(value)
+	}
+}
+
+// normalizeTree converts the map[interface{}]interface{} tables YAML can have to map[string]interface{}
+func normalizeTree(value interface{}) interface{} {
+	switch val := value.(type) {
+	case map[interface{}]interface{}:
+		ret := make(map[string]interface{}, len(val))
+		for k, v := range val {
+			ret[fmt.Sprint(k)] = normalizeTree(v)
+		}
+		return ret
+	case map[string]interface{}:
+		ret := make(map[string]interface{}, len(val))
+		for k, v := range val {
+			ret[k] = normalizeTree(v)
+		}
+		return ret
+	case []interface{}:
+		ret := make([]interface{}, len(val))
+		for i, v := range val {
+			ret[i] = normalizeTree(v)
+		}
+		return ret
+	case []map[string]interface{}:
+		ret := make([]interface{}, len(val))
+		for i, v := range val {
+			ret[i] = normalizeTree(v)
+		}
+		return ret
+	}
+	return value
+}
+
+// flattenTree adds the values in tree to values, with their keys joined by dots.  Tables and lists are also
+// added as JSON.
+func flattenTree(values map[string][]byte, prefix string, tree map[string]interface{}) error {
+	for key, value := range tree {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		switch val := value.(type) {
+		case nil:
+		case map[string]interface{}:
+			if err := flattenTree(values, key, val); err != nil {
+				return err
+			}
+			b, err := json.Marshal(val)
+			if err != nil {
+				return errors.Annotatef(err, "cannot encode table %s", key)
+			}
+			values[key] = b
+		case []interface{}:
+			b, err := json.Marshal(val)
+			if err != nil {
+				return errors.Annotatef(err, "cannot encode list %s", key)
+			}
+			values[key] = b
+		case string:
+			values[key] = []byte(val)
+		case float64:
+			values[key] = []byte(strconv.FormatFloat(val, 'g', -1, 64))
+		case time.Time:
+			values[key] = []byte(val.Format(time.RFC3339Nano))
+		default:
+			values[key] = []byte(fmt.Sprint(val))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package distconf
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/signalfx/golib/v3/pointer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfFile(t *testing.T, dir string, name string, content string) string {
+	filename := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(filename, []byte(content), 0600))
+	return filename
+}
+
+func assertFileValue(t *testing.T, r Reader, key string, expected string) {
+	b, err := r.Get(key)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, string(b), key)
+}
+
+func TestFileLayers(t *testing.T) {
+	dir := t.TempDir()
+	base := writeConfFile(t, dir, "base.yaml", `
+db:
+  host: localhost
+  port: 5432
+  hosts: [a, b]
+rate: 1.5
+enabled: true
+empty:
+`)
+	override := writeConfFile(t, dir, "override.toml", `
+# overrides
+name = "app"  # inline comment
+
+[db]
+port = 6543
+"quoted.key" = 'literal \n'
+
+[limits.http]
+max = 1_000
+ratio = 0.25
+tags = ["x", "y\u0021"]
+point = { x = 1, y = -2 }
+started = 1979-05-27T07:32:00Z
+`)
+	r, err := FileLoader(&FileConfig{HotReload: pointer.Bool(false)}, base, override).Get()
+	require.NoError(t, err)
+	defer r.Close()
+
+	assertFileValue(t, r, "db.host", "localhost")
+	assertFileValue(t, r, "db.port", "6543")
+	assertFileValue(t, r, "db.hosts", `["a","b"]`)
+	assertFileValue(t, r, "db.quoted.key", `literal \n`)
+	assertFileValue(t, r, "rate", "1.5")
+	assertFileValue(t, r, "enabled", "true")
+	assertFileValue(t, r, "empty", "")
+	assertFileValue(t, r, "name", "app")
+	assertFileValue(t, r, "limits.http.max", "1000")
+	assertFileValue(t, r, "limits.http.ratio", "0.25")
+	assertFileValue(t, r, "limits.http.tags", `["x","y!"]`)
+	assertFileValue(t, r, "limits.http.point.y", "-2")
+	assertFileValue(t, r, "limits.http.started", "1979-05-27T07:32:00Z")
+	b, err := r.Get("db")
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"host": "localhost", "port": 6543, "hosts": ["a", "b"], "quoted.key": "literal \\n"}`, string(b))
+
+	conf := New([]Reader{r})
+	assert.Equal(t, int64(6543), conf.Int("db.port", 0).Get())
+	assert.Equal(t, []string{"a", "b"}, conf.StringSlice("db.hosts", nil).Get())
+	assert.Equal(t, "file:"+base+","+override, readerName(r))
+}
+
+func TestFileJSON(t *testing.T) {
+	dir := t.TempDir()
+	filename := writeConfFile(t, dir, "conf", `{"a": {"b": 12345678901234567890, "c": null}}`)
+	r, err := File(&FileConfig{Format: pointer.String("json"), HotReload: pointer.Bool(false)}, filename)
+	require.NoError(t, err)
+	assertFileValue(t, r, "a.b", "12345678901234567890")
+	assertFileValue(t, r, "a.c", "")
+	r.Close()
+}
+
+func TestFileHotReload(t *testing.T) {
+	dir := t.TempDir()
+	filename := writeConfFile(t, dir, "conf.yml", "a:\n  b: one\n")
+	r, err := File(nil, filename)
+	require.NoError(t, err)
+	defer r.Close()
+
+	conf := New([]Reader{r})
+	val := conf.Str("a.b", "")
+	changed := make(chan string, 1)
+	val.Watch(func(str *Str, oldValue string) {
+		changed <- oldValue
+	})
+	writeConfFile(t, dir, "conf.yml", "a:\n  b: [not yaml\n")
+	// replaced, the way editors and Kubernetes config maps change files
+	replacement := writeConfFile(t, dir, "conf.yml.new", "a:\n  b: two\n")
+	require.NoError(t, os.Rename(replacement, filename))
+	select {
+	case old := <-changed:
+		assert.Equal(t, "one", old)
+		assert.Equal(t, "two", val.Get())
+	case <-time.After(time.Second * 5):
+		t.Fatal("the changed file was never reloaded")
+	}
+}
+
+func TestFilePollFallback(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "conf.d")
+	filename := filepath.Join(dir, "conf.yml")
+	// a directory that doesn't exist can't be watched
+	r, err := File(&FileConfig{IgnoreMissing: pointer.Bool(true), PollInterval: pointer.Duration(time.Millisecond)}, filename)
+	require.NoError(t, err)
+	defer r.Close()
+
+	conf := New([]Reader{r})
+	val := conf.Str("a", "")
+	changed := make(chan string, 1)
+	val.Watch(func(str *Str, oldValue string) {
+		changed <- oldValue
+	})
+	require.NoError(t, os.Mkdir(dir, 0700))
+	writeConfFile(t, dir, "conf.yml", "a: one\n")
+	select {
+	case <-changed:
+		assert.Equal(t, "one", val.Get())
+	case <-time.After(time.Second * 5):
+		t.Fatal("the new file was never loaded")
+	}
+}
+
+func TestFileReloadErrors(t *testing.T) {
+	dir := t.TempDir()
+	filename := writeConfFile(t, dir, "conf.yaml", "a: one\n")
+	r, err := File(&FileConfig{HotReload: pointer.Bool(false)}, filename)
+	require.NoError(t, err)
+	f := r.(*fileConfig)
+	writeConfFile(t, dir, "conf.yaml", "a: [broken\n")
+	require.NoError(t, os.Chtimes(filename, time.Now(), time.Now().Add(time.Hour)))
+	f.reload()
+	assertFileValue(t, r, "a", "one")
+	f.reload()
+	r.Close()
+	r.Close()
+}
+
+func TestFileErrors(t *testing.T) {
+	dir := t.TempDir()
+	_, err := File(nil)
+	assert.Error(t, err)
+	_, err = File(nil, filepath.Join(dir, "missing.yaml"))
+	assert.Error(t, err)
+	r, err := File(&FileConfig{IgnoreMissing: pointer.Bool(true), HotReload: pointer.Bool(false)}, filepath.Join(dir, "missing.yaml"))
+	assert.NoError(t, err)
+	assertFileValue(t, r, "a", "")
+	_, err = File(nil, writeConfFile(t, dir, "conf.ini", "a=b"))
+	assert.Error(t, err)
+	_, err = File(nil, writeConfFile(t, dir, "bad.json", "{"))
+	assert.Error(t, err)
+	_, err = File(nil, writeConfFile(t, dir, "bad.toml", "a = "))
+	assert.Error(t, err)
+}
+
+func TestParseTOML(t *testing.T) {
+	for _, bad := range []string{
+		"a",
+		"a = 1\na = 2",
+		"mode = 0755",
+		"a = [1 2]",
+		`a = "\q"`,
+	} {
+		_, err := parseTOML([]byte(bad))
+		assert.Error(t, err, bad)
+	}
+	tree, err := parseTOML([]byte(`
+b = 0x10
+c = 0b101
+d = 07:32:00
+e = 1979-05-27
+f = 1979-05-27T07:32:00
+g = """multi
+line"""
+[[h]]
+name = "one"
+[[h]]
+name = "two"
+`))
+	require.NoError(t, err)
+	assert.Equal(t, int64(16), tree["b"])
+	assert.Equal(t, int64(5), tree["c"])
+	assert.Equal(t, "07:32:00", tree["d"])
+	assert.Equal(t, "1979-05-27", tree["e"])
+	assert.Equal(t, "1979-05-27T07:32:00", tree["f"])
+	assert.Equal(t, "multi\nline", tree["g"])
+	values := make(map[string][]byte)
+	require.NoError(t, flattenTree(values, "", normalizeTree(tree).(map[string]interface{})))
+	assert.JSONEq(t, `[{"name": "one"}, {"name": "two"}]`, string(values["h"]))
+}
@@ -14,7 +14,8 @@ type FloatWatch func(float *Float, oldValue float64)
 
 type floatConf struct {
 	Float
-	defaultVal float64
+	defaultVal  float64
+	constraints []Constraint[float64]
 }
 
 // Float is an float type config inside a Config.
@@ -44,6 +45,9 @@ func (c *floatConf) Update(newValue []byte) error {
 		if err != nil {
 			return errors.Annotatef(err, "unable to parse float %s", newValue)
 		}
+		if err := checkConstraints(c.constraints, newValue, newValueFloat); err != nil {
+			return err
+		}
 		atomic.StoreUint64(&c.currentVal, math.Float64bits(newValueFloat))
 	}
 	if oldValue != c.Get() {
@@ -13,7 +13,8 @@ type IntWatch func(str *Int, oldValue int64)
 
 type intConf struct {
 	Int
-	defaultVal int64
+	defaultVal  int64
+	constraints []Constraint[int64]
 }
 
 // Int is an integer type config inside a Config.
@@ -42,6 +43,9 @@ func (c *intConf) Update(newValue []byte) error {
 		if err != nil {
 			return errors.Annotatef(err, "Unparsable float %s", string(newValue))
 		}
+		if err := checkConstraints(c.constraints, newValue, newValueInt); err != nil {
+			return err
+		}
 		atomic.StoreInt64(&c.currentVal, newValueInt)
 	}
 	if oldValue != c.Get() {
@@ -0,0 +1,93 @@
+package distconf
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sync"
+	"sync/atomic"
+
+	"github.com/signalfx/golib/v3/errors"
+)
+
+// JSONWatch is executed if registered on a JSON variable any time the contents change
+type JSONWatch func(j *JSON, oldValue interface{})
+
+type jsonConf struct {
+	JSON
+	defaultVal  interface{}
+	valueType   reflect.Type
+	constraints []Constraint[interface{}]
+}
+
+// JSON is a config inside a Config that's unmarshalled into a new value of the default's type each time it
+// changes
+type JSON struct {
+	watches []JSONWatch
+
+	// Lock on watches so updates are atomic
+	mutex      sync.Mutex
+	currentVal atomic.Value
+	currentRaw []byte
+}
+
+// jsonHolder lets values of any type be stored in an atomic.Value
+type jsonHolder struct {
+	value interface{}
+}
+
+// Update the contents of JSON to the new value
+func (j *jsonConf) Update(newValue []byte) error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	oldValue := j.Get()
+	oldRaw := j.currentRaw
+	if newValue == nil {
+		j.currentVal.Store(jsonHolder{j.defaultVal})
+		j.currentRaw = nil
+	} else {
+		if bytes.Equal(newValue, j.currentRaw) {
+			return nil
+		}
+		parsed := reflect.New(j.valueType)
+		if err := json.Unmarshal(newValue, parsed.Interface()); err != nil {
+			return errors.Annotatef(err, "Unparsable JSON %s", string(newValue))
+		}
+		if err := checkConstraints(j.constraints, newValue, parsed.Interface()); err != nil {
+			return err
+		}
+		j.currentVal.Store(jsonHolder{parsed.Interface()})
+		j.currentRaw = append([]byte{}, newValue...)
+	}
+	if oldRaw != nil || j.currentRaw != nil {
+		for _, w := range j.watches {
+			w(&j.JSON, oldValue)
+		}
+	}
+	return nil
+}
+
+// Get returns a pointer to the current value, of the same type as the default.  It's shared, so it must not
+// be modified.
+func (j *JSON) Get() interface{} {
+	return j.currentVal.Load().(jsonHolder).value
+}
+
+// Watch adds a watch for changes to this structure
+func (j *JSON) Watch(watch JSONWatch) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	j.watches = append(j.watches, watch)
+}
+
+func (j *jsonConf) GenericGet() interface{} {
+	return j.Get()
+}
+
+func (j *jsonConf) GenericGetDefault() interface{} {
+	return j.defaultVal
+}
+
+func (j *jsonConf) Type() DistType {
+	return JSONType
+}
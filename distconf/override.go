@@ -0,0 +1,174 @@
+package distconf
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/signalfx/golib/v3/log"
+)
+
+// overrideSource is the source of overridden values
+const overrideSource = "override"
+
+// override is a value set with Override, used before any backing's until it's cleared or expires
+type override struct {
+	value   []byte
+	expires time.Time
+	timer   *time.Timer
+}
+
+// Override is a value set with Override
+type Override struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	// Expires is when the override is cleared, or nil if it's only cleared with ClearOverride
+	Expires *time.Time `json:"expires,omitempty"`
+}
+
+// Override sets key to value, ahead of every backing, until ClearOverride or for ttl if it's positive.  Then
+// the backings' value is used again.  An override of a registered variable that it rejects is not kept, and
+// its error is returned.  Overriding key again replaces the previous override and its ttl.
+func (c *Distconf) Override(key string, value []byte, ttl time.Duration) error {
+	o := &override{value: value}
+	if ttl > 0 {
+		o.expires = c.now().Add(ttl)
+	}
+	c.overrideMutex.Lock()
+	if c.overrides == nil {
+		c.overrides = make(map[string]*override)
+	}
+	prev := c.overrides[key]
+	c.overrides[key] = o
+	c.overrideMutex.Unlock()
+
+	if err := c.refreshKey(key); err != nil {
+		c.overrideMutex.Lock()
+		if c.overrides[key] == o {
+			if prev != nil {
+				c.overrides[key] = prev
+			} else {
+				delete(c.overrides, key)
+			}
+		}
+		c.overrideMutex.Unlock()
+		_ = c.refreshKey(key)
+		return err
+	}
+	if prev != nil && prev.timer != nil {
+		prev.timer.Stop()
+	}
+	if ttl > 0 {
+		c.overrideMutex.Lock()
+		o.timer = time.AfterFunc(ttl, func() {
+			c.clearOverride(key, o)
+		})
+		c.overrideMutex.Unlock()
+	}
+	return nil
+}
+
+// ClearOverride clears the override of key, if it has one, using the backings' value again
+func (c *Distconf) ClearOverride(key string) {
+	c.clearOverride(key, nil)
+}
+
+// clearOverride clears the override of key, if it's o or o is nil
+func (c *Distconf) clearOverride(key string, o *override) {
+	c.overrideMutex.Lock()
+	current, exists := c.overrides[key]
+	if !exists || (o != nil && current != o) {
+		c.overrideMutex.Unlock()
+		return
+	}
+	delete(c.overrides, key)
+	if current.timer != nil {
+		current.timer.Stop()
+	}
+	c.overrideMutex.Unlock()
+	_ = c.refreshKey(key)
+}
+
+// Overrides returns the current overrides, sorted by key, with secret values redacted
+func (c *Distconf) Overrides() []Override {
+	c.overrideMutex.Lock()
+	defer c.overrideMutex.Unlock()
+	ret := make([]Override, 0, len(c.overrides))
+	for key, o := range c.overrides {
+		ov := Override{
+			Key:   key,
+			Value: c.redact(key, overrideSource, string(o.value)).(string),
+		}
+		if !o.expires.IsZero() {
+			expires := o.expires
+			ov.Expires = &expires
+		}
+		ret = append(ret, ov)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Key < ret[j].Key
+	})
+	return ret
+}
+
+func (c *Distconf) overrideValue(key string) ([]byte, bool) {
+	c.overrideMutex.Lock()
+	defer c.overrideMutex.Unlock()
+	if o, exists := c.overrides[key]; exists {
+		return o.value, true
+	}
+	return nil, false
+}
+
+// refreshKey refreshes key if it's registered, returning the error if its update was rejected
+func (c *Distconf) refreshKey(key string) error {
+	c.varsMutex.Lock()
+	m, exists := c.registeredVars[key]
+	c.varsMutex.Unlock()
+	if !exists {
+		return nil
+	}
+	_, err := c.refresh(key, m.distvar)
+	return err
+}
+
+// OverrideHandler returns an HTTP handler, for a debug server like httpdebug's, that responds with the
+// Overrides as JSON.  POST and PUT requests first override the key form value with the value form value,
+// for the ttl form value, or defaultTTL if there isn't one.  DELETE requests first clear the override of
+// the key form value.
+func (c *Distconf) OverrideHandler(defaultTTL time.Duration) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case http.MethodGet:
+		case http.MethodPut, http.MethodPost:
+			key := req.FormValue("key")
+			if key == "" {
+				http.Error(rw, "key is required", http.StatusBadRequest)
+				return
+			}
+			ttl := defaultTTL
+			if ttlStr := req.FormValue("ttl"); ttlStr != "" {
+				var err error
+				if ttl, err = time.ParseDuration(ttlStr); err != nil || ttl <= 0 {
+					http.Error(rw, fmt.Sprintf("invalid ttl %q", ttlStr), http.StatusBadRequest)
+					return
+				}
+			}
+			if err := c.Override(key, []byte(req.FormValue("value")), ttl); err != nil {
+				http.Error(rw, err.Error(), http.StatusBadRequest)
+				return
+			}
+		case http.MethodDelete:
+			c.ClearOverride(req.FormValue("key"))
+		default:
+			http.Error(rw, "only GET, PUT, POST and DELETE are supported", http.StatusMethodNotAllowed)
+			return
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(rw).Encode(c.Overrides()); err != nil {
+			c.Logger.Log(log.Err, err, "unable to write distconf overrides")
+		}
+	})
+}
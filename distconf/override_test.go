@@ -0,0 +1,101 @@
+package distconf
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/signalfx/golib/v3/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOverride(t *testing.T) {
+	memConf, conf := makeConf()
+	defer conf.Close()
+	port := conf.Int("port", 80, Max(int64(65535)))
+	log.IfErr(log.Panic, memConf.Write("port", []byte("8080")))
+
+	require.NoError(t, conf.Override("port", []byte("9090"), 0))
+	assert.Equal(t, int64(9090), port.Get())
+	assert.Equal(t, "override", conf.State().Vars["port"].Source)
+	// backing changes don't matter while overridden
+	log.IfErr(log.Panic, memConf.Write("port", []byte("8081")))
+	assert.Equal(t, int64(9090), port.Get())
+
+	// rejected overrides are not kept
+	assert.Error(t, conf.Override("port", []byte("99999"), 0))
+	assert.Equal(t, int64(9090), port.Get())
+	assert.Equal(t, []Override{{Key: "port", Value: "9090"}}, conf.Overrides())
+	conf.ClearOverride("port")
+	assert.Error(t, conf.Override("port", []byte("99999"), 0))
+	assert.Equal(t, int64(8081), port.Get())
+	assert.Empty(t, conf.Overrides())
+	conf.ClearOverride("port")
+
+	// keys are overridden before they're registered
+	require.NoError(t, conf.Override("db.password", []byte("hunter2"), time.Hour))
+	assert.Equal(t, "hunter2", conf.Str("db.password", "").Get())
+	overrides := conf.Overrides()
+	require.Len(t, overrides, 1)
+	assert.Equal(t, RedactedValue, overrides[0].Value)
+	assert.NotNil(t, overrides[0].Expires)
+}
+
+func TestOverrideTTL(t *testing.T) {
+	memConf, conf := makeConf()
+	defer conf.Close()
+	name := conf.Str("name", "default")
+	log.IfErr(log.Panic, memConf.Write("name", []byte("mem")))
+
+	require.NoError(t, conf.Override("name", []byte("long"), time.Hour))
+	require.NoError(t, conf.Override("name", []byte("short"), time.Millisecond))
+	assert.Equal(t, "short", name.Get())
+	for name.Get() != "mem" {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Empty(t, conf.Overrides())
+	history := conf.State().History
+	assert.Equal(t, Change{Key: "name", Time: history[len(history)-1].Time, OldValue: "short", NewValue: "mem", Source: "mem"}, history[len(history)-1])
+}
+
+func TestOverrideHandler(t *testing.T) {
+	_, conf := makeConf()
+	defer conf.Close()
+	level := conf.Str("log.level", "info", OneOf("debug", "info"))
+	handler := conf.OverrideHandler(time.Hour)
+	serve := func(method string, form url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/debug/distconf/overrides?"+form.Encode(), nil)
+		if method == http.MethodPost {
+			req = httptest.NewRequest(method, "/debug/distconf/overrides", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, req)
+		return rw
+	}
+
+	rw := serve(http.MethodPost, url.Values{"key": {"log.level"}, "value": {"debug"}})
+	require.Equal(t, http.StatusOK, rw.Code)
+	var overrides []Override
+	require.NoError(t, json.NewDecoder(rw.Body).Decode(&overrides))
+	require.Len(t, overrides, 1)
+	assert.Equal(t, "debug", overrides[0].Value)
+	require.NotNil(t, overrides[0].Expires)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), *overrides[0].Expires, time.Minute)
+	assert.Equal(t, "debug", level.Get())
+
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodPut, url.Values{"key": {"log.level"}, "value": {"trace"}}).Code)
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodPut, url.Values{"value": {"debug"}}).Code)
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodPut, url.Values{"key": {"log.level"}, "ttl": {"-1s"}}).Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, serve(http.MethodPatch, nil).Code)
+	assert.Contains(t, serve(http.MethodGet, nil).Body.String(), "log.level")
+
+	rw = serve(http.MethodDelete, url.Values{"key": {"log.level"}})
+	assert.Equal(t, "[]\n", rw.Body.String())
+	assert.Equal(t, "info", level.Get())
+}
@@ -10,7 +10,8 @@ type StrWatch func(str *Str, oldValue string)
 
 type strConf struct {
 	Str
-	defaultVal string
+	defaultVal  string
+	constraints []Constraint[string]
 }
 
 // Str is a string type config inside a Config.
@@ -30,6 +31,9 @@ func (s *strConf) Update(newValue []byte) error {
 	if newValue == nil {
 		s.currentVal.Store(s.defaultVal)
 	} else {
+		if err := checkConstraints(s.constraints, newValue, string(newValue)); err != nil {
+			return err
+		}
 		s.currentVal.Store(string(newValue))
 	}
 	if oldValue != s.Get() {
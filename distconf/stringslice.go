@@ -0,0 +1,109 @@
+package distconf
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/signalfx/golib/v3/errors"
+)
+
+// StringSliceWatch is executed if registered on a StringSlice variable any time the contents change
+type StringSliceWatch func(slice *StringSlice, oldValue []string)
+
+type stringSliceConf struct {
+	StringSlice
+	defaultVal  []string
+	constraints []Constraint[[]string]
+}
+
+// StringSlice is a list of strings config inside a Config.  Values are a JSON list of strings, like
+// ["a","b"], or comma separated, like a, b.
+type StringSlice struct {
+	watches []StringSliceWatch
+
+	// Lock on watches so updates are atomic
+	mutex      sync.Mutex
+	currentVal atomic.Value
+}
+
+// parseStringSlice parses a JSON list of strings or a comma separated list, dropping empty items
+func parseStringSlice(value []byte) ([]string, error) {
+	trimmed := strings.TrimSpace(string(value))
+	if strings.HasPrefix(trimmed, "[") {
+		var ret []string
+		if err := json.Unmarshal([]byte(trimmed), &ret); err != nil {
+			return nil, errors.Annotatef(err, "Unparsable string list %s", trimmed)
+		}
+		return ret, nil
+	}
+	ret := make([]string, 0, strings.Count(trimmed, ",")+1)
+	for _, item := range strings.Split(trimmed, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			ret = append(ret, item)
+		}
+	}
+	return ret, nil
+}
+
+// Update the contents of StringSlice to the new value
+func (s *stringSliceConf) Update(newValue []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	oldValue := s.Get()
+	if newValue == nil {
+		s.currentVal.Store(s.defaultVal)
+	} else {
+		parsed, err := parseStringSlice(newValue)
+		if err != nil {
+			return err
+		}
+		if err := checkConstraints(s.constraints, newValue, parsed); err != nil {
+			return err
+		}
+		s.currentVal.Store(parsed)
+	}
+	if !stringSlicesEqual(oldValue, s.Get()) {
+		for _, w := range s.watches {
+			w(&s.StringSlice, oldValue)
+		}
+	}
+	return nil
+}
+
+func stringSlicesEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Get the strings in this config variable.  The slice is shared, so it must not be modified.
+func (s *StringSlice) Get() []string {
+	return s.currentVal.Load().([]string)
+}
+
+// Watch adds a watch for changes to this structure
+func (s *StringSlice) Watch(watch StringSliceWatch) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.watches = append(s.watches, watch)
+}
+
+func (s *stringSliceConf) GenericGet() interface{} {
+	return s.Get()
+}
+
+func (s *stringSliceConf) GenericGetDefault() interface{} {
+	return s.defaultVal
+}
+
+func (s *stringSliceConf) Type() DistType {
+	return StringSliceType
+}
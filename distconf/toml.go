@@ -0,0 +1,50 @@
+package distconf
+
+import (
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// tomlLocalFormats are the formats of TOML's dates and times without a timezone, by the name of the
+// location BurntSushi/toml decodes them in
+var tomlLocalFormats = map[string]string{
+	"datetime-local": "2006-01-02T15:04:05.999999999",
+	"date-local":     "2006-01-02",
+	"time-local":     "15:04:05.999999999",
+}
+
+// parseTOML parses a TOML document.  Dates and times without a timezone are kept as the strings they were
+// written as, since they aren't an instant.
+func parseTOML(data []byte) (map[string]interface{}, error) {
+	var tree map[string]interface{}
+	if err := toml.Unmarshal(data, &tree); err != nil {
+		return nil, err
+	}
+	return localTOMLTimes(tree).(map[string]interface{}), nil
+}
+
+// localTOMLTimes replaces the local dates and times in value with their strings
+func localTOMLTimes(value interface{}) interface{} {
+	switch val := value.(type) {
+	case map[string]interface{}:
+		for k, v := range val {
+			val[k] = localTOMLTimes(v)
+		}
+	case []map[string]interface{}:
+		ret := make([]interface{}, len(val))
+		for i, v := range val {
+			ret[i] = localTOMLTimes(v)
+		}
+		return ret
+	case []interface{}:
+		for i, v := range val {
+			val[i] = localTOMLTimes(v)
+		}
+	case time.Time:
+		if format, ok := tomlLocalFormats[val.Location().String()]; ok {
+			return val.Format(format)
+		}
+	}
+	return value
+}
@@ -0,0 +1,323 @@
+package distconf
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/signalfx/golib/v3/errors"
+	"github.com/signalfx/golib/v3/log"
+	"github.com/signalfx/golib/v3/logkey"
+	"github.com/signalfx/golib/v3/pointer"
+)
+
+// VaultConfig configures a Vault backing.  Address and Path must be set, along with either Token or both
+// RoleID and SecretID to log in with AppRole.
+type VaultConfig struct {
+	// Address is where Vault is, like https://vault:8200
+	Address *string
+	// Token is looked up when the backing is created, to renew it before it expires
+	Token *string
+	// RoleID and SecretID log in with AppRole, getting a new token whenever the last one expires
+	RoleID   *string
+	SecretID *string
+	// Mount is where the KV v2 secrets engine is mounted
+	Mount *string
+	// Path is the secret whose fields are the config keys
+	Path *string
+	// RefreshInterval is how often the secret is read again, and changed keys' watches called.  It's
+	// read sooner if the secret's lease runs out first.
+	RefreshInterval *time.Duration
+	// Timeout is how long each request to Vault can take
+	Timeout *time.Duration
+	Client  *http.Client
+	Logger  log.Logger
+}
+
+// DefaultVaultConfig is used for any unset Vault config parameter
+var DefaultVaultConfig = &VaultConfig{
+	Address:         pointer.String(""),
+	Token:           pointer.String(""),
+	RoleID:          pointer.String(""),
+	SecretID:        pointer.String(""),
+	Mount:           pointer.String("secret"),
+	Path:            pointer.String(""),
+	RefreshInterval: pointer.Duration(time.Minute),
+	Timeout:         pointer.Duration(time.Second * 10),
+	Client:          http.DefaultClient,
+	Logger:          DefaultLogger,
+}
+
+type vaultConfig struct {
+	conf       VaultConfig
+	logger     log.Logger
+	callbacks  callbackMap
+	shouldQuit chan struct{}
+	done       chan struct{}
+	closeOnce  sync.Once
+
+	mu     sync.RWMutex
+	values map[string][]byte
+
+	// the token and when it must be renewed by are only used by the refresh loop after Vault returns.  A
+	// zero tokenExpires is a token that doesn't expire.
+	token        string
+	renewable    bool
+	tokenExpires time.Time
+	secretLease  time.Duration
+}
+
+// vaultResponse is the part of Vault's responses the backing reads
+type vaultResponse struct {
+	LeaseDuration int64 `json:"lease_duration"`
+	Data          struct {
+		Data map[string]interface{} `json:"data"`
+		// TTL and Renewable are in token lookups
+		TTL       int64 `json:"ttl"`
+		Renewable bool  `json:"renewable"`
+	} `json:"data"`
+	Auth *struct {
+		ClientToken   string `json:"client_token"`
+		LeaseDuration int64  `json:"lease_duration"`
+		Renewable     bool   `json:"renewable"`
+	} `json:"auth"`
+	Errors []string `json:"errors"`
+}
+
+// Vault creates a backing that reads keys from the fields of a secret in HashiCorp Vault's KV v2 secrets
+// engine.  The secret is cached, and read again every RefreshInterval so rotated secrets reach the config
+// variables reading them.  Tokens are renewed, or AppRole logged in to again, before they expire.
+func Vault(conf *VaultConfig) (Reader, error) {
+	cfg := pointer.FillDefaultFrom(conf, DefaultVaultConfig).(*VaultConfig)
+	if *cfg.Address == "" || *cfg.Path == "" {
+		return nil, errors.New("vault backing needs an address and a path")
+	}
+	if *cfg.Token == "" && (*cfg.RoleID == "" || *cfg.SecretID == "") {
+		return nil, errors.New("vault backing needs a token or an AppRole role ID and secret ID")
+	}
+	ret := &vaultConfig{
+		conf:   *cfg,
+		logger: log.NewContext(cfg.Logger).With(logkey.DistconfBacking, "vault"),
+		callbacks: callbackMap{
+			callbacks: make(map[string][]backingCallbackFunction),
+		},
+		shouldQuit: make(chan struct{}),
+		done:       make(chan struct{}),
+		token:      *cfg.Token,
+	}
+	if err := ret.login(); err != nil {
+		return nil, err
+	}
+	values, err := ret.read()
+	if err != nil {
+		return nil, err
+	}
+	ret.values = values
+	go ret.refreshLoop()
+	return ret, nil
+}
+
+// VaultLoader is a loading helper for Vault config variables
+func VaultLoader(conf *VaultConfig) BackingLoader {
+	return BackingLoaderFunc(func() (Reader, error) {
+		return Vault(conf)
+	})
+}
+
+// Get returns the cached value of the field key, or nil if the secret doesn't have it
+func (v *vaultConfig) Get(key string) ([]byte, error) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.values[key], nil
+}
+
+// Watch calls callback when the value of key changes
+func (v *vaultConfig) Watch(key string, callback backingCallbackFunction) error {
+	v.callbacks.add(key, callback)
+	return nil
+}
+
+// Close stops refreshing the secret
+func (v *vaultConfig) Close() {
+	v.closeOnce.Do(func() {
+		close(v.shouldQuit)
+	})
+	<-v.done
+}
+
+func (v *vaultConfig) refreshLoop() {
+	defer close(v.done)
+	for {
+		wait := *v.conf.RefreshInterval
+		if v.secretLease > 0 && v.secretLease < wait {
+			wait = v.secretLease
+		}
+		select {
+		case <-v.shouldQuit:
+			return
+		case <-time.After(wait):
+			v.refresh()
+		}
+	}
+}
+
+// refresh renews the token if needed, then reads the secret and calls the watches of the keys that changed
+func (v *vaultConfig) refresh() {
+	if err := v.renewToken(); err != nil {
+		v.logger.Log(log.Err, err, "unable to renew vault token")
+	}
+	values, err := v.read()
+	if err != nil {
+		v.logger.Log(log.Err, err, "unable to refresh vault secret")
+		return
+	}
+	v.mu.Lock()
+	old := v.values
+	v.values = values
+	v.mu.Unlock()
+	v.callbacks.changed(old, values)
+}
+
+// renewToken renews the token, or logs in again, once less than two refreshes are left on its lease
+func (v *vaultConfig) renewToken() error {
+	if v.tokenExpires.IsZero() || time.Until(v.tokenExpires) > 2**v.conf.RefreshInterval {
+		return nil
+	}
+	if v.renewable {
+		resp, err := v.do(http.MethodPost, "/v1/auth/token/renew-self", nil)
+		if err == nil && resp.Auth != nil {
+			v.setToken(resp)
+			return nil
+		}
+		if *v.conf.RoleID == "" {
+			if err == nil {
+				err = errors.New("vault token renewal returned no token")
+			}
+			return err
+		}
+	}
+	if *v.conf.RoleID == "" {
+		return v.errUnrenewable()
+	}
+	return v.login()
+}
+
+// login gets a token with AppRole, if it's configured, or else looks up the static token to learn when it
+// expires
+func (v *vaultConfig) login() error {
+	if *v.conf.RoleID == "" {
+		return v.lookupToken()
+	}
+	body, err := json.Marshal(map[string]string{"role_id": *v.conf.RoleID, "secret_id": *v.conf.SecretID})
+	if err != nil {
+		return errors.Annotate(err, "cannot encode vault login")
+	}
+	resp, err := v.do(http.MethodPost, "/v1/auth/approle/login", body)
+	if err != nil {
+		return errors.Annotate(err, "cannot log in to vault with approle")
+	}
+	if resp.Auth == nil || resp.Auth.ClientToken == "" {
+		return errors.New("vault approle login returned no token")
+	}
+	v.setToken(resp)
+	return nil
+}
+
+// lookupToken learns how long the static token lasts and if it can be renewed.  A token that expires and
+// can't be renewed is logged, since reads will fail once it does.
+func (v *vaultConfig) lookupToken() error {
+	resp, err := v.do(http.MethodGet, "/v1/auth/token/lookup-self", nil)
+	if err != nil {
+		return errors.Annotate(err, "cannot look up vault token")
+	}
+	v.renewable = resp.Data.Renewable
+	v.tokenExpires = time.Time{}
+	if resp.Data.TTL > 0 {
+		v.tokenExpires = time.Now().Add(time.Duration(resp.Data.TTL) * time.Second)
+		if !v.renewable {
+			v.logger.Log(log.Err, v.errUnrenewable(), "vault secret reads will fail once the token expires")
+		}
+	}
+	return nil
+}
+
+func (v *vaultConfig) errUnrenewable() error {
+	return fmt.Errorf("vault token expires at %s and can't be renewed", v.tokenExpires.Format(time.RFC3339))
+}
+
+func (v *vaultConfig) setToken(resp *vaultResponse) {
+	v.token = resp.Auth.ClientToken
+	v.renewable = resp.Auth.Renewable
+	v.tokenExpires = time.Time{}
+	if resp.Auth.LeaseDuration > 0 {
+		v.tokenExpires = time.Now().Add(time.Duration(resp.Auth.LeaseDuration) * time.Second)
+	}
+}
+
+// read returns the fields of the secret.  Strings are returned as they are, other values as JSON.
+func (v *vaultConfig) read() (map[string][]byte, error) {
+	path := fmt.Sprintf("/v1/%s/data/%s", strings.Trim(*v.conf.Mount, "/"), strings.TrimLeft(*v.conf.Path, "/"))
+	resp, err := v.do(http.MethodGet, path, nil)
+	if err != nil {
+		return nil, errors.Annotatef(err, "cannot read vault secret %s", *v.conf.Path)
+	}
+	v.secretLease = time.Duration(resp.LeaseDuration) * time.Second
+	values := make(map[string][]byte, len(resp.Data.Data))
+	for key, value := range resp.Data.Data {
+		switch val := value.(type) {
+		case nil:
+		case string:
+			values[key] = []byte(val)
+		default:
+			b, err := json.Marshal(val)
+			if err != nil {
+				return nil, errors.Annotatef(err, "cannot encode vault secret field %s", key)
+			}
+			values[key] = b
+		}
+	}
+	return values, nil
+}
+
+// do makes a request to Vault.  A secret that doesn't exist is returned as an empty response.
+func (v *vaultConfig) do(method string, path string, body []byte) (*vaultResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), *v.conf.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(*v.conf.Address, "/")+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Annotate(err, "cannot create vault request")
+	}
+	if v.token != "" {
+		req.Header.Set("X-Vault-Token", v.token)
+	}
+	resp, err := v.conf.Client.Do(req)
+	if err != nil {
+		return nil, errors.Annotate(err, "cannot reach vault")
+	}
+	defer func() {
+		log.IfErr(v.logger, resp.Body.Close())
+	}()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Annotate(err, "cannot read vault response")
+	}
+	ret := &vaultResponse{}
+	if resp.StatusCode == http.StatusNotFound && method == http.MethodGet {
+		return ret, nil
+	}
+	if len(respBody) > 0 {
+		if err := json.Unmarshal(respBody, ret); err != nil {
+			return nil, errors.Annotatef(err, "invalid vault response with status %d", resp.StatusCode)
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("vault returned status %d: %s", resp.StatusCode, strings.Join(ret.Errors, "; "))
+	}
+	return ret, nil
+}
@@ -0,0 +1,213 @@
+package distconf
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/signalfx/golib/v3/log"
+	"github.com/signalfx/golib/v3/pointer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeVault struct {
+	mu       sync.Mutex
+	secret   map[string]interface{}
+	logins   int
+	renewals int
+	tokenTTL int64
+}
+
+func (f *fakeVault) set(key string, value interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.secret[key] = value
+}
+
+func (f *fakeVault) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	reply := func(v interface{}) {
+		log.IfErr(log.Panic, json.NewEncoder(rw).Encode(v))
+	}
+	auth := func(token string) map[string]interface{} {
+		return map[string]interface{}{"auth": map[string]interface{}{"client_token": token, "lease_duration": f.tokenTTL, "renewable": true}}
+	}
+	switch req.URL.Path {
+	case "/v1/auth/approle/login":
+		var body map[string]string
+		log.IfErr(log.Panic, json.NewDecoder(req.Body).Decode(&body))
+		if body["role_id"] != "role" || body["secret_id"] != "secret" {
+			rw.WriteHeader(http.StatusBadRequest)
+			reply(map[string]interface{}{"errors": []string{"invalid role or secret ID"}})
+			return
+		}
+		f.logins++
+		reply(auth("approle-token"))
+	case "/v1/auth/token/lookup-self":
+		switch req.Header.Get("X-Vault-Token") {
+		case "root":
+			reply(map[string]interface{}{"data": map[string]interface{}{"ttl": 0, "renewable": false}})
+		case "static":
+			reply(map[string]interface{}{"data": map[string]interface{}{"ttl": f.tokenTTL, "renewable": true}})
+		case "fixed":
+			reply(map[string]interface{}{"data": map[string]interface{}{"ttl": f.tokenTTL, "renewable": false}})
+		default:
+			rw.WriteHeader(http.StatusForbidden)
+			reply(map[string]interface{}{"errors": []string{"permission denied"}})
+		}
+	case "/v1/auth/token/renew-self":
+		f.renewals++
+		reply(auth(req.Header.Get("X-Vault-Token")))
+	case "/v1/secret/data/app":
+		if token := req.Header.Get("X-Vault-Token"); token == "bad" {
+			rw.WriteHeader(http.StatusForbidden)
+			reply(map[string]interface{}{"errors": []string{"permission denied"}})
+			return
+		}
+		reply(map[string]interface{}{"data": map[string]interface{}{"data": f.secret}})
+	default:
+		rw.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestVault(t *testing.T) {
+	fake := &fakeVault{secret: map[string]interface{}{"password": "hunter2", "limits": map[string]interface{}{"max": 3.0}}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	v, err := VaultLoader(&VaultConfig{
+		Address:         pointer.String(server.URL),
+		RoleID:          pointer.String("role"),
+		SecretID:        pointer.String("secret"),
+		Path:            pointer.String("app"),
+		RefreshInterval: pointer.Duration(time.Millisecond * 10),
+	}).Get()
+	require.NoError(t, err)
+	defer v.Close()
+
+	b, err := v.Get("password")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("hunter2"), b)
+	b, err = v.Get("limits")
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"max": 3}`, string(b))
+	b, err = v.Get("missing")
+	assert.NoError(t, err)
+	assert.Nil(t, b)
+
+	conf := New([]Reader{v})
+	password := conf.Str("password", "")
+	changed := make(chan string, 1)
+	password.Watch(func(str *Str, oldValue string) {
+		changed <- oldValue
+	})
+	fake.set("password", "correct horse")
+	select {
+	case old := <-changed:
+		assert.Equal(t, "hunter2", old)
+		assert.Equal(t, "correct horse", password.Get())
+	case <-time.After(time.Second * 5):
+		t.Fatal("the rotated secret was never read")
+	}
+	v.Close()
+	v.Close()
+}
+
+func TestVaultTokenRenewal(t *testing.T) {
+	fake := &fakeVault{secret: map[string]interface{}{}, tokenTTL: 60}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	v, err := Vault(&VaultConfig{
+		Address:         pointer.String(server.URL),
+		RoleID:          pointer.String("role"),
+		SecretID:        pointer.String("secret"),
+		Path:            pointer.String("app"),
+		RefreshInterval: pointer.Duration(time.Minute),
+	})
+	require.NoError(t, err)
+	// refresh once the refresh loop is stopped, so the test owns the token
+	v.Close()
+	v.(*vaultConfig).refresh()
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	assert.Equal(t, 1, fake.logins)
+	assert.Equal(t, 1, fake.renewals)
+}
+
+func TestVaultStaticTokenRenewal(t *testing.T) {
+	fake := &fakeVault{secret: map[string]interface{}{}, tokenTTL: 60}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	v, err := Vault(&VaultConfig{
+		Address:         pointer.String(server.URL),
+		Token:           pointer.String("static"),
+		Path:            pointer.String("app"),
+		RefreshInterval: pointer.Duration(time.Minute),
+	})
+	require.NoError(t, err)
+	v.Close()
+	vc := v.(*vaultConfig)
+	assert.True(t, vc.renewable)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), vc.tokenExpires, time.Second*10)
+	vc.refresh()
+	fake.mu.Lock()
+	assert.Equal(t, 0, fake.logins)
+	assert.Equal(t, 1, fake.renewals)
+	fake.mu.Unlock()
+
+	// a token that can't be renewed is an error once it's about to expire
+	v, err = Vault(&VaultConfig{
+		Address:         pointer.String(server.URL),
+		Token:           pointer.String("fixed"),
+		Path:            pointer.String("app"),
+		RefreshInterval: pointer.Duration(time.Minute),
+	})
+	require.NoError(t, err)
+	v.Close()
+	err = v.(*vaultConfig).renewToken()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "can't be renewed")
+	fake.mu.Lock()
+	assert.Equal(t, 1, fake.renewals)
+	fake.mu.Unlock()
+
+	// tokens that don't expire aren't renewed
+	v, err = Vault(&VaultConfig{Address: pointer.String(server.URL), Token: pointer.String("root"), Path: pointer.String("app")})
+	require.NoError(t, err)
+	v.Close()
+	assert.NoError(t, v.(*vaultConfig).renewToken())
+}
+
+func TestVaultErrors(t *testing.T) {
+	fake := &fakeVault{secret: map[string]interface{}{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	_, err := Vault(&VaultConfig{Path: pointer.String("app")})
+	assert.Error(t, err)
+	_, err = Vault(&VaultConfig{Address: pointer.String(server.URL), Path: pointer.String("app")})
+	assert.Error(t, err)
+	_, err = Vault(&VaultConfig{
+		Address:  pointer.String(server.URL),
+		RoleID:   pointer.String("role"),
+		SecretID: pointer.String("wrong"),
+		Path:     pointer.String("app"),
+	})
+	assert.Contains(t, err.Error(), "invalid role or secret ID")
+	_, err = Vault(&VaultConfig{Address: pointer.String(server.URL), Token: pointer.String("bad"), Path: pointer.String("app")})
+	assert.Contains(t, err.Error(), "permission denied")
+
+	v, err := Vault(&VaultConfig{Address: pointer.String(server.URL), Token: pointer.String("root"), Path: pointer.String("other")})
+	require.NoError(t, err)
+	b, err := v.Get("password")
+	assert.NoError(t, err)
+	assert.Nil(t, b)
+	v.Close()
+}
@@ -2,6 +2,7 @@
 package distconf
 
 import (
+	"bytes"
 	errors2 "errors"
 	"fmt"
 	"sync"
@@ -67,6 +68,17 @@ func (c *callbackMap) get(key string) []backingCallbackFunction {
 	return []backingCallbackFunction{}
 }
 
+// changed calls the callbacks of the keys whose values differ between old and values
+func (c *callbackMap) changed(old map[string][]byte, values map[string][]byte) {
+	for key, callbacks := range c.copy() {
+		if !bytes.Equal(old[key], values[key]) || (old[key] == nil) != (values[key] == nil) {
+			for _, cb := range callbacks {
+				cb(key)
+			}
+		}
+	}
+}
+
 func (c *callbackMap) copy() map[string][]backingCallbackFunction {
 	c.mu.Lock()
 	defer c.mu.Unlock()
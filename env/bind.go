@@ -0,0 +1,164 @@
+package env
+
+import (
+	"encoding"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/signalfx/golib/v3/errors"
+)
+
+// RequiredError is returned by Bind when a field tagged as required has no value
+type RequiredError struct {
+	Var string
+}
+
+func (e *RequiredError) Error() string {
+	return fmt.Sprintf("environment variable %s is required", e.Var)
+}
+
+// ParseError is returned by Bind when a value cannot be parsed into its field
+type ParseError struct {
+	Var   string
+	Value string
+	Err   error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("cannot parse environment variable %s=%q: %s", e.Var, e.Value, e.Err)
+}
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// Bind fills the fields of the struct pointed to by dst from environment variables.  Fields are bound
+// with tags like:
+//
+//	Timeout time.Duration `env:"TIMEOUT" envDefault:"10s"`
+//	Hosts   []string      `env:"HOSTS,required"`
+//	Port    *uint16       `env:"PORT"`
+//
+// Strings, bools, ints, uints, floats, time.Duration, encoding.TextUnmarshaler implementations,
+// comma separated slices and pointers to any of those are supported.  Untagged struct fields are bound
+// recursively.  Pointer fields are left nil when there is neither a value nor a default.  Every missing
+// required variable and unparsable value is reported in the returned error.
+func Bind(dst interface{}) error {
+	return BindWith(dst, os.Getenv)
+}
+
+// BindWith is Bind using getenv to look up variables
+func BindWith(dst interface{}, getenv func(string) string) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return errors.Errorf("bind needs a non nil pointer to a struct, not %T", dst)
+	}
+	var errs []error
+	bindStruct(v.Elem(), getenv, &errs)
+	return errors.NewMultiErr(errs)
+}
+
+func bindStruct(v reflect.Value, getenv func(string) string, errs *[]error) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		tag, hasTag := field.Tag.Lookup("env")
+		if !hasTag {
+			if field.Type.Kind() == reflect.Struct && !reflect.PtrTo(field.Type).Implements(textUnmarshalerType) {
+				bindStruct(v.Field(i), getenv, errs)
+			}
+			continue
+		}
+		parts := strings.Split(tag, ",")
+		name := parts[0]
+		required := false
+		for _, opt := range parts[1:] {
+			if opt == "required" {
+				required = true
+			}
+		}
+		val := getenv(name)
+		if val == "" {
+			val = field.Tag.Get("envDefault")
+		}
+		if val == "" {
+			if required {
+				*errs = append(*errs, &RequiredError{Var: name})
+			}
+			continue
+		}
+		if err := setValue(v.Field(i), val); err != nil {
+			*errs = append(*errs, &ParseError{Var: name, Value: val, Err: err})
+		}
+	}
+}
+
+func setValue(v reflect.Value, val string) error {
+	if v.Kind() == reflect.Ptr {
+		n := reflect.New(v.Type().Elem())
+		if err := setValue(n.Elem(), val); err != nil {
+			return err
+		}
+		v.Set(n)
+		return nil
+	}
+	if v.CanAddr() && v.Addr().Type().Implements(textUnmarshalerType) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(val))
+	}
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(val)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(val, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(val, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(val, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		items := strings.Split(strings.Replace(val, " ", "", -1), ",")
+		s := reflect.MakeSlice(v.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := setValue(s.Index(i), item); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+	default:
+		return errors.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
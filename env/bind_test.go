@@ -0,0 +1,106 @@
+package env
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/signalfx/golib/v3/errors"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+type bindNested struct {
+	Name string `env:"NESTED_NAME"`
+}
+
+type bindConfig struct {
+	Host     string        `env:"HOST,required"`
+	Port     uint16        `env:"PORT" envDefault:"8080"`
+	Timeout  time.Duration `env:"TIMEOUT" envDefault:"10s"`
+	Debug    bool          `env:"DEBUG"`
+	Ratio    float64       `env:"RATIO"`
+	Retries  *int          `env:"RETRIES"`
+	Tags     []string      `env:"TAGS"`
+	Weights  []int         `env:"WEIGHTS"`
+	IP       net.IP        `env:"IP"`
+	Nested   bindNested
+	Untagged string
+	private  string
+}
+
+func getenvFrom(m map[string]string) func(string) string {
+	return func(k string) string {
+		return m[k]
+	}
+}
+
+func TestBind(t *testing.T) {
+	convey.Convey("Bind", t, func() {
+		convey.Convey("should fill fields and defaults", func() {
+			var c bindConfig
+			err := BindWith(&c, getenvFrom(map[string]string{
+				"HOST":        "example.com",
+				"DEBUG":       "true",
+				"RATIO":       "0.5",
+				"RETRIES":     "3",
+				"TAGS":        "a, b,c",
+				"WEIGHTS":     "1,2",
+				"IP":          "10.0.0.1",
+				"NESTED_NAME": "nested",
+			}))
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(c.Host, convey.ShouldEqual, "example.com")
+			convey.So(c.Port, convey.ShouldEqual, 8080)
+			convey.So(c.Timeout, convey.ShouldEqual, 10*time.Second)
+			convey.So(c.Debug, convey.ShouldBeTrue)
+			convey.So(c.Ratio, convey.ShouldEqual, 0.5)
+			convey.So(*c.Retries, convey.ShouldEqual, 3)
+			convey.So(c.Tags, convey.ShouldResemble, []string{"a", "b", "c"})
+			convey.So(c.Weights, convey.ShouldResemble, []int{1, 2})
+			convey.So(c.IP.String(), convey.ShouldEqual, "10.0.0.1")
+			convey.So(c.Nested.Name, convey.ShouldEqual, "nested")
+		})
+		convey.Convey("should leave unset pointers nil", func() {
+			var c bindConfig
+			convey.So(BindWith(&c, getenvFrom(map[string]string{"HOST": "h"})), convey.ShouldBeNil)
+			convey.So(c.Retries, convey.ShouldBeNil)
+		})
+		convey.Convey("should report every problem", func() {
+			var c bindConfig
+			err := BindWith(&c, getenvFrom(map[string]string{
+				"PORT":    "99999",
+				"TIMEOUT": "soon",
+				"IP":      "not an ip",
+			}))
+			convey.So(err, convey.ShouldNotBeNil)
+			convey.So(err.Error(), convey.ShouldContainSubstring, "environment variable HOST is required")
+			convey.So(err.Error(), convey.ShouldContainSubstring, "PORT")
+			convey.So(err.Error(), convey.ShouldContainSubstring, "TIMEOUT")
+			convey.So(err.Error(), convey.ShouldContainSubstring, "IP")
+		})
+		convey.Convey("should return typed errors", func() {
+			var c bindConfig
+			err := BindWith(&c, getenvFrom(map[string]string{}))
+			rerr, ok := err.(*RequiredError)
+			convey.So(ok, convey.ShouldBeTrue)
+			convey.So(rerr.Var, convey.ShouldEqual, "HOST")
+
+			err = BindWith(&c, getenvFrom(map[string]string{"HOST": "h", "DEBUG": "maybe"}))
+			perr, ok := errors.Tail(err).(*ParseError)
+			convey.So(ok, convey.ShouldBeTrue)
+			convey.So(perr.Var, convey.ShouldEqual, "DEBUG")
+		})
+		convey.Convey("should reject unsupported types", func() {
+			var c struct {
+				M map[string]string `env:"M"`
+			}
+			convey.So(BindWith(&c, getenvFrom(map[string]string{"M": "x"})), convey.ShouldNotBeNil)
+		})
+		convey.Convey("should reject non struct pointers", func() {
+			var s string
+			convey.So(Bind(&s), convey.ShouldNotBeNil)
+			convey.So(Bind(bindConfig{}), convey.ShouldNotBeNil)
+			convey.So(Bind((*bindConfig)(nil)), convey.ShouldNotBeNil)
+		})
+	})
+}
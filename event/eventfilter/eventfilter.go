@@ -0,0 +1,165 @@
+// Package eventfilter classifies, enriches and drops events with composable rules before they reach a
+// sink, the way dpfilter does for datapoints.
+package eventfilter
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/event"
+	"github.com/signalfx/golib/v3/sfxclient"
+	"github.com/signalfx/golib/v3/trace"
+)
+
+// SeverityDimension is the dimension MapSeverity sets
+const SeverityDimension = "severity"
+
+// A Rule transforms an event, returning nil to drop it.  Rules must not change the event or its maps,
+// which can be shared, but return a changed copy instead.
+type Rule interface {
+	Apply(e *event.Event) *event.Event
+}
+
+// RuleFunc is a func that is a Rule
+type RuleFunc func(e *event.Event) *event.Event
+
+// Apply calls f
+func (f RuleFunc) Apply(e *event.Event) *event.Event {
+	return f(e)
+}
+
+// withDimension returns a copy of e with the dimension key set to value
+func withDimension(e *event.Event, key string, value string) *event.Event {
+	ret := *e
+	return ret.WithDim(key, value)
+}
+
+// DropEvents drops events with event types matching re
+func DropEvents(re *regexp.Regexp) Rule {
+	return RuleFunc(func(e *event.Event) *event.Event {
+		if re.MatchString(e.EventType) {
+			return nil
+		}
+		return e
+	})
+}
+
+// Categorize sets the category of events with event types matching re
+func Categorize(re *regexp.Regexp, category event.Category) Rule {
+	return RuleFunc(func(e *event.Event) *event.Event {
+		if e.Category == category || !re.MatchString(e.EventType) {
+			return e
+		}
+		ret := *e
+		return ret.WithCategory(category)
+	})
+}
+
+// AddDimensions sets dims on every event that doesn't already have them, so defaults like the host or
+// environment don't replace what the event says
+func AddDimensions(dims map[string]string) Rule {
+	return RuleFunc(func(e *event.Event) *event.Event {
+		var missing map[string]string
+		for k, v := range dims {
+			if _, exists := e.Dimensions[k]; exists {
+				continue
+			}
+			if missing == nil {
+				missing = make(map[string]string, len(dims))
+			}
+			missing[k] = v
+		}
+		if missing == nil {
+			return e
+		}
+		ret := *e
+		return ret.WithDims(missing)
+	})
+}
+
+// MapSeverity sets the SeverityDimension of events to severities[v], where v is the value of the property,
+// like a log level, lower cased.  Events without the property, or with a value not in severities, are left
+// alone.  The keys of severities must be lower case.
+func MapSeverity(property string, severities map[string]string) Rule {
+	return RuleFunc(func(e *event.Event) *event.Event {
+		v, exists := e.Properties[property]
+		if !exists {
+			return e
+		}
+		severity, exists := severities[strings.ToLower(fmt.Sprint(v))]
+		if !exists || e.Dimensions[SeverityDimension] == severity {
+			return e
+		}
+		return withDimension(e, SeverityDimension, severity)
+	})
+}
+
+// Filter applies rules to events in order, stopping at the first that drops an event
+type Filter struct {
+	rules   []Rule
+	dropped int64
+}
+
+var _ sfxclient.Collector = &Filter{}
+
+// New creates a Filter applying rules in order
+func New(rules ...Rule) *Filter {
+	return &Filter{rules: rules}
+}
+
+// Apply returns events with the rules applied, without changing events or the events in it
+func (f *Filter) Apply(events []*event.Event) []*event.Event {
+	ret := make([]*event.Event, 0, len(events))
+	for _, e := range events {
+		for _, r := range f.rules {
+			if e = r.Apply(e); e == nil {
+				break
+			}
+		}
+		if e != nil {
+			ret = append(ret, e)
+		}
+	}
+	if dropped := len(events) - len(ret); dropped > 0 {
+		atomic.AddInt64(&f.dropped, int64(dropped))
+	}
+	return ret
+}
+
+// Datapoints returns how many events the filter dropped
+func (f *Filter) Datapoints() []*datapoint.Datapoint {
+	return []*datapoint.Datapoint{
+		sfxclient.Cumulative("total_eventfilter_dropped", nil, atomic.LoadInt64(&f.dropped)),
+	}
+}
+
+// Middleware applies the filter to the events sent to next.  Datapoints and spans go through unchanged.
+func (f *Filter) Middleware() sfxclient.Middleware {
+	return func(next sfxclient.FullSink) sfxclient.FullSink {
+		return &filterSink{filter: f, next: next}
+	}
+}
+
+type filterSink struct {
+	filter *Filter
+	next   sfxclient.FullSink
+}
+
+func (s *filterSink) AddDatapoints(ctx context.Context, points []*datapoint.Datapoint) error {
+	return s.next.AddDatapoints(ctx, points)
+}
+
+func (s *filterSink) AddEvents(ctx context.Context, events []*event.Event) error {
+	if events = s.filter.Apply(events); len(events) == 0 {
+		return nil
+	}
+	return s.next.AddEvents(ctx, events)
+}
+
+func (s *filterSink) AddSpans(ctx context.Context, spans []*trace.Span) error {
+	return s.next.AddSpans(ctx, spans)
+}
@@ -0,0 +1,88 @@
+package eventfilter
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/datapoint/dptest"
+	"github.com/signalfx/golib/v3/event"
+	"github.com/signalfx/golib/v3/sfxclient"
+	"github.com/signalfx/golib/v3/trace"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRules(t *testing.T) {
+	Convey("event rules", t, func() {
+		dims := map[string]string{"host": "a"}
+		props := map[string]interface{}{"level": "WARN"}
+		e := event.NewWithProperties("k8s.pod.crash", event.USERDEFINED, dims, props, time.Time{})
+		apply := func(r Rule) *event.Event {
+			ret := r.Apply(e)
+			So(dims, ShouldResemble, map[string]string{"host": "a"})
+			So(e.Category, ShouldEqual, event.USERDEFINED)
+			return ret
+		}
+		Convey("should drop by event type", func() {
+			So(apply(DropEvents(regexp.MustCompile(`^k8s\.`))), ShouldBeNil)
+			So(apply(DropEvents(regexp.MustCompile(`^deploy`))), ShouldEqual, e)
+		})
+		Convey("should categorize by event type", func() {
+			So(apply(Categorize(regexp.MustCompile(`crash$`), event.ALERT)).Category, ShouldEqual, event.ALERT)
+			So(apply(Categorize(regexp.MustCompile(`^deploy`), event.ALERT)), ShouldEqual, e)
+			So(apply(Categorize(regexp.MustCompile(`crash$`), event.USERDEFINED)), ShouldEqual, e)
+		})
+		Convey("should add default dimensions", func() {
+			So(apply(AddDimensions(map[string]string{"host": "b", "env": "prod"})).Dimensions, ShouldResemble,
+				map[string]string{"host": "a", "env": "prod"})
+			So(apply(AddDimensions(map[string]string{"host": "b"})), ShouldEqual, e)
+		})
+		Convey("should map severity from a property", func() {
+			severities := map[string]string{"warn": "warning", "error": "critical"}
+			So(apply(MapSeverity("level", severities)).Dimensions, ShouldResemble,
+				map[string]string{"host": "a", SeverityDimension: "warning"})
+			So(apply(MapSeverity("missing", severities)), ShouldEqual, e)
+			So(apply(MapSeverity("level", map[string]string{"info": "info"})), ShouldEqual, e)
+		})
+	})
+}
+
+func TestFilter(t *testing.T) {
+	Convey("a filter", t, func() {
+		f := New(
+			DropEvents(regexp.MustCompile(`^debug\.`)),
+			Categorize(regexp.MustCompile(`^deploy`), event.AUDIT),
+			RuleFunc(func(e *event.Event) *event.Event {
+				So(e.Category, ShouldEqual, event.AUDIT)
+				return e
+			}),
+		)
+		events := []*event.Event{
+			event.New("debug.x", event.USERDEFINED, nil, time.Time{}),
+			event.New("deploy", event.USERDEFINED, nil, time.Time{}),
+		}
+		Convey("should apply rules in order", func() {
+			got := f.Apply(events)
+			So(len(got), ShouldEqual, 1)
+			So(got[0].Category, ShouldEqual, event.AUDIT)
+			So(events[1].Category, ShouldEqual, event.USERDEFINED)
+			So(f.Datapoints()[0].Value, ShouldResemble, datapoint.NewIntValue(1))
+		})
+		Convey("should be sink middleware", func() {
+			next := dptest.NewBasicSink()
+			next.Resize(1)
+			sink := sfxclient.Chain(next, f.Middleware())
+			ctx := context.Background()
+			So(sink.AddEvents(ctx, events), ShouldBeNil)
+			So(len(<-next.EventsChan), ShouldEqual, 1)
+			So(sink.AddEvents(ctx, events[:1]), ShouldBeNil)
+			So(len(next.EventsChan), ShouldEqual, 0)
+			So(sink.AddDatapoints(ctx, []*datapoint.Datapoint{sfxclient.Gauge("m", nil, 1)}), ShouldBeNil)
+			So(next.Next().Metric, ShouldEqual, "m")
+			So(sink.AddSpans(ctx, []*trace.Span{{ID: "s"}}), ShouldBeNil)
+			So(next.NextSpan().ID, ShouldEqual, "s")
+		})
+	})
+}
@@ -0,0 +1,206 @@
+package event
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/signalfx/golib/v3/datapoint"
+)
+
+// The limits SignalFx ingest puts on events, on top of the datapoint limits on dimensions.  Events past
+// them are rejected.
+const (
+	MaxEventTypeLength     = 256
+	MaxPropertyNameLength  = 128
+	MaxPropertyValueLength = 256
+	MaxProperties          = 36
+)
+
+// reservedPrefix starts dimension and property names SignalFx keeps for itself
+const reservedPrefix = "sf_"
+
+// ValidationError lists every way an event breaks the limits of SignalFx ingest
+type ValidationError struct {
+	EventType string
+	Problems  []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid event %q: %s", e.EventType, strings.Join(e.Problems, "; "))
+}
+
+// NewValidated creates a new event like NewWithProperties, returning a *ValidationError instead if SignalFx
+// ingest would reject it
+func NewValidated(eventType string, category Category, dimensions map[string]string, properties map[string]interface{}, timestamp time.Time) (*Event, error) {
+	e := NewWithProperties(eventType, category, dimensions, properties, timestamp)
+	if err := e.Validate(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// WithDim sets the dimension key to value, returning e so calls can be chained, like
+// New(...).WithDim(k, v).WithProperty(k, v).  The dimensions are copied first, so maps shared with other
+// events aren't changed.
+func (e *Event) WithDim(key string, value string) *Event {
+	e.Dimensions = datapoint.AddMaps(e.Dimensions, map[string]string{key: value})
+	return e
+}
+
+// WithDims is like WithDim for each of dims
+func (e *Event) WithDims(dims map[string]string) *Event {
+	if len(dims) == 0 {
+		return e
+	}
+	e.Dimensions = datapoint.AddMaps(e.Dimensions, dims)
+	return e
+}
+
+// WithProperty sets the property key to value, returning e so calls can be chained.  The properties are
+// copied first, so maps shared with other events aren't changed.
+func (e *Event) WithProperty(key string, value interface{}) *Event {
+	properties := make(map[string]interface{}, len(e.Properties)+1)
+	for k, v := range e.Properties {
+		properties[k] = v
+	}
+	properties[key] = value
+	e.Properties = properties
+	return e
+}
+
+// WithCategory sets the category, returning e so calls can be chained
+func (e *Event) WithCategory(category Category) *Event {
+	e.Category = category
+	return e
+}
+
+// WithTime sets the timestamp, returning e so calls can be chained
+func (e *Event) WithTime(t time.Time) *Event {
+	e.Timestamp = t
+	return e
+}
+
+// StringProperty returns the property key if it's a string
+func (e *Event) StringProperty(key string) (string, bool) {
+	s, ok := e.Properties[key].(string)
+	return s, ok
+}
+
+// IntProperty returns the property key if it's an integer of any size
+func (e *Event) IntProperty(key string) (int64, bool) {
+	switch v := e.Properties[key].(type) {
+	case int:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint8:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	}
+	return 0, false
+}
+
+// FloatProperty returns the property key if it's a number, converting integers
+func (e *Event) FloatProperty(key string) (float64, bool) {
+	switch v := e.Properties[key].(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	}
+	i, ok := e.IntProperty(key)
+	return float64(i), ok
+}
+
+// BoolProperty returns the property key if it's a bool
+func (e *Event) BoolProperty(key string) (value bool, ok bool) {
+	value, ok = e.Properties[key].(bool)
+	return value, ok
+}
+
+// Validate returns a *ValidationError listing what about e SignalFx ingest would reject it for, or nil if
+// nothing.  The event type must be at most MaxEventTypeLength characters.  Dimensions have the same limits
+// as datapoint dimensions.  There can be at most MaxProperties properties, whose names follow the rules of
+// dimension names but must be at most MaxPropertyNameLength characters, and whose values must be strings of at
+// most MaxPropertyValueLength characters, ints, int64s, float64s or bools, the types sinks send.
+func (e *Event) Validate() error {
+	var problems []string
+	switch n := utf8.RuneCountInString(e.EventType); {
+	case n == 0:
+		problems = append(problems, "event type is empty")
+	case n > MaxEventTypeLength:
+		problems = append(problems, fmt.Sprintf("event type is %d characters, over the limit of %d", n, MaxEventTypeLength))
+	}
+	if len(e.Dimensions) > datapoint.MaxDimensions {
+		problems = append(problems, fmt.Sprintf("has %d dimensions, over the limit of %d", len(e.Dimensions), datapoint.MaxDimensions))
+	}
+	datapoint.RangeSorted(e.Dimensions, func(key string, value string) {
+		if problem := nameProblem(key, datapoint.MaxDimensionNameLength); problem != "" {
+			problems = append(problems, fmt.Sprintf("dimension name %q %s", key, problem))
+		}
+		if n := utf8.RuneCountInString(value); n > datapoint.MaxDimensionValueLength {
+			problems = append(problems, fmt.Sprintf("dimension %q value is %d characters, over the limit of %d", key, n, datapoint.MaxDimensionValueLength))
+		}
+	})
+	if len(e.Properties) > MaxProperties {
+		problems = append(problems, fmt.Sprintf("has %d properties, over the limit of %d", len(e.Properties), MaxProperties))
+	}
+	datapoint.RangeSorted(e.Properties, func(key string, value interface{}) {
+		if problem := nameProblem(key, MaxPropertyNameLength); problem != "" {
+			problems = append(problems, fmt.Sprintf("property name %q %s", key, problem))
+		}
+		if problem := propertyValueProblem(value); problem != "" {
+			problems = append(problems, fmt.Sprintf("property %q %s", key, problem))
+		}
+	})
+	if len(problems) == 0 {
+		return nil
+	}
+	return &ValidationError{EventType: e.EventType, Problems: problems}
+}
+
+func nameProblem(key string, maxLength int) string {
+	if key == "" {
+		return "is empty"
+	}
+	if n := utf8.RuneCountInString(key); n > maxLength {
+		return fmt.Sprintf("is %d characters, over the limit of %d", n, maxLength)
+	}
+	if strings.HasPrefix(key, reservedPrefix) {
+		return "starts with the reserved prefix " + reservedPrefix
+	}
+	for i, r := range key {
+		letter := (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+		if i == 0 && !letter {
+			return "must start with a letter"
+		}
+		if !letter && !(r >= '0' && r <= '9') && r != '_' && r != '-' {
+			return fmt.Sprintf("has the invalid character %q", r)
+		}
+	}
+	return ""
+}
+
+func propertyValueProblem(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		if n := utf8.RuneCountInString(v); n > MaxPropertyValueLength {
+			return fmt.Sprintf("value is %d characters, over the limit of %d", n, MaxPropertyValueLength)
+		}
+	case bool, float64, int, int64:
+	default:
+		return fmt.Sprintf("value has the unsupported type %T", value)
+	}
+	return ""
+}
@@ -0,0 +1,93 @@
+package event
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBuilder(t *testing.T) {
+	Convey("an event built fluently", t, func() {
+		shared := map[string]string{"host": "a"}
+		sharedProps := map[string]interface{}{"version": "1"}
+		now := time.Unix(1600000000, 0)
+		e := NewWithProperties("deploy", USERDEFINED, shared, sharedProps, time.Time{}).
+			WithDim("region", "us").
+			WithDims(map[string]string{"host": "b"}).
+			WithProperty("count", 3).
+			WithProperty("ratio", 0.5).
+			WithProperty("ok", true).
+			WithCategory(ALERT).
+			WithTime(now)
+		So(e.Dimensions, ShouldResemble, map[string]string{"host": "b", "region": "us"})
+		So(e.Properties, ShouldResemble, map[string]interface{}{"version": "1", "count": 3, "ratio": 0.5, "ok": true})
+		So(e.Category, ShouldEqual, ALERT)
+		So(e.Timestamp, ShouldEqual, now)
+		So(shared, ShouldResemble, map[string]string{"host": "a"})
+		So(sharedProps, ShouldResemble, map[string]interface{}{"version": "1"})
+
+		Convey("should have typed properties", func() {
+			s, ok := e.StringProperty("version")
+			So(s, ShouldEqual, "1")
+			So(ok, ShouldBeTrue)
+			_, ok = e.StringProperty("count")
+			So(ok, ShouldBeFalse)
+			i, ok := e.IntProperty("count")
+			So(i, ShouldEqual, 3)
+			So(ok, ShouldBeTrue)
+			_, ok = e.IntProperty("ratio")
+			So(ok, ShouldBeFalse)
+			f, ok := e.FloatProperty("ratio")
+			So(f, ShouldEqual, 0.5)
+			So(ok, ShouldBeTrue)
+			f, ok = e.FloatProperty("count")
+			So(f, ShouldEqual, 3)
+			So(ok, ShouldBeTrue)
+			_, ok = e.FloatProperty("missing")
+			So(ok, ShouldBeFalse)
+			b, ok := e.BoolProperty("ok")
+			So(b, ShouldBeTrue)
+			So(ok, ShouldBeTrue)
+		})
+	})
+}
+
+func TestValidate(t *testing.T) {
+	Convey("validating events", t, func() {
+		Convey("should pass ones SignalFx takes", func() {
+			e, err := NewValidated("deploy", USERDEFINED, map[string]string{"host": "a"}, map[string]interface{}{"sha": "abc", "n": int64(1)}, time.Time{})
+			So(err, ShouldBeNil)
+			So(e.EventType, ShouldEqual, "deploy")
+		})
+		Convey("should list every problem", func() {
+			properties := map[string]interface{}{
+				"sf_hidden": "v",
+				"1st":       "v",
+				"long":      strings.Repeat("v", MaxPropertyValueLength+1),
+				"odd":       struct{}{},
+			}
+			for i := 0; i < MaxProperties; i++ {
+				properties[strings.Repeat("p", i+1)] = i
+			}
+			_, err := NewValidated("", USERDEFINED, map[string]string{"bad key": "v"}, properties, time.Time{})
+			verr, ok := err.(*ValidationError)
+			So(ok, ShouldBeTrue)
+			So(verr.Problems, ShouldResemble, []string{
+				"event type is empty",
+				`dimension name "bad key" has the invalid character ' '`,
+				"has 40 properties, over the limit of 36",
+				`property name "1st" must start with a letter`,
+				`property "long" value is 257 characters, over the limit of 256`,
+				`property "odd" value has the unsupported type struct {}`,
+				`property name "sf_hidden" starts with the reserved prefix sf_`,
+			})
+			So(err.Error(), ShouldStartWith, `invalid event "": event type is empty; `)
+		})
+		Convey("should limit the event type", func() {
+			err := New(strings.Repeat("e", MaxEventTypeLength+1), USERDEFINED, nil, time.Time{}).Validate()
+			So(err.Error(), ShouldContainSubstring, "event type is 257 characters")
+		})
+	})
+}
@@ -13,6 +13,7 @@ type EventCounter struct {
 
 	nsSinceStart     int64
 	eventsThisPeriod int64
+	totalEvents      int64
 }
 
 // New returns a new EventCounter object that resets event counts per duration.
@@ -50,5 +51,16 @@ func (a *EventCounter) Events(now time.Time, count int64) int64 {
 			break
 		}
 	}
+	atomic.AddInt64(&a.totalEvents, count)
 	return atomic.AddInt64(&a.eventsThisPeriod, count)
 }
+
+// Total returns the number of events ever counted, regardless of period
+func (a *EventCounter) Total() int64 {
+	return atomic.LoadInt64(&a.totalEvents)
+}
+
+// Period returns the duration events are counted over before resetting
+func (a *EventCounter) Period() time.Duration {
+	return a.eventDuration
+}
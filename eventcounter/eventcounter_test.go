@@ -83,3 +83,13 @@ func BenchmarkEventCounterDifferentBuckets20(b *testing.B) {
 	}
 	wg.Wait()
 }
+
+func TestTotal(t *testing.T) {
+	now := time.Now()
+	a := New(now, time.Minute)
+	a.Events(now, 2)
+	a.Events(now.Add(time.Minute*2), 3)
+	assert.Equal(t, int64(3), a.Events(now.Add(time.Minute*2), 0))
+	assert.Equal(t, int64(5), a.Total())
+	assert.Equal(t, time.Minute, a.Period())
+}
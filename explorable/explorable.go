@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"html"
 	"net/http"
+	"path"
 	"reflect"
 	"runtime"
 	"strconv"
@@ -30,6 +31,75 @@ type Handler struct {
 	Val      interface{}
 	BasePath string
 	Logger   log.Logger
+	// Allow, if not empty, are glob patterns (see path.Match) of object paths like "Config/Timeout" that may
+	// be explored.  Everything below an allowed path is allowed, as are the parents needed to navigate to it
+	Allow []string
+	// Deny are glob patterns of object paths that may not be explored, along with everything below them.
+	// Deny wins over Allow
+	Deny []string
+	// MaxDepth, if positive, is the deepest path that may be explored
+	MaxDepth int
+	// MaxChildren, if positive, caps how many children are listed
+	MaxChildren int
+	// MaxDescBytes, if positive, truncates descriptions longer than this
+	MaxDescBytes int
+}
+
+func matchesAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if matched, _ := path.Match(p, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// allowed returns true if the object path made of parts passes the Allow, Deny and MaxDepth checks
+func (h *Handler) allowed(parts []string) bool {
+	if h.MaxDepth > 0 && len(parts) > h.MaxDepth {
+		return false
+	}
+	for i := 1; i <= len(parts); i++ {
+		if matchesAny(h.Deny, strings.Join(parts[:i], "/")) {
+			return false
+		}
+	}
+	if len(h.Allow) == 0 {
+		return true
+	}
+	for i := 1; i <= len(parts); i++ {
+		if matchesAny(h.Allow, strings.Join(parts[:i], "/")) {
+			return true
+		}
+	}
+	// parents of an allowed path are allowed so the allowed path can be reached
+	for _, pattern := range h.Allow {
+		patternParts := strings.Split(pattern, "/")
+		if len(patternParts) > len(parts) {
+			if matched, _ := path.Match(strings.Join(patternParts[:len(parts)], "/"), strings.Join(parts, "/")); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// limit applies Allow, Deny, MaxChildren and MaxDescBytes to the result of exploring parts
+func (h *Handler) limit(o *Result, parts []string) {
+	if h.MaxDescBytes > 0 && len(o.Desc) > h.MaxDescBytes {
+		o.Desc = o.Desc[:h.MaxDescBytes] + "..."
+	}
+	children := make([]string, 0, len(o.Children))
+	for _, c := range o.Children {
+		if h.allowed(append(parts[:len(parts):len(parts)], c)) {
+			children = append(children, c)
+		}
+	}
+	if h.MaxChildren > 0 && len(children) > h.MaxChildren {
+		o.Desc += fmt.Sprintf(" (showing %d of %d children)", h.MaxChildren, len(children))
+		children = children[:h.MaxChildren]
+	}
+	o.Children = children
 }
 
 func (h *Handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
@@ -45,7 +115,14 @@ func (h *Handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 		}
 	}
 	logger.Log(logkey.ExplorableParts, fmt.Sprintf("%v", nonEmptyParts), logkey.URL, r.URL, "Exploring object")
+	if !h.allowed(nonEmptyParts) {
+		rw.WriteHeader(http.StatusForbidden)
+		_, err := rw.Write([]byte("path may not be explored"))
+		log.IfErr(logger, err)
+		return
+	}
 	o := ExploreObject(reflect.ValueOf(h.Val), nonEmptyParts)
+	h.limit(o, nonEmptyParts)
 
 	parent := ""
 	if len(nonEmptyParts) > 0 {
@@ -263,3 +263,50 @@ func TestSlice(t *testing.T) {
 	p = nil
 	assert.Equal(t, "<NIL>", exploreSlice(reflect.ValueOf(p), []string{"abc"}).Desc)
 }
+
+type secretConfig struct {
+	Name     string
+	Password string
+	Nested   map[string]string
+	Items    []int
+}
+
+func TestHandlerLimits(t *testing.T) {
+	conf := &secretConfig{
+		Name:     "a very long name",
+		Password: "hunter2",
+		Nested:   map[string]string{"token": "abc", "other": "def"},
+		Items:    []int{1, 2, 3, 4},
+	}
+	get := func(h *Handler, p string) *httptest.ResponseRecorder {
+		rw := httptest.NewRecorder()
+		req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, "/test/"+p, nil)
+		h.ServeHTTP(rw, req)
+		return rw
+	}
+
+	h := &Handler{Val: conf, BasePath: "/test/", Deny: []string{"Password", "Nested/tok*"}}
+	assert.Equal(t, http.StatusForbidden, get(h, "Password").Code)
+	assert.Equal(t, http.StatusForbidden, get(h, "Nested/token").Code)
+	assert.Equal(t, http.StatusOK, get(h, "Nested/other").Code)
+	root := get(h, "").Body.String()
+	assert.NotContains(t, root, "Password")
+	assert.Contains(t, root, "Name")
+
+	h = &Handler{Val: conf, BasePath: "/test/", Allow: []string{"Nested/other", "Items"}}
+	assert.Equal(t, http.StatusOK, get(h, "").Code)
+	assert.Equal(t, http.StatusOK, get(h, "Nested").Code)
+	assert.Equal(t, http.StatusOK, get(h, "Nested/other").Code)
+	assert.Equal(t, http.StatusOK, get(h, "Items/1").Code)
+	assert.Equal(t, http.StatusForbidden, get(h, "Nested/token").Code)
+	assert.Equal(t, http.StatusForbidden, get(h, "Name").Code)
+	assert.NotContains(t, get(h, "Nested").Body.String(), "token")
+
+	h = &Handler{Val: conf, BasePath: "/test/", MaxDepth: 1}
+	assert.Equal(t, http.StatusOK, get(h, "Items").Code)
+	assert.Equal(t, http.StatusForbidden, get(h, "Items/1").Code)
+
+	h = &Handler{Val: conf, BasePath: "/test/", MaxChildren: 2, MaxDescBytes: 6}
+	assert.Contains(t, get(h, "Items").Body.String(), "slice-... (showing 2 of 4 children)")
+	assert.Contains(t, get(h, "Name").Body.String(), "a very...")
+}
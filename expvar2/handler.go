@@ -8,6 +8,7 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"path"
 	"strconv"
 	"strings"
 
@@ -19,6 +20,76 @@ import (
 type Handler struct {
 	Exported map[string]expvar.Var
 	Logger   log.Logger
+	// Allow, if not empty, are glob patterns (see path.Match) of the only variable names served
+	Allow []string
+	// Deny are glob patterns of variable names that are never served.  Deny wins over Allow
+	Deny []string
+	// MaxDepth, if positive, replaces JSON objects and arrays nested deeper than this inside a variable
+	// with a placeholder string
+	MaxDepth int
+	// MaxVarBytes, if positive, replaces variables whose JSON is larger than this with a placeholder string
+	MaxVarBytes int
+}
+
+const (
+	truncatedDepth = "[truncated: max depth]"
+	truncatedSize  = "[truncated: %d bytes]"
+)
+
+func matchesAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if matched, _ := path.Match(p, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// allowed returns true if the variable name passes the Allow and Deny lists
+func (e *Handler) allowed(name string) bool {
+	if matchesAny(e.Deny, name) {
+		return false
+	}
+	return len(e.Allow) == 0 || matchesAny(e.Allow, name)
+}
+
+// limit applies MaxDepth and MaxVarBytes to the JSON of a single variable
+func (e *Handler) limit(value string) string {
+	if e.MaxDepth > 0 {
+		// numbers are kept as json.Number so int64s larger than a float64 can hold exactly survive
+		dec := json.NewDecoder(strings.NewReader(value))
+		dec.UseNumber()
+		var v interface{}
+		if err := dec.Decode(&v); err == nil {
+			if b, err := json.Marshal(truncateDepth(v, e.MaxDepth)); err == nil {
+				value = string(b)
+			}
+		}
+	}
+	if e.MaxVarBytes > 0 && len(value) > e.MaxVarBytes {
+		return strconv.Quote(fmt.Sprintf(truncatedSize, len(value)))
+	}
+	return value
+}
+
+func truncateDepth(v interface{}, depth int) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		if depth <= 0 {
+			return truncatedDepth
+		}
+		for k, child := range t {
+			t[k] = truncateDepth(child, depth-1)
+		}
+	case []interface{}:
+		if depth <= 0 {
+			return truncatedDepth
+		}
+		for i, child := range t {
+			t[i] = truncateDepth(child, depth-1)
+		}
+	}
+	return v
 }
 
 // New creates and returns a new handler
@@ -70,7 +141,7 @@ func (e *Handler) initialDump(w io.Writer, onlyFetch filterSet) {
 		if _, exists := usedKeys[kv.Key]; exists {
 			return
 		}
-		if onlyFetch.shouldFilter(kv.Key) {
+		if onlyFetch.shouldFilter(kv.Key) || !e.allowed(kv.Key) {
 			return
 		}
 		if !first {
@@ -78,7 +149,7 @@ func (e *Handler) initialDump(w io.Writer, onlyFetch filterSet) {
 			log.IfErr(e.Logger, err)
 		}
 		first = false
-		_, err = fmt.Fprintf(w, "%q:%s", kv.Key, kv.Value)
+		_, err = fmt.Fprintf(w, "%q:%s", kv.Key, e.limit(kv.Value.String()))
 		log.IfErr(e.Logger, err)
 	}
 	for k, v := range e.Exported {
@@ -3,6 +3,7 @@ package expvar2
 import (
 	"context"
 	"expvar"
+	"math"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -45,6 +46,50 @@ func TestExpvarHandler(t *testing.T) {
 				So(w.Body.String(), ShouldContainSubstring, "world")
 			})
 		})
+		Convey("And secrets registered", func() {
+			e.Exported["db.password"] = expvar.Func(func() interface{} {
+				return "hunter2"
+			})
+			e.Exported["nested"] = expvar.Func(func() interface{} {
+				return map[string]interface{}{"a": map[string]interface{}{"b": []int{1, 2}}}
+			})
+			Convey("Deny should hide them", func() {
+				e.Deny = []string{"*password*"}
+				e.ServeHTTP(w, req)
+				So(w.Body.String(), ShouldNotContainSubstring, "hunter2")
+				So(w.Body.String(), ShouldContainSubstring, "nested")
+			})
+			Convey("Allow should only show allowed variables", func() {
+				e.Allow = []string{"nested", "db.*"}
+				e.Deny = []string{"db.password"}
+				e.ServeHTTP(w, req)
+				So(w.Body.String(), ShouldNotContainSubstring, "hunter2")
+				So(w.Body.String(), ShouldNotContainSubstring, toFind)
+				So(w.Body.String(), ShouldContainSubstring, "nested")
+			})
+			Convey("MaxDepth should truncate nested values", func() {
+				e.Allow = []string{"nested"}
+				e.MaxDepth = 1
+				e.ServeHTTP(w, req)
+				So(w.Body.String(), ShouldEqual, `{"nested":{"a":"[truncated: max depth]"}}`)
+			})
+			Convey("MaxDepth should keep large integers exact", func() {
+				e.Exported["big"] = expvar.Func(func() interface{} {
+					return map[string]interface{}{"count": int64(math.MaxInt64), "ratio": 0.5}
+				})
+				e.Allow = []string{"big"}
+				e.MaxDepth = 1
+				e.ServeHTTP(w, req)
+				So(w.Body.String(), ShouldEqual, `{"big":{"count":9223372036854775807,"ratio":0.5}}`)
+			})
+			Convey("MaxVarBytes should truncate big values", func() {
+				e.Allow = []string{"nested", "db.password"}
+				e.MaxVarBytes = 10
+				e.ServeHTTP(w, req)
+				So(w.Body.String(), ShouldContainSubstring, `"nested":"[truncated: 17 bytes]"`)
+				So(w.Body.String(), ShouldContainSubstring, `"db.password":"hunter2"`)
+			})
+		})
 		Convey("Pretty printing should be larger", func() {
 			reqWithPretty, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, "/bob?pretty=true", nil)
 			e.ServeHTTP(w, req)
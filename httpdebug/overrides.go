@@ -0,0 +1,105 @@
+package httpdebug
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/signalfx/golib/v3/log"
+)
+
+// requireToken serves requests with h only if they have the header Authorization: Bearer <token>
+func requireToken(token string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		auth := req.Header.Get("Authorization")
+		const prefix = "bearer "
+		if len(auth) < len(prefix) || !strings.EqualFold(auth[:len(prefix)], prefix) ||
+			subtle.ConstantTimeCompare([]byte(auth[len(prefix):]), []byte(token)) != 1 {
+			rw.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(rw, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(rw, req)
+	})
+}
+
+// LoggerLevel is the level of a named logger served by LogLevels
+type LoggerLevel struct {
+	Level log.Level `json:"level"`
+	// RevertsTo is the level the logger changes back to at RevertsAt, if its level was changed for a while
+	RevertsTo *log.Level `json:"reverts_to,omitempty"`
+	RevertsAt *time.Time `json:"reverts_at,omitempty"`
+}
+
+// LogLevels serves the levels of named loggers, and changes them for a while
+type LogLevels struct {
+	Loggers    map[string]*log.Leveled
+	DefaultTTL time.Duration
+}
+
+// Levels returns the level of each logger
+func (l *LogLevels) Levels() map[string]LoggerLevel {
+	ret := make(map[string]LoggerLevel, len(l.Loggers))
+	for name, logger := range l.Loggers {
+		level := LoggerLevel{Level: logger.Level()}
+		if revertsTo, at, pending := logger.PendingRevert(); pending {
+			level.RevertsTo = &revertsTo
+			level.RevertsAt = &at
+		}
+		ret[name] = level
+	}
+	return ret
+}
+
+// ServeHTTP responds with the Levels as JSON.  POST and PUT requests first change the level of the logger
+// named by the name form value to the level form value, for the ttl form value or DefaultTTL if there isn't
+// one.  DELETE requests first change the named logger back to its level before, if it was changed.
+func (l *LogLevels) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost, http.MethodDelete:
+		name := req.FormValue("name")
+		logger, exists := l.Loggers[name]
+		if !exists {
+			http.Error(rw, fmt.Sprintf("unknown logger %q, known loggers are %s", name, strings.Join(l.names(), ", ")), http.StatusNotFound)
+			return
+		}
+		if req.Method == http.MethodDelete {
+			if revertsTo, _, pending := logger.PendingRevert(); pending {
+				logger.SetLevel(revertsTo)
+			}
+			break
+		}
+		level, err := log.ParseLevel(req.FormValue("level"))
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ttl := l.DefaultTTL
+		if ttlStr := req.FormValue("ttl"); ttlStr != "" {
+			if ttl, err = time.ParseDuration(ttlStr); err != nil || ttl <= 0 {
+				http.Error(rw, fmt.Sprintf("invalid ttl %q", ttlStr), http.StatusBadRequest)
+				return
+			}
+		}
+		logger.SetLevelFor(level, ttl)
+	default:
+		http.Error(rw, "only GET, PUT, POST and DELETE are supported", http.StatusMethodNotAllowed)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(rw).Encode(l.Levels())
+}
+
+func (l *LogLevels) names() []string {
+	names := make([]string, 0, len(l.Loggers))
+	for name := range l.Loggers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,84 @@
+package httpdebug
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/signalfx/golib/v3/distconf"
+	"github.com/signalfx/golib/v3/log"
+	"github.com/signalfx/golib/v3/pointer"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestOverrides(t *testing.T) {
+	Convey("a debug server with an admin token", t, func() {
+		conf := distconf.New([]distconf.Reader{distconf.Mem()})
+		size := conf.Int("cache.size", 10)
+		logger := log.NewLeveled(log.Discard, log.InfoLevel)
+		ser := New(&Config{
+			Distconf:   conf,
+			AdminToken: pointer.String("t0ken"),
+			LogLevels:  map[string]*log.Leveled{"root": logger},
+		})
+		serve := func(method string, path string, token string, form url.Values) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path+"?"+form.Encode(), nil)
+			if token != "" {
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+			rw := httptest.NewRecorder()
+			ser.Handler.ServeHTTP(rw, req)
+			return rw
+		}
+		Convey("should require the token", func() {
+			for _, path := range []string{"/debug/distconf/overrides", "/debug/loglevels"} {
+				So(serve(http.MethodGet, path, "", nil).Code, ShouldEqual, http.StatusUnauthorized)
+				So(serve(http.MethodGet, path, "wrong", nil).Code, ShouldEqual, http.StatusUnauthorized)
+				So(serve(http.MethodGet, path, "t0ken", nil).Code, ShouldEqual, http.StatusOK)
+			}
+		})
+		Convey("should override distconf values", func() {
+			rw := serve(http.MethodPost, "/debug/distconf/overrides", "t0ken", url.Values{"key": {"cache.size"}, "value": {"20"}, "ttl": {"1m"}})
+			So(rw.Code, ShouldEqual, http.StatusOK)
+			So(size.Get(), ShouldEqual, 20)
+			So(rw.Body.String(), ShouldContainSubstring, `"key":"cache.size"`)
+			serve(http.MethodDelete, "/debug/distconf/overrides", "t0ken", url.Values{"key": {"cache.size"}})
+			So(size.Get(), ShouldEqual, 10)
+		})
+		Convey("should change log levels for a while", func() {
+			rw := serve(http.MethodPut, "/debug/loglevels", "t0ken", url.Values{"name": {"root"}, "level": {"debug"}})
+			So(rw.Code, ShouldEqual, http.StatusOK)
+			var levels map[string]LoggerLevel
+			So(json.NewDecoder(rw.Body).Decode(&levels), ShouldBeNil)
+			So(levels["root"].Level, ShouldEqual, log.DebugLevel)
+			So(*levels["root"].RevertsTo, ShouldEqual, log.InfoLevel)
+			So(*levels["root"].RevertsAt, ShouldHappenAfter, time.Now().Add(time.Minute*9))
+			So(logger.Level(), ShouldEqual, log.DebugLevel)
+
+			So(serve(http.MethodPut, "/debug/loglevels", "t0ken", url.Values{"name": {"other"}, "level": {"debug"}}).Code, ShouldEqual, http.StatusNotFound)
+			So(serve(http.MethodPut, "/debug/loglevels", "t0ken", url.Values{"name": {"root"}, "level": {"loud"}}).Code, ShouldEqual, http.StatusBadRequest)
+			So(serve(http.MethodPut, "/debug/loglevels", "t0ken", url.Values{"name": {"root"}, "level": {"warn"}, "ttl": {"0s"}}).Code, ShouldEqual, http.StatusBadRequest)
+			So(serve(http.MethodPatch, "/debug/loglevels", "t0ken", nil).Code, ShouldEqual, http.StatusMethodNotAllowed)
+
+			rw = serve(http.MethodDelete, "/debug/loglevels", "t0ken", url.Values{"name": {"root"}})
+			So(rw.Body.String(), ShouldEqual, `{"root":{"level":"info"}}`+"\n")
+			So(logger.Level(), ShouldEqual, log.InfoLevel)
+			serve(http.MethodPut, "/debug/loglevels", "t0ken", url.Values{"name": {"root"}, "level": {"error"}, "ttl": {"1ms"}})
+			for logger.Level() != log.InfoLevel {
+				time.Sleep(time.Millisecond)
+			}
+		})
+		Reset(func() {
+			So(ser.Close(), ShouldBeNil)
+		})
+	})
+	Convey("a debug server without an admin token shouldn't serve overrides", t, func() {
+		ser := New(&Config{Distconf: distconf.New(nil), LogLevels: map[string]*log.Leveled{"root": log.NewLeveled(log.Discard, log.InfoLevel)}})
+		rw := httptest.NewRecorder()
+		ser.Handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/debug/loglevels", nil))
+		So(rw.Code, ShouldEqual, http.StatusNotFound)
+	})
+}
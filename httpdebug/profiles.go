@@ -0,0 +1,316 @@
+package httpdebug
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime/pprof"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/process"
+	"github.com/signalfx/golib/v3/errors"
+	"github.com/signalfx/golib/v3/log"
+	"github.com/signalfx/golib/v3/pointer"
+)
+
+// profileTimeFormat starts the name of each captured profile, so names sort in the order they were captured
+const profileTimeFormat = "20060102T150405.000Z"
+
+// ProfileTrigger is checked regularly by a ProfileCapturer, which captures profiles when it returns true,
+// with the reason it gives
+type ProfileTrigger func() (reason string, fire bool)
+
+// ProfileCaptureConfig configures a ProfileCapturer
+type ProfileCaptureConfig struct {
+	// Profiles are the profiles captured: cpu or any runtime/pprof profile, like heap or goroutine
+	Profiles []string
+	// Interval is how often profiles are captured on a schedule.  Zero only captures them when triggered.
+	Interval *time.Duration
+	// CPUDuration is how long the CPU is profiled for
+	CPUDuration *time.Duration
+	// Triggers are checked every CheckInterval
+	Triggers      []ProfileTrigger
+	CheckInterval *time.Duration
+	// Cooldown is the least time between captures by triggers, so a trigger that stays true doesn't capture
+	// profiles over and over
+	Cooldown *time.Duration
+	// MaxAge is how long profiles are kept
+	MaxAge *time.Duration
+	// MaxCount is the most profiles kept.  The oldest are deleted first.
+	MaxCount *int
+	Logger   log.Logger
+}
+
+// DefaultProfileCaptureConfig is used for any unset profile capture config parameter
+var DefaultProfileCaptureConfig = &ProfileCaptureConfig{
+	Profiles:      []string{"heap", "cpu", "goroutine"},
+	Interval:      pointer.Duration(0),
+	CPUDuration:   pointer.Duration(time.Second * 10),
+	CheckInterval: pointer.Duration(time.Second * 10),
+	Cooldown:      pointer.Duration(time.Minute * 5),
+	MaxAge:        pointer.Duration(time.Hour * 24 * 7),
+	MaxCount:      pointer.Int(100),
+	Logger:        log.DefaultLogger.CreateChild(),
+}
+
+// ProfileCapturer captures profiles on a schedule, when triggered or when asked to, and writes them to a
+// ProfileStore, deleting the ones past its retention.  Profiles are named
+// <time>_<profile>_<reason>.pb.gz; other names in the store are left alone.
+type ProfileCapturer struct {
+	conf  ProfileCaptureConfig
+	store ProfileStore
+	now   func() time.Time
+
+	captureMu     sync.Mutex
+	lastTriggered time.Time
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	mu     sync.Mutex
+	done   chan struct{}
+}
+
+// NewProfileCapturer creates a ProfileCapturer writing profiles to store.  Start it to capture profiles on
+// a schedule and when triggered.
+func NewProfileCapturer(store ProfileStore, conf *ProfileCaptureConfig) *ProfileCapturer {
+	cfg := pointer.FillDefaultFrom(conf, DefaultProfileCaptureConfig).(*ProfileCaptureConfig)
+	ctx, cancel := context.WithCancel(context.Background())
+	return &ProfileCapturer{
+		conf:   *cfg,
+		store:  store,
+		now:    time.Now,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// RSSAbove returns a trigger that fires, with the reason rss, while the process's resident memory is over
+// threshold bytes
+func RSSAbove(threshold uint64) ProfileTrigger {
+	var once sync.Once
+	var proc *process.Process
+	var err error
+	return func() (string, bool) {
+		once.Do(func() {
+			proc, err = process.NewProcess(int32(os.Getpid()))
+		})
+		if err != nil {
+			return "", false
+		}
+		mem, memErr := proc.MemoryInfo()
+		if memErr != nil || mem.RSS <= threshold {
+			return "", false
+		}
+		return "rss", true
+	}
+}
+
+// Start captures profiles every Interval and when a trigger fires, until Close
+func (p *ProfileCapturer) Start() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.done != nil {
+		return
+	}
+	p.done = make(chan struct{})
+	go p.loop(p.done)
+}
+
+// Close stops capturing profiles, cancelling any capture in progress
+func (p *ProfileCapturer) Close() {
+	p.cancel()
+	p.mu.Lock()
+	done := p.done
+	p.mu.Unlock()
+	if done != nil {
+		<-done
+	}
+}
+
+func (p *ProfileCapturer) loop(done chan struct{}) {
+	defer close(done)
+	var schedule, check <-chan time.Time
+	if *p.conf.Interval > 0 {
+		ticker := time.NewTicker(*p.conf.Interval)
+		defer ticker.Stop()
+		schedule = ticker.C
+	}
+	if len(p.conf.Triggers) > 0 && *p.conf.CheckInterval > 0 {
+		ticker := time.NewTicker(*p.conf.CheckInterval)
+		defer ticker.Stop()
+		check = ticker.C
+	}
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-schedule:
+			p.captureAndLog("schedule")
+		case <-check:
+			p.checkTriggers()
+		}
+	}
+}
+
+// checkTriggers captures profiles if a trigger fires and the last triggered capture was long enough ago
+func (p *ProfileCapturer) checkTriggers() {
+	for _, trigger := range p.conf.Triggers {
+		reason, fire := trigger()
+		if !fire {
+			continue
+		}
+		now := p.now()
+		if !p.lastTriggered.IsZero() && now.Sub(p.lastTriggered) < *p.conf.Cooldown {
+			return
+		}
+		p.lastTriggered = now
+		p.captureAndLog(reason)
+		return
+	}
+}
+
+func (p *ProfileCapturer) captureAndLog(reason string) {
+	if _, err := p.Capture(p.ctx, reason); err != nil {
+		p.conf.Logger.Log(log.Err, err, "reason", reason, "unable to capture profiles")
+	}
+}
+
+// Capture captures each profile now, writes them to the store and deletes the profiles past retention,
+// returning the names of the profiles written.  Captures run one at a time.
+func (p *ProfileCapturer) Capture(ctx context.Context, reason string) ([]string, error) {
+	p.captureMu.Lock()
+	defer p.captureMu.Unlock()
+	reason = sanitizeProfileReason(reason)
+	names := make([]string, 0, len(p.conf.Profiles))
+	var errs []error
+	for _, profile := range p.conf.Profiles {
+		data, err := p.profile(ctx, profile)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		name := fmt.Sprintf("%s_%s_%s.pb.gz", p.now().UTC().Format(profileTimeFormat), profile, reason)
+		if err := p.store.Put(ctx, name, data); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		names = append(names, name)
+	}
+	errs = append(errs, p.prune(ctx))
+	return names, errors.NewMultiErr(errs)
+}
+
+// profile returns the named profile, profiling the CPU for CPUDuration if it's cpu
+func (p *ProfileCapturer) profile(ctx context.Context, name string) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if name == "cpu" {
+		if err := pprof.StartCPUProfile(buf); err != nil {
+			return nil, errors.Annotate(err, "cannot start CPU profile")
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(*p.conf.CPUDuration):
+		}
+		pprof.StopCPUProfile()
+		return buf.Bytes(), nil
+	}
+	profile := pprof.Lookup(name)
+	if profile == nil {
+		return nil, fmt.Errorf("unknown profile %s", name)
+	}
+	if err := profile.WriteTo(buf, 0); err != nil {
+		return nil, errors.Annotatef(err, "cannot write %s profile", name)
+	}
+	return buf.Bytes(), nil
+}
+
+// prune deletes the profiles older than MaxAge, then the oldest ones past MaxCount
+func (p *ProfileCapturer) prune(ctx context.Context) error {
+	stored, err := p.List(ctx)
+	if err != nil {
+		return err
+	}
+	cutoff := p.now().Add(-*p.conf.MaxAge)
+	var errs []error
+	for i, profile := range stored {
+		if profile.Time.Before(cutoff) || len(stored)-i > *p.conf.MaxCount {
+			errs = append(errs, p.store.Delete(ctx, profile.Name))
+		}
+	}
+	return errors.NewMultiErr(errs)
+}
+
+// StoredProfile is a profile in a ProfileCapturer's store
+type StoredProfile struct {
+	Name    string    `json:"name"`
+	Time    time.Time `json:"time"`
+	Profile string    `json:"profile"`
+	Reason  string    `json:"reason"`
+}
+
+// List returns the profiles in the store captured by a ProfileCapturer, oldest first
+func (p *ProfileCapturer) List(ctx context.Context) ([]StoredProfile, error) {
+	names, err := p.store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]StoredProfile, 0, len(names))
+	for _, name := range names {
+		parts := strings.SplitN(strings.TrimSuffix(name, ".pb.gz"), "_", 3)
+		if len(parts) != 3 || !strings.HasSuffix(name, ".pb.gz") {
+			continue
+		}
+		t, err := time.Parse(profileTimeFormat, parts[0])
+		if err != nil {
+			continue
+		}
+		ret = append(ret, StoredProfile{Name: name, Time: t, Profile: parts[1], Reason: parts[2]})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Name < ret[j].Name
+	})
+	return ret, nil
+}
+
+// sanitizeProfileReason makes reason safe to put in a profile's name
+func sanitizeProfileReason(reason string) string {
+	reason = strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '-' {
+			return r
+		}
+		return '-'
+	}, reason)
+	if reason == "" {
+		return "manual"
+	}
+	return reason
+}
+
+// ServeHTTP lists the captured profiles as JSON on GET, and captures profiles on POST, with the reason in
+// the reason query parameter
+func (p *ProfileCapturer) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	var resp interface{}
+	var err error
+	switch req.Method {
+	case http.MethodGet:
+		resp, err = p.List(req.Context())
+	case http.MethodPost:
+		resp, err = p.Capture(req.Context(), req.URL.Query().Get("reason"))
+	default:
+		rw.Header().Set("Allow", "GET, POST")
+		http.Error(rw, "only GET and POST are allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(rw).Encode(resp)
+}
@@ -0,0 +1,173 @@
+package httpdebug
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/signalfx/golib/v3/pointer"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type failingStore struct {
+	DirStore
+}
+
+func (f *failingStore) List(ctx context.Context) ([]string, error) {
+	return nil, errors.New("cannot list")
+}
+
+func TestProfileCapturer(t *testing.T) {
+	Convey("a profile capturer", t, func() {
+		store := &DirStore{Dir: t.TempDir()}
+		ctx := context.Background()
+		now := time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+		p := NewProfileCapturer(store, &ProfileCaptureConfig{
+			Profiles:    []string{"heap", "cpu", "goroutine"},
+			CPUDuration: pointer.Duration(time.Millisecond * 10),
+			MaxCount:    pointer.Int(4),
+			MaxAge:      pointer.Duration(time.Hour),
+		})
+		p.now = func() time.Time {
+			return now
+		}
+		Convey("should capture profiles to the store", func() {
+			names, err := p.Capture(ctx, "high memory!")
+			So(err, ShouldBeNil)
+			So(names, ShouldResemble, []string{
+				"20221001T120000.000Z_heap_high-memory-.pb.gz",
+				"20221001T120000.000Z_cpu_high-memory-.pb.gz",
+				"20221001T120000.000Z_goroutine_high-memory-.pb.gz",
+			})
+			So(store.Put(ctx, "other", nil), ShouldBeNil)
+			So(store.Put(ctx, "20221001T120000.000Z_x.pb.gz", nil), ShouldBeNil)
+			So(store.Put(ctx, "bad-time_heap_x.pb.gz", nil), ShouldBeNil)
+			stored, err := p.List(ctx)
+			So(err, ShouldBeNil)
+			So(len(stored), ShouldEqual, 3)
+			So(stored[0].Profile, ShouldEqual, "cpu")
+			So(stored[0].Reason, ShouldEqual, "high-memory-")
+			So(stored[0].Time.Equal(now), ShouldBeTrue)
+		})
+		Convey("should delete profiles past retention", func() {
+			_, err := p.Capture(ctx, "")
+			So(err, ShouldBeNil)
+			now = now.Add(time.Minute)
+			names, err := p.Capture(ctx, "")
+			So(err, ShouldBeNil)
+			stored, err := p.List(ctx)
+			So(err, ShouldBeNil)
+			So(len(stored), ShouldEqual, 4)
+			So(stored[0].Reason, ShouldEqual, "manual")
+			So(stored[3].Name, ShouldEqual, names[0])
+			now = now.Add(time.Hour * 2)
+			p.conf.Profiles = []string{"heap"}
+			_, err = p.Capture(ctx, "")
+			So(err, ShouldBeNil)
+			stored, err = p.List(ctx)
+			So(err, ShouldBeNil)
+			So(len(stored), ShouldEqual, 1)
+		})
+		Convey("should report profiles it can't capture", func() {
+			p.conf.Profiles = []string{"nope"}
+			_, err := p.Capture(ctx, "")
+			So(err.Error(), ShouldContainSubstring, "unknown profile nope")
+			p.store = &failingStore{DirStore: DirStore{Dir: "/dev/null"}}
+			p.conf.Profiles = []string{"heap"}
+			_, err = p.Capture(ctx, "")
+			So(err, ShouldNotBeNil)
+		})
+		Convey("should capture when triggered, at most once a cooldown", func() {
+			fired := 0
+			p.conf.Triggers = []ProfileTrigger{
+				func() (string, bool) { return "", false },
+				func() (string, bool) {
+					fired++
+					return "test", true
+				},
+			}
+			p.conf.Profiles = []string{"goroutine"}
+			p.checkTriggers()
+			p.checkTriggers()
+			So(fired, ShouldEqual, 2)
+			stored, err := p.List(ctx)
+			So(err, ShouldBeNil)
+			So(len(stored), ShouldEqual, 1)
+			So(stored[0].Reason, ShouldEqual, "test")
+			now = now.Add(*DefaultProfileCaptureConfig.Cooldown)
+			p.checkTriggers()
+			stored, err = p.List(ctx)
+			So(err, ShouldBeNil)
+			So(len(stored), ShouldEqual, 2)
+			_, fire := RSSAbove(1 << 62)()
+			So(fire, ShouldBeFalse)
+			reason, fire := RSSAbove(0)()
+			So(fire, ShouldBeTrue)
+			So(reason, ShouldEqual, "rss")
+		})
+		Convey("should capture on a schedule", func() {
+			p.conf.Interval = pointer.Duration(time.Millisecond)
+			p.conf.Profiles = []string{"heap"}
+			p.conf.Triggers = []ProfileTrigger{func() (string, bool) { return "", false }}
+			p.conf.CheckInterval = pointer.Duration(time.Millisecond)
+			p.Start()
+			p.Start()
+			for {
+				stored, err := p.List(ctx)
+				So(err, ShouldBeNil)
+				if len(stored) > 0 {
+					So(stored[0].Reason, ShouldEqual, "schedule")
+					break
+				}
+				time.Sleep(time.Millisecond)
+			}
+			p.Close()
+			p.captureAndLog("closed")
+		})
+		Convey("should serve captures", func() {
+			p.conf.Profiles = []string{"heap"}
+			serve := func(method string) *httptest.ResponseRecorder {
+				rw := httptest.NewRecorder()
+				p.ServeHTTP(rw, httptest.NewRequest(method, "/debug/pprof/capture?reason=oom", nil))
+				return rw
+			}
+			rw := serve(http.MethodPost)
+			So(rw.Code, ShouldEqual, http.StatusOK)
+			var names []string
+			So(json.NewDecoder(rw.Body).Decode(&names), ShouldBeNil)
+			So(len(names), ShouldEqual, 1)
+			rw = serve(http.MethodGet)
+			var stored []StoredProfile
+			So(json.NewDecoder(rw.Body).Decode(&stored), ShouldBeNil)
+			So(stored[0].Reason, ShouldEqual, "oom")
+			So(serve(http.MethodDelete).Code, ShouldEqual, http.StatusMethodNotAllowed)
+			p.store = &failingStore{}
+			So(serve(http.MethodGet).Code, ShouldEqual, http.StatusInternalServerError)
+		})
+		Reset(func() {
+			p.Close()
+		})
+	})
+}
+
+func TestServerProfiles(t *testing.T) {
+	Convey("a debug server with a profile store should capture profiles", t, func() {
+		store := &DirStore{Dir: t.TempDir()}
+		ser := New(&Config{ProfileStore: store, ProfileCapture: &ProfileCaptureConfig{Profiles: []string{"goroutine"}}})
+		rw := httptest.NewRecorder()
+		ser.Handler.ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "/debug/pprof/capture", nil))
+		So(rw.Code, ShouldEqual, http.StatusOK)
+		So(rw.Body.String(), ShouldContainSubstring, "_goroutine_manual.pb.gz")
+		names, err := store.List(context.Background())
+		So(err, ShouldBeNil)
+		So(len(names), ShouldEqual, 1)
+		So(strings.HasSuffix(names[0], ".pb.gz"), ShouldBeTrue)
+		So(ser.Close(), ShouldBeNil)
+		So(New(nil).Close(), ShouldBeNil)
+	})
+}
@@ -0,0 +1,283 @@
+package httpdebug
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/signalfx/golib/v3/errors"
+	"github.com/signalfx/golib/v3/pointer"
+)
+
+// ProfileStore stores captured profiles by name
+type ProfileStore interface {
+	Put(ctx context.Context, name string, data []byte) error
+	// List returns the names of the stored profiles
+	List(ctx context.Context) ([]string, error)
+	Delete(ctx context.Context, name string) error
+}
+
+// DirStore stores profiles as files in a local directory
+type DirStore struct {
+	Dir string
+}
+
+var _ ProfileStore = &DirStore{}
+
+// Put writes the profile to a file named name, creating the directory if needed
+func (d *DirStore) Put(ctx context.Context, name string, data []byte) error {
+	if err := os.MkdirAll(d.Dir, 0750); err != nil {
+		return errors.Annotatef(err, "cannot create profile directory %s", d.Dir)
+	}
+	filename := filepath.Join(d.Dir, name)
+	// written to a temporary file first, so a half written profile is never listed
+	tmp := filename + ".tmp"
+	if err := os.WriteFile(tmp, data, 0640); err != nil {
+		return errors.Annotatef(err, "cannot write profile %s", tmp)
+	}
+	return errors.Annotatef(os.Rename(tmp, filename), "cannot rename profile %s", tmp)
+}
+
+// List returns the names of the files in the directory
+func (d *DirStore) List(ctx context.Context) ([]string, error) {
+	entries, err := os.ReadDir(d.Dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Annotatef(err, "cannot list profile directory %s", d.Dir)
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() && !strings.HasSuffix(entry.Name(), ".tmp") {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+// Delete removes the file named name
+func (d *DirStore) Delete(ctx context.Context, name string) error {
+	return errors.Annotatef(os.Remove(filepath.Join(d.Dir, name)), "cannot delete profile %s", name)
+}
+
+// S3StoreConfig configures an S3StoreConfig.  Endpoint, Bucket and the access keys must be set.
+type S3StoreConfig struct {
+	// Endpoint is the S3 compatible endpoint, like https://s3.us-west-2.amazonaws.com or http://minio:9000.
+	// Buckets are addressed path style, as every S3 compatible store supports.
+	Endpoint *string
+	Bucket   *string
+	// Prefix is put before the name of each profile, like profiles/my-service/
+	Prefix          *string
+	Region          *string
+	AccessKeyID     *string
+	SecretAccessKey *string
+	// SessionToken is set when the keys are temporary credentials
+	SessionToken *string
+	Client       *http.Client
+}
+
+// DefaultS3StoreConfig is used for any unset S3 store config parameter
+var DefaultS3StoreConfig = &S3StoreConfig{
+	Endpoint:        pointer.String(""),
+	Bucket:          pointer.String(""),
+	Prefix:          pointer.String(""),
+	Region:          pointer.String("us-east-1"),
+	AccessKeyID:     pointer.String(""),
+	SecretAccessKey: pointer.String(""),
+	SessionToken:    pointer.String(""),
+	Client:          http.DefaultClient,
+}
+
+// S3Store stores profiles as objects in an S3 compatible object store
+type S3Store struct {
+	conf S3StoreConfig
+	now  func() time.Time
+}
+
+var _ ProfileStore = &S3Store{}
+
+// NewS3Store creates a store of profiles in an S3 bucket, signing requests with AWS signature version 4
+func NewS3Store(conf *S3StoreConfig) (*S3Store, error) {
+	cfg := pointer.FillDefaultFrom(conf, DefaultS3StoreConfig).(*S3StoreConfig)
+	if *cfg.Endpoint == "" || *cfg.Bucket == "" || *cfg.AccessKeyID == "" || *cfg.SecretAccessKey == "" {
+		return nil, errors.New("S3 store needs an endpoint, a bucket and access keys")
+	}
+	return &S3Store{conf: *cfg, now: time.Now}, nil
+}
+
+// Put uploads the profile as the object Prefix+name
+func (s *S3Store) Put(ctx context.Context, name string, data []byte) error {
+	_, err := s.do(ctx, http.MethodPut, *s.conf.Prefix+name, nil, data)
+	return errors.Annotatef(err, "cannot upload profile %s", name)
+}
+
+// s3ListResult is the part of a ListObjectsV2 response the store reads
+type s3ListResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// List returns the names of the objects under Prefix
+func (s *S3Store) List(ctx context.Context) ([]string, error) {
+	var names []string
+	query := url.Values{"list-type": {"2"}, "prefix": {*s.conf.Prefix}}
+	for {
+		body, err := s.do(ctx, http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, errors.Annotate(err, "cannot list profiles")
+		}
+		var result s3ListResult
+		if err := xml.Unmarshal(body, &result); err != nil {
+			return nil, errors.Annotate(err, "invalid S3 list response")
+		}
+		for _, content := range result.Contents {
+			names = append(names, strings.TrimPrefix(content.Key, *s.conf.Prefix))
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return names, nil
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+}
+
+// Delete deletes the object Prefix+name
+func (s *S3Store) Delete(ctx context.Context, name string) error {
+	_, err := s.do(ctx, http.MethodDelete, *s.conf.Prefix+name, nil, nil)
+	return errors.Annotatef(err, "cannot delete profile %s", name)
+}
+
+// do sends a signed request for key in the bucket, returning the response body
+func (s *S3Store) do(ctx context.Context, method string, key string, query url.Values, body []byte) ([]byte, error) {
+	u, err := url.Parse(strings.TrimRight(*s.conf.Endpoint, "/"))
+	if err != nil {
+		return nil, errors.Annotate(err, "invalid S3 endpoint")
+	}
+	u.Path += "/" + *s.conf.Bucket
+	if key != "" {
+		u.Path += "/" + key
+	}
+	u.RawQuery = query.Encode()
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Annotate(err, "cannot create S3 request")
+	}
+	if *s.conf.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", *s.conf.SessionToken)
+	}
+	signV4(req, body, *s.conf.Region, "s3", *s.conf.AccessKeyID, *s.conf.SecretAccessKey, s.now())
+	resp, err := s.conf.Client.Do(req)
+	if err != nil {
+		return nil, errors.Annotate(err, "cannot reach S3")
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Annotate(err, "cannot read S3 response")
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("S3 returned status %d: %s", resp.StatusCode, respBody)
+	}
+	return respBody, nil
+}
+
+// signV4 signs req, and every header it has, with AWS signature version 4
+func signV4(req *http.Request, body []byte, region string, service string, accessKeyID string, secretAccessKey string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256.Sum256(body)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		sigV4EscapePath(req.URL.Path),
+		sigV4Query(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretAccessKey), date)
+	for _, part := range []string{region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", accessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	_, _ = h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// sigV4Escape escapes s the way signature version 4 does: everything but unreserved characters, and slashes
+// too if escapeSlash is true
+func sigV4Escape(s string, escapeSlash bool) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !escapeSlash) {
+			sb.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&sb, "%%%02X", c)
+	}
+	return sb.String()
+}
+
+func sigV4EscapePath(path string) string {
+	if path == "" {
+		return "/"
+	}
+	return sigV4Escape(path, false)
+}
+
+// sigV4Query returns the query sorted by name, then value, with both escaped
+func sigV4Query(query url.Values) string {
+	pairs := make([]string, 0, len(query))
+	for name, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, sigV4Escape(name, true)+"="+sigV4Escape(value, true))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
@@ -5,6 +5,7 @@ import (
 	"net/http/pprof"
 	"time"
 
+	"github.com/signalfx/golib/v3/distconf"
 	"github.com/signalfx/golib/v3/explorable"
 	"github.com/signalfx/golib/v3/expvar2"
 	"github.com/signalfx/golib/v3/log"
@@ -16,6 +17,8 @@ type Server struct {
 	http.Server
 	Exp2 *expvar2.Handler
 	Mux  *http.ServeMux
+	// Profiles captures profiles to the configured ProfileStore, if there is one
+	Profiles *ProfileCapturer
 }
 
 // Config controls optional parameters for the debug server
@@ -24,6 +27,19 @@ type Config struct {
 	ReadTimeout   *time.Duration
 	WriteTimeout  *time.Duration
 	ExplorableObj interface{}
+	// Distconf, if set, has its state served at /debug/distconf
+	Distconf *distconf.Distconf
+	// ProfileStore, if set, is where profiles are captured to, as ProfileCapture says.  Captured profiles
+	// are listed, and captured on demand with a POST, at /debug/pprof/capture.
+	ProfileStore   ProfileStore
+	ProfileCapture *ProfileCaptureConfig
+	// AdminToken, if set, is the bearer token needed to view and temporarily change Distconf's values, at
+	// /debug/distconf/overrides, and the levels of LogLevels' loggers, at /debug/loglevels.  Without it those
+	// endpoints aren't served.
+	AdminToken *string
+	LogLevels  map[string]*log.Leveled
+	// OverrideTTL is how long values and levels are changed for, when a request doesn't say
+	OverrideTTL *time.Duration
 }
 
 // DefaultConfig is used by default for unset config parameters
@@ -31,6 +47,8 @@ var DefaultConfig = &Config{
 	Logger:       log.DefaultLogger.CreateChild(),
 	ReadTimeout:  pointer.Duration(time.Duration(0)),
 	WriteTimeout: pointer.Duration(time.Duration(0)),
+	AdminToken:   pointer.String(""),
+	OverrideTTL:  pointer.Duration(time.Minute * 10),
 }
 
 // LogKeyHTTPClass is appended as a key to subloggers of the debug server
@@ -63,6 +81,31 @@ func New(conf *Config) *Server {
 		}
 		m.Handle("/debug/explorer/", e)
 	}
+	if conf.Distconf != nil {
+		m.Handle("/debug/distconf", conf.Distconf.Handler())
+	}
+	if conf.ProfileStore != nil {
+		capture := pointer.FillDefaultFrom(conf.ProfileCapture, &ProfileCaptureConfig{Logger: log.NewContext(conf.Logger).With(LogKeyHTTPClass, "profiles")}).(*ProfileCaptureConfig)
+		s.Profiles = NewProfileCapturer(conf.ProfileStore, capture)
+		s.Profiles.Start()
+		m.Handle("/debug/pprof/capture", s.Profiles)
+	}
+	if *conf.AdminToken != "" {
+		if conf.Distconf != nil {
+			m.Handle("/debug/distconf/overrides", requireToken(*conf.AdminToken, conf.Distconf.OverrideHandler(*conf.OverrideTTL)))
+		}
+		if len(conf.LogLevels) > 0 {
+			m.Handle("/debug/loglevels", requireToken(*conf.AdminToken, &LogLevels{Loggers: conf.LogLevels, DefaultTTL: *conf.OverrideTTL}))
+		}
+	}
 	m.Handle("/debug/vars", s.Exp2)
 	return s
 }
+
+// Close stops capturing profiles and closes the server
+func (s *Server) Close() error {
+	if s.Profiles != nil {
+		s.Profiles.Close()
+	}
+	return s.Server.Close()
+}
@@ -9,6 +9,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/signalfx/golib/v3/distconf"
 	"github.com/signalfx/golib/v3/nettest"
 	"github.com/signalfx/golib/v3/pointer"
 	. "github.com/smartystreets/goconvey/convey"
@@ -27,10 +28,13 @@ func TestDebugServer(t *testing.T) {
 		}
 		listener, err := net.Listen("tcp", "127.0.0.1:0")
 		So(err, ShouldBeNil)
+		conf := distconf.New([]distconf.Reader{distconf.Mem()})
+		conf.Str("db.password", "hunter2")
 		ser := New(&Config{
 			ReadTimeout:   pointer.Duration(time.Millisecond * 100),
 			WriteTimeout:  pointer.Duration(time.Millisecond * 100),
 			ExplorableObj: explorable,
+			Distconf:      conf,
 		})
 		listenPort := nettest.TCPPort(listener)
 		done := make(chan error)
@@ -58,6 +62,18 @@ func TestDebugServer(t *testing.T) {
 			So(string(s), ShouldContainSubstring, "bob123")
 			resp.Body.Close()
 		})
+		Convey("and find distconf", func() {
+			req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, serverURL+"/debug/distconf", nil)
+			So(err, ShouldBeNil)
+			resp, err := http.DefaultClient.Do(req)
+			So(err, ShouldBeNil)
+			So(resp.StatusCode, ShouldEqual, http.StatusOK)
+			s, err := ioutil.ReadAll(resp.Body)
+			So(err, ShouldBeNil)
+			So(string(s), ShouldContainSubstring, "db.password")
+			So(string(s), ShouldNotContainSubstring, "hunter2")
+			resp.Body.Close()
+		})
 
 		Reset(func() {
 			So(listener.Close(), ShouldBeNil)
@@ -1,11 +1,15 @@
 package log
 
+import "sync/atomic"
+
 // ChannelLogger creates a logger that sends log messages to a channel.  It's useful for testing and buffering
 // logs.
 type ChannelLogger struct {
 	Out    chan []interface{}
 	Err    chan error
 	OnFull Logger
+
+	dropped int64
 }
 
 // NewChannelLogger creates a ChannelLogger for channels with size buffer
@@ -25,10 +29,16 @@ func (c *ChannelLogger) logNonBlocking(kvs ...interface{}) {
 	select {
 	case c.Out <- append(make([]interface{}, 0, len(kvs)), kvs...):
 	default:
+		atomic.AddInt64(&c.dropped, 1)
 		c.OnFull.Log(kvs...)
 	}
 }
 
+// Dropped returns how many messages were given to OnFull because the buffer was full
+func (c *ChannelLogger) Dropped() int64 {
+	return atomic.LoadInt64(&c.dropped)
+}
+
 // ErrorLogger adds the err to ChannelLogger's buffer and returns itself
 func (c *ChannelLogger) ErrorLogger(err error) Logger {
 	c.Err <- err
@@ -39,6 +39,7 @@ func TestChannelLogger(t *testing.T) {
 				c.Log("hi")
 				c.Log("hi")
 				So(count.Count, ShouldEqual, 1)
+				So(c.Dropped(), ShouldEqual, 1)
 			})
 		})
 	})
@@ -0,0 +1,97 @@
+package log
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// ContextExtractor returns the keyvals to log about a context, like the ID of the trace or request it's
+// part of.  It returns nothing if the context doesn't have what it's looking for.
+type ContextExtractor func(ctx context.Context) []interface{}
+
+type loggerCtxKey struct{}
+
+type extractorsCtxKey struct{}
+
+type requestIDCtxKey struct{}
+
+var (
+	extractorsMu sync.Mutex
+	// extractors holds the []ContextExtractor registered with RegisterContextExtractor
+	extractors atomic.Value
+)
+
+//nolint:gochecknoinits
+func init() {
+	extractors.Store([]ContextExtractor{RequestIDExtractor})
+}
+
+// RegisterContextExtractor adds extractors to the ones With and FromContext use for every context.
+// RequestIDExtractor is registered by default.
+func RegisterContextExtractor(extractor ...ContextExtractor) {
+	extractorsMu.Lock()
+	defer extractorsMu.Unlock()
+	existing := extractors.Load().([]ContextExtractor)
+	extractors.Store(append(existing[:len(existing):len(existing)], extractor...))
+}
+
+// ContextWithExtractors returns a copy of ctx that With and FromContext also use extractors for
+func ContextWithExtractors(ctx context.Context, extractor ...ContextExtractor) context.Context {
+	if len(extractor) == 0 {
+		return ctx
+	}
+	existing, _ := ctx.Value(extractorsCtxKey{}).([]ContextExtractor)
+	return context.WithValue(ctx, extractorsCtxKey{}, addExtractors(existing, extractor))
+}
+
+func addExtractors(a, b []ContextExtractor) []ContextExtractor {
+	ret := make([]ContextExtractor, 0, len(a)+len(b))
+	ret = append(ret, a...)
+	return append(ret, b...)
+}
+
+// ContextWithLogger returns a copy of ctx that FromContext returns logger for
+func ContextWithLogger(ctx context.Context, logger Logger) context.Context {
+	return context.WithValue(ctx, loggerCtxKey{}, logger)
+}
+
+// With returns logger with the keyvals of the registered extractors, and of the extractors stored on ctx
+// with ContextWithExtractors, appended
+func With(ctx context.Context, logger Logger) *Context {
+	var keyvals []interface{}
+	ctxExtractors, _ := ctx.Value(extractorsCtxKey{}).([]ContextExtractor)
+	for _, extractor := range addExtractors(extractors.Load().([]ContextExtractor), ctxExtractors) {
+		keyvals = append(keyvals, extractor(ctx)...)
+	}
+	return NewContext(logger).With(keyvals...)
+}
+
+// FromContext returns With for the logger stored on ctx with ContextWithLogger, or DefaultLogger if there
+// isn't one
+func FromContext(ctx context.Context) *Context {
+	logger, ok := ctx.Value(loggerCtxKey{}).(Logger)
+	if !ok {
+		logger = DefaultLogger
+	}
+	return With(ctx, logger)
+}
+
+// ContextWithRequestID returns a copy of ctx that carries the ID of the request it's handling
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDCtxKey{}, id)
+}
+
+// RequestIDFromContext returns the request ID stored on ctx with ContextWithRequestID, or ""
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDCtxKey{}).(string)
+	return id
+}
+
+// RequestIDExtractor logs the request ID stored on a context with ContextWithRequestID under RequestIDKey
+func RequestIDExtractor(ctx context.Context) []interface{} {
+	if id := RequestIDFromContext(ctx); id != "" {
+		return []interface{}{RequestIDKey, id}
+	}
+	return nil
+}
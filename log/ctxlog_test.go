@@ -0,0 +1,52 @@
+package log
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type testCtxKey struct{}
+
+func TestContextLogging(t *testing.T) {
+	Convey("Logging from a context", t, func() {
+		out := NewChannelLogger(10, Panic)
+		ctx := ContextWithRequestID(context.Background(), "req")
+		Convey("should log the request ID", func() {
+			So(RequestIDFromContext(ctx), ShouldEqual, "req")
+			So(RequestIDFromContext(context.Background()), ShouldEqual, "")
+			With(ctx, out).Log(Msg, "hi")
+			So(<-out.Out, ShouldResemble, []interface{}{RequestIDKey, "req", Msg, "hi"})
+			With(context.Background(), out).Log(Msg, "hi")
+			So(<-out.Out, ShouldResemble, []interface{}{Msg, "hi"})
+		})
+		Convey("should use the extractors stored on the context", func() {
+			extractor := func(ctx context.Context) []interface{} {
+				if v := ctx.Value(testCtxKey{}); v != nil {
+					return []interface{}{"test", v}
+				}
+				return nil
+			}
+			So(ContextWithExtractors(ctx), ShouldEqual, ctx)
+			ctx = ContextWithExtractors(ctx, extractor)
+			ctx = ContextWithExtractors(ctx, RequestIDExtractor)
+			ctx = context.WithValue(ctx, testCtxKey{}, "value")
+			With(ctx, out).Log(Msg, "hi")
+			So(<-out.Out, ShouldResemble, []interface{}{RequestIDKey, "req", "test", "value", RequestIDKey, "req", Msg, "hi"})
+		})
+		Convey("should use the logger stored on the context", func() {
+			FromContext(ContextWithLogger(ctx, out)).Log(Msg, "hi")
+			So(<-out.Out, ShouldResemble, []interface{}{RequestIDKey, "req", Msg, "hi"})
+			So(FromContext(ctx).Logger, ShouldEqual, DefaultLogger)
+		})
+		Convey("should use registered extractors", func() {
+			defer extractors.Store(extractors.Load())
+			RegisterContextExtractor(func(ctx context.Context) []interface{} {
+				return []interface{}{"registered", true}
+			})
+			With(ctx, out).Log(Msg, "hi")
+			So(<-out.Out, ShouldResemble, []interface{}{RequestIDKey, "req", "registered", true, Msg, "hi"})
+		})
+	})
+}
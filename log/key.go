@@ -13,4 +13,12 @@ var (
 	Err = Key("err")
 	// Msg is the suggested Log() key for messages
 	Msg = Key("message")
+	// LevelKey is the Log() key of the Level of a message
+	LevelKey = Key("level")
+	// TimeKey is the suggested Log() key for when a message was logged
+	TimeKey = Key("time")
+	// CallerKey is the suggested Log() key for where a message was logged from
+	CallerKey = Key("caller")
+	// RequestIDKey is the Log() key of the request ID stored on a context with ContextWithRequestID
+	RequestIDKey = Key("request_id")
 )
@@ -0,0 +1,231 @@
+package log
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Level is how severe a log message is
+type Level int32
+
+// The levels of a Leveled logger, from least to most severe
+const (
+	DebugLevel Level = iota
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+// String returns the lower case name of the level
+func (l Level) String() string {
+	if l < DebugLevel || l > ErrorLevel {
+		return fmt.Sprintf("Level(%d)", int32(l))
+	}
+	return levelNames[l]
+}
+
+// MarshalText encodes the level as its name, so JSON logs show the name
+func (l Level) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+// UnmarshalText decodes a level name, in any case
+func (l *Level) UnmarshalText(text []byte) error {
+	parsed, err := ParseLevel(string(text))
+	if err != nil {
+		return err
+	}
+	*l = parsed
+	return nil
+}
+
+// ParseLevel returns the level called name, in any case.  warning is also accepted for WarnLevel.
+func ParseLevel(name string) (Level, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "warning" {
+		return WarnLevel, nil
+	}
+	for i, n := range levelNames {
+		if n == name {
+			return Level(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level %q", name)
+}
+
+// Leveled logs messages at or above its level to Logger, with the level under LevelKey.  The level can be
+// changed while logging, with SetLevel or over HTTP with ServeHTTP, or for a while with SetLevelFor.
+type Leveled struct {
+	Logger Logger
+	level  int32
+
+	revertMu sync.Mutex
+	revert   *levelRevert
+}
+
+// levelRevert is a pending change back to the level set before SetLevelFor
+type levelRevert struct {
+	level Level
+	at    time.Time
+	timer *time.Timer
+}
+
+var _ Logger = &Leveled{}
+var _ http.Handler = &Leveled{}
+
+// NewLeveled creates a logger of the messages at or above level to logger
+func NewLeveled(logger Logger, level Level) *Leveled {
+	return &Leveled{
+		Logger: logger,
+		level:  int32(level),
+	}
+}
+
+// NewLeveledJSONLogger creates a logger writing the messages at or above level to w as JSON objects, with
+// the UTC time under TimeKey as RFC3339 and the file and line that logged under CallerKey
+func NewLeveledJSONLogger(w io.Writer, level Level, errHandler ErrorHandler) *Leveled {
+	// the caller is four frames above the Caller's LogValue: copyIfDynamic, Context.Log, Leveled.log or
+	// Leveled.logAt, and the Leveled method called
+	logger := NewContext(NewJSONLogger(w, errHandler)).With(TimeKey, DefaultTimestampUTC, CallerKey, &Caller{Depth: 5})
+	return NewLeveled(logger, level)
+}
+
+// Level returns the least severe level logged
+func (l *Leveled) Level() Level {
+	return Level(atomic.LoadInt32(&l.level))
+}
+
+// SetLevel changes the least severe level logged, cancelling any change back from SetLevelFor
+func (l *Leveled) SetLevel(level Level) {
+	l.revertMu.Lock()
+	defer l.revertMu.Unlock()
+	if l.revert != nil {
+		l.revert.timer.Stop()
+		l.revert = nil
+	}
+	atomic.StoreInt32(&l.level, int32(level))
+}
+
+// SetLevelFor changes the least severe level logged for ttl, then changes it back to the level set before.
+// Calling it again before then extends or shortens the change, still changing back to the level set before
+// the first call.
+func (l *Leveled) SetLevelFor(level Level, ttl time.Duration) {
+	l.revertMu.Lock()
+	defer l.revertMu.Unlock()
+	revertTo := l.Level()
+	if l.revert != nil {
+		l.revert.timer.Stop()
+		revertTo = l.revert.level
+	}
+	r := &levelRevert{level: revertTo, at: time.Now().Add(ttl)}
+	r.timer = time.AfterFunc(ttl, func() {
+		l.revertMu.Lock()
+		defer l.revertMu.Unlock()
+		if l.revert == r {
+			l.revert = nil
+			atomic.StoreInt32(&l.level, int32(r.level))
+		}
+	})
+	l.revert = r
+	atomic.StoreInt32(&l.level, int32(level))
+}
+
+// PendingRevert returns the level SetLevelFor changes back to and when, if a change back is pending
+func (l *Leveled) PendingRevert() (Level, time.Time, bool) {
+	l.revertMu.Lock()
+	defer l.revertMu.Unlock()
+	if l.revert == nil {
+		return 0, time.Time{}, false
+	}
+	return l.revert.level, l.revert.at, true
+}
+
+// Enabled returns true if messages at level are logged
+func (l *Leveled) Enabled(level Level) bool {
+	return level >= l.Level() && !IsDisabled(l.Logger)
+}
+
+// Disabled returns true if the wrapped logger is disabled
+func (l *Leveled) Disabled() bool {
+	return IsDisabled(l.Logger)
+}
+
+// Log logs keyvals, unless they have a Level under LevelKey that isn't enabled
+func (l *Leveled) Log(keyvals ...interface{}) {
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		if keyvals[i] == LevelKey || keyvals[i] == string(LevelKey) {
+			if level, ok := keyvals[i+1].(Level); ok && !l.Enabled(level) {
+				return
+			}
+		}
+	}
+	l.log(keyvals)
+}
+
+// Debug logs keyvals at DebugLevel
+func (l *Leveled) Debug(keyvals ...interface{}) {
+	l.logAt(DebugLevel, keyvals)
+}
+
+// Info logs keyvals at InfoLevel
+func (l *Leveled) Info(keyvals ...interface{}) {
+	l.logAt(InfoLevel, keyvals)
+}
+
+// Warn logs keyvals at WarnLevel
+func (l *Leveled) Warn(keyvals ...interface{}) {
+	l.logAt(WarnLevel, keyvals)
+}
+
+// Error logs keyvals at ErrorLevel
+func (l *Leveled) Error(keyvals ...interface{}) {
+	l.logAt(ErrorLevel, keyvals)
+}
+
+func (l *Leveled) logAt(level Level, keyvals []interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+	l.Logger.Log(addArrays([]interface{}{LevelKey, level}, keyvals)...)
+}
+
+// log is called by Log, so the caller is as deep in the stack as it is for the methods calling logAt
+func (l *Leveled) log(keyvals []interface{}) {
+	l.Logger.Log(keyvals...)
+}
+
+// ServeHTTP replies with the current level, after changing it to the level form value of PUT and POST
+// requests.  With a ttl form value, like 10m, the level is changed for that long with SetLevelFor.
+func (l *Leveled) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost:
+		level, err := ParseLevel(req.FormValue("level"))
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ttlStr := req.FormValue("ttl")
+		if ttlStr == "" {
+			l.SetLevel(level)
+			break
+		}
+		ttl, err := time.ParseDuration(ttlStr)
+		if err != nil || ttl <= 0 {
+			http.Error(rw, fmt.Sprintf("invalid ttl %q", ttlStr), http.StatusBadRequest)
+			return
+		}
+		l.SetLevelFor(level, ttl)
+	default:
+		http.Error(rw, "only GET, PUT and POST are supported", http.StatusMethodNotAllowed)
+		return
+	}
+	_, _ = io.WriteString(rw, l.Level().String()+"\n")
+}
@@ -0,0 +1,142 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLevels(t *testing.T) {
+	Convey("Levels", t, func() {
+		Convey("should parse their names", func() {
+			for _, level := range []Level{DebugLevel, InfoLevel, WarnLevel, ErrorLevel} {
+				parsed, err := ParseLevel(strings.ToUpper(level.String()))
+				So(err, ShouldBeNil)
+				So(parsed, ShouldEqual, level)
+			}
+			parsed, err := ParseLevel("warning")
+			So(err, ShouldBeNil)
+			So(parsed, ShouldEqual, WarnLevel)
+			_, err = ParseLevel("loud")
+			So(err, ShouldNotBeNil)
+			So(Level(9).String(), ShouldEqual, "Level(9)")
+		})
+		Convey("should unmarshal from text", func() {
+			var cfg struct{ Level Level }
+			So(json.Unmarshal([]byte(`{"Level":"error"}`), &cfg), ShouldBeNil)
+			So(cfg.Level, ShouldEqual, ErrorLevel)
+			So(json.Unmarshal([]byte(`{"Level":"loud"}`), &cfg), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestLeveled(t *testing.T) {
+	Convey("A leveled logger", t, func() {
+		counter := &Counter{}
+		l := NewLeveled(counter, InfoLevel)
+		Convey("should drop messages below its level", func() {
+			l.Debug(Msg, "hidden")
+			l.Info(Msg, "shown")
+			l.Warn(Msg, "shown")
+			l.Error(Msg, "shown")
+			So(counter.Count, ShouldEqual, 3)
+			So(l.Enabled(DebugLevel), ShouldBeFalse)
+			So(l.Enabled(ErrorLevel), ShouldBeTrue)
+		})
+		Convey("should change level at runtime", func() {
+			l.SetLevel(ErrorLevel)
+			So(l.Level(), ShouldEqual, ErrorLevel)
+			l.Warn(Msg, "hidden")
+			So(counter.Count, ShouldEqual, 0)
+			l.SetLevel(DebugLevel)
+			l.Debug(Msg, "shown")
+			So(counter.Count, ShouldEqual, 1)
+		})
+		Convey("should change level for a while", func() {
+			l.SetLevelFor(DebugLevel, time.Hour)
+			l.SetLevelFor(WarnLevel, time.Millisecond)
+			So(l.Level(), ShouldEqual, WarnLevel)
+			level, at, pending := l.PendingRevert()
+			So(pending, ShouldBeTrue)
+			So(level, ShouldEqual, InfoLevel)
+			So(at, ShouldHappenBefore, time.Now().Add(time.Minute))
+			for l.Level() != InfoLevel {
+				time.Sleep(time.Millisecond)
+			}
+			_, _, pending = l.PendingRevert()
+			So(pending, ShouldBeFalse)
+			l.SetLevelFor(DebugLevel, time.Millisecond)
+			l.SetLevel(ErrorLevel)
+			time.Sleep(time.Millisecond * 5)
+			So(l.Level(), ShouldEqual, ErrorLevel)
+		})
+		Convey("should filter Log by the level key", func() {
+			l.Log(LevelKey, DebugLevel, Msg, "hidden")
+			l.Log("level", DebugLevel, Msg, "hidden")
+			l.Log(LevelKey, WarnLevel, Msg, "shown")
+			l.Log(Msg, "shown")
+			So(counter.Count, ShouldEqual, 2)
+		})
+		Convey("should be disabled with its logger", func() {
+			So(IsDisabled(l), ShouldBeFalse)
+			So(IsDisabled(NewLeveled(Discard, InfoLevel)), ShouldBeTrue)
+		})
+		Convey("should serve its level over HTTP", func() {
+			serve := func(method string, target string) *httptest.ResponseRecorder {
+				rw := httptest.NewRecorder()
+				l.ServeHTTP(rw, httptest.NewRequest(method, target, nil))
+				return rw
+			}
+			rw := serve(http.MethodGet, "/")
+			So(rw.Code, ShouldEqual, http.StatusOK)
+			So(rw.Body.String(), ShouldEqual, "info\n")
+			rw = serve(http.MethodPut, "/?level=debug")
+			So(rw.Body.String(), ShouldEqual, "debug\n")
+			So(l.Level(), ShouldEqual, DebugLevel)
+			So(serve(http.MethodPost, "/?level=loud").Code, ShouldEqual, http.StatusBadRequest)
+			So(serve(http.MethodDelete, "/").Code, ShouldEqual, http.StatusMethodNotAllowed)
+			So(l.Level(), ShouldEqual, DebugLevel)
+			So(serve(http.MethodPut, "/?level=warn&ttl=1h").Body.String(), ShouldEqual, "warn\n")
+			level, _, pending := l.PendingRevert()
+			So(pending, ShouldBeTrue)
+			So(level, ShouldEqual, DebugLevel)
+			So(serve(http.MethodPut, "/?level=warn&ttl=soon").Code, ShouldEqual, http.StatusBadRequest)
+			l.SetLevel(InfoLevel)
+		})
+	})
+}
+
+func TestLeveledJSONLogger(t *testing.T) {
+	Convey("A leveled JSON logger", t, func() {
+		b := &bytes.Buffer{}
+		l := NewLeveledJSONLogger(b, InfoLevel, Panic)
+		decode := func() map[string]interface{} {
+			var m map[string]interface{}
+			So(json.Unmarshal(b.Bytes(), &m), ShouldBeNil)
+			return m
+		}
+		Convey("should log the level, time and caller", func() {
+			l.Warn(Msg, "hello")
+			m := decode()
+			So(m[string(Msg)], ShouldEqual, "hello")
+			So(m[string(LevelKey)], ShouldEqual, "warn")
+			_, err := time.Parse(time.RFC3339Nano, m[string(TimeKey)].(string))
+			So(err, ShouldBeNil)
+			So(m[string(CallerKey)], ShouldStartWith, "level_test.go:")
+		})
+		Convey("should find the caller of Log too", func() {
+			l.Log(Msg, "hello")
+			So(decode()[string(CallerKey)], ShouldStartWith, "level_test.go:")
+		})
+		Convey("should drop messages below its level", func() {
+			l.Debug(Msg, "hidden")
+			So(b.Len(), ShouldEqual, 0)
+		})
+	})
+}
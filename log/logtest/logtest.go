@@ -0,0 +1,202 @@
+// Package logtest has a Logger that keeps what is logged in memory so tests can assert on it.
+package logtest
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/signalfx/golib/v3/log"
+)
+
+// LevelKey is the key levels are expected to be logged with
+const LevelKey = "level"
+
+// Record is the key/values of one Log call
+type Record struct {
+	KeyVals []interface{}
+}
+
+// Get returns the value logged with key.  Keys are compared by their string form, so log.Msg and "message"
+// are the same key.
+func (r Record) Get(key string) (interface{}, bool) {
+	for i := 0; i+1 < len(r.KeyVals); i += 2 {
+		if fmt.Sprint(r.KeyVals[i]) == key {
+			return r.KeyVals[i+1], true
+		}
+	}
+	return nil, false
+}
+
+// String returns the value logged with key as a string, or "" if it wasn't logged
+func (r Record) String(key string) string {
+	v, exists := r.Get(key)
+	if !exists {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+// Message is the value logged with log.Msg
+func (r Record) Message() string {
+	return r.String(log.Msg.String())
+}
+
+// Level is the value logged with LevelKey
+func (r Record) Level() string {
+	return r.String(LevelKey)
+}
+
+// Err is the error logged with log.Err, if any
+func (r Record) Err() error {
+	v, _ := r.Get(log.Err.String())
+	err, _ := v.(error)
+	return err
+}
+
+// A Matcher is true for the records a query selects
+type Matcher func(Record) bool
+
+// HasKey matches records that logged key
+func HasKey(key string) Matcher {
+	return func(r Record) bool {
+		_, exists := r.Get(key)
+		return exists
+	}
+}
+
+// HasValue matches records that logged key with a value whose string form is value
+func HasValue(key string, value interface{}) Matcher {
+	want := fmt.Sprint(value)
+	return func(r Record) bool {
+		v, exists := r.Get(key)
+		return exists && fmt.Sprint(v) == want
+	}
+}
+
+// HasLevel matches records logged at level
+func HasLevel(level string) Matcher {
+	return HasValue(LevelKey, level)
+}
+
+// MessageContains matches records whose message contains substr
+func MessageContains(substr string) Matcher {
+	return func(r Record) bool {
+		_, exists := r.Get(log.Msg.String())
+		return exists && strings.Contains(r.Message(), substr)
+	}
+}
+
+// HasErr matches records that logged an error
+func HasErr() Matcher {
+	return func(r Record) bool {
+		return r.Err() != nil
+	}
+}
+
+func matchesAll(r Record, matchers []Matcher) bool {
+	for _, m := range matchers {
+		if !m(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// Logger keeps every record logged to it.  It is safe to use concurrently.
+type Logger struct {
+	mu      sync.Mutex
+	records []Record
+	errs    []error
+}
+
+var _ log.ErrorHandlingLogger = &Logger{}
+
+// New creates an empty Logger
+func New() *Logger {
+	return &Logger{}
+}
+
+// Log keeps a copy of keyvals
+func (l *Logger) Log(keyvals ...interface{}) {
+	r := Record{KeyVals: append(make([]interface{}, 0, len(keyvals)), keyvals...)}
+	l.mu.Lock()
+	l.records = append(l.records, r)
+	l.mu.Unlock()
+}
+
+// ErrorLogger keeps err, returned by Errors, and returns the logger
+func (l *Logger) ErrorLogger(err error) log.Logger {
+	l.mu.Lock()
+	l.errs = append(l.errs, err)
+	l.mu.Unlock()
+	return l
+}
+
+// Records returns what has been logged, oldest first
+func (l *Logger) Records() []Record {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]Record(nil), l.records...)
+}
+
+// Errors returns the errors passed to ErrorLogger
+func (l *Logger) Errors() []error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]error(nil), l.errs...)
+}
+
+// Reset forgets everything logged
+func (l *Logger) Reset() {
+	l.mu.Lock()
+	l.records = nil
+	l.errs = nil
+	l.mu.Unlock()
+}
+
+// Filter returns the records matching every matcher
+func (l *Logger) Filter(matchers ...Matcher) []Record {
+	var ret []Record
+	for _, r := range l.Records() {
+		if matchesAll(r, matchers) {
+			ret = append(ret, r)
+		}
+	}
+	return ret
+}
+
+// Count returns how many records match every matcher
+func (l *Logger) Count(matchers ...Matcher) int {
+	return len(l.Filter(matchers...))
+}
+
+// AssertLogged fails t unless a record matches every matcher, returning the first that does
+func (l *Logger) AssertLogged(t testing.TB, matchers ...Matcher) Record {
+	t.Helper()
+	matched := l.Filter(matchers...)
+	if len(matched) == 0 {
+		t.Errorf("no matching record was logged, got %s", l)
+		return Record{}
+	}
+	return matched[0]
+}
+
+// AssertNotLogged fails t if any record matches every matcher
+func (l *Logger) AssertNotLogged(t testing.TB, matchers ...Matcher) {
+	t.Helper()
+	if matched := l.Filter(matchers...); len(matched) > 0 {
+		t.Errorf("%d matching records were logged, first %v", len(matched), matched[0].KeyVals)
+	}
+}
+
+// String lists the records for failure messages
+func (l *Logger) String() string {
+	records := l.Records()
+	lines := make([]string, 0, len(records))
+	for _, r := range records {
+		lines = append(lines, fmt.Sprint(r.KeyVals))
+	}
+	return fmt.Sprintf("%d records [%s]", len(records), strings.Join(lines, ", "))
+}
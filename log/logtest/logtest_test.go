@@ -0,0 +1,84 @@
+package logtest
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/signalfx/golib/v3/log"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type fakeTB struct {
+	testing.TB
+	failures []string
+}
+
+func (f *fakeTB) Helper() {}
+
+func (f *fakeTB) Errorf(format string, args ...interface{}) {
+	f.failures = append(f.failures, fmt.Sprintf(format, args...))
+}
+
+func TestLogger(t *testing.T) {
+	Convey("A test logger", t, func() {
+		l := New()
+		ctx := log.NewContext(l).With("component", "sink")
+		ctx.Log(LevelKey, "info", log.Msg, "starting up")
+		ctx.Log(LevelKey, "error", log.Msg, "cannot send", log.Err, errors.New("timeout"))
+		ctx.Log("odd")
+
+		Convey("should keep every record", func() {
+			So(len(l.Records()), ShouldEqual, 3)
+			So(l.Records()[0].KeyVals, ShouldResemble, []interface{}{"component", "sink", LevelKey, "info", log.Msg, "starting up"})
+		})
+		Convey("should read records", func() {
+			r := l.Records()[1]
+			So(r.Message(), ShouldEqual, "cannot send")
+			So(r.Level(), ShouldEqual, "error")
+			So(r.Err().Error(), ShouldEqual, "timeout")
+			So(r.String("component"), ShouldEqual, "sink")
+			So(r.String("missing"), ShouldEqual, "")
+			_, exists := l.Records()[2].Get("odd")
+			So(exists, ShouldBeFalse)
+		})
+		Convey("should query records", func() {
+			So(l.Count(), ShouldEqual, 3)
+			So(l.Count(HasLevel("error")), ShouldEqual, 1)
+			So(l.Count(HasKey("component")), ShouldEqual, 3)
+			So(l.Count(HasValue("component", "sink"), MessageContains("start")), ShouldEqual, 1)
+			So(l.Count(MessageContains("")), ShouldEqual, 2)
+			So(l.Filter(HasErr())[0].Message(), ShouldEqual, "cannot send")
+		})
+		Convey("should assert on records", func() {
+			tb := &fakeTB{}
+			So(l.AssertLogged(tb, HasLevel("info")).Message(), ShouldEqual, "starting up")
+			l.AssertNotLogged(tb, HasLevel("debug"))
+			So(tb.failures, ShouldBeEmpty)
+			l.AssertLogged(tb, HasLevel("debug"))
+			l.AssertNotLogged(tb, HasErr())
+			So(len(tb.failures), ShouldEqual, 2)
+			So(tb.failures[0], ShouldContainSubstring, "3 records")
+		})
+		Convey("should keep errors and reset", func() {
+			So(l.ErrorLogger(errors.New("bad")), ShouldEqual, l)
+			So(len(l.Errors()), ShouldEqual, 1)
+			l.Reset()
+			So(l.Records(), ShouldBeEmpty)
+			So(l.Errors(), ShouldBeEmpty)
+		})
+		Convey("should be safe to use concurrently", func() {
+			var wg sync.WaitGroup
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					l.Log(log.Msg, "hi")
+				}()
+			}
+			wg.Wait()
+			So(l.Count(MessageContains("hi")), ShouldEqual, 10)
+		})
+	})
+}
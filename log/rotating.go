@@ -0,0 +1,254 @@
+package log
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/signalfx/golib/v3/errors"
+	"github.com/signalfx/golib/v3/pointer"
+	"github.com/signalfx/golib/v3/timekeeper"
+)
+
+// RotatingFileConfig controls optional parameters of a RotatingFile
+type RotatingFileConfig struct {
+	// MaxBytes is how large the file gets before it's rotated
+	MaxBytes *int64
+	// RotateEvery rotates the file once it's been open this long.  0 never rotates it for its age.
+	RotateEvery *time.Duration
+	// MaxBackups is how many rotated files are kept.  0 keeps them all.
+	MaxBackups *int
+	// Compress gzips rotated files
+	Compress *bool
+	// QueueSize is how many writes are queued for the file before writes are dropped
+	QueueSize *int
+	Timer     timekeeper.TimeKeeper
+}
+
+// DefaultRotatingFileConfig is used for unset config parameters
+var DefaultRotatingFileConfig = &RotatingFileConfig{
+	MaxBytes:    pointer.Int64(100 * 1024 * 1024),
+	RotateEvery: pointer.Duration(0),
+	MaxBackups:  pointer.Int(5),
+	Compress:    pointer.Bool(false),
+	QueueSize:   pointer.Int(1024),
+	Timer:       timekeeper.RealTime{},
+}
+
+// rotatedTimeFormat is the suffix of rotated files, which sorts in the order they were rotated
+const rotatedTimeFormat = "20060102T150405.000000000"
+
+var errRotatingFileClosed = errors.New("rotating file is closed")
+
+// RotatingFile is an io.WriteCloser, for loggers like NewJSONLogger, that appends to a file and rotates it
+// once it's too large or too old.  Rotated files are renamed with the time they were rotated, like
+// app.log.20060102T150405.000000000, gzipped if configured, and the oldest removed past MaxBackups.  Writes
+// are queued and written in the background, so they never block on the disk.  They're dropped, and counted,
+// if the queue is full.
+type RotatingFile struct {
+	filename string
+	conf     RotatingFileConfig
+
+	queue   chan queuedWrite
+	done    chan struct{}
+	closeMu sync.RWMutex
+	closed  bool
+	dropped int64
+	lastErr atomic.Value
+
+	// file, size and opened are only used by the background writer
+	file   *os.File
+	size   int64
+	opened time.Time
+}
+
+var _ io.WriteCloser = &RotatingFile{}
+
+// queuedWrite is a write waiting for the background writer, with when it was made
+type queuedWrite struct {
+	b  []byte
+	at time.Time
+}
+
+// NewRotatingFile opens filename for appending, creating it if it doesn't exist, and starts writing to it
+// in the background
+func NewRotatingFile(filename string, config *RotatingFileConfig) (*RotatingFile, error) {
+	conf := pointer.FillDefaultFrom(config, DefaultRotatingFileConfig).(*RotatingFileConfig)
+	f := &RotatingFile{
+		filename: filename,
+		conf:     *conf,
+		queue:    make(chan queuedWrite, *conf.QueueSize),
+		done:     make(chan struct{}),
+	}
+	if err := f.open(f.conf.Timer.Now()); err != nil {
+		return nil, err
+	}
+	go f.drain()
+	return f, nil
+}
+
+// Write queues a copy of p to be written to the file, or drops it if the queue is full.  It only fails if
+// the file is closed.
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.closeMu.RLock()
+	defer f.closeMu.RUnlock()
+	if f.closed {
+		return 0, errRotatingFileClosed
+	}
+	b := make([]byte, len(p))
+	copy(b, p)
+	select {
+	case f.queue <- queuedWrite{b: b, at: f.conf.Timer.Now()}:
+	default:
+		atomic.AddInt64(&f.dropped, 1)
+	}
+	return len(p), nil
+}
+
+// Close waits for the queued writes to be written, then closes the file
+func (f *RotatingFile) Close() error {
+	f.closeMu.Lock()
+	if f.closed {
+		f.closeMu.Unlock()
+		return errRotatingFileClosed
+	}
+	f.closed = true
+	close(f.queue)
+	f.closeMu.Unlock()
+	<-f.done
+	return f.file.Close()
+}
+
+// Dropped returns how many writes were dropped because the queue was full
+func (f *RotatingFile) Dropped() int64 {
+	return atomic.LoadInt64(&f.dropped)
+}
+
+// Err returns the last error writing or rotating the file in the background, or nil
+func (f *RotatingFile) Err() error {
+	err, _ := f.lastErr.Load().(error)
+	return err
+}
+
+func (f *RotatingFile) setErr(err error) {
+	if err != nil {
+		f.lastErr.Store(err)
+	}
+}
+
+func (f *RotatingFile) open(now time.Time) error {
+	file, err := os.OpenFile(f.filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return errors.Annotatef(err, "cannot open log file %s", f.filename)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return errors.Annotatef(errors.NewMultiErr([]error{err, file.Close()}), "cannot stat log file %s", f.filename)
+	}
+	f.file = file
+	f.size = info.Size()
+	f.opened = now
+	return nil
+}
+
+func (f *RotatingFile) drain() {
+	defer close(f.done)
+	for w := range f.queue {
+		if f.shouldRotate(int64(len(w.b)), w.at) {
+			f.setErr(f.rotate(w.at))
+		}
+		n, err := f.file.Write(w.b)
+		f.size += int64(n)
+		f.setErr(err)
+	}
+}
+
+// shouldRotate returns true if writing n more bytes would make the file too large, unless it's empty, or if
+// it's too old at now
+func (f *RotatingFile) shouldRotate(n int64, now time.Time) bool {
+	if f.size > 0 && f.size+n > *f.conf.MaxBytes {
+		return true
+	}
+	return *f.conf.RotateEvery > 0 && now.Sub(f.opened) >= *f.conf.RotateEvery
+}
+
+// rotate renames the file to a backup named for now and opens a new one
+func (f *RotatingFile) rotate(now time.Time) error {
+	if err := f.file.Close(); err != nil {
+		return errors.Annotatef(err, "cannot close log file %s", f.filename)
+	}
+	backup := f.filename + "." + now.UTC().Format(rotatedTimeFormat)
+	if err := os.Rename(f.filename, backup); err != nil {
+		return errors.Annotatef(errors.NewMultiErr([]error{err, f.open(now)}), "cannot rotate log file %s", f.filename)
+	}
+	if err := f.open(now); err != nil {
+		return err
+	}
+	if *f.conf.Compress {
+		if err := compressFile(backup); err != nil {
+			return err
+		}
+	}
+	return f.removeOldBackups()
+}
+
+// compressFile replaces filename with filename.gz
+func compressFile(filename string) (err error) {
+	in, err := os.Open(filename)
+	if err != nil {
+		return errors.Annotatef(err, "cannot open %s to compress", filename)
+	}
+	defer func() {
+		err = errors.NewMultiErr([]error{err, in.Close()})
+	}()
+	out, err := os.OpenFile(filename+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return errors.Annotatef(err, "cannot create %s.gz", filename)
+	}
+	gz := gzip.NewWriter(out)
+	_, err = io.Copy(gz, in)
+	if err = errors.NewMultiErr([]error{err, gz.Close(), out.Close()}); err != nil {
+		return errors.Annotatef(errors.NewMultiErr([]error{err, os.Remove(filename + ".gz")}), "cannot compress %s", filename)
+	}
+	return os.Remove(filename)
+}
+
+// removeOldBackups removes the oldest rotated files past MaxBackups
+func (f *RotatingFile) removeOldBackups() error {
+	if *f.conf.MaxBackups <= 0 {
+		return nil
+	}
+	dir, base := filepath.Split(f.filename)
+	if dir == "" {
+		dir = "."
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return errors.Annotatef(err, "cannot list log file backups in %s", dir)
+	}
+	var backups []string
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasPrefix(e.Name(), base+".") {
+			continue
+		}
+		suffix := strings.TrimSuffix(strings.TrimPrefix(e.Name(), base+"."), ".gz")
+		if _, err := time.Parse(rotatedTimeFormat, suffix); err == nil {
+			backups = append(backups, e.Name())
+		}
+	}
+	if len(backups) <= *f.conf.MaxBackups {
+		return nil
+	}
+	sort.Strings(backups)
+	errs := make([]error, 0, len(backups)-*f.conf.MaxBackups)
+	for _, name := range backups[:len(backups)-*f.conf.MaxBackups] {
+		errs = append(errs, os.Remove(filepath.Join(dir, name)))
+	}
+	return errors.NewMultiErr(errs)
+}
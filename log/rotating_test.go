@@ -0,0 +1,146 @@
+package log
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/signalfx/golib/v3/errors"
+	"github.com/signalfx/golib/v3/pointer"
+	"github.com/signalfx/golib/v3/timekeeper"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type stubTime struct {
+	timekeeper.RealTime
+	now time.Time
+}
+
+func (s *stubTime) Now() time.Time {
+	return s.now
+}
+
+func TestRotatingFile(t *testing.T) {
+	Convey("A rotating file", t, func() {
+		dir := t.TempDir()
+		filename := filepath.Join(dir, "app.log")
+		clock := &stubTime{now: time.Unix(1600000000, 0)}
+		conf := &RotatingFileConfig{
+			MaxBytes:   pointer.Int64(10),
+			MaxBackups: pointer.Int(2),
+			Timer:      clock,
+		}
+		files := func() []string {
+			entries, err := os.ReadDir(dir)
+			So(err, ShouldBeNil)
+			var ret []string
+			for _, e := range entries {
+				ret = append(ret, e.Name())
+			}
+			sort.Strings(ret)
+			return ret
+		}
+		read := func(name string) string {
+			b, err := os.ReadFile(filepath.Join(dir, name))
+			So(err, ShouldBeNil)
+			return string(b)
+		}
+		write := func(f *RotatingFile, lines ...string) {
+			for _, line := range lines {
+				// each rotation gets its own time
+				clock.now = clock.now.Add(time.Second)
+				n, err := f.Write([]byte(line))
+				So(err, ShouldBeNil)
+				So(n, ShouldEqual, len(line))
+			}
+		}
+		Convey("should rotate when it's too large", func() {
+			So(os.WriteFile(filename, []byte("12345\n"), 0o644), ShouldBeNil)
+			f, err := NewRotatingFile(filename, conf)
+			So(err, ShouldBeNil)
+			write(f, "abcd\n", "efgh\n", "ijkl\n", "mnop\n")
+			So(f.Close(), ShouldBeNil)
+			So(f.Err(), ShouldBeNil)
+			So(f.Dropped(), ShouldEqual, 0)
+			names := files()
+			So(len(names), ShouldEqual, 3)
+			So(names[0], ShouldEqual, "app.log")
+			So(read("app.log"), ShouldEqual, "ijkl\nmnop\n")
+			So(read(names[1]), ShouldEqual, "12345\n")
+			So(read(names[2]), ShouldEqual, "abcd\nefgh\n")
+			So(f.Close(), ShouldEqual, errRotatingFileClosed)
+			_, err = f.Write([]byte("x"))
+			So(err, ShouldEqual, errRotatingFileClosed)
+		})
+		Convey("should rotate when it's too old", func() {
+			conf.MaxBytes = pointer.Int64(1000)
+			conf.RotateEvery = pointer.Duration(time.Minute)
+			f, err := NewRotatingFile(filename, conf)
+			So(err, ShouldBeNil)
+			write(f, "a\n")
+			clock.now = clock.now.Add(time.Minute)
+			write(f, "b\n")
+			So(f.Close(), ShouldBeNil)
+			So(len(files()), ShouldEqual, 2)
+			So(read("app.log"), ShouldEqual, "b\n")
+		})
+		Convey("should compress rotated files", func() {
+			conf.Compress = pointer.Bool(true)
+			f, err := NewRotatingFile(filename, conf)
+			So(err, ShouldBeNil)
+			write(f, "0123456789", "abc")
+			So(f.Close(), ShouldBeNil)
+			So(f.Err(), ShouldBeNil)
+			names := files()
+			So(len(names), ShouldEqual, 2)
+			So(names[1], ShouldEndWith, ".gz")
+			in, err := os.Open(filepath.Join(dir, names[1]))
+			So(err, ShouldBeNil)
+			defer func() { So(in.Close(), ShouldBeNil) }()
+			gz, err := gzip.NewReader(in)
+			So(err, ShouldBeNil)
+			b, err := io.ReadAll(gz)
+			So(err, ShouldBeNil)
+			So(string(b), ShouldEqual, "0123456789")
+		})
+		Convey("should keep other files", func() {
+			So(os.WriteFile(filename+".lock", nil, 0o644), ShouldBeNil)
+			conf.MaxBackups = pointer.Int(1)
+			f, err := NewRotatingFile(filename, conf)
+			So(err, ShouldBeNil)
+			write(f, "0123456789", "0123456789", "0123456789")
+			So(f.Close(), ShouldBeNil)
+			names := files()
+			So(len(names), ShouldEqual, 3)
+			So(names[2], ShouldEqual, "app.log.lock")
+		})
+		Convey("should drop writes when the queue is full", func() {
+			conf.QueueSize = pointer.Int(0)
+			f, err := NewRotatingFile(filename, conf)
+			So(err, ShouldBeNil)
+			for i := 0; i < 100; i++ {
+				_, err := f.Write([]byte("x"))
+				So(err, ShouldBeNil)
+			}
+			So(f.Close(), ShouldBeNil)
+			So(f.Dropped(), ShouldBeGreaterThan, 0)
+			So(int64(len(read("app.log")))+f.Dropped(), ShouldEqual, 100)
+		})
+		Convey("should fail to open a missing directory", func() {
+			_, err := NewRotatingFile(filepath.Join(dir, "missing", "app.log"), nil)
+			So(os.IsNotExist(errors.Cause(err)), ShouldBeTrue)
+		})
+		Convey("should work with loggers", func() {
+			f, err := NewRotatingFile(filename, nil)
+			So(err, ShouldBeNil)
+			NewJSONLogger(f, Panic).Log(Msg, "hi")
+			So(f.Close(), ShouldBeNil)
+			So(strings.TrimSpace(read("app.log")), ShouldEqual, `{"message":"hi"}`)
+		})
+	})
+}
@@ -0,0 +1,129 @@
+package log
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TokenBucketLogger logs bursts of up to Burst messages, and PerSecond messages a second on average, to
+// Logger and drops the rest without blocking.  Unlike RateLimitedLogger it never disables itself for a
+// whole period, so messages keep trickling through an error storm.
+type TokenBucketLogger struct {
+	Logger    Logger
+	PerSecond float64
+	Burst     int
+	Now       func() time.Time
+
+	mu         sync.Mutex
+	tokens     float64
+	last       time.Time
+	suppressed int64
+}
+
+var _ Logger = &TokenBucketLogger{}
+
+// NewRateLimited returns a logger that logs up to burst messages at once and perSecond messages a second
+// to logger
+func NewRateLimited(logger Logger, perSecond float64, burst int) *TokenBucketLogger {
+	return &TokenBucketLogger{
+		Logger:    logger,
+		PerSecond: perSecond,
+		Burst:     burst,
+		tokens:    float64(burst),
+	}
+}
+
+func (r *TokenBucketLogger) now() time.Time {
+	if r.Now == nil {
+		return time.Now()
+	}
+	return r.Now()
+}
+
+// allow takes a token from the bucket, if there's one, after refilling it for the time since the last call
+func (r *TokenBucketLogger) allow() bool {
+	now := r.now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.last.IsZero() && now.After(r.last) {
+		r.tokens += now.Sub(r.last).Seconds() * r.PerSecond
+	}
+	if r.tokens > float64(r.Burst) {
+		r.tokens = float64(r.Burst)
+	}
+	if now.After(r.last) {
+		r.last = now
+	}
+	if r.tokens < 1 {
+		return false
+	}
+	r.tokens--
+	return true
+}
+
+// Log logs kvs to the wrapped Logger if there's a token for it
+func (r *TokenBucketLogger) Log(kvs ...interface{}) {
+	if !r.allow() {
+		atomic.AddInt64(&r.suppressed, 1)
+		return
+	}
+	r.Logger.Log(kvs...)
+}
+
+// Disabled returns true if the wrapped logger is disabled
+func (r *TokenBucketLogger) Disabled() bool {
+	return IsDisabled(r.Logger)
+}
+
+// Suppressed returns how many messages have been dropped
+func (r *TokenBucketLogger) Suppressed() int64 {
+	return atomic.LoadInt64(&r.suppressed)
+}
+
+// SampledLogger logs the First messages to Logger, then every Every'th message after them, and drops the
+// rest without blocking
+type SampledLogger struct {
+	Logger Logger
+	First  int64
+	Every  int64
+
+	count      int64
+	suppressed int64
+}
+
+var _ Logger = &SampledLogger{}
+
+// NewSampled returns a logger that logs one in every n messages to logger, starting with the first
+func NewSampled(logger Logger, n int64) *SampledLogger {
+	return NewFirstThenEvery(logger, 0, n)
+}
+
+// NewFirstThenEvery returns a logger that logs the first messages to logger, then every every'th message
+func NewFirstThenEvery(logger Logger, first int64, every int64) *SampledLogger {
+	return &SampledLogger{
+		Logger: logger,
+		First:  first,
+		Every:  every,
+	}
+}
+
+// Log logs kvs to the wrapped Logger if it's one of the first messages or falls on the sample
+func (s *SampledLogger) Log(kvs ...interface{}) {
+	n := atomic.AddInt64(&s.count, 1)
+	if n > s.First && (s.Every <= 0 || (n-s.First-1)%s.Every != 0) {
+		atomic.AddInt64(&s.suppressed, 1)
+		return
+	}
+	s.Logger.Log(kvs...)
+}
+
+// Disabled returns true if the wrapped logger is disabled
+func (s *SampledLogger) Disabled() bool {
+	return IsDisabled(s.Logger)
+}
+
+// Suppressed returns how many messages have been dropped
+func (s *SampledLogger) Suppressed() int64 {
+	return atomic.LoadInt64(&s.suppressed)
+}
@@ -0,0 +1,107 @@
+package log
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTokenBucketLogger(t *testing.T) {
+	Convey("A rate limited logger", t, func() {
+		now := time.Unix(1000, 0)
+		counter := &Counter{}
+		l := NewRateLimited(counter, 2, 3)
+		l.Now = func() time.Time { return now }
+		Convey("should log a burst then drop", func() {
+			for i := 0; i < 5; i++ {
+				l.Log(Msg, i)
+			}
+			So(counter.Count, ShouldEqual, 3)
+			So(l.Suppressed(), ShouldEqual, 2)
+			Convey("and refill at its rate", func() {
+				now = now.Add(time.Second)
+				for i := 0; i < 5; i++ {
+					l.Log(Msg, i)
+				}
+				So(counter.Count, ShouldEqual, 5)
+				So(l.Suppressed(), ShouldEqual, 5)
+			})
+			Convey("up to its burst", func() {
+				now = now.Add(time.Hour)
+				for i := 0; i < 5; i++ {
+					l.Log(Msg, i)
+				}
+				So(counter.Count, ShouldEqual, 6)
+			})
+			Convey("ignoring the clock going backwards", func() {
+				now = now.Add(-time.Hour)
+				l.Log(Msg, 1)
+				now = now.Add(time.Hour)
+				l.Log(Msg, 1)
+				So(counter.Count, ShouldEqual, 3)
+			})
+		})
+		Convey("should be disabled with its logger", func() {
+			So(l.Disabled(), ShouldBeFalse)
+			So(NewRateLimited(Discard, 1, 1).Disabled(), ShouldBeTrue)
+		})
+		Convey("should use the clock by default", func() {
+			l := NewRateLimited(counter, 1, 1)
+			l.Log(Msg, 1)
+			l.Log(Msg, 2)
+			So(counter.Count, ShouldEqual, 1)
+		})
+	})
+}
+
+func TestSampledLogger(t *testing.T) {
+	Convey("A sampled logger", t, func() {
+		out := NewChannelLogger(100, Panic)
+		logged := func(l Logger, n int) []interface{} {
+			for i := 1; i <= n; i++ {
+				l.Log(i)
+			}
+			var ret []interface{}
+			for len(out.Out) > 0 {
+				ret = append(ret, (<-out.Out)[0])
+			}
+			return ret
+		}
+		Convey("should log one in n", func() {
+			l := NewSampled(out, 3)
+			So(logged(l, 7), ShouldResemble, []interface{}{1, 4, 7})
+			So(l.Suppressed(), ShouldEqual, 4)
+		})
+		Convey("should log the first then every m'th", func() {
+			l := NewFirstThenEvery(out, 2, 3)
+			So(logged(l, 9), ShouldResemble, []interface{}{1, 2, 3, 6, 9})
+			So(l.Suppressed(), ShouldEqual, 4)
+		})
+		Convey("should only log the first without a sample", func() {
+			So(logged(NewFirstThenEvery(out, 2, 0), 5), ShouldResemble, []interface{}{1, 2})
+		})
+		Convey("should count concurrent messages", func() {
+			counter := &Counter{}
+			l := NewSampled(counter, 10)
+			wg := sync.WaitGroup{}
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for j := 0; j < 100; j++ {
+						l.Log(j)
+					}
+				}()
+			}
+			wg.Wait()
+			So(counter.Count, ShouldEqual, 100)
+			So(l.Suppressed(), ShouldEqual, 900)
+		})
+		Convey("should be disabled with its logger", func() {
+			So(NewSampled(out, 2).Disabled(), ShouldBeFalse)
+			So(NewSampled(Discard, 2).Disabled(), ShouldBeTrue)
+		})
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/signalfx/golib/v3/env"
 	"github.com/signalfx/golib/v3/errors"
 )
 
@@ -153,3 +154,9 @@ func (m *Maestro) getServiceInstanceNames(service string) []string {
 	}
 	return strings.Split(val, ",")
 }
+
+// Bind fills the env tagged fields of the struct pointed to by dst from the environment.  See env.Bind
+// for the supported tags and types.
+func (m *Maestro) Bind(dst interface{}) error {
+	return env.BindWith(dst, m.osGetenv)
+}
@@ -87,3 +87,20 @@ func TestMaestro(t *testing.T) {
 
 	assert.Equal(t, []string{"host3"}, m.GetNodeList("BADSERVICE", []string{"badclient"}))
 }
+
+func TestMaestroBind(t *testing.T) {
+	e := envMap{"SERVICE_NAME": "svc", "WORKERS": "4"}
+	m := New(e.get)
+	var conf struct {
+		Service string `env:"SERVICE_NAME,required"`
+		Workers int    `env:"WORKERS" envDefault:"1"`
+		Region  string `env:"REGION" envDefault:"local"`
+	}
+	assert.NoError(t, m.Bind(&conf))
+	assert.Equal(t, "svc", conf.Service)
+	assert.Equal(t, 4, conf.Workers)
+	assert.Equal(t, "local", conf.Region)
+
+	delete(e, "SERVICE_NAME")
+	assert.Error(t, m.Bind(&conf))
+}
@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"time"
 )
@@ -12,6 +14,15 @@ import (
 // will need to update this version from time to time
 var identityURL = "http://169.254.169.254/2016-09-02/dynamic/instance-identity/document"
 
+// tokenURL is the IMDSv2 session token endpoint
+var tokenURL = "http://169.254.169.254/latest/api/token"
+
+const (
+	tokenHeader    = "X-aws-ec2-metadata-token"
+	tokenTTLHeader = "X-aws-ec2-metadata-token-ttl-seconds"
+	tokenTTL       = "21600"
+)
+
 // EC2Metadata contains metadata about an ec2 instance
 type EC2Metadata struct {
 	AvailabilityZone string `json:"availabilityZone"`
@@ -59,14 +70,28 @@ func (e *EC2Metadata) ToStringMap() map[string]string {
 	return metadata
 }
 
-// Get returns a map with aws metadata including the AWSUniqueID
+// Get returns a map with aws metadata including the AWSUniqueID.  An IMDSv2
+// session token is requested first and IMDSv1 is used if that fails.
 func Get() (*EC2Metadata, error) {
-	return GetWithIdentityURL(identityURL)
+	return GetWithURLs(tokenURL, identityURL)
 }
 
 // GetWithIdentityURL returns a map with aws metadata including AWSUniqueID
+// using IMDSv1
 func GetWithIdentityURL(url string) (*EC2Metadata, error) {
-	metadata, err := requestAWSInfo(url)
+	return getWithToken(url, "")
+}
+
+// GetWithURLs returns a map with aws metadata including AWSUniqueID.  A session
+// token is requested from tokenURL (IMDSv2) and attached to the identity
+// request; if no token could be obtained the request falls back to IMDSv1.
+func GetWithURLs(tokenURL string, identityURL string) (*EC2Metadata, error) {
+	token, _ := requestToken(tokenURL)
+	return getWithToken(identityURL, token)
+}
+
+func getWithToken(url string, token string) (*EC2Metadata, error) {
+	metadata, err := requestAWSInfo(url, token)
 	if err != nil {
 		return metadata, errors.New("not an aws box")
 	}
@@ -77,9 +102,34 @@ func GetWithIdentityURL(url string) (*EC2Metadata, error) {
 	return metadata, nil
 }
 
+// requestToken requests an IMDSv2 session token
+func requestToken(url string) (string, error) {
+	httpClient := &http.Client{Timeout: 200 * time.Millisecond}
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPut, url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set(tokenTTLHeader, tokenTTL)
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status code %d requesting token", res.StatusCode)
+	}
+	token, err := ioutil.ReadAll(io.LimitReader(res.Body, 4096))
+	if err != nil {
+		return "", err
+	}
+	return string(token), nil
+}
+
 // requestAWSInfo makes a request to the desired aws metadata url and decodes
 // the response into an EC2Metadata struct
-func requestAWSInfo(url string) (metadata *EC2Metadata, err error) {
+func requestAWSInfo(url string, token string) (metadata *EC2Metadata, err error) {
 	metadata = &EC2Metadata{}
 	httpClient := &http.Client{Timeout: 200 * time.Millisecond}
 
@@ -90,6 +140,9 @@ func requestAWSInfo(url string) (metadata *EC2Metadata, err error) {
 	)
 
 	if req, err = http.NewRequestWithContext(context.Background(), http.MethodGet, url, nil); err == nil {
+		if token != "" {
+			req.Header.Set(tokenHeader, token)
+		}
 		if res, err = httpClient.Do(req); err == nil {
 			err = json.NewDecoder(res.Body).Decode(metadata)
 			_ = res.Body.Close()
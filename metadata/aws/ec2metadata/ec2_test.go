@@ -146,8 +146,10 @@ func TestAWSMetadata_Get(t *testing.T) {
 
 				// set the identityURL to point to mock server
 				identityURL = server.URL
+				tokenURL = server.URL + "/notoken"
 			} else {
 				identityURL = "NotARealDomainName"
+				tokenURL = "NotARealDomainName"
 			}
 			// create new aws metadata
 			awsMeta, err := Get()
@@ -162,3 +164,36 @@ func TestAWSMetadata_Get(t *testing.T) {
 		})
 	}
 }
+
+func TestAWSMetadata_GetIMDSv2(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut || r.Header.Get(tokenTTLHeader) == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, "testtoken")
+	})
+	mux.HandleFunc("/identity", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(tokenHeader) != "testtoken" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"instanceId":"testInstanceId","accountId":"testAccountId","region":"testRegion"}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	awsMeta, err := GetWithURLs(server.URL+"/token", server.URL+"/identity")
+	if err != nil {
+		t.Fatalf("GetWithURLs() error = %v", err)
+	}
+	if awsMeta.AWSUniqueID != "testInstanceId_testRegion_testAccountId" {
+		t.Errorf("GetWithURLs() AWSUniqueID = %s", awsMeta.AWSUniqueID)
+	}
+
+	// without a token the identity request is rejected
+	if _, err := GetWithURLs(server.URL+"/missing", server.URL+"/identity"); err == nil {
+		t.Error("expected an error without a token")
+	}
+}
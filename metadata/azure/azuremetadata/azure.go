@@ -0,0 +1,73 @@
+package azuremetadata
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// will need to update this api version from time to time
+var computeURL = "http://169.254.169.254/metadata/instance/compute?api-version=2021-02-01"
+
+// AzureMetadata contains metadata about an azure virtual machine
+type AzureMetadata struct {
+	VMID              string `json:"vmId"`
+	Name              string `json:"name"`
+	Location          string `json:"location"`
+	Zone              string `json:"zone"`
+	VMSize            string `json:"vmSize"`
+	SubscriptionID    string `json:"subscriptionId"`
+	ResourceGroupName string `json:"resourceGroupName"`
+}
+
+// ToStringMap returns the azure metadata as a string map
+func (a *AzureMetadata) ToStringMap() map[string]string {
+	return map[string]string{
+		"azure_vm_id":               a.VMID,
+		"azure_name":                a.Name,
+		"azure_location":            a.Location,
+		"azure_zone":                a.Zone,
+		"azure_vm_size":             a.VMSize,
+		"azure_subscription_id":     a.SubscriptionID,
+		"azure_resource_group_name": a.ResourceGroupName,
+	}
+}
+
+// Get returns the metadata of the azure vm this process is running on
+func Get() (*AzureMetadata, error) {
+	return GetWithURL(computeURL)
+}
+
+// GetWithURL returns azure metadata read from the given compute metadata url
+func GetWithURL(url string) (*AzureMetadata, error) {
+	metadata, err := requestAzureInfo(url)
+	if err != nil {
+		return metadata, errors.New("not an azure box")
+	}
+	return metadata, nil
+}
+
+func requestAzureInfo(url string) (*AzureMetadata, error) {
+	metadata := &AzureMetadata{}
+	httpClient := &http.Client{Timeout: 200 * time.Millisecond}
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, url, nil)
+	if err != nil {
+		return metadata, err
+	}
+	req.Header.Set("Metadata", "true")
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return metadata, err
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+	if res.StatusCode != http.StatusOK {
+		return metadata, fmt.Errorf("unexpected status code %d", res.StatusCode)
+	}
+	err = json.NewDecoder(res.Body).Decode(metadata)
+	return metadata, err
+}
@@ -0,0 +1,84 @@
+package azuremetadata
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestGet(t *testing.T) {
+	tests := []struct {
+		name    string
+		compute map[string]interface{}
+		status  int
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name: "successful connection",
+			compute: map[string]interface{}{
+				"vmId":              "testVMID",
+				"name":              "testName",
+				"location":          "westus2",
+				"zone":              "1",
+				"vmSize":            "Standard_D2s_v3",
+				"subscriptionId":    "testSubscription",
+				"resourceGroupName": "testGroup",
+			},
+			status: http.StatusOK,
+			want: map[string]string{
+				"azure_vm_id":               "testVMID",
+				"azure_name":                "testName",
+				"azure_location":            "westus2",
+				"azure_zone":                "1",
+				"azure_vm_size":             "Standard_D2s_v3",
+				"azure_subscription_id":     "testSubscription",
+				"azure_resource_group_name": "testGroup",
+			},
+		},
+		{
+			name:    "bad status code",
+			status:  http.StatusBadRequest,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Metadata") != "true" {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				w.WriteHeader(tt.status)
+				_ = json.NewEncoder(w).Encode(tt.compute)
+			}))
+			defer server.Close()
+			computeURL = server.URL
+
+			azureMeta, err := Get()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("AzureMetadata.Get() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			got := azureMeta.ToStringMap()
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("AzureMetadata.Get() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetWithURLBadURL(t *testing.T) {
+	if _, err := GetWithURL("NotARealDomainName"); err == nil {
+		t.Error("expected an error")
+	}
+	if _, err := GetWithURL(":"); err == nil {
+		t.Error("expected an error")
+	}
+}
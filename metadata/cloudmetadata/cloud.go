@@ -0,0 +1,134 @@
+package cloudmetadata
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/signalfx/golib/v3/metadata/aws/ec2metadata"
+	"github.com/signalfx/golib/v3/metadata/azure/azuremetadata"
+	"github.com/signalfx/golib/v3/metadata/gcp/gcemetadata"
+)
+
+// Cloud providers reported in the cloud_provider dimension
+const (
+	ProviderAWS   = "aws"
+	ProviderGCP   = "gcp"
+	ProviderAzure = "azure"
+)
+
+// Map the provider lookups to unexported package variables for testing purposes
+var (
+	getEC2   = ec2metadata.Get
+	getGCE   = gcemetadata.Get
+	getAzure = azuremetadata.Get
+)
+
+// ErrNoProvider is returned when none of the cloud metadata services answered
+var ErrNoProvider = errors.New("unable to find cloud provider metadata")
+
+// Identity is the provider agnostic identity of a cloud host
+type Identity struct {
+	Provider    string
+	InstanceID  string
+	Region      string
+	Zone        string
+	MachineType string
+}
+
+// ToStringMap returns the identity as dimensions suitable for attaching to all
+// emitted telemetry (for example via Scheduler.DefaultDimensions).  Empty
+// values are left out.
+func (i *Identity) ToStringMap() map[string]string {
+	ret := make(map[string]string, 5)
+	for k, v := range map[string]string{
+		"cloud_provider":     i.Provider,
+		"cloud_instance_id":  i.InstanceID,
+		"cloud_region":       i.Region,
+		"cloud_zone":         i.Zone,
+		"cloud_machine_type": i.MachineType,
+	} {
+		if v != "" {
+			ret[k] = v
+		}
+	}
+	return ret
+}
+
+// FromEC2 converts ec2 metadata into an Identity
+func FromEC2(m *ec2metadata.EC2Metadata) *Identity {
+	return &Identity{
+		Provider:    ProviderAWS,
+		InstanceID:  m.InstanceID,
+		Region:      m.Region,
+		Zone:        m.AvailabilityZone,
+		MachineType: m.InstanceType,
+	}
+}
+
+// FromGCE converts gce metadata into an Identity
+func FromGCE(m *gcemetadata.GCEMetadata) *Identity {
+	return &Identity{
+		Provider:    ProviderGCP,
+		InstanceID:  m.InstanceID,
+		Region:      m.Region,
+		Zone:        m.Zone,
+		MachineType: m.MachineType,
+	}
+}
+
+// FromAzure converts azure metadata into an Identity
+func FromAzure(m *azuremetadata.AzureMetadata) *Identity {
+	return &Identity{
+		Provider:    ProviderAzure,
+		InstanceID:  m.VMID,
+		Region:      m.Location,
+		Zone:        m.Zone,
+		MachineType: m.VMSize,
+	}
+}
+
+// Get queries the aws, gcp and azure metadata services concurrently and
+// returns the identity from the first one (in that order) that answered
+func Get() (*Identity, error) {
+	lookups := []func() (*Identity, error){
+		func() (*Identity, error) {
+			m, err := getEC2()
+			if err != nil {
+				return nil, err
+			}
+			return FromEC2(m), nil
+		},
+		func() (*Identity, error) {
+			m, err := getGCE()
+			if err != nil {
+				return nil, err
+			}
+			return FromGCE(m), nil
+		},
+		func() (*Identity, error) {
+			m, err := getAzure()
+			if err != nil {
+				return nil, err
+			}
+			return FromAzure(m), nil
+		},
+	}
+	results := make([]*Identity, len(lookups))
+	wg := sync.WaitGroup{}
+	wg.Add(len(lookups))
+	for i := range lookups {
+		go func(i int) {
+			defer wg.Done()
+			if id, err := lookups[i](); err == nil {
+				results[i] = id
+			}
+		}(i)
+	}
+	wg.Wait()
+	for _, id := range results {
+		if id != nil {
+			return id, nil
+		}
+	}
+	return &Identity{}, ErrNoProvider
+}
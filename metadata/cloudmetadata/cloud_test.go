@@ -0,0 +1,98 @@
+package cloudmetadata
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/signalfx/golib/v3/metadata/aws/ec2metadata"
+	"github.com/signalfx/golib/v3/metadata/azure/azuremetadata"
+	"github.com/signalfx/golib/v3/metadata/gcp/gcemetadata"
+)
+
+var errTest = errors.New("nope")
+
+func noEC2() (*ec2metadata.EC2Metadata, error)       { return &ec2metadata.EC2Metadata{}, errTest }
+func noGCE() (*gcemetadata.GCEMetadata, error)       { return &gcemetadata.GCEMetadata{}, errTest }
+func noAzure() (*azuremetadata.AzureMetadata, error) { return &azuremetadata.AzureMetadata{}, errTest }
+
+func TestGet(t *testing.T) {
+	defer func() {
+		getEC2, getGCE, getAzure = ec2metadata.Get, gcemetadata.Get, azuremetadata.Get
+	}()
+	tests := []struct {
+		name    string
+		ec2     func() (*ec2metadata.EC2Metadata, error)
+		gce     func() (*gcemetadata.GCEMetadata, error)
+		azure   func() (*azuremetadata.AzureMetadata, error)
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name: "aws",
+			ec2: func() (*ec2metadata.EC2Metadata, error) {
+				return &ec2metadata.EC2Metadata{InstanceID: "i-1", Region: "us-east-1", AvailabilityZone: "us-east-1a", InstanceType: "m5.large"}, nil
+			},
+			gce:   noGCE,
+			azure: noAzure,
+			want: map[string]string{
+				"cloud_provider":     "aws",
+				"cloud_instance_id":  "i-1",
+				"cloud_region":       "us-east-1",
+				"cloud_zone":         "us-east-1a",
+				"cloud_machine_type": "m5.large",
+			},
+		},
+		{
+			name: "gcp",
+			ec2:  noEC2,
+			gce: func() (*gcemetadata.GCEMetadata, error) {
+				return &gcemetadata.GCEMetadata{InstanceID: "123", Region: "us-central1", Zone: "us-central1-a", MachineType: "n1-standard-1"}, nil
+			},
+			azure: noAzure,
+			want: map[string]string{
+				"cloud_provider":     "gcp",
+				"cloud_instance_id":  "123",
+				"cloud_region":       "us-central1",
+				"cloud_zone":         "us-central1-a",
+				"cloud_machine_type": "n1-standard-1",
+			},
+		},
+		{
+			name: "azure without zone",
+			ec2:  noEC2,
+			gce:  noGCE,
+			azure: func() (*azuremetadata.AzureMetadata, error) {
+				return &azuremetadata.AzureMetadata{VMID: "vm", Location: "westus2", VMSize: "Standard_D2s_v3"}, nil
+			},
+			want: map[string]string{
+				"cloud_provider":     "azure",
+				"cloud_instance_id":  "vm",
+				"cloud_region":       "westus2",
+				"cloud_machine_type": "Standard_D2s_v3",
+			},
+		},
+		{
+			name:    "no provider",
+			ec2:     noEC2,
+			gce:     noGCE,
+			azure:   noAzure,
+			want:    map[string]string{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			getEC2, getGCE, getAzure = tt.ec2, tt.gce, tt.azure
+			id, err := Get()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Get() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got := id.ToStringMap(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Get() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package gcemetadata
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// metadataURL returns the instance and project metadata in a single document
+var metadataURL = "http://metadata.google.internal/computeMetadata/v1/?recursive=true"
+
+// GCEMetadata contains metadata about a gce instance
+type GCEMetadata struct {
+	InstanceID  string
+	Name        string
+	Hostname    string
+	Zone        string
+	Region      string
+	MachineType string
+	ProjectID   string
+}
+
+// ToStringMap returns the gce metadata as a string map
+func (g *GCEMetadata) ToStringMap() map[string]string {
+	return map[string]string{
+		"gcp_instance_id":  g.InstanceID,
+		"gcp_name":         g.Name,
+		"gcp_hostname":     g.Hostname,
+		"gcp_zone":         g.Zone,
+		"gcp_region":       g.Region,
+		"gcp_machine_type": g.MachineType,
+		"gcp_project_id":   g.ProjectID,
+	}
+}
+
+// document is the subset of the recursive metadata document we care about
+type document struct {
+	Instance struct {
+		ID          json.Number `json:"id"`
+		Name        string      `json:"name"`
+		Hostname    string      `json:"hostname"`
+		Zone        string      `json:"zone"`
+		MachineType string      `json:"machineType"`
+	} `json:"instance"`
+	Project struct {
+		ProjectID string `json:"projectId"`
+	} `json:"project"`
+}
+
+// Get returns the metadata of the gce instance this process is running on
+func Get() (*GCEMetadata, error) {
+	return GetWithURL(metadataURL)
+}
+
+// GetWithURL returns gce metadata read from the given recursive metadata url
+func GetWithURL(url string) (*GCEMetadata, error) {
+	doc, err := requestGCEInfo(url)
+	if err != nil {
+		return &GCEMetadata{}, errors.New("not a gce box")
+	}
+	zone := lastPathElement(doc.Instance.Zone)
+	return &GCEMetadata{
+		InstanceID:  doc.Instance.ID.String(),
+		Name:        doc.Instance.Name,
+		Hostname:    doc.Instance.Hostname,
+		Zone:        zone,
+		Region:      regionFromZone(zone),
+		MachineType: lastPathElement(doc.Instance.MachineType),
+		ProjectID:   doc.Project.ProjectID,
+	}, nil
+}
+
+// lastPathElement strips the "projects/<num>/zones/" style prefix that gce
+// puts on zones and machine types
+func lastPathElement(s string) string {
+	return s[strings.LastIndex(s, "/")+1:]
+}
+
+// regionFromZone turns a zone like "us-central1-a" into "us-central1"
+func regionFromZone(zone string) string {
+	if idx := strings.LastIndex(zone, "-"); idx > 0 {
+		return zone[:idx]
+	}
+	return zone
+}
+
+func requestGCEInfo(url string) (*document, error) {
+	httpClient := &http.Client{Timeout: 200 * time.Millisecond}
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", res.StatusCode)
+	}
+	if res.Header.Get("Metadata-Flavor") != "Google" {
+		return nil, errors.New("response is missing the Metadata-Flavor header")
+	}
+	doc := &document{}
+	if err := json.NewDecoder(res.Body).Decode(doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
@@ -0,0 +1,114 @@
+package gcemetadata
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+const testDocument = `{
+	"instance": {
+		"id": 4520031799277581759,
+		"name": "test-instance",
+		"hostname": "test-instance.c.test-project.internal",
+		"zone": "projects/123456789/zones/us-central1-a",
+		"machineType": "projects/123456789/machineTypes/n1-standard-1"
+	},
+	"project": {
+		"projectId": "test-project",
+		"numericProjectId": 123456789
+	}
+}`
+
+func TestGet(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name: "successful connection",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Metadata-Flavor") != "Google" {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+				w.Header().Set("Metadata-Flavor", "Google")
+				fmt.Fprint(w, testDocument)
+			},
+			want: map[string]string{
+				"gcp_instance_id":  "4520031799277581759",
+				"gcp_name":         "test-instance",
+				"gcp_hostname":     "test-instance.c.test-project.internal",
+				"gcp_zone":         "us-central1-a",
+				"gcp_region":       "us-central1",
+				"gcp_machine_type": "n1-standard-1",
+				"gcp_project_id":   "test-project",
+			},
+		},
+		{
+			name: "missing metadata flavor header",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, testDocument)
+			},
+			wantErr: true,
+		},
+		{
+			name: "bad status code",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNotFound)
+			},
+			wantErr: true,
+		},
+		{
+			name: "bad json",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Metadata-Flavor", "Google")
+				fmt.Fprint(w, "{")
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.handler)
+			defer server.Close()
+			metadataURL = server.URL
+
+			gceMeta, err := Get()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GCEMetadata.Get() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			got := gceMeta.ToStringMap()
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GCEMetadata.Get() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetWithURLBadURL(t *testing.T) {
+	if _, err := GetWithURL("NotARealDomainName"); err == nil {
+		t.Error("expected an error")
+	}
+	if _, err := GetWithURL(":"); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestRegionFromZone(t *testing.T) {
+	if got := regionFromZone("europe-west1-b"); got != "europe-west1" {
+		t.Errorf("regionFromZone() = %s", got)
+	}
+	if got := regionFromZone("nozone"); got != "nozone" {
+		t.Errorf("regionFromZone() = %s", got)
+	}
+}
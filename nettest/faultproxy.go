@@ -0,0 +1,260 @@
+package nettest
+
+import (
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/signalfx/golib/v3/errors"
+)
+
+// Faults control how a FaultProxy misbehaves.  The zero value forwards traffic untouched.
+type Faults struct {
+	// Latency is added before every chunk of data is forwarded, in either direction
+	Latency time.Duration
+	// BytesPerSecond throttles each direction of each connection.  Zero means unlimited
+	BytesPerSecond int64
+	// DropConnections closes newly accepted connections without dialing the target
+	DropConnections bool
+	// ResetAfterBytes resets (RST) a connection once it has forwarded this many bytes in total.
+	// Zero means never
+	ResetAfterBytes int64
+}
+
+// FaultProxyStats are counters of what a FaultProxy has done
+type FaultProxyStats struct {
+	Accepted  int64
+	Dropped   int64
+	Reset     int64
+	BytesSent int64
+}
+
+// FaultProxy is a TCP proxy between a client and a server that can inject latency, throttle bandwidth,
+// drop connections and reset them.  Faults can be changed at any time and apply to data forwarded after
+// the change, which lets tests exercise retry and backoff logic deterministically.
+type FaultProxy struct {
+	target   string
+	listener net.Listener
+
+	mu     sync.Mutex
+	faults Faults
+	conns  map[*proxiedConn]struct{}
+	closed bool
+
+	wg    sync.WaitGroup
+	stats FaultProxyStats
+}
+
+var _ NetworkListener = &FaultProxy{}
+
+type proxiedConn struct {
+	client    net.Conn
+	server    net.Conn
+	forwarded int64
+	active    int32
+	closeOnce sync.Once
+	// resetOnce is separate from closeOnce, so a reset injected once the connection is closed is still
+	// counted
+	resetOnce sync.Once
+}
+
+// NewFaultProxy listens on listenAddr (use "localhost:0" for a free port) and forwards connections to target
+func NewFaultProxy(listenAddr string, target string) (*FaultProxy, error) {
+	l, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		return nil, errors.Annotatef(err, "cannot listen on %s", listenAddr)
+	}
+	p := &FaultProxy{
+		target:   target,
+		listener: l,
+		conns:    make(map[*proxiedConn]struct{}),
+	}
+	p.wg.Add(1)
+	go p.acceptLoop()
+	return p, nil
+}
+
+// Addr is the address clients should connect to
+func (p *FaultProxy) Addr() net.Addr {
+	return p.listener.Addr()
+}
+
+// SetFaults changes the faults injected from now on
+func (p *FaultProxy) SetFaults(f Faults) {
+	p.mu.Lock()
+	p.faults = f
+	p.mu.Unlock()
+}
+
+// Faults returns the currently injected faults
+func (p *FaultProxy) Faults() Faults {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.faults
+}
+
+// Stats returns a snapshot of the proxy counters
+func (p *FaultProxy) Stats() FaultProxyStats {
+	return FaultProxyStats{
+		Accepted:  atomic.LoadInt64(&p.stats.Accepted),
+		Dropped:   atomic.LoadInt64(&p.stats.Dropped),
+		Reset:     atomic.LoadInt64(&p.stats.Reset),
+		BytesSent: atomic.LoadInt64(&p.stats.BytesSent),
+	}
+}
+
+// ResetAll sends a TCP reset on every connection currently being proxied
+func (p *FaultProxy) ResetAll() {
+	p.mu.Lock()
+	conns := make([]*proxiedConn, 0, len(p.conns))
+	for c := range p.conns {
+		conns = append(conns, c)
+	}
+	p.mu.Unlock()
+	for _, c := range conns {
+		p.reset(c)
+	}
+}
+
+// Close stops accepting connections, closes all proxied connections and waits for forwarding to stop
+func (p *FaultProxy) Close() error {
+	err := p.listener.Close()
+	p.mu.Lock()
+	p.closed = true
+	for c := range p.conns {
+		c.close()
+	}
+	p.mu.Unlock()
+	p.wg.Wait()
+	return err
+}
+
+func (p *FaultProxy) acceptLoop() {
+	defer p.wg.Done()
+	for {
+		client, err := p.listener.Accept()
+		if err != nil {
+			return
+		}
+		atomic.AddInt64(&p.stats.Accepted, 1)
+		if p.Faults().DropConnections {
+			atomic.AddInt64(&p.stats.Dropped, 1)
+			_ = client.Close()
+			continue
+		}
+		server, err := net.Dial("tcp", p.target)
+		if err != nil {
+			atomic.AddInt64(&p.stats.Dropped, 1)
+			_ = client.Close()
+			continue
+		}
+		c := &proxiedConn{client: client, server: server, active: 2}
+		p.mu.Lock()
+		if p.closed {
+			// Close has already closed every connection it knows about, so this one would never be closed
+			p.mu.Unlock()
+			c.close()
+			return
+		}
+		p.conns[c] = struct{}{}
+		p.wg.Add(2)
+		p.mu.Unlock()
+		go p.forward(c, c.server, c.client)
+		go p.forward(c, c.client, c.server)
+	}
+}
+
+func (p *FaultProxy) forward(c *proxiedConn, dst net.Conn, src net.Conn) {
+	defer p.wg.Done()
+	defer p.done(c)
+	buf := make([]byte, 32*1024)
+	for {
+		f := p.Faults()
+		chunk := buf
+		if f.BytesPerSecond > 0 && f.BytesPerSecond < int64(len(buf)) {
+			chunk = buf[:f.BytesPerSecond]
+		}
+		n, err := src.Read(chunk)
+		if n > 0 {
+			if !p.send(c, dst, chunk[:n], f) {
+				return
+			}
+		}
+		if err != nil {
+			if err == io.EOF {
+				if tcp, ok := dst.(*net.TCPConn); ok {
+					_ = tcp.CloseWrite()
+					return
+				}
+			}
+			c.close()
+			return
+		}
+	}
+}
+
+// send writes data to dst applying latency, throttling and resets, returning false if forwarding should stop
+func (p *FaultProxy) send(c *proxiedConn, dst net.Conn, data []byte, f Faults) bool {
+	if f.Latency > 0 {
+		time.Sleep(f.Latency)
+	}
+	if f.ResetAfterBytes > 0 {
+		remaining := f.ResetAfterBytes - atomic.LoadInt64(&c.forwarded)
+		if remaining <= 0 {
+			p.reset(c)
+			return false
+		}
+		if int64(len(data)) > remaining {
+			data = data[:remaining]
+		}
+	}
+	if f.BytesPerSecond > 0 {
+		time.Sleep(time.Duration(int64(len(data)) * int64(time.Second) / f.BytesPerSecond))
+	}
+	n, err := dst.Write(data)
+	atomic.AddInt64(&c.forwarded, int64(n))
+	atomic.AddInt64(&p.stats.BytesSent, int64(n))
+	if err != nil {
+		c.close()
+		return false
+	}
+	if f.ResetAfterBytes > 0 && atomic.LoadInt64(&c.forwarded) >= f.ResetAfterBytes {
+		p.reset(c)
+		return false
+	}
+	return true
+}
+
+func (p *FaultProxy) reset(c *proxiedConn) {
+	c.resetOnce.Do(func() {
+		atomic.AddInt64(&p.stats.Reset, 1)
+		for _, conn := range []net.Conn{c.client, c.server} {
+			if tcp, ok := conn.(*net.TCPConn); ok {
+				_ = tcp.SetLinger(0)
+			}
+			_ = conn.Close()
+		}
+		// the connections are closed, so close has nothing left to do
+		c.closeOnce.Do(func() {})
+	})
+}
+
+// done is called as each direction stops forwarding; once both have stopped the connection is forgotten
+func (p *FaultProxy) done(c *proxiedConn) {
+	if atomic.AddInt32(&c.active, -1) != 0 {
+		return
+	}
+	c.close()
+	p.mu.Lock()
+	delete(p.conns, c)
+	p.mu.Unlock()
+}
+
+func (c *proxiedConn) close() {
+	c.closeOnce.Do(func() {
+		_ = c.client.Close()
+		_ = c.server.Close()
+	})
+}
@@ -0,0 +1,179 @@
+package nettest
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/signalfx/golib/v3/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// echoServer echos back everything written to it
+func echoServer(t *testing.T) net.Listener {
+	l, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, _ = io.Copy(c, c)
+				log.IfErr(log.Discard, c.Close())
+			}()
+		}
+	}()
+	return l
+}
+
+func setupProxy(t *testing.T) (*FaultProxy, func()) {
+	server := echoServer(t)
+	p, err := NewFaultProxy("localhost:0", server.Addr().String())
+	require.NoError(t, err)
+	return p, func() {
+		log.IfErr(log.Discard, p.Close())
+		log.IfErr(log.Discard, server.Close())
+	}
+}
+
+func roundTrip(t *testing.T, p *FaultProxy, msg string) (string, error) {
+	conn, err := net.Dial("tcp", p.Addr().String())
+	require.NoError(t, err)
+	defer func() {
+		log.IfErr(log.Discard, conn.Close())
+	}()
+	if _, err := conn.Write([]byte(msg)); err != nil {
+		return "", err
+	}
+	// the proxy may already have closed the connection
+	_ = conn.(*net.TCPConn).CloseWrite()
+	b, err := ioutil.ReadAll(conn)
+	return string(b), err
+}
+
+func TestFaultProxyForwards(t *testing.T) {
+	p, cleanup := setupProxy(t)
+	defer cleanup()
+	got, err := roundTrip(t, p, "hello world")
+	assert.NoError(t, err)
+	assert.Equal(t, "hello world", got)
+	assert.Equal(t, int64(1), p.Stats().Accepted)
+	assert.Equal(t, int64(22), p.Stats().BytesSent)
+	assert.True(t, TCPPort(p) > 0)
+}
+
+func TestFaultProxyLatency(t *testing.T) {
+	p, cleanup := setupProxy(t)
+	defer cleanup()
+	p.SetFaults(Faults{Latency: 50 * time.Millisecond})
+	assert.Equal(t, 50*time.Millisecond, p.Faults().Latency)
+	start := time.Now()
+	got, err := roundTrip(t, p, "hi")
+	assert.NoError(t, err)
+	assert.Equal(t, "hi", got)
+	assert.True(t, time.Since(start) >= 100*time.Millisecond)
+}
+
+func TestFaultProxyThrottle(t *testing.T) {
+	p, cleanup := setupProxy(t)
+	defer cleanup()
+	p.SetFaults(Faults{BytesPerSecond: 100})
+	start := time.Now()
+	got, err := roundTrip(t, p, string(make([]byte, 20)))
+	assert.NoError(t, err)
+	assert.Equal(t, 20, len(got))
+	assert.True(t, time.Since(start) >= 300*time.Millisecond)
+}
+
+func TestFaultProxyDrop(t *testing.T) {
+	p, cleanup := setupProxy(t)
+	defer cleanup()
+	p.SetFaults(Faults{DropConnections: true})
+	got, _ := roundTrip(t, p, "hi")
+	assert.Equal(t, "", got)
+	assert.Equal(t, int64(1), p.Stats().Dropped)
+}
+
+func TestFaultProxyBadTarget(t *testing.T) {
+	l, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	target := l.Addr().String()
+	log.IfErr(log.Panic, l.Close())
+	p, err := NewFaultProxy("localhost:0", target)
+	require.NoError(t, err)
+	defer func() {
+		log.IfErr(log.Discard, p.Close())
+	}()
+	got, _ := roundTrip(t, p, "hi")
+	assert.Equal(t, "", got)
+	assert.Equal(t, int64(1), p.Stats().Dropped)
+}
+
+func TestFaultProxyResetAfterBytes(t *testing.T) {
+	p, cleanup := setupProxy(t)
+	defer cleanup()
+	p.SetFaults(Faults{ResetAfterBytes: 5})
+	got, _ := roundTrip(t, p, "hello world")
+	assert.True(t, len(got) < len("hello world"))
+	assert.Equal(t, int64(1), p.Stats().Reset)
+}
+
+func TestFaultProxyResetAll(t *testing.T) {
+	p, cleanup := setupProxy(t)
+	defer cleanup()
+	conn, err := net.Dial("tcp", p.Addr().String())
+	require.NoError(t, err)
+	defer func() {
+		log.IfErr(log.Discard, conn.Close())
+	}()
+	_, err = conn.Write([]byte("hi"))
+	require.NoError(t, err)
+	buf := make([]byte, 2)
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	p.ResetAll()
+	_, err = conn.Read(buf)
+	assert.Error(t, err)
+	assert.Equal(t, int64(1), p.Stats().Reset)
+}
+
+func TestFaultProxyResetAfterClose(t *testing.T) {
+	p, cleanup := setupProxy(t)
+	defer cleanup()
+	client, server := net.Pipe()
+	c := &proxiedConn{client: client, server: server}
+	c.close()
+	p.reset(c)
+	p.reset(c)
+	assert.Equal(t, int64(1), p.Stats().Reset)
+}
+
+func TestFaultProxyBadListen(t *testing.T) {
+	_, err := NewFaultProxy("not an address", "localhost:1")
+	assert.Error(t, err)
+}
+
+func TestFaultProxyAcceptAfterClose(t *testing.T) {
+	p, cleanup := setupProxy(t)
+	defer cleanup()
+	// a connection accepted once Close has closed the proxied connections must be closed too
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+	conn, err := net.Dial("tcp", p.Addr().String())
+	require.NoError(t, err)
+	defer func() {
+		log.IfErr(log.Discard, conn.Close())
+	}()
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second*5)))
+	_, err = conn.Read(make([]byte, 1))
+	assert.Equal(t, io.EOF, err)
+	p.mu.Lock()
+	assert.Len(t, p.conns, 0)
+	p.mu.Unlock()
+}
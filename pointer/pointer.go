@@ -6,64 +6,102 @@ import (
 	"time"
 )
 
+// Of returns a pointer to a copy of v.  It works for any type, including user defined ones, and
+// supersedes the per-type helpers below which are kept for compatibility.
+func Of[T any](v T) *T {
+	return &v
+}
+
+// ValueOr returns the value p points to, or def if p is nil
+func ValueOr[T any](p *T, def T) T {
+	if p == nil {
+		return def
+	}
+	return *p
+}
+
+// Value returns the value p points to, or the zero value of T if p is nil
+func Value[T any](p *T) T {
+	var zero T
+	return ValueOr(p, zero)
+}
+
+// SliceOf returns a slice of pointers to copies of each of vs
+func SliceOf[T any](vs ...T) []*T {
+	ret := make([]*T, len(vs))
+	for i := range vs {
+		ret[i] = Of(vs[i])
+	}
+	return ret
+}
+
+// SliceValues dereferences each of ps, using def for nil entries
+func SliceValues[T any](ps []*T, def T) []T {
+	ret := make([]T, len(ps))
+	for i, p := range ps {
+		ret[i] = ValueOr(p, def)
+	}
+	return ret
+}
+
 // Duration returns a pointer to a time.Duration
 func Duration(d time.Duration) *time.Duration {
-	return &d
+	return Of(d)
 }
 
 // Int32 returns a pointer to an int32
 func Int32(i int32) *int32 {
-	return &i
+	return Of(i)
 }
 
 // Uint returns a pointer to a uint
 func Uint(i uint) *uint {
-	return &i
+	return Of(i)
 }
 
 // Uint16 returns a pointer to a uint16
 func Uint16(i uint16) *uint16 {
-	return &i
+	return Of(i)
 }
 
 // Uint32 returns a pointer to a uint32
 func Uint32(i uint32) *uint32 {
-	return &i
+	return Of(i)
 }
 
 // Uint64 returns a pointer to a uint64
 func Uint64(i uint64) *uint64 {
-	return &i
+	return Of(i)
 }
 
 // String returns a pointer to a string
 func String(i string) *string {
-	return &i
+	return Of(i)
 }
 
 // Int returns a pointer to an int
 func Int(i int) *int {
-	return &i
+	return Of(i)
 }
 
 // Int64 returns a pointer to an int64
 func Int64(i int64) *int64 {
-	return &i
+	return Of(i)
 }
 
 // Bool returns a pointer to a bool
 func Bool(b bool) *bool {
-	return &b
+	return Of(b)
 }
 
 // Float32 returns a pointer to a float32
 func Float32(f float32) *float32 {
-	return &f
+	return Of(f)
 }
 
 // Float64 returns a pointer to a float64
 func Float64(b float64) *float64 {
-	return &b
+	return Of(b)
 }
 
 func canNil(k reflect.Kind) bool {
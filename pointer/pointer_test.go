@@ -164,3 +164,30 @@ func TestFillDefaultFrom(t *testing.T) {
 		})
 	})
 }
+
+type customID string
+
+func TestGenerics(t *testing.T) {
+	Convey("Of should work for any type", t, func() {
+		So(*Of(3), ShouldEqual, 3)
+		So(*Of(customID("abc")), ShouldEqual, customID("abc"))
+		p := Person{Name: String("john")}
+		So(*Of(p).Name, ShouldEqual, "john")
+		v := 1
+		So(Of(v), ShouldNotEqual, &v)
+	})
+	Convey("ValueOr and Value should handle nil", t, func() {
+		So(ValueOr((*int)(nil), 7), ShouldEqual, 7)
+		So(ValueOr(Of(3), 7), ShouldEqual, 3)
+		So(Value((*string)(nil)), ShouldEqual, "")
+		So(Value(Of(customID("x"))), ShouldEqual, customID("x"))
+	})
+	Convey("slice helpers should round trip", t, func() {
+		ps := SliceOf("a", "b")
+		So(len(ps), ShouldEqual, 2)
+		So(*ps[1], ShouldEqual, "b")
+		ps = append(ps, nil)
+		So(SliceValues(ps, "z"), ShouldResemble, []string{"a", "b", "z"})
+		So(SliceOf[int](), ShouldBeEmpty)
+	})
+}
@@ -6,6 +6,9 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"runtime/debug"
+	"strconv"
+	"strings"
 	"sync"
 
 	"github.com/signalfx/golib/v3/datapoint"
@@ -14,6 +17,9 @@ import (
 	"github.com/signalfx/golib/v3/sfxclient"
 )
 
+// readBuildInfo is a package variable so tests can fake the binary's build info
+var readBuildInfo = debug.ReadBuildInfo
+
 // SHA1Reporter reports a gauge to Client that is the commit SHA1 of the current image
 type SHA1Reporter struct {
 	RepoURL  string
@@ -21,7 +27,66 @@ type SHA1Reporter struct {
 	Logger   log.Logger
 	Fi       fileInfo
 	Tag      string
-	oc       sync.Once
+	// Modules are module paths whose versions, as compiled into the binary, are reported as dimensions
+	Modules []string
+	// Build is read from the binary's embedded build info
+	Build BuildInfo
+	oc    sync.Once
+}
+
+// BuildInfo is the subset of runtime/debug.BuildInfo that is reported
+type BuildInfo struct {
+	GoVersion   string            `json:"goVersion,omitempty"`
+	VCSRevision string            `json:"vcsRevision,omitempty"`
+	VCSTime     string            `json:"vcsTime,omitempty"`
+	VCSModified bool              `json:"vcsModified,omitempty"`
+	Modules     map[string]string `json:"modules,omitempty"`
+}
+
+func loadBuildInfo(modules []string) BuildInfo {
+	var bi BuildInfo
+	info, ok := readBuildInfo()
+	if !ok {
+		return bi
+	}
+	bi.GoVersion = info.GoVersion
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			bi.VCSRevision = s.Value
+		case "vcs.time":
+			bi.VCSTime = s.Value
+		case "vcs.modified":
+			bi.VCSModified, _ = strconv.ParseBool(s.Value)
+		}
+	}
+	if len(modules) == 0 {
+		return bi
+	}
+	bi.Modules = make(map[string]string, len(modules))
+	deps := append([]*debug.Module{&info.Main}, info.Deps...)
+	for _, want := range modules {
+		for _, dep := range deps {
+			if dep.Path != want {
+				continue
+			}
+			if dep.Replace != nil {
+				dep = dep.Replace
+			}
+			bi.Modules[want] = dep.Version
+		}
+	}
+	return bi
+}
+
+// moduleDimension turns a module path into a valid dimension name
+func moduleDimension(path string) string {
+	return "module_" + strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, path)
 }
 
 type fileInfo struct {
@@ -47,6 +112,7 @@ func load(fileName string) (fileInfo, error) {
 func (s *SHA1Reporter) loadInfo() {
 	s.oc.Do(func() {
 		s.Tag = os.Getenv("DOCKER_TAG")
+		s.Build = loadBuildInfo(s.Modules)
 		fi, err := load(s.FileName)
 		if err != nil {
 			s.Logger.Log(log.Err, err, logkey.Name, s.FileName, "Cannot load file info!")
@@ -57,21 +123,41 @@ func (s *SHA1Reporter) loadInfo() {
 	})
 }
 
-// Var returns an expvar that is the build file info
+// Var returns an expvar that is the build file info along with the binary's build info
 func (s *SHA1Reporter) Var() expvar.Var {
 	s.loadInfo()
 	return expvar.Func(func() interface{} {
-		return s.Fi
+		return struct {
+			fileInfo
+			Build BuildInfo `json:"build"`
+		}{s.Fi, s.Build}
 	})
 }
 
-// Datapoints returns a single datapoint that includes the commit sha loaded from a config file
+// Datapoints returns a single datapoint that includes the commit sha loaded from a config file.  The go
+// version, vcs information and requested module versions from the binary's build info are added as
+// dimensions when available; the vcs revision is used as the commit if the file could not be loaded.
 func (s *SHA1Reporter) Datapoints() []*datapoint.Datapoint {
 	s.loadInfo()
 	dims := map[string]string{"commit": s.Fi.Commit}
+	if dims["commit"] == "" && s.Build.VCSRevision != "" {
+		dims["commit"] = s.Build.VCSRevision
+	}
 	if len(s.Tag) > 0 {
 		dims["dockerTag"] = s.Tag
 	}
+	if s.Build.GoVersion != "" {
+		dims["go_version"] = s.Build.GoVersion
+	}
+	if s.Build.VCSTime != "" {
+		dims["vcs_time"] = s.Build.VCSTime
+	}
+	if s.Build.VCSRevision != "" {
+		dims["vcs_modified"] = strconv.FormatBool(s.Build.VCSModified)
+	}
+	for path, version := range s.Build.Modules {
+		dims[moduleDimension(path)] = version
+	}
 	return []*datapoint.Datapoint{
 		sfxclient.Gauge("fileinfo_commit", dims, int64(1)),
 	}
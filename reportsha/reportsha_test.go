@@ -3,6 +3,7 @@ package reportsha
 import (
 	"io/ioutil"
 	"os"
+	"runtime/debug"
 	"testing"
 
 	"github.com/signalfx/golib/v3/log"
@@ -35,6 +36,50 @@ func TestReportSha(t *testing.T) {
 			So(reporter.Var().String(), ShouldContainSubstring, "b70a843b07741e04ce6845aaefdbcb077787b4a3")
 		})
 
+		Convey("Build info should be reported", func() {
+			readBuildInfo = func() (*debug.BuildInfo, bool) {
+				return &debug.BuildInfo{
+					GoVersion: "go1.99",
+					Main:      debug.Module{Path: "example.com/service", Version: "(devel)"},
+					Deps: []*debug.Module{
+						{Path: "github.com/signalfx/golib/v3", Version: "v3.3.46"},
+						{Path: "example.com/replaced", Version: "v1.0.0", Replace: &debug.Module{Path: "../replaced", Version: "v1.0.1"}},
+					},
+					Settings: []debug.BuildSetting{
+						{Key: "vcs.revision", Value: "abc123"},
+						{Key: "vcs.time", Value: "2022-09-01T00:00:00Z"},
+						{Key: "vcs.modified", Value: "true"},
+					},
+				}, true
+			}
+			reporter.Modules = []string{"github.com/signalfx/golib/v3", "example.com/replaced", "example.com/missing"}
+			dps := reporter.Datapoints()
+			dims := dps[0].Dimensions
+			So(dims["commit"], ShouldEqual, "b70a843b07741e04ce6845aaefdbcb077787b4a3")
+			So(dims["go_version"], ShouldEqual, "go1.99")
+			So(dims["vcs_time"], ShouldEqual, "2022-09-01T00:00:00Z")
+			So(dims["vcs_modified"], ShouldEqual, "true")
+			So(dims["module_github_com_signalfx_golib_v3"], ShouldEqual, "v3.3.46")
+			So(dims["module_example_com_replaced"], ShouldEqual, "v1.0.1")
+			So(dims, ShouldNotContainKey, "module_example_com_missing")
+			So(reporter.Var().String(), ShouldContainSubstring, `"vcsRevision":"abc123"`)
+
+			Convey("and the vcs revision should stand in for a missing file", func() {
+				other := SHA1Reporter{FileName: "asdfsadfsad", Logger: log.Discard}
+				So(other.Datapoints()[0].Dimensions["commit"], ShouldEqual, "abc123")
+			})
+		})
+
+		Convey("Missing build info should be ignored", func() {
+			readBuildInfo = func() (*debug.BuildInfo, bool) {
+				return nil, false
+			}
+			reporter.Modules = []string{"github.com/signalfx/golib/v3"}
+			dims := reporter.Datapoints()[0].Dimensions
+			So(dims, ShouldNotContainKey, "go_version")
+			So(dims, ShouldNotContainKey, "vcs_modified")
+		})
+
 		Convey("Invalid files should not load", func() {
 			_, _ = tmpFile.WriteString("asdfsadfsad")
 			So(reporter.Var().String(), ShouldNotContainSubstring, "asdf")
@@ -46,6 +91,7 @@ func TestReportSha(t *testing.T) {
 		})
 
 		Reset(func() {
+			readBuildInfo = debug.ReadBuildInfo
 			So(os.Remove(tmpFile.Name()), ShouldBeNil)
 			So(tmpFile.Close(), ShouldBeNil)
 		})
@@ -2,8 +2,12 @@ package safeexec
 
 import (
 	"bytes"
+	"context"
+	"io"
+	"os"
 	"os/exec"
 	"strings"
+	"sync"
 
 	"github.com/signalfx/golib/v3/errors"
 )
@@ -20,3 +24,82 @@ func Execute(name string, stdin string, args ...string) (string, string, error)
 	err := cmd.Run()
 	return stdout.String(), stderr.String(), errors.Annotatef(err, "cannot run command %s", name)
 }
+
+// Options control how ExecuteContext runs a command.  The zero value behaves like Execute.
+type Options struct {
+	// Stdin is passed to the command
+	Stdin io.Reader
+	// Dir is the working directory of the command.  Empty means the current directory
+	Dir string
+	// Env, if not nil, replaces the environment of the command
+	Env []string
+	// ExtraEnv is appended to the environment of the command (to Env, or to the current environment if Env is nil)
+	ExtraEnv []string
+	// OnStdout is called with each chunk of stdout as it is produced
+	OnStdout func([]byte)
+	// OnStderr is called with each chunk of stderr as it is produced
+	OnStderr func([]byte)
+	// MaxOutputBytes caps how much of stdout and of stderr is kept in the returned strings.  Output past the
+	// cap is still passed to the callbacks.  Zero means no cap
+	MaxOutputBytes int
+}
+
+// ExecuteContext runs a command like Execute, killing it when ctx is done.  Output is streamed to the
+// callbacks in opts as it arrives.  The returned error wraps ctx.Err() if the command was stopped by ctx.
+func ExecuteContext(ctx context.Context, opts *Options, name string, args ...string) (string, string, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdin = opts.Stdin
+	cmd.Dir = opts.Dir
+	if opts.Env != nil || opts.ExtraEnv != nil {
+		env := opts.Env
+		if env == nil {
+			env = os.Environ()
+		}
+		cmd.Env = append(append([]string{}, env...), opts.ExtraEnv...)
+	}
+	stdout := &cappedWriter{max: opts.MaxOutputBytes, callback: opts.OnStdout}
+	stderr := &cappedWriter{max: opts.MaxOutputBytes, callback: opts.OnStderr}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	err := cmd.Run()
+	if ctxErr := ctx.Err(); err != nil && ctxErr != nil {
+		err = errors.Wrap(errors.Errorf("command %s stopped: %s", name, err), ctxErr)
+	} else {
+		err = errors.Annotatef(err, "cannot run command %s", name)
+	}
+	return stdout.String(), stderr.String(), err
+}
+
+// cappedWriter buffers up to max bytes and forwards everything to callback
+type cappedWriter struct {
+	mu       sync.Mutex
+	buf      bytes.Buffer
+	max      int
+	callback func([]byte)
+}
+
+func (c *cappedWriter) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.callback != nil {
+		c.callback(p)
+	}
+	toKeep := p
+	if c.max > 0 {
+		if remaining := c.max - c.buf.Len(); remaining < len(p) {
+			toKeep = p[:remaining]
+		}
+	}
+	c.buf.Write(toKeep)
+	return len(p), nil
+}
+
+func (c *cappedWriter) String() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.buf.String()
+}
@@ -1,9 +1,14 @@
 package safeexec
 
 import (
+	"bytes"
+	"context"
 	"runtime"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/signalfx/golib/v3/errors"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -20,3 +25,75 @@ func TestNotHereExec(t *testing.T) {
 	_, _, err := Execute("asdgfhnjasdgnadsjkgnjadhfgnjkadf", "", "hi")
 	assert.Error(t, err)
 }
+
+func TestExecuteContextStreaming(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		return
+	}
+	var streamed bytes.Buffer
+	stdout, stderr, err := ExecuteContext(context.Background(), &Options{
+		Stdin:    strings.NewReader("hello"),
+		OnStdout: func(b []byte) { streamed.Write(b) },
+	}, "cat")
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", stdout)
+	assert.Equal(t, "", stderr)
+	assert.Equal(t, "hello", streamed.String())
+}
+
+func TestExecuteContextNilOptions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		return
+	}
+	stdout, _, err := ExecuteContext(context.Background(), nil, "echo", "hi")
+	assert.NoError(t, err)
+	assert.Equal(t, "hi\n", stdout)
+}
+
+func TestExecuteContextOutputCap(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		return
+	}
+	var streamed bytes.Buffer
+	stdout, _, err := ExecuteContext(context.Background(), &Options{
+		MaxOutputBytes: 3,
+		OnStdout:       func(b []byte) { streamed.Write(b) },
+	}, "echo", "hello")
+	assert.NoError(t, err)
+	assert.Equal(t, "hel", stdout)
+	assert.Equal(t, "hello\n", streamed.String())
+}
+
+func TestExecuteContextEnv(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		return
+	}
+	stdout, _, err := ExecuteContext(context.Background(), &Options{
+		Env:      []string{"A=1"},
+		ExtraEnv: []string{"B=2"},
+	}, "sh", "-c", "echo $A$B$HOME")
+	assert.NoError(t, err)
+	assert.Equal(t, "12\n", stdout)
+
+	stdout, _, err = ExecuteContext(context.Background(), &Options{ExtraEnv: []string{"B=2"}, Dir: "/"}, "sh", "-c", "echo $B; pwd")
+	assert.NoError(t, err)
+	assert.Equal(t, "2\n/\n", stdout)
+}
+
+func TestExecuteContextTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, _, err := ExecuteContext(ctx, nil, "sleep", "10")
+	assert.Error(t, err)
+	assert.Equal(t, context.DeadlineExceeded, errors.Tail(err))
+	assert.True(t, time.Since(start) < 5*time.Second)
+}
+
+func TestExecuteContextFailure(t *testing.T) {
+	_, _, err := ExecuteContext(context.Background(), nil, "asdgfhnjasdgnadsjkgnjadhfgnjkadf")
+	assert.Error(t, err)
+}
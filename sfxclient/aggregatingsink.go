@@ -0,0 +1,220 @@
+package sfxclient
+
+import (
+	"context"
+	"math"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/errors"
+	"github.com/signalfx/golib/v3/event"
+	"github.com/signalfx/golib/v3/timekeeper"
+	"github.com/signalfx/golib/v3/trace"
+)
+
+// DefaultAggregationWindow is how long an AggregatingSink aggregates datapoints by default
+const DefaultAggregationWindow = time.Second * 10
+
+// GaugeAggregation is how an AggregatingSink rolls up the gauges of a series over a window
+type GaugeAggregation int
+
+const (
+	// AggregateLast keeps the last value
+	AggregateLast GaugeAggregation = iota
+	// AggregateMin keeps the smallest value
+	AggregateMin
+	// AggregateMax keeps the biggest value
+	AggregateMax
+	// AggregateAvg averages the values
+	AggregateAvg
+)
+
+// AggregatingSink pre-aggregates the datapoints of each series, a metric, its type and its dimensions,
+// over a Window before forwarding one datapoint per series to the next sink, to cut how many datapoints
+// chatty producers send.  Counters, which are deltas, are summed, cumulative counters and datapoints
+// without numeric values keep their last value, and gauges are rolled up as Gauges says.  Events and spans
+// are forwarded straight away.
+type AggregatingSink struct {
+	// Window is how often Run forwards what's been aggregated
+	Window time.Duration
+	// Gauges is how gauges are rolled up
+	Gauges GaugeAggregation
+	Timer  timekeeper.TimeKeeper
+	// ErrorHandler is called when forwarding fails.  Run stops if it returns an error
+	ErrorHandler func(error) error
+
+	next FullSink
+
+	mu     sync.Mutex
+	series map[string]*aggregate
+	// order is the keys of series in the order they were first seen, so they're forwarded in that order
+	order []string
+
+	stats struct {
+		received  int64
+		forwarded int64
+	}
+}
+
+var (
+	_ FullSink  = &AggregatingSink{}
+	_ Collector = &AggregatingSink{}
+)
+
+// aggregate is what a window of a series' datapoints rolls up to
+type aggregate struct {
+	last  *datapoint.Datapoint
+	count int64
+	// sum, min and max are of numeric values, and isInt is whether they all were integers
+	sum, min, max float64
+	isInt         bool
+}
+
+// NewAggregatingSink creates a sink aggregating over DefaultAggregationWindow, keeping the last value of
+// gauges, before forwarding to next
+func NewAggregatingSink(next FullSink) *AggregatingSink {
+	return &AggregatingSink{
+		Window:       DefaultAggregationWindow,
+		Gauges:       AggregateLast,
+		Timer:        timekeeper.RealTime{},
+		ErrorHandler: DefaultErrorHandler,
+		next:         next,
+		series:       make(map[string]*aggregate),
+	}
+}
+
+// seriesKey identifies the series of dp
+func seriesKey(dp *datapoint.Datapoint) string {
+	var b strings.Builder
+	b.WriteString(dp.Metric)
+	b.WriteByte(0)
+	b.WriteString(dp.MetricType.String())
+	datapoint.RangeSorted(dp.Dimensions, func(k string, v string) {
+		b.WriteByte(0)
+		b.WriteString(k)
+		b.WriteByte(0)
+		b.WriteString(v)
+	})
+	return b.String()
+}
+
+func numericValue(v datapoint.Value) (float64, bool, bool) {
+	switch t := v.(type) {
+	case datapoint.IntValue:
+		return float64(t.Int()), true, true
+	case datapoint.FloatValue:
+		return t.Float(), false, true
+	}
+	return 0, false, false
+}
+
+// AddDatapoints aggregates points until the window is forwarded
+func (a *AggregatingSink) AddDatapoints(ctx context.Context, points []*datapoint.Datapoint) error {
+	atomic.AddInt64(&a.stats.received, int64(len(points)))
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, dp := range points {
+		key := seriesKey(dp)
+		agg, exists := a.series[key]
+		if !exists {
+			agg = &aggregate{isInt: true, min: math.Inf(1), max: math.Inf(-1)}
+			a.series[key] = agg
+			a.order = append(a.order, key)
+		}
+		agg.last = dp
+		agg.count++
+		if f, isInt, ok := numericValue(dp.Value); ok {
+			agg.sum += f
+			agg.min = math.Min(agg.min, f)
+			agg.max = math.Max(agg.max, f)
+			agg.isInt = agg.isInt && isInt
+		}
+	}
+	return nil
+}
+
+// AddEvents forwards events to the next sink
+func (a *AggregatingSink) AddEvents(ctx context.Context, events []*event.Event) error {
+	return a.next.AddEvents(ctx, events)
+}
+
+// AddSpans forwards spans to the next sink
+func (a *AggregatingSink) AddSpans(ctx context.Context, spans []*trace.Span) error {
+	return a.next.AddSpans(ctx, spans)
+}
+
+// rollup returns the datapoint a window of a series rolls up to
+func (a *AggregatingSink) rollup(agg *aggregate) *datapoint.Datapoint {
+	last := agg.last
+	if _, _, ok := numericValue(last.Value); !ok || agg.count == 1 {
+		return last
+	}
+	var v float64
+	switch {
+	case last.MetricType == datapoint.Count:
+		v = agg.sum
+	case last.MetricType == datapoint.Counter:
+		return last
+	case a.Gauges == AggregateMin:
+		v = agg.min
+	case a.Gauges == AggregateMax:
+		v = agg.max
+	case a.Gauges == AggregateAvg:
+		return datapoint.New(last.Metric, last.Dimensions, datapoint.NewFloatValue(agg.sum/float64(agg.count)), last.MetricType, last.Timestamp)
+	default:
+		return last
+	}
+	value := datapoint.Value(datapoint.NewFloatValue(v))
+	if agg.isInt {
+		value = datapoint.NewIntValue(int64(v))
+	}
+	return datapoint.New(last.Metric, last.Dimensions, value, last.MetricType, last.Timestamp)
+}
+
+// Flush forwards what's been aggregated to the next sink now, starting a new window
+func (a *AggregatingSink) Flush(ctx context.Context) error {
+	a.mu.Lock()
+	series, order := a.series, a.order
+	a.series, a.order = make(map[string]*aggregate, len(series)), nil
+	a.mu.Unlock()
+	if len(order) == 0 {
+		return nil
+	}
+	points := make([]*datapoint.Datapoint, 0, len(order))
+	for _, key := range order {
+		points = append(points, a.rollup(series[key]))
+	}
+	atomic.AddInt64(&a.stats.forwarded, int64(len(points)))
+	return errors.Annotate(a.next.AddDatapoints(ctx, points), "cannot forward aggregated datapoints")
+}
+
+// Run forwards what's been aggregated every Window until ctx is done, flushing one last time, or the
+// ErrorHandler returns an error.  This is intended to be run inside a goroutine.
+func (a *AggregatingSink) Run(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			if err := a.Flush(context.Background()); err != nil {
+				_ = a.ErrorHandler(err)
+			}
+			return errors.Annotate(ctx.Err(), "context closed")
+		case <-a.Timer.After(a.Window):
+			if err := a.Flush(ctx); err != nil {
+				if err2 := errors.Annotate(a.ErrorHandler(err), "error handler returned an error"); err2 != nil {
+					return err2
+				}
+			}
+		}
+	}
+}
+
+// Datapoints returns how many datapoints the sink received and forwarded
+func (a *AggregatingSink) Datapoints() []*datapoint.Datapoint {
+	return []*datapoint.Datapoint{
+		Cumulative("total_aggregating_sink_received", nil, atomic.LoadInt64(&a.stats.received)),
+		Cumulative("total_aggregating_sink_forwarded", nil, atomic.LoadInt64(&a.stats.forwarded)),
+	}
+}
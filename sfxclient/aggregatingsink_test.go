@@ -0,0 +1,128 @@
+package sfxclient
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/errors"
+	"github.com/signalfx/golib/v3/event"
+	"github.com/signalfx/golib/v3/timekeeper/timekeepertest"
+	"github.com/signalfx/golib/v3/trace"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAggregatingSink(t *testing.T) {
+	Convey("an aggregating sink", t, func() {
+		ctx := context.Background()
+		next := &recordingSink{}
+		a := NewAggregatingSink(next)
+		host := func(h string) map[string]string {
+			return map[string]string{"host": h}
+		}
+		add := func(points ...*datapoint.Datapoint) {
+			So(a.AddDatapoints(ctx, points), ShouldBeNil)
+		}
+		add(
+			Counter("hits", host("a"), 2),
+			Gauge("load", host("a"), 3),
+			Counter("hits", host("b"), 5),
+			Cumulative("total", host("a"), 10),
+			datapoint.New("state", nil, datapoint.NewStringValue("up"), datapoint.Enum, time.Time{}),
+			Counter("hits", host("a"), 4),
+			Gauge("load", host("a"), 1),
+			Cumulative("total", host("a"), 12),
+			GaugeF("load", host("a"), 2.5),
+			datapoint.New("state", nil, datapoint.NewStringValue("down"), datapoint.Enum, time.Time{}),
+		)
+		So(next.calls, ShouldEqual, 0)
+		value := func(i int) datapoint.Value {
+			return next.points[i].Value
+		}
+		Convey("should sum counters and keep the last of the rest", func() {
+			So(a.Flush(ctx), ShouldBeNil)
+			So(next.calls, ShouldEqual, 1)
+			So(len(next.points), ShouldEqual, 5)
+			So(next.points[0].Metric, ShouldEqual, "hits")
+			So(next.points[0].Dimensions, ShouldResemble, host("a"))
+			So(value(0), ShouldResemble, datapoint.NewIntValue(6))
+			So(value(1), ShouldResemble, datapoint.NewFloatValue(2.5))
+			So(value(2), ShouldResemble, datapoint.NewIntValue(5))
+			So(value(3), ShouldResemble, datapoint.NewIntValue(12))
+			So(value(4), ShouldResemble, datapoint.NewStringValue("down"))
+			So(a.Datapoints()[0].Value, ShouldResemble, datapoint.NewIntValue(10))
+			So(a.Datapoints()[1].Value, ShouldResemble, datapoint.NewIntValue(5))
+			Convey("and start a new window", func() {
+				So(a.Flush(ctx), ShouldBeNil)
+				So(next.calls, ShouldEqual, 1)
+			})
+		})
+		Convey("should roll up gauges", func() {
+			for aggregation, expected := range map[GaugeAggregation]datapoint.Value{
+				AggregateMin: datapoint.NewFloatValue(1),
+				AggregateMax: datapoint.NewFloatValue(3),
+				AggregateAvg: datapoint.NewFloatValue(6.5 / 3),
+			} {
+				a.Gauges = aggregation
+				So(a.rollup(a.series[seriesKey(Gauge("load", host("a"), 0))]).Value, ShouldResemble, expected)
+			}
+			a.Gauges = AggregateMax
+			add(Gauge("ints", nil, 1), Gauge("ints", nil, 7))
+			So(a.rollup(a.series[seriesKey(Gauge("ints", nil, 0))]).Value, ShouldResemble, datapoint.NewIntValue(7))
+		})
+		Convey("should forward events and spans straight away", func() {
+			So(a.AddEvents(ctx, []*event.Event{event.New("e", event.USERDEFINED, nil, time.Time{})}), ShouldBeNil)
+			So(a.AddSpans(ctx, []*trace.Span{{ID: "s"}}), ShouldBeNil)
+			So(len(next.events), ShouldEqual, 1)
+			So(len(next.spans), ShouldEqual, 1)
+		})
+		Convey("should run until the context is done", func() {
+			clock := timekeepertest.NewStubClock(time.Now())
+			a.Timer = clock
+			errBad := errors.New("bad")
+			next.errs = []error{errBad}
+			handled := make(chan error, 1)
+			a.ErrorHandler = func(err error) error {
+				handled <- err
+				return nil
+			}
+			runCtx, cancel := context.WithCancel(ctx)
+			done := make(chan error)
+			go func() {
+				done <- a.Run(runCtx)
+			}()
+			for len(handled) == 0 {
+				clock.Incr(a.Window)
+				runtime.Gosched()
+			}
+			So(errors.Cause(<-handled), ShouldEqual, errBad)
+			add(Gauge("after", nil, 1))
+			cancel()
+			So(errors.Cause(<-done), ShouldEqual, context.Canceled)
+			So(next.points[len(next.points)-1].Metric, ShouldEqual, "after")
+		})
+		Convey("should stop running if the error handler says to", func() {
+			a.Timer = timekeepertest.NewStubClock(time.Now())
+			next.errs = []error{errors.New("bad")}
+			a.ErrorHandler = func(err error) error {
+				return err
+			}
+			done := make(chan error)
+			go func() {
+				done <- a.Run(ctx)
+			}()
+			for {
+				a.Timer.(*timekeepertest.StubClock).Incr(a.Window)
+				select {
+				case err := <-done:
+					So(err, ShouldNotBeNil)
+					return
+				default:
+					runtime.Gosched()
+				}
+			}
+		})
+	})
+}
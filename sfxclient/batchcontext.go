@@ -0,0 +1,49 @@
+package sfxclient
+
+import (
+	"context"
+)
+
+// batchContext is the context a worker emits a batch with.  It is done when the pipeline's drain context
+// is, and carries the values of the context the batch's items were added with, except their token, since
+// the batch is always sent with the token it was added with.
+type batchContext struct {
+	context.Context
+	values context.Context
+}
+
+// Value returns the value of key from the context the batch was added with, or else the drain context
+func (c batchContext) Value(key interface{}) interface{} {
+	if key != TokenCtxKey && key != TokenHeaderName {
+		if v := c.values.Value(key); v != nil {
+			return v
+		}
+	}
+	return c.Context.Value(key)
+}
+
+// newBatchContext returns the context to emit a batch added with added.  If propagateDeadline is set the
+// batch also has the deadline of added, and is cancelled when added is.
+func newBatchContext(drainCtx context.Context, added context.Context, propagateDeadline bool) (context.Context, context.CancelFunc) {
+	if added == nil {
+		return drainCtx, func() {}
+	}
+	ctx := context.Context(batchContext{Context: drainCtx, values: added})
+	if !propagateDeadline || added.Done() == nil {
+		return ctx, func() {}
+	}
+	var cancel context.CancelFunc
+	if deadline, ok := added.Deadline(); ok {
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	go func() {
+		select {
+		case <-added.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
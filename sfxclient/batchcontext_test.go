@@ -0,0 +1,137 @@
+package sfxclient
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type batchContextKey string
+
+func TestBatchContext(t *testing.T) {
+	Convey("A batch context", t, func() {
+		drainCtx, cancelDrain := context.WithCancel(context.Background())
+		defer cancelDrain()
+		added := context.WithValue(ContextWithToken(context.Background(), Token{Value: "abc"}), batchContextKey("trace"), "123")
+		Convey("should carry the values it was added with, except the token", func() {
+			ctx, cancel := newBatchContext(drainCtx, added, false)
+			defer cancel()
+			So(ctx.Value(batchContextKey("trace")), ShouldEqual, "123")
+			_, hasToken := TokenFromContext(ctx)
+			So(hasToken, ShouldBeFalse)
+		})
+		Convey("should be done with the pipeline's drain context", func() {
+			ctx, cancel := newBatchContext(drainCtx, added, false)
+			defer cancel()
+			cancelDrain()
+			<-ctx.Done()
+		})
+		Convey("should only propagate deadlines when asked to", func() {
+			addedCtx, cancelAdded := context.WithTimeout(added, time.Minute)
+			ctx, cancel := newBatchContext(drainCtx, addedCtx, false)
+			_, hasDeadline := ctx.Deadline()
+			So(hasDeadline, ShouldBeFalse)
+			cancel()
+			ctx, cancel = newBatchContext(drainCtx, addedCtx, true)
+			defer cancel()
+			deadline, hasDeadline := ctx.Deadline()
+			So(hasDeadline, ShouldBeTrue)
+			addedDeadline, _ := addedCtx.Deadline()
+			So(deadline, ShouldEqual, addedDeadline)
+			cancelAdded()
+			<-ctx.Done()
+		})
+		Convey("should be the drain context for empty batches", func() {
+			ctx, cancel := newBatchContext(drainCtx, nil, true)
+			defer cancel()
+			So(ctx, ShouldEqual, drainCtx)
+		})
+	})
+}
+
+func TestPipelineContextPropagation(t *testing.T) {
+	Convey("A pipeline should emit batches with the values they were added with", t, func() {
+		values := make(chan interface{}, 10)
+		p := NewPipeline(&PipelineConfig[string]{
+			Name:               "log",
+			NumChannels:        1,
+			NumDrainingThreads: 1,
+			Buffer:             10,
+			BatchSize:          10,
+			PropagateDeadline:  true,
+			ErrorHandler:       func(error) error { return nil },
+			NewEmitter: func() EmitFunc[string] {
+				return func(ctx context.Context, token Token, data []string) error {
+					if len(data) > 0 {
+						values <- ctx.Value(batchContextKey("trace"))
+						_, hasDeadline := ctx.Deadline()
+						values <- hasDeadline
+					}
+					return nil
+				}
+			},
+		})
+		ctx, cancel := context.WithTimeout(ContextWithToken(context.Background(), Token{Value: "abc"}), time.Minute)
+		defer cancel()
+		So(p.Add(context.WithValue(ctx, batchContextKey("trace"), "123"), []string{"a"}), ShouldBeNil)
+		So(<-values, ShouldEqual, "123")
+		So(<-values, ShouldBeTrue)
+		So(p.Close(time.Second), ShouldBeNil)
+	})
+}
+
+func TestPipelineBatchesByContext(t *testing.T) {
+	Convey("A pipeline should not batch items added with different contexts together", t, func() {
+		type batch struct {
+			data  []string
+			trace interface{}
+			err   error
+		}
+		gate := make(chan struct{})
+		batches := make(chan batch, 10)
+		p := NewPipeline(&PipelineConfig[string]{
+			Name:               "log",
+			NumChannels:        1,
+			NumDrainingThreads: 1,
+			Buffer:             10,
+			BatchSize:          10,
+			PropagateDeadline:  true,
+			ErrorHandler:       func(error) error { return nil },
+			NewEmitter: func() EmitFunc[string] {
+				return func(ctx context.Context, token Token, data []string) error {
+					if len(data) == 0 {
+						return nil
+					}
+					<-gate
+					batches <- batch{data: append([]string(nil), data...), trace: ctx.Value(batchContextKey("trace")), err: ctx.Err()}
+					return nil
+				}
+			},
+		})
+		token := Token{Value: "abc"}
+		// the worker holds the first item while items added with two other contexts queue up
+		So(p.AddWithToken(token, []string{"first"}), ShouldBeNil)
+		for len(p.channels[0].input) > 0 {
+			time.Sleep(time.Millisecond)
+		}
+		cancelled, cancel := context.WithCancel(ContextWithToken(context.Background(), token))
+		cancelled = context.WithValue(cancelled, batchContextKey("trace"), "1")
+		live := context.WithValue(ContextWithToken(context.Background(), token), batchContextKey("trace"), "2")
+		So(p.Add(cancelled, []string{"a"}), ShouldBeNil)
+		So(p.Add(live, []string{"b", "c"}), ShouldBeNil)
+		So(p.Add(live, []string{"d"}), ShouldBeNil)
+		cancel()
+		close(gate)
+		So((<-batches).data, ShouldResemble, []string{"first"})
+		first := <-batches
+		So(first.data, ShouldResemble, []string{"a"})
+		So(first.trace, ShouldEqual, "1")
+		second := <-batches
+		So(second.data, ShouldResemble, []string{"b", "c", "d"})
+		So(second.trace, ShouldEqual, "2")
+		So(second.err, ShouldBeNil)
+		So(p.Close(time.Second), ShouldBeNil)
+	})
+}
@@ -0,0 +1,118 @@
+package sfxclient
+
+import (
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/timekeeper"
+)
+
+// DefaultCardinalityWindow is how long a CardinalityGuard remembers series by default
+const DefaultCardinalityWindow = time.Hour
+
+// CardinalityGuard caps how many distinct series, a metric name and its dimensions, each token can send
+// over a window of time.  Datapoints of series past the limit are dropped, or passed to Overflow, so one
+// runaway dimension can't flood an account.  Series already seen in the window always pass.
+type CardinalityGuard struct {
+	// Limit is the most series a token can send each Window
+	Limit int
+	// Window is how long series are remembered before counting starts over
+	Window time.Duration
+	// Overflow is given the datapoints over the limit.  They are dropped if it is nil
+	Overflow func(token string, dps []*datapoint.Datapoint)
+	Timer    timekeeper.TimeKeeper
+
+	mu          sync.Mutex
+	windowStart time.Time
+	series      map[string]map[uint64]struct{}
+	rejected    map[string]int64
+}
+
+// NewCardinalityGuard creates a guard allowing limit series per token every DefaultCardinalityWindow
+func NewCardinalityGuard(limit int) *CardinalityGuard {
+	return &CardinalityGuard{
+		Limit:    limit,
+		Window:   DefaultCardinalityWindow,
+		Timer:    timekeeper.RealTime{},
+		series:   make(map[string]map[uint64]struct{}),
+		rejected: make(map[string]int64),
+	}
+}
+
+// Filter returns the datapoints token may send.  dps is returned unchanged when all of them may be sent.
+func (g *CardinalityGuard) Filter(token string, dps []*datapoint.Datapoint) []*datapoint.Datapoint {
+	var allowed, overflow []*datapoint.Datapoint
+	g.mu.Lock()
+	g.roll()
+	seen, exists := g.series[token]
+	if !exists {
+		seen = make(map[uint64]struct{})
+		g.series[token] = seen
+	}
+	for i, dp := range dps {
+		id := seriesID(dp)
+		if _, exists := seen[id]; !exists {
+			if len(seen) < g.Limit {
+				seen[id] = struct{}{}
+			} else {
+				if overflow == nil {
+					allowed = append(make([]*datapoint.Datapoint, 0, len(dps)), dps[:i]...)
+				}
+				overflow = append(overflow, dp)
+				continue
+			}
+		}
+		if overflow != nil {
+			allowed = append(allowed, dp)
+		}
+	}
+	g.rejected[token] += int64(len(overflow))
+	g.mu.Unlock()
+
+	if overflow == nil {
+		return dps
+	}
+	if g.Overflow != nil {
+		g.Overflow(token, overflow)
+	}
+	return allowed
+}
+
+// roll starts a new window when the current one is over
+func (g *CardinalityGuard) roll() {
+	now := g.Timer.Now()
+	if now.Sub(g.windowStart) < g.Window {
+		return
+	}
+	g.windowStart = now
+	g.series = make(map[string]map[uint64]struct{}, len(g.series))
+}
+
+// Datapoints returns the series each token sent this window and how many datapoints were over the limit
+func (g *CardinalityGuard) Datapoints() []*datapoint.Datapoint {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	dps := make([]*datapoint.Datapoint, 0, len(g.series)+len(g.rejected))
+	for token, seen := range g.series {
+		dps = append(dps, Gauge("series_by_token", map[string]string{"token": token}, int64(len(seen))))
+	}
+	for token, count := range g.rejected {
+		dps = append(dps, Cumulative("total_datapoints_over_cardinality_limit", map[string]string{"token": token}, count))
+	}
+	return dps
+}
+
+// seriesID hashes the metric name and sorted dimensions of dp
+func seriesID(dp *datapoint.Datapoint) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(dp.Metric))
+	datapoint.RangeSorted(dp.Dimensions, func(k, v string) {
+		_, _ = h.Write([]byte{0})
+		_, _ = h.Write([]byte(k))
+		_, _ = h.Write([]byte{0})
+		_, _ = h.Write([]byte(v))
+	})
+	return h.Sum64()
+}
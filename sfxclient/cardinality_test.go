@@ -0,0 +1,91 @@
+package sfxclient
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/timekeeper/timekeepertest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func seriesDatapoints(n int) []*datapoint.Datapoint {
+	dps := make([]*datapoint.Datapoint, 0, n)
+	for i := 0; i < n; i++ {
+		dps = append(dps, Gauge("requests", map[string]string{"host": "h" + strconv.Itoa(i)}, 1))
+	}
+	return dps
+}
+
+func TestCardinalityGuard(t *testing.T) {
+	Convey("A cardinality guard", t, func() {
+		clock := timekeepertest.NewStubClock(time.Now())
+		g := NewCardinalityGuard(3)
+		g.Timer = clock
+		var overflow []*datapoint.Datapoint
+		g.Overflow = func(token string, dps []*datapoint.Datapoint) {
+			So(token, ShouldEqual, "abc")
+			overflow = append(overflow, dps...)
+		}
+
+		Convey("should pass datapoints under the limit untouched", func() {
+			dps := seriesDatapoints(3)
+			So(g.Filter("abc", dps), ShouldResemble, dps)
+			So(g.Filter("abc", dps), ShouldResemble, dps)
+			So(overflow, ShouldBeEmpty)
+		})
+		Convey("should drop new series past the limit", func() {
+			dps := seriesDatapoints(5)
+			allowed := g.Filter("abc", dps)
+			So(allowed, ShouldResemble, dps[:3])
+			So(overflow, ShouldResemble, dps[3:])
+			Convey("but keep passing series it has seen", func() {
+				So(g.Filter("abc", []*datapoint.Datapoint{dps[4], dps[1]}), ShouldResemble, []*datapoint.Datapoint{dps[1]})
+			})
+			Convey("and count each token separately", func() {
+				g.Overflow = nil
+				So(len(g.Filter("def", dps)), ShouldEqual, 3)
+			})
+			Convey("and start over every window", func() {
+				clock.Incr(DefaultCardinalityWindow)
+				So(g.Filter("abc", dps[3:]), ShouldResemble, dps[3:])
+			})
+			Convey("and report what it has seen", func() {
+				stats := map[string]int64{}
+				for _, dp := range g.Datapoints() {
+					stats[dp.Metric+":"+dp.Dimensions["token"]] = dp.Value.(datapoint.IntValue).Int()
+				}
+				So(stats, ShouldResemble, map[string]int64{
+					"series_by_token:abc":                         3,
+					"total_datapoints_over_cardinality_limit:abc": 2,
+				})
+			})
+		})
+		Convey("should tell series apart by their dimensions", func() {
+			a := Gauge("m", map[string]string{"a": "bc"}, 1)
+			b := Gauge("m", map[string]string{"ab": "c"}, 1)
+			So(seriesID(a), ShouldNotEqual, seriesID(b))
+			So(seriesID(a), ShouldEqual, seriesID(Gauge("m", map[string]string{"a": "bc"}, 2)))
+		})
+	})
+}
+
+func TestAsyncMultiTokenSinkCardinalityGuard(t *testing.T) {
+	Convey("An AsyncMultiTokenSink with a cardinality guard", t, func() {
+		g := NewCardinalityGuard(1)
+		s := NewAsyncMultiTokenSink(1, 1, 5, 25, "", "", "", "", newDefaultHTTPClient, nil, 0, WithDatumTypes(DatapointDatum), WithCardinalityGuard(g))
+		s.ShutdownTimeout = time.Millisecond * 500
+		So(s.AddDatapointsWithToken("abc", seriesDatapoints(2)), ShouldBeNil)
+		So(s.AddDatapoints(ContextWithToken(context.Background(), Token{Value: "abc"}), seriesDatapoints(3)), ShouldBeNil)
+		So(s.Close(), ShouldBeNil)
+		var rejected int64
+		for _, dp := range s.Datapoints() {
+			if dp.Metric == "total_datapoints_over_cardinality_limit" {
+				rejected = dp.Value.(datapoint.IntValue).Int()
+			}
+		}
+		So(rejected, ShouldEqual, 3)
+	})
+}
@@ -0,0 +1,245 @@
+package sfxclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/timekeeper"
+)
+
+// BreakerState is the state of a CircuitBreaker
+type BreakerState int
+
+const (
+	// BreakerClosed lets every request through
+	BreakerClosed BreakerState = iota
+	// BreakerOpen fails every request fast with ErrCircuitOpen
+	BreakerOpen
+	// BreakerHalfOpen lets a few probe requests through to find out if ingest has recovered
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half_open"
+	}
+	return "unknown"
+}
+
+// ErrCircuitOpen is returned instead of sending a request while the circuit breaker is open
+var ErrCircuitOpen = errors.New("circuit breaker is open: ingest is failing")
+
+const (
+	// DefaultBreakerConsecutiveFailures is how many failed requests in a row open a CircuitBreaker by default
+	DefaultBreakerConsecutiveFailures = 5
+	// DefaultBreakerErrorRate is the share of failed requests in a window that opens a CircuitBreaker by default
+	DefaultBreakerErrorRate = 0.5
+	// DefaultBreakerMinRequests is how many requests a window needs before its error rate can open a
+	// CircuitBreaker by default
+	DefaultBreakerMinRequests = 20
+	// DefaultBreakerWindow is how long a CircuitBreaker measures the error rate over by default
+	DefaultBreakerWindow = time.Minute
+	// DefaultBreakerOpenDuration is how long a CircuitBreaker stays open before probing by default
+	DefaultBreakerOpenDuration = time.Second * 30
+	// DefaultBreakerHalfOpenProbes is how many probes must succeed to close a CircuitBreaker by default
+	DefaultBreakerHalfOpenProbes = 1
+)
+
+// CircuitBreaker makes a sink fail fast while ingest is down, instead of waiting out the full timeout on
+// every batch.  It opens after ConsecutiveFailures failed requests in a row, or once ErrorRate of at least
+// MinRequests requests in a Window fail.  After OpenDuration it lets HalfOpenProbes requests through at a
+// time, closing once that many succeed and opening again as soon as one fails.
+//
+// Only failures that say ingest is unhealthy count: transport errors, timeouts, 5xx responses and 429s.
+// A request the caller cancelled, or one ingest rejected for being invalid, doesn't.
+type CircuitBreaker struct {
+	ConsecutiveFailures int
+	ErrorRate           float64
+	MinRequests         int
+	Window              time.Duration
+	OpenDuration        time.Duration
+	HalfOpenProbes      int
+	// OnStateChange, when set, is called after every state transition
+	OnStateChange func(from, to BreakerState)
+	Timer         timekeeper.TimeKeeper
+
+	mu          sync.Mutex
+	state       BreakerState
+	consecutive int
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	probing     int
+	probed      int
+	transitions map[BreakerState]int64
+	rejected    int64
+}
+
+// NewCircuitBreaker creates a closed CircuitBreaker with the default thresholds
+func NewCircuitBreaker() *CircuitBreaker {
+	return &CircuitBreaker{
+		ConsecutiveFailures: DefaultBreakerConsecutiveFailures,
+		ErrorRate:           DefaultBreakerErrorRate,
+		MinRequests:         DefaultBreakerMinRequests,
+		Window:              DefaultBreakerWindow,
+		OpenDuration:        DefaultBreakerOpenDuration,
+		HalfOpenProbes:      DefaultBreakerHalfOpenProbes,
+		Timer:               timekeeper.RealTime{},
+		transitions:         make(map[BreakerState]int64),
+	}
+}
+
+// State is the breaker's current state
+func (b *CircuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Allow returns ErrCircuitOpen if a request can't be sent now.  Every nil return must be followed by a
+// call to Record with the request's outcome.
+func (b *CircuitBreaker) Allow() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	from := b.state
+	if b.state == BreakerOpen && !b.Timer.Now().Before(b.openedAt.Add(b.OpenDuration)) {
+		b.transition(BreakerHalfOpen)
+	}
+	err := b.admit()
+	to := b.state
+	b.mu.Unlock()
+	b.notify(from, to)
+	return err
+}
+
+// admit lets the request through unless the breaker is open, or half open with enough probes in flight
+func (b *CircuitBreaker) admit() error {
+	switch b.state {
+	case BreakerOpen:
+		b.rejected++
+		return ErrCircuitOpen
+	case BreakerHalfOpen:
+		if b.probing >= b.halfOpenProbes() {
+			b.rejected++
+			return ErrCircuitOpen
+		}
+		b.probing++
+	}
+	return nil
+}
+
+// Record the outcome of a request Allow let through
+func (b *CircuitBreaker) Record(failed bool) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	from := b.state
+	switch b.state {
+	case BreakerHalfOpen:
+		b.probing--
+		if failed {
+			b.open()
+		} else if b.probed++; b.probed >= b.halfOpenProbes() {
+			b.transition(BreakerClosed)
+		}
+	case BreakerClosed:
+		b.count(failed)
+		if b.tripped() {
+			b.open()
+		}
+	}
+	to := b.state
+	b.mu.Unlock()
+	b.notify(from, to)
+}
+
+// count adds a request to the consecutive failure count and the current window
+func (b *CircuitBreaker) count(failed bool) {
+	now := b.Timer.Now()
+	if b.Window > 0 && !now.Before(b.windowStart.Add(b.Window)) {
+		b.windowStart, b.requests, b.failures = now, 0, 0
+	}
+	b.requests++
+	if failed {
+		b.consecutive++
+		b.failures++
+	} else {
+		b.consecutive = 0
+	}
+}
+
+// tripped is true if either threshold has been crossed
+func (b *CircuitBreaker) tripped() bool {
+	if b.ConsecutiveFailures > 0 && b.consecutive >= b.ConsecutiveFailures {
+		return true
+	}
+	return b.ErrorRate > 0 && b.requests >= b.MinRequests && float64(b.failures)/float64(b.requests) >= b.ErrorRate
+}
+
+func (b *CircuitBreaker) open() {
+	b.openedAt = b.Timer.Now()
+	b.transition(BreakerOpen)
+}
+
+// transition moves the breaker to state, starting the new state's counts from scratch
+func (b *CircuitBreaker) transition(state BreakerState) {
+	b.state = state
+	b.consecutive, b.requests, b.failures = 0, 0, 0
+	b.windowStart = b.Timer.Now()
+	b.probing, b.probed = 0, 0
+	if b.transitions == nil {
+		b.transitions = make(map[BreakerState]int64)
+	}
+	b.transitions[state]++
+}
+
+func (b *CircuitBreaker) halfOpenProbes() int {
+	if b.HalfOpenProbes < 1 {
+		return 1
+	}
+	return b.HalfOpenProbes
+}
+
+// notify calls OnStateChange, outside the lock so the callback can use the breaker
+func (b *CircuitBreaker) notify(from, to BreakerState) {
+	if from != to && b.OnStateChange != nil {
+		b.OnStateChange(from, to)
+	}
+}
+
+// Datapoints returns the breaker's state, how many times it moved to each state and how many requests
+// it failed fast
+func (b *CircuitBreaker) Datapoints() []*datapoint.Datapoint {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	dps := []*datapoint.Datapoint{
+		Gauge("circuit_breaker_state", nil, int64(b.state)),
+		Cumulative("total_circuit_breaker_rejected", nil, b.rejected),
+	}
+	for _, state := range []BreakerState{BreakerClosed, BreakerOpen, BreakerHalfOpen} {
+		dps = append(dps, Cumulative("total_circuit_breaker_transitions", map[string]string{"state": state.String()}, b.transitions[state]))
+	}
+	return dps
+}
+
+// breakerFailure is true if a request that ended with resp, or err if it couldn't be sent, says ingest is
+// unhealthy, rather than that the caller gave up or the request was bad
+func breakerFailure(ctx context.Context, resp *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(ctx.Err(), context.Canceled)
+	}
+	return resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests
+}
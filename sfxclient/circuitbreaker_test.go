@@ -0,0 +1,145 @@
+package sfxclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/timekeeper/timekeepertest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	Convey("A circuit breaker", t, func() {
+		clock := timekeepertest.NewStubClock(time.Now())
+		b := NewCircuitBreaker()
+		b.Timer = clock
+		b.ConsecutiveFailures = 3
+		b.MinRequests = 10
+		var changes []string
+		b.OnStateChange = func(from, to BreakerState) {
+			changes = append(changes, from.String()+"->"+to.String())
+		}
+		request := func(failed bool) error {
+			if err := b.Allow(); err != nil {
+				return err
+			}
+			b.Record(failed)
+			return nil
+		}
+		open := func() {
+			for i := 0; i < 3; i++ {
+				So(request(true), ShouldBeNil)
+			}
+			So(b.State(), ShouldEqual, BreakerOpen)
+		}
+
+		Convey("should open after consecutive failures", func() {
+			So(request(true), ShouldBeNil)
+			So(request(true), ShouldBeNil)
+			So(request(false), ShouldBeNil)
+			So(b.State(), ShouldEqual, BreakerClosed)
+			open()
+			So(request(false), ShouldEqual, ErrCircuitOpen)
+			So(changes, ShouldResemble, []string{"closed->open"})
+		})
+		Convey("should open once the error rate is crossed", func() {
+			for i := 0; i < 10; i++ {
+				So(request(i%2 == 0), ShouldBeNil)
+			}
+			So(b.State(), ShouldEqual, BreakerOpen)
+		})
+		Convey("should measure the error rate per window", func() {
+			for i := 0; i < 9; i++ {
+				So(request(i%2 == 0), ShouldBeNil)
+			}
+			clock.Incr(b.Window)
+			So(request(true), ShouldBeNil)
+			So(b.State(), ShouldEqual, BreakerClosed)
+		})
+		Convey("once open", func() {
+			open()
+			Convey("should probe after OpenDuration", func() {
+				clock.Incr(b.OpenDuration)
+				So(b.Allow(), ShouldBeNil)
+				So(b.State(), ShouldEqual, BreakerHalfOpen)
+				So(b.Allow(), ShouldEqual, ErrCircuitOpen)
+				Convey("and close when the probe succeeds", func() {
+					b.Record(false)
+					So(b.State(), ShouldEqual, BreakerClosed)
+					So(changes, ShouldResemble, []string{"closed->open", "open->half_open", "half_open->closed"})
+				})
+				Convey("and open again when the probe fails", func() {
+					b.Record(true)
+					So(b.State(), ShouldEqual, BreakerOpen)
+					So(request(false), ShouldEqual, ErrCircuitOpen)
+				})
+			})
+			Convey("should need HalfOpenProbes successes to close", func() {
+				b.HalfOpenProbes = 2
+				clock.Incr(b.OpenDuration)
+				So(request(false), ShouldBeNil)
+				So(b.State(), ShouldEqual, BreakerHalfOpen)
+				So(request(false), ShouldBeNil)
+				So(b.State(), ShouldEqual, BreakerClosed)
+			})
+			Convey("should report its transitions", func() {
+				So(request(false), ShouldEqual, ErrCircuitOpen)
+				values := make(map[string]int64)
+				for _, dp := range b.Datapoints() {
+					key := dp.Metric
+					if state := dp.Dimensions["state"]; state != "" {
+						key += "." + state
+					}
+					values[key] = dp.Value.(datapoint.IntValue).Int()
+				}
+				So(values, ShouldResemble, map[string]int64{
+					"circuit_breaker_state":                       int64(BreakerOpen),
+					"total_circuit_breaker_rejected":              1,
+					"total_circuit_breaker_transitions.closed":    0,
+					"total_circuit_breaker_transitions.open":      1,
+					"total_circuit_breaker_transitions.half_open": 0,
+				})
+			})
+		})
+	})
+}
+
+func TestBreakerFailure(t *testing.T) {
+	Convey("Only unhealthy ingest should count as a breaker failure", t, func() {
+		ctx := context.Background()
+		So(breakerFailure(ctx, nil, errors.New("connection refused")), ShouldBeTrue)
+		So(breakerFailure(ctx, &http.Response{StatusCode: http.StatusServiceUnavailable}, nil), ShouldBeTrue)
+		So(breakerFailure(ctx, &http.Response{StatusCode: http.StatusTooManyRequests}, nil), ShouldBeTrue)
+		So(breakerFailure(ctx, &http.Response{StatusCode: http.StatusBadRequest}, nil), ShouldBeFalse)
+		So(breakerFailure(ctx, &http.Response{StatusCode: http.StatusOK}, nil), ShouldBeFalse)
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+		So(breakerFailure(cancelled, nil, context.Canceled), ShouldBeFalse)
+	})
+}
+
+func TestHTTPSinkCircuitBreaker(t *testing.T) {
+	Convey("An HTTPSink with a circuit breaker", t, func() {
+		var requests int64
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt64(&requests, 1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer server.Close()
+		breaker := NewCircuitBreaker()
+		breaker.ConsecutiveFailures = 2
+		sink := NewHTTPSink(WithCircuitBreaker(breaker))
+		sink.DatapointEndpoint = server.URL
+		points := []*datapoint.Datapoint{GaugeF("g", nil, 1)}
+		So(sink.AddDatapoints(context.Background(), points), ShouldNotBeNil)
+		So(sink.AddDatapoints(context.Background(), points), ShouldNotBeNil)
+		So(sink.AddDatapoints(context.Background(), points), ShouldEqual, ErrCircuitOpen)
+		So(atomic.LoadInt64(&requests), ShouldEqual, 2)
+	})
+}
@@ -0,0 +1,180 @@
+// Package collectd accepts the JSON collectd's write_http plugin posts, turning values into datapoints and
+// notifications into events, for hosts still running collectd.
+package collectd
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/errors"
+	"github.com/signalfx/golib/v3/event"
+)
+
+// Record is one element of a write_http JSON post.  Value lists have Values, DSTypes and DSNames while
+// notifications have Severity and Message.
+type Record struct {
+	Values         []*float64 `json:"values"`
+	DSTypes        []string   `json:"dstypes"`
+	DSNames        []string   `json:"dsnames"`
+	Time           float64    `json:"time"`
+	Interval       float64    `json:"interval"`
+	Host           string     `json:"host"`
+	Plugin         string     `json:"plugin"`
+	PluginInstance string     `json:"plugin_instance"`
+	Type           string     `json:"type"`
+	TypeInstance   string     `json:"type_instance"`
+	Severity       string     `json:"severity"`
+	Message        string     `json:"message"`
+}
+
+// IsNotification is true if the record is a notification rather than values
+func (r *Record) IsNotification() bool {
+	return r.Severity != "" || r.Message != ""
+}
+
+// dsTypes maps collectd data source types to metric types
+var dsTypes = map[string]datapoint.MetricType{
+	"gauge":    datapoint.Gauge,
+	"derive":   datapoint.Counter,
+	"counter":  datapoint.Counter,
+	"absolute": datapoint.Count,
+}
+
+// Decode reads a write_http JSON post
+func Decode(r io.Reader) ([]*datapoint.Datapoint, []*event.Event, error) {
+	var records []*Record
+	if err := json.NewDecoder(r).Decode(&records); err != nil {
+		return nil, nil, errors.Annotate(err, "invalid collectd JSON")
+	}
+	var dps []*datapoint.Datapoint
+	var evs []*event.Event
+	for _, rec := range records {
+		if rec == nil {
+			continue
+		}
+		if rec.IsNotification() {
+			evs = append(evs, rec.Event())
+			continue
+		}
+		recDps, err := rec.Datapoints()
+		if err != nil {
+			return nil, nil, err
+		}
+		dps = append(dps, recDps...)
+	}
+	return dps, evs, nil
+}
+
+// Datapoints converts the record's values.  The metric is the type, then the type instance and, when the
+// type has more than one data source or its data source isn't called value, the data source name, joined
+// by dots.  The host, plugin and plugin instance become dimensions, along with any [key=value,...]
+// dimensions embedded in the host or plugin instance.  Null values are skipped.
+func (r *Record) Datapoints() ([]*datapoint.Datapoint, error) {
+	if len(r.Values) != len(r.DSTypes) || len(r.Values) != len(r.DSNames) {
+		return nil, errors.Errorf("%s has %d values, %d dstypes and %d dsnames", r.Type, len(r.Values), len(r.DSTypes), len(r.DSNames))
+	}
+	dims := r.dimensions()
+	ts := fromEpoch(r.Time)
+	dps := make([]*datapoint.Datapoint, 0, len(r.Values))
+	for i, v := range r.Values {
+		if v == nil || math.IsNaN(*v) || math.IsInf(*v, 0) {
+			continue
+		}
+		mt, exists := dsTypes[r.DSTypes[i]]
+		if !exists {
+			return nil, errors.Errorf("%s has unknown dstype %q", r.Type, r.DSTypes[i])
+		}
+		dps = append(dps, datapoint.New(r.metricName(r.DSNames[i]), dims, value(*v), mt, ts))
+	}
+	return dps, nil
+}
+
+func (r *Record) metricName(dsName string) string {
+	name := r.Type
+	if r.TypeInstance != "" {
+		name += "." + r.TypeInstance
+	}
+	if len(r.DSNames) > 1 || dsName != "value" {
+		name += "." + dsName
+	}
+	return name
+}
+
+// Event converts a notification into a collectd event of the notification's type, with its message and
+// severity as properties
+func (r *Record) Event() *event.Event {
+	dims := r.dimensions()
+	if r.Type != "" {
+		dims["type"] = r.Type
+	}
+	if r.TypeInstance != "" {
+		dims["type_instance"] = r.TypeInstance
+	}
+	eventType := r.Type
+	if eventType == "" {
+		eventType = "collectd_notification"
+	}
+	props := map[string]interface{}{
+		"message":  r.Message,
+		"severity": r.Severity,
+	}
+	return event.NewWithProperties(eventType, event.COLLECTD, dims, props, fromEpoch(r.Time))
+}
+
+func (r *Record) dimensions() map[string]string {
+	dims := make(map[string]string, 3)
+	host, hostDims := parseDimensions(r.Host)
+	pluginInstance, pluginDims := parseDimensions(r.PluginInstance)
+	for k, v := range hostDims {
+		dims[k] = v
+	}
+	for k, v := range pluginDims {
+		dims[k] = v
+	}
+	if host != "" {
+		dims["host"] = host
+	}
+	if r.Plugin != "" {
+		dims["plugin"] = r.Plugin
+	}
+	if pluginInstance != "" {
+		dims["plugin_instance"] = pluginInstance
+	}
+	return dims
+}
+
+// parseDimensions splits "name[k1=v1,k2=v2]" into name and its dimensions
+func parseDimensions(s string) (string, map[string]string) {
+	start := strings.IndexByte(s, '[')
+	end := strings.LastIndexByte(s, ']')
+	if start < 0 || end < start {
+		return s, nil
+	}
+	dims := make(map[string]string)
+	for _, pair := range strings.Split(s[start+1:end], ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) == 2 && kv[0] != "" && kv[1] != "" {
+			dims[kv[0]] = kv[1]
+		}
+	}
+	return s[:start] + s[end+1:], dims
+}
+
+func value(v float64) datapoint.Value {
+	if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+		return datapoint.NewIntValue(int64(v))
+	}
+	return datapoint.NewFloatValue(v)
+}
+
+// fromEpoch converts collectd's fractional seconds, where zero means unset
+func fromEpoch(secs float64) time.Time {
+	if secs <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(secs*float64(time.Second)))
+}
@@ -0,0 +1,69 @@
+package collectd
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/event"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const post = `[
+ {"values": [197141504, 175136768], "dstypes": ["derive", "derive"], "dsnames": ["read", "write"],
+  "time": 1251533299.5, "interval": 10, "host": "leeloo", "plugin": "disk", "plugin_instance": "sda",
+  "type": "disk_octets", "type_instance": ""},
+ {"values": [0.5, null], "dstypes": ["gauge", "gauge"], "dsnames": ["value", "other"], "time": 1251533299,
+  "host": "leeloo[env=prod,bad]", "plugin": "cpu", "plugin_instance": "0[core=a]", "type": "cpu", "type_instance": "idle"},
+ {"values": [3], "dstypes": ["absolute"], "dsnames": ["value"], "time": 0, "host": "h", "plugin": "p", "type": "requests"},
+ null,
+ {"time": 1251533299, "severity": "failure", "message": "disk full", "host": "leeloo", "plugin": "df",
+  "type": "df_complex", "type_instance": "free"},
+ {"severity": "okay", "host": "leeloo"}
+]`
+
+func TestDecode(t *testing.T) {
+	Convey("decoding a write_http post", t, func() {
+		dps, evs, err := Decode(strings.NewReader(post))
+		So(err, ShouldBeNil)
+		So(len(dps), ShouldEqual, 4)
+		So(len(evs), ShouldEqual, 2)
+		Convey("should name metrics after the type and data source", func() {
+			So(dps[0].Metric, ShouldEqual, "disk_octets.read")
+			So(dps[0].Value, ShouldResemble, datapoint.NewIntValue(197141504))
+			So(dps[0].MetricType, ShouldEqual, datapoint.Counter)
+			So(dps[0].Dimensions, ShouldResemble, map[string]string{"host": "leeloo", "plugin": "disk", "plugin_instance": "sda"})
+			So(dps[0].Timestamp.Equal(time.Unix(1251533299, int64(time.Second/2))), ShouldBeTrue)
+			So(dps[1].Metric, ShouldEqual, "disk_octets.write")
+			So(dps[2].Metric, ShouldEqual, "cpu.idle.value")
+			So(dps[3].Metric, ShouldEqual, "requests")
+			So(dps[3].MetricType, ShouldEqual, datapoint.Count)
+			So(dps[3].Timestamp.IsZero(), ShouldBeTrue)
+		})
+		Convey("should pull dimensions out of the host and plugin instance", func() {
+			So(dps[2].Value, ShouldResemble, datapoint.NewFloatValue(0.5))
+			So(dps[2].MetricType, ShouldEqual, datapoint.Gauge)
+			So(dps[2].Dimensions, ShouldResemble, map[string]string{"host": "leeloo", "env": "prod", "plugin": "cpu", "plugin_instance": "0", "core": "a"})
+		})
+		Convey("should turn notifications into events", func() {
+			So(evs[0].EventType, ShouldEqual, "df_complex")
+			So(evs[0].Category, ShouldEqual, event.COLLECTD)
+			So(evs[0].Dimensions, ShouldResemble, map[string]string{"host": "leeloo", "plugin": "df", "type": "df_complex", "type_instance": "free"})
+			So(evs[0].Properties, ShouldResemble, map[string]interface{}{"message": "disk full", "severity": "failure"})
+			So(evs[0].Timestamp.Equal(time.Unix(1251533299, 0)), ShouldBeTrue)
+			So(evs[1].EventType, ShouldEqual, "collectd_notification")
+		})
+	})
+	Convey("decoding bad posts should fail", t, func() {
+		for _, body := range []string{
+			`{`,
+			`{}`,
+			`[{"values": [1], "dstypes": [], "dsnames": ["value"], "type": "a"}]`,
+			`[{"values": [1], "dstypes": ["weird"], "dsnames": ["value"], "type": "a"}]`,
+		} {
+			_, _, err := Decode(strings.NewReader(body))
+			So(err, ShouldNotBeNil)
+		}
+	})
+}
@@ -0,0 +1,86 @@
+package collectd
+
+import (
+	"io"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/datapoint/dpsink"
+	"github.com/signalfx/golib/v3/errors"
+	"github.com/signalfx/golib/v3/sfxclient"
+)
+
+// DefaultMaxBodyBytes is the largest post a Handler accepts by default
+const DefaultMaxBodyBytes = 10 << 20
+
+// Handler is an http.Handler for collectd's write_http plugin that forwards what it is posted to a Sink.
+// A token sent in the X-Sf-Token header is forwarded with the datapoints and events.
+type Handler struct {
+	Sink dpsink.Sink
+	// MaxBodyBytes is the largest post accepted
+	MaxBodyBytes int64
+
+	stats struct {
+		requests   int64
+		errors     int64
+		datapoints int64
+		events     int64
+	}
+}
+
+var _ http.Handler = &Handler{}
+var _ sfxclient.Collector = &Handler{}
+
+// NewHandler creates a handler forwarding to sink
+func NewHandler(sink dpsink.Sink) *Handler {
+	return &Handler{
+		Sink:         sink,
+		MaxBodyBytes: DefaultMaxBodyBytes,
+	}
+}
+
+func (h *Handler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	atomic.AddInt64(&h.stats.requests, 1)
+	if status, err := h.serve(req); err != nil {
+		atomic.AddInt64(&h.stats.errors, 1)
+		http.Error(rw, err.Error(), status)
+		return
+	}
+	_, _ = rw.Write([]byte(`"OK"`))
+}
+
+// serve forwards what req posted, returning the status to respond with when it fails
+func (h *Handler) serve(req *http.Request) (int, error) {
+	ctx := req.Context()
+	if token := req.Header.Get(sfxclient.TokenHeaderName); token != "" {
+		ctx = sfxclient.ContextWithToken(ctx, sfxclient.Token{Value: token})
+	}
+	dps, evs, err := Decode(io.LimitReader(req.Body, h.MaxBodyBytes))
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	if len(dps) > 0 {
+		if err := h.Sink.AddDatapoints(ctx, dps); err != nil {
+			return http.StatusInternalServerError, errors.Annotate(err, "cannot forward datapoints")
+		}
+		atomic.AddInt64(&h.stats.datapoints, int64(len(dps)))
+	}
+	if len(evs) > 0 {
+		if err := h.Sink.AddEvents(ctx, evs); err != nil {
+			return http.StatusInternalServerError, errors.Annotate(err, "cannot forward events")
+		}
+		atomic.AddInt64(&h.stats.events, int64(len(evs)))
+	}
+	return http.StatusOK, nil
+}
+
+// Datapoints returns stats about the handler
+func (h *Handler) Datapoints() []*datapoint.Datapoint {
+	return []*datapoint.Datapoint{
+		sfxclient.Cumulative("total_collectd_requests", nil, atomic.LoadInt64(&h.stats.requests)),
+		sfxclient.Cumulative("total_collectd_errors", nil, atomic.LoadInt64(&h.stats.errors)),
+		sfxclient.Cumulative("total_collectd_datapoints", nil, atomic.LoadInt64(&h.stats.datapoints)),
+		sfxclient.Cumulative("total_collectd_events", nil, atomic.LoadInt64(&h.stats.events)),
+	}
+}
@@ -0,0 +1,73 @@
+package collectd
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/event"
+	"github.com/signalfx/golib/v3/sfxclient"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type captureSink struct {
+	dps   []*datapoint.Datapoint
+	evs   []*event.Event
+	token sfxclient.Token
+	dpErr error
+	evErr error
+}
+
+func (c *captureSink) AddDatapoints(ctx context.Context, points []*datapoint.Datapoint) error {
+	c.token, _ = sfxclient.TokenFromContext(ctx)
+	c.dps = append(c.dps, points...)
+	return c.dpErr
+}
+
+func (c *captureSink) AddEvents(ctx context.Context, events []*event.Event) error {
+	c.evs = append(c.evs, events...)
+	return c.evErr
+}
+
+func TestHandler(t *testing.T) {
+	Convey("a collectd handler", t, func() {
+		sink := &captureSink{}
+		h := NewHandler(sink)
+		serve := func(body string) *httptest.ResponseRecorder {
+			rw := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/post-collectd", strings.NewReader(body))
+			req.Header.Set(sfxclient.TokenHeaderName, "abc")
+			h.ServeHTTP(rw, req)
+			return rw
+		}
+		Convey("should forward datapoints and events with the request's token", func() {
+			rw := serve(post)
+			So(rw.Code, ShouldEqual, http.StatusOK)
+			So(rw.Body.String(), ShouldEqual, `"OK"`)
+			So(len(sink.dps), ShouldEqual, 4)
+			So(len(sink.evs), ShouldEqual, 2)
+			So(sink.token.Value, ShouldEqual, "abc")
+			stats := h.Datapoints()
+			So(stats[0].Value, ShouldResemble, datapoint.NewIntValue(1))
+			So(stats[2].Value, ShouldResemble, datapoint.NewIntValue(4))
+			So(stats[3].Value, ShouldResemble, datapoint.NewIntValue(2))
+		})
+		Convey("should reject bad posts", func() {
+			So(serve(`{`).Code, ShouldEqual, http.StatusBadRequest)
+			h.MaxBodyBytes = 10
+			So(serve(post).Code, ShouldEqual, http.StatusBadRequest)
+			So(h.Datapoints()[1].Value, ShouldResemble, datapoint.NewIntValue(2))
+		})
+		Convey("should report sink failures", func() {
+			sink.dpErr = errors.New("nope")
+			So(serve(post).Code, ShouldEqual, http.StatusInternalServerError)
+			sink.dpErr = nil
+			sink.evErr = errors.New("nope")
+			So(serve(post).Code, ShouldEqual, http.StatusInternalServerError)
+		})
+	})
+}
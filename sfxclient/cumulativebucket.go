@@ -2,7 +2,9 @@ package sfxclient
 
 import (
 	"math"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/signalfx/golib/v3/datapoint"
 )
@@ -50,6 +52,10 @@ type CumulativeBucket struct {
 	count        int64
 	sum          int64
 	sumOfSquares atomicFloat
+
+	exemplarMu sync.Mutex
+	// exemplar is the last value added with an exemplar since the last report
+	exemplar *Exemplar
 }
 
 var _ Collector = &CumulativeBucket{}
@@ -61,6 +67,16 @@ func (b *CumulativeBucket) Add(val int64) {
 	b.MultiAdd(r)
 }
 
+// AddWithExemplar is like Add, but the value was observed in the span spanID of the trace traceID.  The
+// next report's count and sum are sent with the exemplar of the last such value.
+func (b *CumulativeBucket) AddWithExemplar(val int64, traceID string, spanID string) {
+	b.Add(val)
+	e := &Exemplar{TraceID: traceID, SpanID: spanID, Value: float64(val), Timestamp: time.Now()}
+	b.exemplarMu.Lock()
+	b.exemplar = e
+	b.exemplarMu.Unlock()
+}
+
 // MultiAdd many items into the bucket at once using a Result.  This can be more efficient as it
 // involves only a constant number of atomic operations.
 func (b *CumulativeBucket) MultiAdd(res *Result) {
@@ -77,9 +93,18 @@ func (b *CumulativeBucket) Datapoints() []*datapoint.Datapoint {
 	if b.MetricName == "" {
 		return []*datapoint.Datapoint{}
 	}
-	return []*datapoint.Datapoint{
+	ret := []*datapoint.Datapoint{
 		CumulativeP(b.MetricName+".count", b.Dimensions, &b.count),
 		CumulativeP(b.MetricName+".sum", b.Dimensions, &b.sum),
 		CumulativeF(b.MetricName+".sumsquare", b.Dimensions, b.sumOfSquares.Get()),
 	}
+	b.exemplarMu.Lock()
+	e := b.exemplar
+	b.exemplar = nil
+	b.exemplarMu.Unlock()
+	if e != nil {
+		AddExemplars(ret[0], *e)
+		AddExemplars(ret[1], *e)
+	}
+	return ret
 }
@@ -74,6 +74,18 @@ func TestCumulativeBucket(t *testing.T) {
 				So(dpNamed("mname.count", dps).Value.String(), ShouldEqual, "3")
 				So(dpNamed("mname.sumsquare", dps).Value.String(), ShouldEqual, "10041")
 			})
+			Convey("and attach the last exemplar once", func() {
+				cb.AddWithExemplar(5, "fa281a8955571a3a", "acdfec5be6328c3a")
+				cb.AddWithExemplar(7, "fa281a8955571a3a", "bcdfec5be6328c3a")
+				dps := cb.Datapoints()
+				exemplars := Exemplars(dpNamed("mname.sum", dps))
+				So(len(exemplars), ShouldEqual, 1)
+				So(exemplars[0].SpanID, ShouldEqual, "bcdfec5be6328c3a")
+				So(exemplars[0].Value, ShouldEqual, 7)
+				So(Exemplars(dpNamed("mname.count", dps)), ShouldResemble, exemplars)
+				So(Exemplars(dpNamed("mname.sumsquare", dps)), ShouldBeNil)
+				So(Exemplars(dpNamed("mname.sum", cb.Datapoints())), ShouldBeNil)
+			})
 			Convey("zero multiadd should do nothing", func() {
 				cb.MultiAdd(&Result{})
 				dps := cb.Datapoints()
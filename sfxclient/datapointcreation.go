@@ -37,3 +37,9 @@ func CumulativeP(metricName string, dimensions map[string]string, val *int64) *d
 func Counter(metricName string, dimensions map[string]string, val int64) *datapoint.Datapoint {
 	return datapoint.New(metricName, dimensions, datapoint.NewIntValue(val), datapoint.Count, time.Time{})
 }
+
+// Histogram creates a SignalFx cumulative histogram.  HTTPSink sends it as an OTLP histogram, or as the
+// _bucket, _count and _sum cumulative counters SignalFx protobuf has instead.
+func Histogram(metricName string, dimensions map[string]string, val datapoint.HistogramValue) *datapoint.Datapoint {
+	return datapoint.New(metricName, dimensions, val, datapoint.Counter, time.Time{})
+}
@@ -0,0 +1,45 @@
+package sfxclient
+
+import (
+	"database/sql"
+
+	"github.com/signalfx/golib/v3/datapoint"
+)
+
+// DBStatsCollector is a Collector of the connection pool stats of a database: how many connections are
+// open, in use and idle, and how often and for how long callers waited for one
+type DBStatsCollector struct {
+	// Dimensions are added to every datapoint, along with a db dimension naming the database
+	Dimensions map[string]string
+
+	db   *sql.DB
+	name string
+}
+
+var _ Collector = &DBStatsCollector{}
+
+// NewDBStatsCollector creates a Collector of the connection pool stats of db, reported with the dimension
+// db set to dbName
+func NewDBStatsCollector(db *sql.DB, dbName string) *DBStatsCollector {
+	return &DBStatsCollector{
+		db:   db,
+		name: dbName,
+	}
+}
+
+// Datapoints returns the current stats of the connection pool
+func (d *DBStatsCollector) Datapoints() []*datapoint.Datapoint {
+	stats := d.db.Stats()
+	dims := datapoint.AddMaps(d.Dimensions, map[string]string{"db": d.name})
+	return []*datapoint.Datapoint{
+		Gauge("db.max_open_connections", dims, int64(stats.MaxOpenConnections)),
+		Gauge("db.open_connections", dims, int64(stats.OpenConnections)),
+		Gauge("db.in_use_connections", dims, int64(stats.InUse)),
+		Gauge("db.idle_connections", dims, int64(stats.Idle)),
+		Cumulative("db.total_waits", dims, stats.WaitCount),
+		Cumulative("db.total_wait_time_ns", dims, stats.WaitDuration.Nanoseconds()),
+		Cumulative("db.total_closed_max_idle", dims, stats.MaxIdleClosed),
+		Cumulative("db.total_closed_max_idle_time", dims, stats.MaxIdleTimeClosed),
+		Cumulative("db.total_closed_max_lifetime", dims, stats.MaxLifetimeClosed),
+	}
+}
@@ -0,0 +1,65 @@
+package sfxclient
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// nopConnector opens connections that can't do anything but be pooled
+type nopConnector struct{}
+
+func (nopConnector) Connect(context.Context) (driver.Conn, error) {
+	return nopConn{}, nil
+}
+
+func (nopConnector) Driver() driver.Driver {
+	return nil
+}
+
+type nopConn struct{}
+
+func (nopConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+
+func (nopConn) Close() error {
+	return nil
+}
+
+func (nopConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("not supported")
+}
+
+func TestDBStatsCollector(t *testing.T) {
+	Convey("a db stats collector", t, func() {
+		db := sql.OpenDB(nopConnector{})
+		defer func() {
+			So(db.Close(), ShouldBeNil)
+		}()
+		db.SetMaxOpenConns(3)
+		c := NewDBStatsCollector(db, "users")
+		c.Dimensions = map[string]string{"app": "test"}
+		Convey("should report the connection pool", func() {
+			conn, err := db.Conn(context.Background())
+			So(err, ShouldBeNil)
+			idle, err := db.Conn(context.Background())
+			So(err, ShouldBeNil)
+			So(idle.Close(), ShouldBeNil)
+			dps := c.Datapoints()
+			So(len(dps), ShouldEqual, 9)
+			So(dpNamed("db.max_open_connections", dps).Value, ShouldResemble, datapoint.NewIntValue(3))
+			So(dpNamed("db.open_connections", dps).Value, ShouldResemble, datapoint.NewIntValue(2))
+			So(dpNamed("db.in_use_connections", dps).Value, ShouldResemble, datapoint.NewIntValue(1))
+			So(dpNamed("db.idle_connections", dps).Value, ShouldResemble, datapoint.NewIntValue(1))
+			So(dpNamed("db.total_waits", dps).MetricType, ShouldEqual, datapoint.Counter)
+			So(dpNamed("db.idle_connections", dps).Dimensions, ShouldResemble, map[string]string{"app": "test", "db": "users"})
+			So(conn.Close(), ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,165 @@
+// Package decoder decodes SignalFx datapoint, event and span payloads from untrusted clients.  Every
+// decoder enforces Limits on the size and shape of its input before and while decoding it, so a hostile
+// payload can't make an ingest handler allocate unbounded memory or recurse without limit.
+package decoder
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/signalfx/golib/v3/errors"
+)
+
+// Limits bound the input a Decoder accepts.  Zero fields use the value from DefaultLimits.
+type Limits struct {
+	// MaxBodyBytes is the most bytes read from the input
+	MaxBodyBytes int
+	// MaxItems is the most datapoints, events or spans in one input
+	MaxItems int
+	// MaxStringLength is the longest string, or JSON number, in the input: metric names, dimension keys and
+	// values, property values and so on
+	MaxStringLength int
+	// MaxDimensions is the most dimensions, properties, tags or annotations an item can have
+	MaxDimensions int
+	// MaxDepth is the deepest JSON nesting allowed
+	MaxDepth int
+}
+
+// DefaultLimits are generous limits for payloads from well behaved clients
+var DefaultLimits = Limits{
+	MaxBodyBytes:    10 << 20,
+	MaxItems:        100000,
+	MaxStringLength: 4096,
+	MaxDimensions:   128,
+	MaxDepth:        16,
+}
+
+// LimitError is returned when the input exceeds one of the Limits
+type LimitError struct {
+	// Limit is the name of the Limits field that was exceeded
+	Limit string
+	Max   int
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("input exceeds %s of %d", e.Limit, e.Max)
+}
+
+// Decoder decodes datapoints, events and spans, refusing input that exceeds its Limits.  The zero value
+// uses DefaultLimits.
+type Decoder struct {
+	Limits Limits
+}
+
+// limits returns the decoder's limits with defaults filled in
+func (d *Decoder) limits() Limits {
+	l := d.Limits
+	if l.MaxBodyBytes <= 0 {
+		l.MaxBodyBytes = DefaultLimits.MaxBodyBytes
+	}
+	if l.MaxItems <= 0 {
+		l.MaxItems = DefaultLimits.MaxItems
+	}
+	if l.MaxStringLength <= 0 {
+		l.MaxStringLength = DefaultLimits.MaxStringLength
+	}
+	if l.MaxDimensions <= 0 {
+		l.MaxDimensions = DefaultLimits.MaxDimensions
+	}
+	if l.MaxDepth <= 0 {
+		l.MaxDepth = DefaultLimits.MaxDepth
+	}
+	return l
+}
+
+// readBody reads at most MaxBodyBytes from r
+func (l Limits) readBody(r io.Reader) ([]byte, error) {
+	b, err := ioutil.ReadAll(io.LimitReader(r, int64(l.MaxBodyBytes)+1))
+	if err != nil {
+		return nil, errors.Annotate(err, "cannot read input")
+	}
+	if len(b) > l.MaxBodyBytes {
+		return nil, &LimitError{Limit: "MaxBodyBytes", Max: l.MaxBodyBytes}
+	}
+	return b, nil
+}
+
+func (l Limits) checkItems(n int) error {
+	if n > l.MaxItems {
+		return &LimitError{Limit: "MaxItems", Max: l.MaxItems}
+	}
+	return nil
+}
+
+func (l Limits) checkDimensions(n int) error {
+	if n > l.MaxDimensions {
+		return &LimitError{Limit: "MaxDimensions", Max: l.MaxDimensions}
+	}
+	return nil
+}
+
+func (l Limits) checkString(s string) error {
+	if len(s) > l.MaxStringLength {
+		return &LimitError{Limit: "MaxStringLength", Max: l.MaxStringLength}
+	}
+	return nil
+}
+
+// checkJSON streams through the tokens of b, enforcing MaxDepth and MaxStringLength before anything is
+// decoded into structs
+func (l Limits) checkJSON(b []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	depth := 0
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF && depth == 0 {
+			return nil
+		}
+		if err != nil {
+			return errors.Annotate(err, "invalid JSON")
+		}
+		switch t := tok.(type) {
+		case json.Delim:
+			if t == '{' || t == '[' {
+				depth++
+				if depth > l.MaxDepth {
+					return &LimitError{Limit: "MaxDepth", Max: l.MaxDepth}
+				}
+			} else {
+				depth--
+			}
+		case string:
+			if err := l.checkString(t); err != nil {
+				return err
+			}
+		case json.Number:
+			if err := l.checkString(t.String()); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// decodeJSON checks then decodes the JSON in r into v
+func (l Limits) decodeJSON(r io.Reader, v interface{}) error {
+	b, err := l.readBody(r)
+	if err != nil {
+		return err
+	}
+	if err := l.checkJSON(b); err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return errors.Annotate(err, "cannot decode JSON")
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return errors.New("unexpected data after JSON")
+	}
+	return nil
+}
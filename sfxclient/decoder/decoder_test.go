@@ -0,0 +1,46 @@
+package decoder
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLimits(t *testing.T) {
+	Convey("a decoder's limits", t, func() {
+		Convey("should default zero fields", func() {
+			d := &Decoder{Limits: Limits{MaxItems: 5}}
+			l := d.limits()
+			So(l.MaxItems, ShouldEqual, 5)
+			So(l.MaxBodyBytes, ShouldEqual, DefaultLimits.MaxBodyBytes)
+			So(l.MaxDepth, ShouldEqual, DefaultLimits.MaxDepth)
+		})
+		l := (&Decoder{Limits: Limits{MaxBodyBytes: 10, MaxStringLength: 3, MaxDepth: 2}}).limits()
+		Convey("should bound the body", func() {
+			_, err := l.readBody(strings.NewReader("0123456789"))
+			So(err, ShouldBeNil)
+			_, err = l.readBody(strings.NewReader("0123456789a"))
+			So(err, ShouldResemble, &LimitError{Limit: "MaxBodyBytes", Max: 10})
+			So(err.Error(), ShouldEqual, "input exceeds MaxBodyBytes of 10")
+			_, err = l.readBody(iotest.ErrReader(errors.New("nope")))
+			So(err.Error(), ShouldContainSubstring, "nope")
+		})
+		Convey("should bound JSON depth and string length", func() {
+			So(l.checkJSON([]byte(`[[1]]`)), ShouldBeNil)
+			So(l.checkJSON([]byte(`[[[1]]]`)), ShouldResemble, &LimitError{Limit: "MaxDepth", Max: 2})
+			So(l.checkJSON([]byte(`["abcd"]`)), ShouldResemble, &LimitError{Limit: "MaxStringLength", Max: 3})
+			So(l.checkJSON([]byte(`[1234]`)), ShouldResemble, &LimitError{Limit: "MaxStringLength", Max: 3})
+			So(l.checkJSON([]byte(`[1,`)), ShouldNotBeNil)
+		})
+		Convey("should refuse trailing data", func() {
+			var v []int
+			So(l.decodeJSON(bytes.NewReader([]byte(`[1] [2]`)), &v), ShouldNotBeNil)
+			So(l.decodeJSON(bytes.NewReader([]byte(`[1] `)), &v), ShouldBeNil)
+			So(l.decodeJSON(bytes.NewReader([]byte(`{"a":1}`)), &v), ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,119 @@
+package decoder
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	sfxmodel "github.com/signalfx/com_signalfx_metrics_protobuf/model"
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/event"
+)
+
+// fuzzLimits are small so the fuzzer finds the edges of every limit quickly
+var fuzzLimits = Limits{MaxBodyBytes: 4096, MaxItems: 8, MaxStringLength: 32, MaxDimensions: 4, MaxDepth: 4}
+
+func checkDatapoints(t *testing.T, dps []*datapoint.Datapoint, err error) {
+	if err != nil {
+		return
+	}
+	if len(dps) > fuzzLimits.MaxItems {
+		t.Fatalf("%d datapoints is over the limit", len(dps))
+	}
+	for _, dp := range dps {
+		if len(dp.Metric) > fuzzLimits.MaxStringLength || len(dp.Dimensions) > fuzzLimits.MaxDimensions {
+			t.Fatalf("datapoint %v is over the limits", dp)
+		}
+	}
+}
+
+func checkEvents(t *testing.T, evs []*event.Event, err error) {
+	if err != nil {
+		return
+	}
+	if len(evs) > fuzzLimits.MaxItems {
+		t.Fatalf("%d events is over the limit", len(evs))
+	}
+	for _, ev := range evs {
+		if len(ev.EventType) > fuzzLimits.MaxStringLength || len(ev.Dimensions)+len(ev.Properties) > fuzzLimits.MaxDimensions {
+			t.Fatalf("event %v is over the limits", ev)
+		}
+	}
+}
+
+func FuzzDatapointsJSON(f *testing.F) {
+	f.Add([]byte(`{"gauge": [{"metric": "a", "value": 1, "dimensions": {"host": "h"}, "timestamp": 1}]}`))
+	f.Add([]byte(`{"counter": [{"metric": "a", "value": 1.5}], "cumulative_counter": [{"metric": "b", "value": "s"}]}`))
+	f.Add([]byte(`{"gauge": [[[[[]]]]]}`))
+	d := &Decoder{Limits: fuzzLimits}
+	f.Fuzz(func(t *testing.T, b []byte) {
+		dps, err := d.DatapointsJSON(bytes.NewReader(b))
+		checkDatapoints(t, dps, err)
+	})
+}
+
+func FuzzEventsJSON(f *testing.F) {
+	f.Add([]byte(`[{"eventType": "a", "category": "ALERT", "dimensions": {"a": "b"}, "properties": {"i": 1, "b": true}}]`))
+	f.Add([]byte(`[{"eventType": "a", "properties": {"f": 1.5, "s": "s"}, "timestamp": 1}]`))
+	d := &Decoder{Limits: fuzzLimits}
+	f.Fuzz(func(t *testing.T, b []byte) {
+		evs, err := d.EventsJSON(bytes.NewReader(b))
+		checkEvents(t, evs, err)
+	})
+}
+
+func FuzzSpansJSON(f *testing.F) {
+	f.Add([]byte(`[{"traceId": "a", "id": "b", "name": "n", "tags": {"a": "b"}, "annotations": [{"timestamp": 1, "value": "v"}]}]`))
+	f.Add([]byte(`[{"traceId": "a", "id": "b", "localEndpoint": {"serviceName": "s", "ipv4": "127.0.0.1", "port": 80}}]`))
+	d := &Decoder{Limits: fuzzLimits}
+	f.Fuzz(func(t *testing.T, b []byte) {
+		spans, err := d.SpansJSON(bytes.NewReader(b))
+		if err != nil {
+			return
+		}
+		if len(spans) > fuzzLimits.MaxItems {
+			t.Fatalf("%d spans is over the limit", len(spans))
+		}
+		for _, s := range spans {
+			if len(s.Tags)+len(s.Annotations) > fuzzLimits.MaxDimensions {
+				t.Fatalf("span %v is over the limits", s)
+			}
+		}
+	})
+}
+
+func FuzzDatapointsProtobuf(f *testing.F) {
+	counter := sfxmodel.MetricType_COUNTER
+	for _, msg := range []*sfxmodel.DataPointUploadMessage{
+		{Datapoints: []*sfxmodel.DataPoint{{Metric: "a", Value: sfxmodel.Datum{IntValue: proto.Int64(1)},
+			Dimensions: []*sfxmodel.Dimension{{Key: "a", Value: "b"}}}}},
+		{Datapoints: []*sfxmodel.DataPoint{{Metric: "a", Value: sfxmodel.Datum{StrValue: proto.String("s")}, MetricType: &counter}}},
+	} {
+		b, err := proto.Marshal(msg)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(b)
+	}
+	d := &Decoder{Limits: fuzzLimits}
+	f.Fuzz(func(t *testing.T, b []byte) {
+		dps, err := d.DatapointsProtobuf(bytes.NewReader(b))
+		checkDatapoints(t, dps, err)
+	})
+}
+
+func FuzzEventsProtobuf(f *testing.F) {
+	alert := sfxmodel.EventCategory_ALERT
+	b, err := proto.Marshal(&sfxmodel.EventUploadMessage{Events: []*sfxmodel.Event{{EventType: "a", Category: &alert,
+		Dimensions: []*sfxmodel.Dimension{{Key: "a", Value: "b"}},
+		Properties: []*sfxmodel.Property{{Key: "p", Value: &sfxmodel.PropertyValue{BoolValue: proto.Bool(true)}}}}}})
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(b)
+	d := &Decoder{Limits: fuzzLimits}
+	f.Fuzz(func(t *testing.T, b []byte) {
+		evs, err := d.EventsProtobuf(bytes.NewReader(b))
+		checkEvents(t, evs, err)
+	})
+}
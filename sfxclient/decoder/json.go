@@ -0,0 +1,202 @@
+package decoder
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"time"
+
+	sfxmodel "github.com/signalfx/com_signalfx_metrics_protobuf/model"
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/errors"
+	"github.com/signalfx/golib/v3/event"
+	"github.com/signalfx/golib/v3/trace"
+)
+
+// jsonDatapoint is a datapoint in the SignalFx v2 JSON format
+type jsonDatapoint struct {
+	Metric     string            `json:"metric"`
+	Value      interface{}       `json:"value"`
+	Dimensions map[string]string `json:"dimensions"`
+	Timestamp  int64             `json:"timestamp"`
+}
+
+// jsonMetricTypes are the keys of the SignalFx v2 JSON datapoint format
+var jsonMetricTypes = map[string]datapoint.MetricType{
+	"gauge":              datapoint.Gauge,
+	"counter":            datapoint.Count,
+	"cumulative_counter": datapoint.Counter,
+}
+
+// DatapointsJSON decodes datapoints in the SignalFx v2 JSON format, like
+// {"gauge": [{"metric": "cpu", "value": 1, "dimensions": {"host": "a"}, "timestamp": 1500000000000}]}
+func (d *Decoder) DatapointsJSON(r io.Reader) ([]*datapoint.Datapoint, error) {
+	l := d.limits()
+	var body map[string][]*jsonDatapoint
+	if err := l.decodeJSON(r, &body); err != nil {
+		return nil, err
+	}
+	total := 0
+	for key, points := range body {
+		if _, exists := jsonMetricTypes[key]; !exists {
+			return nil, errors.Errorf("unknown metric type %q", key)
+		}
+		total += len(points)
+	}
+	if err := l.checkItems(total); err != nil {
+		return nil, err
+	}
+	dps := make([]*datapoint.Datapoint, 0, total)
+	for key, points := range body {
+		for _, p := range points {
+			if p == nil {
+				return nil, errors.New("null datapoint")
+			}
+			dp, err := l.jsonToDatapoint(p, jsonMetricTypes[key])
+			if err != nil {
+				return nil, err
+			}
+			dps = append(dps, dp)
+		}
+	}
+	return dps, nil
+}
+
+func (l Limits) jsonToDatapoint(p *jsonDatapoint, mt datapoint.MetricType) (*datapoint.Datapoint, error) {
+	if p.Metric == "" {
+		return nil, errors.New("datapoint has no metric")
+	}
+	if err := l.checkDimensions(len(p.Dimensions)); err != nil {
+		return nil, err
+	}
+	var value datapoint.Value
+	switch v := p.Value.(type) {
+	case string:
+		value = datapoint.NewStringValue(v)
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			value = datapoint.NewIntValue(i)
+		} else if f, err := v.Float64(); err == nil {
+			value = datapoint.NewFloatValue(f)
+		} else {
+			return nil, errors.Errorf("datapoint %q has an invalid value %q", p.Metric, v)
+		}
+	default:
+		return nil, errors.Errorf("datapoint %q must have a string or number value", p.Metric)
+	}
+	dims := p.Dimensions
+	if dims == nil {
+		dims = map[string]string{}
+	}
+	return datapoint.New(p.Metric, dims, value, mt, fromMillis(p.Timestamp)), nil
+}
+
+// jsonEvent is an event in the SignalFx v2 JSON format
+type jsonEvent struct {
+	EventType  string                 `json:"eventType"`
+	Category   string                 `json:"category"`
+	Dimensions map[string]string      `json:"dimensions"`
+	Properties map[string]interface{} `json:"properties"`
+	Timestamp  int64                  `json:"timestamp"`
+}
+
+// EventsJSON decodes events in the SignalFx v2 JSON format, like
+// [{"eventType": "deploy", "category": "USER_DEFINED", "dimensions": {"host": "a"}, "timestamp": 1500000000000}]
+func (d *Decoder) EventsJSON(r io.Reader) ([]*event.Event, error) {
+	l := d.limits()
+	var body []*jsonEvent
+	if err := l.decodeJSON(r, &body); err != nil {
+		return nil, err
+	}
+	if err := l.checkItems(len(body)); err != nil {
+		return nil, err
+	}
+	evs := make([]*event.Event, 0, len(body))
+	for _, e := range body {
+		if e == nil {
+			return nil, errors.New("null event")
+		}
+		ev, err := l.jsonToEvent(e)
+		if err != nil {
+			return nil, err
+		}
+		evs = append(evs, ev)
+	}
+	return evs, nil
+}
+
+func (l Limits) jsonToEvent(e *jsonEvent) (*event.Event, error) {
+	if e.EventType == "" {
+		return nil, errors.New("event has no eventType")
+	}
+	if err := l.checkDimensions(len(e.Dimensions) + len(e.Properties)); err != nil {
+		return nil, err
+	}
+	category := event.USERDEFINED
+	if e.Category != "" {
+		c, exists := sfxmodel.EventCategory_value[strings.ToUpper(e.Category)]
+		if !exists {
+			return nil, errors.Errorf("event %q has an unknown category %q", e.EventType, e.Category)
+		}
+		category = event.Category(c)
+	}
+	props := make(map[string]interface{}, len(e.Properties))
+	for k, v := range e.Properties {
+		switch t := v.(type) {
+		case json.Number:
+			if i, err := t.Int64(); err == nil {
+				props[k] = i
+			} else if f, err := t.Float64(); err == nil {
+				props[k] = f
+			} else {
+				return nil, errors.Errorf("event %q property %q is an invalid number", e.EventType, k)
+			}
+		case string, bool:
+			props[k] = t
+		default:
+			return nil, errors.Errorf("event %q property %q must be a string, number or bool", e.EventType, k)
+		}
+	}
+	dims := e.Dimensions
+	if dims == nil {
+		dims = map[string]string{}
+	}
+	return event.NewWithProperties(e.EventType, category, dims, props, fromMillis(e.Timestamp)), nil
+}
+
+// SpansJSON decodes a JSON array of Zipkin v2 spans
+func (d *Decoder) SpansJSON(r io.Reader) ([]*trace.Span, error) {
+	l := d.limits()
+	var spans []*trace.Span
+	if err := l.decodeJSON(r, &spans); err != nil {
+		return nil, err
+	}
+	if err := l.checkItems(len(spans)); err != nil {
+		return nil, err
+	}
+	for _, s := range spans {
+		if s == nil {
+			return nil, errors.New("null span")
+		}
+		if s.TraceID == "" || s.ID == "" {
+			return nil, errors.New("span needs a traceId and id")
+		}
+		if err := l.checkDimensions(len(s.Tags) + len(s.Annotations)); err != nil {
+			return nil, err
+		}
+		for _, a := range s.Annotations {
+			if a == nil {
+				return nil, errors.New("null annotation")
+			}
+		}
+	}
+	return spans, nil
+}
+
+// fromMillis converts a SignalFx millisecond timestamp, where zero means unset
+func fromMillis(ms int64) time.Time {
+	if ms == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ms*int64(time.Millisecond))
+}
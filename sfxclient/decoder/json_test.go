@@ -0,0 +1,133 @@
+package decoder
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/event"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDatapointsJSON(t *testing.T) {
+	Convey("decoding JSON datapoints", t, func() {
+		d := &Decoder{}
+		Convey("should decode every metric type and value", func() {
+			dps, err := d.DatapointsJSON(strings.NewReader(`{
+				"gauge": [{"metric": "a", "value": 1, "dimensions": {"host": "h"}, "timestamp": 1500000000000}],
+				"counter": [{"metric": "b", "value": 1.5}],
+				"cumulative_counter": [{"metric": "c", "value": "s"}]}`))
+			So(err, ShouldBeNil)
+			So(len(dps), ShouldEqual, 3)
+			byMetric := map[string]*datapoint.Datapoint{}
+			for _, dp := range dps {
+				byMetric[dp.Metric] = dp
+			}
+			So(byMetric["a"].Value, ShouldResemble, datapoint.NewIntValue(1))
+			So(byMetric["a"].MetricType, ShouldEqual, datapoint.Gauge)
+			So(byMetric["a"].Dimensions, ShouldResemble, map[string]string{"host": "h"})
+			So(byMetric["a"].Timestamp.Equal(time.Unix(1500000000, 0)), ShouldBeTrue)
+			So(byMetric["b"].Value, ShouldResemble, datapoint.NewFloatValue(1.5))
+			So(byMetric["b"].MetricType, ShouldEqual, datapoint.Count)
+			So(byMetric["b"].Timestamp.IsZero(), ShouldBeTrue)
+			So(byMetric["c"].Value, ShouldResemble, datapoint.NewStringValue("s"))
+			So(byMetric["c"].MetricType, ShouldEqual, datapoint.Counter)
+		})
+		Convey("should reject bad datapoints", func() {
+			for _, body := range []string{
+				`{"histogram": []}`,
+				`{"gauge": [null]}`,
+				`{"gauge": [{"value": 1}]}`,
+				`{"gauge": [{"metric": "a"}]}`,
+				`{"gauge": [{"metric": "a", "value": true}]}`,
+				`{"gauge": [{"metric": "a", "value": 1e999}]}`,
+				`[]`,
+			} {
+				_, err := d.DatapointsJSON(strings.NewReader(body))
+				So(err, ShouldNotBeNil)
+			}
+		})
+		Convey("should enforce limits", func() {
+			d.Limits = Limits{MaxItems: 1, MaxDimensions: 1}
+			_, err := d.DatapointsJSON(strings.NewReader(`{"gauge": [{"metric": "a", "value": 1}], "counter": [{"metric": "b", "value": 1}]}`))
+			So(err, ShouldResemble, &LimitError{Limit: "MaxItems", Max: 1})
+			_, err = d.DatapointsJSON(strings.NewReader(`{"gauge": [{"metric": "a", "value": 1, "dimensions": {"a": "b", "c": "d"}}]}`))
+			So(err, ShouldResemble, &LimitError{Limit: "MaxDimensions", Max: 1})
+		})
+	})
+}
+
+func TestEventsJSON(t *testing.T) {
+	Convey("decoding JSON events", t, func() {
+		d := &Decoder{}
+		Convey("should decode events and their properties", func() {
+			evs, err := d.EventsJSON(strings.NewReader(`[
+				{"eventType": "deploy", "category": "alert", "dimensions": {"host": "h"},
+				 "properties": {"i": 1, "f": 1.5, "s": "s", "b": true}, "timestamp": 1500000000000},
+				{"eventType": "other"}]`))
+			So(err, ShouldBeNil)
+			So(len(evs), ShouldEqual, 2)
+			So(evs[0].EventType, ShouldEqual, "deploy")
+			So(evs[0].Category, ShouldEqual, event.ALERT)
+			So(evs[0].Dimensions, ShouldResemble, map[string]string{"host": "h"})
+			So(evs[0].Properties, ShouldResemble, map[string]interface{}{"i": int64(1), "f": 1.5, "s": "s", "b": true})
+			So(evs[0].Timestamp.Equal(time.Unix(1500000000, 0)), ShouldBeTrue)
+			So(evs[1].Category, ShouldEqual, event.USERDEFINED)
+			So(evs[1].Dimensions, ShouldResemble, map[string]string{})
+		})
+		Convey("should reject bad events", func() {
+			for _, body := range []string{
+				`[null]`,
+				`[{}]`,
+				`[{"eventType": "a", "category": "nope"}]`,
+				`[{"eventType": "a", "properties": {"a": null}}]`,
+				`[{"eventType": "a", "properties": {"a": 1e999}}]`,
+				`{}`,
+			} {
+				_, err := d.EventsJSON(strings.NewReader(body))
+				So(err, ShouldNotBeNil)
+			}
+		})
+		Convey("should enforce limits", func() {
+			d.Limits = Limits{MaxItems: 1, MaxDimensions: 1}
+			_, err := d.EventsJSON(strings.NewReader(`[{"eventType": "a"}, {"eventType": "b"}]`))
+			So(err, ShouldResemble, &LimitError{Limit: "MaxItems", Max: 1})
+			_, err = d.EventsJSON(strings.NewReader(`[{"eventType": "a", "dimensions": {"a": "b"}, "properties": {"c": "d"}}]`))
+			So(err, ShouldResemble, &LimitError{Limit: "MaxDimensions", Max: 1})
+		})
+	})
+}
+
+func TestSpansJSON(t *testing.T) {
+	Convey("decoding JSON spans", t, func() {
+		d := &Decoder{}
+		Convey("should decode spans", func() {
+			spans, err := d.SpansJSON(strings.NewReader(`[{"traceId": "abc", "id": "def", "name": "n", "tags": {"a": "b"},
+				"annotations": [{"timestamp": 1, "value": "v"}]}]`))
+			So(err, ShouldBeNil)
+			So(len(spans), ShouldEqual, 1)
+			So(spans[0].TraceID, ShouldEqual, "abc")
+			So(*spans[0].Name, ShouldEqual, "n")
+			So(spans[0].Tags, ShouldResemble, map[string]string{"a": "b"})
+		})
+		Convey("should reject bad spans", func() {
+			for _, body := range []string{
+				`[null]`,
+				`[{"id": "def"}]`,
+				`[{"traceId": "abc", "id": "def", "annotations": [null]}]`,
+				`{}`,
+			} {
+				_, err := d.SpansJSON(strings.NewReader(body))
+				So(err, ShouldNotBeNil)
+			}
+		})
+		Convey("should enforce limits", func() {
+			d.Limits = Limits{MaxItems: 1, MaxDimensions: 1}
+			_, err := d.SpansJSON(strings.NewReader(`[{"traceId": "a", "id": "b"}, {"traceId": "a", "id": "c"}]`))
+			So(err, ShouldResemble, &LimitError{Limit: "MaxItems", Max: 1})
+			_, err = d.SpansJSON(strings.NewReader(`[{"traceId": "a", "id": "b", "tags": {"a": "b", "c": "d"}}]`))
+			So(err, ShouldResemble, &LimitError{Limit: "MaxDimensions", Max: 1})
+		})
+	})
+}
@@ -0,0 +1,171 @@
+package decoder
+
+import (
+	"io"
+
+	sfxmodel "github.com/signalfx/com_signalfx_metrics_protobuf/model"
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/errors"
+	"github.com/signalfx/golib/v3/event"
+)
+
+// protoMetricTypes maps protobuf metric types to datapoint metric types
+var protoMetricTypes = map[sfxmodel.MetricType]datapoint.MetricType{
+	sfxmodel.MetricType_GAUGE:              datapoint.Gauge,
+	sfxmodel.MetricType_COUNTER:            datapoint.Count,
+	sfxmodel.MetricType_ENUM:               datapoint.Enum,
+	sfxmodel.MetricType_CUMULATIVE_COUNTER: datapoint.Counter,
+}
+
+// DatapointsProtobuf decodes a protobuf DataPointUploadMessage, the format HTTPSink sends
+func (d *Decoder) DatapointsProtobuf(r io.Reader) ([]*datapoint.Datapoint, error) {
+	l := d.limits()
+	b, err := l.readBody(r)
+	if err != nil {
+		return nil, err
+	}
+	var msg sfxmodel.DataPointUploadMessage
+	if err := msg.Unmarshal(b); err != nil {
+		return nil, errors.Annotate(err, "cannot decode protobuf")
+	}
+	if err := l.checkItems(len(msg.Datapoints)); err != nil {
+		return nil, err
+	}
+	dps := make([]*datapoint.Datapoint, 0, len(msg.Datapoints))
+	for _, p := range msg.Datapoints {
+		if p == nil {
+			return nil, errors.New("null datapoint")
+		}
+		dp, err := l.protoToDatapoint(p)
+		if err != nil {
+			return nil, err
+		}
+		dps = append(dps, dp)
+	}
+	return dps, nil
+}
+
+func (l Limits) protoToDatapoint(p *sfxmodel.DataPoint) (*datapoint.Datapoint, error) {
+	if p.Metric == "" {
+		return nil, errors.New("datapoint has no metric")
+	}
+	if err := l.checkString(p.Metric); err != nil {
+		return nil, err
+	}
+	dims, err := l.protoDimensions(p.Dimensions)
+	if err != nil {
+		return nil, err
+	}
+	mt, exists := protoMetricTypes[p.GetMetricType()]
+	if !exists {
+		return nil, errors.Errorf("datapoint %q has an unknown metric type %d", p.Metric, p.GetMetricType())
+	}
+	var value datapoint.Value
+	switch {
+	case p.Value.IntValue != nil:
+		value = datapoint.NewIntValue(*p.Value.IntValue)
+	case p.Value.DoubleValue != nil:
+		value = datapoint.NewFloatValue(*p.Value.DoubleValue)
+	case p.Value.StrValue != nil:
+		if err := l.checkString(*p.Value.StrValue); err != nil {
+			return nil, err
+		}
+		value = datapoint.NewStringValue(*p.Value.StrValue)
+	default:
+		return nil, errors.Errorf("datapoint %q has no value", p.Metric)
+	}
+	return datapoint.New(p.Metric, dims, value, mt, fromMillis(p.Timestamp)), nil
+}
+
+// EventsProtobuf decodes a protobuf EventUploadMessage, the format HTTPSink sends
+func (d *Decoder) EventsProtobuf(r io.Reader) ([]*event.Event, error) {
+	l := d.limits()
+	b, err := l.readBody(r)
+	if err != nil {
+		return nil, err
+	}
+	var msg sfxmodel.EventUploadMessage
+	if err := msg.Unmarshal(b); err != nil {
+		return nil, errors.Annotate(err, "cannot decode protobuf")
+	}
+	if err := l.checkItems(len(msg.Events)); err != nil {
+		return nil, err
+	}
+	evs := make([]*event.Event, 0, len(msg.Events))
+	for _, e := range msg.Events {
+		if e == nil {
+			return nil, errors.New("null event")
+		}
+		ev, err := l.protoToEvent(e)
+		if err != nil {
+			return nil, err
+		}
+		evs = append(evs, ev)
+	}
+	return evs, nil
+}
+
+func (l Limits) protoToEvent(e *sfxmodel.Event) (*event.Event, error) {
+	if e.EventType == "" {
+		return nil, errors.New("event has no eventType")
+	}
+	if err := l.checkString(e.EventType); err != nil {
+		return nil, err
+	}
+	if err := l.checkDimensions(len(e.Dimensions) + len(e.Properties)); err != nil {
+		return nil, err
+	}
+	dims, err := l.protoDimensions(e.Dimensions)
+	if err != nil {
+		return nil, err
+	}
+	props := make(map[string]interface{}, len(e.Properties))
+	for _, p := range e.Properties {
+		if p == nil || p.Value == nil {
+			return nil, errors.Errorf("event %q has a property without a value", e.EventType)
+		}
+		if err := l.checkString(p.Key); err != nil {
+			return nil, err
+		}
+		switch v := p.Value; {
+		case v.StrValue != nil:
+			if err := l.checkString(*v.StrValue); err != nil {
+				return nil, err
+			}
+			props[p.Key] = *v.StrValue
+		case v.IntValue != nil:
+			props[p.Key] = *v.IntValue
+		case v.DoubleValue != nil:
+			props[p.Key] = *v.DoubleValue
+		case v.BoolValue != nil:
+			props[p.Key] = *v.BoolValue
+		default:
+			return nil, errors.Errorf("event %q property %q has no value", e.EventType, p.Key)
+		}
+	}
+	category := event.USERDEFINED
+	if e.Category != nil {
+		category = event.ToProtoEC(*e.Category)
+	}
+	return event.NewWithProperties(e.EventType, category, dims, props, fromMillis(e.Timestamp)), nil
+}
+
+func (l Limits) protoDimensions(dims []*sfxmodel.Dimension) (map[string]string, error) {
+	if err := l.checkDimensions(len(dims)); err != nil {
+		return nil, err
+	}
+	ret := make(map[string]string, len(dims))
+	for _, dim := range dims {
+		if dim == nil {
+			return nil, errors.New("null dimension")
+		}
+		if err := l.checkString(dim.Key); err != nil {
+			return nil, err
+		}
+		if err := l.checkString(dim.Value); err != nil {
+			return nil, err
+		}
+		ret[dim.Key] = dim.Value
+	}
+	return ret, nil
+}
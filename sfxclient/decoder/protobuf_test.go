@@ -0,0 +1,133 @@
+package decoder
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	sfxmodel "github.com/signalfx/com_signalfx_metrics_protobuf/model"
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/event"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func marshal(t *testing.T, m proto.Message) *bytes.Reader {
+	b, err := proto.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytes.NewReader(b)
+}
+
+func TestDatapointsProtobuf(t *testing.T) {
+	Convey("decoding protobuf datapoints", t, func() {
+		d := &Decoder{}
+		counter := sfxmodel.MetricType_COUNTER
+		unknown := sfxmodel.MetricType(99)
+		Convey("should decode every value type", func() {
+			dps, err := d.DatapointsProtobuf(marshal(t, &sfxmodel.DataPointUploadMessage{Datapoints: []*sfxmodel.DataPoint{
+				{Metric: "a", Value: sfxmodel.Datum{IntValue: proto.Int64(1)}, Timestamp: 1500000000000,
+					Dimensions: []*sfxmodel.Dimension{{Key: "host", Value: "h"}}},
+				{Metric: "b", Value: sfxmodel.Datum{DoubleValue: proto.Float64(1.5)}, MetricType: &counter},
+				{Metric: "c", Value: sfxmodel.Datum{StrValue: proto.String("s")}},
+			}}))
+			So(err, ShouldBeNil)
+			So(len(dps), ShouldEqual, 3)
+			So(dps[0].Value, ShouldResemble, datapoint.NewIntValue(1))
+			So(dps[0].MetricType, ShouldEqual, datapoint.Gauge)
+			So(dps[0].Dimensions, ShouldResemble, map[string]string{"host": "h"})
+			So(dps[0].Timestamp.Equal(time.Unix(1500000000, 0)), ShouldBeTrue)
+			So(dps[1].Value, ShouldResemble, datapoint.NewFloatValue(1.5))
+			So(dps[1].MetricType, ShouldEqual, datapoint.Count)
+			So(dps[2].Value, ShouldResemble, datapoint.NewStringValue("s"))
+		})
+		Convey("should reject bad datapoints", func() {
+			for _, dp := range []*sfxmodel.DataPoint{
+				{Value: sfxmodel.Datum{IntValue: proto.Int64(1)}},
+				{Metric: "a"},
+				{Metric: "a", Value: sfxmodel.Datum{IntValue: proto.Int64(1)}, MetricType: &unknown},
+			} {
+				_, err := d.DatapointsProtobuf(marshal(t, &sfxmodel.DataPointUploadMessage{Datapoints: []*sfxmodel.DataPoint{dp}}))
+				So(err, ShouldNotBeNil)
+			}
+			_, err := d.DatapointsProtobuf(bytes.NewReader([]byte{0xff, 0xff}))
+			So(err, ShouldNotBeNil)
+		})
+		Convey("should enforce limits", func() {
+			d.Limits = Limits{MaxItems: 1, MaxDimensions: 1, MaxStringLength: 3}
+			one := sfxmodel.Datum{IntValue: proto.Int64(1)}
+			_, err := d.DatapointsProtobuf(marshal(t, &sfxmodel.DataPointUploadMessage{Datapoints: []*sfxmodel.DataPoint{
+				{Metric: "a", Value: one}, {Metric: "b", Value: one}}}))
+			So(err, ShouldResemble, &LimitError{Limit: "MaxItems", Max: 1})
+			_, err = d.DatapointsProtobuf(marshal(t, &sfxmodel.DataPointUploadMessage{Datapoints: []*sfxmodel.DataPoint{
+				{Metric: "a", Value: one, Dimensions: []*sfxmodel.Dimension{{Key: "a"}, {Key: "b"}}}}}))
+			So(err, ShouldResemble, &LimitError{Limit: "MaxDimensions", Max: 1})
+			for _, dp := range []*sfxmodel.DataPoint{
+				{Metric: "abcd", Value: one},
+				{Metric: "a", Value: sfxmodel.Datum{StrValue: proto.String("abcd")}},
+				{Metric: "a", Value: one, Dimensions: []*sfxmodel.Dimension{{Key: "abcd"}}},
+				{Metric: "a", Value: one, Dimensions: []*sfxmodel.Dimension{{Key: "a", Value: "abcd"}}},
+			} {
+				_, err = d.DatapointsProtobuf(marshal(t, &sfxmodel.DataPointUploadMessage{Datapoints: []*sfxmodel.DataPoint{dp}}))
+				So(err, ShouldResemble, &LimitError{Limit: "MaxStringLength", Max: 3})
+			}
+		})
+	})
+}
+
+func TestEventsProtobuf(t *testing.T) {
+	Convey("decoding protobuf events", t, func() {
+		d := &Decoder{}
+		alert := sfxmodel.EventCategory_ALERT
+		Convey("should decode events and their properties", func() {
+			evs, err := d.EventsProtobuf(marshal(t, &sfxmodel.EventUploadMessage{Events: []*sfxmodel.Event{
+				{EventType: "deploy", Category: &alert, Timestamp: 1500000000000,
+					Dimensions: []*sfxmodel.Dimension{{Key: "host", Value: "h"}},
+					Properties: []*sfxmodel.Property{
+						{Key: "i", Value: &sfxmodel.PropertyValue{IntValue: proto.Int64(1)}},
+						{Key: "f", Value: &sfxmodel.PropertyValue{DoubleValue: proto.Float64(1.5)}},
+						{Key: "s", Value: &sfxmodel.PropertyValue{StrValue: proto.String("s")}},
+						{Key: "b", Value: &sfxmodel.PropertyValue{BoolValue: proto.Bool(true)}},
+					}},
+				{EventType: "other"},
+			}}))
+			So(err, ShouldBeNil)
+			So(len(evs), ShouldEqual, 2)
+			So(evs[0].Category, ShouldEqual, event.ALERT)
+			So(evs[0].Dimensions, ShouldResemble, map[string]string{"host": "h"})
+			So(evs[0].Properties, ShouldResemble, map[string]interface{}{"i": int64(1), "f": 1.5, "s": "s", "b": true})
+			So(evs[0].Timestamp.Equal(time.Unix(1500000000, 0)), ShouldBeTrue)
+			So(evs[1].Category, ShouldEqual, event.USERDEFINED)
+		})
+		Convey("should reject bad events", func() {
+			for _, ev := range []*sfxmodel.Event{
+				{},
+				{EventType: "a", Properties: []*sfxmodel.Property{{Key: "a"}}},
+				{EventType: "a", Properties: []*sfxmodel.Property{{Key: "a", Value: &sfxmodel.PropertyValue{}}}},
+			} {
+				_, err := d.EventsProtobuf(marshal(t, &sfxmodel.EventUploadMessage{Events: []*sfxmodel.Event{ev}}))
+				So(err, ShouldNotBeNil)
+			}
+			_, err := d.EventsProtobuf(bytes.NewReader([]byte{0xff, 0xff}))
+			So(err, ShouldNotBeNil)
+		})
+		Convey("should enforce limits", func() {
+			d.Limits = Limits{MaxItems: 1, MaxDimensions: 1, MaxStringLength: 3}
+			_, err := d.EventsProtobuf(marshal(t, &sfxmodel.EventUploadMessage{Events: []*sfxmodel.Event{{EventType: "a"}, {EventType: "b"}}}))
+			So(err, ShouldResemble, &LimitError{Limit: "MaxItems", Max: 1})
+			_, err = d.EventsProtobuf(marshal(t, &sfxmodel.EventUploadMessage{Events: []*sfxmodel.Event{{EventType: "a",
+				Dimensions: []*sfxmodel.Dimension{{Key: "a"}},
+				Properties: []*sfxmodel.Property{{Key: "b", Value: &sfxmodel.PropertyValue{BoolValue: proto.Bool(true)}}}}}}))
+			So(err, ShouldResemble, &LimitError{Limit: "MaxDimensions", Max: 1})
+			for _, ev := range []*sfxmodel.Event{
+				{EventType: "abcd"},
+				{EventType: "a", Properties: []*sfxmodel.Property{{Key: "abcd", Value: &sfxmodel.PropertyValue{BoolValue: proto.Bool(true)}}}},
+				{EventType: "a", Properties: []*sfxmodel.Property{{Key: "a", Value: &sfxmodel.PropertyValue{StrValue: proto.String("abcd")}}}},
+			} {
+				_, err = d.EventsProtobuf(marshal(t, &sfxmodel.EventUploadMessage{Events: []*sfxmodel.Event{ev}}))
+				So(err, ShouldResemble, &LimitError{Limit: "MaxStringLength", Max: 3})
+			}
+		})
+	})
+}
@@ -0,0 +1,162 @@
+package sfxclient
+
+import (
+	"math"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+)
+
+// DefaultDistributionQuantiles are the quantiles a Distribution reports by default
+var DefaultDistributionQuantiles = []float64{.5, .9, .99}
+
+// DefaultDistributionBufferSize is how many values a Distribution records before merging them into its
+// t-digest, if it isn't reported first
+var DefaultDistributionBufferSize = 1024
+
+// Distribution records values, like request latencies, without taking a lock and reports their count and
+// sum as cumulative counters, and the min, max and quantiles of the values recorded since the last report
+// as gauges.  Quantiles are estimated with a t-digest, so its memory stays bounded however many values
+// are recorded.
+type Distribution struct {
+	// MetricName is the metric name used when the Distribution is reported to SignalFx
+	MetricName string
+	// Dimensions are the dimensions used when the Distribution is reported to SignalFx
+	Dimensions map[string]string
+	// Quantiles are values [0 - 1.0] of the quantiles reported.  For example, [.5] would only report the
+	// median.
+	Quantiles []float64
+	// Compression trades the accuracy of the quantiles for the size of the t-digest, see DefaultCompression
+	Compression float64
+
+	count int64
+	sum   atomicFloat
+	// buffer is the *distributionBuffer values are recorded to
+	buffer atomic.Value
+
+	mu       sync.Mutex
+	digest   tdigest
+	min, max float64
+}
+
+var _ Collector = &Distribution{}
+
+// distributionBuffer holds values until they're merged into the t-digest.  Writers claim a slot each.
+type distributionBuffer struct {
+	values []uint64
+	// claimed is how many slots writers have claimed, which can be more than there are
+	claimed int64
+	// writers are how many writers are claiming or writing a slot
+	writers int64
+}
+
+// NewDistribution creates a Distribution reporting DefaultDistributionQuantiles
+func NewDistribution(metricName string, dimensions map[string]string) *Distribution {
+	return &Distribution{
+		MetricName:  metricName,
+		Dimensions:  dimensions,
+		Quantiles:   DefaultDistributionQuantiles,
+		Compression: DefaultCompression,
+	}
+}
+
+func newDistributionBuffer() *distributionBuffer {
+	return &distributionBuffer{values: make([]uint64, DefaultDistributionBufferSize)}
+}
+
+// current returns the buffer values are recorded to
+func (d *Distribution) current() *distributionBuffer {
+	if buf, ok := d.buffer.Load().(*distributionBuffer); ok {
+		return buf
+	}
+	d.buffer.CompareAndSwap(nil, newDistributionBuffer())
+	return d.buffer.Load().(*distributionBuffer)
+}
+
+// Add records a value
+func (d *Distribution) Add(v float64) {
+	atomic.AddInt64(&d.count, 1)
+	d.sum.Add(v)
+	bits := math.Float64bits(v)
+	for {
+		buf := d.current()
+		atomic.AddInt64(&buf.writers, 1)
+		// a buffer swapped out before this writer was counted may already have been merged
+		if d.current() != buf {
+			atomic.AddInt64(&buf.writers, -1)
+			continue
+		}
+		i := atomic.AddInt64(&buf.claimed, 1) - 1
+		if i < int64(len(buf.values)) {
+			atomic.StoreUint64(&buf.values[i], bits)
+			atomic.AddInt64(&buf.writers, -1)
+			return
+		}
+		atomic.AddInt64(&buf.writers, -1)
+		d.mu.Lock()
+		d.merge(buf)
+		d.mu.Unlock()
+	}
+}
+
+// AddDuration records a duration in milliseconds
+func (d *Distribution) AddDuration(dur time.Duration) {
+	d.Add(float64(dur) / float64(time.Millisecond))
+}
+
+// merge swaps buf for an empty buffer, if it's still the one written to, and merges its values into the
+// digest once its writers are done.  d.mu must be held.
+func (d *Distribution) merge(buf *distributionBuffer) {
+	if d.current() != buf {
+		return
+	}
+	d.buffer.Store(newDistributionBuffer())
+	for atomic.LoadInt64(&buf.writers) > 0 {
+		runtime.Gosched()
+	}
+	n := atomic.LoadInt64(&buf.claimed)
+	if n > int64(len(buf.values)) {
+		n = int64(len(buf.values))
+	}
+	values := make([]float64, n)
+	for i := range values {
+		v := math.Float64frombits(atomic.LoadUint64(&buf.values[i]))
+		if d.digest.total == 0 && i == 0 {
+			d.min, d.max = v, v
+		}
+		d.min = math.Min(d.min, v)
+		d.max = math.Max(d.max, v)
+		values[i] = v
+	}
+	d.digest.compression = d.Compression
+	d.digest.add(values)
+}
+
+// Datapoints returns the count and sum, and the min, max and quantiles of the values recorded since the
+// last call if there are any
+func (d *Distribution) Datapoints() []*datapoint.Datapoint {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.merge(d.current())
+	ret := make([]*datapoint.Datapoint, 0, 4+len(d.Quantiles))
+	ret = append(ret,
+		Cumulative(d.MetricName+".count", d.Dimensions, atomic.LoadInt64(&d.count)),
+		CumulativeF(d.MetricName+".sum", d.Dimensions, d.sum.Get()),
+	)
+	if d.digest.total == 0 {
+		return ret
+	}
+	ret = append(ret,
+		GaugeF(d.MetricName+".min", d.Dimensions, d.min),
+		GaugeF(d.MetricName+".max", d.Dimensions, d.max),
+	)
+	for _, q := range d.Quantiles {
+		v := math.Max(d.min, math.Min(d.max, d.digest.quantile(q)))
+		ret = append(ret, GaugeF(d.MetricName+".p"+percentToString(q), d.Dimensions, v))
+	}
+	d.digest.reset()
+	return ret
+}
@@ -0,0 +1,114 @@
+package sfxclient
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func distributionValues(dps []*datapoint.Datapoint) map[string]float64 {
+	ret := make(map[string]float64, len(dps))
+	for _, dp := range dps {
+		switch v := dp.Value.(type) {
+		case datapoint.IntValue:
+			ret[dp.Metric] = float64(v.Int())
+		case datapoint.FloatValue:
+			ret[dp.Metric] = v.Float()
+		}
+	}
+	return ret
+}
+
+func TestTDigest(t *testing.T) {
+	Convey("A t-digest", t, func() {
+		d := &tdigest{}
+		Convey("should know nothing before values are added", func() {
+			So(math.IsNaN(d.quantile(.5)), ShouldBeTrue)
+		})
+		Convey("should estimate quantiles", func() {
+			values := rand.New(rand.NewSource(0)).Perm(100000)
+			for i := 0; i < len(values); i += 1000 {
+				batch := make([]float64, 1000)
+				for j := range batch {
+					batch[j] = float64(values[i+j])
+				}
+				d.add(batch)
+			}
+			So(len(d.centroids), ShouldBeLessThan, 1000)
+			So(d.quantile(.5), ShouldAlmostEqual, 50000, 500)
+			So(d.quantile(.9), ShouldAlmostEqual, 90000, 500)
+			So(d.quantile(.99), ShouldAlmostEqual, 99000, 100)
+			So(d.quantile(0), ShouldEqual, 0)
+			So(d.quantile(1), ShouldEqual, 99999)
+		})
+	})
+}
+
+func TestDistribution(t *testing.T) {
+	Convey("A Distribution", t, func() {
+		d := NewDistribution("latency", map[string]string{"svc": "api"})
+		Convey("should report only its count and sum before values are added", func() {
+			So(distributionValues(d.Datapoints()), ShouldResemble, map[string]float64{"latency.count": 0, "latency.sum": 0})
+		})
+		Convey("should report what's been added since the last report", func() {
+			for i := 1; i <= 100; i++ {
+				d.Add(float64(i))
+			}
+			dps := d.Datapoints()
+			So(dps[0].Dimensions, ShouldResemble, map[string]string{"svc": "api"})
+			values := distributionValues(dps)
+			So(values["latency.count"], ShouldEqual, 100)
+			So(values["latency.sum"], ShouldEqual, 5050)
+			So(values["latency.min"], ShouldEqual, 1)
+			So(values["latency.max"], ShouldEqual, 100)
+			So(values["latency.p50"], ShouldAlmostEqual, 50.5, 1)
+			So(values["latency.p99"], ShouldAlmostEqual, 99.5, 1)
+			d.AddDuration(time.Second)
+			values = distributionValues(d.Datapoints())
+			So(values["latency.count"], ShouldEqual, 101)
+			So(values["latency.min"], ShouldEqual, 1000)
+			So(values["latency.p50"], ShouldEqual, 1000)
+		})
+		Convey("should record concurrently", func() {
+			var wg sync.WaitGroup
+			reported := make(chan struct{})
+			go func() {
+				defer close(reported)
+				for i := 0; i < 20; i++ {
+					d.Datapoints()
+				}
+			}()
+			for g := 0; g < 8; g++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for i := 0; i < DefaultDistributionBufferSize; i++ {
+						d.Add(1)
+					}
+				}()
+			}
+			wg.Wait()
+			<-reported
+			So(distributionValues(d.Datapoints())["latency.count"], ShouldEqual, 8*DefaultDistributionBufferSize)
+			So(d.digest.total, ShouldEqual, 0)
+		})
+		Convey("should work without being created", func() {
+			zero := &Distribution{MetricName: "z", Quantiles: []float64{.5}}
+			zero.Add(2)
+			So(distributionValues(zero.Datapoints()), ShouldResemble, map[string]float64{
+				"z.count": 1, "z.sum": 2, "z.min": 2, "z.max": 2, "z.p50": 2,
+			})
+		})
+		Convey("should report through a scheduler", func() {
+			s := NewScheduler()
+			s.AddCallback(d)
+			d.Add(3)
+			So(len(s.CollectDatapoints()), ShouldEqual, 7)
+		})
+	})
+}
@@ -0,0 +1,61 @@
+package sfxclient
+
+import (
+	"sync"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/eventcounter"
+	"github.com/signalfx/golib/v3/timekeeper"
+)
+
+// EventCounterCollector reports an eventcounter.EventCounter on a Scheduler.  Every report emits
+//   - MetricName.count: a cumulative counter of all events
+//   - MetricName.period_count: a gauge of the events counted so far in the counter's current period
+//   - MetricName.rate: a gauge of events per second since the previous report
+type EventCounterCollector struct {
+	Counter    *eventcounter.EventCounter
+	MetricName string
+	Dimensions map[string]string
+	Timer      timekeeper.TimeKeeper
+
+	mu        sync.Mutex
+	lastTime  time.Time
+	lastTotal int64
+}
+
+var _ Collector = &EventCounterCollector{}
+
+// NewEventCounterCollector returns a collector reporting counter under metricName with dims
+func NewEventCounterCollector(counter *eventcounter.EventCounter, metricName string, dims map[string]string) *EventCounterCollector {
+	return &EventCounterCollector{
+		Counter:    counter,
+		MetricName: metricName,
+		Dimensions: dims,
+		Timer:      timekeeper.RealTime{},
+	}
+}
+
+// Datapoints returns the count, period count and rate datapoints.  No rate is reported on the
+// first call since there is nothing to compare against yet.
+func (e *EventCounterCollector) Datapoints() []*datapoint.Datapoint {
+	if e.MetricName == "" {
+		return []*datapoint.Datapoint{}
+	}
+	now := e.Timer.Now()
+	total := e.Counter.Total()
+	ret := []*datapoint.Datapoint{
+		Cumulative(e.MetricName+".count", e.Dimensions, total),
+		Gauge(e.MetricName+".period_count", e.Dimensions, e.Counter.Events(now, 0)),
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.lastTime.IsZero() {
+		if elapsed := now.Sub(e.lastTime).Seconds(); elapsed > 0 {
+			ret = append(ret, GaugeF(e.MetricName+".rate", e.Dimensions, float64(total-e.lastTotal)/elapsed))
+		}
+	}
+	e.lastTime = now
+	e.lastTotal = total
+	return ret
+}
@@ -0,0 +1,55 @@
+package sfxclient
+
+import (
+	"testing"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/eventcounter"
+	"github.com/signalfx/golib/v3/timekeeper/timekeepertest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEventCounterCollector(t *testing.T) {
+	Convey("With an event counter collector", t, func() {
+		tk := timekeepertest.NewStubClock(time.Now())
+		ec := eventcounter.New(tk.Now(), time.Minute)
+		c := NewEventCounterCollector(&ec, "events", map[string]string{"type": "login"})
+		c.Timer = tk
+		Convey("the first report should not have a rate", func() {
+			ec.Events(tk.Now(), 5)
+			dps := c.Datapoints()
+			So(len(dps), ShouldEqual, 2)
+			So(dps[0].Metric, ShouldEqual, "events.count")
+			So(dps[0].MetricType, ShouldEqual, datapoint.Counter)
+			So(dps[0].Value.String(), ShouldEqual, "5")
+			So(dps[0].Dimensions["type"], ShouldEqual, "login")
+			So(dps[1].Metric, ShouldEqual, "events.period_count")
+			So(dps[1].Value.String(), ShouldEqual, "5")
+			Convey("and later reports should", func() {
+				tk.Incr(time.Second * 10)
+				ec.Events(tk.Now(), 20)
+				dps := c.Datapoints()
+				So(len(dps), ShouldEqual, 3)
+				So(dps[2].Metric, ShouldEqual, "events.rate")
+				So(dps[2].Value.String(), ShouldEqual, "2")
+				Convey("period counts should reset with the counter", func() {
+					tk.Incr(time.Minute)
+					dps := c.Datapoints()
+					So(dps[0].Value.String(), ShouldEqual, "25")
+					So(dps[1].Value.String(), ShouldEqual, "0")
+					So(dps[2].Value.String(), ShouldEqual, "0")
+				})
+			})
+		})
+		Convey("no metric name should report nothing", func() {
+			c.MetricName = ""
+			So(c.Datapoints(), ShouldBeEmpty)
+		})
+		Convey("it should work on a scheduler", func() {
+			s := NewScheduler()
+			s.AddCallback(c)
+			So(len(s.CollectDatapoints()), ShouldEqual, 2)
+		})
+	})
+}
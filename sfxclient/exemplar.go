@@ -0,0 +1,87 @@
+package sfxclient
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+)
+
+// DefaultMaxExemplars is how many observations with exemplars a RollingBucket samples each window by default
+var DefaultMaxExemplars = 64
+
+// Exemplar is an observation made while tracing the span SpanID of the trace TraceID.  Attached to a
+// datapoint, it lets backends that understand exemplars, like OTLP ones, link the datapoint to the trace.
+type Exemplar struct {
+	TraceID   string
+	SpanID    string
+	Value     float64
+	Timestamp time.Time
+}
+
+// exemplarsMeta is the datapoint Meta key exemplars are attached with
+type exemplarsMeta struct{}
+
+// AddExemplars attaches exemplars to dp
+func AddExemplars(dp *datapoint.Datapoint, exemplars ...Exemplar) {
+	if len(exemplars) == 0 {
+		return
+	}
+	if dp.Meta == nil {
+		dp.Meta = make(map[interface{}]interface{}, 1)
+	}
+	existing, _ := dp.Meta[exemplarsMeta{}].([]Exemplar)
+	dp.Meta[exemplarsMeta{}] = append(existing[:len(existing):len(existing)], exemplars...)
+}
+
+// Exemplars returns the exemplars attached to dp
+func Exemplars(dp *datapoint.Datapoint) []Exemplar {
+	ret, _ := dp.Meta[exemplarsMeta{}].([]Exemplar)
+	return ret
+}
+
+// exemplarSample is a uniform sample of up to max exemplars, by reservoir sampling.  It isn't thread safe.
+type exemplarSample struct {
+	exemplars []Exemplar
+	seen      int64
+}
+
+func (s *exemplarSample) add(e Exemplar, max int) {
+	if max <= 0 {
+		max = DefaultMaxExemplars
+	}
+	s.seen++
+	if len(s.exemplars) < max {
+		s.exemplars = append(s.exemplars, e)
+		return
+	}
+	if i := rand.Int63n(s.seen); i < int64(len(s.exemplars)) {
+		s.exemplars[i] = e
+	}
+}
+
+// attach attaches the exemplar with the value nearest each point's to it
+func (s *exemplarSample) attach(points []*datapoint.Datapoint) {
+	if len(s.exemplars) == 0 {
+		return
+	}
+	for _, dp := range points {
+		fv, ok := dp.Value.(datapoint.FloatValue)
+		if !ok {
+			continue
+		}
+		nearest := 0
+		for i, e := range s.exemplars {
+			if math.Abs(e.Value-fv.Float()) < math.Abs(s.exemplars[nearest].Value-fv.Float()) {
+				nearest = i
+			}
+		}
+		AddExemplars(dp, s.exemplars[nearest])
+	}
+}
+
+func (s *exemplarSample) reset() {
+	s.exemplars = s.exemplars[:0]
+	s.seen = 0
+}
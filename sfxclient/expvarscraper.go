@@ -0,0 +1,193 @@
+package sfxclient
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/errors"
+)
+
+// maxExpvarBytes bounds how much of an expvar response is read
+const maxExpvarBytes = 16 << 20
+
+// DefaultExpvarCumulatives are the flattened names of the runtime.MemStats fields, published by the expvar
+// package as memstats, that only ever increase
+var DefaultExpvarCumulatives = []string{
+	"memstats.TotalAlloc",
+	"memstats.Lookups",
+	"memstats.Mallocs",
+	"memstats.Frees",
+	"memstats.PauseTotalNs",
+	"memstats.NumGC",
+	"memstats.NumForcedGC",
+}
+
+// ExpvarScraper is a Collector that fetches a /debug/vars endpoint each time it is collected and turns the
+// numbers in it into datapoints.  Nested objects are flattened, joining names with a dot, so the expvar
+// memstats becomes memstats.HeapAlloc, memstats.NumGC and so on.  Arrays, strings and bools are ignored.
+// Add it to a Scheduler to ingest metrics from processes that only expose expvar.
+type ExpvarScraper struct {
+	// URL is the expvar endpoint, like http://localhost:6060/debug/vars
+	URL    string
+	Client *http.Client
+	// Dimensions are added to every datapoint
+	Dimensions map[string]string
+	// Allow, if not empty, are glob patterns (see path.Match) of the only flattened names collected
+	Allow []string
+	// Deny are glob patterns of flattened names never collected.  Deny wins over Allow
+	Deny []string
+	// Cumulatives are glob patterns of flattened names that are sent as cumulative counters rather than gauges
+	Cumulatives []string
+	// MetricName maps a flattened name to the metric to send it as.  Returning "" drops it.  Nil sends the
+	// flattened name unchanged
+	MetricName func(name string) string
+	// ErrorHandler is called when a scrape fails
+	ErrorHandler func(error) error
+
+	stats struct {
+		scrapes int64
+		errors  int64
+	}
+	mu      sync.Mutex
+	lastErr error
+}
+
+var _ Collector = &ExpvarScraper{}
+
+// NewExpvarScraper creates a scraper of url that treats DefaultExpvarCumulatives as counters
+func NewExpvarScraper(url string) *ExpvarScraper {
+	return &ExpvarScraper{
+		URL: url,
+		Client: &http.Client{
+			Timeout: DefaultTimeout,
+		},
+		Cumulatives:  DefaultExpvarCumulatives,
+		ErrorHandler: DefaultErrorHandler,
+	}
+}
+
+// Datapoints scrapes the endpoint, returning its datapoints along with stats about the scraper.  A failed
+// scrape is passed to the ErrorHandler and only the stats are returned.
+func (e *ExpvarScraper) Datapoints() []*datapoint.Datapoint {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultTimeout)
+	defer cancel()
+	dps, err := e.Scrape(ctx)
+	if err != nil && e.ErrorHandler != nil {
+		_ = e.ErrorHandler(err)
+	}
+	return append(dps,
+		Cumulative("total_expvar_scrapes", e.Dimensions, atomic.LoadInt64(&e.stats.scrapes)),
+		Cumulative("total_expvar_scrape_errors", e.Dimensions, atomic.LoadInt64(&e.stats.errors)),
+	)
+}
+
+// LastError is the error from the most recent scrape, or nil if it succeeded
+func (e *ExpvarScraper) LastError() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.lastErr
+}
+
+// Scrape fetches the endpoint once and converts it to datapoints
+func (e *ExpvarScraper) Scrape(ctx context.Context) ([]*datapoint.Datapoint, error) {
+	atomic.AddInt64(&e.stats.scrapes, 1)
+	dps, err := e.scrape(ctx)
+	if err != nil {
+		atomic.AddInt64(&e.stats.errors, 1)
+		err = errors.Annotatef(err, "cannot scrape expvars from %s", e.URL)
+	}
+	e.mu.Lock()
+	e.lastErr = err
+	e.mu.Unlock()
+	return dps, err
+}
+
+func (e *ExpvarScraper) scrape(ctx context.Context) ([]*datapoint.Datapoint, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, e.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := e.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("invalid status code %d", resp.StatusCode)
+	}
+	dec := json.NewDecoder(io.LimitReader(resp.Body, maxExpvarBytes))
+	dec.UseNumber()
+	var vars map[string]interface{}
+	if err := dec.Decode(&vars); err != nil {
+		return nil, err
+	}
+	var dps []*datapoint.Datapoint
+	for name, v := range vars {
+		dps = e.flatten(dps, name, v)
+	}
+	return dps, nil
+}
+
+// flatten appends the numbers in v, named name, to dps
+func (e *ExpvarScraper) flatten(dps []*datapoint.Datapoint, name string, v interface{}) []*datapoint.Datapoint {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, child := range t {
+			dps = e.flatten(dps, name+"."+k, child)
+		}
+	case json.Number:
+		if dp := e.datapoint(name, t); dp != nil {
+			dps = append(dps, dp)
+		}
+	}
+	return dps
+}
+
+func (e *ExpvarScraper) datapoint(name string, n json.Number) *datapoint.Datapoint {
+	if matchesAnyGlob(e.Deny, name) || (len(e.Allow) > 0 && !matchesAnyGlob(e.Allow, name)) {
+		return nil
+	}
+	metric := name
+	if e.MetricName != nil {
+		if metric = e.MetricName(name); metric == "" {
+			return nil
+		}
+	}
+	cumulative := matchesAnyGlob(e.Cumulatives, name)
+	if i, err := strconv.ParseInt(n.String(), 10, 64); err == nil {
+		if cumulative {
+			return Cumulative(metric, e.Dimensions, i)
+		}
+		return Gauge(metric, e.Dimensions, i)
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return nil
+	}
+	if cumulative {
+		return CumulativeF(metric, e.Dimensions, f)
+	}
+	return GaugeF(metric, e.Dimensions, f)
+}
+
+func matchesAnyGlob(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if matched, _ := path.Match(p, name); matched {
+			return true
+		}
+	}
+	return false
+}
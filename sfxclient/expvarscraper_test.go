@@ -0,0 +1,106 @@
+package sfxclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func findDatapoint(dps []*datapoint.Datapoint, metric string) *datapoint.Datapoint {
+	for _, dp := range dps {
+		if dp.Metric == metric {
+			return dp
+		}
+	}
+	return nil
+}
+
+func TestExpvarScraper(t *testing.T) {
+	Convey("an expvar scraper", t, func() {
+		body := `{"cmdline": ["a"], "requests": 12, "ratio": 0.5, "huge": 18446744073709551615, "on": true,
+			"memstats": {"HeapAlloc": 100, "NumGC": 3, "PauseNs": [1, 2], "BySize": [{"Size": 8}]},
+			"app": {"cache": {"hits": 7, "name": "lru"}}}`
+		status := http.StatusOK
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			rw.WriteHeader(status)
+			_, _ = rw.Write([]byte(body))
+		}))
+		defer server.Close()
+		var handled []error
+		scraper := NewExpvarScraper(server.URL + "/debug/vars")
+		scraper.ErrorHandler = func(err error) error {
+			handled = append(handled, err)
+			return nil
+		}
+		scraper.Dimensions = map[string]string{"app": "test"}
+		Convey("should flatten numeric expvars", func() {
+			dps := scraper.Datapoints()
+			So(handled, ShouldBeEmpty)
+			So(scraper.LastError(), ShouldBeNil)
+			So(findDatapoint(dps, "requests").Value, ShouldResemble, datapoint.NewIntValue(12))
+			So(findDatapoint(dps, "requests").MetricType, ShouldEqual, datapoint.Gauge)
+			So(findDatapoint(dps, "requests").Dimensions, ShouldResemble, map[string]string{"app": "test"})
+			So(findDatapoint(dps, "ratio").Value, ShouldResemble, datapoint.NewFloatValue(0.5))
+			So(findDatapoint(dps, "huge").Value, ShouldResemble, datapoint.NewFloatValue(18446744073709551615))
+			So(findDatapoint(dps, "memstats.HeapAlloc").MetricType, ShouldEqual, datapoint.Gauge)
+			So(findDatapoint(dps, "memstats.NumGC").MetricType, ShouldEqual, datapoint.Counter)
+			So(findDatapoint(dps, "app.cache.hits").Value, ShouldResemble, datapoint.NewIntValue(7))
+			So(findDatapoint(dps, "cmdline"), ShouldBeNil)
+			So(findDatapoint(dps, "on"), ShouldBeNil)
+			So(findDatapoint(dps, "app.cache.name"), ShouldBeNil)
+			So(findDatapoint(dps, "memstats.PauseNs"), ShouldBeNil)
+			So(findDatapoint(dps, "total_expvar_scrapes").Value, ShouldResemble, datapoint.NewIntValue(1))
+			So(len(dps), ShouldEqual, 8)
+		})
+		Convey("should filter and rename", func() {
+			scraper.Allow = []string{"memstats.*", "app.*.*"}
+			scraper.Deny = []string{"memstats.NumGC"}
+			scraper.Cumulatives = []string{"app.cache.hits"}
+			scraper.MetricName = func(name string) string {
+				if name == "memstats.HeapAlloc" {
+					return ""
+				}
+				return "myapp." + strings.ReplaceAll(name, ".", "_")
+			}
+			dps, err := scraper.Scrape(context.Background())
+			So(err, ShouldBeNil)
+			So(len(dps), ShouldEqual, 1)
+			So(dps[0].Metric, ShouldEqual, "myapp.app_cache_hits")
+			So(dps[0].MetricType, ShouldEqual, datapoint.Counter)
+		})
+		Convey("should report failed scrapes", func() {
+			status = http.StatusInternalServerError
+			dps := scraper.Datapoints()
+			So(len(handled), ShouldEqual, 1)
+			So(scraper.LastError(), ShouldEqual, handled[0])
+			So(handled[0].Error(), ShouldContainSubstring, "500")
+			So(len(dps), ShouldEqual, 2)
+			So(findDatapoint(dps, "total_expvar_scrape_errors").Value, ShouldResemble, datapoint.NewIntValue(1))
+		})
+		Convey("should report invalid JSON", func() {
+			body = `{`
+			_, err := scraper.Scrape(context.Background())
+			So(err, ShouldNotBeNil)
+		})
+		Convey("should report bad URLs and unreachable servers", func() {
+			scraper.URL = "%gh&%ij"
+			_, err := scraper.Scrape(context.Background())
+			So(err, ShouldNotBeNil)
+			scraper.URL = "http://127.0.0.1:1/debug/vars"
+			scraper.Client = nil
+			_, err = scraper.Scrape(context.Background())
+			So(err, ShouldNotBeNil)
+		})
+		Convey("should work without an error handler", func() {
+			scraper.ErrorHandler = nil
+			scraper.URL = "%gh&%ij"
+			So(len(scraper.Datapoints()), ShouldEqual, 2)
+			So(scraper.LastError(), ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,534 @@
+package sfxclient
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/errors"
+	"github.com/signalfx/golib/v3/event"
+	"github.com/signalfx/golib/v3/sfxclient/decoder"
+	"github.com/signalfx/golib/v3/timekeeper"
+	"github.com/signalfx/golib/v3/trace"
+)
+
+// FileFormat is how a FileSink writes its files
+type FileFormat int
+
+const (
+	// FileFormatJSON writes one datapoint, event or span per line as JSON
+	FileFormatJSON FileFormat = iota
+	// FileFormatProtobuf writes each call as a length prefixed record holding the protobuf HTTPSink would
+	// send.  Spans, which have no SignalFx protobuf, are held as JSON.
+	FileFormatProtobuf
+)
+
+const (
+	// DefaultMaxFileBytes is the size a FileSink file grows to before the sink moves on to a new one
+	DefaultMaxFileBytes = 64 << 20
+
+	fileExtJSON     = ".ndjson"
+	fileExtProtobuf = ".pb"
+
+	// replayBatchSize is the most items Replay sends in one call from a JSON file
+	replayBatchSize = 1000
+)
+
+// the kinds of record in a protobuf file
+const (
+	fileRecordDatapoints byte = iota + 1
+	fileRecordEvents
+	fileRecordSpans
+)
+
+// FileSink writes datapoints, events and spans to files instead of sending them, to capture data where
+// there's no network or to record test fixtures.  Files are rotated once they reach MaxFileBytes and can
+// be sent on later with Replay.
+type FileSink struct {
+	// Dir is the directory files are written to
+	Dir string
+	// Prefix starts the name of every file
+	Prefix string
+	Format FileFormat
+	// MaxFileBytes is the size a file grows to before a new one is started.  A single call is never split
+	// across files, so a file can be bigger.
+	MaxFileBytes int64
+	// MaxFiles is the most files kept, removing the oldest ones.  Zero keeps them all.
+	MaxFiles int
+	// Timer timestamps file names
+	Timer timekeeper.TimeKeeper
+
+	mu    sync.Mutex
+	file  *os.File
+	size  int64
+	seq   int64
+	files []string
+	// encoder encodes protobuf records the same way HTTPSink encodes request bodies
+	encoder *HTTPSink
+}
+
+var _ FullSink = &FileSink{}
+
+// NewFileSink creates a FileSink writing JSON files to dir
+func NewFileSink(dir string) *FileSink {
+	return &FileSink{
+		Dir:          dir,
+		Prefix:       "sfx",
+		Format:       FileFormatJSON,
+		MaxFileBytes: DefaultMaxFileBytes,
+		Timer:        timekeeper.RealTime{},
+		encoder:      &HTTPSink{protoMarshaler: proto.Marshal},
+	}
+}
+
+// AddDatapoints writes points to the current file
+func (f *FileSink) AddDatapoints(ctx context.Context, points []*datapoint.Datapoint) error {
+	if len(points) == 0 {
+		return nil
+	}
+	if f.Format == FileFormatProtobuf {
+		return writeRecord(f, fileRecordDatapoints, points, f.encoder.marshalDatapoints)
+	}
+	return writeLines(f, points, func(dp *datapoint.Datapoint) fileLine {
+		return fileLine{Datapoint: toFileDatapoint(dp)}
+	})
+}
+
+// AddEvents writes events to the current file
+func (f *FileSink) AddEvents(ctx context.Context, events []*event.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	if f.Format == FileFormatProtobuf {
+		return writeRecord(f, fileRecordEvents, events, f.encoder.marshalEvents)
+	}
+	return writeLines(f, events, func(ev *event.Event) fileLine {
+		return fileLine{Event: &fileEvent{
+			EventType:  ev.EventType,
+			Category:   ev.Category,
+			Dimensions: ev.Dimensions,
+			Properties: ev.Properties,
+			Timestamp:  ev.Timestamp,
+		}}
+	})
+}
+
+// AddSpans writes spans to the current file
+func (f *FileSink) AddSpans(ctx context.Context, spans []*trace.Span) error {
+	if len(spans) == 0 {
+		return nil
+	}
+	if f.Format == FileFormatProtobuf {
+		return writeRecord(f, fileRecordSpans, spans, func(spans []*trace.Span) ([]byte, error) {
+			return json.Marshal(spans)
+		})
+	}
+	return writeLines(f, spans, func(span *trace.Span) fileLine {
+		return fileLine{Span: span}
+	})
+}
+
+// Close closes the current file.  The next call starts a new one.
+func (f *FileSink) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.closeFile()
+}
+
+// writeRecord writes items as a record: its kind, the uvarint length of the encoded items, then the
+// encoded items
+func writeRecord[T any](f *FileSink, kind byte, items []T, encode func([]T) ([]byte, error)) error {
+	body, err := encode(items)
+	if err != nil {
+		return errors.Annotate(err, "cannot encode record")
+	}
+	var buf bytes.Buffer
+	buf.WriteByte(kind)
+	var n [binary.MaxVarintLen64]byte
+	buf.Write(n[:binary.PutUvarint(n[:], uint64(len(body)))])
+	buf.Write(body)
+	return f.write(buf.Bytes())
+}
+
+// writeLines writes each item as a line of JSON
+func writeLines[T any](f *FileSink, items []T, line func(T) fileLine) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, item := range items {
+		if err := enc.Encode(line(item)); err != nil {
+			return errors.Annotate(err, "cannot encode line")
+		}
+	}
+	return f.write(buf.Bytes())
+}
+
+// write appends b to the current file, starting a new one first if the current one is full
+func (f *FileSink) write(b []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file != nil && f.MaxFileBytes > 0 && f.size > 0 && f.size+int64(len(b)) > f.MaxFileBytes {
+		if err := f.closeFile(); err != nil {
+			return err
+		}
+	}
+	if f.file == nil {
+		if err := f.openFile(); err != nil {
+			return err
+		}
+	}
+	n, err := f.file.Write(b)
+	f.size += int64(n)
+	return errors.Annotatef(err, "cannot write to %s", f.file.Name())
+}
+
+// openFile starts a new file, removing the oldest ones past MaxFiles
+func (f *FileSink) openFile() error {
+	if err := os.MkdirAll(f.Dir, 0750); err != nil {
+		return errors.Annotatef(err, "cannot create %s", f.Dir)
+	}
+	ext := fileExtJSON
+	if f.Format == FileFormatProtobuf {
+		ext = fileExtProtobuf
+	}
+	f.seq++
+	name := filepath.Join(f.Dir, fmt.Sprintf("%s-%s-%06d%s", f.Prefix, f.Timer.Now().UTC().Format("20060102T150405.000000000"), f.seq, ext))
+	file, err := os.OpenFile(filepath.Clean(name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return errors.Annotatef(err, "cannot create %s", name)
+	}
+	f.file = file
+	f.size = 0
+	f.files = append(f.files, name)
+	for f.MaxFiles > 0 && len(f.files) > f.MaxFiles {
+		if err := os.Remove(f.files[0]); err != nil && !os.IsNotExist(err) {
+			return errors.Annotatef(err, "cannot remove %s", f.files[0])
+		}
+		f.files = f.files[1:]
+	}
+	return nil
+}
+
+func (f *FileSink) closeFile() error {
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return errors.Annotate(err, "cannot close file")
+}
+
+// fileLine is a line of a JSON file, holding one of a datapoint, event or span
+type fileLine struct {
+	Datapoint *fileDatapoint `json:"datapoint,omitempty"`
+	Event     *fileEvent     `json:"event,omitempty"`
+	Span      *trace.Span    `json:"span,omitempty"`
+}
+
+// fileDatapoint keeps the type of a datapoint's value, so a float that happens to be whole is still a float
+// when it's read back
+type fileDatapoint struct {
+	Metric     string               `json:"metric"`
+	Dimensions map[string]string    `json:"dimensions,omitempty"`
+	MetricType datapoint.MetricType `json:"metric_type"`
+	Timestamp  time.Time            `json:"timestamp"`
+	Int        *int64               `json:"int,omitempty"`
+	Float      *float64             `json:"float,omitempty"`
+	String     *string              `json:"string,omitempty"`
+	Histogram  *fileHistogram       `json:"histogram,omitempty"`
+}
+
+type fileHistogram struct {
+	Bounds []float64 `json:"bounds"`
+	Counts []uint64  `json:"counts"`
+	Sum    float64   `json:"sum"`
+}
+
+func toFileDatapoint(dp *datapoint.Datapoint) *fileDatapoint {
+	ret := &fileDatapoint{
+		Metric:     dp.Metric,
+		Dimensions: dp.Dimensions,
+		MetricType: dp.MetricType,
+		Timestamp:  dp.Timestamp,
+	}
+	switch v := dp.Value.(type) {
+	case datapoint.IntValue:
+		i := v.Int()
+		ret.Int = &i
+	case datapoint.FloatValue:
+		f := v.Float()
+		ret.Float = &f
+	case datapoint.HistogramValue:
+		ret.Histogram = &fileHistogram{Bounds: v.Bounds(), Counts: v.Counts(), Sum: v.Sum()}
+	case nil:
+	default:
+		s := v.String()
+		ret.String = &s
+	}
+	return ret
+}
+
+func (p *fileDatapoint) datapoint() (*datapoint.Datapoint, error) {
+	var value datapoint.Value
+	switch {
+	case p.Histogram != nil:
+		hv, err := datapoint.NewHistogramValue(p.Histogram.Bounds, p.Histogram.Counts, p.Histogram.Sum)
+		if err != nil {
+			return nil, err
+		}
+		value = hv
+	case p.Int != nil:
+		value = datapoint.NewIntValue(*p.Int)
+	case p.Float != nil:
+		value = datapoint.NewFloatValue(*p.Float)
+	case p.String != nil:
+		value = datapoint.NewStringValue(*p.String)
+	}
+	return datapoint.New(p.Metric, p.Dimensions, value, p.MetricType, p.Timestamp), nil
+}
+
+type fileEvent struct {
+	EventType  string                 `json:"eventType"`
+	Category   event.Category         `json:"category"`
+	Dimensions map[string]string      `json:"dimensions,omitempty"`
+	Properties map[string]interface{} `json:"properties,omitempty"`
+	Timestamp  time.Time              `json:"timestamp"`
+}
+
+func (e *fileEvent) event() *event.Event {
+	props := make(map[string]interface{}, len(e.Properties))
+	for k, v := range e.Properties {
+		if n, ok := v.(json.Number); ok {
+			if i, err := n.Int64(); err == nil {
+				v = i
+			} else if f, err := n.Float64(); err == nil {
+				v = f
+			}
+		}
+		props[k] = v
+	}
+	return event.NewWithProperties(e.EventType, e.Category, e.Dimensions, props, e.Timestamp)
+}
+
+// replayDecoder reads protobuf records back.  They were written by FileSink, not an untrusted client, so
+// nothing in them is too big.
+var replayDecoder = &decoder.Decoder{Limits: decoder.Limits{
+	MaxBodyBytes:    math.MaxInt32,
+	MaxItems:        math.MaxInt32,
+	MaxStringLength: math.MaxInt32,
+	MaxDimensions:   math.MaxInt32,
+}}
+
+// Replay sends what a FileSink wrote to path, a file or a directory of them, on to sink.  A directory's
+// files are sent oldest first.  Events and spans are only sent if sink has AddEvents or AddSpans, and are
+// skipped if it doesn't.
+func Replay(ctx context.Context, path string, sink Sink) error {
+	files, err := replayFiles(path)
+	if err != nil {
+		return err
+	}
+	r := &replayer{sink: sink}
+	r.events, _ = sink.(EventSink)
+	r.spans, _ = sink.(trace.Sink)
+	for _, name := range files {
+		if err := r.replayFile(ctx, name); err != nil {
+			return errors.Annotatef(err, "cannot replay %s", name)
+		}
+	}
+	return nil
+}
+
+// replayFiles lists the files at path in the order they were written
+func replayFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, errors.Annotatef(err, "cannot replay %s", path)
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, errors.Annotatef(err, "cannot list %s", path)
+	}
+	files := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if ext := filepath.Ext(entry.Name()); !entry.IsDir() && (ext == fileExtJSON || ext == fileExtProtobuf) {
+			files = append(files, filepath.Join(path, entry.Name()))
+		}
+	}
+	return files, nil
+}
+
+// EventSink is anything events can be sent to, like HTTPSink
+type EventSink interface {
+	AddEvents(ctx context.Context, events []*event.Event) error
+}
+
+type replayer struct {
+	sink   Sink
+	events EventSink
+	spans  trace.Sink
+
+	// what's been read from a JSON file but not yet sent
+	pendingPoints []*datapoint.Datapoint
+	pendingEvents []*event.Event
+	pendingSpans  []*trace.Span
+}
+
+func (r *replayer) replayFile(ctx context.Context, name string) (err error) {
+	file, err := os.Open(filepath.Clean(name))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+	in := bufio.NewReader(file)
+	if filepath.Ext(name) == fileExtProtobuf {
+		return r.replayProtobuf(ctx, in)
+	}
+	return r.replayJSON(ctx, in)
+}
+
+// replayJSON sends the lines of a JSON file in batches of up to replayBatchSize items of the same kind
+func (r *replayer) replayJSON(ctx context.Context, in *bufio.Reader) error {
+	for {
+		b, err := in.ReadBytes('\n')
+		if len(bytes.TrimSpace(b)) > 0 {
+			if lineErr := r.replayLine(ctx, b); lineErr != nil {
+				return lineErr
+			}
+		}
+		if err == io.EOF {
+			return r.flush(ctx)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (r *replayer) replayLine(ctx context.Context, b []byte) error {
+	var line fileLine
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&line); err != nil {
+		return errors.Annotate(err, "cannot decode line")
+	}
+	switch {
+	case line.Datapoint != nil:
+		if len(r.pendingEvents)+len(r.pendingSpans) > 0 {
+			if err := r.flush(ctx); err != nil {
+				return err
+			}
+		}
+		dp, err := line.Datapoint.datapoint()
+		if err != nil {
+			return errors.Annotate(err, "cannot decode datapoint")
+		}
+		r.pendingPoints = append(r.pendingPoints, dp)
+	case line.Event != nil:
+		if len(r.pendingPoints)+len(r.pendingSpans) > 0 {
+			if err := r.flush(ctx); err != nil {
+				return err
+			}
+		}
+		r.pendingEvents = append(r.pendingEvents, line.Event.event())
+	case line.Span != nil:
+		if len(r.pendingPoints)+len(r.pendingEvents) > 0 {
+			if err := r.flush(ctx); err != nil {
+				return err
+			}
+		}
+		r.pendingSpans = append(r.pendingSpans, line.Span)
+	}
+	if len(r.pendingPoints)+len(r.pendingEvents)+len(r.pendingSpans) >= replayBatchSize {
+		return r.flush(ctx)
+	}
+	return nil
+}
+
+// flush sends what's pending
+func (r *replayer) flush(ctx context.Context) error {
+	points, events, spans := r.pendingPoints, r.pendingEvents, r.pendingSpans
+	r.pendingPoints, r.pendingEvents, r.pendingSpans = nil, nil, nil
+	return r.send(ctx, points, events, spans)
+}
+
+func (r *replayer) send(ctx context.Context, points []*datapoint.Datapoint, events []*event.Event, spans []*trace.Span) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if len(points) > 0 {
+		return r.sink.AddDatapoints(ctx, points)
+	}
+	if len(events) > 0 && r.events != nil {
+		return r.events.AddEvents(ctx, events)
+	}
+	if len(spans) > 0 && r.spans != nil {
+		return r.spans.AddSpans(ctx, spans)
+	}
+	return nil
+}
+
+// replayProtobuf sends each record of a protobuf file in a call of its own
+func (r *replayer) replayProtobuf(ctx context.Context, in *bufio.Reader) error {
+	for {
+		kind, err := in.ReadByte()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		size, err := binary.ReadUvarint(in)
+		if err != nil {
+			return errors.Annotate(err, "cannot read record length")
+		}
+		body := make([]byte, size)
+		if _, err := io.ReadFull(in, body); err != nil {
+			return errors.Annotate(err, "cannot read record")
+		}
+		if err := r.replayRecord(ctx, kind, body); err != nil {
+			return err
+		}
+	}
+}
+
+func (r *replayer) replayRecord(ctx context.Context, kind byte, body []byte) error {
+	switch kind {
+	case fileRecordDatapoints:
+		points, err := replayDecoder.DatapointsProtobuf(bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		return r.send(ctx, points, nil, nil)
+	case fileRecordEvents:
+		events, err := replayDecoder.EventsProtobuf(bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		return r.send(ctx, nil, events, nil)
+	case fileRecordSpans:
+		var spans []*trace.Span
+		if err := json.Unmarshal(body, &spans); err != nil {
+			return errors.Annotate(err, "cannot decode spans")
+		}
+		return r.send(ctx, nil, nil, spans)
+	default:
+		return errors.Errorf("unknown record kind %d", kind)
+	}
+}
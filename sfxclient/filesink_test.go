@@ -0,0 +1,132 @@
+package sfxclient
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/errors"
+	"github.com/signalfx/golib/v3/event"
+	"github.com/signalfx/golib/v3/timekeeper/timekeepertest"
+	"github.com/signalfx/golib/v3/trace"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// datapointSink is a Sink with nothing but AddDatapoints
+type datapointSink struct {
+	points []*datapoint.Datapoint
+}
+
+func (d *datapointSink) AddDatapoints(ctx context.Context, points []*datapoint.Datapoint) error {
+	d.points = append(d.points, points...)
+	return nil
+}
+
+func TestFileSink(t *testing.T) {
+	Convey("A FileSink", t, func() {
+		ctx := context.Background()
+		dir := t.TempDir()
+		now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+		f := NewFileSink(dir)
+		f.Timer = timekeepertest.NewStubClock(now)
+		points := []*datapoint.Datapoint{
+			Gauge("ints", map[string]string{"host": "a"}, 3),
+			datapoint.New("floats", nil, datapoint.NewFloatValue(2), datapoint.Counter, now),
+			datapoint.New("strings", nil, datapoint.NewStringValue("up"), datapoint.Enum, now),
+		}
+		events := []*event.Event{event.NewWithProperties("deploy", event.USERDEFINED, map[string]string{"service": "api"},
+			map[string]interface{}{"version": int64(7), "ratio": 0.5, "who": "me"}, now)}
+		spans := []*trace.Span{{TraceID: "fa281a8955571a3a", ID: "acdfec5be6328c3a", Tags: map[string]string{"k": "v"}}}
+		write := func() {
+			So(f.AddDatapoints(ctx, points), ShouldBeNil)
+			So(f.AddEvents(ctx, events), ShouldBeNil)
+			So(f.AddSpans(ctx, spans), ShouldBeNil)
+			So(f.AddDatapoints(ctx, nil), ShouldBeNil)
+			So(f.Close(), ShouldBeNil)
+		}
+		files := func() []string {
+			entries, err := os.ReadDir(dir)
+			So(err, ShouldBeNil)
+			names := make([]string, 0, len(entries))
+			for _, entry := range entries {
+				names = append(names, entry.Name())
+			}
+			return names
+		}
+
+		Convey("should write JSON lines that replay", func() {
+			write()
+			So(files(), ShouldResemble, []string{"sfx-20210601T120000.000000000-000001.ndjson"})
+			b, err := ioutil.ReadFile(filepath.Join(dir, files()[0]))
+			So(err, ShouldBeNil)
+			So(string(b), ShouldStartWith, `{"datapoint":{"metric":"ints","dimensions":{"host":"a"},"metric_type":0,`)
+			got := &recordingSink{}
+			So(Replay(ctx, dir, got), ShouldBeNil)
+			So(got.calls, ShouldEqual, 3)
+			So(got.points, ShouldResemble, points)
+			So(got.events, ShouldResemble, events)
+			So(got.spans, ShouldResemble, spans)
+		})
+		Convey("should write protobuf records that replay", func() {
+			f.Format = FileFormatProtobuf
+			write()
+			So(files(), ShouldResemble, []string{"sfx-20210601T120000.000000000-000001.pb"})
+			got := &recordingSink{}
+			So(Replay(ctx, filepath.Join(dir, files()[0]), got), ShouldBeNil)
+			So(got.calls, ShouldEqual, 3)
+			So(len(got.points), ShouldEqual, 3)
+			So(got.points[1].Value, ShouldResemble, datapoint.NewFloatValue(2))
+			So(got.points[2].Value.String(), ShouldEqual, "up")
+			So(got.events[0].Properties, ShouldResemble, events[0].Properties)
+			So(got.spans, ShouldResemble, spans)
+		})
+		Convey("should rotate files", func() {
+			f.MaxFileBytes = 1
+			f.MaxFiles = 2
+			write()
+			So(files(), ShouldResemble, []string{
+				"sfx-20210601T120000.000000000-000002.ndjson",
+				"sfx-20210601T120000.000000000-000003.ndjson",
+			})
+			got := &recordingSink{}
+			So(Replay(ctx, dir, got), ShouldBeNil)
+			So(len(got.points), ShouldEqual, 0)
+			So(got.events, ShouldResemble, events)
+			So(got.spans, ShouldResemble, spans)
+		})
+		Convey("should replay only datapoints to a sink that takes nothing else", func() {
+			write()
+			got := &datapointSink{}
+			So(Replay(ctx, dir, got), ShouldBeNil)
+			So(got.points, ShouldResemble, points)
+		})
+		Convey("should not replay", func() {
+			Convey("what isn't there", func() {
+				So(Replay(ctx, filepath.Join(dir, "missing"), &recordingSink{}), ShouldNotBeNil)
+			})
+			Convey("a truncated record", func() {
+				f.Format = FileFormatProtobuf
+				write()
+				name := filepath.Join(dir, files()[0])
+				b, err := ioutil.ReadFile(name)
+				So(err, ShouldBeNil)
+				So(ioutil.WriteFile(name, b[:len(b)-1], 0600), ShouldBeNil)
+				So(Replay(ctx, dir, &recordingSink{}), ShouldNotBeNil)
+			})
+			Convey("a bad line", func() {
+				So(ioutil.WriteFile(filepath.Join(dir, "bad.ndjson"), []byte("{\n"), 0600), ShouldBeNil)
+				So(Replay(ctx, dir, &recordingSink{}), ShouldNotBeNil)
+			})
+			Convey("once the context is done", func() {
+				write()
+				cancelled, cancel := context.WithCancel(ctx)
+				cancel()
+				So(errors.Cause(Replay(cancelled, dir, &recordingSink{})), ShouldEqual, context.Canceled)
+			})
+		})
+	})
+}
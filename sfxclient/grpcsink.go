@@ -0,0 +1,218 @@
+package sfxclient
+
+import (
+	"context"
+	"crypto/tls"
+	"sync/atomic"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/errors"
+	"github.com/signalfx/golib/v3/event"
+	"github.com/signalfx/golib/v3/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// DefaultGRPCEndpoint is the OTLP/gRPC port of a local OpenTelemetry collector
+	DefaultGRPCEndpoint = "localhost:4317"
+
+	otlpMetricsExportMethod = "/opentelemetry.proto.collector.metrics.v1.MetricsService/Export"
+	otlpTracesExportMethod  = "/opentelemetry.proto.collector.trace.v1.TraceService/Export"
+	otlpLogsExportMethod    = "/opentelemetry.proto.collector.logs.v1.LogsService/Export"
+)
+
+// DefaultGRPCKeepalive pings idle connections so gateways and load balancers don't silently drop them
+var DefaultGRPCKeepalive = keepalive.ClientParameters{
+	Time:                30 * time.Second,
+	Timeout:             10 * time.Second,
+	PermitWithoutStream: true,
+}
+
+// GRPCSink sends datapoints, events and spans as OTLP over gRPC, for deployments behind gRPC-only gateways.
+// Events are sent as OTLP logs.
+type GRPCSink struct {
+	// AuthToken is sent when the context has no token, see TokenFromContext
+	AuthToken string
+	// Timeout is the deadline of each export RPC
+	Timeout time.Duration
+	// Deterministic orders dimensions, properties and span tags by key
+	Deterministic bool
+
+	conn        *grpc.ClientConn
+	tlsConfig   *tls.Config
+	keepalive   keepalive.ClientParameters
+	dialOptions []grpc.DialOption
+
+	stats struct {
+		otlpDroppedDatapoints int64
+	}
+}
+
+// GRPCSinkOption can be passed to NewGRPCSink to customize it's behaviour
+type GRPCSinkOption func(*GRPCSink)
+
+// WithGRPCTLS configures GRPCSink to connect with TLS using config instead of in plain text
+func WithGRPCTLS(config *tls.Config) GRPCSinkOption {
+	return func(s *GRPCSink) {
+		s.tlsConfig = config
+	}
+}
+
+// WithGRPCKeepalive configures how GRPCSink pings its connection, instead of DefaultGRPCKeepalive
+func WithGRPCKeepalive(params keepalive.ClientParameters) GRPCSinkOption {
+	return func(s *GRPCSink) {
+		s.keepalive = params
+	}
+}
+
+// WithGRPCTimeout configures the deadline of each export RPC, instead of DefaultTimeout
+func WithGRPCTimeout(timeout time.Duration) GRPCSinkOption {
+	return func(s *GRPCSink) {
+		s.Timeout = timeout
+	}
+}
+
+// WithGRPCDialOptions adds opts to the options GRPCSink dials its connection with
+func WithGRPCDialOptions(opts ...grpc.DialOption) GRPCSinkOption {
+	return func(s *GRPCSink) {
+		s.dialOptions = append(s.dialOptions, opts...)
+	}
+}
+
+// NewGRPCSink connects a GRPCSink to target, like DefaultGRPCEndpoint.  Like grpc.Dial the connection is
+// established in the background, so an unreachable target fails the exports rather than NewGRPCSink.
+func NewGRPCSink(target string, opts ...GRPCSinkOption) (*GRPCSink, error) {
+	s := &GRPCSink{
+		Timeout:   DefaultTimeout,
+		keepalive: DefaultGRPCKeepalive,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	creds := insecure.NewCredentials()
+	if s.tlsConfig != nil {
+		creds = credentials.NewTLS(s.tlsConfig)
+	}
+	dialOptions := append([]grpc.DialOption{
+		grpc.WithTransportCredentials(creds),
+		grpc.WithKeepaliveParams(s.keepalive),
+		grpc.WithUserAgent(DefaultUserAgent),
+	}, s.dialOptions...)
+	conn, err := grpc.Dial(target, dialOptions...)
+	if err != nil {
+		return nil, errors.Annotatef(err, "cannot dial %s", target)
+	}
+	s.conn = conn
+	return s, nil
+}
+
+// AddDatapoints exports the datapoints OTLP can represent, see OTLPDroppedDatapoints
+func (s *GRPCSink) AddDatapoints(ctx context.Context, points []*datapoint.Datapoint) error {
+	if len(points) == 0 {
+		return nil
+	}
+	body, encoded := s.otlp().metrics(points)
+	if dropped := len(points) - encoded; dropped > 0 {
+		atomic.AddInt64(&s.stats.otlpDroppedDatapoints, int64(dropped))
+	}
+	if encoded == 0 {
+		return nil
+	}
+	return s.export(ctx, otlpMetricsExportMethod, body)
+}
+
+// AddEvents exports the events as OTLP logs
+func (s *GRPCSink) AddEvents(ctx context.Context, events []*event.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	return s.export(ctx, otlpLogsExportMethod, s.otlp().logs(events))
+}
+
+// AddSpans exports the spans, failing with a *spanfilter.Map if any have invalid IDs
+func (s *GRPCSink) AddSpans(ctx context.Context, spans []*trace.Span) error {
+	if len(spans) == 0 {
+		return nil
+	}
+	body, err := s.otlp().traces(spans)
+	if err != nil {
+		return err
+	}
+	return s.export(ctx, otlpTracesExportMethod, body)
+}
+
+// Close closes the connection
+func (s *GRPCSink) Close() error {
+	return s.conn.Close()
+}
+
+// OTLPDroppedDatapoints is how many datapoints have been left out because OTLP can't represent them, like
+// datapoints with string values
+func (s *GRPCSink) OTLPDroppedDatapoints() int64 {
+	return atomic.LoadInt64(&s.stats.otlpDroppedDatapoints)
+}
+
+// otlp is the encoder GRPCSink sends OTLP with
+func (s *GRPCSink) otlp() otlpEncoder {
+	return otlpEncoder{deterministic: s.Deterministic}
+}
+
+// export calls the OTLP export method with body, sending the token from ctx, falling back to AuthToken
+func (s *GRPCSink) export(ctx context.Context, method string, body []byte) error {
+	resp, err := s.invoke(ctx, method, body)
+	if err != nil {
+		return err
+	}
+	return otlpResponseValidator(resp)
+}
+
+// invoke calls method with the encoded request body, returning the encoded response
+func (s *GRPCSink) invoke(ctx context.Context, method string, body []byte) ([]byte, error) {
+	tok, ok := TokenFromContext(ctx)
+	if !ok {
+		tok = Token{Value: s.AuthToken}
+	}
+	if tok.Value != "" {
+		name, value := tok.header(nil)
+		ctx = metadata.AppendToOutgoingContext(ctx, name, value)
+	}
+	if s.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Timeout)
+		defer cancel()
+	}
+	var resp []byte
+	if err := s.conn.Invoke(ctx, method, body, &resp, grpc.ForceCodec(otlpCodec{})); err != nil {
+		return nil, errors.Annotatef(err, "cannot export to %s", method)
+	}
+	return resp, nil
+}
+
+// otlpCodec passes the OTLP messages otlpEncoder encodes through to gRPC as is
+type otlpCodec struct{}
+
+func (otlpCodec) Marshal(v interface{}) ([]byte, error) {
+	b, ok := v.([]byte)
+	if !ok {
+		return nil, errors.Errorf("cannot marshal %T", v)
+	}
+	return b, nil
+}
+
+func (otlpCodec) Unmarshal(data []byte, v interface{}) error {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return errors.Errorf("cannot unmarshal into %T", v)
+	}
+	*b = append((*b)[:0], data...)
+	return nil
+}
+
+func (otlpCodec) Name() string {
+	return "proto"
+}
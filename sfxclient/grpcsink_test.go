@@ -0,0 +1,150 @@
+package sfxclient
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/event"
+	"github.com/signalfx/golib/v3/pointer"
+	"github.com/signalfx/golib/v3/trace"
+	. "github.com/smartystreets/goconvey/convey"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type grpcExport struct {
+	method string
+	md     metadata.MD
+	body   []byte
+}
+
+// grpcCollector is an OTLP/gRPC server that records the exports it receives and replies with resp
+type grpcCollector struct {
+	server  *grpc.Server
+	addr    string
+	exports chan grpcExport
+	resp    []byte
+	err     error
+}
+
+func newGRPCCollector() *grpcCollector {
+	c := &grpcCollector{exports: make(chan grpcExport, 10)}
+	c.server = grpc.NewServer(grpc.ForceServerCodec(otlpCodec{}), grpc.UnknownServiceHandler(c.handle))
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	So(err, ShouldBeNil)
+	c.addr = l.Addr().String()
+	go func() {
+		_ = c.server.Serve(l)
+	}()
+	return c
+}
+
+func (c *grpcCollector) handle(srv interface{}, stream grpc.ServerStream) error {
+	method, _ := grpc.MethodFromServerStream(stream)
+	md, _ := metadata.FromIncomingContext(stream.Context())
+	var body []byte
+	if err := stream.RecvMsg(&body); err != nil {
+		return err
+	}
+	c.exports <- grpcExport{method: method, md: md, body: body}
+	if c.err != nil {
+		return c.err
+	}
+	return stream.SendMsg(c.resp)
+}
+
+func TestGRPCSink(t *testing.T) {
+	Convey("A GRPCSink", t, func() {
+		collector := newGRPCCollector()
+		defer collector.server.Stop()
+		sink, err := NewGRPCSink(collector.addr, WithGRPCTimeout(time.Second))
+		So(err, ShouldBeNil)
+		defer func() {
+			So(sink.Close(), ShouldBeNil)
+		}()
+		sink.AuthToken = "abc"
+		ctx := context.Background()
+		Convey("should export datapoints as metrics", func() {
+			points := []*datapoint.Datapoint{
+				GaugeF("g", map[string]string{"host": "a"}, 1),
+				datapoint.New("s", nil, datapoint.NewStringValue("x"), datapoint.Gauge, time.Now()),
+			}
+			So(sink.AddDatapoints(ctx, points), ShouldBeNil)
+			export := <-collector.exports
+			So(export.method, ShouldEqual, otlpMetricsExportMethod)
+			So(export.md.Get(TokenHeaderName), ShouldResemble, []string{"abc"})
+			metrics := decodeOTLP(export.body).message(1).message(2).all(2)
+			So(len(metrics), ShouldEqual, 1)
+			So(metrics[0].string(1), ShouldEqual, "g")
+			So(sink.OTLPDroppedDatapoints(), ShouldEqual, 1)
+		})
+		Convey("should export events as logs", func() {
+			ts := time.Unix(1600000000, 0)
+			ev := event.NewWithProperties("deploy", event.USERDEFINED, map[string]string{"host": "a"},
+				map[string]interface{}{"version": "1.2", "count": int64(3), "ok": true, "ratio": 0.5}, ts)
+			sink.Deterministic = true
+			So(sink.AddEvents(ctx, []*event.Event{ev}), ShouldBeNil)
+			export := <-collector.exports
+			So(export.method, ShouldEqual, otlpLogsExportMethod)
+			record := decodeOTLP(export.body).message(1).message(2).message(2)
+			So(record.numbers[1][0], ShouldEqual, uint64(ts.UnixNano()))
+			attrs := record.all(6)
+			So(len(attrs), ShouldEqual, 4)
+			So(attrs[0].string(1), ShouldEqual, "host")
+			So(attrs[0].message(2).string(1), ShouldEqual, "a")
+			So(attrs[1].string(1), ShouldEqual, otlpEventTypeKey)
+			So(attrs[1].message(2).string(1), ShouldEqual, "deploy")
+			So(attrs[2].string(1), ShouldEqual, otlpEventCategoryKey)
+			So(attrs[2].message(2).numbers[3][0], ShouldEqual, uint64(event.USERDEFINED))
+			So(attrs[3].string(1), ShouldEqual, otlpEventPropertiesKey)
+			properties := attrs[3].message(2).message(6).all(1)
+			So(len(properties), ShouldEqual, 4)
+			So(properties[0].string(1), ShouldEqual, "count")
+			So(properties[0].message(2).numbers[3][0], ShouldEqual, 3)
+			So(properties[1].string(1), ShouldEqual, "ok")
+			So(properties[1].message(2).numbers[2][0], ShouldEqual, 1)
+			So(properties[2].string(1), ShouldEqual, "ratio")
+			So(properties[2].message(2).numbers[4][0], ShouldEqual, 0x3fe0000000000000)
+			So(properties[3].message(2).string(1), ShouldEqual, "1.2")
+		})
+		Convey("should export spans as traces", func() {
+			span := &trace.Span{
+				TraceID:       "fa281a8955571a3a",
+				ID:            "acdfec5be6328c3a",
+				LocalEndpoint: &trace.Endpoint{ServiceName: pointer.String("api")},
+			}
+			So(sink.AddSpans(ctx, []*trace.Span{span}), ShouldBeNil)
+			export := <-collector.exports
+			So(export.method, ShouldEqual, otlpTracesExportMethod)
+			So(len(decodeOTLP(export.body).all(1)), ShouldEqual, 1)
+		})
+		Convey("should prefer the token from the context", func() {
+			ctx = context.WithValue(ctx, TokenCtxKey, Token{Value: "fromctx"})
+			So(sink.AddDatapoints(ctx, []*datapoint.Datapoint{GaugeF("g", nil, 1)}), ShouldBeNil)
+			So((<-collector.exports).md.Get(TokenHeaderName), ShouldResemble, []string{"fromctx"})
+		})
+		Convey("should report partial success", func() {
+			collector.resp = otlpMessage(nil, 1, otlpString(otlpVarint(nil, 1, 1), 2, "bad point"))
+			err := sink.AddDatapoints(ctx, []*datapoint.Datapoint{GaugeF("g", nil, 1)})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "1 were rejected: bad point")
+		})
+		Convey("should report failed RPCs", func() {
+			collector.err = status.Error(codes.Unavailable, "down")
+			err := sink.AddDatapoints(ctx, []*datapoint.Datapoint{GaugeF("g", nil, 1)})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "down")
+		})
+		Convey("should not send empty batches", func() {
+			So(sink.AddDatapoints(ctx, nil), ShouldBeNil)
+			So(sink.AddEvents(ctx, nil), ShouldBeNil)
+			So(sink.AddSpans(ctx, nil), ShouldBeNil)
+			So(len(collector.exports), ShouldEqual, 0)
+		})
+	})
+}
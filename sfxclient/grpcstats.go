@@ -0,0 +1,170 @@
+package sfxclient
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultGRPCLatencyBounds are the upper bounds, in milliseconds, of the latency buckets a GRPCStatsHandler
+// counts calls in by default
+var DefaultGRPCLatencyBounds = []float64{1, 2.5, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+// DefaultGRPCMaxMethods is how many methods a GRPCStatsHandler tracks by default
+const DefaultGRPCMaxMethods = 1000
+
+// grpcOtherMethod is the method calls of untracked methods are counted under
+const grpcOtherMethod = "other"
+
+// GRPCStatsHandler is a gRPC stats.Handler, for grpc.StatsHandler on servers and grpc.WithStatsHandler on
+// clients, and a Collector of what it sees: per method, a cumulative count of calls by status code, a
+// histogram of their latency in milliseconds and the messages and bytes sent and received.  Server calls
+// are reported as grpc.server.* and client calls as grpc.client.*, with method and, for calls, code
+// dimensions.
+type GRPCStatsHandler struct {
+	// Dimensions are added to every datapoint
+	Dimensions map[string]string
+	// LatencyBounds are the increasing upper bounds of the latency buckets, in milliseconds.  They can't change
+	// once calls are handled.
+	LatencyBounds []float64
+	// MaxMethods caps how many methods are tracked, so a client calling made up methods can't make a
+	// server report unbounded series.  Calls of methods past the cap are counted as the method "other".
+	MaxMethods int
+
+	mu      sync.Mutex
+	methods map[grpcMethodKey]*grpcMethodStats
+}
+
+var (
+	_ stats.Handler = &GRPCStatsHandler{}
+	_ Collector     = &GRPCStatsHandler{}
+)
+
+type grpcMethodKey struct {
+	client bool
+	method string
+}
+
+type grpcMethodStats struct {
+	calls            map[string]int64
+	latencyCounts    []uint64
+	latencySum       float64
+	sentMessages     int64
+	sentBytes        int64
+	receivedMessages int64
+	receivedBytes    int64
+}
+
+type grpcMethodCtxKey struct{}
+
+// NewGRPCStatsHandler creates a GRPCStatsHandler with DefaultGRPCLatencyBounds
+func NewGRPCStatsHandler(dimensions map[string]string) *GRPCStatsHandler {
+	return &GRPCStatsHandler{
+		Dimensions:    dimensions,
+		LatencyBounds: DefaultGRPCLatencyBounds,
+		MaxMethods:    DefaultGRPCMaxMethods,
+	}
+}
+
+// TagRPC remembers the method of the call in its context
+func (g *GRPCStatsHandler) TagRPC(ctx context.Context, info *stats.RPCTagInfo) context.Context {
+	return context.WithValue(ctx, grpcMethodCtxKey{}, info.FullMethodName)
+}
+
+// HandleRPC records the payloads and end of calls
+func (g *GRPCStatsHandler) HandleRPC(ctx context.Context, rs stats.RPCStats) {
+	method, _ := ctx.Value(grpcMethodCtxKey{}).(string)
+	switch s := rs.(type) {
+	case *stats.InPayload:
+		g.mu.Lock()
+		m := g.method(s.Client, method)
+		m.receivedMessages++
+		m.receivedBytes += int64(s.WireLength)
+		g.mu.Unlock()
+	case *stats.OutPayload:
+		g.mu.Lock()
+		m := g.method(s.Client, method)
+		m.sentMessages++
+		m.sentBytes += int64(s.WireLength)
+		g.mu.Unlock()
+	case *stats.End:
+		code := status.Code(s.Error).String()
+		latency := float64(s.EndTime.Sub(s.BeginTime)) / float64(time.Millisecond)
+		g.mu.Lock()
+		m := g.method(s.Client, method)
+		m.calls[code]++
+		bucket := len(g.LatencyBounds)
+		for i, bound := range g.LatencyBounds {
+			if latency <= bound {
+				bucket = i
+				break
+			}
+		}
+		m.latencyCounts[bucket]++
+		m.latencySum += latency
+		g.mu.Unlock()
+	}
+}
+
+// TagConn returns ctx
+func (g *GRPCStatsHandler) TagConn(ctx context.Context, info *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+// HandleConn does nothing
+func (g *GRPCStatsHandler) HandleConn(ctx context.Context, cs stats.ConnStats) {}
+
+// method returns the stats of method, or of the other method if there are too many.  g.mu must be held.
+func (g *GRPCStatsHandler) method(client bool, method string) *grpcMethodStats {
+	if g.methods == nil {
+		g.methods = make(map[grpcMethodKey]*grpcMethodStats)
+	}
+	key := grpcMethodKey{client: client, method: method}
+	m, exists := g.methods[key]
+	if exists {
+		return m
+	}
+	if g.MaxMethods > 0 && len(g.methods) >= g.MaxMethods {
+		key.method = grpcOtherMethod
+		if m, exists = g.methods[key]; exists {
+			return m
+		}
+	}
+	m = &grpcMethodStats{
+		calls:         make(map[string]int64),
+		latencyCounts: make([]uint64, len(g.LatencyBounds)+1),
+	}
+	g.methods[key] = m
+	return m
+}
+
+// Datapoints returns the stats of each method called
+func (g *GRPCStatsHandler) Datapoints() []*datapoint.Datapoint {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	dps := make([]*datapoint.Datapoint, 0, len(g.methods)*6)
+	for key, m := range g.methods {
+		prefix := "grpc.server."
+		if key.client {
+			prefix = "grpc.client."
+		}
+		dims := datapoint.AddMaps(g.Dimensions, map[string]string{"method": key.method})
+		for code, count := range m.calls {
+			dps = append(dps, Cumulative(prefix+"calls", datapoint.AddMaps(dims, map[string]string{"code": code}), count))
+		}
+		if latency, err := datapoint.NewHistogramValue(g.LatencyBounds, m.latencyCounts, m.latencySum); err == nil {
+			dps = append(dps, Histogram(prefix+"latency", dims, latency))
+		}
+		dps = append(dps,
+			Cumulative(prefix+"sent_messages", dims, m.sentMessages),
+			Cumulative(prefix+"sent_bytes", dims, m.sentBytes),
+			Cumulative(prefix+"received_messages", dims, m.receivedMessages),
+			Cumulative(prefix+"received_bytes", dims, m.receivedBytes),
+		)
+	}
+	return dps
+}
@@ -0,0 +1,74 @@
+package sfxclient
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	. "github.com/smartystreets/goconvey/convey"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
+)
+
+func TestGRPCStatsHandler(t *testing.T) {
+	Convey("a gRPC stats handler", t, func() {
+		g := NewGRPCStatsHandler(map[string]string{"app": "test"})
+		start := time.Unix(1600000000, 0)
+		call := func(client bool, method string, latency time.Duration, err error) {
+			ctx := g.TagRPC(context.Background(), &stats.RPCTagInfo{FullMethodName: method})
+			g.HandleRPC(ctx, &stats.Begin{Client: client, BeginTime: start})
+			g.HandleRPC(ctx, &stats.InPayload{Client: client, WireLength: 10})
+			g.HandleRPC(ctx, &stats.OutPayload{Client: client, WireLength: 20})
+			g.HandleRPC(ctx, &stats.End{Client: client, BeginTime: start, EndTime: start.Add(latency), Error: err})
+		}
+		find := func(dps []*datapoint.Datapoint, metric string, dims map[string]string) *datapoint.Datapoint {
+			for _, dp := range dps {
+				if dp.Metric == metric && dp.Dimensions["method"] == dims["method"] && dp.Dimensions["code"] == dims["code"] {
+					return dp
+				}
+			}
+			return nil
+		}
+		Convey("should count calls by method and code", func() {
+			call(false, "/svc/Get", time.Millisecond*3, nil)
+			call(false, "/svc/Get", time.Millisecond*30, nil)
+			call(false, "/svc/Get", time.Second*30, status.Error(codes.NotFound, "gone"))
+			call(true, "/svc/Get", time.Millisecond, nil)
+			dps := g.Datapoints()
+			ok := find(dps, "grpc.server.calls", map[string]string{"method": "/svc/Get", "code": "OK"})
+			So(ok.Value, ShouldResemble, datapoint.NewIntValue(2))
+			So(ok.MetricType, ShouldEqual, datapoint.Counter)
+			So(ok.Dimensions, ShouldResemble, map[string]string{"app": "test", "method": "/svc/Get", "code": "OK"})
+			So(find(dps, "grpc.server.calls", map[string]string{"method": "/svc/Get", "code": "NotFound"}).Value, ShouldResemble, datapoint.NewIntValue(1))
+			So(find(dps, "grpc.client.calls", map[string]string{"method": "/svc/Get", "code": "OK"}).Value, ShouldResemble, datapoint.NewIntValue(1))
+			latency := find(dps, "grpc.server.latency", map[string]string{"method": "/svc/Get"}).Value.(datapoint.HistogramValue)
+			So(latency.Bounds(), ShouldResemble, DefaultGRPCLatencyBounds)
+			So(latency.Count(), ShouldEqual, 3)
+			So(latency.Sum(), ShouldEqual, 30033)
+			So(latency.Counts()[2], ShouldEqual, 1)
+			So(latency.Counts()[5], ShouldEqual, 1)
+			So(latency.Counts()[len(DefaultGRPCLatencyBounds)], ShouldEqual, 1)
+			So(find(dps, "grpc.server.received_bytes", map[string]string{"method": "/svc/Get"}).Value, ShouldResemble, datapoint.NewIntValue(30))
+			So(find(dps, "grpc.server.sent_messages", map[string]string{"method": "/svc/Get"}).Value, ShouldResemble, datapoint.NewIntValue(3))
+			So(len(dps), ShouldEqual, 2+5+1+5)
+		})
+		Convey("should count methods past the cap as other", func() {
+			g.MaxMethods = 1
+			call(false, "/svc/Get", time.Millisecond, nil)
+			call(false, "/svc/Put", time.Millisecond, nil)
+			call(false, "/svc/Delete", time.Millisecond, nil)
+			dps := g.Datapoints()
+			So(find(dps, "grpc.server.calls", map[string]string{"method": "/svc/Get", "code": "OK"}).Value, ShouldResemble, datapoint.NewIntValue(1))
+			So(find(dps, "grpc.server.calls", map[string]string{"method": "other", "code": "OK"}).Value, ShouldResemble, datapoint.NewIntValue(2))
+			So(find(dps, "grpc.server.calls", map[string]string{"method": "/svc/Put", "code": "OK"}), ShouldBeNil)
+		})
+		Convey("should ignore connections", func() {
+			ctx := context.Background()
+			So(g.TagConn(ctx, &stats.ConnTagInfo{}) == ctx, ShouldBeTrue)
+			g.HandleConn(ctx, &stats.ConnBegin{})
+			So(g.Datapoints(), ShouldBeEmpty)
+		})
+	})
+}
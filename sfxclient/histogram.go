@@ -0,0 +1,51 @@
+package sfxclient
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/signalfx/golib/v3/datapoint"
+)
+
+// upperBoundDimension is the dimension holding the upper bound of each bucket of a histogram sent as
+// SignalFx protobuf, as the OpenTelemetry collector's signalfx exporter sends them
+const upperBoundDimension = "upper_bound"
+
+// expandHistograms returns points with each histogram replaced by the datapoints SignalFx protobuf sends
+// it as: a <metric>_bucket per bucket counting the observations up to its upper_bound, and <metric>_count
+// and <metric>_sum.  points is returned as is if it has no histograms.
+func expandHistograms(points []*datapoint.Datapoint) []*datapoint.Datapoint {
+	for i, dp := range points {
+		if _, ok := dp.Value.(datapoint.HistogramValue); ok {
+			ret := append(make([]*datapoint.Datapoint, 0, len(points)+8), points[:i]...)
+			for _, dp := range points[i:] {
+				ret = appendExpandedHistogram(ret, dp)
+			}
+			return ret
+		}
+	}
+	return points
+}
+
+func appendExpandedHistogram(ret []*datapoint.Datapoint, dp *datapoint.Datapoint) []*datapoint.Datapoint {
+	hv, ok := dp.Value.(datapoint.HistogramValue)
+	if !ok {
+		return append(ret, dp)
+	}
+	counts := hv.Counts()
+	bounds := hv.Bounds()
+	cumulative := uint64(0)
+	for i, count := range counts {
+		cumulative += count
+		bound := math.Inf(1)
+		if i < len(bounds) {
+			bound = bounds[i]
+		}
+		dims := datapoint.AddMaps(dp.Dimensions, map[string]string{upperBoundDimension: strconv.FormatFloat(bound, 'f', -1, 64)})
+		ret = append(ret, datapoint.New(dp.Metric+"_bucket", dims, datapoint.NewIntValue(int64(cumulative)), dp.MetricType, dp.Timestamp))
+	}
+	return append(ret,
+		datapoint.New(dp.Metric+"_count", dp.Dimensions, datapoint.NewIntValue(int64(hv.Count())), dp.MetricType, dp.Timestamp),
+		datapoint.New(dp.Metric+"_sum", dp.Dimensions, datapoint.NewFloatValue(hv.Sum()), dp.MetricType, dp.Timestamp),
+	)
+}
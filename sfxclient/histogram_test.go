@@ -0,0 +1,106 @@
+package sfxclient
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	sfxmodel "github.com/signalfx/com_signalfx_metrics_protobuf/model"
+	"github.com/signalfx/golib/v3/datapoint"
+	. "github.com/smartystreets/goconvey/convey"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestHistograms(t *testing.T) {
+	Convey("A histogram", t, func() {
+		ts := time.Unix(1600000000, 0)
+		hv, err := datapoint.NewHistogramValue([]float64{1, 5}, []uint64{2, 3, 1}, 12.5)
+		So(err, ShouldBeNil)
+		dp := Histogram("latency", map[string]string{"host": "a"}, hv)
+		dp.Timestamp = ts
+		gauge := GaugeF("g", nil, 1)
+
+		Convey("should expand to cumulative buckets, a count and a sum", func() {
+			points := expandHistograms([]*datapoint.Datapoint{gauge, dp})
+			So(len(points), ShouldEqual, 6)
+			So(points[0], ShouldEqual, gauge)
+			for i, bucket := range []struct {
+				bound string
+				count int64
+			}{{"1", 2}, {"5", 5}, {"+Inf", 6}} {
+				p := points[i+1]
+				So(p.Metric, ShouldEqual, "latency_bucket")
+				So(p.Dimensions, ShouldResemble, map[string]string{"host": "a", upperBoundDimension: bucket.bound})
+				So(p.Value, ShouldResemble, datapoint.NewIntValue(bucket.count))
+				So(p.MetricType, ShouldEqual, datapoint.Counter)
+				So(p.Timestamp, ShouldEqual, ts)
+			}
+			So(points[4].Metric, ShouldEqual, "latency_count")
+			So(points[4].Value, ShouldResemble, datapoint.NewIntValue(6))
+			So(points[5].Metric, ShouldEqual, "latency_sum")
+			So(points[5].Value, ShouldResemble, datapoint.NewFloatValue(12.5))
+			So(dp.Dimensions, ShouldResemble, map[string]string{"host": "a"})
+			Convey("unless there aren't any", func() {
+				points := []*datapoint.Datapoint{gauge}
+				So(expandHistograms(points), ShouldResemble, points)
+			})
+		})
+		Convey("should be sent as SignalFx protobuf", func() {
+			b, err := NewHTTPSink().marshalDatapoints([]*datapoint.Datapoint{dp})
+			So(err, ShouldBeNil)
+			msg := &sfxmodel.DataPointUploadMessage{}
+			So(proto.Unmarshal(b, msg), ShouldBeNil)
+			So(len(msg.Datapoints), ShouldEqual, 5)
+			So(msg.Datapoints[2].Metric, ShouldEqual, "latency_bucket")
+			So(*msg.Datapoints[2].Value.IntValue, ShouldEqual, 6)
+			So(*msg.Datapoints[4].Value.DoubleValue, ShouldEqual, 12.5)
+			So(*msg.Datapoints[4].MetricType, ShouldEqual, sfxmodel.MetricType_CUMULATIVE_COUNTER)
+		})
+		Convey("should be sent as an OTLP histogram", func() {
+			sink := NewHTTPSink(WithOTLPExporter(DefaultOTLPEndpoint))
+			b, encoded := sink.otlp().metrics([]*datapoint.Datapoint{dp})
+			So(encoded, ShouldEqual, 1)
+			m := decodeOTLP(b).message(1).message(2).message(2)
+			So(m.string(1), ShouldEqual, "latency")
+			histogram := m.message(9)
+			So(histogram.numbers[2][0], ShouldEqual, otlpTemporalityCumulative)
+			point := histogram.message(1)
+			So(point.attributes(9), ShouldResemble, map[string]string{"host": "a"})
+			So(point.numbers[2][0], ShouldEqual, otlpStart(ts))
+			So(point.numbers[3][0], ShouldEqual, uint64(ts.UnixNano()))
+			So(point.numbers[4][0], ShouldEqual, 6)
+			So(math.Float64frombits(point.numbers[5][0]), ShouldEqual, 12.5)
+			packed := func(b []byte) []uint64 {
+				var ret []uint64
+				for len(b) > 0 {
+					v, n := protowire.ConsumeFixed64(b)
+					So(n, ShouldEqual, 8)
+					ret = append(ret, v)
+					b = b[n:]
+				}
+				return ret
+			}
+			So(packed(point.messages[6][0]), ShouldResemble, []uint64{2, 3, 1})
+			So(packed(point.messages[7][0]), ShouldResemble, []uint64{math.Float64bits(1), math.Float64bits(5)})
+			Convey("with delta temporality unless it's cumulative", func() {
+				dp.MetricType = datapoint.Count
+				b, _ := sink.otlp().metrics([]*datapoint.Datapoint{dp})
+				histogram := decodeOTLP(b).message(1).message(2).message(2).message(9)
+				So(histogram.numbers[2][0], ShouldEqual, otlpTemporalityDelta)
+				So(len(histogram.message(1).numbers[2]), ShouldEqual, 0)
+			})
+		})
+		Convey("should be written to and replayed from files", func() {
+			f := NewFileSink(t.TempDir())
+			So(f.AddDatapoints(context.Background(), []*datapoint.Datapoint{dp}), ShouldBeNil)
+			So(f.Close(), ShouldBeNil)
+			got := &datapointSink{}
+			So(Replay(context.Background(), f.Dir, got), ShouldBeNil)
+			So(len(got.points), ShouldEqual, 1)
+			So(got.points[0].Value, ShouldResemble, hv)
+			So(got.points[0].Timestamp.Equal(ts), ShouldBeTrue)
+		})
+	})
+}
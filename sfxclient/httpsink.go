@@ -7,11 +7,13 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	goerrors "errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -52,6 +54,10 @@ const (
 	// DefaultTimeout is the default time to fail signalfx datapoint requests if they don't succeed
 	DefaultTimeout = time.Second * 5
 
+	// DefaultMaxResponseBytes is how much of a response body HTTPSink reads by default.  Ingest responses
+	// are small, so anything past it is only a misbehaving proxy's error page.
+	DefaultMaxResponseBytes = 64 * 1024
+
 	contentTypeHeaderJSON = "application/json"
 	contentTypeHeaderSAPM = "application/x-protobuf"
 )
@@ -62,6 +68,8 @@ var DefaultUserAgent = fmt.Sprintf("golib-sfxclient/%s (gover %s)", ClientVersio
 // HTTPSink -
 type HTTPSink struct {
 	AuthToken          string
+	AuthScheme         TokenScheme
+	AuthHeaders        map[TokenScheme]string
 	UserAgent          string
 	EventEndpoint      string
 	DatapointEndpoint  string
@@ -75,22 +83,87 @@ type HTTPSink struct {
 	zippers            sync.Pool
 	contentTypeHeader  string
 
+	// IdempotencyKeyHeader, when set, is the header each request sends an idempotency key in
+	IdempotencyKeyHeader string
+	// Deterministic orders dimensions, properties and span tags by key so the same data is always sent as
+	// the same bytes
+	Deterministic bool
+	// PayloadCallback, when set, is called with the size of each request body before compression and the
+	// size actually sent
+	PayloadCallback func(uncompressedBytes, sentBytes int)
+	// CompressionThreshold is the size in bytes a request body must exceed to be compressed.  Zero means
+	// DefaultCompressionThreshold, and a negative value compresses every body.
+	CompressionThreshold int
+	// Compressor, when set, compresses request bodies instead of gzip
+	Compressor Compressor
+	// Format is the wire format datapoints and spans are sent in
+	Format ExportFormat
+	// CircuitBreaker, when set, fails requests fast while ingest is down
+	CircuitBreaker *CircuitBreaker
+	// MaxResponseBytes is how much of a response body is read.  Zero means DefaultMaxResponseBytes.
+	MaxResponseBytes int64
+	// MaxRequestItems, when set, is the most datapoints, events or spans sent in one request.  Bigger
+	// slices are split across requests.
+	MaxRequestItems int
+	// MaxRequestBytes, when set, is the most bytes a request body may encode to before compression.  Bigger
+	// requests are halved until they fit, and so are requests ingest rejects with 413, whether it's set or not.
+	MaxRequestBytes int
+	// DatapointTimeout, EventTimeout and TraceTimeout, when set, replace Client.Timeout for requests sending
+	// datapoints, events and spans, since span payloads are much larger and need longer
+	DatapointTimeout time.Duration
+	EventTimeout     time.Duration
+	TraceTimeout     time.Duration
+
 	stats struct {
-		readingBody int64
+		readingBody           int64
+		otlpDroppedDatapoints int64
 	}
 }
 
-// SFXAPIError is returned when the API returns a status code other than 200.
+// SFXAPIError is returned when the API returns a status code other than 200.  Code and Message are
+// parsed from a JSON error body like {"code": "INVALID_TOKEN", "message": "..."}, and are empty if the body
+// isn't one.
 type SFXAPIError struct {
 	StatusCode   int
 	ResponseBody string
 	Endpoint     string
+	Code         string
+	Message      string
 }
 
 func (se SFXAPIError) Error() string {
+	if se.Code != "" || se.Message != "" {
+		return fmt.Sprintf("invalid status code %d: %s: %s", se.StatusCode, se.Code, se.Message)
+	}
 	return fmt.Sprintf("invalid status code %d: %s", se.StatusCode, se.ResponseBody)
 }
 
+// APIErrorCode returns the Code of the SFXAPIError err is or wraps, so callers can switch on codes like
+// "INVALID_TOKEN"
+func APIErrorCode(err error) (string, bool) {
+	var apiErr *SFXAPIError
+	if goerrors.As(err, &apiErr) && apiErr.Code != "" {
+		return apiErr.Code, true
+	}
+	return "", false
+}
+
+// parseAPIError fills in the Code and Message of se from its JSON error body.  The code may be a string or
+// a number.
+func (se *SFXAPIError) parseAPIError() {
+	var body struct {
+		Code    json.RawMessage `json:"code"`
+		Message string          `json:"message"`
+	}
+	if json.Unmarshal([]byte(se.ResponseBody), &body) != nil {
+		return
+	}
+	se.Message = body.Message
+	if json.Unmarshal(body.Code, &se.Code) != nil {
+		se.Code = string(body.Code)
+	}
+}
+
 // TooManyRequestError is returned when the API returns HTTP 429 error.
 // see https://developer.mozilla.org/en-US/docs/Web/HTTP/Status/429 fot details.
 type TooManyRequestError struct {
@@ -111,6 +184,11 @@ func (e TooManyRequestError) Error() string {
 		e.ThrottleType, e.RetryAfter.Seconds())
 }
 
+// Unwrap returns the SFXAPIError the 429 was returned with
+func (e TooManyRequestError) Unwrap() error {
+	return e.Err
+}
+
 type responseValidator func(respBody []byte) error
 
 func (h *HTTPSink) handleResponse(resp *http.Response, respValidator responseValidator) (err error) {
@@ -119,7 +197,7 @@ func (h *HTTPSink) handleResponse(resp *http.Response, respValidator responseVal
 		err = errors.NewMultiErr([]error{err, closeErr})
 	}()
 	atomic.AddInt64(&h.stats.readingBody, 1)
-	respBody, err := ioutil.ReadAll(resp.Body)
+	respBody, err := ioutil.ReadAll(io.LimitReader(resp.Body, h.maxResponseBytes()))
 	if err != nil {
 		return fmt.Errorf("cannot fully read response body: %w: %v", err, resp.Header)
 	}
@@ -131,6 +209,7 @@ func (h *HTTPSink) handleResponse(resp *http.Response, respValidator responseVal
 			ResponseBody: string(respBody),
 			Endpoint:     resp.Request.URL.Path,
 		}
+		baseErr.parseAPIError()
 
 		if resp.StatusCode == http.StatusTooManyRequests {
 			retryAfter, err := parseRetryAfterHeader(resp.Header.Get("Retry-After"))
@@ -164,12 +243,12 @@ func getShaValue(values []string) string {
 	return hex.EncodeToString(h.Sum(nil))
 }
 
-// loggableHeaders returns headers that are only allowed to be logged. For instance "X-Sf-Token" should not be logged so
+// loggableHeaders returns headers that are only allowed to be logged. For instance "X-Sf-Token" or "Authorization" should not be logged so
 // it will generate a sha value and then log it
 func loggableHeaders(headers map[string][]string) (rv map[string][]string) {
 	rv = make(map[string][]string, len(headers))
 	for header, value := range headers {
-		if strings.EqualFold(header, TokenHeaderName) {
+		if strings.EqualFold(header, TokenHeaderName) || strings.EqualFold(header, AuthorizationHeaderName) {
 			rv[header] = []string{getShaValue(value)}
 			continue
 		}
@@ -178,7 +257,7 @@ func loggableHeaders(headers map[string][]string) (rv map[string][]string) {
 	return rv
 }
 
-func (h *HTTPSink) doBottom(ctx context.Context, f func() (io.Reader, bool, error), contentType, endpoint string, respValidator responseValidator) error {
+func (h *HTTPSink) doBottom(ctx context.Context, f func() (io.Reader, bool, error), contentType, endpoint string, timeout time.Duration, respValidator responseValidator) error {
 	if ctx.Err() != nil {
 		return errors.Annotate(ctx.Err(), "context already closed")
 	}
@@ -195,7 +274,11 @@ func (h *HTTPSink) doBottom(ctx context.Context, f func() (io.Reader, bool, erro
 		req.Header.Set(k, v)
 	}
 	h.setHeadersOnBottom(ctx, req, contentType, compressed)
-	resp, err := h.Client.Do(req)
+	if err := h.CircuitBreaker.Allow(); err != nil {
+		return err
+	}
+	resp, err := h.client(timeout).Do(req)
+	h.CircuitBreaker.Record(breakerFailure(ctx, resp, err))
 	if err != nil {
 		// According to docs, resp can be ignored since err is non-nil, so we
 		// don't have to close body.
@@ -216,18 +299,20 @@ var (
 	XTracingID xKeyContextValue = "X-SF-Tracing-ID"
 )
 
+// setTokenHeader sends the token from ctx, falling back to AuthToken, in the header AuthHeaders picks for its scheme
 func (h *HTTPSink) setTokenHeader(ctx context.Context, req *http.Request) {
-	if tok := ctx.Value(TokenHeaderName); tok != nil {
-		req.Header.Set(TokenHeaderName, tok.(string))
-	} else {
-		req.Header.Set(TokenHeaderName, h.AuthToken)
+	tok, ok := TokenFromContext(ctx)
+	if !ok {
+		tok = Token{Value: h.AuthToken, Scheme: h.AuthScheme}
 	}
+	req.Header.Set(tok.header(h.AuthHeaders))
 }
 
 func (h *HTTPSink) setHeadersOnBottom(ctx context.Context, req *http.Request, contentType string, compressed bool) {
 	// set these below so if someone accidentally uses the same as below we wil override appropriately
 	req.Header.Set("Content-Type", contentType)
 	h.setTokenHeader(ctx, req)
+	h.setIdempotencyKeyHeader(ctx, req)
 	req.Header.Set("User-Agent", h.UserAgent)
 	req.Header.Set("Connection", "keep-alive")
 	if v := ctx.Value(XDebugID); v != nil {
@@ -240,7 +325,7 @@ func (h *HTTPSink) setHeadersOnBottom(ctx context.Context, req *http.Request, co
 		}
 	}
 	if compressed {
-		req.Header.Set("Content-Encoding", "gzip")
+		req.Header.Set("Content-Encoding", h.contentEncoding())
 	}
 }
 
@@ -249,9 +334,36 @@ func (h *HTTPSink) AddDatapoints(ctx context.Context, points []*datapoint.Datapo
 	if len(points) == 0 || h.DatapointEndpoint == "" {
 		return nil
 	}
-	return h.doBottom(ctx, func() (io.Reader, bool, error) {
-		return h.encodePostBodyProtobufV2(points)
-	}, "application/x-protobuf", h.DatapointEndpoint, datapointAndEventResponseValidator)
+	if h.Format == OTLPFormat {
+		encodable := otlpEncodable(points)
+		if dropped := len(points) - len(encodable); dropped > 0 {
+			atomic.AddInt64(&h.stats.otlpDroppedDatapoints, int64(dropped))
+		}
+		if len(encodable) == 0 {
+			return nil
+		}
+		splitter := &requestSplitter[*datapoint.Datapoint]{
+			h: h,
+			encode: func(points []*datapoint.Datapoint) ([]byte, error) {
+				body, _ := h.otlp().metrics(points)
+				return body, nil
+			},
+			contentType: contentTypeHeaderProtobuf,
+			endpoint:    h.DatapointEndpoint,
+			timeout:     h.DatapointTimeout,
+			validator:   otlpResponseValidator,
+		}
+		return splitter.send(ctx, encodable)
+	}
+	splitter := &requestSplitter[*datapoint.Datapoint]{
+		h:           h,
+		encode:      h.marshalDatapoints,
+		contentType: "application/x-protobuf",
+		endpoint:    h.DatapointEndpoint,
+		timeout:     h.DatapointTimeout,
+		validator:   datapointAndEventResponseValidator,
+	}
+	return splitter.send(ctx, points)
 }
 
 func datapointAndEventResponseValidator(respBody []byte) error {
@@ -292,20 +404,6 @@ func toEC(ec event.Category) sfxmodel.EventCategory {
 	return sfxmodel.EventCategory(ec)
 }
 
-func datumForPoint(pv datapoint.Value) sfxmodel.Datum {
-	switch t := pv.(type) {
-	case datapoint.IntValue:
-		x := t.Int()
-		return sfxmodel.Datum{IntValue: &x}
-	case datapoint.FloatValue:
-		x := t.Float()
-		return sfxmodel.Datum{DoubleValue: &x}
-	default:
-		x := t.String()
-		return sfxmodel.Datum{StrValue: &x}
-	}
-}
-
 func mapToDimensions(dimensions map[string]string) []*sfxmodel.Dimension {
 	ret := make([]*sfxmodel.Dimension, 0, len(dimensions))
 	for k, v := range dimensions {
@@ -320,6 +418,12 @@ func mapToDimensions(dimensions map[string]string) []*sfxmodel.Dimension {
 	return ret
 }
 
+func sortDimensions(dims []*sfxmodel.Dimension) {
+	sort.Slice(dims, func(i, j int) bool {
+		return dims[i].Key < dims[j].Key
+	})
+}
+
 func filterSignalfxKey(str string) string {
 	return strings.Map(runeFilterMap, str)
 }
@@ -358,59 +462,194 @@ func rawToProtobuf(raw interface{}) *sfxmodel.PropertyValue {
 }
 
 func (h *HTTPSink) coreDatapointToProtobuf(point *datapoint.Datapoint) *sfxmodel.DataPoint {
-	m := point.Metric
+	return h.appendProtobuf(newProtobufBatch([]*datapoint.Datapoint{point}), point)
+}
+
+// protobufBatch holds the protobuf datapoints of a request.  Their fields are allocated up front, a slice
+// per field for the whole batch, rather than a few times for every datapoint.
+type protobufBatch struct {
+	points      []sfxmodel.DataPoint
+	values      []protobufValue
+	metricTypes []sfxmodel.MetricType
+	dims        []sfxmodel.Dimension
+	dimPtrs     []*sfxmodel.Dimension
+}
+
+// protobufValue holds the value a sfxmodel.Datum points to
+type protobufValue struct {
+	i int64
+	f float64
+	s string
+}
+
+// newProtobufBatch makes a batch big enough for datapoints.  Appending to a slice in it never grows it,
+// so pointers into it stay valid.
+func newProtobufBatch(datapoints []*datapoint.Datapoint) *protobufBatch {
+	numDims := 0
+	for _, dp := range datapoints {
+		numDims += len(dp.Dimensions)
+	}
+	return &protobufBatch{
+		points:      make([]sfxmodel.DataPoint, 0, len(datapoints)),
+		values:      make([]protobufValue, len(datapoints)),
+		metricTypes: make([]sfxmodel.MetricType, 0, len(datapoints)),
+		dims:        make([]sfxmodel.Dimension, 0, numDims),
+		dimPtrs:     make([]*sfxmodel.Dimension, 0, numDims),
+	}
+}
+
+// appendProtobuf adds point to the batch, returning its protobuf datapoint
+func (h *HTTPSink) appendProtobuf(b *protobufBatch, point *datapoint.Datapoint) *sfxmodel.DataPoint {
+	i := len(b.points)
 	var ts int64
-	if point.Timestamp.IsZero() {
-		ts = 0
-	} else {
+	if !point.Timestamp.IsZero() {
 		ts = point.Timestamp.UnixNano() / time.Millisecond.Nanoseconds()
 	}
-	mt := toMT(point.MetricType)
-	dp := &sfxmodel.DataPoint{
-		Metric:     m,
-		Timestamp:  ts,
-		Value:      datumForPoint(point.Value),
-		MetricType: &mt,
-		Dimensions: mapToDimensions(point.Dimensions),
+	b.points = append(b.points, sfxmodel.DataPoint{
+		Metric:    point.Metric,
+		Timestamp: ts,
+	})
+	dp := &b.points[i]
+	b.metricTypes = append(b.metricTypes, toMT(point.MetricType))
+	dp.MetricType = &b.metricTypes[i]
+	v := &b.values[i]
+	switch t := point.Value.(type) {
+	case datapoint.IntValue:
+		v.i = t.Int()
+		dp.Value.IntValue = &v.i
+	case datapoint.FloatValue:
+		v.f = t.Float()
+		dp.Value.DoubleValue = &v.f
+	default:
+		v.s = t.String()
+		dp.Value.StrValue = &v.s
+	}
+	start := len(b.dimPtrs)
+	for k, v := range point.Dimensions {
+		if k == "" || v == "" {
+			continue
+		}
+		b.dims = append(b.dims, sfxmodel.Dimension{
+			Key:   filterSignalfxKey(k),
+			Value: v,
+		})
+		b.dimPtrs = append(b.dimPtrs, &b.dims[len(b.dims)-1])
+	}
+	dp.Dimensions = b.dimPtrs[start:len(b.dimPtrs):len(b.dimPtrs)]
+	if len(dp.Dimensions) == 0 {
+		dp.Dimensions = nil
+	}
+	if h.Deterministic {
+		sortDimensions(dp.Dimensions)
 	}
 	return dp
 }
 
-// avoid attempting to compress things that fit into a single ethernet frame
+// DefaultCompressionThreshold avoids attempting to compress things that fit into a single ethernet frame
+const DefaultCompressionThreshold = 1500
+
+// Compressor compresses HTTPSink request bodies with an encoding other than gzip, like the one
+// NewZstdCompressor returns
+type Compressor interface {
+	// ContentEncoding is the Content-Encoding header sent with compressed bodies
+	ContentEncoding() string
+	// Compress writes b compressed to dst
+	Compress(dst *bytes.Buffer, b []byte) error
+}
+
 func (h *HTTPSink) getReader(b []byte) (io.Reader, bool, error) {
 	var err error
-	if !h.DisableCompression && len(b) > 1500 {
+	if !h.DisableCompression && len(b) > h.compressionThreshold() {
 		buf := new(bytes.Buffer) // TODO use a pool for this too?
-		w, ok := h.zippers.Get().(*gzip.Writer)
-		if !ok {
-			return nil, false, errors.New("invalid gzip writer")
+		if h.Compressor != nil {
+			err = h.Compressor.Compress(buf, b)
+		} else {
+			w, ok := h.zippers.Get().(*gzip.Writer)
+			if !ok {
+				return nil, false, errors.New("invalid gzip writer")
+			}
+			defer h.zippers.Put(w)
+			err = gzipBody(w, buf, b)
 		}
-		defer h.zippers.Put(w)
-		w.Reset(buf)
-		_, err = w.Write(b)
 		if err == nil {
-			err = w.Close()
-			if err == nil {
-				return buf, true, nil
-			}
+			h.payloadSent(len(b), buf.Len())
+			return buf, true, nil
 		}
 	}
+	if err == nil {
+		h.payloadSent(len(b), len(b))
+	}
 	return bytes.NewReader(b), false, err
 }
 
+// client is the Client requests are sent with, with its Timeout replaced by timeout if it's set
+func (h *HTTPSink) client(timeout time.Duration) *http.Client {
+	if timeout <= 0 {
+		return h.Client
+	}
+	client := *h.Client
+	client.Timeout = timeout
+	return &client
+}
+
+func (h *HTTPSink) maxResponseBytes() int64 {
+	if h.MaxResponseBytes > 0 {
+		return h.MaxResponseBytes
+	}
+	return DefaultMaxResponseBytes
+}
+
+func (h *HTTPSink) compressionThreshold() int {
+	if h.CompressionThreshold == 0 {
+		return DefaultCompressionThreshold
+	}
+	return h.CompressionThreshold
+}
+
+// gzipBody writes b gzipped with w to buf
+func gzipBody(w *gzip.Writer, buf *bytes.Buffer, b []byte) error {
+	w.Reset(buf)
+	if _, err := w.Write(b); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// contentEncoding is the Content-Encoding of compressed request bodies
+func (h *HTTPSink) contentEncoding() string {
+	if h.Compressor != nil {
+		return h.Compressor.ContentEncoding()
+	}
+	return "gzip"
+}
+
+// payloadSent passes the size of a request body to the PayloadCallback, if any
+func (h *HTTPSink) payloadSent(uncompressedBytes, sentBytes int) {
+	if h.PayloadCallback != nil {
+		h.PayloadCallback(uncompressedBytes, sentBytes)
+	}
+}
+
 func (h *HTTPSink) encodePostBodyProtobufV2(datapoints []*datapoint.Datapoint) (io.Reader, bool, error) {
+	body, err := h.marshalDatapoints(datapoints)
+	if err != nil {
+		return nil, false, err
+	}
+	return h.getReader(body)
+}
+
+func (h *HTTPSink) marshalDatapoints(datapoints []*datapoint.Datapoint) ([]byte, error) {
+	datapoints = expandHistograms(datapoints)
+	batch := newProtobufBatch(datapoints)
 	dps := make([]*sfxmodel.DataPoint, 0, len(datapoints))
 	for _, dp := range datapoints {
-		dps = append(dps, h.coreDatapointToProtobuf(dp))
+		dps = append(dps, h.appendProtobuf(batch, dp))
 	}
 	msg := &sfxmodel.DataPointUploadMessage{
 		Datapoints: dps,
 	}
 	body, err := h.protoMarshaler(msg)
-	if err != nil {
-		return nil, false, errors.Annotate(err, "protobuf marshal failed")
-	}
-	return h.getReader(body)
+	return body, errors.Annotate(err, "protobuf marshal failed")
 }
 
 // AddEvents forwards the events to SignalFx.
@@ -418,12 +657,26 @@ func (h *HTTPSink) AddEvents(ctx context.Context, events []*event.Event) (err er
 	if len(events) == 0 || h.EventEndpoint == "" {
 		return nil
 	}
-	return h.doBottom(ctx, func() (io.Reader, bool, error) {
-		return h.encodePostBodyProtobufV2Events(events)
-	}, "application/x-protobuf", h.EventEndpoint, datapointAndEventResponseValidator)
+	splitter := &requestSplitter[*event.Event]{
+		h:           h,
+		encode:      h.marshalEvents,
+		contentType: "application/x-protobuf",
+		endpoint:    h.EventEndpoint,
+		timeout:     h.EventTimeout,
+		validator:   datapointAndEventResponseValidator,
+	}
+	return splitter.send(ctx, events)
 }
 
 func (h *HTTPSink) encodePostBodyProtobufV2Events(events []*event.Event) (io.Reader, bool, error) {
+	body, err := h.marshalEvents(events)
+	if err != nil {
+		return nil, false, err
+	}
+	return h.getReader(body)
+}
+
+func (h *HTTPSink) marshalEvents(events []*event.Event) ([]byte, error) {
 	evs := make([]*sfxmodel.Event, 0, len(events))
 	for _, ev := range events {
 		evs = append(evs, h.coreEventToProtobuf(ev))
@@ -432,10 +685,7 @@ func (h *HTTPSink) encodePostBodyProtobufV2Events(events []*event.Event) (io.Rea
 		Events: evs,
 	}
 	body, err := h.protoMarshaler(msg)
-	if err != nil {
-		return nil, false, errors.Annotate(err, "protobuf marshal failed")
-	}
-	return h.getReader(body)
+	return body, errors.Annotate(err, "protobuf marshal failed")
 }
 
 func (h *HTTPSink) coreEventToProtobuf(event *event.Event) *sfxmodel.Event {
@@ -454,6 +704,12 @@ func (h *HTTPSink) coreEventToProtobuf(event *event.Event) *sfxmodel.Event {
 		Properties: mapToProperties(event.Properties),
 		Timestamp:  ts,
 	}
+	if h.Deterministic {
+		sortDimensions(ev.Dimensions)
+		sort.Slice(ev.Properties, func(i, j int) bool {
+			return ev.Properties[i].Key < ev.Properties[j].Key
+		})
+	}
 	return ev
 }
 
@@ -490,14 +746,37 @@ func (h *HTTPSink) AddSpans(ctx context.Context, traces []*trace.Span) (err erro
 	if len(traces) == 0 || h.TraceEndpoint == "" {
 		return nil
 	}
-
-	return h.doBottom(ctx, func() (io.Reader, bool, error) {
-		b, err := h.traceMarshal(traces)
-		if spanfilter.IsInvalid(err) {
-			return nil, false, errors.Annotate(err, "cannot encode traces")
+	if h.Format == OTLPFormat {
+		splitter := &requestSplitter[*trace.Span]{
+			h:           h,
+			encode:      h.otlp().traces,
+			contentType: contentTypeHeaderProtobuf,
+			endpoint:    h.TraceEndpoint,
+			timeout:     h.TraceTimeout,
+			validator:   otlpResponseValidator,
 		}
-		return h.getReader(b)
-	}, h.contentTypeHeader, h.TraceEndpoint, spanResponseValidator)
+		return splitter.send(ctx, traces)
+	}
+
+	marshal := h.traceMarshal
+	if h.Deterministic {
+		marshal = canonicalTraceMarshal(h.contentTypeHeader)
+	}
+	splitter := &requestSplitter[*trace.Span]{
+		h: h,
+		encode: func(traces []*trace.Span) ([]byte, error) {
+			b, err := marshal(traces)
+			if spanfilter.IsInvalid(err) {
+				return nil, err
+			}
+			return b, nil
+		},
+		contentType: h.contentTypeHeader,
+		endpoint:    h.TraceEndpoint,
+		timeout:     h.TraceTimeout,
+		validator:   spanResponseValidator,
+	}
+	return splitter.send(ctx, traces)
 }
 
 func jsonMarshal(v []*trace.Span) ([]byte, error) {
@@ -515,6 +794,17 @@ func sapmMarshal(v []*trace.Span) ([]byte, error) {
 	return bb, err
 }
 
+// canonicalTraceMarshal returns the marshaller of contentType that always encodes the same spans the same
+// way.  encoding/json, unlike easyjson, sorts map keys.
+func canonicalTraceMarshal(contentType string) func([]*trace.Span) ([]byte, error) {
+	if contentType == contentTypeHeaderSAPM {
+		return translator.EncodeSAPM
+	}
+	return func(v []*trace.Span) ([]byte, error) {
+		return json.Marshal(v)
+	}
+}
+
 func parseRetryAfterHeader(v string) (time.Duration, error) {
 	// Retry-After: <http-date>
 	// https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Date
@@ -2,14 +2,19 @@ package sfxclient
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"encoding/pem"
 	goerrors "errors"
 	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"path/filepath"
 	"strings"
 	"sync"
 	"testing"
@@ -123,6 +128,69 @@ func TestHTTPSinkZipper(t *testing.T) {
 	})
 }
 
+// reverseCompressor "compresses" bodies by reversing them
+type reverseCompressor struct{}
+
+func (reverseCompressor) ContentEncoding() string {
+	return "reverse"
+}
+
+func (reverseCompressor) Compress(dst *bytes.Buffer, b []byte) error {
+	for i := len(b) - 1; i >= 0; i-- {
+		dst.WriteByte(b[i])
+	}
+	return nil
+}
+
+func TestHTTPSinkCompression(t *testing.T) {
+	Convey("An HTTPSink", t, func() {
+		body := []byte(strings.Repeat(longTraceExample, 4))
+		var sizes [][2]int
+		encode := func(sink *HTTPSink) int {
+			sink.PayloadCallback = func(uncompressedBytes, sentBytes int) {
+				sizes = append(sizes, [2]int{uncompressedBytes, sentBytes})
+			}
+			_, _, err := sink.getReader(body)
+			So(err, ShouldBeNil)
+			return sizes[len(sizes)-1][1]
+		}
+		Convey("should report the size of each payload", func() {
+			sent := encode(NewHTTPSink())
+			So(sent, ShouldBeLessThan, len(body))
+			So(sizes[0][0], ShouldEqual, len(body))
+			noCompression := NewHTTPSink()
+			noCompression.DisableCompression = true
+			So(encode(noCompression), ShouldEqual, len(body))
+		})
+		Convey("should compress at the level it is given", func() {
+			So(encode(NewHTTPSink(WithCompressionLevel(gzip.NoCompression))), ShouldBeGreaterThan, encode(NewHTTPSink(WithCompressionLevel(gzip.BestCompression))))
+			So(encode(NewHTTPSink(WithCompressionLevel(42))), ShouldEqual, encode(NewHTTPSink()))
+		})
+		Convey("should only compress bodies over the threshold", func() {
+			So(encode(NewHTTPSink(WithCompressionThreshold(len(body)))), ShouldEqual, len(body))
+			So(encode(NewHTTPSink(WithCompressionThreshold(len(body)-1))), ShouldBeLessThan, len(body))
+			_, compressed, err := NewHTTPSink(WithCompressionThreshold(-1)).getReader([]byte("a"))
+			So(err, ShouldBeNil)
+			So(compressed, ShouldBeTrue)
+		})
+		Convey("should compress with the compressor it is given", func() {
+			encodings := make(chan string, 2)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				encodings <- r.Header.Get("Content-Encoding")
+				b, _ := ioutil.ReadAll(r.Body)
+				encodings <- string(b)
+				_, _ = w.Write([]byte(`"OK"`))
+			}))
+			defer server.Close()
+			sink := NewHTTPSink(WithCompressor(reverseCompressor{}), WithCompressionThreshold(-1))
+			encode := func() (io.Reader, bool, error) { return sink.getReader([]byte("abc")) }
+			So(sink.doBottom(context.Background(), encode, "application/json", server.URL, 0, func([]byte) error { return nil }), ShouldBeNil)
+			So(<-encodings, ShouldEqual, "reverse")
+			So(<-encodings, ShouldEqual, "cba")
+		})
+	})
+}
+
 func ExampleHTTPSink() {
 	sink := NewHTTPSink()
 	sink.AuthToken = "ABCDEFG"
@@ -276,6 +344,30 @@ func TestHTTPDatapointSink(t *testing.T) {
 				retCode = http.StatusNotAcceptable
 				So(errors.Details(s.AddDatapoints(ctx, dps)), ShouldContainSubstring, "invalid status code")
 			})
+			Convey("error bodies should be parsed", func() {
+				retCode = http.StatusUnauthorized
+				retString = `{"code": "INVALID_TOKEN", "message": "token is not valid"}`
+				err := s.AddDatapoints(ctx, dps)
+				var apiErr *SFXAPIError
+				So(goerrors.As(err, &apiErr), ShouldBeTrue)
+				So(apiErr.Message, ShouldEqual, "token is not valid")
+				So(apiErr.Error(), ShouldEqual, "invalid status code 401: INVALID_TOKEN: token is not valid")
+				code, ok := APIErrorCode(err)
+				So(ok, ShouldBeTrue)
+				So(code, ShouldEqual, "INVALID_TOKEN")
+				Convey("with numeric codes", func() {
+					retString = `{"code": 401, "message": "unauthorized"}`
+					code, _ := APIErrorCode(s.AddDatapoints(ctx, dps))
+					So(code, ShouldEqual, "401")
+				})
+				Convey("only as far as MaxResponseBytes", func() {
+					s.MaxResponseBytes = 10
+					So(goerrors.As(s.AddDatapoints(ctx, dps), &apiErr), ShouldBeTrue)
+					So(apiErr.ResponseBody, ShouldEqual, retString[:10])
+					_, ok := APIErrorCode(apiErr)
+					So(ok, ShouldBeFalse)
+				})
+			})
 			Convey("HTTP 429 should be checked", func() {
 				retCode = http.StatusTooManyRequests
 				retHeaders = map[string]string{
@@ -287,6 +379,9 @@ func TestHTTPDatapointSink(t *testing.T) {
 					So(goerrors.As(s.AddDatapoints(ctx, dps), &tooManyRequestError), ShouldBeTrue)
 					So(tooManyRequestError.RetryAfter, ShouldEqual, time.Second)
 					So(tooManyRequestError.Error(), ShouldContainSubstring, "[x] too many requests, retry after")
+					var apiErr *SFXAPIError
+					So(goerrors.As(tooManyRequestError, &apiErr), ShouldBeTrue)
+					So(apiErr.StatusCode, ShouldEqual, http.StatusTooManyRequests)
 				})
 				Convey("retry until date", func() {
 					retHeaders["Retry-After"] = time.Now().Add(time.Second).Format(time.RFC850)
@@ -765,3 +860,163 @@ func TestLoggableHeaders(t *testing.T) {
 		}
 	})
 }
+
+func TestHTTPSinkDeterministic(t *testing.T) {
+	Convey("A deterministic HTTPSink", t, func() {
+		s := NewHTTPSink(WithDeterministicSerialization())
+		s.DisableCompression = true
+		dims := map[string]string{"z": "1", "a": "2", "m": "3", "b": "4", "k": "5"}
+		read := func(r io.Reader, _ bool, err error) []byte {
+			So(err, ShouldBeNil)
+			b, err := ioutil.ReadAll(r)
+			So(err, ShouldBeNil)
+			return b
+		}
+		Convey("should encode datapoints the same way every time", func() {
+			dps := []*datapoint.Datapoint{Gauge("m", dims, 1)}
+			first := read(s.encodePostBodyProtobufV2(dps))
+			for i := 0; i < 10; i++ {
+				So(read(s.encodePostBodyProtobufV2(dps)), ShouldResemble, first)
+			}
+			msg := s.coreDatapointToProtobuf(dps[0])
+			So(msg.Dimensions[0].Key, ShouldEqual, "a")
+			So(msg.Dimensions[4].Key, ShouldEqual, "z")
+		})
+		Convey("should encode events the same way every time", func() {
+			evs := []*event.Event{event.NewWithProperties("e", event.USERDEFINED, dims, map[string]interface{}{"y": 1, "x": "2", "w": true}, time.Time{})}
+			first := read(s.encodePostBodyProtobufV2Events(evs))
+			for i := 0; i < 10; i++ {
+				So(read(s.encodePostBodyProtobufV2Events(evs)), ShouldResemble, first)
+			}
+			So(s.coreEventToProtobuf(evs[0]).Properties[0].Key, ShouldEqual, "w")
+		})
+		Convey("should encode spans the same way every time", func() {
+			spans := []*trace.Span{{TraceID: "fa281a8955571a3a", ID: "acdfec5be6328c3a", Tags: dims}}
+			for _, contentType := range []string{contentTypeHeaderJSON, contentTypeHeaderSAPM} {
+				marshal := canonicalTraceMarshal(contentType)
+				first, err := marshal(spans)
+				So(spanfilter.IsInvalid(err), ShouldBeFalse)
+				for i := 0; i < 10; i++ {
+					b, _ := marshal(spans)
+					So(b, ShouldResemble, first)
+				}
+			}
+		})
+	})
+}
+
+func TestHTTPSinkRequestTimeouts(t *testing.T) {
+	Convey("An HTTPSink with request timeouts", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(time.Millisecond * 100)
+			_, _ = io.WriteString(w, respBodyStrOk)
+		}))
+		defer server.Close()
+		s := NewHTTPSink(WithRequestTimeouts(time.Millisecond*10, 0, time.Second))
+		s.DatapointEndpoint = server.URL
+		s.TraceEndpoint = server.URL
+		s.Client.Timeout = time.Millisecond * 50
+		Convey("should time out datapoints with DatapointTimeout", func() {
+			err := s.AddDatapoints(context.Background(), []*datapoint.Datapoint{GaugeF("g", nil, 1)})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "Timeout")
+		})
+		Convey("should let spans outlast Client.Timeout", func() {
+			spans := []*trace.Span{{TraceID: "fa281a8955571a3a", ID: "acdfec5be6328c3a"}}
+			So(s.AddSpans(context.Background(), spans), ShouldBeNil)
+			So(s.Client.Timeout, ShouldEqual, time.Millisecond*50)
+		})
+	})
+}
+
+func TestHTTPSinkTransportOptions(t *testing.T) {
+	Convey("An HTTPSink", t, func() {
+		points := []*datapoint.Datapoint{GaugeF("g", nil, 1)}
+		ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, respBodyStrOk)
+		})
+		Convey("sending to a TLS server", func() {
+			server := httptest.NewUnstartedServer(ok)
+			server.StartTLS()
+			defer server.Close()
+			Convey("should not trust it by default", func() {
+				s := NewHTTPSink()
+				s.DatapointEndpoint = server.URL
+				So(s.AddDatapoints(context.Background(), points), ShouldNotBeNil)
+			})
+			Convey("should trust it with its CA", func() {
+				caFile := filepath.Join(t.TempDir(), "ca.pem")
+				ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+				So(ioutil.WriteFile(caFile, ca, 0600), ShouldBeNil)
+				pool, err := LoadCertPool(caFile)
+				So(err, ShouldBeNil)
+				s := NewHTTPSink(WithRootCAs(pool))
+				s.DatapointEndpoint = server.URL
+				So(s.AddDatapoints(context.Background(), points), ShouldBeNil)
+				So(s.Client.Transport != http.DefaultTransport, ShouldBeTrue)
+				if def := http.DefaultTransport.(*http.Transport).TLSClientConfig; def != nil {
+					So(def.RootCAs, ShouldBeNil)
+				}
+			})
+			Convey("should trust it when told not to verify", func() {
+				s := NewHTTPSink(WithInsecureSkipVerify())
+				s.DatapointEndpoint = server.URL
+				So(s.AddDatapoints(context.Background(), points), ShouldBeNil)
+			})
+		})
+		Convey("sending to a server requiring mutual TLS", func() {
+			server := httptest.NewUnstartedServer(ok)
+			server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert, MinVersion: tls.VersionTLS12}
+			server.StartTLS()
+			defer server.Close()
+			s := NewHTTPSink(WithInsecureSkipVerify())
+			s.DatapointEndpoint = server.URL
+			So(s.AddDatapoints(context.Background(), points), ShouldNotBeNil)
+			WithClientCertificate(server.TLS.Certificates[0])(s)
+			So(s.AddDatapoints(context.Background(), points), ShouldBeNil)
+		})
+		Convey("should send through a proxy", func() {
+			hosts := make(chan string, 1)
+			proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				hosts <- r.URL.Host
+				_, _ = io.WriteString(w, respBodyStrOk)
+			}))
+			defer proxy.Close()
+			proxyURL, err := url.Parse(proxy.URL)
+			So(err, ShouldBeNil)
+			s := NewHTTPSink(WithProxy(proxyURL))
+			s.DatapointEndpoint = "http://ingest.example.com/v2/datapoint"
+			So(s.AddDatapoints(context.Background(), points), ShouldBeNil)
+			So(<-hosts, ShouldEqual, "ingest.example.com")
+		})
+		Convey("should leave custom round trippers alone", func() {
+			s := NewHTTPSink()
+			s.Client.Transport = roundTripperFunc(http.DefaultTransport.RoundTrip)
+			WithInsecureSkipVerify()(s)
+			So(s.tlsConfig(), ShouldBeNil)
+		})
+		Convey("should fail to load missing or empty CA bundles", func() {
+			_, err := LoadCertPool(filepath.Join(t.TempDir(), "missing.pem"))
+			So(err, ShouldNotBeNil)
+			empty := filepath.Join(t.TempDir(), "empty.pem")
+			So(ioutil.WriteFile(empty, []byte("nope"), 0600), ShouldBeNil)
+			_, err = LoadCertPool(empty)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func BenchmarkHTTPSinkMarshalDatapoints(b *testing.B) {
+	points := GoMetricsSource.Datapoints()
+	sink := NewHTTPSink()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, _ = sink.marshalDatapoints(points)
+	}
+}
@@ -0,0 +1,57 @@
+package sfxclient
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// IdempotencyKeyHeaderName is the header idempotency keys are sent in by default
+const IdempotencyKeyHeaderName = "Idempotency-Key"
+
+// IdempotencyKeyCtxKey is the context key for idempotency keys
+const IdempotencyKeyCtxKey ContextKey = IdempotencyKeyHeaderName
+
+// NewIdempotencyKey returns a random key identifying one batch of data
+func NewIdempotencyKey() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// ContextWithIdempotencyKey returns a copy of ctx that carries key.  An HTTPSink sending idempotency keys
+// sends key rather than a fresh one, so a request retried with the same context can be deduplicated.
+func ContextWithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, IdempotencyKeyCtxKey, key)
+}
+
+// IdempotencyKeyFromContext returns the key stored on ctx by ContextWithIdempotencyKey
+func IdempotencyKeyFromContext(ctx context.Context) (string, bool) {
+	key, ok := ctx.Value(IdempotencyKeyCtxKey).(string)
+	return key, ok && key != ""
+}
+
+// WithIdempotencyKeys configures HTTPSink to send an idempotency key with every request in header, or in
+// IdempotencyKeyHeaderName if header is empty.  The key comes from the request's context, or is generated
+// if the context doesn't have one.
+func WithIdempotencyKeys(header string) HTTPSinkOption {
+	return func(s *HTTPSink) {
+		if header == "" {
+			header = IdempotencyKeyHeaderName
+		}
+		s.IdempotencyKeyHeader = header
+	}
+}
+
+// setIdempotencyKeyHeader sends the idempotency key from ctx, or a new one, if the sink sends them
+func (h *HTTPSink) setIdempotencyKeyHeader(ctx context.Context, req *http.Request) {
+	if h.IdempotencyKeyHeader == "" {
+		return
+	}
+	key, ok := IdempotencyKeyFromContext(ctx)
+	if !ok {
+		key = NewIdempotencyKey()
+	}
+	req.Header.Set(h.IdempotencyKeyHeader, key)
+}
@@ -0,0 +1,94 @@
+package sfxclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestIdempotencyKeyFromContext(t *testing.T) {
+	Convey("IdempotencyKeyFromContext", t, func() {
+		Convey("should return keys set with ContextWithIdempotencyKey", func() {
+			key, ok := IdempotencyKeyFromContext(ContextWithIdempotencyKey(context.Background(), "abc"))
+			So(ok, ShouldBeTrue)
+			So(key, ShouldEqual, "abc")
+		})
+		Convey("should return false without a key", func() {
+			_, ok := IdempotencyKeyFromContext(context.Background())
+			So(ok, ShouldBeFalse)
+			_, ok = IdempotencyKeyFromContext(ContextWithIdempotencyKey(context.Background(), ""))
+			So(ok, ShouldBeFalse)
+		})
+		Convey("new keys should be unique", func() {
+			So(NewIdempotencyKey(), ShouldNotEqual, NewIdempotencyKey())
+			So(len(NewIdempotencyKey()), ShouldEqual, 32)
+		})
+	})
+}
+
+func TestHTTPSinkIdempotencyKeys(t *testing.T) {
+	Convey("An HTTPSink", t, func() {
+		req := httptest.NewRequest(http.MethodPost, "/v2/datapoint", nil)
+		Convey("shouldn't send idempotency keys by default", func() {
+			NewHTTPSink().setIdempotencyKeyHeader(context.Background(), req)
+			So(req.Header.Get(IdempotencyKeyHeaderName), ShouldEqual, "")
+		})
+		Convey("sending idempotency keys", func() {
+			s := NewHTTPSink(WithIdempotencyKeys(""))
+			So(s.IdempotencyKeyHeader, ShouldEqual, IdempotencyKeyHeaderName)
+			Convey("should send the key from the context", func() {
+				s.setIdempotencyKeyHeader(ContextWithIdempotencyKey(context.Background(), "abc"), req)
+				So(req.Header.Get(IdempotencyKeyHeaderName), ShouldEqual, "abc")
+			})
+			Convey("should generate a key without one on the context", func() {
+				s.setIdempotencyKeyHeader(context.Background(), req)
+				So(req.Header.Get(IdempotencyKeyHeaderName), ShouldNotEqual, "")
+			})
+		})
+		Convey("should send keys in a custom header", func() {
+			NewHTTPSink(WithIdempotencyKeys("X-Request-Id")).setIdempotencyKeyHeader(context.Background(), req)
+			So(req.Header.Get("X-Request-Id"), ShouldNotEqual, "")
+		})
+	})
+}
+
+func TestAsyncMultiTokenSinkIdempotencyKeys(t *testing.T) {
+	Convey("An AsyncMultiTokenSink sending idempotency keys", t, func() {
+		var mu sync.Mutex
+		var keys []string
+		retried := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			mu.Lock()
+			keys = append(keys, req.Header.Get(IdempotencyKeyHeaderName))
+			count := len(keys)
+			mu.Unlock()
+			if count == 1 {
+				rw.WriteHeader(http.StatusGatewayTimeout)
+				return
+			}
+			if count == 2 {
+				close(retried)
+			}
+			_, _ = rw.Write([]byte(`"OK"`))
+		}))
+		defer server.Close()
+		s := NewAsyncMultiTokenSink(1, 1, 5, 5000, server.URL, "", "", "", nil, func(error) error { return nil }, 2, WithDatumTypes(DatapointDatum), WithSinkIdempotencyKeys(""))
+		s.ShutdownTimeout = time.Second
+		So(s.AddDatapointsWithToken("abc", GoMetricsSource.Datapoints()), ShouldBeNil)
+		select {
+		case <-retried:
+		case <-time.After(time.Second * 5):
+		}
+		So(s.Close(), ShouldBeNil)
+		mu.Lock()
+		defer mu.Unlock()
+		So(len(keys), ShouldEqual, 2)
+		So(keys[0], ShouldNotEqual, "")
+		So(keys[1], ShouldEqual, keys[0])
+	})
+}
@@ -0,0 +1,69 @@
+package sfxclient
+
+import (
+	"context"
+
+	"github.com/signalfx/golib/v3/errors"
+	"github.com/signalfx/golib/v3/trace"
+	"github.com/signalfx/golib/v3/trace/translator"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	// DefaultJaegerGRPCEndpoint is the gRPC port of a local Jaeger collector
+	DefaultJaegerGRPCEndpoint = "localhost:14250"
+
+	jaegerPostSpansMethod = "/jaeger.api_v2.CollectorService/PostSpans"
+)
+
+// JaegerGRPCSink sends spans to a Jaeger collector as Jaeger protobuf over gRPC, so services where only
+// Jaeger is deployed can still use golib's trace types.  Spans are converted like the SAPM format converts
+// them, and each process, a local service and its tags, is posted as its own batch.
+type JaegerGRPCSink struct {
+	grpc *GRPCSink
+}
+
+var _ trace.Sink = &JaegerGRPCSink{}
+
+// NewJaegerGRPCSink connects a JaegerGRPCSink to target, like DefaultJaegerGRPCEndpoint.  It takes the
+// same options as NewGRPCSink.
+func NewJaegerGRPCSink(target string, opts ...GRPCSinkOption) (*JaegerGRPCSink, error) {
+	s, err := NewGRPCSink(target, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &JaegerGRPCSink{grpc: s}, nil
+}
+
+// AddSpans posts the spans, failing with a *spanfilter.Map if any were invalid.  The valid ones are still
+// posted.
+func (j *JaegerGRPCSink) AddSpans(ctx context.Context, spans []*trace.Span) error {
+	if len(spans) == 0 {
+		return nil
+	}
+	req, invalid := translator.SFXToSAPMPostRequest(spans)
+	if j.grpc.Deterministic {
+		translator.Canonicalize(req)
+	}
+	for _, batch := range req.Batches {
+		b, err := batch.Marshal()
+		if err != nil {
+			return errors.Annotate(err, "cannot marshal jaeger batch")
+		}
+		// PostSpansRequest has the batch as its only field
+		body := protowire.AppendTag(nil, 1, protowire.BytesType)
+		body = protowire.AppendBytes(body, b)
+		if _, err := j.grpc.invoke(ctx, jaegerPostSpansMethod, body); err != nil {
+			return err
+		}
+	}
+	if invalid.CheckInvalid() {
+		return invalid
+	}
+	return nil
+}
+
+// Close closes the connection
+func (j *JaegerGRPCSink) Close() error {
+	return j.grpc.Close()
+}
@@ -0,0 +1,71 @@
+package sfxclient
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	jaegerpb "github.com/jaegertracing/jaeger/model"
+	"github.com/signalfx/golib/v3/pointer"
+	"github.com/signalfx/golib/v3/sfxclient/spanfilter"
+	"github.com/signalfx/golib/v3/trace"
+	. "github.com/smartystreets/goconvey/convey"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestJaegerGRPCSink(t *testing.T) {
+	Convey("A JaegerGRPCSink", t, func() {
+		collector := newGRPCCollector()
+		defer collector.server.Stop()
+		sink, err := NewJaegerGRPCSink(collector.addr, WithGRPCTimeout(time.Second))
+		So(err, ShouldBeNil)
+		defer func() {
+			So(sink.Close(), ShouldBeNil)
+		}()
+		ctx := context.Background()
+		span := func(service string, id string) *trace.Span {
+			return &trace.Span{
+				TraceID:       "fa281a8955571a3a",
+				ID:            id,
+				Name:          pointer.String("GET"),
+				LocalEndpoint: &trace.Endpoint{ServiceName: pointer.String(service)},
+				Timestamp:     pointer.Int64(1000),
+				Duration:      pointer.Int64(5),
+				Tags:          map[string]string{"http.method": "GET"},
+			}
+		}
+		batch := func(export grpcExport) *jaegerpb.Batch {
+			So(export.method, ShouldEqual, jaegerPostSpansMethod)
+			b, ok := otlpField(export.body, 1, 2)
+			So(ok, ShouldBeTrue)
+			ret := &jaegerpb.Batch{}
+			So(ret.Unmarshal(b), ShouldBeNil)
+			return ret
+		}
+		Convey("should post a batch per process", func() {
+			So(sink.AddSpans(ctx, []*trace.Span{span("api", "acdfec5be6328c3a"), span("db", "bcdfec5be6328c3a")}), ShouldBeNil)
+			services := map[string]string{}
+			for i := 0; i < 2; i++ {
+				b := batch(<-collector.exports)
+				So(len(b.Spans), ShouldEqual, 1)
+				services[b.Process.ServiceName] = b.Spans[0].OperationName
+				So(b.Spans[0].Duration, ShouldEqual, 5*time.Microsecond)
+			}
+			So(services, ShouldResemble, map[string]string{"api": "GET", "db": "GET"})
+		})
+		Convey("should post the valid spans and report the invalid ones", func() {
+			err := sink.AddSpans(ctx, []*trace.Span{span("api", "acdfec5be6328c3a"), span("api", "")})
+			So(spanfilter.IsMap(err), ShouldBeTrue)
+			So(len(batch(<-collector.exports).Spans), ShouldEqual, 1)
+		})
+		Convey("should fail when the collector does", func() {
+			collector.err = status.Error(codes.Unavailable, "down")
+			So(sink.AddSpans(ctx, []*trace.Span{span("api", "acdfec5be6328c3a")}), ShouldNotBeNil)
+		})
+		Convey("should do nothing without spans", func() {
+			So(sink.AddSpans(ctx, nil), ShouldBeNil)
+			So(len(collector.exports), ShouldEqual, 0)
+		})
+	})
+}
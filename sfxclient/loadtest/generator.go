@@ -0,0 +1,98 @@
+// Package loadtest generates datapoints, events and spans, and drives AsyncMultiTokenSink with them
+// against a fake ingest server, to measure how the sink's buffer, channel and batch settings perform.
+package loadtest
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/event"
+	"github.com/signalfx/golib/v3/pointer"
+	"github.com/signalfx/golib/v3/trace"
+)
+
+// Generator creates synthetic datapoints, events and spans.  It is safe for concurrent use.
+type Generator struct {
+	// Metrics is how many distinct metric names to generate
+	Metrics int
+	// Dimensions is how many dimensions each item has
+	Dimensions int
+	// Cardinality is how many distinct values each dimension has
+	Cardinality int
+
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+// NewGenerator returns a Generator with a few metrics and dimensions, seeded with seed
+func NewGenerator(seed int64) *Generator {
+	return &Generator{
+		Metrics:     10,
+		Dimensions:  3,
+		Cardinality: 100,
+		rnd:         rand.New(rand.NewSource(seed)),
+	}
+}
+
+func (g *Generator) intn(n int) int {
+	if n <= 0 {
+		return 0
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.rnd.Intn(n)
+}
+
+func (g *Generator) dims() map[string]string {
+	dims := make(map[string]string, g.Dimensions)
+	for i := 0; i < g.Dimensions; i++ {
+		dims["dim"+strconv.Itoa(i)] = "value" + strconv.Itoa(g.intn(g.Cardinality))
+	}
+	return dims
+}
+
+// Datapoints returns n gauges and counters with random values
+func (g *Generator) Datapoints(n int) []*datapoint.Datapoint {
+	now := time.Now()
+	dps := make([]*datapoint.Datapoint, 0, n)
+	for i := 0; i < n; i++ {
+		metric := g.intn(g.Metrics)
+		mt := datapoint.Gauge
+		if metric%2 == 1 {
+			mt = datapoint.Counter
+		}
+		dps = append(dps, datapoint.New(fmt.Sprintf("loadtest.metric%d", metric), g.dims(), datapoint.NewIntValue(int64(g.intn(1000))), mt, now))
+	}
+	return dps
+}
+
+// Events returns n events
+func (g *Generator) Events(n int) []*event.Event {
+	now := time.Now()
+	evs := make([]*event.Event, 0, n)
+	for i := 0; i < n; i++ {
+		evs = append(evs, event.New(fmt.Sprintf("loadtest.event%d", g.intn(g.Metrics)), event.USERDEFINED, g.dims(), now))
+	}
+	return evs
+}
+
+// Spans returns n spans, each in its own trace
+func (g *Generator) Spans(n int) []*trace.Span {
+	now := time.Now().UnixNano() / int64(time.Microsecond)
+	spans := make([]*trace.Span, 0, n)
+	for i := 0; i < n; i++ {
+		spans = append(spans, &trace.Span{
+			TraceID:   fmt.Sprintf("%016x", g.intn(1<<30)),
+			ID:        fmt.Sprintf("%016x", g.intn(1<<30)),
+			Name:      pointer.String(fmt.Sprintf("loadtest.span%d", g.intn(g.Metrics))),
+			Timestamp: pointer.Int64(now),
+			Duration:  pointer.Int64(int64(g.intn(1000))),
+			Tags:      g.dims(),
+		})
+	}
+	return spans
+}
@@ -0,0 +1,233 @@
+package loadtest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/event"
+	"github.com/signalfx/golib/v3/sfxclient"
+	"github.com/signalfx/golib/v3/trace"
+)
+
+// Config is the sink settings to test and the load to drive it with.  Zero values use the defaults below.
+type Config struct {
+	// AsyncMultiTokenSink settings.  Defaults are 2 channels, 2 draining threads, a buffer of 1000 and a
+	// batch size of 500
+	NumChannels        int64
+	NumDrainingThreads int64
+	Buffer             int
+	BatchSize          int
+	MaxRetry           int
+	ShutdownTimeout    time.Duration
+
+	// Tokens is how many distinct tokens to send with.  Defaults to 1
+	Tokens int
+	// Senders is how many goroutines add items to the sink.  Defaults to 1
+	Senders int
+	// ItemsPerAdd is how many items each Add call has.  Defaults to 50
+	ItemsPerAdd int
+	// Duration is how long to send for.  Defaults to a second
+	Duration time.Duration
+	// Datapoints, Events and Spans pick what to send.  Datapoints are sent if none are set
+	Datapoints bool
+	Events     bool
+	Spans      bool
+
+	// Generator creates the items.  Defaults to NewGenerator(0)
+	Generator *Generator
+	// Ingest receives the items.  A FakeIngest is started, and closed, by Run if it is nil
+	Ingest *FakeIngest
+}
+
+func (c Config) withDefaults() Config {
+	if c.NumChannels == 0 {
+		c.NumChannels = 2
+	}
+	if c.NumDrainingThreads == 0 {
+		c.NumDrainingThreads = 2
+	}
+	if c.Buffer == 0 {
+		c.Buffer = 1000
+	}
+	if c.BatchSize == 0 {
+		c.BatchSize = 500
+	}
+	if c.ShutdownTimeout == 0 {
+		c.ShutdownTimeout = 5 * time.Second
+	}
+	if c.Tokens == 0 {
+		c.Tokens = 1
+	}
+	if c.Senders == 0 {
+		c.Senders = 1
+	}
+	if c.ItemsPerAdd == 0 {
+		c.ItemsPerAdd = 50
+	}
+	if c.Duration == 0 {
+		c.Duration = time.Second
+	}
+	if !c.Datapoints && !c.Events && !c.Spans {
+		c.Datapoints = true
+	}
+	if c.Generator == nil {
+		c.Generator = NewGenerator(0)
+	}
+	return c
+}
+
+// Result is what happened during a Run
+type Result struct {
+	Config  Config
+	Elapsed time.Duration
+	// Added is how many items the sink accepted
+	Added int64
+	// Rejected is how many items the sink refused, usually because its buffer was full
+	Rejected int64
+	// Ingest is what the ingest server received
+	Ingest FakeIngestStats
+	// Mallocs and AllocBytes are the heap allocations made during the run, by every goroutine
+	Mallocs    uint64
+	AllocBytes uint64
+	// CloseErr is the error closing the sink returned, if items were still buffered when it timed out
+	CloseErr error
+}
+
+// Received is how many items the ingest server received
+func (r *Result) Received() int64 {
+	return r.Ingest.Datapoints + r.Ingest.Events + r.Ingest.Spans
+}
+
+// Throughput is how many items per second the ingest server received
+func (r *Result) Throughput() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Received()) / r.Elapsed.Seconds()
+}
+
+// DropRate is the fraction of the items offered to the sink that never reached the ingest server
+func (r *Result) DropRate() float64 {
+	offered := r.Added + r.Rejected
+	if offered == 0 {
+		return 0
+	}
+	return float64(offered-r.Received()) / float64(offered)
+}
+
+func (r *Result) String() string {
+	allocsPerItem := 0.0
+	if received := r.Received(); received > 0 {
+		allocsPerItem = float64(r.Mallocs) / float64(received)
+	}
+	return fmt.Sprintf("channels=%d threads=%d buffer=%d batch=%d: %.0f items/sec, %.2f%% dropped (%d added, %d rejected, %d received in %d requests), %.1f allocs/item, %d bytes allocated",
+		r.Config.NumChannels, r.Config.NumDrainingThreads, r.Config.Buffer, r.Config.BatchSize,
+		r.Throughput(), r.DropRate()*100, r.Added, r.Rejected, r.Received(), r.Ingest.Requests, allocsPerItem, r.AllocBytes)
+}
+
+// batchesPerType is how many batches of each type are generated up front, so generation isn't measured
+const batchesPerType = 64
+
+type sender struct {
+	sink       *sfxclient.AsyncMultiTokenSink
+	tokens     []string
+	datapoints [][]*datapoint.Datapoint
+	events     [][]*event.Event
+	spans      [][]*trace.Span
+	added      int64
+	rejected   int64
+}
+
+func (s *sender) count(err error, n int) {
+	if err != nil {
+		atomic.AddInt64(&s.rejected, int64(n))
+		return
+	}
+	atomic.AddInt64(&s.added, int64(n))
+}
+
+// send adds the i'th batch of each type
+func (s *sender) send(i int) {
+	token := s.tokens[i%len(s.tokens)]
+	if len(s.datapoints) > 0 {
+		b := s.datapoints[i%len(s.datapoints)]
+		s.count(s.sink.AddDatapointsWithToken(token, b), len(b))
+	}
+	if len(s.events) > 0 {
+		b := s.events[i%len(s.events)]
+		s.count(s.sink.AddEventsWithToken(token, b), len(b))
+	}
+	if len(s.spans) > 0 {
+		b := s.spans[i%len(s.spans)]
+		s.count(s.sink.AddSpansWithToken(token, b), len(b))
+	}
+}
+
+// Run drives an AsyncMultiTokenSink configured by conf against a fake ingest server until conf.Duration
+// passes or ctx is done, then closes the sink and reports what happened
+func Run(ctx context.Context, conf Config) *Result {
+	conf = conf.withDefaults()
+	ingest := conf.Ingest
+	if ingest == nil {
+		ingest = NewFakeIngest()
+		defer ingest.Close()
+	}
+	sink := sfxclient.NewAsyncMultiTokenSink(conf.NumChannels, conf.NumDrainingThreads, conf.Buffer, conf.BatchSize,
+		ingest.DatapointEndpoint(), ingest.EventEndpoint(), ingest.TraceEndpoint(), "", func() *http.Client {
+			return &http.Client{Timeout: sfxclient.DefaultTimeout}
+		}, func(error) error { return nil }, conf.MaxRetry)
+	sink.ShutdownTimeout = conf.ShutdownTimeout
+
+	s := &sender{sink: sink}
+	for i := 0; i < conf.Tokens; i++ {
+		s.tokens = append(s.tokens, fmt.Sprintf("token%d", i))
+	}
+	for i := 0; i < batchesPerType; i++ {
+		if conf.Datapoints {
+			s.datapoints = append(s.datapoints, conf.Generator.Datapoints(conf.ItemsPerAdd))
+		}
+		if conf.Events {
+			s.events = append(s.events, conf.Generator.Events(conf.ItemsPerAdd))
+		}
+		if conf.Spans {
+			s.spans = append(s.spans, conf.Generator.Spans(conf.ItemsPerAdd))
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, conf.Duration)
+	defer cancel()
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	wg := sync.WaitGroup{}
+	for i := 0; i < conf.Senders; i++ {
+		wg.Add(1)
+		go func(offset int) {
+			defer wg.Done()
+			for j := offset; ctx.Err() == nil; j++ {
+				s.send(j)
+			}
+		}(i)
+	}
+	wg.Wait()
+	closeErr := sink.Close()
+	elapsed := time.Since(start)
+	runtime.ReadMemStats(&after)
+
+	return &Result{
+		Config:     conf,
+		Elapsed:    elapsed,
+		Added:      atomic.LoadInt64(&s.added),
+		Rejected:   atomic.LoadInt64(&s.rejected),
+		Ingest:     ingest.Stats(),
+		Mallocs:    after.Mallocs - before.Mallocs,
+		AllocBytes: after.TotalAlloc - before.TotalAlloc,
+		CloseErr:   closeErr,
+	}
+}
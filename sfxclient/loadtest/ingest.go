@@ -0,0 +1,153 @@
+package loadtest
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+
+	sfxmodel "github.com/signalfx/com_signalfx_metrics_protobuf/model"
+)
+
+// FakeIngest is an in process ingest server that accepts and counts datapoints, events and spans the way
+// HTTPSink sends them
+type FakeIngest struct {
+	server *httptest.Server
+	// latency is how long each request takes, in nanoseconds
+	latency int64
+	// failEvery fails every Nth request with a 503 when non zero
+	failEvery int64
+
+	stats FakeIngestStats
+}
+
+// FakeIngestStats counts what a FakeIngest received
+type FakeIngestStats struct {
+	Requests   int64
+	Failures   int64
+	Bytes      int64
+	Datapoints int64
+	Events     int64
+	Spans      int64
+}
+
+// NewFakeIngest starts a FakeIngest
+func NewFakeIngest() *FakeIngest {
+	f := &FakeIngest{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v2/datapoint", f.handle(f.countDatapoints))
+	mux.HandleFunc("/v2/event", f.handle(f.countEvents))
+	mux.HandleFunc("/v2/trace", f.handle(f.countSpans))
+	f.server = httptest.NewServer(mux)
+	return f
+}
+
+// DatapointEndpoint is the URL to send datapoints to
+func (f *FakeIngest) DatapointEndpoint() string {
+	return f.server.URL + "/v2/datapoint"
+}
+
+// EventEndpoint is the URL to send events to
+func (f *FakeIngest) EventEndpoint() string {
+	return f.server.URL + "/v2/event"
+}
+
+// TraceEndpoint is the URL to send spans to
+func (f *FakeIngest) TraceEndpoint() string {
+	return f.server.URL + "/v2/trace"
+}
+
+// SetLatency makes every request take at least d
+func (f *FakeIngest) SetLatency(d time.Duration) {
+	atomic.StoreInt64(&f.latency, int64(d))
+}
+
+// SetFailEvery makes every nth request fail with a 503.  Zero turns failures off.
+func (f *FakeIngest) SetFailEvery(n int64) {
+	atomic.StoreInt64(&f.failEvery, n)
+}
+
+// Stats returns a snapshot of what was received
+func (f *FakeIngest) Stats() FakeIngestStats {
+	return FakeIngestStats{
+		Requests:   atomic.LoadInt64(&f.stats.Requests),
+		Failures:   atomic.LoadInt64(&f.stats.Failures),
+		Bytes:      atomic.LoadInt64(&f.stats.Bytes),
+		Datapoints: atomic.LoadInt64(&f.stats.Datapoints),
+		Events:     atomic.LoadInt64(&f.stats.Events),
+		Spans:      atomic.LoadInt64(&f.stats.Spans),
+	}
+}
+
+// Close shuts down the server
+func (f *FakeIngest) Close() {
+	f.server.Close()
+}
+
+func (f *FakeIngest) handle(count func(body []byte) error) http.HandlerFunc {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		n := atomic.AddInt64(&f.stats.Requests, 1)
+		if latency := atomic.LoadInt64(&f.latency); latency > 0 {
+			time.Sleep(time.Duration(latency))
+		}
+		if failEvery := atomic.LoadInt64(&f.failEvery); failEvery > 0 && n%failEvery == 0 {
+			atomic.AddInt64(&f.stats.Failures, 1)
+			http.Error(rw, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		body, err := readBody(req)
+		if err == nil {
+			atomic.AddInt64(&f.stats.Bytes, int64(len(body)))
+			err = count(body)
+		}
+		if err != nil {
+			atomic.AddInt64(&f.stats.Failures, 1)
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+		_, _ = rw.Write([]byte(`"OK"`))
+	}
+}
+
+func readBody(req *http.Request) ([]byte, error) {
+	var r io.Reader = req.Body
+	if req.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		r = gz
+	}
+	return ioutil.ReadAll(r)
+}
+
+func (f *FakeIngest) countDatapoints(body []byte) error {
+	var msg sfxmodel.DataPointUploadMessage
+	if err := msg.Unmarshal(body); err != nil {
+		return err
+	}
+	atomic.AddInt64(&f.stats.Datapoints, int64(len(msg.Datapoints)))
+	return nil
+}
+
+func (f *FakeIngest) countEvents(body []byte) error {
+	var msg sfxmodel.EventUploadMessage
+	if err := msg.Unmarshal(body); err != nil {
+		return err
+	}
+	atomic.AddInt64(&f.stats.Events, int64(len(msg.Events)))
+	return nil
+}
+
+func (f *FakeIngest) countSpans(body []byte) error {
+	var spans []json.RawMessage
+	if err := json.Unmarshal(body, &spans); err != nil {
+		return err
+	}
+	atomic.AddInt64(&f.stats.Spans, int64(len(spans)))
+	return nil
+}
@@ -0,0 +1,127 @@
+package loadtest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/sfxclient"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGenerator(t *testing.T) {
+	Convey("a generator", t, func() {
+		g := NewGenerator(1)
+		g.Metrics = 2
+		g.Dimensions = 2
+		g.Cardinality = 3
+		Convey("should create datapoints within its cardinality", func() {
+			dps := g.Datapoints(100)
+			So(len(dps), ShouldEqual, 100)
+			names := map[string]bool{}
+			values := map[string]bool{}
+			for _, dp := range dps {
+				names[dp.Metric] = true
+				values[dp.Dimensions["dim1"]] = true
+				So(len(dp.Dimensions), ShouldEqual, 2)
+				So(dp.MetricType == datapoint.Gauge || dp.MetricType == datapoint.Counter, ShouldBeTrue)
+			}
+			So(len(names), ShouldEqual, 2)
+			So(len(values), ShouldEqual, 3)
+		})
+		Convey("should create events and spans", func() {
+			So(len(g.Events(5)), ShouldEqual, 5)
+			spans := g.Spans(5)
+			So(len(spans), ShouldEqual, 5)
+			So(spans[0].TraceID, ShouldNotBeEmpty)
+			So(*spans[0].Name, ShouldStartWith, "loadtest.span")
+		})
+	})
+}
+
+func TestFakeIngest(t *testing.T) {
+	Convey("a fake ingest server", t, func() {
+		ingest := NewFakeIngest()
+		defer ingest.Close()
+		sink := sfxclient.NewHTTPSink()
+		sink.DatapointEndpoint = ingest.DatapointEndpoint()
+		sink.EventEndpoint = ingest.EventEndpoint()
+		sink.TraceEndpoint = ingest.TraceEndpoint()
+		g := NewGenerator(1)
+		ctx := context.Background()
+		Convey("should count what HTTPSink sends, compressed or not", func() {
+			So(sink.AddDatapoints(ctx, g.Datapoints(100)), ShouldBeNil)
+			So(sink.AddDatapoints(ctx, g.Datapoints(1)), ShouldBeNil)
+			So(sink.AddEvents(ctx, g.Events(3)), ShouldBeNil)
+			So(sink.AddSpans(ctx, g.Spans(4)), ShouldBeNil)
+			stats := ingest.Stats()
+			So(stats.Datapoints, ShouldEqual, 101)
+			So(stats.Events, ShouldEqual, 3)
+			So(stats.Spans, ShouldEqual, 4)
+			So(stats.Requests, ShouldEqual, 4)
+			So(stats.Bytes, ShouldBeGreaterThan, 0)
+		})
+		Convey("should fail requests when asked to", func() {
+			ingest.SetFailEvery(2)
+			So(sink.AddDatapoints(ctx, g.Datapoints(1)), ShouldBeNil)
+			So(sink.AddDatapoints(ctx, g.Datapoints(1)), ShouldNotBeNil)
+			So(ingest.Stats().Failures, ShouldEqual, 1)
+		})
+		Convey("should add latency when asked to", func() {
+			ingest.SetLatency(20 * time.Millisecond)
+			start := time.Now()
+			So(sink.AddDatapoints(ctx, g.Datapoints(1)), ShouldBeNil)
+			So(time.Since(start), ShouldBeGreaterThanOrEqualTo, 20*time.Millisecond)
+		})
+	})
+}
+
+func TestRun(t *testing.T) {
+	Convey("a load test run", t, func() {
+		res := Run(context.Background(), Config{
+			Duration:    100 * time.Millisecond,
+			Tokens:      3,
+			Senders:     2,
+			ItemsPerAdd: 10,
+			Datapoints:  true,
+			Events:      true,
+			Spans:       true,
+		})
+		Convey("should push data through the sink to the ingest server", func() {
+			So(res.Added, ShouldBeGreaterThan, 0)
+			So(res.Ingest.Datapoints, ShouldBeGreaterThan, 0)
+			So(res.Ingest.Events, ShouldBeGreaterThan, 0)
+			So(res.Ingest.Spans, ShouldBeGreaterThan, 0)
+			So(res.Received(), ShouldBeLessThanOrEqualTo, res.Added)
+			So(res.Throughput(), ShouldBeGreaterThan, 0)
+			So(res.DropRate(), ShouldBeBetweenOrEqual, 0, 1)
+			So(res.Mallocs, ShouldBeGreaterThan, 0)
+			So(res.String(), ShouldContainSubstring, "items/sec")
+		})
+	})
+	Convey("an empty result should not divide by zero", t, func() {
+		res := &Result{}
+		So(res.Throughput(), ShouldEqual, 0)
+		So(res.DropRate(), ShouldEqual, 0)
+		So(res.String(), ShouldContainSubstring, "0 received")
+	})
+}
+
+func BenchmarkAsyncMultiTokenSink(b *testing.B) {
+	ingest := NewFakeIngest()
+	defer ingest.Close()
+	g := NewGenerator(0)
+	dps := g.Datapoints(50)
+	sink := sfxclient.NewAsyncMultiTokenSink(2, 2, 1000, 500, ingest.DatapointEndpoint(), "", "", "", nil, func(error) error { return nil }, 0)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for sink.AddDatapointsWithToken("token", dps) != nil {
+			time.Sleep(time.Microsecond)
+		}
+	}
+	b.StopTimer()
+	_ = sink.Close()
+	b.ReportMetric(float64(ingest.Stats().Datapoints)/float64(b.N), "received/op")
+}
@@ -0,0 +1,164 @@
+package sfxclient
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/event"
+	"github.com/signalfx/golib/v3/log"
+)
+
+// DefaultLogEventType is the event type LogEventSink sends log lines as by default
+const DefaultLogEventType = "log.error"
+
+// DefaultLogEventTimeout is how long LogEventSink waits for an event to be sent by default
+const DefaultLogEventTimeout = time.Second * 5
+
+// LogEventSink is a log.Logger that sends the lines logged at MinLevel or above, under log.LevelKey, to
+// Sink as events, so errors show up in SignalFx without another pipeline.  The other keyvals of a line
+// become properties of its event, with values that aren't strings, bools or numbers logged as strings, and
+// names and values changed to fit the limits of SignalFx ingest.  Events are sent as lines are logged, so wrap it with a
+// rate limited logger, like log.NewRateLimited, if error storms could flood Sink.
+type LogEventSink struct {
+	Sink         EventSink
+	EventType    string
+	Category     event.Category
+	Dimensions   map[string]string
+	MinLevel     log.Level
+	Timeout      time.Duration
+	ErrorHandler func(error) error
+
+	stats struct {
+		sent   int64
+		failed int64
+	}
+}
+
+var _ log.Logger = &LogEventSink{}
+var _ Collector = &LogEventSink{}
+
+// NewLogEventSink creates a logger that sends error level lines to sink as DefaultLogEventType events
+func NewLogEventSink(sink EventSink) *LogEventSink {
+	return &LogEventSink{
+		Sink:         sink,
+		EventType:    DefaultLogEventType,
+		Category:     event.EXCEPTION,
+		MinLevel:     log.ErrorLevel,
+		Timeout:      DefaultLogEventTimeout,
+		ErrorHandler: DefaultErrorHandler,
+	}
+}
+
+// Log sends keyvals as an event if they're logged at MinLevel or above
+func (l *LogEventSink) Log(keyvals ...interface{}) {
+	if !l.shouldSend(keyvals) {
+		return
+	}
+	ctx := context.Background()
+	if l.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, l.Timeout)
+		defer cancel()
+	}
+	e := event.NewWithProperties(l.EventType, l.Category, l.Dimensions, logEventProperties(keyvals), time.Now())
+	if err := l.Sink.AddEvents(ctx, []*event.Event{e}); err != nil {
+		atomic.AddInt64(&l.stats.failed, 1)
+		if l.ErrorHandler != nil {
+			_ = l.ErrorHandler(err)
+		}
+		return
+	}
+	atomic.AddInt64(&l.stats.sent, 1)
+}
+
+// shouldSend returns true if keyvals have a level, as a log.Level or its name, at MinLevel or above
+func (l *LogEventSink) shouldSend(keyvals []interface{}) bool {
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		if logKeyString(keyvals[i]) != string(log.LevelKey) {
+			continue
+		}
+		switch level := keyvals[i+1].(type) {
+		case log.Level:
+			return level >= l.MinLevel
+		case string:
+			parsed, err := log.ParseLevel(level)
+			return err == nil && parsed >= l.MinLevel
+		}
+	}
+	return false
+}
+
+// Datapoints returns how many events were sent and failed to send
+func (l *LogEventSink) Datapoints() []*datapoint.Datapoint {
+	return []*datapoint.Datapoint{
+		Cumulative("total_log_events_sent", nil, atomic.LoadInt64(&l.stats.sent)),
+		Cumulative("total_log_events_failed", nil, atomic.LoadInt64(&l.stats.failed)),
+	}
+}
+
+func logKeyString(key interface{}) string {
+	if s, ok := key.(string); ok {
+		return s
+	}
+	return fmt.Sprint(key)
+}
+
+// logEventProperties turns keyvals, other than the level, into event properties SignalFx accepts
+func logEventProperties(keyvals []interface{}) map[string]interface{} {
+	props := make(map[string]interface{}, len(keyvals)/2)
+	for i := 0; i+1 < len(keyvals) && len(props) < event.MaxProperties; i += 2 {
+		key := logKeyString(keyvals[i])
+		if key == string(log.LevelKey) {
+			continue
+		}
+		name := logEventPropertyName(key)
+		value := keyvals[i+1]
+		if d, ok := value.(log.Dynamic); ok {
+			value = d.LogValue()
+		}
+		switch v := value.(type) {
+		case string:
+			props[name] = truncateString(v, event.MaxPropertyValueLength)
+		case bool, float64, int, int64:
+			props[name] = v
+		case error:
+			props[name] = truncateString(v.Error(), event.MaxPropertyValueLength)
+		default:
+			props[name] = truncateString(fmt.Sprint(v), event.MaxPropertyValueLength)
+		}
+	}
+	return props
+}
+
+// truncateString cuts s down to at most max characters
+func truncateString(s string, max int) string {
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	return string([]rune(s)[:max])
+}
+
+// logEventPropertyName turns a log key into a property name SignalFx accepts, replacing the characters it
+// doesn't with _, and prefixing names that don't start with a letter, or start with sf_, with key_
+func logEventPropertyName(key string) string {
+	name := []rune(key)
+	for i, r := range name {
+		if !isLetter(r) && !(r >= '0' && r <= '9') && r != '_' && r != '-' {
+			name[i] = '_'
+		}
+	}
+	ret := string(name)
+	if ret == "" || !isLetter(name[0]) || strings.HasPrefix(ret, "sf_") {
+		ret = "key_" + ret
+	}
+	return truncateString(ret, event.MaxPropertyNameLength)
+}
+
+func isLetter(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+}
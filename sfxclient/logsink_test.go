@@ -0,0 +1,82 @@
+package sfxclient
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/signalfx/golib/v3/event"
+	"github.com/signalfx/golib/v3/log"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLogEventSink(t *testing.T) {
+	Convey("A log event sink", t, func() {
+		sink := &recordingSink{}
+		l := NewLogEventSink(sink)
+		l.Dimensions = map[string]string{"service": "api"}
+		var handled []error
+		l.ErrorHandler = func(err error) error {
+			handled = append(handled, err)
+			return nil
+		}
+		Convey("should send error lines as events", func() {
+			leveled := log.NewLeveled(l, log.InfoLevel)
+			leveled.Error(log.Msg, "failed", log.Err, errors.New("boom"), "attempt", 3, "retry", true, "ratio", .5, "at", []int{1})
+			So(len(sink.events), ShouldEqual, 1)
+			e := sink.events[0]
+			So(e.EventType, ShouldEqual, DefaultLogEventType)
+			So(e.Category, ShouldEqual, event.EXCEPTION)
+			So(e.Dimensions, ShouldResemble, map[string]string{"service": "api"})
+			So(e.Timestamp.IsZero(), ShouldBeFalse)
+			So(e.Properties, ShouldResemble, map[string]interface{}{
+				"message": "failed",
+				"err":     "boom",
+				"attempt": 3,
+				"retry":   true,
+				"ratio":   .5,
+				"at":      "[1]",
+			})
+			So(e.Validate(), ShouldBeNil)
+			So(l.Datapoints()[0].Value.String(), ShouldEqual, "1")
+		})
+		Convey("should drop lines below its level", func() {
+			l.Log(log.LevelKey, log.WarnLevel, log.Msg, "hi")
+			l.Log(log.Msg, "no level")
+			l.Log("level", "loud")
+			So(len(sink.events), ShouldEqual, 0)
+			l.Log("level", "ERROR", log.Msg, "hi")
+			So(len(sink.events), ShouldEqual, 1)
+		})
+		Convey("should evaluate dynamic values", func() {
+			l.Log(log.LevelKey, log.ErrorLevel, "dynamic", log.DynamicFunc(func() interface{} {
+				return "value"
+			}))
+			So(sink.events[0].Properties["dynamic"], ShouldEqual, "value")
+		})
+		Convey("should fit ingest limits", func() {
+			keyvals := []interface{}{log.LevelKey, log.ErrorLevel, "long", strings.Repeat("é", event.MaxPropertyValueLength)}
+			for i := 0; i < event.MaxProperties*2; i++ {
+				keyvals = append(keyvals, i, i)
+			}
+			l.Log(keyvals...)
+			e := sink.events[0]
+			So(e.Validate(), ShouldBeNil)
+			So(len(e.Properties), ShouldEqual, event.MaxProperties)
+			So(len([]rune(e.Properties["long"].(string))), ShouldEqual, event.MaxPropertyValueLength)
+			So(e.Properties["key_0"], ShouldEqual, 0)
+		})
+		Convey("should fix property names", func() {
+			So(logEventPropertyName("http.url"), ShouldEqual, "http_url")
+			So(logEventPropertyName("sf_id"), ShouldEqual, "key_sf_id")
+			So(logEventPropertyName(""), ShouldEqual, "key_")
+			So(len(logEventPropertyName(strings.Repeat("a", 200))), ShouldEqual, event.MaxPropertyNameLength)
+		})
+		Convey("should count and handle failures", func() {
+			sink.errs = []error{errors.New("nope")}
+			l.Log(log.LevelKey, log.ErrorLevel)
+			So(len(handled), ShouldEqual, 1)
+			So(l.Datapoints()[1].Value.String(), ShouldEqual, "1")
+		})
+	})
+}
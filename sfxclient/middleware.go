@@ -0,0 +1,204 @@
+package sfxclient
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/event"
+	"github.com/signalfx/golib/v3/trace"
+)
+
+// FullSink sends datapoints, events and spans.  HTTPSink, GRPCSink and the middleware below all are one, so
+// behaviours can be stacked around a sink with Chain.
+type FullSink interface {
+	Sink
+	AddEvents(ctx context.Context, events []*event.Event) error
+	AddSpans(ctx context.Context, spans []*trace.Span) error
+}
+
+var (
+	_ FullSink = &HTTPSink{}
+	_ FullSink = &GRPCSink{}
+)
+
+// Middleware wraps a sink in some behaviour
+type Middleware func(next FullSink) FullSink
+
+// Chain wraps sink in middlewares, the first being the outermost, so data goes through them in order
+func Chain(sink FullSink, middlewares ...Middleware) FullSink {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		sink = middlewares[i](sink)
+	}
+	return sink
+}
+
+// SinkFilter decides which datapoints, events and spans a filtering sink keeps.  A nil func keeps everything
+// of its kind.
+type SinkFilter struct {
+	Datapoint func(dp *datapoint.Datapoint) bool
+	Event     func(ev *event.Event) bool
+	Span      func(span *trace.Span) bool
+}
+
+// NewFilteringSink sends next only what filter keeps
+func NewFilteringSink(next FullSink, filter SinkFilter) FullSink {
+	return &filteringSink{next: next, filter: filter}
+}
+
+type filteringSink struct {
+	next   FullSink
+	filter SinkFilter
+}
+
+func (s *filteringSink) AddDatapoints(ctx context.Context, points []*datapoint.Datapoint) error {
+	if points = filterItems(points, s.filter.Datapoint); len(points) == 0 {
+		return nil
+	}
+	return s.next.AddDatapoints(ctx, points)
+}
+
+func (s *filteringSink) AddEvents(ctx context.Context, events []*event.Event) error {
+	if events = filterItems(events, s.filter.Event); len(events) == 0 {
+		return nil
+	}
+	return s.next.AddEvents(ctx, events)
+}
+
+func (s *filteringSink) AddSpans(ctx context.Context, spans []*trace.Span) error {
+	if spans = filterItems(spans, s.filter.Span); len(spans) == 0 {
+		return nil
+	}
+	return s.next.AddSpans(ctx, spans)
+}
+
+// filterItems returns the items keep keeps, without changing the caller's slice
+func filterItems[T any](items []T, keep func(T) bool) []T {
+	if keep == nil {
+		return items
+	}
+	kept := make([]T, 0, len(items))
+	for _, item := range items {
+		if keep(item) {
+			kept = append(kept, item)
+		}
+	}
+	return kept
+}
+
+// NewRateLimitedSink sends next at most rps calls a second, across datapoints, events and spans.  Calls over
+// the limit wait their turn, or fail with the context's error if it's done first.
+func NewRateLimitedSink(next FullSink, rps float64) FullSink {
+	if rps <= 0 {
+		return next
+	}
+	return &rateLimitedSink{next: next, interval: time.Duration(float64(time.Second) / rps)}
+}
+
+type rateLimitedSink struct {
+	next     FullSink
+	interval time.Duration
+
+	mu     sync.Mutex
+	nextAt time.Time
+}
+
+// wait takes the next free slot and waits for it
+func (s *rateLimitedSink) wait(ctx context.Context) error {
+	s.mu.Lock()
+	now := time.Now()
+	at := s.nextAt
+	if at.Before(now) {
+		at = now
+	}
+	s.nextAt = at.Add(s.interval)
+	s.mu.Unlock()
+	if at.Equal(now) {
+		return nil
+	}
+	timer := time.NewTimer(at.Sub(now))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *rateLimitedSink) AddDatapoints(ctx context.Context, points []*datapoint.Datapoint) error {
+	if err := s.wait(ctx); err != nil {
+		return err
+	}
+	return s.next.AddDatapoints(ctx, points)
+}
+
+func (s *rateLimitedSink) AddEvents(ctx context.Context, events []*event.Event) error {
+	if err := s.wait(ctx); err != nil {
+		return err
+	}
+	return s.next.AddEvents(ctx, events)
+}
+
+func (s *rateLimitedSink) AddSpans(ctx context.Context, spans []*trace.Span) error {
+	if err := s.wait(ctx); err != nil {
+		return err
+	}
+	return s.next.AddSpans(ctx, spans)
+}
+
+// NewRetrySink retries calls to next that fail, up to maxRetry times, backing off and deciding what to
+// retry with policy the same way pipeline workers do
+func NewRetrySink(next FullSink, policy *RetryPolicy, maxRetry int) FullSink {
+	return &retrySink{next: next, policy: policy, maxRetry: maxRetry}
+}
+
+type retrySink struct {
+	next     FullSink
+	policy   *RetryPolicy
+	maxRetry int
+}
+
+func (s *retrySink) AddDatapoints(ctx context.Context, points []*datapoint.Datapoint) error {
+	return retryAdd(ctx, s, points, s.next.AddDatapoints)
+}
+
+func (s *retrySink) AddEvents(ctx context.Context, events []*event.Event) error {
+	return retryAdd(ctx, s, events, s.next.AddEvents)
+}
+
+func (s *retrySink) AddSpans(ctx context.Context, spans []*trace.Span) error {
+	return retryAdd(ctx, s, spans, s.next.AddSpans)
+}
+
+// retryAdd calls add with data until it succeeds, the policy says not to retry, the retries run out or ctx
+// is done
+func retryAdd[T any](ctx context.Context, s *retrySink, data []T, add func(context.Context, []T) error) error {
+	attempt := func() error {
+		attemptCtx, cancel := s.policy.attemptContext(ctx)
+		defer cancel()
+		return add(attemptCtx, data)
+	}
+	err := attempt()
+	for i := 0; i < s.maxRetry && err != nil; i++ {
+		wait, throttled := s.policy.retryAfter(err)
+		if !throttled {
+			if !s.policy.retryable(getHTTPStatusCode(&tokenStatus{status: -1}, err).status, err) {
+				break
+			}
+			wait = s.policy.Backoff(i)
+		}
+		if wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return err
+			}
+		}
+		err = attempt()
+	}
+	return err
+}
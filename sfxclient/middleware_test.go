@@ -0,0 +1,142 @@
+package sfxclient
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/event"
+	"github.com/signalfx/golib/v3/trace"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// recordingSink records what it's sent, failing with the errors in errs first
+type recordingSink struct {
+	mu     sync.Mutex
+	points []*datapoint.Datapoint
+	events []*event.Event
+	spans  []*trace.Span
+	calls  int
+	errs   []error
+}
+
+func (r *recordingSink) call() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls++
+	if len(r.errs) > 0 {
+		err := r.errs[0]
+		r.errs = r.errs[1:]
+		return err
+	}
+	return nil
+}
+
+func (r *recordingSink) AddDatapoints(ctx context.Context, points []*datapoint.Datapoint) error {
+	if err := r.call(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.points = append(r.points, points...)
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *recordingSink) AddEvents(ctx context.Context, events []*event.Event) error {
+	if err := r.call(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.events = append(r.events, events...)
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *recordingSink) AddSpans(ctx context.Context, spans []*trace.Span) error {
+	if err := r.call(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.spans = append(r.spans, spans...)
+	r.mu.Unlock()
+	return nil
+}
+
+func TestMiddleware(t *testing.T) {
+	Convey("Sink middleware", t, func() {
+		ctx := context.Background()
+		next := &recordingSink{}
+		points := []*datapoint.Datapoint{GaugeF("keep", nil, 1), GaugeF("drop", nil, 2)}
+		events := []*event.Event{event.New("keep", event.USERDEFINED, nil, time.Time{})}
+		spans := []*trace.Span{{ID: "keep"}, {ID: "drop"}}
+
+		Convey("should chain in order", func() {
+			var order []string
+			named := func(name string) Middleware {
+				return func(next FullSink) FullSink {
+					return NewFilteringSink(next, SinkFilter{Datapoint: func(*datapoint.Datapoint) bool {
+						order = append(order, name)
+						return true
+					}})
+				}
+			}
+			sink := Chain(next, named("outer"), named("inner"))
+			So(sink.AddDatapoints(ctx, points[:1]), ShouldBeNil)
+			So(order, ShouldResemble, []string{"outer", "inner"})
+		})
+		Convey("should filter", func() {
+			sink := NewFilteringSink(next, SinkFilter{
+				Datapoint: func(dp *datapoint.Datapoint) bool { return dp.Metric == "keep" },
+				Span:      func(s *trace.Span) bool { return s.ID == "keep" },
+			})
+			So(sink.AddDatapoints(ctx, points), ShouldBeNil)
+			So(sink.AddEvents(ctx, events), ShouldBeNil)
+			So(sink.AddSpans(ctx, spans), ShouldBeNil)
+			So(len(next.points), ShouldEqual, 1)
+			So(len(next.events), ShouldEqual, 1)
+			So(len(next.spans), ShouldEqual, 1)
+			So(len(points), ShouldEqual, 2)
+			Convey("and not call next with nothing", func() {
+				So(sink.AddDatapoints(ctx, points[1:]), ShouldBeNil)
+				So(next.calls, ShouldEqual, 3)
+			})
+		})
+		Convey("should rate limit", func() {
+			sink := NewRateLimitedSink(next, 20)
+			start := time.Now()
+			for i := 0; i < 3; i++ {
+				So(sink.AddDatapoints(ctx, points), ShouldBeNil)
+			}
+			So(time.Since(start), ShouldBeGreaterThanOrEqualTo, time.Millisecond*100)
+			Convey("until the context is done", func() {
+				cancelled, cancel := context.WithCancel(ctx)
+				cancel()
+				So(sink.AddEvents(cancelled, events), ShouldEqual, context.Canceled)
+			})
+			Convey("unless the rate is unlimited", func() {
+				So(NewRateLimitedSink(next, 0), ShouldEqual, next)
+			})
+		})
+		Convey("should retry", func() {
+			timeout := &SFXAPIError{StatusCode: http.StatusGatewayTimeout}
+			next.errs = []error{timeout, timeout}
+			sink := NewRetrySink(next, &RetryPolicy{InitialBackoff: time.Millisecond}, 2)
+			So(sink.AddSpans(ctx, spans), ShouldBeNil)
+			So(next.calls, ShouldEqual, 3)
+			Convey("up to maxRetry times", func() {
+				next.errs = []error{timeout, timeout, timeout}
+				So(sink.AddDatapoints(ctx, points), ShouldEqual, timeout)
+				So(next.calls, ShouldEqual, 6)
+			})
+			Convey("only what the policy says is retryable", func() {
+				badRequest := &SFXAPIError{StatusCode: http.StatusBadRequest}
+				next.errs = []error{badRequest}
+				So(sink.AddEvents(ctx, events), ShouldEqual, badRequest)
+				So(next.calls, ShouldEqual, 4)
+			})
+		})
+	})
+}
@@ -1,13 +1,13 @@
 package sfxclient
 
 import (
+	"container/list"
 	"context"
 	"errors"
 	"fmt"
 	"hash"
 	"hash/fnv"
 	"net/http"
-	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -25,24 +25,6 @@ const (
 	TokenCtxKey ContextKey = TokenHeaderName
 )
 
-// dpMsg is the message object for datapoints
-type dpMsg struct {
-	token string
-	data  []*datapoint.Datapoint
-}
-
-// evMsg is the message object for events
-type evMsg struct {
-	token string
-	data  []*event.Event
-}
-
-// spanMsg is the message object for events
-type spanMsg struct {
-	token string
-	data  []*trace.Span
-}
-
 type tokenStatus struct {
 	status int
 	token  string
@@ -74,11 +56,56 @@ type AsyncTokenStatusCounter struct {
 	dataStore         map[string]map[int]int64
 	input             chan *tokenStatus
 	stop              chan bool
-	requestDatapoints chan chan []*datapoint.Datapoint
+	requestDatapoints chan snapshotRequest
+	snapshotTimeout   time.Duration
+	reset             chan chan struct{}
 	defaultDims       map[string]string
+	// maxTokens caps how many tokens are counted, evicting the least recently counted.  recent orders the
+	// tokens from most to least recently counted, and elements finds a token in recent.
+	maxTokens int
+	recent    *list.List
+	elements  map[string]*list.Element
+	// delta reports the counts since the last report instead of since the counter started
+	delta bool
+}
+
+// snapshotRequest asks the counting goroutine for its counts, sent on response, and to forget them if reset
+type snapshotRequest struct {
+	reset    bool
+	response chan []*datapoint.Datapoint
 }
 
-func (a *AsyncTokenStatusCounter) fetchDatapoints() (counters []*datapoint.Datapoint) {
+// DefaultSnapshotTimeout is how long Datapoints waits for the counting goroutine by default
+const DefaultSnapshotTimeout = time.Second
+
+// AsyncTokenStatusCounterOption can be passed to NewAsyncTokenStatusCounter to customize the counter
+type AsyncTokenStatusCounterOption func(*AsyncTokenStatusCounter)
+
+// WithMaxTokens counts at most max tokens, forgetting the counts of the least recently counted token to make
+// room for a new one, so programs that see many short lived tokens don't keep counts for all of them forever
+func WithMaxTokens(max int) AsyncTokenStatusCounterOption {
+	return func(a *AsyncTokenStatusCounter) {
+		a.maxTokens = max
+	}
+}
+
+// WithSnapshotTimeout sets how long Datapoints and SnapshotAndReset wait for the counting goroutine to take
+// their request before giving up and returning nil
+func WithSnapshotTimeout(timeout time.Duration) AsyncTokenStatusCounterOption {
+	return func(a *AsyncTokenStatusCounter) {
+		a.snapshotTimeout = timeout
+	}
+}
+
+// WithDeltaReports reports the counts since the last call to Datapoints, as counters, and then forgets them
+func WithDeltaReports() AsyncTokenStatusCounterOption {
+	return func(a *AsyncTokenStatusCounter) {
+		a.delta = true
+	}
+}
+
+func (a *AsyncTokenStatusCounter) fetchDatapoints(reset bool) (counters []*datapoint.Datapoint) {
+	reset = reset || a.delta
 	for token, statuses := range a.dataStore {
 		for status, counter := range statuses {
 			statusString := http.StatusText(status)
@@ -89,9 +116,16 @@ func (a *AsyncTokenStatusCounter) fetchDatapoints() (counters []*datapoint.Datap
 			for k, v := range a.defaultDims {
 				dims[k] = v
 			}
-			counters = append(counters, Cumulative(a.name, dims, counter))
+			if reset {
+				counters = append(counters, Counter(a.name, dims, counter))
+			} else {
+				counters = append(counters, Cumulative(a.name, dims, counter))
+			}
 		}
 	}
+	if reset {
+		a.clear()
+	}
 	return
 }
 
@@ -104,24 +138,78 @@ func (a *AsyncTokenStatusCounter) processInput(t *tokenStatus) {
 	} else { // if the status doesn't exist add create it
 		a.dataStore[t.token][t.status] = t.val
 	}
+	a.touch(t.token)
 }
 
-// Datapoints returns datapoints for each token and status
-func (a *AsyncTokenStatusCounter) Datapoints() (dps []*datapoint.Datapoint) {
-	var request bool
-	returnDatapoints := make(chan []*datapoint.Datapoint)
-	defer close(returnDatapoints)
-	for {
+// touch marks token as the most recently counted, evicting the least recently counted token if there are
+// more than maxTokens
+func (a *AsyncTokenStatusCounter) touch(token string) {
+	if a.maxTokens <= 0 {
+		return
+	}
+	if e, exists := a.elements[token]; exists {
+		a.recent.MoveToFront(e)
+		return
+	}
+	a.elements[token] = a.recent.PushFront(token)
+	if a.recent.Len() > a.maxTokens {
+		oldest := a.recent.Remove(a.recent.Back()).(string)
+		delete(a.elements, oldest)
+		delete(a.dataStore, oldest)
+	}
+}
+
+// clear forgets every count
+func (a *AsyncTokenStatusCounter) clear() {
+	a.dataStore = map[string]map[int]int64{}
+	if a.maxTokens > 0 {
+		a.recent.Init()
+		a.elements = make(map[string]*list.Element)
+	}
+}
+
+// Datapoints returns datapoints for each token and status.  It returns nil if the counter is stopped, or
+// doesn't take the request within the snapshot timeout.
+func (a *AsyncTokenStatusCounter) Datapoints() []*datapoint.Datapoint {
+	return a.snapshot(false)
+}
+
+// SnapshotAndReset returns the counts since the last reset, as counters, and forgets them in the same step,
+// so no increment is reported twice or lost between reports
+func (a *AsyncTokenStatusCounter) SnapshotAndReset() []*datapoint.Datapoint {
+	return a.snapshot(true)
+}
+
+// snapshot asks the counting goroutine for the current counts, giving up if it doesn't take the request
+// within snapshotTimeout.  Once taken, the request is always answered, so reset counts are never lost.
+func (a *AsyncTokenStatusCounter) snapshot(reset bool) []*datapoint.Datapoint {
+	req := snapshotRequest{reset: reset, response: make(chan []*datapoint.Datapoint, 1)}
+	timer := time.NewTimer(a.snapshotTimeout)
+	defer timer.Stop()
+	select {
+	case <-a.stop:
+		return nil
+	case <-timer.C:
+		return nil
+	case a.requestDatapoints <- req:
+	}
+	select {
+	case <-a.stop:
+		return nil
+	case dps := <-req.response:
+		return dps
+	}
+}
+
+// Reset forgets every count, including increments still waiting to be counted
+func (a *AsyncTokenStatusCounter) Reset() {
+	done := make(chan struct{})
+	select {
+	case <-a.stop:
+	case a.reset <- done:
 		select {
 		case <-a.stop:
-			return
-		case dps = <-returnDatapoints: // listen on the newly created channel for datapoints
-			return
-		default:
-			if !request {
-				a.requestDatapoints <- returnDatapoints
-				request = true
-			}
+		case <-done:
 		}
 	}
 }
@@ -140,14 +228,21 @@ func (a *AsyncTokenStatusCounter) Increment(status *tokenStatus) {
 }
 
 // NewAsyncTokenStatusCounter returns a structure for counting occurrences of http statuses by token
-func NewAsyncTokenStatusCounter(name string, buffer int, numWorkers int64, defaultDims map[string]string) *AsyncTokenStatusCounter {
+func NewAsyncTokenStatusCounter(name string, buffer int, numWorkers int64, defaultDims map[string]string, opts ...AsyncTokenStatusCounterOption) *AsyncTokenStatusCounter {
 	a := &AsyncTokenStatusCounter{
 		name:              name,
 		dataStore:         map[string]map[int]int64{},
 		input:             make(chan *tokenStatus, int64(buffer)*numWorkers),
 		stop:              make(chan bool),
-		requestDatapoints: make(chan chan []*datapoint.Datapoint, 5000),
+		requestDatapoints: make(chan snapshotRequest),
+		snapshotTimeout:   DefaultSnapshotTimeout,
+		reset:             make(chan chan struct{}),
 		defaultDims:       defaultDims,
+		recent:            list.New(),
+		elements:          make(map[string]*list.Element),
+	}
+	for _, opt := range opts {
+		opt(a)
 	}
 	go func() {
 		for {
@@ -156,472 +251,377 @@ func NewAsyncTokenStatusCounter(name string, buffer int, numWorkers int64, defau
 				return
 			case input := <-a.input:
 				a.processInput(input)
-			case returnDatapoints := <-a.requestDatapoints:
-				response := a.fetchDatapoints()
-				returnDatapoints <- response
+			case req := <-a.requestDatapoints:
+				req.response <- a.fetchDatapoints(req.reset)
+			case done := <-a.reset:
+				a.discardInput()
+				a.clear()
+				close(done)
 			}
 		}
 	}()
 	return a
 }
 
-// worker manages a pipeline for emitting metrics
-type worker struct {
-	lock         *sync.Mutex       // lock to control concurrent access to the worker
-	errorHandler func(error) error // error handler for handling error emitting datapoints
-	sink         *HTTPSink         // sink is an HTTPSink for emitting datapoints to Signal Fx
-	closing      chan bool         // channel to signal that the worker is stopping
-	done         chan bool         // channel to signal that the worker is done
-}
-
-// returns a new instance of worker with an configured emission pipeline
-func newWorker(errorHandler func(error) error, closing chan bool, done chan bool) *worker {
-	w := &worker{
-		lock:         &sync.Mutex{},
-		sink:         NewHTTPSink(),
-		errorHandler: errorHandler,
-		closing:      closing,
-		done:         done,
-	}
-
-	return w
-}
-
-// worker for handling datapoints
-type datapointWorker struct {
-	*worker
-	input     chan *dpMsg // channel for inputing datapoints into a worker
-	buffer    []*datapoint.Datapoint
-	batchSize int
-	stats     *asyncMultiTokenSinkStats // stats about
-	maxRetry  int                       // maximum number of times that to retry emitting datapoints
-}
-
-// emits a series of datapoints
-func (w *datapointWorker) emit(token string) {
-	// set the token on the HTTPSink
-	w.sink.AuthToken = token
-	w.stats.DPBatchSizes.Add(float64(len(w.buffer)))
-	// emit datapoints and handle any errors
-	err := w.sink.AddDatapoints(context.Background(), w.buffer)
-	w.handleError(err, token, w.buffer, w.sink.AddDatapoints)
-	// account for the emitted datapoints
-	atomic.AddInt64(&w.stats.TotalDatapointsBuffered, int64(len(w.buffer)*-1))
-	w.buffer = w.buffer[:0]
-}
-
-//nolint:dupl
-func (w *datapointWorker) handleError(err error, token string, datapoints []*datapoint.Datapoint, addDatapoints func(context.Context, []*datapoint.Datapoint) error) {
-	errr := err
-	status := &tokenStatus{
-		status: -1,
-		token:  token,
-		val:    int64(len(datapoints)),
-	}
-	status = getHTTPStatusCode(status, errr)
-	for i := 0; i < w.maxRetry; i++ {
-		// retry in the cases where http status codes are not found or an http timeout status is encountered
-		if status.status == -1 || status.status == http.StatusRequestTimeout || status.status == http.StatusGatewayTimeout || status.status == 598 {
-			atomic.AddInt64(&w.stats.NumberOfRetries, 1)
-			errr = addDatapoints(context.Background(), w.buffer)
-			status = getHTTPStatusCode(status, errr)
-		} else {
-			break
+// discardInput drops the statuses waiting in the input channel
+func (a *AsyncTokenStatusCounter) discardInput() {
+	for {
+		select {
+		case <-a.input:
+		default:
+			return
 		}
 	}
-	w.stats.TotalDatapointsByToken.Increment(status)
-	if errr != nil {
-		_ = w.errorHandler(errr)
-	}
 }
 
-func (w *datapointWorker) processMsg(msg *dpMsg) {
-	for len(msg.data) > 0 {
-		msgLength := len(msg.data)
-		remainingBuffer := w.batchSize - len(w.buffer)
-		if msgLength > remainingBuffer {
-			msgLength = remainingBuffer
-		}
-		w.buffer = append(w.buffer, msg.data[:msgLength]...)
-		msg.data = msg.data[msgLength:]
-		if len(w.buffer) >= w.batchSize {
-			w.emit(msg.token)
+// DatumType is a kind of data an AsyncMultiTokenSink emits.  Types can be combined with |.
+type DatumType int
+
+// The datum types an AsyncMultiTokenSink can emit
+const (
+	DatapointDatum DatumType = 1 << iota
+	EventDatum
+	SpanDatum
+	// AllDatumTypes is every datum type, which is what a sink emits by default
+	AllDatumTypes = DatapointDatum | EventDatum | SpanDatum
+)
+
+// ErrDatumTypeDisabled is returned when adding a datum type the sink wasn't created to emit
+var ErrDatumTypeDisabled = errors.New("datum type is disabled on this sink")
+
+// AsyncMultiTokenSinkOption can be passed to NewAsyncMultiTokenSink to customize the sink before its
+// workers start
+type AsyncMultiTokenSinkOption func(*AsyncMultiTokenSink)
+
+// WithDatumTypes only creates the channels and workers for the given datum types, so a metrics only service
+// doesn't run event and span workers.  Adding a disabled type returns ErrDatumTypeDisabled.
+func WithDatumTypes(types ...DatumType) AsyncMultiTokenSinkOption {
+	return func(a *AsyncMultiTokenSink) {
+		a.datumTypes = 0
+		for _, t := range types {
+			a.datumTypes |= t
 		}
 	}
 }
 
-// bufferDatapoints is responsible for batching incoming datapoints into a buffer
-func (w *datapointWorker) bufferFunc(msg *dpMsg) (stop bool) {
-	lastTokenSeen := msg.token
-	w.processMsg(msg)
-outer:
-	for len(w.buffer) < w.batchSize {
-		select {
-		case msg = <-w.input:
-			if msg.token != lastTokenSeen {
-				// if the token changes, then emit what ever is in the buffer before proceeding
-				w.emit(lastTokenSeen)
-				lastTokenSeen = msg.token
-			}
-			w.processMsg(msg)
-		default:
-			break outer // emit what ever is in the buffer if there are no more datapoints to read
-		}
+// WithLightweightStats skips the per token status counts and batch size distributions, which each keep
+// their own bookkeeping, for programs running many sinks that don't need those datapoints
+func WithLightweightStats() AsyncMultiTokenSinkOption {
+	return func(a *AsyncMultiTokenSink) {
+		a.disableDetailedStats = true
 	}
-	// emit the data in the buffer
-	w.emit(msg.token)
-	return
 }
 
-// newBuffer buffers datapoints and events in the pipeline for the duration specified during Startup
-func (w *datapointWorker) newBuffer() {
-	for {
-		select {
-		// check if the sink is closing and return if so
-		// reading from a.closing will only return a value if the a.closing channel is closed
-		// nothing should ever write into it
-		case <-w.closing: // check if the worker is in a closing state
-			w.done <- true
-			return
-		case msg := <-w.input:
-			// process the Datapoint Message
-			w.bufferFunc(msg)
-		}
+// WithStatsSampleRate only records the status and size of one in every rate batches each worker emits,
+// scaling the status counts back up
+func WithStatsSampleRate(rate int) AsyncMultiTokenSinkOption {
+	return func(a *AsyncMultiTokenSink) {
+		a.statsSampleRate = rate
 	}
 }
 
-func newDatapointWorker(batchSize int, errorHandler func(error) error, stats *asyncMultiTokenSinkStats, closing chan bool, done chan bool, input chan *dpMsg, maxRetry int) *datapointWorker {
-	w := &datapointWorker{
-		worker:    newWorker(errorHandler, closing, done),
-		input:     input,
-		buffer:    make([]*datapoint.Datapoint, 0), // let it grow, let it grow!
-		batchSize: batchSize,
-		stats:     stats,
-		maxRetry:  maxRetry,
-	}
-	go w.newBuffer()
-	return w
-}
-
-// worker for handling events
-type eventWorker struct {
-	*worker
-	input     chan *evMsg // channel for inputing datapoints into a worker
-	buffer    []*event.Event
-	batchSize int
-	stats     *asyncMultiTokenSinkStats // stats about
-	maxRetry  int                       // maximum number of times to retry emitting events
-}
-
-// emits a series of datapoints
-func (w *eventWorker) emit(token string) {
-	// set the token on the HTTPSink
-	w.sink.AuthToken = token
-	w.stats.EVBatchSizes.Add(float64(len(w.buffer)))
-	// emit datapoints and handle any errors
-	err := w.sink.AddEvents(context.Background(), w.buffer)
-	w.handleError(err, token, w.buffer, w.sink.AddEvents)
-	// account for the emitted datapoints
-	atomic.AddInt64(&w.stats.TotalEventsBuffered, int64(len(w.buffer)*-1))
-	w.buffer = w.buffer[:0]
-}
-
-//nolint:dupl
-func (w *eventWorker) handleError(err error, token string, events []*event.Event, addEvents func(context.Context, []*event.Event) error) {
-	errr := err
-	status := &tokenStatus{
-		status: -1,
-		token:  token,
-		val:    int64(len(events)),
-	}
-	status = getHTTPStatusCode(status, errr)
-	for i := 0; i < w.maxRetry; i++ {
-		// retry in the cases where http status codes are not found or an http timeout status is encountered
-		if status.status == -1 || status.status == http.StatusRequestTimeout || status.status == http.StatusGatewayTimeout || status.status == 598 {
-			atomic.AddInt64(&w.stats.NumberOfRetries, 1)
-			errr = addEvents(context.Background(), w.buffer)
-			status = getHTTPStatusCode(status, errr)
-		} else {
-			break
+// WithSinkIdempotencyKeys sends each batch with an idempotency key in header, or in IdempotencyKeyHeaderName if
+// header is empty.  Retries of a batch send the same key, so backends that deduplicate don't count a batch
+// twice when a request that timed out actually succeeded.
+func WithSinkIdempotencyKeys(header string) AsyncMultiTokenSinkOption {
+	return func(a *AsyncMultiTokenSink) {
+		if header == "" {
+			header = IdempotencyKeyHeaderName
 		}
+		a.idempotencyKeyHeader = header
 	}
-	w.stats.TotalEventsByToken.Increment(status)
-	if errr != nil {
-		_ = w.errorHandler(errr)
+}
+
+// WithCardinalityGuard caps the series each token can send with guard, whose stats are included in the
+// sink's datapoints
+func WithCardinalityGuard(guard *CardinalityGuard) AsyncMultiTokenSinkOption {
+	return func(a *AsyncMultiTokenSink) {
+		a.cardinality = guard
 	}
 }
 
-func (w *eventWorker) processMsg(msg *evMsg) {
-	for len(msg.data) > 0 {
-		msgLength := len(msg.data)
-		remainingBuffer := w.batchSize - len(w.buffer)
-		if msgLength > remainingBuffer {
-			msgLength = remainingBuffer
-		}
-		w.buffer = append(w.buffer, msg.data[:msgLength]...)
-		msg.data = msg.data[msgLength:]
-		if len(w.buffer) >= w.batchSize {
-			w.emit(msg.token)
-		}
+// WithTokenProvider resolves the token of data added without a token on the context with provider.  Data
+// is sent in groups of the same token.  If provider implements InvalidateToken(token string), like
+// CachingTokenProvider, it is called with tokens the backend rejects, and if it is a Collector its
+// datapoints are included in the sink's.
+func WithTokenProvider(provider TokenProvider) AsyncMultiTokenSinkOption {
+	return func(a *AsyncMultiTokenSink) {
+		a.tokenProvider = provider
 	}
 }
 
-// bufferDatapoints is responsible for batching incoming datapoints into a buffer
-func (w *eventWorker) bufferFunc(msg *evMsg) (stop bool) {
-	lastTokenSeen := msg.token
-	w.processMsg(msg)
-outer:
-	for len(w.buffer) < w.batchSize {
-		select {
-		case msg = <-w.input:
-			if msg.token != lastTokenSeen {
-				// if the token changes, then emit what ever is in the buffer before proceeding
-				w.emit(lastTokenSeen)
-				lastTokenSeen = msg.token
-			}
-			w.processMsg(msg)
-		default:
-			break outer // emit what ever is in the buffer if there are no more datapoints to read
-		}
+// WithRetryPolicy retries failed batches with policy, such as DefaultRetryPolicy, instead of retrying
+// timeouts right away.  Batches are still retried at most maxRetry times.
+func WithRetryPolicy(policy *RetryPolicy) AsyncMultiTokenSinkOption {
+	return func(a *AsyncMultiTokenSink) {
+		a.retryPolicy = policy
 	}
-	// emit the data in the buffer
-	w.emit(msg.token)
-	return
 }
 
-// newBuffer buffers datapoints and events in the pipeline for the duration specified during Startup
-func (w *eventWorker) newBuffer() {
-	for {
-		select {
-		// check if the sink is closing and return if so
-		// reading from a.closing will only return a value if the a.closing channel is closed
-		// nothing should ever write into it
-		case <-w.closing:
-			// signal that the worker is done
-			w.done <- true
-			return
-		case msg := <-w.input:
-			// process the Datapoint Message
-			w.bufferFunc(msg)
-		}
+// WithMaxBufferDuration emits partially full batches once a worker has been filling them for d, so data
+// for tokens that trickle in steadily isn't held back waiting for a full batch
+func WithMaxBufferDuration(d time.Duration) AsyncMultiTokenSinkOption {
+	return func(a *AsyncMultiTokenSink) {
+		a.maxBufferDuration = d
 	}
 }
 
-func newEventWorker(batchSize int, errorHandler func(error) error, stats *asyncMultiTokenSinkStats, closing chan bool, done chan bool, input chan *evMsg, maxRetry int) *eventWorker {
-	w := &eventWorker{
-		worker:    newWorker(errorHandler, closing, done),
-		input:     input,
-		buffer:    make([]*event.Event, 0), // let it grow, let it grow!
-		batchSize: batchSize,
-		stats:     stats,
-		maxRetry:  maxRetry,
-	}
-	go w.newBuffer()
-	return w
-}
-
-// worker for handling traces
-type spanWorker struct {
-	*worker
-	input     chan *spanMsg // channel for inputing datapoints into a worker
-	buffer    []*trace.Span
-	batchSize int
-	stats     *asyncMultiTokenSinkStats // stats about
-	maxRetry  int                       // maximum number of times to retry emitting traces
-}
-
-// emits a series of datapoints
-func (w *spanWorker) emit(token string) {
-	// set the token on the HTTPSink
-	w.sink.AuthToken = token
-	w.stats.SpanBatchSizes.Add(float64(len(w.buffer)))
-	// emit spans and handle any errors
-	err := w.sink.AddSpans(context.Background(), w.buffer)
-	w.handleError(err, token, w.buffer, w.sink.AddSpans)
-	// account for the emitted spans
-	atomic.AddInt64(&w.stats.TotalSpansBuffered, int64(len(w.buffer)*-1))
-	w.buffer = w.buffer[:0]
-}
-
-//nolint:dupl
-func (w *spanWorker) handleError(err error, token string, traces []*trace.Span, addSpans func(context.Context, []*trace.Span) error) {
-	errr := err
-	status := &tokenStatus{
-		status: -1,
-		token:  token,
-		val:    int64(len(traces)),
-	}
-	status = getHTTPStatusCode(status, errr)
-	for i := 0; i < w.maxRetry; i++ {
-		// retry in the cases where http status codes are not found or an http timeout status is encountered
-		if status.status == -1 || status.status == http.StatusRequestTimeout || status.status == http.StatusGatewayTimeout || status.status == 598 {
-			atomic.AddInt64(&w.stats.NumberOfRetries, 1)
-			errr = addSpans(context.Background(), w.buffer)
-			status = getHTTPStatusCode(status, errr)
-		} else {
-			break
-		}
+// WithBlockingAdd makes adding data wait for room when the buffer of its token's channel is full, so
+// producers slow down instead of data being dropped.  The Add methods that take a context give up when it
+// is done, and the ...WithToken methods wait until the sink is closed.
+func WithBlockingAdd() AsyncMultiTokenSinkOption {
+	return func(a *AsyncMultiTokenSink) {
+		a.blockOnFull = true
 	}
-	w.stats.TotalSpansByToken.Increment(status)
-	if errr != nil {
-		_ = w.errorHandler(errr)
+}
+
+// DroppedBatch is a batch the sink gave up on after retrying.  Only the slice of the batch's datum type is
+// set.
+type DroppedBatch struct {
+	Token      string
+	Datapoints []*datapoint.Datapoint
+	Events     []*event.Event
+	Spans      []*trace.Span
+	// Err is the error the last attempt to emit the batch failed with
+	Err error
+}
+
+// DroppedBatchHandler is given each batch the sink drops after retrying.  It is called from the sink's
+// workers, which wait for it to return.
+type DroppedBatchHandler func(batch *DroppedBatch)
+
+// WithDroppedBatchHandler passes batches that still fail after retrying to handler, after the sink's error
+// handler, so they can be saved or sent elsewhere instead of being lost
+func WithDroppedBatchHandler(handler DroppedBatchHandler) AsyncMultiTokenSinkOption {
+	return func(a *AsyncMultiTokenSink) {
+		a.droppedBatchHandler = handler
 	}
 }
 
-func (w *spanWorker) processMsg(msg *spanMsg) {
-	for len(msg.data) > 0 {
-		msgLength := len(msg.data)
-		remainingBuffer := w.batchSize - len(w.buffer)
-		if msgLength > remainingBuffer {
-			msgLength = remainingBuffer
-		}
-		w.buffer = append(w.buffer, msg.data[:msgLength]...)
-		msg.data = msg.data[msgLength:]
-		if len(w.buffer) >= w.batchSize {
-			w.emit(msg.token)
-		}
+// WithOrderedDelivery pins each token to a single worker, so its batches are emitted in the order they were
+// added, which keeps counters and cumulative metrics in order.  Otherwise the draining threads sharing a
+// channel can emit batches of the same token out of order.
+func WithOrderedDelivery() AsyncMultiTokenSinkOption {
+	return func(a *AsyncMultiTokenSink) {
+		a.orderedDelivery = true
 	}
 }
 
-// bufferDatapoints is responsible for batching incoming datapoints into a buffer
-func (w *spanWorker) bufferFunc(msg *spanMsg) (stop bool) {
-	lastTokenSeen := msg.token
-	w.processMsg(msg)
-outer:
-	for len(w.buffer) < w.batchSize {
-		select {
-		case msg = <-w.input:
-			if msg.token != lastTokenSeen {
-				// if the token changes, then emit what ever is in the buffer before proceeding
-				w.emit(lastTokenSeen)
-				lastTokenSeen = msg.token
-			}
-			w.processMsg(msg)
-		default:
-			break outer // emit what ever is in the buffer if there are no more datapoints to read
-		}
+// WithSinkCompressionLevel gzips request bodies at level, from gzip.BestSpeed to gzip.BestCompression
+func WithSinkCompressionLevel(level int) AsyncMultiTokenSinkOption {
+	return func(a *AsyncMultiTokenSink) {
+		a.httpSinkOptions = append(a.httpSinkOptions, WithCompressionLevel(level))
 	}
-	// emit the data in the buffer
-	w.emit(msg.token)
-	return
 }
 
-// newBuffer buffers datapoints and traces in the pipeline for the duration specified during Startup
-func (w *spanWorker) newBuffer() {
-	for {
-		select {
-		// check if the sink is closing and return if so
-		// reading from a.closing will only return a value if the a.closing channel is closed
-		// nothing should ever write into it
-		case <-w.closing:
-			// signal that the worker is done
-			w.done <- true
-			return
-		case msg := <-w.input:
-			// process the Datapoint Message
-			w.bufferFunc(msg)
-		}
+// WithSinkCompressionThreshold only compresses request bodies larger than threshold bytes
+func WithSinkCompressionThreshold(threshold int) AsyncMultiTokenSinkOption {
+	return func(a *AsyncMultiTokenSink) {
+		a.httpSinkOptions = append(a.httpSinkOptions, WithCompressionThreshold(threshold))
+	}
+}
+
+// WithSinkCompressor compresses request bodies with compressor instead of gzip
+func WithSinkCompressor(compressor Compressor) AsyncMultiTokenSinkOption {
+	return func(a *AsyncMultiTokenSink) {
+		a.httpSinkOptions = append(a.httpSinkOptions, WithCompressor(compressor))
 	}
 }
 
-func newSpanWorker(batchSize int, errorHandler func(error) error, stats *asyncMultiTokenSinkStats, closing chan bool, done chan bool, input chan *spanMsg, maxRetry int) *spanWorker {
-	w := &spanWorker{
-		worker:    newWorker(errorHandler, closing, done),
-		input:     input,
-		buffer:    make([]*trace.Span, 0), // let it grow, let it grow!
-		batchSize: batchSize,
-		stats:     stats,
-		maxRetry:  maxRetry,
+// WithoutSinkCompression sends request bodies uncompressed, trading bandwidth for CPU
+func WithoutSinkCompression() AsyncMultiTokenSinkOption {
+	return func(a *AsyncMultiTokenSink) {
+		a.httpSinkOptions = append(a.httpSinkOptions, func(s *HTTPSink) {
+			s.DisableCompression = true
+		})
 	}
-	go w.newBuffer()
-	return w
 }
 
-// asyncMultiTokenSinkStats - holds stats about the sink
-type asyncMultiTokenSinkStats struct {
-	DefaultDimensions      map[string]string
-	TotalDatapointsByToken *AsyncTokenStatusCounter
-	TotalEventsByToken     *AsyncTokenStatusCounter
-	TotalSpansByToken      *AsyncTokenStatusCounter
-	DPBatchSizes           *RollingBucket
-	EVBatchSizes           *RollingBucket
-	SpanBatchSizes         *RollingBucket
+// WithMaxStatsTokens caps how many tokens the per token status counts, gauges and payload sizes keep,
+// forgetting the least recently seen tokens, for sinks that see many short lived tokens
+func WithMaxStatsTokens(max int) AsyncMultiTokenSinkOption {
+	return func(a *AsyncMultiTokenSink) {
+		a.maxStatsTokens = max
+	}
+}
 
-	TotalDatapointsBuffered  int64
-	TotalEventsBuffered      int64
-	TotalSpansBuffered       int64
-	NumberOfDatapointWorkers int64
-	NumberOfEventWorkers     int64
-	NumberOfSpanWorkers      int64
-	NumberOfRetries          int64
+// WithTokenValidator checks the token of data before adding it, rejecting data whose token isn't valid with
+// an error wrapping ErrInvalidToken
+func WithTokenValidator(validator TokenValidator) AsyncMultiTokenSinkOption {
+	return func(a *AsyncMultiTokenSink) {
+		a.tokenValidator = validator
+	}
 }
 
-func (a *asyncMultiTokenSinkStats) Close() {
-	close(a.TotalDatapointsByToken.stop)
-	close(a.TotalEventsByToken.stop)
-	close(a.TotalSpansByToken.stop)
+// WithTokenObfuscator obfuscates the tokens in the sink's errors and in the token dimension of its stats,
+// with HashToken, LastFourToken or a TokenObfuscator of your own.  Without it stats have tokens as is, and
+// errors have them hashed with HashToken.
+func WithTokenObfuscator(obfuscator TokenObfuscator) AsyncMultiTokenSinkOption {
+	return func(a *AsyncMultiTokenSink) {
+		a.obfuscator = obfuscator
+	}
 }
 
-func newAsyncMultiTokenSinkStats(buffer int, numChannels int64, numDrainingThreads int64, batchSize int) *asyncMultiTokenSinkStats {
-	workerCount := numChannels * numDrainingThreads
-	defaultDims := map[string]string{
-		"buffer_size":        strconv.Itoa(buffer),
-		"numChannels":        strconv.FormatInt(numChannels, 10),
-		"numDrainingThreads": strconv.FormatInt(numDrainingThreads, 10),
-		"worker_count":       strconv.FormatInt(workerCount, 10),
-		"batch_size":         strconv.Itoa(batchSize),
+// WithPriorityLanes gives each channel of the sink a high priority lane of size buffer for data added
+// with HighPriority, which workers drain first
+func WithPriorityLanes(buffer int) AsyncMultiTokenSinkOption {
+	return func(a *AsyncMultiTokenSink) {
+		a.priorityBuffer = buffer
 	}
-	return &asyncMultiTokenSinkStats{
-		DefaultDimensions:      defaultDims,
-		TotalDatapointsByToken: NewAsyncTokenStatusCounter("total_datapoints_by_token", buffer, workerCount, defaultDims),
-		TotalEventsByToken:     NewAsyncTokenStatusCounter("total_events_by_token", buffer, workerCount, defaultDims),
-		TotalSpansByToken:      NewAsyncTokenStatusCounter("total_spans_by_token", buffer, workerCount, defaultDims),
-		DPBatchSizes:           NewRollingBucket("batch_sizes", map[string]string{"path": "pops_to_ingest", "datum_type": "datapoint"}),
-		EVBatchSizes:           NewRollingBucket("batch_sizes", map[string]string{"path": "pops_to_ingest", "datum_type": "event"}),
-		SpanBatchSizes:         NewRollingBucket("batch_sizes", map[string]string{"path": "pops_to_ingest", "datum_type": "span"}),
+}
+
+// WithDeadlinePropagation sends each batch with the deadline of the context its items were added with, and
+// cancels it when that context is.  Batches always carry that context's values, like trace IDs, since items
+// added with different contexts are never batched together.
+func WithDeadlinePropagation() AsyncMultiTokenSinkOption {
+	return func(a *AsyncMultiTokenSink) {
+		a.propagateDeadline = true
 	}
 }
 
 // AsyncMultiTokenSink asynchronously sends datapoints for multiple tokens
 type AsyncMultiTokenSink struct {
-	ShutdownTimeout time.Duration     // ShutdownTimeout is how long the sink should wait before timing out after Close() is called
-	errorHandler    func(error) error // error handler is a handler for errors encountered while emitting metrics
-	Hasher          hash.Hash32       // Hasher is used to hash access tokens to a worker
-	lock            sync.RWMutex      // lock is a mutex preventing concurrent access to getWorker
-	// closing is channel to signal the workers that the sink is closing
-	// nothing is ever passed to the channel it is just open and
-	// it will be read from by multiple select statements across multiple workers
-	// when the channel is closed by close() all of the select statements reading from the channel will receive nil.
-	// this is a broadcast mechanism to signal at once to everything that the sink is closing.
-	closing       chan bool
-	dpDone        chan bool
-	evDone        chan bool
-	spansDone     chan bool
-	dpChannels    []*dpChannel              // dpChannels is an array of dpChannels used to emit datapoints asynchronously
-	evChannels    []*evChannel              // evChannels is an array of evChannels used to emit events asynchronously
-	spanChannels  []*spanChannel            // spanChannels is an array of spanChannel used to emit spans asynchronously
-	dpBuffered    int64                     // number of datapoints in the sink that haven't been emitted
-	evBuffered    int64                     // number of events in the sink that haven't been emitted
-	spansBuffered int64                     // number of spans in the sink that haven't been emitted
-	NewHTTPClient func() *http.Client       // function used to create an http client for the underlying sinks
-	stats         *asyncMultiTokenSinkStats // stats are stats about that sink that can be collected from the Datapoitns() method
-	maxRetry      int                       // maximum number of times to retry sending a set of datapoints or events
-}
-
-// Datapoints returns a set of datapoints about the sink
+	ShutdownTimeout time.Duration                   // ShutdownTimeout is how long the sink should wait before timing out after Close() is called
+	errorHandler    func(error) error               // error handler is a handler for errors encountered while emitting metrics
+	Hasher          hash.Hash32                     // Hasher is used to hash access tokens to a worker
+	lock            sync.RWMutex                    // lock is a mutex preventing concurrent access to getWorker
+	datapoints      *Pipeline[*datapoint.Datapoint] // datapoints is the pipeline used to emit datapoints asynchronously
+	events          *Pipeline[*event.Event]         // events is the pipeline used to emit events asynchronously
+	spans           *Pipeline[*trace.Span]          // spans is the pipeline used to emit spans asynchronously
+	NewHTTPClient   func() *http.Client             // function used to create an http client for the underlying sinks
+	defaultDims     map[string]string               // defaultDims are the dimensions of the datapoints about the sink
+	maxRetry        int                             // maximum number of times to retry sending a set of datapoints or events
+	datumTypes      DatumType                       // datumTypes are the types the sink has pipelines for
+	// disableDetailedStats, statsSampleRate and maxStatsTokens are passed to each pipeline's PipelineConfig
+	disableDetailedStats bool
+	statsSampleRate      int
+	maxStatsTokens       int
+	// idempotencyKeyHeader is the header the workers send idempotency keys in, if any
+	idempotencyKeyHeader string
+	// cardinality, if set, filters the datapoints added to the sink
+	cardinality *CardinalityGuard
+	// tokenProvider, if set, resolves tokens for data added without one on the context
+	tokenProvider TokenProvider
+	// tokenValidator, if set, checks tokens before their data is added
+	tokenValidator TokenValidator
+	// obfuscator, if set, obfuscates the tokens in errors and dimensions
+	obfuscator TokenObfuscator
+	// priorityBuffer is the size of each pipeline channel's high priority lane
+	priorityBuffer int
+	// propagateDeadline emits batches with the deadline of the context they were added with
+	propagateDeadline bool
+	// retryPolicy is passed to each pipeline's PipelineConfig
+	retryPolicy *RetryPolicy
+	// maxBufferDuration is passed to each pipeline's PipelineConfig
+	maxBufferDuration time.Duration
+	// blockOnFull and orderedDelivery are passed to each pipeline's PipelineConfig
+	blockOnFull     bool
+	orderedDelivery bool
+	// droppedBatchHandler, if set, is given batches the pipelines drop
+	droppedBatchHandler DroppedBatchHandler
+	// httpSinkOptions are given to the HTTPSink of each worker
+	httpSinkOptions []HTTPSinkOption
+	// payloads counts the bytes sent, before and after compression
+	payloads *payloadStats
+	// routes are the endpoints of tokens registered with RegisterTokenEndpoint
+	routesLock sync.RWMutex
+	routes     map[string]TokenEndpoints
+}
+
+// TokenEndpoints are the ingest endpoints data for a token is sent to.  Empty endpoints are left as the
+// sink's endpoints.
+type TokenEndpoints struct {
+	DatapointEndpoint string
+	EventEndpoint     string
+	TraceEndpoint     string
+}
+
+// RegisterTokenEndpoint sends data for token to the given endpoints instead of the sink's, so one sink
+// can send to different realms or gateways.  Empty endpoints are left as the sink's.
+func (a *AsyncMultiTokenSink) RegisterTokenEndpoint(token, datapointEndpoint, eventEndpoint, traceEndpoint string) {
+	a.routesLock.Lock()
+	if a.routes == nil {
+		a.routes = make(map[string]TokenEndpoints)
+	}
+	a.routes[token] = TokenEndpoints{
+		DatapointEndpoint: datapointEndpoint,
+		EventEndpoint:     eventEndpoint,
+		TraceEndpoint:     traceEndpoint,
+	}
+	a.routesLock.Unlock()
+}
+
+// UnregisterTokenEndpoint sends data for token to the sink's endpoints again
+func (a *AsyncMultiTokenSink) UnregisterTokenEndpoint(token string) {
+	a.routesLock.Lock()
+	delete(a.routes, token)
+	a.routesLock.Unlock()
+}
+
+// tokenEndpoints returns the endpoints registered for token
+func (a *AsyncMultiTokenSink) tokenEndpoints(token string) (TokenEndpoints, bool) {
+	a.routesLock.RLock()
+	defer a.routesLock.RUnlock()
+	endpoints, exists := a.routes[token]
+	return endpoints, exists
+}
+
+// routeEndpoint returns the endpoint chosen by pick from the endpoints registered for token, or
+// defaultEndpoint
+func (a *AsyncMultiTokenSink) routeEndpoint(token string, defaultEndpoint string, pick func(TokenEndpoints) string) string {
+	if endpoints, exists := a.tokenEndpoints(token); exists && pick(endpoints) != "" {
+		return pick(endpoints)
+	}
+	return defaultEndpoint
+}
+
+// Datapoints returns a set of datapoints about the sink.  Disabled datum types have no datapoints.
 func (a *AsyncMultiTokenSink) Datapoints() (dps []*datapoint.Datapoint) {
-	dps = append(dps, []*datapoint.Datapoint{
-		Gauge("total_datapoints_buffered", a.stats.DefaultDimensions, atomic.LoadInt64(&a.stats.TotalDatapointsBuffered)),
-		Gauge("total_events_buffered", a.stats.DefaultDimensions, atomic.LoadInt64(&a.stats.TotalEventsBuffered)),
-		Gauge("total_spans_buffered", a.stats.DefaultDimensions, atomic.LoadInt64(&a.stats.TotalSpansBuffered)),
-	}...)
-	dps = append(dps, a.stats.TotalDatapointsByToken.Datapoints()...)
-	dps = append(dps, a.stats.TotalEventsByToken.Datapoints()...)
-	dps = append(dps, a.stats.TotalSpansByToken.Datapoints()...)
-	dps = append(dps, a.stats.DPBatchSizes.Datapoints()...)
-	dps = append(dps, a.stats.EVBatchSizes.Datapoints()...)
-	dps = append(dps, a.stats.SpanBatchSizes.Datapoints()...)
-	dps = append(dps, Cumulative("total_retries", a.stats.DefaultDimensions, atomic.LoadInt64(&a.stats.NumberOfRetries)))
+	var retries int64
+	if a.datapoints != nil {
+		dps = append(dps, Gauge("total_datapoints_buffered", a.defaultDims, atomic.LoadInt64(&a.datapoints.buffered)))
+		retries += atomic.LoadInt64(&a.datapoints.retries)
+	}
+	if a.events != nil {
+		dps = append(dps, Gauge("total_events_buffered", a.defaultDims, atomic.LoadInt64(&a.events.buffered)))
+		retries += atomic.LoadInt64(&a.events.retries)
+	}
+	if a.spans != nil {
+		dps = append(dps, Gauge("total_spans_buffered", a.defaultDims, atomic.LoadInt64(&a.spans.buffered)))
+		retries += atomic.LoadInt64(&a.spans.retries)
+	}
+	if a.datapoints != nil {
+		dps = append(dps, a.datapoints.tokenDatapoints()...)
+	}
+	if a.events != nil {
+		dps = append(dps, a.events.tokenDatapoints()...)
+	}
+	if a.spans != nil {
+		dps = append(dps, a.spans.tokenDatapoints()...)
+	}
+	if a.datapoints != nil {
+		dps = append(dps, a.datapoints.evictedDatapoints()...)
+		dps = append(dps, a.datapoints.batchSizeDatapoints()...)
+	}
+	if a.events != nil {
+		dps = append(dps, a.events.evictedDatapoints()...)
+		dps = append(dps, a.events.batchSizeDatapoints()...)
+	}
+	if a.spans != nil {
+		dps = append(dps, a.spans.evictedDatapoints()...)
+		dps = append(dps, a.spans.batchSizeDatapoints()...)
+	}
+	dps = append(dps, Cumulative("total_retries", a.defaultDims, retries))
+	dps = append(dps, obfuscateTokenDims(a.payloads.Datapoints(), a.obfuscator)...)
+	if a.cardinality != nil {
+		dps = append(dps, obfuscateTokenDims(a.cardinality.Datapoints(), a.obfuscator)...)
+	}
+	if c, ok := a.tokenProvider.(Collector); ok {
+		dps = append(dps, c.Datapoints()...)
+	}
+	if c, ok := a.tokenValidator.(Collector); ok {
+		dps = append(dps, c.Datapoints()...)
+	}
 	return
 }
 
@@ -644,169 +644,152 @@ func (a *AsyncMultiTokenSink) getChannel(input string, size int) (workerID int64
 }
 
 // AddDatapointsWithToken emits a list of datapoints using a supplied token
-//nolint:dupl
 func (a *AsyncMultiTokenSink) AddDatapointsWithToken(token string, datapoints []*datapoint.Datapoint) (err error) {
-	var channelID int64
-	if channelID, err = a.getChannel(token, len(a.dpChannels)); err == nil {
-		worker := a.dpChannels[channelID]
-		_ = atomic.AddInt64(&a.dpBuffered, int64(len(datapoints)))
-		m := &dpMsg{
-			token: token,
-			data:  datapoints,
-		}
-		select {
-		// check if the sink is closing and return if so
-		// reading from a.closing will only return a value if the a.closing channel is closed
-		case <-a.closing:
-			err = fmt.Errorf("unable to add datapoints: the worker has been stopped")
-		default:
-			select {
-			case worker.input <- m:
-				atomic.AddInt64(&a.stats.TotalDatapointsBuffered, int64(len(datapoints)))
-			default:
-				err = fmt.Errorf("unable to add datapoints: the input buffer is full")
-			}
-		}
-	} else {
-		err = fmt.Errorf("unable to add datapoints: there was an error while hashing the token to a worker. %w", err)
+	if a.datapoints == nil {
+		return disabledErr("datapoints")
 	}
-
-	return
+	return a.addDatapoints(context.Background(), Token{Value: token}, datapoints)
 }
 
-// AddDatapoints add datapoints to the multi token sync using a context that has the TokenCtxKey
+// AddDatapoints add datapoints to the multi token sync using a context that has the TokenCtxKey, or with
+// the tokens from the sink's TokenProvider.  A sink created WithBlockingAdd waits for room until ctx is done.
 func (a *AsyncMultiTokenSink) AddDatapoints(ctx context.Context, datapoints []*datapoint.Datapoint) (err error) {
-	if token := ctx.Value(TokenCtxKey); token != nil {
-		err = a.AddDatapointsWithToken(token.(string), datapoints)
-	} else {
-		err = fmt.Errorf("no value was found on the context with key '%s'", TokenCtxKey)
+	if a.datapoints == nil {
+		return disabledErr("datapoints")
 	}
-	return
+	if token, ok := TokenFromContext(ctx); ok {
+		return a.addDatapoints(ctx, token, datapoints)
+	}
+	if a.tokenProvider != nil {
+		return addByToken(ctx, a.tokenProvider, datapoints, func(token Token, datapoints []*datapoint.Datapoint) error {
+			return a.addDatapoints(ctx, token, datapoints)
+		})
+	}
+	return a.datapoints.Add(ctx, datapoints)
+}
+
+// AddDatapointsWithPriority emits a list of datapoints using a supplied token.  On a sink created
+// WithPriorityLanes, HighPriority datapoints, like heartbeats, are emitted before others and normal priority
+// data is dropped to make room for them when the sink is overloaded.
+func (a *AsyncMultiTokenSink) AddDatapointsWithPriority(token string, datapoints []*datapoint.Datapoint, priority Priority) error {
+	if a.datapoints == nil {
+		return disabledErr("datapoints")
+	}
+	if a.cardinality != nil {
+		datapoints = a.cardinality.Filter(token, datapoints)
+	}
+	return a.datapoints.AddWithPriority(Token{Value: token}, datapoints, priority)
+}
+
+// addDatapoints filters datapoints through the cardinality guard, if any, and adds them with token
+func (a *AsyncMultiTokenSink) addDatapoints(ctx context.Context, token Token, datapoints []*datapoint.Datapoint) error {
+	if a.cardinality != nil {
+		datapoints = a.cardinality.Filter(token.Value, datapoints)
+	}
+	return a.datapoints.addContext(ctx, token, datapoints)
 }
 
 // AddEventsWithToken emits a list of events using a supplied token
-//nolint:dupl
 func (a *AsyncMultiTokenSink) AddEventsWithToken(token string, events []*event.Event) (err error) {
-	var channelID int64
-	if channelID, err = a.getChannel(token, len(a.evChannels)); err == nil {
-		worker := a.evChannels[channelID]
-		_ = atomic.AddInt64(&a.evBuffered, int64(len(events)))
-		m := &evMsg{
-			token: token,
-			data:  events,
-		}
-		select {
-		// check if the sink is closing and return if so
-		// reading from a.closing will only return a value if the a.closing channel is closed
-		case <-a.closing:
-			err = fmt.Errorf("unable to add events: the worker has been stopped")
-		default:
-			select {
-			case worker.input <- m:
-				atomic.AddInt64(&a.stats.TotalEventsBuffered, int64(len(events)))
-			default:
-				err = fmt.Errorf("unable to add events: the input buffer is full")
-			}
-		}
-	} else {
-		err = fmt.Errorf("unable to add events: there was an error while hashing the token to a worker. %w", err)
+	if a.events == nil {
+		return disabledErr("events")
 	}
-	return
+	return a.events.AddWithToken(Token{Value: token}, events)
 }
 
-// AddEvents add datapoints to the multi token sync using a context that has the TokenCtxKey
+// AddEvents add datapoints to the multi token sync using a context that has the TokenCtxKey, or with the
+// tokens from the sink's TokenProvider.  A sink created WithBlockingAdd waits for room until ctx is done.
 func (a *AsyncMultiTokenSink) AddEvents(ctx context.Context, events []*event.Event) (err error) {
-	if token := ctx.Value(TokenCtxKey); token != nil {
-		err = a.AddEventsWithToken(token.(string), events)
-	} else {
-		err = fmt.Errorf("no value was found on the context with key '%s'", TokenCtxKey)
+	if a.events == nil {
+		return disabledErr("events")
 	}
-	return
+	if _, ok := TokenFromContext(ctx); !ok && a.tokenProvider != nil {
+		return addByToken(ctx, a.tokenProvider, events, func(token Token, events []*event.Event) error {
+			return a.events.addContext(ctx, token, events)
+		})
+	}
+	return a.events.Add(ctx, events)
 }
 
-// AddSpansWithToken emits a list of events using a supplied token
-//nolint:dupl
+// AddSpansWithToken emits a list of spans using a supplied token
 func (a *AsyncMultiTokenSink) AddSpansWithToken(token string, spans []*trace.Span) (err error) {
-	var channelID int64
-	if channelID, err = a.getChannel(token, len(a.evChannels)); err == nil {
-		worker := a.spanChannels[channelID]
-		_ = atomic.AddInt64(&a.spansBuffered, int64(len(spans)))
-		m := &spanMsg{
-			token: token,
-			data:  spans,
-		}
-		select {
-		// check if the sink is closing and return if so
-		// reading from a.closing will only return a value if the a.closing channel is closed
-		case <-a.closing:
-			err = fmt.Errorf("unable to add spans: the worker has been stopped")
-		default:
-			select {
-			case worker.input <- m:
-				atomic.AddInt64(&a.stats.TotalSpansBuffered, int64(len(spans)))
-			default:
-				err = fmt.Errorf("unable to add spans: the input buffer is full")
-			}
-		}
-	} else {
-		err = fmt.Errorf("unable to add spans: there was an error while hashing the token to a worker. %w", err)
+	if a.spans == nil {
+		return disabledErr("spans")
 	}
-	return
+	return a.spans.AddWithToken(Token{Value: token}, spans)
 }
 
-// AddSpans add datepoints to the multitoken sync using a context that has the TokenCtxKey
+// AddSpans add datepoints to the multitoken sync using a context that has the TokenCtxKey, or with the
+// tokens from the sink's TokenProvider.  A sink created WithBlockingAdd waits for room until ctx is done.
 func (a *AsyncMultiTokenSink) AddSpans(ctx context.Context, spans []*trace.Span) (err error) {
-	if token := ctx.Value(TokenCtxKey); token != nil {
-		err = a.AddSpansWithToken(token.(string), spans)
-	} else {
-		err = fmt.Errorf("no value was found on the context with key '%s'", TokenCtxKey)
+	if a.spans == nil {
+		return disabledErr("spans")
 	}
-	return
+	if _, ok := TokenFromContext(ctx); !ok && a.tokenProvider != nil {
+		return addByToken(ctx, a.tokenProvider, spans, func(token Token, spans []*trace.Span) error {
+			return a.spans.addContext(ctx, token, spans)
+		})
+	}
+	return a.spans.Add(ctx, spans)
+}
+
+// disabledErr is the error adding a disabled datum type returns
+func disabledErr(kind string) error {
+	return fmt.Errorf("unable to add %s: %w", kind, ErrDatumTypeDisabled)
 }
 
 // close workers and get the number of datapoints and events dropped if they do not close cleanly
 func (a *AsyncMultiTokenSink) closeWorkers() (datapointsDropped, eventsDropped, spansDropped int64) {
 	// signal to all workers that the sink is closing
-	close(a.closing)
+	if a.datapoints != nil {
+		a.datapoints.stop()
+	}
+	if a.events != nil {
+		a.events.stop()
+	}
+	if a.spans != nil {
+		a.spans.stop()
+	}
 
-	// timer to timeout close operations
-	timeout := time.After(a.ShutdownTimeout)
+	// the pipelines share the timeout for close operations
+	deadline := time.Now().Add(a.ShutdownTimeout)
 
-done:
-	for {
-		if atomic.LoadInt64(&a.stats.NumberOfEventWorkers) == 0 && atomic.LoadInt64(&a.stats.NumberOfDatapointWorkers) == 0 && atomic.LoadInt64(&a.stats.NumberOfSpanWorkers) == 0 {
-			// return nil if they all are done
-			break done
-		}
-		select {
-		case <-timeout:
-			datapointsDropped = atomic.LoadInt64(&a.stats.TotalDatapointsBuffered)
-			eventsDropped = atomic.LoadInt64(&a.stats.TotalEventsBuffered)
-			spansDropped = atomic.LoadInt64(&a.stats.TotalSpansBuffered)
-			break done
-		case <-a.dpDone:
-			atomic.AddInt64(&a.stats.NumberOfDatapointWorkers, -1)
-		case <-a.evDone:
-			atomic.AddInt64(&a.stats.NumberOfEventWorkers, -1)
-		case <-a.spansDone:
-			atomic.AddInt64(&a.stats.NumberOfSpanWorkers, -1)
-		}
+	if a.datapoints != nil {
+		datapointsDropped = a.datapoints.wait(time.After(time.Until(deadline)))
+		a.datapoints.stopStats()
+	}
+	if a.events != nil {
+		eventsDropped = a.events.wait(time.After(time.Until(deadline)))
+		a.events.stopStats()
+	}
+	if a.spans != nil {
+		spansDropped = a.spans.wait(time.After(time.Until(deadline)))
+		a.spans.stopStats()
 	}
-	a.stats.Close()
 	return
 }
 
-// Close stops the existing workers and prevents additional datapoints from being added
-// if a ShutdownTimeout is set on the sink, it will be used as a timeout for closing the sink
-// the default timeout is 5 seconds
+// Close prevents additional datapoints from being added and stops the existing workers once they have
+// emitted everything buffered.  If a ShutdownTimeout is set on the sink, it will be used as a timeout for
+// closing the sink, after which whatever is still buffered is dropped.  The default timeout is 5 seconds
 func (a *AsyncMultiTokenSink) Close() (err error) {
 	// close the workers and collect the number of datapoints and events still buffered
 	datapointsDropped, eventsDropped, spansDropped := a.closeWorkers()
 
 	// if something didn't close cleanly return an appropriate error message
-	if atomic.LoadInt64(&a.stats.NumberOfDatapointWorkers) > 0 || atomic.LoadInt64(&a.stats.NumberOfEventWorkers) > 0 || datapointsDropped > 0 || eventsDropped > 0 || spansDropped > 0 {
+	var workers int64
+	if a.datapoints != nil {
+		workers += atomic.LoadInt64(&a.datapoints.workers)
+	}
+	if a.events != nil {
+		workers += atomic.LoadInt64(&a.events.workers)
+	}
+	if a.spans != nil {
+		workers += atomic.LoadInt64(&a.spans.workers)
+	}
+	if workers > 0 || datapointsDropped > 0 || eventsDropped > 0 || spansDropped > 0 {
 		err = fmt.Errorf("some workers (%d) timedout while stopping the sink approximately %d datapoints, %d events and %d spans may have been dropped",
-			atomic.LoadInt64(&a.stats.NumberOfDatapointWorkers)+atomic.LoadInt64(&a.stats.NumberOfEventWorkers), datapointsDropped, eventsDropped, spansDropped)
+			workers, datapointsDropped, eventsDropped, spansDropped)
 	}
 	return
 }
@@ -818,113 +801,68 @@ func newDefaultHTTPClient() *http.Client {
 	}
 }
 
-// dpChannel is a container with a datapoint input channel and a series of workers to drain the channel
-type dpChannel struct {
-	input   chan *dpMsg
-	workers []*datapointWorker
-}
-
-// evChannel is a container with an event input channel and a series of workers to drain the channel
-type evChannel struct {
-	input   chan *evMsg
-	workers []*eventWorker
-}
-
-// spanChannel is a container with a trace input channel and a series of workers to drain the channel
-type spanChannel struct {
-	input   chan *spanMsg
-	workers []*spanWorker
-}
-
-//nolint:dupl
-func newDPChannel(numDrainingThreads int64, buffer int, batchSize int, datapointEndpoint string, userAgent string, httpClient func() *http.Client, errorHandler func(error) error, stats *asyncMultiTokenSinkStats, closing chan bool, done chan bool, maxRetry int) (dpc *dpChannel) {
-	dpc = &dpChannel{
-		input:   make(chan *dpMsg, int64(buffer)),
-		workers: make([]*datapointWorker, numDrainingThreads),
+// onUnauthorized returns the function the pipelines call with rejected tokens, if the TokenProvider wants them
+func (a *AsyncMultiTokenSink) onUnauthorized() func(token string) {
+	var invalidators []tokenInvalidator
+	if inv, ok := a.tokenProvider.(tokenInvalidator); ok {
+		invalidators = append(invalidators, inv)
 	}
-	for i := int64(0); i < numDrainingThreads; i++ {
-		dpWorker := newDatapointWorker(batchSize, errorHandler, stats, closing, done, dpc.input, maxRetry)
-		if datapointEndpoint != "" {
-			dpWorker.sink.DatapointEndpoint = datapointEndpoint
-		}
-		if userAgent != "" {
-			dpWorker.sink.UserAgent = userAgent
-		}
-		if httpClient != nil {
-			dpWorker.sink.Client = httpClient()
+	if inv, ok := a.tokenValidator.(tokenInvalidator); ok {
+		invalidators = append(invalidators, inv)
+	}
+	switch len(invalidators) {
+	case 0:
+		return nil
+	case 1:
+		return invalidators[0].InvalidateToken
+	}
+	return func(token string) {
+		for _, inv := range invalidators {
+			inv.InvalidateToken(token)
 		}
-		dpc.workers[i] = dpWorker
 	}
-	return
 }
 
-//nolint:dupl
-func newEVChannel(numDrainingThreads int64, buffer int, batchSize int, eventEndpoint string, userAgent string, httpClient func() *http.Client, errorHandler func(error) error, stats *asyncMultiTokenSinkStats, closing chan bool, done chan bool, maxRetry int) (evc *evChannel) {
-	evc = &evChannel{
-		input:   make(chan *evMsg, int64(buffer)),
-		workers: make([]*eventWorker, numDrainingThreads),
+// onDropped returns the OnDropped function of a pipeline that passes its batches to handler, using set to put
+// the data in a DroppedBatch
+func onDropped[T any](handler DroppedBatchHandler, set func(*DroppedBatch, []T)) func(token Token, data []T, err error) {
+	if handler == nil {
+		return nil
 	}
-	for i := int64(0); i < numDrainingThreads; i++ {
-		evWorker := newEventWorker(batchSize, errorHandler, stats, closing, done, evc.input, maxRetry)
-		if eventEndpoint != "" {
-			evWorker.sink.EventEndpoint = eventEndpoint
-		}
-		if userAgent != "" {
-			evWorker.sink.UserAgent = userAgent
-		}
-		if httpClient != nil {
-			evWorker.sink.Client = httpClient()
-		}
-		evc.workers[i] = evWorker
+	return func(token Token, data []T, err error) {
+		batch := &DroppedBatch{Token: token.Value, Err: err}
+		set(batch, data)
+		handler(batch)
 	}
-	return
 }
 
-//nolint:dupl
-func newSpanChannel(numDrainingThreads int64, buffer int, batchSize int, traceEndpoint string, userAgent string, httpClient func() *http.Client, errorHandler func(error) error, stats *asyncMultiTokenSinkStats, closing chan bool, done chan bool, maxRetry int) (spc *spanChannel) {
-	spc = &spanChannel{
-		input:   make(chan *spanMsg, int64(buffer)),
-		workers: make([]*spanWorker, numDrainingThreads),
+// newWorkerSink returns the HTTPSink a single worker emits with
+func (a *AsyncMultiTokenSink) newWorkerSink(userAgent string) *HTTPSink {
+	sink := NewHTTPSink(a.httpSinkOptions...)
+	sink.IdempotencyKeyHeader = a.idempotencyKeyHeader
+	if userAgent != "" {
+		sink.UserAgent = userAgent
 	}
-	for i := int64(0); i < numDrainingThreads; i++ {
-		spanWorker := newSpanWorker(batchSize, errorHandler, stats, closing, done, spc.input, maxRetry)
-		if traceEndpoint != "" {
-			spanWorker.sink.TraceEndpoint = traceEndpoint
-		}
-		if userAgent != "" {
-			spanWorker.sink.UserAgent = userAgent
-		}
-		if httpClient != nil {
-			spanWorker.sink.Client = httpClient()
-		}
-		spc.workers[i] = spanWorker
+	if a.NewHTTPClient != nil {
+		sink.Client = a.NewHTTPClient()
 	}
-	return
+	return sink
 }
 
 // NewAsyncMultiTokenSink returns a sink that asynchronously emits datapoints with different tokens
-func NewAsyncMultiTokenSink(numChannels int64, numDrainingThreads int64, buffer int, batchSize int, datapointEndpoint, eventEndpoint, traceEndpoint, userAgent string, httpClient func() *http.Client, errorHandler func(error) error, maxRetry int) *AsyncMultiTokenSink {
+func NewAsyncMultiTokenSink(numChannels int64, numDrainingThreads int64, buffer int, batchSize int, datapointEndpoint, eventEndpoint, traceEndpoint, userAgent string, httpClient func() *http.Client, errorHandler func(error) error, maxRetry int, opts ...AsyncMultiTokenSinkOption) *AsyncMultiTokenSink {
 	a := &AsyncMultiTokenSink{
 		ShutdownTimeout: time.Second * 5,
 		errorHandler:    DefaultErrorHandler,
-		dpChannels:      make([]*dpChannel, numChannels),
-		evChannels:      make([]*evChannel, numChannels),
-		spanChannels:    make([]*spanChannel, numChannels),
 		Hasher:          fnv.New32(),
-		// closing is channel to signal the workers that the sink is closing
-		// nothing is ever passed to the channel it is just open and
-		// it will be read from by multiple select statements across multiple workers
-		// when the channel is closed by close() all of the select statements reading from the channel will receive nil.
-		// this is a broadcast mechanism to signal at once to everything that the sink is closing.
-		closing: make(chan bool),
-		// make buffered channels to receive done messages from the workers
-		dpDone:        make(chan bool, numChannels*numDrainingThreads),
-		evDone:        make(chan bool, numChannels*numDrainingThreads),
-		spansDone:     make(chan bool, numChannels*numDrainingThreads),
-		lock:          sync.RWMutex{},
-		NewHTTPClient: newDefaultHTTPClient,
-		stats:         newAsyncMultiTokenSinkStats(buffer, numChannels, numDrainingThreads, batchSize),
-		maxRetry:      maxRetry,
+		lock:            sync.RWMutex{},
+		NewHTTPClient:   newDefaultHTTPClient,
+		maxRetry:        maxRetry,
+		datumTypes:      AllDatumTypes,
+		defaultDims:     pipelineDims(numChannels, numDrainingThreads, buffer, batchSize),
+	}
+	for _, opt := range opts {
+		opt(a)
 	}
 	if errorHandler != nil {
 		a.errorHandler = errorHandler
@@ -932,14 +870,101 @@ func NewAsyncMultiTokenSink(numChannels int64, numDrainingThreads int64, buffer
 	if httpClient != nil {
 		a.NewHTTPClient = httpClient
 	}
-	for i := int64(0); i < numChannels; i++ {
-		a.dpChannels[i] = newDPChannel(numDrainingThreads, buffer, batchSize, datapointEndpoint, userAgent, a.NewHTTPClient, a.errorHandler, a.stats, a.closing, a.dpDone, a.maxRetry)
-		a.evChannels[i] = newEVChannel(numDrainingThreads, buffer, batchSize, eventEndpoint, userAgent, a.NewHTTPClient, a.errorHandler, a.stats, a.closing, a.evDone, a.maxRetry)
-		a.spanChannels[i] = newSpanChannel(numDrainingThreads, buffer, batchSize, traceEndpoint, userAgent, a.NewHTTPClient, a.errorHandler, a.stats, a.closing, a.spansDone, a.maxRetry)
+	a.payloads = newPayloadStats(a.defaultDims, !a.disableDetailedStats, a.maxStatsTokens)
+	if a.datumTypes&DatapointDatum != 0 {
+		a.datapoints = newSinkPipeline(a, datapointSinkDatum, numChannels, numDrainingThreads, buffer, batchSize, datapointEndpoint, userAgent)
+		// hash tokens with the sink's Hasher so it can be replaced
+		a.datapoints.getChannel = a.getChannel
+	}
+	if a.datumTypes&EventDatum != 0 {
+		a.events = newSinkPipeline(a, eventSinkDatum, numChannels, numDrainingThreads, buffer, batchSize, eventEndpoint, userAgent)
+		a.events.getChannel = a.getChannel
+	}
+	if a.datumTypes&SpanDatum != 0 {
+		a.spans = newSinkPipeline(a, spanSinkDatum, numChannels, numDrainingThreads, buffer, batchSize, traceEndpoint, userAgent)
+		a.spans.getChannel = a.getChannel
 	}
-	atomic.StoreInt64(&a.stats.NumberOfDatapointWorkers, numChannels*numDrainingThreads)
-	atomic.StoreInt64(&a.stats.NumberOfEventWorkers, numChannels*numDrainingThreads)
-	atomic.StoreInt64(&a.stats.NumberOfSpanWorkers, numChannels*numDrainingThreads)
-
 	return a
 }
+
+// sinkDatum is how the sink emits one datum type with an HTTPSink.  Supporting another datum type takes
+// a sinkDatum for it and a Pipeline made with newSinkPipeline.
+type sinkDatum[T any] struct {
+	name string
+	// endpoint returns the field of an HTTPSink holding the datum type's endpoint
+	endpoint func(sink *HTTPSink) *string
+	// route returns the datum type's endpoint from a token's endpoints
+	route func(endpoints TokenEndpoints) string
+	// add emits data with sink
+	add func(sink *HTTPSink, ctx context.Context, data []T) error
+	// dropped puts data in a DroppedBatch
+	dropped func(batch *DroppedBatch, data []T)
+}
+
+var (
+	datapointSinkDatum = sinkDatum[*datapoint.Datapoint]{
+		name:     "datapoint",
+		endpoint: func(sink *HTTPSink) *string { return &sink.DatapointEndpoint },
+		route:    func(endpoints TokenEndpoints) string { return endpoints.DatapointEndpoint },
+		add:      (*HTTPSink).AddDatapoints,
+		dropped:  func(batch *DroppedBatch, data []*datapoint.Datapoint) { batch.Datapoints = data },
+	}
+	eventSinkDatum = sinkDatum[*event.Event]{
+		name:     "event",
+		endpoint: func(sink *HTTPSink) *string { return &sink.EventEndpoint },
+		route:    func(endpoints TokenEndpoints) string { return endpoints.EventEndpoint },
+		add:      (*HTTPSink).AddEvents,
+		dropped:  func(batch *DroppedBatch, data []*event.Event) { batch.Events = data },
+	}
+	spanSinkDatum = sinkDatum[*trace.Span]{
+		name:     "span",
+		endpoint: func(sink *HTTPSink) *string { return &sink.TraceEndpoint },
+		route:    func(endpoints TokenEndpoints) string { return endpoints.TraceEndpoint },
+		add:      (*HTTPSink).AddSpans,
+		dropped:  func(batch *DroppedBatch, data []*trace.Span) { batch.Spans = data },
+	}
+)
+
+// newSinkPipeline creates the pipeline of datum type d, configured by the sink's options.  Each worker emits
+// with its own HTTPSink, sending to endpoint unless the token of a batch has its own.
+func newSinkPipeline[T any](a *AsyncMultiTokenSink, d sinkDatum[T], numChannels int64, numDrainingThreads int64, buffer int, batchSize int, endpoint, userAgent string) *Pipeline[T] {
+	return NewPipeline(&PipelineConfig[T]{
+		Name:                 d.name,
+		NumChannels:          numChannels,
+		NumDrainingThreads:   numDrainingThreads,
+		Buffer:               buffer,
+		BatchSize:            batchSize,
+		MaxRetry:             a.maxRetry,
+		Retry:                a.retryPolicy,
+		MaxBufferDuration:    a.maxBufferDuration,
+		BlockOnFull:          a.blockOnFull,
+		OrderedDelivery:      a.orderedDelivery,
+		ErrorHandler:         a.errorHandler,
+		DisableDetailedStats: a.disableDetailedStats,
+		StatsSampleRate:      a.statsSampleRate,
+		MaxStatsTokens:       a.maxStatsTokens,
+		IdempotencyKeys:      a.idempotencyKeyHeader != "",
+		OnUnauthorized:       a.onUnauthorized(),
+		TokenValidator:       a.tokenValidator,
+		TokenObfuscator:      a.obfuscator,
+		PriorityBuffer:       a.priorityBuffer,
+		PropagateDeadline:    a.propagateDeadline,
+		OnDropped:            onDropped(a.droppedBatchHandler, d.dropped),
+		NewEmitter: func() EmitFunc[T] {
+			sink := a.newWorkerSink(userAgent)
+			sinkEndpoint := d.endpoint(sink)
+			if endpoint != "" {
+				*sinkEndpoint = endpoint
+			}
+			defaultEndpoint := *sinkEndpoint
+			sink.PayloadCallback = func(uncompressedBytes, sentBytes int) {
+				a.payloads.add(d.name, sink.AuthToken, uncompressedBytes, sentBytes)
+			}
+			return func(ctx context.Context, token Token, data []T) error {
+				sink.AuthToken, sink.AuthScheme = token.Value, token.Scheme
+				*sinkEndpoint = a.routeEndpoint(token.Value, defaultEndpoint, d.route)
+				return d.add(sink, ctx, data)
+			}
+		},
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"runtime"
 	"sync"
 	"sync/atomic"
@@ -71,6 +72,79 @@ func TestAsyncMultiTokenSinkClose(t *testing.T) {
 	})
 }
 
+func TestAsyncMultiTokenSinkDatumTypes(t *testing.T) {
+	Convey("An AsyncMultiTokenSink with only datapoints enabled", t, func() {
+		s := NewAsyncMultiTokenSink(int64(2), int64(2), 5, 25, "", "", "", "", newDefaultHTTPClient, nil, 0, WithDatumTypes(DatapointDatum))
+		s.ShutdownTimeout = time.Millisecond * 500
+		Reset(func() {
+			So(s.Close(), ShouldBeNil)
+		})
+
+		Convey("should only create the datapoint pipeline", func() {
+			So(s.datapoints, ShouldNotBeNil)
+			So(s.events, ShouldBeNil)
+			So(s.spans, ShouldBeNil)
+		})
+
+		Convey("should refuse events and spans", func() {
+			ctx := context.WithValue(context.Background(), TokenCtxKey, "HELLOOOOOO")
+			So(s.AddEvents(ctx, GoEventSource.Events()).Error(), ShouldContainSubstring, "unable to add events: datum type is disabled")
+			So(s.AddEventsWithToken("HELLOOOOOO", GoEventSource.Events()).Error(), ShouldContainSubstring, "unable to add events: datum type is disabled")
+			So(s.AddSpans(ctx, GoSpanSource.Spans()).Error(), ShouldContainSubstring, "unable to add spans: datum type is disabled")
+			So(s.AddSpansWithToken("HELLOOOOOO", GoSpanSource.Spans()).Error(), ShouldContainSubstring, "unable to add spans: datum type is disabled")
+		})
+
+		Convey("should only report datapoint stats", func() {
+			dps := s.Datapoints()
+			names := make(map[string]bool, len(dps))
+			for _, dp := range dps {
+				names[dp.Metric] = true
+			}
+			So(names["total_datapoints_buffered"], ShouldBeTrue)
+			So(names["total_events_buffered"], ShouldBeFalse)
+			So(names["total_spans_buffered"], ShouldBeFalse)
+			So(names["total_retries"], ShouldBeTrue)
+		})
+	})
+
+	Convey("An AsyncMultiTokenSink with events and spans enabled", t, func() {
+		s := NewAsyncMultiTokenSink(int64(1), int64(1), 5, 25, "", "", "", "", newDefaultHTTPClient, nil, 0, WithDatumTypes(EventDatum, SpanDatum))
+		s.ShutdownTimeout = time.Millisecond * 500
+		So(s.datapoints, ShouldBeNil)
+		So(s.events, ShouldNotBeNil)
+		So(s.spans, ShouldNotBeNil)
+		So(s.defaultDims["worker_count"], ShouldEqual, "1")
+		So(s.AddDatapointsWithToken("HELLOOOOOO", GoMetricsSource.Datapoints()).Error(), ShouldContainSubstring, "unable to add datapoints: datum type is disabled")
+		So(s.Close(), ShouldBeNil)
+	})
+}
+
+func TestAsyncMultiTokenSinkLightweightStats(t *testing.T) {
+	Convey("An AsyncMultiTokenSink with lightweight stats", t, func() {
+		s := NewAsyncMultiTokenSink(int64(2), int64(2), 5, 25, "", "", "", "", newDefaultHTTPClient, nil, 0, WithLightweightStats())
+		s.ShutdownTimeout = time.Millisecond * 500
+		So(s.datapoints.byToken, ShouldBeNil)
+		So(s.events.batchSizes, ShouldBeNil)
+		names := make(map[string]bool)
+		for _, dp := range s.Datapoints() {
+			names[dp.Metric] = true
+		}
+		So(names, ShouldResemble, map[string]bool{
+			"total_datapoints_buffered": true,
+			"total_events_buffered":     true,
+			"total_spans_buffered":      true,
+			"total_retries":             true,
+		})
+		So(s.Close(), ShouldBeNil)
+	})
+	Convey("An AsyncMultiTokenSink sampling its stats", t, func() {
+		s := NewAsyncMultiTokenSink(int64(1), int64(1), 5, 25, "", "", "", "", newDefaultHTTPClient, nil, 0, WithStatsSampleRate(10))
+		s.ShutdownTimeout = time.Millisecond * 500
+		So(s.spans.statsSampleRate, ShouldEqual, 10)
+		So(s.Close(), ShouldBeNil)
+	})
+}
+
 func AddDatapointsGetError(ctx context.Context, dps []*datapoint.Datapoint) (err error) {
 	err = &SFXAPIError{
 		StatusCode:   http.StatusRequestTimeout,
@@ -149,13 +223,13 @@ func TestWorkerErrorHandlerDps(t *testing.T) {
 		Convey("should handle errors while emitting datapoints", func() {
 			s := NewAsyncMultiTokenSink(int64(1), int64(1), 5, 7, "", "", "", "", newDefaultHTTPClient, nil, 0)
 			s.ShutdownTimeout = time.Second * 5
-			s.dpChannels[0].workers[0].handleError(fmt.Errorf("this is an error"), "HELLOOOOO", []*datapoint.Datapoint{Cumulative("metricname", nil, 64)}, AddDatapointsGetSuccess)
+			s.datapoints.channels[0].workers[0].handleError(context.Background(), fmt.Errorf("this is an error"), "HELLOOOOO", []*datapoint.Datapoint{Cumulative("metricname", nil, 64)}, AddDatapointsGetSuccess)
 			verifyDrop(s, 1)
 		})
 		Convey("should handle nil errors while emitting datapoints", func() {
 			s := NewAsyncMultiTokenSink(int64(1), int64(1), 5, 7, "", "", "", "", newDefaultHTTPClient, nil, 3)
 			s.ShutdownTimeout = time.Second * 5
-			s.dpChannels[0].workers[0].handleError(nil, "HELLOOOOO", []*datapoint.Datapoint{Cumulative("metricname", nil, 64)}, AddDatapointsGetSuccess)
+			s.datapoints.channels[0].workers[0].handleError(context.Background(), nil, "HELLOOOOO", []*datapoint.Datapoint{Cumulative("metricname", nil, 64)}, AddDatapointsGetSuccess)
 			verifyDrop(s, 0)
 		})
 		Convey("should handle errors and retry while emitting datapoints", func() {
@@ -165,7 +239,7 @@ func TestWorkerErrorHandlerDps(t *testing.T) {
 				StatusCode:   http.StatusRequestTimeout,
 				ResponseBody: "HELLO",
 			}
-			s.dpChannels[0].workers[0].handleError(err, "HELLOOOOO", []*datapoint.Datapoint{Cumulative("metricname", nil, 64)}, AddDatapointsGetError)
+			s.datapoints.channels[0].workers[0].handleError(context.Background(), err, "HELLOOOOO", []*datapoint.Datapoint{Cumulative("metricname", nil, 64)}, AddDatapointsGetError)
 			verifyDrop(s, 1)
 		})
 	})
@@ -191,13 +265,13 @@ func TestWorkerErrorHandlerEvents(t *testing.T) {
 		Convey("should handle errors while emitting events", func() {
 			s := NewAsyncMultiTokenSink(int64(1), int64(1), 5, 7, "", "", "", "", newDefaultHTTPClient, nil, 0)
 			s.ShutdownTimeout = time.Second * 5
-			s.evChannels[0].workers[0].handleError(fmt.Errorf("this is an error"), "HELLOOOOO", []*event.Event{event.New("TotalAlloc", event.COLLECTD, nil, time.Time{})}, AddEventsGetSuccess)
+			s.events.channels[0].workers[0].handleError(context.Background(), fmt.Errorf("this is an error"), "HELLOOOOO", []*event.Event{event.New("TotalAlloc", event.COLLECTD, nil, time.Time{})}, AddEventsGetSuccess)
 			verifyDrop(s, 1)
 		})
 		Convey("should handle nil errors while emitting events", func() {
 			s := NewAsyncMultiTokenSink(int64(1), int64(1), 5, 7, "", "", "", "", newDefaultHTTPClient, nil, 3)
 			s.ShutdownTimeout = time.Second * 5
-			s.evChannels[0].workers[0].handleError(nil, "HELLOOOOO", []*event.Event{event.New("TotalAlloc", event.COLLECTD, nil, time.Time{})}, AddEventsGetSuccess)
+			s.events.channels[0].workers[0].handleError(context.Background(), nil, "HELLOOOOO", []*event.Event{event.New("TotalAlloc", event.COLLECTD, nil, time.Time{})}, AddEventsGetSuccess)
 			verifyDrop(s, 0)
 		})
 		Convey("should handle errors and retry while emitting events", func() {
@@ -207,7 +281,7 @@ func TestWorkerErrorHandlerEvents(t *testing.T) {
 				StatusCode:   http.StatusRequestTimeout,
 				ResponseBody: "HELLO",
 			}
-			s.evChannels[0].workers[0].handleError(err, "HELLOOOOO", []*event.Event{event.New("TotalAlloc", event.COLLECTD, nil, time.Time{})}, AddEventsGetError)
+			s.events.channels[0].workers[0].handleError(context.Background(), err, "HELLOOOOO", []*event.Event{event.New("TotalAlloc", event.COLLECTD, nil, time.Time{})}, AddEventsGetError)
 			verifyDrop(s, 1)
 		})
 	})
@@ -233,13 +307,13 @@ func TestWorkerErrorHandlerSpans(t *testing.T) {
 		Convey("should handle errors while emitting traces", func() {
 			s := NewAsyncMultiTokenSink(int64(1), int64(1), 5, 7, "", "", "", "", newDefaultHTTPClient, nil, 0)
 			s.ShutdownTimeout = time.Second * 5
-			s.spanChannels[0].workers[0].handleError(fmt.Errorf("this is an error"), "HELLOOOOO", []*trace.Span{{}}, AddSpansGetSuccess)
+			s.spans.channels[0].workers[0].handleError(context.Background(), fmt.Errorf("this is an error"), "HELLOOOOO", []*trace.Span{{}}, AddSpansGetSuccess)
 			verifyDrop(s, 1)
 		})
 		Convey("should handle nil errors while emitting traces", func() {
 			s := NewAsyncMultiTokenSink(int64(1), int64(1), 5, 7, "", "", "", "", newDefaultHTTPClient, nil, 3)
 			s.ShutdownTimeout = time.Second * 5
-			s.spanChannels[0].workers[0].handleError(nil, "HELLOOOOO", []*trace.Span{{}}, AddSpansGetSuccess)
+			s.spans.channels[0].workers[0].handleError(context.Background(), nil, "HELLOOOOO", []*trace.Span{{}}, AddSpansGetSuccess)
 			verifyDrop(s, 0)
 		})
 		Convey("should handle errors and retry while emitting traces", func() {
@@ -249,7 +323,7 @@ func TestWorkerErrorHandlerSpans(t *testing.T) {
 				StatusCode:   http.StatusRequestTimeout,
 				ResponseBody: string("HELLO"),
 			}
-			s.spanChannels[0].workers[0].handleError(err, "HELLOOOOO", []*trace.Span{{}}, AddSpansGetError)
+			s.spans.channels[0].workers[0].handleError(context.Background(), err, "HELLOOOOO", []*trace.Span{{}}, AddSpansGetError)
 			verifyDrop(s, 1)
 		})
 	})
@@ -279,7 +353,7 @@ func TestAsyncMultiTokenSinkShutdownDroppedDatapoints(t *testing.T) {
 				}()
 				runtime.Gosched()
 			}
-			for atomic.LoadInt64(&s.dpBuffered) <= int64(iterations) {
+			for atomic.LoadInt64(&s.datapoints.added) <= int64(iterations) {
 				runtime.Gosched()
 			}
 			So(errors.Details(s.Close()), ShouldContainSubstring, "may have been dropped")
@@ -310,7 +384,7 @@ func TestAsyncMultiTokenSinkShutdownDroppedEvents(t *testing.T) {
 					}
 				}()
 			}
-			for atomic.LoadInt64(&s.evBuffered) <= int64(iterations) {
+			for atomic.LoadInt64(&s.events.added) <= int64(iterations) {
 				runtime.Gosched()
 			}
 			So(errors.Details(s.Close()), ShouldContainSubstring, "may have been dropped")
@@ -341,7 +415,7 @@ func TestAsyncMultiTokenSinkShutdownDroppedSpans(t *testing.T) {
 					}
 				}()
 			}
-			for atomic.LoadInt64(&s.spansBuffered) <= int64(iterations) {
+			for atomic.LoadInt64(&s.spans.added) <= int64(iterations) {
 				runtime.Gosched()
 			}
 			So(errors.Details(s.Close()), ShouldContainSubstring, "may have been dropped")
@@ -382,6 +456,87 @@ func TestAsyncTokenStatusCounter(t *testing.T) {
 	})
 }
 
+func countsByToken(dps []*datapoint.Datapoint) map[string]int64 {
+	counts := make(map[string]int64)
+	for _, dp := range dps {
+		counts[dp.Dimensions["token"]] += dp.Value.(datapoint.IntValue).Int()
+	}
+	return counts
+}
+
+func TestAsyncTokenStatusCounterOptions(t *testing.T) {
+	t.Parallel()
+	Convey("An AsyncTokenStatusCounter", t, func() {
+		Convey("should forget the least recently counted token past its max", func() {
+			s := NewAsyncTokenStatusCounter("testCounter", 100, 1, nil, WithMaxTokens(2))
+			s.Increment(&tokenStatus{status: http.StatusOK, token: "a", val: 1})
+			s.Increment(&tokenStatus{status: http.StatusOK, token: "b", val: 1})
+			s.Increment(&tokenStatus{status: http.StatusOK, token: "a", val: 1})
+			s.Increment(&tokenStatus{status: http.StatusOK, token: "c", val: 1})
+			counts := countsByToken(s.Datapoints())
+			for counts["c"] == 0 {
+				runtime.Gosched()
+				counts = countsByToken(s.Datapoints())
+			}
+			So(counts, ShouldResemble, map[string]int64{"a": 2, "c": 1})
+			close(s.stop)
+		})
+		Convey("should forget every count on Reset", func() {
+			s := NewAsyncTokenStatusCounter("testCounter", 100, 1, nil)
+			s.Increment(&tokenStatus{status: http.StatusOK, token: "a", val: 1})
+			s.Reset()
+			So(s.Datapoints(), ShouldBeEmpty)
+			s.Increment(&tokenStatus{status: http.StatusOK, token: "a", val: 3})
+			counts := countsByToken(s.Datapoints())
+			for len(counts) == 0 {
+				runtime.Gosched()
+				counts = countsByToken(s.Datapoints())
+			}
+			So(counts, ShouldResemble, map[string]int64{"a": 3})
+			close(s.stop)
+		})
+		Convey("should report deltas when asked to", func() {
+			s := NewAsyncTokenStatusCounter("testCounter", 100, 1, nil, WithDeltaReports())
+			s.Increment(&tokenStatus{status: http.StatusOK, token: "a", val: 2})
+			dps := s.Datapoints()
+			for len(dps) == 0 {
+				runtime.Gosched()
+				dps = s.Datapoints()
+			}
+			So(len(dps), ShouldEqual, 1)
+			So(dps[0].MetricType, ShouldEqual, datapoint.Count)
+			So(dps[0].Value.(datapoint.IntValue).Int(), ShouldEqual, 2)
+			So(s.Datapoints(), ShouldBeEmpty)
+			close(s.stop)
+		})
+		Convey("should snapshot and reset its counts in one step", func() {
+			s := NewAsyncTokenStatusCounter("testCounter", 100, 1, nil)
+			s.Increment(&tokenStatus{status: http.StatusOK, token: "a", val: 2})
+			for len(s.Datapoints()) == 0 {
+				runtime.Gosched()
+			}
+			dps := s.SnapshotAndReset()
+			So(len(dps), ShouldEqual, 1)
+			So(dps[0].MetricType, ShouldEqual, datapoint.Count)
+			So(dps[0].Value.(datapoint.IntValue).Int(), ShouldEqual, 2)
+			So(s.Datapoints(), ShouldBeEmpty)
+			close(s.stop)
+			So(s.SnapshotAndReset(), ShouldBeNil)
+		})
+		Convey("should give up on a snapshot the counting goroutine doesn't take", func() {
+			stuck := &AsyncTokenStatusCounter{stop: make(chan bool), requestDatapoints: make(chan snapshotRequest), snapshotTimeout: time.Millisecond * 10}
+			start := time.Now()
+			So(stuck.Datapoints(), ShouldBeNil)
+			So(time.Since(start), ShouldBeGreaterThanOrEqualTo, time.Millisecond*10)
+		})
+		Convey("should be capped by the sink that owns it", func() {
+			s := NewAsyncMultiTokenSink(1, 1, 5, 25, "", "", "", "", newDefaultHTTPClient, nil, 1, WithMaxStatsTokens(3))
+			So(s.datapoints.byToken.maxTokens, ShouldEqual, 3)
+			So(s.Close(), ShouldBeNil)
+		})
+	})
+}
+
 func TestAsyncMultiTokenSinkCleanCloseDatapointsEventsAndSpans(t *testing.T) {
 	t.Parallel()
 	Convey("An AsyncMultiTokenSink", t, func() {
@@ -411,13 +566,13 @@ func TestAsyncMultiTokenSinkCleanCloseDatapointsEventsAndSpans(t *testing.T) {
 				runtime.Gosched()
 			}
 			wg.Wait()
-			for atomic.LoadInt64(&s.dpBuffered) <= int64(iterations) {
+			for atomic.LoadInt64(&s.datapoints.added) <= int64(iterations) {
 				runtime.Gosched()
 			}
-			for atomic.LoadInt64(&s.evBuffered) <= int64(iterations) {
+			for atomic.LoadInt64(&s.events.added) <= int64(iterations) {
 				runtime.Gosched()
 			}
-			for atomic.LoadInt64(&s.spansBuffered) <= int64(iterations) {
+			for atomic.LoadInt64(&s.spans.added) <= int64(iterations) {
 				runtime.Gosched()
 			}
 			So(s.Close(), ShouldBeNil)
@@ -628,3 +783,91 @@ func BenchmarkAsyncMultiTokenSinkWithBufferAddSeveralEvents(b *testing.B) {
 		_ = sink.AddEvents(ctx, events)
 	}
 }
+
+func TestAsyncMultiTokenSinkTokenEndpoints(t *testing.T) {
+	Convey("An AsyncMultiTokenSink with token endpoints", t, func() {
+		var mu sync.Mutex
+		received := map[string][]string{}
+		newServer := func(name string) *httptest.Server {
+			return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				mu.Lock()
+				received[name] = append(received[name], req.URL.Path+" "+req.Header.Get(TokenHeaderName))
+				mu.Unlock()
+				_, _ = rw.Write([]byte(`"OK"`))
+			}))
+		}
+		shared, gateway := newServer("shared"), newServer("gateway")
+		defer shared.Close()
+		defer gateway.Close()
+		s := NewAsyncMultiTokenSink(1, 1, 5, 5000, shared.URL+"/dp", shared.URL+"/ev", shared.URL+"/tr", "", nil, nil, 0)
+		s.RegisterTokenEndpoint("onprem", gateway.URL+"/dp", gateway.URL+"/ev", "")
+		add := func(token string) {
+			So(s.AddDatapointsWithToken(token, []*datapoint.Datapoint{Gauge("m", nil, 1)}), ShouldBeNil)
+			So(s.AddEventsWithToken(token, []*event.Event{event.New("e", event.USERDEFINED, nil, time.Now())}), ShouldBeNil)
+			So(s.AddSpansWithToken(token, []*trace.Span{{TraceID: "1", ID: "1"}}), ShouldBeNil)
+		}
+		Convey("should send each token's data to its endpoints", func() {
+			add("cloud")
+			add("onprem")
+			So(s.Close(), ShouldBeNil)
+			mu.Lock()
+			defer mu.Unlock()
+			So(received["shared"], ShouldHaveLength, 4)
+			So(received["shared"], ShouldContain, "/tr onprem")
+			So(received["gateway"], ShouldHaveLength, 2)
+			So(received["gateway"], ShouldContain, "/dp onprem")
+			So(received["gateway"], ShouldContain, "/ev onprem")
+		})
+		Convey("should go back to the sink's endpoints once unregistered", func() {
+			s.UnregisterTokenEndpoint("onprem")
+			add("onprem")
+			So(s.Close(), ShouldBeNil)
+			mu.Lock()
+			defer mu.Unlock()
+			So(received["shared"], ShouldHaveLength, 3)
+			So(received["gateway"], ShouldBeEmpty)
+		})
+	})
+}
+
+func TestAsyncMultiTokenSinkDroppedBatchHandler(t *testing.T) {
+	Convey("An AsyncMultiTokenSink with a dropped batch handler", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			rw.WriteHeader(http.StatusBadRequest)
+		}))
+		defer server.Close()
+		var mu sync.Mutex
+		var dropped []*DroppedBatch
+		s := NewAsyncMultiTokenSink(1, 1, 5, 5000, server.URL, server.URL, server.URL, "", nil, func(error) error { return nil }, 0, WithDroppedBatchHandler(func(batch *DroppedBatch) {
+			mu.Lock()
+			dropped = append(dropped, batch)
+			mu.Unlock()
+		}))
+		dps := []*datapoint.Datapoint{Gauge("m", nil, 1)}
+		evs := []*event.Event{event.New("e", event.USERDEFINED, nil, time.Now())}
+		spans := []*trace.Span{{TraceID: "1", ID: "1"}}
+		So(s.AddDatapointsWithToken("abc", dps), ShouldBeNil)
+		So(s.AddEventsWithToken("abc", evs), ShouldBeNil)
+		So(s.AddSpansWithToken("abc", spans), ShouldBeNil)
+		So(s.Close(), ShouldBeNil)
+		mu.Lock()
+		defer mu.Unlock()
+		So(len(dropped), ShouldEqual, 3)
+		byType := map[string]*DroppedBatch{}
+		for _, b := range dropped {
+			So(b.Token, ShouldEqual, "abc")
+			So(b.Err, ShouldNotBeNil)
+			switch {
+			case b.Datapoints != nil:
+				byType["datapoints"] = b
+			case b.Events != nil:
+				byType["events"] = b
+			case b.Spans != nil:
+				byType["spans"] = b
+			}
+		}
+		So(byType["datapoints"].Datapoints, ShouldResemble, dps)
+		So(byType["events"].Events, ShouldResemble, evs)
+		So(byType["spans"].Spans, ShouldResemble, spans)
+	})
+}
@@ -0,0 +1,227 @@
+// Package otelexporter bridges the OpenTelemetry metric SDK to golib.  Exporter converts the metrics an
+// otel reader collects into datapoints and adds them to any sfxclient.Sink, so otel instrumented and golib
+// instrumented code can share one export path and token.
+package otelexporter
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/sfxclient"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// BucketDimension is the dimension histogram bucket datapoints carry their upper bound in
+const BucketDimension = "le"
+
+// Exporter is an otel metric Exporter that sends to a sfxclient.Sink
+type Exporter struct {
+	sink         sfxclient.Sink
+	token        *sfxclient.Token
+	defaultDims  map[string]string
+	resourceDims bool
+	shutdown     int32
+	timeNow      func() time.Time
+	exported     int64
+}
+
+var _ sdkmetric.Exporter = &Exporter{}
+
+// Option customizes an Exporter
+type Option func(*Exporter)
+
+// WithToken sends every export with token, rather than the sink's own or the one in the export context
+func WithToken(token sfxclient.Token) Option {
+	return func(e *Exporter) {
+		e.token = &token
+	}
+}
+
+// WithDefaultDimensions adds dims to every datapoint.  Attributes of the same name win.
+func WithDefaultDimensions(dims map[string]string) Option {
+	return func(e *Exporter) {
+		e.defaultDims = dims
+	}
+}
+
+// WithoutResourceDimensions stops the otel resource's attributes, like service.name, being added as
+// dimensions
+func WithoutResourceDimensions() Option {
+	return func(e *Exporter) {
+		e.resourceDims = false
+	}
+}
+
+// New creates an Exporter adding to sink.  Use it with an otel reader, like
+// sdkmetric.NewPeriodicReader(otelexporter.New(sink))
+func New(sink sfxclient.Sink, opts ...Option) *Exporter {
+	e := &Exporter{
+		sink:         sink,
+		resourceDims: true,
+		timeNow:      time.Now,
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+// Export converts metrics to datapoints and adds them to the sink
+func (e *Exporter) Export(ctx context.Context, metrics metricdata.ResourceMetrics) error {
+	if atomic.LoadInt32(&e.shutdown) != 0 {
+		return sdkmetric.ErrExporterShutdown
+	}
+	dps := e.Convert(metrics)
+	if len(dps) == 0 {
+		return nil
+	}
+	if e.token != nil {
+		ctx = sfxclient.ContextWithToken(ctx, *e.token)
+	}
+	if err := e.sink.AddDatapoints(ctx, dps); err != nil {
+		return err
+	}
+	atomic.AddInt64(&e.exported, int64(len(dps)))
+	return nil
+}
+
+// ForceFlush does nothing since Export adds datapoints to the sink directly
+func (e *Exporter) ForceFlush(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// Shutdown stops future exports
+func (e *Exporter) Shutdown(ctx context.Context) error {
+	atomic.StoreInt32(&e.shutdown, 1)
+	return ctx.Err()
+}
+
+// Datapoints returns stats about the exporter
+func (e *Exporter) Datapoints() []*datapoint.Datapoint {
+	return []*datapoint.Datapoint{
+		sfxclient.Cumulative("total_otel_datapoints_exported", nil, atomic.LoadInt64(&e.exported)),
+	}
+}
+
+// Convert converts metrics to datapoints.  Gauges become gauges, monotonic sums become counters and
+// other sums become gauges.  A histogram becomes <name>_count, <name>_sum, <name>_min, <name>_max and
+// one <name>_bucket per bucket, counting the values at or below its BucketDimension, like Prometheus.
+func (e *Exporter) Convert(metrics metricdata.ResourceMetrics) []*datapoint.Datapoint {
+	base := make(map[string]string, len(e.defaultDims))
+	for k, v := range e.defaultDims {
+		base[k] = v
+	}
+	if e.resourceDims && metrics.Resource != nil {
+		addAttributes(base, metrics.Resource.Set())
+	}
+	c := converter{base: base, now: e.timeNow()}
+	for _, scope := range metrics.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			switch data := m.Data.(type) {
+			case metricdata.Gauge[int64]:
+				convertPoints(&c, m.Name, datapoint.Gauge, data.DataPoints, intValue)
+			case metricdata.Gauge[float64]:
+				convertPoints(&c, m.Name, datapoint.Gauge, data.DataPoints, floatValue)
+			case metricdata.Sum[int64]:
+				convertPoints(&c, m.Name, sumType(data.IsMonotonic, data.Temporality), data.DataPoints, intValue)
+			case metricdata.Sum[float64]:
+				convertPoints(&c, m.Name, sumType(data.IsMonotonic, data.Temporality), data.DataPoints, floatValue)
+			case metricdata.Histogram:
+				c.histogram(m.Name, data)
+			}
+		}
+	}
+	return c.dps
+}
+
+type converter struct {
+	base map[string]string
+	now  time.Time
+	dps  []*datapoint.Datapoint
+}
+
+func (c *converter) add(metric string, dims map[string]string, value datapoint.Value, mt datapoint.MetricType, ts time.Time) {
+	if ts.IsZero() {
+		ts = c.now
+	}
+	c.dps = append(c.dps, datapoint.New(metric, dims, value, mt, ts))
+}
+
+// dims returns the base dimensions plus attrs
+func (c *converter) dims(attrs attribute.Set) map[string]string {
+	dims := make(map[string]string, len(c.base)+attrs.Len())
+	for k, v := range c.base {
+		dims[k] = v
+	}
+	addAttributes(dims, &attrs)
+	return dims
+}
+
+func (c *converter) histogram(name string, data metricdata.Histogram) {
+	mt := sumType(true, data.Temporality)
+	for _, p := range data.DataPoints {
+		dims := c.dims(p.Attributes)
+		c.add(name+"_count", dims, datapoint.NewIntValue(int64(p.Count)), mt, p.Time)
+		c.add(name+"_sum", dims, datapoint.NewFloatValue(p.Sum), mt, p.Time)
+		if p.Min != nil {
+			c.add(name+"_min", dims, datapoint.NewFloatValue(*p.Min), datapoint.Gauge, p.Time)
+		}
+		if p.Max != nil {
+			c.add(name+"_max", dims, datapoint.NewFloatValue(*p.Max), datapoint.Gauge, p.Time)
+		}
+		var total uint64
+		for i, count := range p.BucketCounts {
+			total += count
+			bound := "+Inf"
+			if i < len(p.Bounds) {
+				bound = strconv.FormatFloat(p.Bounds[i], 'g', -1, 64)
+			}
+			bucketDims := make(map[string]string, len(dims)+1)
+			for k, v := range dims {
+				bucketDims[k] = v
+			}
+			bucketDims[BucketDimension] = bound
+			c.add(name+"_bucket", bucketDims, datapoint.NewIntValue(int64(total)), mt, p.Time)
+		}
+	}
+}
+
+func convertPoints[N int64 | float64](c *converter, name string, mt datapoint.MetricType, points []metricdata.DataPoint[N], value func(N) datapoint.Value) {
+	for _, p := range points {
+		c.add(name, c.dims(p.Attributes), value(p.Value), mt, p.Time)
+	}
+}
+
+func intValue(v int64) datapoint.Value {
+	return datapoint.NewIntValue(v)
+}
+
+func floatValue(v float64) datapoint.Value {
+	return datapoint.NewFloatValue(v)
+}
+
+// sumType is the metric type for a sum: monotonic cumulative sums are counters, monotonic delta sums are
+// counts and anything that can go down is a gauge
+func sumType(monotonic bool, temporality metricdata.Temporality) datapoint.MetricType {
+	switch {
+	case !monotonic:
+		return datapoint.Gauge
+	case temporality == metricdata.DeltaTemporality:
+		return datapoint.Count
+	default:
+		return datapoint.Counter
+	}
+}
+
+func addAttributes(dims map[string]string, attrs *attribute.Set) {
+	iter := attrs.Iter()
+	for iter.Next() {
+		kv := iter.Attribute()
+		dims[string(kv.Key)] = kv.Value.Emit()
+	}
+}
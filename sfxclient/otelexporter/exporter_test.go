@@ -0,0 +1,156 @@
+package otelexporter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/sfxclient"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric/instrument"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+type captureSink struct {
+	dps   []*datapoint.Datapoint
+	token sfxclient.Token
+	err   error
+}
+
+func (c *captureSink) AddDatapoints(ctx context.Context, points []*datapoint.Datapoint) error {
+	c.token, _ = sfxclient.TokenFromContext(ctx)
+	c.dps = append(c.dps, points...)
+	return c.err
+}
+
+func (c *captureSink) find(metric string, dims map[string]string) *datapoint.Datapoint {
+	for _, dp := range c.dps {
+		if dp.Metric != metric {
+			continue
+		}
+		matches := true
+		for k, v := range dims {
+			if dp.Dimensions[k] != v {
+				matches = false
+			}
+		}
+		if matches {
+			return dp
+		}
+	}
+	return nil
+}
+
+func TestExporter(t *testing.T) {
+	Convey("an exporter fed by the otel SDK", t, func() {
+		ctx := context.Background()
+		sink := &captureSink{}
+		exporter := New(sink, WithDefaultDimensions(map[string]string{"env": "test", "host": "default"}))
+		reader := sdkmetric.NewManualReader()
+		provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader),
+			sdkmetric.WithResource(resource.NewSchemaless(attribute.String("service.name", "svc"))))
+		meter := provider.Meter("test")
+		attrs := []attribute.KeyValue{attribute.String("host", "a"), attribute.Int("shard", 2)}
+
+		counter, err := meter.SyncInt64().Counter("requests")
+		So(err, ShouldBeNil)
+		counter.Add(ctx, 3, attrs...)
+		upDown, err := meter.SyncInt64().UpDownCounter("inflight")
+		So(err, ShouldBeNil)
+		upDown.Add(ctx, -2, attrs...)
+		histogram, err := meter.SyncFloat64().Histogram("latency")
+		So(err, ShouldBeNil)
+		histogram.Record(ctx, 3, attrs...)
+		histogram.Record(ctx, 7, attrs...)
+		gauge, err := meter.AsyncFloat64().Gauge("temperature")
+		So(err, ShouldBeNil)
+		So(meter.RegisterCallback([]instrument.Asynchronous{gauge}, func(ctx context.Context) {
+			gauge.Observe(ctx, 1.5, attrs...)
+		}), ShouldBeNil)
+
+		metrics, err := reader.Collect(ctx)
+		So(err, ShouldBeNil)
+		Convey("should convert every kind of metric", func() {
+			So(exporter.Export(ctx, metrics), ShouldBeNil)
+			dims := map[string]string{"host": "a", "shard": "2", "env": "test", "service.name": "svc"}
+
+			dp := sink.find("requests", dims)
+			So(dp, ShouldNotBeNil)
+			So(dp.Value, ShouldResemble, datapoint.NewIntValue(3))
+			So(dp.MetricType, ShouldEqual, datapoint.Counter)
+			So(dp.Timestamp.IsZero(), ShouldBeFalse)
+
+			dp = sink.find("inflight", dims)
+			So(dp.Value, ShouldResemble, datapoint.NewIntValue(-2))
+			So(dp.MetricType, ShouldEqual, datapoint.Gauge)
+
+			dp = sink.find("temperature", dims)
+			So(dp.Value, ShouldResemble, datapoint.NewFloatValue(1.5))
+			So(dp.MetricType, ShouldEqual, datapoint.Gauge)
+
+			So(sink.find("latency_count", dims).Value, ShouldResemble, datapoint.NewIntValue(2))
+			So(sink.find("latency_sum", dims).Value, ShouldResemble, datapoint.NewFloatValue(10))
+			So(sink.find("latency_min", dims).Value, ShouldResemble, datapoint.NewFloatValue(3))
+			So(sink.find("latency_max", dims).Value, ShouldResemble, datapoint.NewFloatValue(7))
+			So(sink.find("latency_bucket", map[string]string{BucketDimension: "0"}).Value, ShouldResemble, datapoint.NewIntValue(0))
+			So(sink.find("latency_bucket", map[string]string{BucketDimension: "5"}).Value, ShouldResemble, datapoint.NewIntValue(1))
+			So(sink.find("latency_bucket", map[string]string{BucketDimension: "10"}).Value, ShouldResemble, datapoint.NewIntValue(2))
+			So(sink.find("latency_bucket", map[string]string{BucketDimension: "+Inf"}).Value, ShouldResemble, datapoint.NewIntValue(2))
+			So(sink.find("latency_bucket", map[string]string{BucketDimension: "+Inf"}).MetricType, ShouldEqual, datapoint.Counter)
+
+			So(exporter.Datapoints()[0].Value, ShouldResemble, datapoint.NewIntValue(int64(len(sink.dps))))
+		})
+		Convey("should skip resource dimensions if asked", func() {
+			WithoutResourceDimensions()(exporter)
+			So(exporter.Export(ctx, metrics), ShouldBeNil)
+			_, exists := sink.find("requests", nil).Dimensions["service.name"]
+			So(exists, ShouldBeFalse)
+		})
+		Convey("should send with its token", func() {
+			WithToken(sfxclient.Token{Value: "abc", Scheme: sfxclient.BearerTokenScheme})(exporter)
+			So(exporter.Export(ctx, metrics), ShouldBeNil)
+			So(sink.token, ShouldResemble, sfxclient.Token{Value: "abc", Scheme: sfxclient.BearerTokenScheme})
+		})
+		Convey("should return sink errors", func() {
+			sink.err = errors.New("nope")
+			So(exporter.Export(ctx, metrics), ShouldEqual, sink.err)
+			So(exporter.Datapoints()[0].Value, ShouldResemble, datapoint.NewIntValue(0))
+		})
+		Convey("should refuse to export after shutdown", func() {
+			So(exporter.ForceFlush(ctx), ShouldBeNil)
+			So(exporter.Shutdown(ctx), ShouldBeNil)
+			So(exporter.Export(ctx, metrics), ShouldEqual, sdkmetric.ErrExporterShutdown)
+		})
+		Reset(func() {
+			So(provider.Shutdown(ctx), ShouldBeNil)
+		})
+	})
+	Convey("an exporter given delta sums", t, func() {
+		sink := &captureSink{}
+		exporter := New(sink)
+		now := time.Unix(100, 0)
+		exporter.timeNow = func() time.Time { return now }
+		metrics := metricdata.ResourceMetrics{ScopeMetrics: []metricdata.ScopeMetrics{{Metrics: []metricdata.Metrics{
+			{Name: "delta", Data: metricdata.Sum[float64]{IsMonotonic: true, Temporality: metricdata.DeltaTemporality,
+				DataPoints: []metricdata.DataPoint[float64]{{Value: 2.5}}}},
+			{Name: "ints", Data: metricdata.Gauge[int64]{DataPoints: []metricdata.DataPoint[int64]{{Value: 4}}}},
+		}}}}
+		Convey("should send counts, timestamped now if the points have no time", func() {
+			So(exporter.Export(context.Background(), metrics), ShouldBeNil)
+			So(len(sink.dps), ShouldEqual, 2)
+			So(sink.dps[0].MetricType, ShouldEqual, datapoint.Count)
+			So(sink.dps[0].Value, ShouldResemble, datapoint.NewFloatValue(2.5))
+			So(sink.dps[0].Timestamp, ShouldEqual, now)
+			So(sink.dps[1].Value, ShouldResemble, datapoint.NewIntValue(4))
+		})
+		Convey("should not call the sink with nothing to send", func() {
+			So(exporter.Export(context.Background(), metricdata.ResourceMetrics{}), ShouldBeNil)
+			So(sink.dps, ShouldBeNil)
+		})
+	})
+}
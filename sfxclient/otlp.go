@@ -0,0 +1,553 @@
+package sfxclient
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/errors"
+	"github.com/signalfx/golib/v3/event"
+	"github.com/signalfx/golib/v3/sfxclient/spanfilter"
+	"github.com/signalfx/golib/v3/trace"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// ExportFormat is the wire format HTTPSink sends datapoints and spans in
+type ExportFormat int
+
+const (
+	// SignalFxFormat sends datapoints as SignalFx protobuf, and spans as Zipkin JSON or SAPM
+	SignalFxFormat ExportFormat = iota
+	// OTLPFormat sends datapoints as OTLP metrics and spans as OTLP traces, over HTTP/protobuf.  OTLP has
+	// no events, so events are still sent to the EventEndpoint as SignalFx protobuf.
+	OTLPFormat
+)
+
+// DefaultOTLPEndpoint is the OTLP/HTTP endpoint of an OpenTelemetry collector running next to the program
+const DefaultOTLPEndpoint = "http://localhost:4318"
+
+const contentTypeHeaderProtobuf = "application/x-protobuf"
+
+// The OTLP enum values sfxclient sends
+const (
+	otlpTemporalityDelta      = 1
+	otlpTemporalityCumulative = 2
+	otlpSpanKindInternal      = 1
+	otlpStatusCodeError       = 2
+)
+
+var otlpSpanKinds = map[string]uint64{
+	"SERVER":   2,
+	"CLIENT":   3,
+	"PRODUCER": 4,
+	"CONSUMER": 5,
+}
+
+// otlpMessage appends the field num holding the encoded message msg to b
+func otlpMessage(b []byte, num protowire.Number, msg []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, msg)
+}
+
+// otlpString appends the field num holding s to b, unless s is empty
+func otlpString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+// otlpVarint appends the field num holding v to b, unless v is zero
+func otlpVarint(b []byte, num protowire.Number, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+// otlpFixed64 appends the field num holding v to b
+func otlpFixed64(b []byte, num protowire.Number, v uint64) []byte {
+	b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, v)
+}
+
+// otlpEncoder encodes datapoints, spans and events as OTLP export requests, for HTTPSink and GRPCSink
+type otlpEncoder struct {
+	// deterministic orders attributes by key
+	deterministic bool
+}
+
+// attributes appends attrs to b as KeyValues with string values in the field num, in key order if the
+// encoder is deterministic
+func (e otlpEncoder) attributes(b []byte, num protowire.Number, attrs map[string]string) []byte {
+	appendAttr := func(key string, value string) {
+		// the value is always written, since an empty AnyValue has no value at all
+		anyValue := protowire.AppendTag(nil, 1, protowire.BytesType)
+		anyValue = protowire.AppendString(anyValue, value)
+		kv := otlpString(nil, 1, key)
+		b = otlpMessage(b, num, otlpMessage(kv, 2, anyValue))
+	}
+	if e.deterministic {
+		datapoint.RangeSorted(attrs, appendAttr)
+		return b
+	}
+	for k, v := range attrs {
+		appendAttr(k, v)
+	}
+	return b
+}
+
+// otlpScope is the InstrumentationScope of everything the sink sends
+func otlpScope() []byte {
+	return otlpString(otlpString(nil, 1, "golib-sfxclient"), 2, ClientVersion)
+}
+
+// otlpStartTime is the start_time_unix_nano of cumulative sums, which count from when the program started
+var otlpStartTime = time.Now()
+
+// metrics encodes points as an OTLP ExportMetricsServiceRequest, returning how many points it encoded.
+// Datapoints with string values, which OTLP has no metric for, are left out.
+func (e otlpEncoder) metrics(points []*datapoint.Datapoint) ([]byte, int) {
+	now := time.Now()
+	encoded := 0
+	scopeMetrics := otlpMessage(nil, 1, otlpScope())
+	for _, dp := range points {
+		if metric := e.metric(dp, now); metric != nil {
+			scopeMetrics = otlpMessage(scopeMetrics, 2, metric)
+			encoded++
+		}
+	}
+	resourceMetrics := otlpMessage(nil, 2, scopeMetrics)
+	return otlpMessage(nil, 1, resourceMetrics), encoded
+}
+
+// otlpEncodable returns the points OTLP can represent, leaving out datapoints with string values
+func otlpEncodable(points []*datapoint.Datapoint) []*datapoint.Datapoint {
+	for i, dp := range points {
+		if !otlpNumeric(dp) {
+			encodable := append(make([]*datapoint.Datapoint, 0, len(points)-1), points[:i]...)
+			for _, dp := range points[i+1:] {
+				if otlpNumeric(dp) {
+					encodable = append(encodable, dp)
+				}
+			}
+			return encodable
+		}
+	}
+	return points
+}
+
+func otlpNumeric(dp *datapoint.Datapoint) bool {
+	switch dp.Value.(type) {
+	case datapoint.IntValue, datapoint.FloatValue, datapoint.HistogramValue:
+		return true
+	}
+	return false
+}
+
+// metric encodes dp as an OTLP Metric with a single data point, timestamped now if dp has no timestamp.
+// It returns nil for datapoints OTLP can't represent.
+func (e otlpEncoder) metric(dp *datapoint.Datapoint, now time.Time) []byte {
+	ts := dp.Timestamp
+	if ts.IsZero() {
+		ts = now
+	}
+	if hv, ok := dp.Value.(datapoint.HistogramValue); ok {
+		return e.histogram(dp, hv, ts)
+	}
+	numberDataPoint := e.attributes(nil, 7, dp.Dimensions)
+	numberDataPoint = otlpFixed64(numberDataPoint, 3, uint64(ts.UnixNano()))
+	switch v := dp.Value.(type) {
+	case datapoint.IntValue:
+		numberDataPoint = protowire.AppendTag(numberDataPoint, 6, protowire.Fixed64Type)
+		numberDataPoint = protowire.AppendFixed64(numberDataPoint, uint64(v.Int()))
+	case datapoint.FloatValue:
+		numberDataPoint = otlpFixed64(numberDataPoint, 4, math.Float64bits(v.Float()))
+	default:
+		return nil
+	}
+	numberDataPoint = otlpExemplars(numberDataPoint, 5, dp, ts)
+	data := otlpMessage(nil, 1, numberDataPoint)
+	metric := otlpString(nil, 1, dp.Metric)
+	switch dp.MetricType {
+	case datapoint.Counter:
+		numberDataPoint = otlpFixed64(numberDataPoint, 2, otlpStart(ts))
+		data = otlpMessage(nil, 1, numberDataPoint)
+		data = otlpVarint(otlpVarint(data, 2, otlpTemporalityCumulative), 3, 1)
+		return otlpMessage(metric, 7, data)
+	case datapoint.Count:
+		data = otlpVarint(otlpVarint(data, 2, otlpTemporalityDelta), 3, 1)
+		return otlpMessage(metric, 7, data)
+	}
+	return otlpMessage(metric, 5, data)
+}
+
+// otlpStart returns the start_time_unix_nano of a cumulative point at ts
+func otlpStart(ts time.Time) uint64 {
+	start := otlpStartTime
+	if ts.Before(start) {
+		start = ts
+	}
+	return uint64(start.UnixNano())
+}
+
+// otlpExemplars appends the exemplars attached to dp to b in the field num, timestamping those without a
+// timestamp ts.  Exemplars with invalid trace or span IDs are left out.
+func otlpExemplars(b []byte, num protowire.Number, dp *datapoint.Datapoint, ts time.Time) []byte {
+	for _, ex := range Exemplars(dp) {
+		traceID, validTrace := otlpID(ex.TraceID, 16)
+		spanID, validSpan := otlpID(ex.SpanID, 8)
+		if !validTrace || !validSpan {
+			continue
+		}
+		exTime := ex.Timestamp
+		if exTime.IsZero() {
+			exTime = ts
+		}
+		exemplar := otlpFixed64(nil, 2, uint64(exTime.UnixNano()))
+		exemplar = otlpFixed64(exemplar, 3, math.Float64bits(ex.Value))
+		exemplar = otlpMessage(exemplar, 4, spanID)
+		exemplar = otlpMessage(exemplar, 5, traceID)
+		b = otlpMessage(b, num, exemplar)
+	}
+	return b
+}
+
+// histogram encodes dp, with the value hv, as an OTLP Metric with a single HistogramDataPoint.  Cumulative
+// counters are cumulative histograms and everything else a delta.
+func (e otlpEncoder) histogram(dp *datapoint.Datapoint, hv datapoint.HistogramValue, ts time.Time) []byte {
+	point := e.attributes(nil, 9, dp.Dimensions)
+	temporality := uint64(otlpTemporalityDelta)
+	if dp.MetricType == datapoint.Counter {
+		point = otlpFixed64(point, 2, otlpStart(ts))
+		temporality = otlpTemporalityCumulative
+	}
+	point = otlpFixed64(point, 3, uint64(ts.UnixNano()))
+	point = otlpFixed64(point, 4, hv.Count())
+	point = otlpFixed64(point, 5, math.Float64bits(hv.Sum()))
+	counts := make([]byte, 0, 8*len(hv.Counts()))
+	for _, c := range hv.Counts() {
+		counts = protowire.AppendFixed64(counts, c)
+	}
+	point = otlpMessage(point, 6, counts)
+	if len(hv.Bounds()) > 0 {
+		bounds := make([]byte, 0, 8*len(hv.Bounds()))
+		for _, b := range hv.Bounds() {
+			bounds = protowire.AppendFixed64(bounds, math.Float64bits(b))
+		}
+		point = otlpMessage(point, 7, bounds)
+	}
+	point = otlpExemplars(point, 8, dp, ts)
+	data := otlpVarint(otlpMessage(nil, 1, point), 2, temporality)
+	return otlpMessage(otlpString(nil, 1, dp.Metric), 9, data)
+}
+
+// The attributes SignalFx events are sent as OTLP logs with, matching the OpenTelemetry collector's
+// signalfx receiver
+const (
+	otlpEventTypeKey       = "com.splunk.signalfx.event_type"
+	otlpEventCategoryKey   = "com.splunk.signalfx.event_category"
+	otlpEventPropertiesKey = "com.splunk.signalfx.event_properties"
+)
+
+// logs encodes events as an OTLP ExportLogsServiceRequest, with a log record per event timestamped now if
+// the event has no timestamp
+func (e otlpEncoder) logs(events []*event.Event) []byte {
+	now := time.Now()
+	scopeLogs := otlpMessage(nil, 1, otlpScope())
+	for _, ev := range events {
+		scopeLogs = otlpMessage(scopeLogs, 2, e.logRecord(ev, now))
+	}
+	resourceLogs := otlpMessage(nil, 2, scopeLogs)
+	return otlpMessage(nil, 1, resourceLogs)
+}
+
+// logRecord encodes ev as an OTLP LogRecord, with its dimensions, type, category and properties as attributes
+func (e otlpEncoder) logRecord(ev *event.Event, now time.Time) []byte {
+	ts := ev.Timestamp
+	if ts.IsZero() {
+		ts = now
+	}
+	record := otlpFixed64(nil, 1, uint64(ts.UnixNano()))
+	record = otlpFixed64(record, 11, uint64(now.UnixNano()))
+	record = e.attributes(record, 6, ev.Dimensions)
+	record = otlpKeyValue(record, 6, otlpEventTypeKey, otlpAnyValue(ev.EventType))
+	record = otlpKeyValue(record, 6, otlpEventCategoryKey, otlpAnyValue(int64(ev.Category)))
+	if len(ev.Properties) > 0 {
+		var properties []byte
+		appendProperty := func(k string, v interface{}) {
+			properties = otlpKeyValue(properties, 1, k, otlpAnyValue(v))
+		}
+		if e.deterministic {
+			keys := make([]string, 0, len(ev.Properties))
+			for k := range ev.Properties {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				appendProperty(k, ev.Properties[k])
+			}
+		} else {
+			for k, v := range ev.Properties {
+				appendProperty(k, v)
+			}
+		}
+		record = otlpKeyValue(record, 6, otlpEventPropertiesKey, otlpMessage(nil, 6, properties))
+	}
+	return record
+}
+
+// otlpKeyValue appends the field num holding a KeyValue of key and the encoded AnyValue value to b
+func otlpKeyValue(b []byte, num protowire.Number, key string, value []byte) []byte {
+	return otlpMessage(b, num, otlpMessage(otlpString(nil, 1, key), 2, value))
+}
+
+// otlpAnyValue encodes v as an AnyValue.  Values that aren't strings, bools or numbers are sent as strings.
+func otlpAnyValue(v interface{}) []byte {
+	switch t := v.(type) {
+	case string:
+		b := protowire.AppendTag(nil, 1, protowire.BytesType)
+		return protowire.AppendString(b, t)
+	case bool:
+		b := protowire.AppendTag(nil, 2, protowire.VarintType)
+		return protowire.AppendVarint(b, protowire.EncodeBool(t))
+	case int:
+		return otlpIntValue(int64(t))
+	case int32:
+		return otlpIntValue(int64(t))
+	case int64:
+		return otlpIntValue(t)
+	case uint32:
+		return otlpIntValue(int64(t))
+	case float32:
+		return otlpFixed64(nil, 4, math.Float64bits(float64(t)))
+	case float64:
+		return otlpFixed64(nil, 4, math.Float64bits(t))
+	}
+	return otlpAnyValue(fmt.Sprint(v))
+}
+
+// otlpIntValue encodes v as an AnyValue holding an int
+func otlpIntValue(v int64) []byte {
+	b := protowire.AppendTag(nil, 3, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(v))
+}
+
+// otlpID decodes the hex ID of a trace or span to size bytes, left padding IDs that are half as long
+func otlpID(id string, size int) ([]byte, bool) {
+	b, err := hex.DecodeString(id)
+	if err != nil {
+		return nil, false
+	}
+	switch len(b) {
+	case size:
+		return b, true
+	case size / 2:
+		return append(make([]byte, size/2, size), b...), true
+	}
+	return nil, false
+}
+
+// traces encodes spans as an OTLP ExportTraceServiceRequest, with a resource per service.  Spans with
+// invalid IDs make it return a *spanfilter.Map.
+func (e otlpEncoder) traces(spans []*trace.Span) ([]byte, error) {
+	var services []string
+	scopeSpans := make(map[string][]byte)
+	invalid := &spanfilter.Map{}
+	for _, s := range spans {
+		span, reason := e.span(s)
+		if reason != "" {
+			invalid.Add(reason, s.ID)
+			continue
+		}
+		var service string
+		if s.LocalEndpoint != nil && s.LocalEndpoint.ServiceName != nil {
+			service = *s.LocalEndpoint.ServiceName
+		}
+		if _, exists := scopeSpans[service]; !exists {
+			services = append(services, service)
+			scopeSpans[service] = otlpMessage(nil, 1, otlpScope())
+		}
+		scopeSpans[service] = otlpMessage(scopeSpans[service], 2, span)
+		invalid.AddValid(1)
+	}
+	if invalid.CheckInvalid() {
+		return nil, invalid
+	}
+	var request []byte
+	for _, service := range services {
+		resource := e.attributes(nil, 1, map[string]string{"service.name": service})
+		resourceSpans := otlpMessage(nil, 1, resource)
+		resourceSpans = otlpMessage(resourceSpans, 2, scopeSpans[service])
+		request = otlpMessage(request, 1, resourceSpans)
+	}
+	return request, nil
+}
+
+// span encodes s as an OTLP Span, or returns the spanfilter reason it is invalid
+func (e otlpEncoder) span(s *trace.Span) ([]byte, string) {
+	traceID, ok := otlpID(s.TraceID, 16)
+	if !ok {
+		return nil, spanfilter.InvalidTraceID
+	}
+	spanID, ok := otlpID(s.ID, 8)
+	if !ok {
+		return nil, spanfilter.InvalidSpanID
+	}
+	span := otlpMessage(nil, 1, traceID)
+	span = otlpMessage(span, 2, spanID)
+	if s.ParentID != nil && *s.ParentID != "" {
+		parentID, ok := otlpID(*s.ParentID, 8)
+		if !ok {
+			return nil, spanfilter.InvalidSpanID
+		}
+		span = otlpMessage(span, 4, parentID)
+	}
+	if s.Name != nil {
+		span = otlpString(span, 5, *s.Name)
+	}
+	kind := uint64(otlpSpanKindInternal)
+	if s.Kind != nil {
+		if k, exists := otlpSpanKinds[strings.ToUpper(*s.Kind)]; exists {
+			kind = k
+		}
+	}
+	span = otlpVarint(span, 6, kind)
+	var start, duration int64
+	if s.Timestamp != nil {
+		start = *s.Timestamp * int64(time.Microsecond)
+	}
+	if s.Duration != nil {
+		duration = *s.Duration * int64(time.Microsecond)
+	}
+	span = otlpFixed64(span, 7, uint64(start))
+	span = otlpFixed64(span, 8, uint64(start+duration))
+	span = e.attributes(span, 9, otlpSpanAttributes(s))
+	for _, a := range s.Annotations {
+		var event []byte
+		if a.Timestamp != nil {
+			event = otlpFixed64(event, 1, uint64(*a.Timestamp*int64(time.Microsecond)))
+		}
+		if a.Value != nil {
+			event = otlpString(event, 2, *a.Value)
+		}
+		span = otlpMessage(span, 11, event)
+	}
+	if msg, exists := s.Tags["error"]; exists && msg != "false" {
+		if msg == "true" {
+			// Zipkin error tags are often just a flag, which makes a useless status message
+			msg = ""
+		}
+		status := otlpString(nil, 2, msg)
+		span = otlpMessage(span, 15, otlpVarint(status, 3, otlpStatusCodeError))
+	}
+	return span, ""
+}
+
+// otlpSpanAttributes returns the tags of s, with the network details of its endpoints added as the
+// OpenTelemetry semantic convention attributes for them
+func otlpSpanAttributes(s *trace.Span) map[string]string {
+	endpointAttributes := func(attrs map[string]string, ep *trace.Endpoint, prefix string) map[string]string {
+		if ep == nil {
+			return attrs
+		}
+		add := func(key string, value string) {
+			if attrs == nil {
+				attrs = make(map[string]string, len(s.Tags)+4)
+				for k, v := range s.Tags {
+					attrs[k] = v
+				}
+			}
+			attrs[key] = value
+		}
+		if prefix == "net.peer" && ep.ServiceName != nil {
+			add("peer.service", *ep.ServiceName)
+		}
+		if ep.Ipv4 != nil {
+			add(prefix+".ip", *ep.Ipv4)
+		} else if ep.Ipv6 != nil {
+			add(prefix+".ip", *ep.Ipv6)
+		}
+		if ep.Port != nil {
+			add(prefix+".port", strconv.Itoa(int(*ep.Port)))
+		}
+		return attrs
+	}
+	attrs := endpointAttributes(nil, s.LocalEndpoint, "net.host")
+	attrs = endpointAttributes(attrs, s.RemoteEndpoint, "net.peer")
+	if attrs == nil {
+		return s.Tags
+	}
+	return attrs
+}
+
+// MarshalOTLPTraces encodes spans as an OTLP ExportTraceServiceRequest, the body OpenTelemetry collectors
+// take at /v1/traces, for programs that send spans to a collector some other way than HTTPSink or GRPCSink.
+// Zipkin kinds become OTLP span kinds, annotations span events, tags and endpoints attributes, and error
+// tags an error status.  Spans with invalid IDs make it return a *spanfilter.Map.
+func MarshalOTLPTraces(spans []*trace.Span) ([]byte, error) {
+	return otlpEncoder{}.traces(spans)
+}
+
+// otlpResponseValidator checks the partial_success of an OTLP export response, which is the first field of
+// metric and trace responses alike
+func otlpResponseValidator(respBody []byte) error {
+	partialSuccess, ok := otlpField(respBody, 1, protowire.BytesType)
+	if !ok {
+		return nil
+	}
+	rejected, ok := otlpField(partialSuccess, 1, protowire.VarintType)
+	if !ok {
+		return nil
+	}
+	if count, _ := protowire.ConsumeVarint(rejected); count > 0 {
+		message, _ := otlpField(partialSuccess, 2, protowire.BytesType)
+		return errors.Errorf("%d were rejected: %s", count, message)
+	}
+	return nil
+}
+
+// otlpField returns the last field num of wire type typ in msg.  Varints are returned still encoded.
+func otlpField(msg []byte, num protowire.Number, typ protowire.Type) ([]byte, bool) {
+	var found []byte
+	var ok bool
+	for len(msg) > 0 {
+		n, t, tagLen := protowire.ConsumeTag(msg)
+		if tagLen < 0 {
+			return nil, false
+		}
+		msg = msg[tagLen:]
+		valueLen := protowire.ConsumeFieldValue(n, t, msg)
+		if valueLen < 0 {
+			return nil, false
+		}
+		if n == num && t == typ {
+			ok = true
+			found = msg[:valueLen]
+			if t == protowire.BytesType {
+				found, _ = protowire.ConsumeBytes(found)
+			}
+		}
+		msg = msg[valueLen:]
+	}
+	return found, ok
+}
+
+// otlp is the encoder HTTPSink sends OTLP with
+func (h *HTTPSink) otlp() otlpEncoder {
+	return otlpEncoder{deterministic: h.Deterministic}
+}
+
+// OTLPDroppedDatapoints is how many datapoints the OTLP format has left out because OTLP can't represent
+// them, like datapoints with string values
+func (h *HTTPSink) OTLPDroppedDatapoints() int64 {
+	return atomic.LoadInt64(&h.stats.otlpDroppedDatapoints)
+}
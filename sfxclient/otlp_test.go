@@ -0,0 +1,276 @@
+package sfxclient
+
+import (
+	"context"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/pointer"
+	"github.com/signalfx/golib/v3/sfxclient/spanfilter"
+	"github.com/signalfx/golib/v3/trace"
+	. "github.com/smartystreets/goconvey/convey"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// otlpDecoded is a protobuf message decoded with protowire, by field number
+type otlpDecoded struct {
+	messages map[protowire.Number][][]byte
+	numbers  map[protowire.Number][]uint64
+}
+
+func decodeOTLP(msg []byte) otlpDecoded {
+	d := otlpDecoded{messages: map[protowire.Number][][]byte{}, numbers: map[protowire.Number][]uint64{}}
+	for len(msg) > 0 {
+		num, typ, n := protowire.ConsumeTag(msg)
+		So(n, ShouldBeGreaterThan, 0)
+		msg = msg[n:]
+		switch typ {
+		case protowire.BytesType:
+			v, n := protowire.ConsumeBytes(msg)
+			So(n, ShouldBeGreaterThan, 0)
+			d.messages[num] = append(d.messages[num], v)
+			msg = msg[n:]
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(msg)
+			So(n, ShouldBeGreaterThan, 0)
+			d.numbers[num] = append(d.numbers[num], v)
+			msg = msg[n:]
+		case protowire.Fixed64Type:
+			v, n := protowire.ConsumeFixed64(msg)
+			So(n, ShouldBeGreaterThan, 0)
+			d.numbers[num] = append(d.numbers[num], v)
+			msg = msg[n:]
+		default:
+			So(typ, ShouldBeIn, protowire.BytesType, protowire.VarintType, protowire.Fixed64Type)
+			return d
+		}
+	}
+	return d
+}
+
+func (d otlpDecoded) message(num protowire.Number) otlpDecoded {
+	So(len(d.messages[num]), ShouldEqual, 1)
+	return decodeOTLP(d.messages[num][0])
+}
+
+func (d otlpDecoded) all(num protowire.Number) []otlpDecoded {
+	ret := make([]otlpDecoded, 0, len(d.messages[num]))
+	for _, m := range d.messages[num] {
+		ret = append(ret, decodeOTLP(m))
+	}
+	return ret
+}
+
+func (d otlpDecoded) string(num protowire.Number) string {
+	if len(d.messages[num]) == 0 {
+		return ""
+	}
+	return string(d.messages[num][0])
+}
+
+// attributes decodes the string KeyValues in the field num
+func (d otlpDecoded) attributes(num protowire.Number) map[string]string {
+	attrs := make(map[string]string)
+	for _, kv := range d.all(num) {
+		attrs[kv.string(1)] = kv.message(2).string(1)
+	}
+	return attrs
+}
+
+func TestOTLPMetrics(t *testing.T) {
+	Convey("An OTLP HTTPSink", t, func() {
+		sink := NewHTTPSink(WithOTLPExporter(DefaultOTLPEndpoint + "/"))
+		So(sink.DatapointEndpoint, ShouldEqual, "http://localhost:4318/v1/metrics")
+		So(sink.TraceEndpoint, ShouldEqual, "http://localhost:4318/v1/traces")
+		ts := time.Unix(1600000000, 0)
+		metrics := func(points ...*datapoint.Datapoint) []otlpDecoded {
+			b, encoded := sink.otlp().metrics(points)
+			request := decodeOTLP(b)
+			scopeMetrics := request.message(1).message(2)
+			So(scopeMetrics.message(1).string(1), ShouldEqual, "golib-sfxclient")
+			all := scopeMetrics.all(2)
+			So(len(all), ShouldEqual, encoded)
+			return all
+		}
+		Convey("should encode gauges", func() {
+			m := metrics(datapoint.New("g", map[string]string{"host": "a"}, datapoint.NewFloatValue(1.5), datapoint.Gauge, ts))
+			So(len(m), ShouldEqual, 1)
+			So(m[0].string(1), ShouldEqual, "g")
+			dp := m[0].message(5).message(1)
+			So(math.Float64frombits(dp.numbers[4][0]), ShouldEqual, 1.5)
+			So(dp.numbers[3][0], ShouldEqual, uint64(ts.UnixNano()))
+			So(dp.attributes(7), ShouldResemble, map[string]string{"host": "a"})
+		})
+		Convey("should encode counters as monotonic sums", func() {
+			m := metrics(
+				datapoint.New("cumulative", nil, datapoint.NewIntValue(-3), datapoint.Counter, ts),
+				datapoint.New("delta", nil, datapoint.NewIntValue(4), datapoint.Count, ts),
+			)
+			So(len(m), ShouldEqual, 2)
+			cumulative := m[0].message(7)
+			So(cumulative.numbers[2][0], ShouldEqual, otlpTemporalityCumulative)
+			So(cumulative.numbers[3][0], ShouldEqual, 1)
+			dp := cumulative.message(1)
+			So(int64(dp.numbers[6][0]), ShouldEqual, -3)
+			So(dp.numbers[2][0], ShouldEqual, uint64(ts.UnixNano()))
+			delta := m[1].message(7)
+			So(delta.numbers[2][0], ShouldEqual, otlpTemporalityDelta)
+			So(delta.message(1).numbers[6][0], ShouldEqual, 4)
+		})
+		Convey("should start cumulative sums when the program started", func() {
+			m := metrics(datapoint.New("cumulative", nil, datapoint.NewIntValue(0), datapoint.Counter, time.Time{}))
+			dp := m[0].message(7).message(1)
+			So(dp.numbers[2][0], ShouldEqual, uint64(otlpStartTime.UnixNano()))
+			So(dp.numbers[3][0], ShouldBeGreaterThanOrEqualTo, dp.numbers[2][0])
+			So(int64(dp.numbers[6][0]), ShouldEqual, 0)
+		})
+		Convey("should encode exemplars with valid IDs", func() {
+			dp := datapoint.New("g", nil, datapoint.NewFloatValue(1.5), datapoint.Gauge, ts)
+			AddExemplars(dp,
+				Exemplar{TraceID: "fa281a8955571a3a", SpanID: "acdfec5be6328c3a", Value: 1.4},
+				Exemplar{TraceID: "bad", SpanID: "acdfec5be6328c3a", Value: 2},
+			)
+			exemplars := metrics(dp)[0].message(5).message(1).all(5)
+			So(len(exemplars), ShouldEqual, 1)
+			So(exemplars[0].numbers[2][0], ShouldEqual, uint64(ts.UnixNano()))
+			So(math.Float64frombits(exemplars[0].numbers[3][0]), ShouldEqual, 1.4)
+			So(exemplars[0].messages[4][0], ShouldResemble, []byte{0xac, 0xdf, 0xec, 0x5b, 0xe6, 0x32, 0x8c, 0x3a})
+			So(len(exemplars[0].messages[5][0]), ShouldEqual, 16)
+		})
+		Convey("should leave out string datapoints", func() {
+			m := metrics(
+				datapoint.New("s", nil, datapoint.NewStringValue("x"), datapoint.Gauge, ts),
+				datapoint.New("g", nil, datapoint.NewIntValue(1), datapoint.Gauge, ts),
+			)
+			So(len(m), ShouldEqual, 1)
+			So(m[0].string(1), ShouldEqual, "g")
+		})
+		Convey("should post to the collector", func() {
+			requests := make(chan *http.Request, 1)
+			bodies := make(chan []byte, 1)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				b, _ := ioutil.ReadAll(r.Body)
+				requests <- r
+				bodies <- b
+			}))
+			defer server.Close()
+			sink := NewHTTPSink(WithOTLPExporter(server.URL))
+			sink.DisableCompression = true
+			Convey("with the metrics", func() {
+				So(sink.AddDatapoints(context.Background(), []*datapoint.Datapoint{GaugeF("g", nil, 1)}), ShouldBeNil)
+				r := <-requests
+				So(r.URL.Path, ShouldEqual, "/v1/metrics")
+				So(r.Header.Get("Content-Type"), ShouldEqual, contentTypeHeaderProtobuf)
+				So(len(decodeOTLP(<-bodies).messages[1]), ShouldEqual, 1)
+				So(sink.OTLPDroppedDatapoints(), ShouldEqual, 0)
+			})
+			Convey("unless nothing could be encoded", func() {
+				points := []*datapoint.Datapoint{datapoint.New("s", nil, datapoint.NewStringValue("x"), datapoint.Gauge, ts)}
+				So(sink.AddDatapoints(context.Background(), points), ShouldBeNil)
+				So(len(requests), ShouldEqual, 0)
+				So(sink.OTLPDroppedDatapoints(), ShouldEqual, 1)
+			})
+		})
+	})
+}
+
+func TestOTLPTraces(t *testing.T) {
+	Convey("An OTLP HTTPSink", t, func() {
+		sink := NewHTTPSink(WithOTLPExporter(DefaultOTLPEndpoint), WithDeterministicSerialization())
+		span := func(service string, id string) *trace.Span {
+			return &trace.Span{
+				TraceID:       "fa281a8955571a3a",
+				ID:            id,
+				LocalEndpoint: &trace.Endpoint{ServiceName: pointer.String(service)},
+				Timestamp:     pointer.Int64(1000),
+				Duration:      pointer.Int64(5),
+			}
+		}
+		Convey("should group spans by service", func() {
+			server := span("api", "acdfec5be6328c3a")
+			server.Kind = pointer.String("server")
+			server.Name = pointer.String("GET")
+			server.Tags = map[string]string{"error": "boom", "http.method": "GET"}
+			server.RemoteEndpoint = &trace.Endpoint{ServiceName: pointer.String("web")}
+			server.Annotations = []*trace.Annotation{{Timestamp: pointer.Int64(1002), Value: pointer.String("sent")}}
+			child := span("db", "bcdfec5be6328c3a")
+			child.ParentID = pointer.String("acdfec5be6328c3a")
+			b, err := sink.otlp().traces([]*trace.Span{server, child, span("api", "ccdfec5be6328c3a")})
+			So(err, ShouldBeNil)
+			resourceSpans := decodeOTLP(b).all(1)
+			So(len(resourceSpans), ShouldEqual, 2)
+			So(resourceSpans[0].message(1).attributes(1), ShouldResemble, map[string]string{"service.name": "api"})
+			So(resourceSpans[1].message(1).attributes(1), ShouldResemble, map[string]string{"service.name": "db"})
+			apiSpans := resourceSpans[0].message(2).all(2)
+			So(len(apiSpans), ShouldEqual, 2)
+
+			s := apiSpans[0]
+			So(len(s.messages[1][0]), ShouldEqual, 16)
+			So(s.messages[1][0][:8], ShouldResemble, make([]byte, 8))
+			So(len(s.messages[2][0]), ShouldEqual, 8)
+			So(s.string(5), ShouldEqual, "GET")
+			So(s.numbers[6][0], ShouldEqual, 2)
+			So(s.numbers[7][0], ShouldEqual, uint64(1000*time.Microsecond))
+			So(s.numbers[8][0], ShouldEqual, uint64(1005*time.Microsecond))
+			So(s.attributes(9), ShouldResemble, map[string]string{"error": "boom", "http.method": "GET", "peer.service": "web"})
+			So(s.message(11).string(2), ShouldEqual, "sent")
+			status := s.message(15)
+			So(status.string(2), ShouldEqual, "boom")
+			So(status.numbers[3][0], ShouldEqual, otlpStatusCodeError)
+			So(apiSpans[1].numbers[6][0], ShouldEqual, otlpSpanKindInternal)
+
+			dbSpan := resourceSpans[1].message(2).all(2)[0]
+			So(dbSpan.messages[4][0], ShouldResemble, apiSpans[0].messages[2][0])
+		})
+		Convey("should add endpoints as attributes", func() {
+			s := span("api", "acdfec5be6328c3a")
+			s.LocalEndpoint.Ipv4 = pointer.String("10.0.0.1")
+			s.LocalEndpoint.Port = pointer.Int32(8080)
+			s.RemoteEndpoint = &trace.Endpoint{Ipv6: pointer.String("::1")}
+			s.Tags = map[string]string{"error": "true"}
+			b, err := MarshalOTLPTraces([]*trace.Span{s})
+			So(err, ShouldBeNil)
+			encoded := decodeOTLP(b).message(1).message(2).message(2)
+			So(encoded.attributes(9), ShouldResemble, map[string]string{
+				"error":         "true",
+				"net.host.ip":   "10.0.0.1",
+				"net.host.port": "8080",
+				"net.peer.ip":   "::1",
+			})
+			So(s.Tags, ShouldResemble, map[string]string{"error": "true"})
+			status := encoded.message(15)
+			So(status.string(2), ShouldEqual, "")
+			So(status.numbers[3][0], ShouldEqual, otlpStatusCodeError)
+		})
+		Convey("should reject spans with invalid IDs", func() {
+			_, err := sink.otlp().traces([]*trace.Span{span("api", "not hex")})
+			So(spanfilter.IsMap(err), ShouldBeTrue)
+			So(err.(*spanfilter.Map).Invalid[spanfilter.InvalidSpanID], ShouldResemble, []string{"not hex"})
+		})
+	})
+}
+
+func TestOTLPResponseValidator(t *testing.T) {
+	Convey("The OTLP response validator", t, func() {
+		partialSuccess := func(rejected uint64, message string) []byte {
+			return otlpMessage(nil, 1, otlpString(otlpVarint(nil, 1, rejected), 2, message))
+		}
+		Convey("should accept full success", func() {
+			So(otlpResponseValidator(nil), ShouldBeNil)
+			So(otlpResponseValidator(partialSuccess(0, "")), ShouldBeNil)
+		})
+		Convey("should report rejected data", func() {
+			err := otlpResponseValidator(partialSuccess(2, "bad points"))
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "2 were rejected: bad points")
+		})
+		Convey("should ignore malformed responses", func() {
+			So(otlpResponseValidator([]byte{0xff}), ShouldBeNil)
+		})
+	})
+}
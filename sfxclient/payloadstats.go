@@ -0,0 +1,116 @@
+package sfxclient
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/signalfx/golib/v3/datapoint"
+)
+
+// payloadStats counts the bytes of the request bodies each datum type and token sent, before compression
+// and as sent, to show how much compression saves
+type payloadStats struct {
+	defaultDims map[string]string
+	// perToken counts each token separately, instead of only each datum type
+	perToken bool
+	// maxTokens caps how many tokens are counted separately.  The counts of the least recently seen token
+	// are folded into its datum type's count without a token, so the totals never go down.  recent orders
+	// the tokens from most to least recently seen, and elements finds a token in recent.
+	maxTokens int
+	recent    *list.List
+	elements  map[string]*list.Element
+
+	mu     sync.Mutex
+	counts map[payloadKey]*payloadCount
+}
+
+type payloadKey struct {
+	datumType string
+	token     string
+}
+
+type payloadCount struct {
+	uncompressed int64
+	sent         int64
+}
+
+func newPayloadStats(defaultDims map[string]string, perToken bool, maxTokens int) *payloadStats {
+	return &payloadStats{
+		defaultDims: defaultDims,
+		perToken:    perToken,
+		maxTokens:   maxTokens,
+		recent:      list.New(),
+		elements:    make(map[string]*list.Element),
+		counts:      make(map[payloadKey]*payloadCount),
+	}
+}
+
+// add counts a request body of datumType sent with token
+func (p *payloadStats) add(datumType string, token string, uncompressedBytes, sentBytes int) {
+	if !p.perToken {
+		token = ""
+	}
+	p.mu.Lock()
+	c := p.count(payloadKey{datumType: datumType, token: token})
+	c.uncompressed += int64(uncompressedBytes)
+	c.sent += int64(sentBytes)
+	p.touch(token)
+	p.mu.Unlock()
+}
+
+// count returns the count of key, creating it if needed.  p.mu must be held.
+func (p *payloadStats) count(key payloadKey) *payloadCount {
+	c, exists := p.counts[key]
+	if !exists {
+		c = &payloadCount{}
+		p.counts[key] = c
+	}
+	return c
+}
+
+// touch marks token as the most recently seen, folding the counts of the least recently seen token into
+// their datum types if there are more than maxTokens.  p.mu must be held.
+func (p *payloadStats) touch(token string) {
+	if p.maxTokens <= 0 || token == "" {
+		return
+	}
+	if e, exists := p.elements[token]; exists {
+		p.recent.MoveToFront(e)
+		return
+	}
+	p.elements[token] = p.recent.PushFront(token)
+	if p.recent.Len() <= p.maxTokens {
+		return
+	}
+	oldest := p.recent.Remove(p.recent.Back()).(string)
+	delete(p.elements, oldest)
+	for key, c := range p.counts {
+		if key.token != oldest {
+			continue
+		}
+		folded := p.count(payloadKey{datumType: key.datumType})
+		folded.uncompressed += c.uncompressed
+		folded.sent += c.sent
+		delete(p.counts, key)
+	}
+}
+
+// Datapoints returns the bytes counted before compression and as sent
+func (p *payloadStats) Datapoints() []*datapoint.Datapoint {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	dps := make([]*datapoint.Datapoint, 0, len(p.counts)*2)
+	for key, c := range p.counts {
+		dims := map[string]string{"datum_type": key.datumType}
+		if key.token != "" {
+			dims["token"] = key.token
+		}
+		for k, v := range p.defaultDims {
+			dims[k] = v
+		}
+		dps = append(dps,
+			Cumulative("total_uncompressed_bytes", dims, c.uncompressed),
+			Cumulative("total_sent_bytes", dims, c.sent))
+	}
+	return dps
+}
@@ -0,0 +1,97 @@
+package sfxclient
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func payloadValues(dps []*datapoint.Datapoint) map[string]int64 {
+	values := map[string]int64{}
+	for _, dp := range dps {
+		if dp.Metric == "total_uncompressed_bytes" || dp.Metric == "total_sent_bytes" {
+			values[dp.Metric+":"+dp.Dimensions["datum_type"]+":"+dp.Dimensions["token"]] = dp.Value.(datapoint.IntValue).Int()
+		}
+	}
+	return values
+}
+
+func TestPayloadStats(t *testing.T) {
+	Convey("Payload stats", t, func() {
+		Convey("should count each token", func() {
+			p := newPayloadStats(map[string]string{"a": "b"}, true, 0)
+			p.add("datapoint", "abc", 100, 40)
+			p.add("datapoint", "abc", 10, 10)
+			p.add("event", "def", 5, 5)
+			So(payloadValues(p.Datapoints()), ShouldResemble, map[string]int64{
+				"total_uncompressed_bytes:datapoint:abc": 110,
+				"total_sent_bytes:datapoint:abc":         50,
+				"total_uncompressed_bytes:event:def":     5,
+				"total_sent_bytes:event:def":             5,
+			})
+			So(p.Datapoints()[0].Dimensions["a"], ShouldEqual, "b")
+		})
+		Convey("should only count datum types without per token stats", func() {
+			p := newPayloadStats(nil, false, 0)
+			p.add("datapoint", "abc", 100, 40)
+			p.add("datapoint", "def", 10, 10)
+			So(payloadValues(p.Datapoints()), ShouldResemble, map[string]int64{
+				"total_uncompressed_bytes:datapoint:": 110,
+				"total_sent_bytes:datapoint:":         50,
+			})
+		})
+		Convey("should fold the least recently seen tokens into their datum type past the cap", func() {
+			p := newPayloadStats(nil, true, 2)
+			p.add("datapoint", "abc", 100, 40)
+			p.add("event", "abc", 1, 1)
+			p.add("datapoint", "def", 10, 10)
+			p.add("datapoint", "ghi", 5, 5)
+			p.add("datapoint", "jkl", 7, 7)
+			So(len(p.elements), ShouldEqual, 2)
+			So(payloadValues(p.Datapoints()), ShouldResemble, map[string]int64{
+				"total_uncompressed_bytes:datapoint:":    110,
+				"total_sent_bytes:datapoint:":            50,
+				"total_uncompressed_bytes:event:":        1,
+				"total_sent_bytes:event:":                1,
+				"total_uncompressed_bytes:datapoint:ghi": 5,
+				"total_sent_bytes:datapoint:ghi":         5,
+				"total_uncompressed_bytes:datapoint:jkl": 7,
+				"total_sent_bytes:datapoint:jkl":         7,
+			})
+		})
+	})
+}
+
+func TestAsyncMultiTokenSinkCompression(t *testing.T) {
+	Convey("An AsyncMultiTokenSink", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			_, _ = rw.Write([]byte(`"OK"`))
+		}))
+		defer server.Close()
+		dps := make([]*datapoint.Datapoint, 0, 100)
+		for i := 0; i < 100; i++ {
+			dps = append(dps, Gauge("some.metric.name", map[string]string{"host": "host.example.com"}, int64(i)))
+		}
+		send := func(opts ...AsyncMultiTokenSinkOption) map[string]int64 {
+			s := NewAsyncMultiTokenSink(1, 1, 5, 5000, server.URL, "", "", "", nil, nil, 0, append(opts, WithDatumTypes(DatapointDatum))...)
+			s.ShutdownTimeout = time.Second
+			So(s.AddDatapointsWithToken("abc", dps), ShouldBeNil)
+			So(s.Close(), ShouldBeNil)
+			return payloadValues(s.Datapoints())
+		}
+		Convey("should count the bytes each token sends compressed", func() {
+			values := send(WithSinkCompressionLevel(9))
+			So(values["total_uncompressed_bytes:datapoint:abc"], ShouldBeGreaterThan, 1500)
+			So(values["total_sent_bytes:datapoint:abc"], ShouldBeLessThan, values["total_uncompressed_bytes:datapoint:abc"])
+		})
+		Convey("should be able to send uncompressed", func() {
+			values := send(WithoutSinkCompression())
+			So(values["total_sent_bytes:datapoint:abc"], ShouldEqual, values["total_uncompressed_bytes:datapoint:abc"])
+			So(values["total_sent_bytes:datapoint:abc"], ShouldBeGreaterThan, 1500)
+		})
+	})
+}
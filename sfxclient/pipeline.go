@@ -0,0 +1,690 @@
+package sfxclient
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+)
+
+// EmitFunc sends a batch of data using token.  Each pipeline worker has its own EmitFunc, so it is never
+// called concurrently with itself.
+type EmitFunc[T any] func(ctx context.Context, token Token, data []T) error
+
+// PipelineConfig configures a Pipeline
+type PipelineConfig[T any] struct {
+	// Name is the singular name of the datum type, like "datapoint".  It names the pipeline's metrics and errors
+	Name string
+	// NumChannels is how many input channels tokens are hashed to
+	NumChannels int64
+	// NumDrainingThreads is how many workers drain each channel
+	NumDrainingThreads int64
+	// Buffer is the size of each input channel
+	Buffer int
+	// BatchSize is the most items a worker emits at once
+	BatchSize int
+	// MaxRetry is how many times a batch is retried after a timeout
+	MaxRetry int
+	// Retry is how failed batches are retried.  By default timeouts are retried right away, and throttled
+	// batches once their Retry-After has passed.
+	Retry *RetryPolicy
+	// OnDropped, if set, is given a copy of each batch that still failed after retrying, with the error
+	// it failed with, so it can be saved or sent elsewhere
+	OnDropped func(token Token, data []T, err error)
+	// OrderedDelivery hashes tokens to workers instead of channels, so the batches of a token are emitted in
+	// the order they were added.  Each worker gets its own channel of size Buffer.
+	OrderedDelivery bool
+	// BlockOnFull makes adding wait for room in a full input channel, until the context of the add is
+	// done, instead of returning an error right away
+	BlockOnFull bool
+	// PriorityBuffer is the size of the high priority lane of each channel, which workers drain before
+	// the channel itself.  Zero adds high priority data like any other.
+	PriorityBuffer int
+	// PropagateDeadline emits each batch with the deadline of the context its items were added with, and
+	// cancels it when that context is.  Batches always carry the values of that context, since items added
+	// with different contexts are never batched together.
+	PropagateDeadline bool
+	// MaxBufferDuration is the longest a worker keeps adding items to a batch before emitting it, even if
+	// more items keep arriving.  Zero fills batches for as long as items are waiting.
+	MaxBufferDuration time.Duration
+	// NewEmitter is called once per worker to create the function the worker emits batches with
+	NewEmitter func() EmitFunc[T]
+	// ErrorHandler is called with errors that are not retried, or still fail after retrying.  Defaults to
+	// DefaultErrorHandler
+	ErrorHandler func(error) error
+	// DisableDetailedStats skips the per token status counts and the batch size distribution, which each
+	// keep their own bookkeeping, leaving only the buffered and retry counts
+	DisableDetailedStats bool
+	// IdempotencyKeys gives each batch's context a new idempotency key, which is kept when the batch is
+	// retried
+	IdempotencyKeys bool
+	// StatsSampleRate records the status and size of one in every StatsSampleRate batches a worker emits,
+	// scaling the status counts back up.  Zero or one records every batch.
+	StatsSampleRate int
+	// MaxStatsTokens caps how many tokens the per token status counts and gauges keep.  Zero keeps every token.
+	MaxStatsTokens int
+	// OnUnauthorized, if set, is called with tokens the backend rejects with a 401 or 403
+	OnUnauthorized func(token string)
+	// TokenValidator, if set, checks each token before its data is added
+	TokenValidator TokenValidator
+	// TokenObfuscator obfuscates the tokens in the pipeline's errors and token dimensions.  By default
+	// dimensions have the token as is, and errors have it hashed with HashToken.
+	TokenObfuscator TokenObfuscator
+}
+
+// msg is a set of items to emit with a single token
+type msg[T any] struct {
+	token    string
+	scheme   TokenScheme
+	data     []T
+	priority Priority
+	// ctx is the context the data was added with
+	ctx context.Context
+}
+
+// maxRetainedBufferCap caps the capacity of the batch buffer a worker keeps between batches, so a huge
+// BatchSize doesn't pin a huge buffer per worker
+const maxRetainedBufferCap = 4096
+
+// pipelineChannel is an input channel and the workers draining it.  priority is the channel's high
+// priority lane, or nil if the pipeline has none.
+type pipelineChannel[T any] struct {
+	input    chan *msg[T]
+	priority chan *msg[T]
+	workers  []*pipelineWorker[T]
+	// mu keeps adds from taking slots of input while sendPriority rearranges it
+	mu sync.Mutex
+}
+
+// Pipeline asynchronously batches and emits items of any type for multiple tokens.  Items for a token are
+// hashed to one of several channels, each drained by a set of workers that batch the items and emit them
+// with an EmitFunc.  AsyncMultiTokenSink is built from one Pipeline per datum type.
+type Pipeline[T any] struct {
+	name         string
+	channels     []*pipelineChannel[T]
+	errorHandler func(error) error
+	// closing is closed to signal the workers to stop accepting data and drain what is buffered.  Nothing
+	// is ever sent on it.
+	closing chan bool
+	done    chan bool
+	// drainCtx is the context batches are emitted with.  It is cancelled once Close stops waiting for the
+	// workers to drain, which abandons what is left.
+	drainCtx    context.Context
+	cancelDrain context.CancelFunc
+	// getChannel hashes a token to a channel
+	getChannel func(token string, size int) (int64, error)
+	msgPool    sync.Pool
+
+	defaultDims map[string]string
+	// byToken, tokenGauges and batchSizes are nil when detailed stats are disabled
+	byToken         *AsyncTokenStatusCounter
+	tokenGauges     *tokenGauges
+	batchSizes      *RollingBucket
+	statsSampleRate int
+	idempotencyKeys bool
+	onUnauthorized  func(token string)
+	tokenValidator  TokenValidator
+	obfuscator      TokenObfuscator
+	retry           *RetryPolicy
+	maxBufferTime   time.Duration
+	blockOnFull     bool
+	onDropped       func(token Token, data []T, err error)
+	added           int64 // number of items ever added to the pipeline
+	buffered        int64 // number of items added that haven't been emitted
+	retries         int64
+	evicted         int64 // number of items evicted to make room for high priority data
+	priorityLanes   bool
+	deadlines       bool  // propagate the deadlines of the contexts data is added with
+	workers         int64 // number of running workers
+}
+
+// NewPipeline creates and starts a Pipeline
+func NewPipeline[T any](conf *PipelineConfig[T]) *Pipeline[T] {
+	workerCount := conf.NumChannels * conf.NumDrainingThreads
+	defaultDims := pipelineDims(conf.NumChannels, conf.NumDrainingThreads, conf.Buffer, conf.BatchSize)
+	numChannels, numDrainingThreads := conf.NumChannels, conf.NumDrainingThreads
+	if conf.OrderedDelivery {
+		// give each worker its own channel, so every token is only ever emitted by one worker
+		numChannels, numDrainingThreads = workerCount, 1
+	}
+	p := &Pipeline[T]{
+		name:         conf.Name,
+		channels:     make([]*pipelineChannel[T], numChannels),
+		errorHandler: DefaultErrorHandler,
+		closing:      make(chan bool),
+		done:         make(chan bool, workerCount),
+		getChannel:   newTokenHasher(),
+		defaultDims:  defaultDims,
+		workers:      workerCount,
+	}
+	p.drainCtx, p.cancelDrain = context.WithCancel(context.Background())
+	if !conf.DisableDetailedStats {
+		p.byToken = NewAsyncTokenStatusCounter(fmt.Sprintf("total_%ss_by_token", conf.Name), conf.Buffer, workerCount, defaultDims, WithMaxTokens(conf.MaxStatsTokens))
+		p.tokenGauges = newTokenGauges(conf.Name, defaultDims, conf.MaxStatsTokens)
+		p.batchSizes = NewRollingBucket("batch_sizes", map[string]string{"path": "pops_to_ingest", "datum_type": conf.Name})
+		p.statsSampleRate = conf.StatsSampleRate
+	}
+	p.idempotencyKeys = conf.IdempotencyKeys
+	p.onUnauthorized = conf.OnUnauthorized
+	p.tokenValidator, p.obfuscator = conf.TokenValidator, conf.TokenObfuscator
+	p.retry = conf.Retry
+	p.maxBufferTime = conf.MaxBufferDuration
+	p.blockOnFull = conf.BlockOnFull
+	p.onDropped = conf.OnDropped
+	p.priorityLanes = conf.PriorityBuffer > 0
+	p.deadlines = conf.PropagateDeadline
+	p.msgPool.New = func() interface{} {
+		return &msg[T]{}
+	}
+	if conf.ErrorHandler != nil {
+		p.errorHandler = conf.ErrorHandler
+	}
+	for i := range p.channels {
+		c := &pipelineChannel[T]{
+			input:   make(chan *msg[T], conf.Buffer),
+			workers: make([]*pipelineWorker[T], numDrainingThreads),
+		}
+		if p.priorityLanes {
+			c.priority = make(chan *msg[T], conf.PriorityBuffer)
+		}
+		for j := range c.workers {
+			c.workers[j] = newPipelineWorker(p, c, conf.NewEmitter(), conf.BatchSize, conf.MaxRetry)
+		}
+		p.channels[i] = c
+	}
+	return p
+}
+
+// pipelineDims are the dimensions of the datapoints about a pipeline
+func pipelineDims(numChannels int64, numDrainingThreads int64, buffer int, batchSize int) map[string]string {
+	return map[string]string{
+		"buffer_size":        strconv.Itoa(buffer),
+		"numChannels":        strconv.FormatInt(numChannels, 10),
+		"numDrainingThreads": strconv.FormatInt(numDrainingThreads, 10),
+		"worker_count":       strconv.FormatInt(numChannels*numDrainingThreads, 10),
+		"batch_size":         strconv.Itoa(batchSize),
+	}
+}
+
+// newTokenHasher returns a function that hashes tokens to one of size channels
+func newTokenHasher() func(token string, size int) (int64, error) {
+	var lock sync.Mutex
+	hasher := fnv.New32()
+	return func(token string, size int) (int64, error) {
+		if size <= 0 {
+			return 0, fmt.Errorf("no available workers")
+		}
+		lock.Lock()
+		defer lock.Unlock()
+		hasher.Reset()
+		_, _ = hasher.Write([]byte(token))
+		return int64(hasher.Sum32()) % int64(size), nil
+	}
+}
+
+// AddWithToken queues data to be emitted with token.  It returns an error, and does not block, if the
+// channel for the token is full or the pipeline is closed.  A pipeline with BlockOnFull set waits for
+// room in the channel instead.
+func (p *Pipeline[T]) AddWithToken(token Token, data []T) error {
+	return p.addContext(context.Background(), token, data)
+}
+
+// AddWithPriority queues data to be emitted with token like AddWithToken.  If the pipeline has a
+// PriorityBuffer, HighPriority data is emitted before normal priority data, and normal priority data is
+// dropped to make room for it when the pipeline is full.
+func (p *Pipeline[T]) AddWithPriority(token Token, data []T, priority Priority) error {
+	return p.add(context.Background(), token, data, priority)
+}
+
+// addContext queues data to be emitted with token, waiting for room in the channel until ctx is done if
+// the pipeline blocks when full
+func (p *Pipeline[T]) addContext(ctx context.Context, token Token, data []T) error {
+	return p.add(ctx, token, data, NormalPriority)
+}
+
+// add queues data to be emitted with token in the lane for priority
+func (p *Pipeline[T]) add(ctx context.Context, token Token, data []T, priority Priority) (err error) {
+	if p.tokenValidator != nil {
+		if err = p.tokenValidator.ValidateToken(ctx, token.Value); err != nil {
+			return fmt.Errorf("unable to add %ss with token %s: %w", p.name, p.obfuscate(token.Value), err)
+		}
+	}
+	var channelID int64
+	if channelID, err = p.getChannel(token.Value, len(p.channels)); err != nil {
+		return fmt.Errorf("unable to add %ss: there was an error while hashing the token to a worker. %w", p.name, err)
+	}
+	_ = atomic.AddInt64(&p.added, int64(len(data)))
+	if p.tokenGauges != nil {
+		// count the items before sending them, so a worker can't count them leaving first
+		p.tokenGauges.buffer(token.Value, int64(len(data)))
+	}
+	m := p.msgPool.Get().(*msg[T])
+	m.token, m.scheme, m.data, m.priority, m.ctx = token.Value, token.Scheme, data, priority, ctx
+	c := p.channels[channelID]
+	select {
+	// check if the pipeline is closing and return if so
+	// reading from p.closing will only return a value if the p.closing channel is closed
+	case <-p.closing:
+		err = fmt.Errorf("unable to add %ss: the worker has been stopped", p.name)
+	default:
+		switch {
+		case priority > NormalPriority && p.priorityLanes:
+			if err = p.sendPriority(c, m); err != nil && p.blockOnFull {
+				err = p.send(ctx, c.priority, m)
+			}
+		case p.blockOnFull:
+			err = p.send(ctx, c.input, m)
+		default:
+			if !p.trySendNormal(c, m) {
+				err = fmt.Errorf("unable to add %ss: the input buffer is full", p.name)
+			}
+		}
+		if err == nil {
+			atomic.AddInt64(&p.buffered, int64(len(data)))
+			return nil
+		}
+	}
+	if p.tokenGauges != nil {
+		p.tokenGauges.buffer(token.Value, -int64(len(data)))
+	}
+	p.releaseMsg(m)
+	return err
+}
+
+// send waits until m is sent on input, ctx is done or the pipeline closes
+func (p *Pipeline[T]) send(ctx context.Context, input chan *msg[T], m *msg[T]) error {
+	select {
+	case input <- m:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("unable to add %ss: %w", p.name, ctx.Err())
+	case <-p.closing:
+		return fmt.Errorf("unable to add %ss: the worker has been stopped", p.name)
+	}
+}
+
+// releaseMsg returns a message to the pool once nothing references it
+func (p *Pipeline[T]) releaseMsg(m *msg[T]) {
+	*m = msg[T]{}
+	p.msgPool.Put(m)
+}
+
+// Add queues data to be emitted with the token from TokenFromContext.  A pipeline with BlockOnFull set
+// waits for room until ctx is done.
+func (p *Pipeline[T]) Add(ctx context.Context, data []T) error {
+	if token, ok := TokenFromContext(ctx); ok {
+		return p.addContext(ctx, token, data)
+	}
+	return fmt.Errorf("no value was found on the context with key '%s'", TokenCtxKey)
+}
+
+// Datapoints returns datapoints about the pipeline
+func (p *Pipeline[T]) Datapoints() []*datapoint.Datapoint {
+	retryDims := map[string]string{"datum_type": p.name}
+	for k, v := range p.defaultDims {
+		retryDims[k] = v
+	}
+	dps := []*datapoint.Datapoint{
+		Gauge(fmt.Sprintf("total_%ss_buffered", p.name), p.defaultDims, atomic.LoadInt64(&p.buffered)),
+		Cumulative("total_retries", retryDims, atomic.LoadInt64(&p.retries)),
+	}
+	dps = append(dps, p.evictedDatapoints()...)
+	dps = append(dps, p.tokenDatapoints()...)
+	return append(dps, p.batchSizeDatapoints()...)
+}
+
+// evictedDatapoints returns how many items were evicted for high priority data, if the pipeline has
+// priority lanes
+func (p *Pipeline[T]) evictedDatapoints() []*datapoint.Datapoint {
+	if !p.priorityLanes {
+		return nil
+	}
+	return []*datapoint.Datapoint{Cumulative(fmt.Sprintf("total_%ss_evicted", p.name), p.defaultDims, atomic.LoadInt64(&p.evicted))}
+}
+
+// tokenDatapoints returns the per token status counts and gauges, if they are kept
+func (p *Pipeline[T]) tokenDatapoints() []*datapoint.Datapoint {
+	if p.byToken == nil {
+		return nil
+	}
+	return obfuscateTokenDims(append(p.byToken.Datapoints(), p.tokenGauges.Datapoints()...), p.obfuscator)
+}
+
+// obfuscate returns token as it may appear in errors
+func (p *Pipeline[T]) obfuscate(token string) string {
+	if p.obfuscator == nil {
+		return HashToken(token)
+	}
+	return p.obfuscator(token)
+}
+
+// batchSizeDatapoints returns the batch size distribution, if it is kept
+func (p *Pipeline[T]) batchSizeDatapoints() []*datapoint.Datapoint {
+	if p.batchSizes == nil {
+		return nil
+	}
+	return p.batchSizes.Datapoints()
+}
+
+// stopStats stops the per token status counter
+func (p *Pipeline[T]) stopStats() {
+	if p.byToken != nil {
+		close(p.byToken.stop)
+	}
+}
+
+// stop signals the workers to stop
+func (p *Pipeline[T]) stop() {
+	close(p.closing)
+}
+
+// wait waits until the workers have drained the pipeline or timeout fires, returning how many items may
+// have been dropped.  Items still being emitted when timeout fires are abandoned.
+func (p *Pipeline[T]) wait(timeout <-chan time.Time) (dropped int64) {
+	defer p.cancelDrain()
+	for atomic.LoadInt64(&p.workers) > 0 {
+		select {
+		case <-timeout:
+			return atomic.LoadInt64(&p.buffered)
+		case <-p.done:
+			atomic.AddInt64(&p.workers, -1)
+		}
+	}
+	// items added while the workers finished draining are never emitted
+	if dropped = atomic.LoadInt64(&p.buffered); dropped < 0 {
+		dropped = 0
+	}
+	return dropped
+}
+
+// Close stops accepting data and waits up to timeout for the workers to emit what is buffered
+func (p *Pipeline[T]) Close(timeout time.Duration) error {
+	p.stop()
+	dropped := p.wait(time.After(timeout))
+	p.stopStats()
+	if workers := atomic.LoadInt64(&p.workers); workers > 0 || dropped > 0 {
+		return fmt.Errorf("some workers (%d) timedout while stopping the pipeline approximately %d %ss may have been dropped", workers, dropped, p.name)
+	}
+	return nil
+}
+
+// pipelineWorker batches items from a channel and emits them
+type pipelineWorker[T any] struct {
+	pipeline  *Pipeline[T]
+	input     chan *msg[T] // channel for inputing items into a worker
+	priority  chan *msg[T] // high priority lane drained before input, or nil
+	emit      EmitFunc[T]
+	buffer    []T
+	batchSize int
+	maxRetry  int // maximum number of times to retry emitting a batch
+	// token is the token of the batch being emitted, and emitToken emits with it.  emitToken is created
+	// once so flushing doesn't allocate a closure per batch
+	token     Token
+	emitToken func(ctx context.Context, data []T) error
+
+	// batches counts the batches emitted, and skipStats is set when the current batch isn't sampled
+	batches   int
+	skipStats bool
+	// bufferStart is when the worker started filling the current batch, if the pipeline has a
+	// MaxBufferDuration
+	bufferStart time.Time
+	// batchCtx is the context every item of the current batch was added with
+	batchCtx context.Context
+}
+
+func newPipelineWorker[T any](p *Pipeline[T], c *pipelineChannel[T], emit EmitFunc[T], batchSize int, maxRetry int) *pipelineWorker[T] {
+	w := &pipelineWorker[T]{
+		pipeline:  p,
+		input:     c.input,
+		priority:  c.priority,
+		emit:      emit,
+		buffer:    make([]T, 0, bufferCap(batchSize)),
+		batchSize: batchSize,
+		maxRetry:  maxRetry,
+	}
+	w.emitToken = func(ctx context.Context, data []T) error {
+		ctx, cancel := p.retry.attemptContext(ctx)
+		defer cancel()
+		return w.emit(ctx, w.token, data)
+	}
+	go w.newBuffer()
+	return w
+}
+
+func bufferCap(batchSize int) int {
+	if batchSize > maxRetainedBufferCap {
+		return maxRetainedBufferCap
+	}
+	return batchSize
+}
+
+// flush emits the buffered items.  A batch that filled up as its last message was processed has already
+// been flushed, so there may be nothing left to emit.
+func (w *pipelineWorker[T]) flush(token string, scheme TokenScheme) {
+	if len(w.buffer) == 0 {
+		return
+	}
+	w.token = Token{Value: token, Scheme: scheme}
+	w.batches++
+	w.skipStats = w.pipeline.statsSampleRate > 1 && w.batches%w.pipeline.statsSampleRate != 0
+	if w.pipeline.batchSizes != nil && !w.skipStats {
+		w.pipeline.batchSizes.Add(float64(len(w.buffer)))
+	}
+	ctx, cancel := newBatchContext(w.pipeline.drainCtx, w.batchCtx, w.pipeline.deadlines)
+	defer cancel()
+	w.batchCtx = nil
+	if w.pipeline.idempotencyKeys {
+		ctx = ContextWithIdempotencyKey(ctx, NewIdempotencyKey())
+	}
+	// emit the items and handle any errors
+	err := w.emitToken(ctx, w.buffer)
+	w.handleError(ctx, err, token, w.buffer, w.emitToken)
+	// account for the emitted items
+	atomic.AddInt64(&w.pipeline.buffered, int64(len(w.buffer)*-1))
+	w.resetBuffer()
+	w.startBuffer()
+}
+
+// startBuffer notes when the worker started filling a batch
+func (w *pipelineWorker[T]) startBuffer() {
+	if w.pipeline.maxBufferTime > 0 {
+		w.bufferStart = time.Now()
+	}
+}
+
+// bufferExpired is true if the batch has been filling for longer than the pipeline's MaxBufferDuration
+func (w *pipelineWorker[T]) bufferExpired() bool {
+	return w.pipeline.maxBufferTime > 0 && len(w.buffer) > 0 && time.Since(w.bufferStart) >= w.pipeline.maxBufferTime
+}
+
+// resetBuffer empties the buffer for reuse, dropping references to the emitted items so they can be
+// collected, and dropping the buffer itself if it grew past maxRetainedBufferCap
+func (w *pipelineWorker[T]) resetBuffer() {
+	if cap(w.buffer) > maxRetainedBufferCap {
+		w.buffer = make([]T, 0, maxRetainedBufferCap)
+		return
+	}
+	var zero T
+	for i := range w.buffer {
+		w.buffer[i] = zero
+	}
+	w.buffer = w.buffer[:0]
+}
+
+// isRetryableStatus is true for the cases where http status codes are not found or an http timeout status is encountered
+func isRetryableStatus(status int) bool {
+	return status == -1 || status == http.StatusRequestTimeout || status == http.StatusGatewayTimeout || status == 598
+}
+
+// handleError retries timeouts with ctx, counts the final status and reports errors that remain
+func (w *pipelineWorker[T]) handleError(ctx context.Context, err error, token string, data []T, emit func(context.Context, []T) error) {
+	status := &tokenStatus{
+		status: -1,
+		token:  token,
+		val:    int64(len(data)),
+	}
+	status = getHTTPStatusCode(status, err)
+	for i := 0; i < w.maxRetry && err != nil; i++ {
+		wait, throttled := w.pipeline.retry.retryAfter(err)
+		if !throttled {
+			if !w.pipeline.retry.retryable(status.status, err) {
+				break
+			}
+			wait = w.pipeline.retry.Backoff(i)
+		}
+		if !w.sleep(wait) {
+			break
+		}
+		atomic.AddInt64(&w.pipeline.retries, 1)
+		err = emit(ctx, data)
+		status = getHTTPStatusCode(status, err)
+	}
+	if w.pipeline.byToken != nil && !w.skipStats {
+		if w.pipeline.statsSampleRate > 1 {
+			status.val *= int64(w.pipeline.statsSampleRate)
+		}
+		w.pipeline.byToken.Increment(status)
+	}
+	if w.pipeline.tokenGauges != nil && len(data) > 0 {
+		w.pipeline.tokenGauges.emitted(token, int64(len(data)), status.status, time.Now())
+	}
+	if w.pipeline.onUnauthorized != nil && (status.status == http.StatusUnauthorized || status.status == http.StatusForbidden) {
+		w.pipeline.onUnauthorized(token)
+	}
+	if err != nil {
+		_ = w.pipeline.errorHandler(err)
+		if w.pipeline.onDropped != nil && len(data) > 0 {
+			// the buffer is reused for the next batch, so the handler gets its own copy
+			w.pipeline.onDropped(w.token, append([]T(nil), data...), err)
+		}
+	}
+}
+
+// sleep waits before retrying, returning false if Close gave up waiting for the pipeline to drain.  Batches
+// that fail while draining are still retried for as long as Close waits.
+func (w *pipelineWorker[T]) sleep(wait time.Duration) bool {
+	if wait <= 0 {
+		return w.pipeline.drainCtx.Err() == nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-w.pipeline.drainCtx.Done():
+		return false
+	}
+}
+
+func (w *pipelineWorker[T]) processMsg(m *msg[T]) {
+	for len(m.data) > 0 {
+		msgLength := len(m.data)
+		if len(w.buffer) == 0 {
+			w.batchCtx = m.ctx
+		}
+		remainingBuffer := w.batchSize - len(w.buffer)
+		if msgLength > remainingBuffer {
+			msgLength = remainingBuffer
+		}
+		w.buffer = append(w.buffer, m.data[:msgLength]...)
+		m.data = m.data[msgLength:]
+		if len(w.buffer) >= w.batchSize {
+			w.flush(m.token, m.scheme)
+		}
+	}
+}
+
+// bufferFunc is responsible for batching incoming items into a buffer
+func (w *pipelineWorker[T]) bufferFunc(m *msg[T]) {
+	lastTokenSeen, lastSchemeSeen := m.token, m.scheme
+	w.startBuffer()
+	w.processMsg(m)
+	w.pipeline.releaseMsg(m)
+	for len(w.buffer) < w.batchSize && !w.bufferExpired() {
+		var ok bool
+		if m, ok = w.next(); !ok {
+			break // emit what ever is in the buffer if there are no more items to read
+		}
+		if m.token != lastTokenSeen || m.scheme != lastSchemeSeen || !w.sameContext(m.ctx) {
+			// if the token or context changes, then emit what ever is in the buffer before proceeding, so a
+			// batch is never cancelled by, or sent with the values of, a context that didn't add all of it
+			w.flush(lastTokenSeen, lastSchemeSeen)
+			lastTokenSeen, lastSchemeSeen = m.token, m.scheme
+		}
+		w.processMsg(m)
+		w.pipeline.releaseMsg(m)
+	}
+	// emit the data in the buffer
+	w.flush(lastTokenSeen, lastSchemeSeen)
+}
+
+// sameContext is true if items added with ctx can join the current batch
+func (w *pipelineWorker[T]) sameContext(ctx context.Context) bool {
+	if len(w.buffer) == 0 {
+		return true
+	}
+	if ctx == nil || w.batchCtx == nil {
+		return ctx == w.batchCtx
+	}
+	// contexts are almost always pointers, but comparing two of a type that isn't comparable would panic
+	t := reflect.TypeOf(ctx)
+	return t == reflect.TypeOf(w.batchCtx) && t.Comparable() && ctx == w.batchCtx
+}
+
+// drain emits what is left in the input channel once the pipeline is closing, until the channel is empty
+// or Close gives up waiting
+func (w *pipelineWorker[T]) drain() {
+	for w.pipeline.drainCtx.Err() == nil {
+		m, ok := w.next()
+		if !ok {
+			return
+		}
+		w.bufferFunc(m)
+	}
+}
+
+// next returns a waiting message, from the high priority lane first, without blocking
+func (w *pipelineWorker[T]) next() (*msg[T], bool) {
+	select {
+	case m := <-w.priority:
+		return m, true
+	default:
+	}
+	select {
+	case m := <-w.input:
+		return m, true
+	default:
+		return nil, false
+	}
+}
+
+// newBuffer reads messages until the pipeline closes
+func (w *pipelineWorker[T]) newBuffer() {
+	for {
+		select {
+		case m := <-w.priority:
+			w.bufferFunc(m)
+			continue
+		default:
+		}
+		select {
+		// reading from closing will only return a value if the closing channel is closed
+		case <-w.pipeline.closing:
+			w.drain()
+			// signal that the worker is done
+			w.pipeline.done <- true
+			return
+		case m := <-w.priority:
+			w.bufferFunc(m)
+		case m := <-w.input:
+			w.bufferFunc(m)
+		}
+	}
+}
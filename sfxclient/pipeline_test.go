@@ -0,0 +1,504 @@
+package sfxclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type logBatch struct {
+	token Token
+	lines []string
+}
+
+func newLogPipeline(batchSize int, maxRetry int, emitErr error) (*Pipeline[string], chan logBatch) {
+	batches := make(chan logBatch, 100)
+	p := NewPipeline(&PipelineConfig[string]{
+		Name:               "log",
+		NumChannels:        2,
+		NumDrainingThreads: 1,
+		Buffer:             10,
+		BatchSize:          batchSize,
+		MaxRetry:           maxRetry,
+		ErrorHandler:       func(error) error { return nil },
+		NewEmitter: func() EmitFunc[string] {
+			return func(ctx context.Context, token Token, data []string) error {
+				batches <- logBatch{token: token, lines: append([]string(nil), data...)}
+				return emitErr
+			}
+		},
+	})
+	return p, batches
+}
+
+func TestPipeline(t *testing.T) {
+	Convey("A pipeline of a custom type", t, func() {
+		p, batches := newLogPipeline(2, 2, nil)
+		Convey("should emit items in batches with their token", func() {
+			So(p.AddWithToken(Token{Value: "abc", Scheme: BearerTokenScheme}, []string{"a", "b", "c"}), ShouldBeNil)
+			first := <-batches
+			So(first.token, ShouldResemble, Token{Value: "abc", Scheme: BearerTokenScheme})
+			So(first.lines, ShouldResemble, []string{"a", "b"})
+			So((<-batches).lines, ShouldResemble, []string{"c"})
+			So(p.Close(time.Second), ShouldBeNil)
+			So(atomic.LoadInt64(&p.buffered), ShouldEqual, 0)
+			So(atomic.LoadInt64(&p.added), ShouldEqual, 3)
+		})
+		Convey("should take the token from the context", func() {
+			So(p.Add(context.Background(), []string{"a"}), ShouldNotBeNil)
+			So(p.Add(ContextWithToken(context.Background(), Token{Value: "abc"}), []string{"a"}), ShouldBeNil)
+			So((<-batches).token.Value, ShouldEqual, "abc")
+			So(p.Close(time.Second), ShouldBeNil)
+		})
+		Convey("should refuse items after closing", func() {
+			So(p.Close(time.Second), ShouldBeNil)
+			So(p.AddWithToken(Token{Value: "abc"}, []string{"a"}).Error(), ShouldEqual, "unable to add logs: the worker has been stopped")
+		})
+		Convey("should report stats named after the datum type", func() {
+			So(p.AddWithToken(Token{Value: "abc"}, []string{"a"}), ShouldBeNil)
+			<-batches
+			So(p.Close(time.Second), ShouldBeNil)
+			metrics := map[string]bool{}
+			for _, dp := range p.Datapoints() {
+				metrics[dp.Metric] = true
+			}
+			So(metrics["total_logs_buffered"], ShouldBeTrue)
+			So(metrics["total_retries"], ShouldBeTrue)
+			So(metrics["batch_sizes.count"], ShouldBeTrue)
+		})
+	})
+	Convey("A pipeline that fails to emit", t, func() {
+		p, batches := newLogPipeline(10, 2, &SFXAPIError{StatusCode: http.StatusGatewayTimeout})
+		Convey("should retry timeouts", func() {
+			So(p.AddWithToken(Token{Value: "abc"}, []string{"a"}), ShouldBeNil)
+			for i := 0; i < 3; i++ {
+				So((<-batches).lines, ShouldResemble, []string{"a"})
+			}
+			So(p.Close(time.Second), ShouldBeNil)
+			So(atomic.LoadInt64(&p.retries), ShouldEqual, 2)
+		})
+	})
+	Convey("A pipeline with a slow emitter", t, func() {
+		var once sync.Once
+		release := make(chan struct{})
+		p := NewPipeline(&PipelineConfig[string]{
+			Name:               "log",
+			NumChannels:        1,
+			NumDrainingThreads: 1,
+			Buffer:             1,
+			BatchSize:          1,
+			ErrorHandler:       func(error) error { return nil },
+			NewEmitter: func() EmitFunc[string] {
+				return func(ctx context.Context, token Token, data []string) error {
+					<-release
+					return errors.New("nope")
+				}
+			},
+		})
+		defer once.Do(func() { close(release) })
+		Convey("should report a full buffer and items dropped on close", func() {
+			var err error
+			for err == nil {
+				err = p.AddWithToken(Token{Value: "abc"}, []string{"a"})
+			}
+			So(err.Error(), ShouldEqual, "unable to add logs: the input buffer is full")
+			So(p.Close(0).Error(), ShouldContainSubstring, "may have been dropped")
+		})
+	})
+}
+
+func newStatsPipeline(disable bool, sampleRate int) (*Pipeline[string], chan logBatch) {
+	batches := make(chan logBatch, 100)
+	p := NewPipeline(&PipelineConfig[string]{
+		Name:                 "log",
+		NumChannels:          1,
+		NumDrainingThreads:   1,
+		Buffer:               10,
+		BatchSize:            10,
+		DisableDetailedStats: disable,
+		StatsSampleRate:      sampleRate,
+		NewEmitter: func() EmitFunc[string] {
+			return func(ctx context.Context, token Token, data []string) error {
+				batches <- logBatch{token: token, lines: data}
+				return nil
+			}
+		},
+	})
+	return p, batches
+}
+
+func TestPipelineStats(t *testing.T) {
+	Convey("A pipeline without detailed stats", t, func() {
+		p, batches := newStatsPipeline(true, 0)
+		So(p.byToken, ShouldBeNil)
+		So(p.batchSizes, ShouldBeNil)
+		So(p.AddWithToken(Token{Value: "abc"}, []string{"a"}), ShouldBeNil)
+		<-batches
+		metrics := map[string]bool{}
+		for _, dp := range p.Datapoints() {
+			metrics[dp.Metric] = true
+		}
+		So(metrics["total_logs_buffered"], ShouldBeTrue)
+		So(metrics["total_retries"], ShouldBeTrue)
+		So(metrics["total_logs_by_token"], ShouldBeFalse)
+		So(metrics["batch_sizes.count"], ShouldBeFalse)
+		So(p.Close(time.Second), ShouldBeNil)
+	})
+	Convey("A pipeline sampling its stats", t, func() {
+		p, batches := newStatsPipeline(false, 2)
+		for i := 0; i < 4; i++ {
+			So(p.AddWithToken(Token{Value: "abc"}, []string{"a"}), ShouldBeNil)
+			<-batches
+		}
+		var byToken int64
+		for deadline := time.Now().Add(time.Second * 5); byToken < 4 && time.Now().Before(deadline); runtime.Gosched() {
+			for _, dp := range p.byToken.Datapoints() {
+				byToken = dp.Value.(datapoint.IntValue).Int()
+			}
+		}
+		So(byToken, ShouldEqual, 4)
+		So(p.Close(time.Second), ShouldBeNil)
+		So(p.batchSizes.Hist.Count(), ShouldEqual, 2)
+	})
+}
+
+func BenchmarkPipelineAddWithToken(b *testing.B) {
+	p := NewPipeline(&PipelineConfig[string]{
+		Name:               "log",
+		NumChannels:        1,
+		NumDrainingThreads: 1,
+		Buffer:             100,
+		BatchSize:          50,
+		NewEmitter: func() EmitFunc[string] {
+			return func(ctx context.Context, token Token, data []string) error {
+				return nil
+			}
+		},
+	})
+	defer func() {
+		_ = p.Close(time.Second)
+	}()
+	lines := []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j"}
+	token := Token{Value: "abc"}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for p.AddWithToken(token, lines) != nil {
+			runtime.Gosched()
+		}
+	}
+}
+
+// BenchmarkPipelineFlush drives full batches through a worker's flush, measuring the allocations left once
+// msgs are pooled and the batch buffer is reused.  Batches bigger than maxRetainedBufferCap show the cost
+// of not keeping their buffers.
+func BenchmarkPipelineFlush(b *testing.B) {
+	for _, batchSize := range []int{50, maxRetainedBufferCap * 2} {
+		b.Run(strconv.Itoa(batchSize), func(b *testing.B) {
+			p := NewPipeline(&PipelineConfig[string]{
+				Name:               "log",
+				NumChannels:        1,
+				NumDrainingThreads: 1,
+				Buffer:             1,
+				BatchSize:          batchSize,
+				NewEmitter: func() EmitFunc[string] {
+					return func(ctx context.Context, token Token, data []string) error {
+						return nil
+					}
+				},
+			})
+			defer func() {
+				_ = p.Close(time.Second)
+			}()
+			// nothing is sent to the pipeline, so its worker goroutine never touches the worker
+			w := p.channels[0].workers[0]
+			lines := make([]string, batchSize)
+			m := &msg[string]{token: "abc", ctx: context.Background()}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				m.data = lines
+				w.processMsg(m)
+			}
+		})
+	}
+}
+
+func TestPipelineMaxBufferDuration(t *testing.T) {
+	run := func(maxBufferDuration time.Duration) []int {
+		gate := make(chan struct{})
+		emitting := make(chan struct{}, 10)
+		sizes := make(chan int, 10)
+		p := NewPipeline(&PipelineConfig[string]{
+			Name:               "log",
+			NumChannels:        1,
+			NumDrainingThreads: 1,
+			Buffer:             10,
+			BatchSize:          100,
+			MaxBufferDuration:  maxBufferDuration,
+			ErrorHandler:       func(error) error { return nil },
+			NewEmitter: func() EmitFunc[string] {
+				return func(ctx context.Context, token Token, data []string) error {
+					emitting <- struct{}{}
+					<-gate
+					sizes <- len(data)
+					return nil
+				}
+			},
+		})
+		So(p.AddWithToken(Token{Value: "abc"}, []string{"a"}), ShouldBeNil)
+		// while the first batch is stuck emitting, queue up more messages for the next batch
+		<-emitting
+		for i := 0; i < 4; i++ {
+			So(p.AddWithToken(Token{Value: "abc"}, []string{"b"}), ShouldBeNil)
+		}
+		close(gate)
+		var got []int
+		for total := 0; total < 5; {
+			size := <-sizes
+			total += size
+			got = append(got, size)
+		}
+		So(p.Close(time.Second), ShouldBeNil)
+		return got
+	}
+	Convey("A pipeline without a MaxBufferDuration should batch everything waiting", t, func() {
+		So(run(0), ShouldResemble, []int{1, 4})
+	})
+	Convey("A pipeline with a MaxBufferDuration should emit batches that have waited too long", t, func() {
+		So(run(time.Nanosecond), ShouldResemble, []int{1, 1, 1, 1, 1})
+	})
+}
+
+func TestAsyncMultiTokenSinkMaxBufferDuration(t *testing.T) {
+	Convey("An AsyncMultiTokenSink should pass its max buffer duration to its pipelines", t, func() {
+		s := NewAsyncMultiTokenSink(1, 1, 5, 25, "", "", "", "", newDefaultHTTPClient, nil, 1, WithMaxBufferDuration(time.Second))
+		So(s.datapoints.maxBufferTime, ShouldEqual, time.Second)
+		So(s.events.maxBufferTime, ShouldEqual, time.Second)
+		So(s.spans.maxBufferTime, ShouldEqual, time.Second)
+		So(s.Close(), ShouldBeNil)
+	})
+}
+
+func TestPipelineBlockOnFull(t *testing.T) {
+	Convey("A pipeline that blocks when full", t, func() {
+		gate := make(chan struct{})
+		emitting := make(chan struct{}, 10)
+		p := NewPipeline(&PipelineConfig[string]{
+			Name:               "log",
+			NumChannels:        1,
+			NumDrainingThreads: 1,
+			Buffer:             1,
+			BatchSize:          1,
+			BlockOnFull:        true,
+			ErrorHandler:       func(error) error { return nil },
+			NewEmitter: func() EmitFunc[string] {
+				return func(ctx context.Context, token Token, data []string) error {
+					emitting <- struct{}{}
+					<-gate
+					return nil
+				}
+			},
+		})
+		ctx := ContextWithToken(context.Background(), Token{Value: "abc"})
+		// the worker holds the first message and the channel holds the second
+		So(p.Add(ctx, []string{"a"}), ShouldBeNil)
+		<-emitting
+		So(p.Add(ctx, []string{"b"}), ShouldBeNil)
+
+		Convey("should give up when the context is done", func() {
+			timeoutCtx, cancel := context.WithTimeout(ctx, time.Millisecond*10)
+			defer cancel()
+			err := p.Add(timeoutCtx, []string{"c"})
+			So(errors.Is(err, context.DeadlineExceeded), ShouldBeTrue)
+			So(err.Error(), ShouldStartWith, "unable to add logs")
+			close(gate)
+			So(p.Close(time.Second), ShouldBeNil)
+		})
+		Convey("should add once there is room", func() {
+			added := make(chan error)
+			go func() {
+				added <- p.AddWithToken(Token{Value: "abc"}, []string{"c"})
+			}()
+			select {
+			case <-added:
+				t.Error("add should block while the channel is full")
+			case <-time.After(time.Millisecond * 10):
+			}
+			close(gate)
+			So(<-added, ShouldBeNil)
+			So(p.Close(time.Second), ShouldBeNil)
+		})
+		Convey("should give up when the pipeline closes", func() {
+			added := make(chan error)
+			go func() {
+				added <- p.Add(ctx, []string{"c"})
+			}()
+			p.stop()
+			So((<-added).Error(), ShouldEqual, "unable to add logs: the worker has been stopped")
+			close(gate)
+			So(p.wait(time.After(time.Second)), ShouldEqual, 0)
+			p.stopStats()
+		})
+	})
+}
+
+func TestAsyncMultiTokenSinkBlockingAdd(t *testing.T) {
+	Convey("An AsyncMultiTokenSink should pass blocking adds to its pipelines", t, func() {
+		s := NewAsyncMultiTokenSink(1, 1, 5, 25, "", "", "", "", newDefaultHTTPClient, nil, 1, WithBlockingAdd())
+		So(s.datapoints.blockOnFull, ShouldBeTrue)
+		So(s.events.blockOnFull, ShouldBeTrue)
+		So(s.spans.blockOnFull, ShouldBeTrue)
+		So(s.Close(), ShouldBeNil)
+	})
+}
+
+func TestPipelineDrain(t *testing.T) {
+	Convey("A closing pipeline", t, func() {
+		gate := make(chan struct{})
+		emitting := make(chan struct{}, 10)
+		var mu sync.Mutex
+		var emitted []string
+		p := NewPipeline(&PipelineConfig[string]{
+			Name:               "log",
+			NumChannels:        1,
+			NumDrainingThreads: 1,
+			Buffer:             10,
+			BatchSize:          1,
+			ErrorHandler:       func(error) error { return nil },
+			NewEmitter: func() EmitFunc[string] {
+				return func(ctx context.Context, token Token, data []string) error {
+					emitting <- struct{}{}
+					select {
+					case <-gate:
+					case <-ctx.Done():
+						return ctx.Err()
+					}
+					mu.Lock()
+					emitted = append(emitted, data...)
+					mu.Unlock()
+					return nil
+				}
+			},
+		})
+		// the worker holds the first message while the rest wait in the channel
+		So(p.AddWithToken(Token{Value: "abc"}, []string{"a"}), ShouldBeNil)
+		<-emitting
+		So(p.AddWithToken(Token{Value: "abc"}, []string{"b", "c"}), ShouldBeNil)
+		So(p.AddWithToken(Token{Value: "def"}, []string{"d"}), ShouldBeNil)
+
+		Convey("should emit everything buffered before stopping", func() {
+			closed := make(chan error)
+			go func() {
+				closed <- p.Close(time.Second * 5)
+			}()
+			close(gate)
+			So(<-closed, ShouldBeNil)
+			So(emitted, ShouldResemble, []string{"a", "b", "c", "d"})
+			So(p.AddWithToken(Token{Value: "abc"}, []string{"e"}), ShouldNotBeNil)
+		})
+		Convey("should abandon what is left after the timeout", func() {
+			So(p.Close(time.Millisecond*10).Error(), ShouldContainSubstring, "approximately 4 logs may have been dropped")
+			So(p.drainCtx.Err(), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestPipelineOnDropped(t *testing.T) {
+	Convey("A pipeline with an OnDropped handler", t, func() {
+		dropped := make(chan logBatch, 10)
+		errs := make(chan error, 10)
+		p := NewPipeline(&PipelineConfig[string]{
+			Name:               "log",
+			NumChannels:        1,
+			NumDrainingThreads: 1,
+			Buffer:             10,
+			BatchSize:          10,
+			MaxRetry:           1,
+			ErrorHandler:       func(error) error { return nil },
+			OnDropped: func(token Token, data []string, err error) {
+				errs <- err
+				dropped <- logBatch{token: token, lines: data}
+			},
+			NewEmitter: func() EmitFunc[string] {
+				return func(ctx context.Context, token Token, data []string) error {
+					if data[0] == "ok" {
+						return nil
+					}
+					return errors.New("nope")
+				}
+			},
+		})
+		So(p.AddWithToken(Token{Value: "abc"}, []string{"ok"}), ShouldBeNil)
+		So(p.AddWithToken(Token{Value: "def", Scheme: BearerTokenScheme}, []string{"a", "b"}), ShouldBeNil)
+		So(p.Close(time.Second), ShouldBeNil)
+		So(len(dropped), ShouldEqual, 1)
+		batch := <-dropped
+		So(batch.token, ShouldResemble, Token{Value: "def", Scheme: BearerTokenScheme})
+		So(batch.lines, ShouldResemble, []string{"a", "b"})
+		So((<-errs).Error(), ShouldEqual, "nope")
+		So(atomic.LoadInt64(&p.retries), ShouldEqual, 1)
+	})
+}
+
+func TestPipelineOrderedDelivery(t *testing.T) {
+	Convey("A pipeline with ordered delivery", t, func() {
+		var mu sync.Mutex
+		emitted := map[string][]int{}
+		p := NewPipeline(&PipelineConfig[int]{
+			Name:               "seq",
+			NumChannels:        1,
+			NumDrainingThreads: 4,
+			Buffer:             100,
+			BatchSize:          1,
+			OrderedDelivery:    true,
+			ErrorHandler:       func(error) error { return nil },
+			NewEmitter: func() EmitFunc[int] {
+				return func(ctx context.Context, token Token, data []int) error {
+					if len(data) == 0 {
+						return nil
+					}
+					time.Sleep(time.Duration(data[0]%3) * time.Millisecond)
+					mu.Lock()
+					emitted[token.Value] = append(emitted[token.Value], data...)
+					mu.Unlock()
+					return nil
+				}
+			},
+		})
+		So(len(p.channels), ShouldEqual, 4)
+		So(len(p.channels[0].workers), ShouldEqual, 1)
+		for i := 0; i < 30; i++ {
+			for _, token := range []string{"a", "b", "c"} {
+				So(p.AddWithToken(Token{Value: token}, []int{i}), ShouldBeNil)
+			}
+		}
+		So(p.Close(time.Second*5), ShouldBeNil)
+		for _, token := range []string{"a", "b", "c"} {
+			So(len(emitted[token]), ShouldEqual, 30)
+			for i, seq := range emitted[token] {
+				So(seq, ShouldEqual, i)
+			}
+		}
+	})
+}
+
+func TestAsyncMultiTokenSinkOrderedDelivery(t *testing.T) {
+	Convey("An AsyncMultiTokenSink should pass ordered delivery to its pipelines", t, func() {
+		s := NewAsyncMultiTokenSink(2, 3, 5, 25, "", "", "", "", newDefaultHTTPClient, nil, 1, WithOrderedDelivery())
+		So(len(s.datapoints.channels), ShouldEqual, 6)
+		So(len(s.events.channels), ShouldEqual, 6)
+		So(len(s.spans.channels), ShouldEqual, 6)
+		So(s.datapoints.defaultDims["numChannels"], ShouldEqual, "2")
+		So(s.Close(), ShouldBeNil)
+	})
+}
@@ -0,0 +1,117 @@
+package sfxclient
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+// Priority is how important data is to deliver when a pipeline is overloaded
+type Priority int
+
+const (
+	// NormalPriority data is dropped first when a pipeline is overloaded
+	NormalPriority Priority = iota
+	// HighPriority data, like heartbeats, is emitted before normal priority data, and normal priority data
+	// is dropped to make room for it
+	HighPriority
+)
+
+// ErrEvicted is the error normal priority data dropped to make room for high priority data is dropped with
+var ErrEvicted = errors.New("evicted to make room for high priority data")
+
+// sendPriority sends the high priority m on c's priority lane or, if that is full, on its normal lane.  If
+// both are full the oldest normal priority message is evicted to make room, keeping the order of the rest.
+// m is only rejected when the normal lane is full of high priority messages too.
+func (p *Pipeline[T]) sendPriority(c *pipelineChannel[T], m *msg[T]) error {
+	if p.trySend(c.priority, m) {
+		return nil
+	}
+	c.mu.Lock()
+	if p.trySend(c.priority, m) || p.trySend(c.input, m) {
+		c.mu.Unlock()
+		return nil
+	}
+	// take everything off the normal lane and put it back in order, without its oldest normal priority message
+	var victim *msg[T]
+	queued := make([]*msg[T], 0, cap(c.input)+1)
+	for n := len(c.input); n > 0; n-- {
+		old, ok := p.tryReceive(c.input)
+		if !ok {
+			break
+		}
+		if victim == nil && old.priority == NormalPriority {
+			victim = old
+			continue
+		}
+		queued = append(queued, old)
+	}
+	if victim != nil {
+		queued = append(queued, m)
+	}
+	for _, q := range queued {
+		p.requeue(c, q)
+	}
+	c.mu.Unlock()
+	if victim == nil {
+		return fmt.Errorf("unable to add %ss: the input buffer is full of high priority data", p.name)
+	}
+	p.evict(victim)
+	return nil
+}
+
+// requeue puts m back on c's normal lane.  c.mu keeps other adds from taking its place, unless they block
+// on a full pipeline, in which case it waits for the workers to make room.
+func (p *Pipeline[T]) requeue(c *pipelineChannel[T], m *msg[T]) {
+	if p.trySend(c.input, m) {
+		return
+	}
+	select {
+	case c.input <- m:
+	case <-p.drainCtx.Done():
+	}
+}
+
+// tryReceive takes a message off input if there is one
+func (p *Pipeline[T]) tryReceive(input chan *msg[T]) (*msg[T], bool) {
+	select {
+	case m := <-input:
+		return m, true
+	default:
+		return nil, false
+	}
+}
+
+// trySendNormal sends normal priority m on c's normal lane if there is room, taking c.mu when the pipeline
+// has priority lanes so it can't take a slot sendPriority is rearranging
+func (p *Pipeline[T]) trySendNormal(c *pipelineChannel[T], m *msg[T]) bool {
+	if !p.priorityLanes {
+		return p.trySend(c.input, m)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return p.trySend(c.input, m)
+}
+
+// trySend sends m on input if there is room
+func (p *Pipeline[T]) trySend(input chan *msg[T], m *msg[T]) bool {
+	select {
+	case input <- m:
+		return true
+	default:
+		return false
+	}
+}
+
+// evict drops a buffered message to make room for high priority data, passing it to OnDropped
+func (p *Pipeline[T]) evict(m *msg[T]) {
+	atomic.AddInt64(&p.buffered, -int64(len(m.data)))
+	atomic.AddInt64(&p.evicted, int64(len(m.data)))
+	if p.tokenGauges != nil {
+		p.tokenGauges.buffer(m.token, -int64(len(m.data)))
+	}
+	if p.onDropped != nil && len(m.data) > 0 {
+		p.onDropped(Token{Value: m.token, Scheme: m.scheme}, m.data, ErrEvicted)
+	}
+	p.releaseMsg(m)
+}
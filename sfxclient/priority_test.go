@@ -0,0 +1,168 @@
+package sfxclient
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPipelinePriorityLanes(t *testing.T) {
+	Convey("A pipeline with priority lanes", t, func() {
+		gate := make(chan struct{})
+		emitting := make(chan struct{}, 10)
+		emitted := make(chan string, 10)
+		dropped := make(chan string, 10)
+		p := NewPipeline(&PipelineConfig[string]{
+			Name:               "log",
+			NumChannels:        1,
+			NumDrainingThreads: 1,
+			Buffer:             2,
+			PriorityBuffer:     1,
+			BatchSize:          1,
+			ErrorHandler:       func(error) error { return nil },
+			OnDropped: func(token Token, data []string, err error) {
+				if errors.Is(err, ErrEvicted) {
+					dropped <- data[0]
+				}
+			},
+			NewEmitter: func() EmitFunc[string] {
+				return func(ctx context.Context, token Token, data []string) error {
+					if len(data) == 0 {
+						return nil
+					}
+					emitting <- struct{}{}
+					<-gate
+					emitted <- data[0]
+					return nil
+				}
+			},
+		})
+		token := Token{Value: "abc"}
+		// the worker holds the first item while the rest queue up
+		So(p.AddWithToken(token, []string{"first"}), ShouldBeNil)
+		<-emitting
+		So(p.AddWithToken(token, []string{"low1"}), ShouldBeNil)
+		So(p.AddWithPriority(token, []string{"high1"}, HighPriority), ShouldBeNil)
+
+		Convey("should emit high priority items first", func() {
+			close(gate)
+			So(p.Close(time.Second), ShouldBeNil)
+			So(<-emitted, ShouldEqual, "first")
+			So(<-emitted, ShouldEqual, "high1")
+			So(<-emitted, ShouldEqual, "low1")
+		})
+		Convey("should evict normal priority items to make room for high priority ones", func() {
+			So(p.AddWithToken(token, []string{"low2"}), ShouldBeNil)
+			So(p.AddWithToken(token, []string{"low3"}), ShouldNotBeNil)
+			So(p.AddWithPriority(token, []string{"high2"}, HighPriority), ShouldBeNil)
+			So(<-dropped, ShouldEqual, "low1")
+			So(atomic.LoadInt64(&p.evicted), ShouldEqual, 1)
+			So(p.AddWithPriority(token, []string{"high3"}, HighPriority), ShouldBeNil)
+			So(<-dropped, ShouldEqual, "low2")
+			close(gate)
+			So(p.Close(time.Second), ShouldBeNil)
+			var order []string
+			for i := 0; i < 4; i++ {
+				order = append(order, <-emitted)
+			}
+			So(order, ShouldResemble, []string{"first", "high1", "high2", "high3"})
+			So(atomic.LoadInt64(&p.buffered), ShouldEqual, 0)
+		})
+		Convey("should reject high priority items once full of them", func() {
+			So(p.AddWithPriority(token, []string{"high2"}, HighPriority), ShouldBeNil)
+			So(p.AddWithPriority(token, []string{"high3"}, HighPriority), ShouldBeNil)
+			So(p.AddWithPriority(token, []string{"high4"}, HighPriority), ShouldNotBeNil)
+			So(atomic.LoadInt64(&p.evicted), ShouldEqual, 1)
+			close(gate)
+			So(p.Close(time.Second), ShouldBeNil)
+			So(atomic.LoadInt64(&p.buffered), ShouldEqual, 0)
+		})
+	})
+}
+
+func TestPipelinePriorityLanesMixed(t *testing.T) {
+	Convey("A pipeline with high priority data in its normal lane", t, func() {
+		gate := make(chan struct{})
+		emitting := make(chan struct{}, 10)
+		emitted := make(chan string, 10)
+		dropped := make(chan string, 10)
+		p := NewPipeline(&PipelineConfig[string]{
+			Name:               "log",
+			NumChannels:        1,
+			NumDrainingThreads: 1,
+			Buffer:             3,
+			PriorityBuffer:     1,
+			BatchSize:          1,
+			ErrorHandler:       func(error) error { return nil },
+			OnDropped: func(token Token, data []string, err error) {
+				dropped <- data[0]
+			},
+			NewEmitter: func() EmitFunc[string] {
+				return func(ctx context.Context, token Token, data []string) error {
+					emitting <- struct{}{}
+					<-gate
+					emitted <- data[0]
+					return nil
+				}
+			},
+		})
+		token := Token{Value: "abc"}
+		So(p.AddWithToken(token, []string{"first"}), ShouldBeNil)
+		<-emitting
+		// the priority lane is full, so high2 is queued ahead of the normal priority items
+		So(p.AddWithPriority(token, []string{"high1"}, HighPriority), ShouldBeNil)
+		So(p.AddWithPriority(token, []string{"high2"}, HighPriority), ShouldBeNil)
+		So(p.AddWithToken(token, []string{"low1"}), ShouldBeNil)
+		So(p.AddWithToken(token, []string{"low2"}), ShouldBeNil)
+
+		Convey("should evict the normal priority items behind high priority ones", func() {
+			So(p.AddWithPriority(token, []string{"high3"}, HighPriority), ShouldBeNil)
+			So(<-dropped, ShouldEqual, "low1")
+			So(p.AddWithPriority(token, []string{"high4"}, HighPriority), ShouldBeNil)
+			So(<-dropped, ShouldEqual, "low2")
+			So(p.AddWithPriority(token, []string{"high5"}, HighPriority), ShouldNotBeNil)
+			So(atomic.LoadInt64(&p.evicted), ShouldEqual, 2)
+			close(gate)
+			So(p.Close(time.Second), ShouldBeNil)
+			var order []string
+			for i := 0; i < 5; i++ {
+				order = append(order, <-emitted)
+			}
+			So(order, ShouldResemble, []string{"first", "high1", "high2", "high3", "high4"})
+			So(len(dropped), ShouldEqual, 0)
+			So(atomic.LoadInt64(&p.buffered), ShouldEqual, 0)
+		})
+		Convey("should keep the order of what it doesn't evict", func() {
+			So(p.AddWithPriority(token, []string{"high3"}, HighPriority), ShouldBeNil)
+			close(gate)
+			So(p.Close(time.Second), ShouldBeNil)
+			var order []string
+			for i := 0; i < 5; i++ {
+				order = append(order, <-emitted)
+			}
+			So(order, ShouldResemble, []string{"first", "high1", "high2", "low2", "high3"})
+			So(<-dropped, ShouldEqual, "low1")
+		})
+	})
+}
+
+func TestAsyncMultiTokenSinkPriorityLanes(t *testing.T) {
+	Convey("An AsyncMultiTokenSink with priority lanes", t, func() {
+		s := NewAsyncMultiTokenSink(1, 1, 5, 25, "", "", "", "", newDefaultHTTPClient, nil, 1, WithPriorityLanes(3))
+		So(s.datapoints.priorityLanes, ShouldBeTrue)
+		So(cap(s.datapoints.channels[0].priority), ShouldEqual, 3)
+		var evicted bool
+		for _, dp := range s.Datapoints() {
+			evicted = evicted || dp.Metric == "total_datapoints_evicted"
+		}
+		So(evicted, ShouldBeTrue)
+		s.ShutdownTimeout = time.Millisecond * 100
+		_ = s.AddDatapointsWithPriority("abc", []*datapoint.Datapoint{GaugeF("heartbeat", nil, 1)}, HighPriority)
+		_ = s.Close()
+	})
+}
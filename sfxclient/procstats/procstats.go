@@ -0,0 +1,155 @@
+// Package procstats collects stats about the process, and optionally the host it runs on, as datapoints, so
+// programs built on golib get basic telemetry by adding a Collector to their Scheduler.
+package procstats
+
+import (
+	"os"
+	"runtime"
+	"runtime/debug"
+	"sync"
+
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/load"
+	"github.com/shirou/gopsutil/v3/net"
+	"github.com/shirou/gopsutil/v3/process"
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/errors"
+	"github.com/signalfx/golib/v3/sfxclient"
+)
+
+// Map library functions to unexported package variables for testing purposes
+var (
+	newProcess     = process.NewProcess
+	loadAvg        = load.Avg
+	diskIOCounters = disk.IOCounters
+	netIOCounters  = net.IOCounters
+)
+
+// Collector is a sfxclient.Collector of the process's resident memory, open file descriptors, CPU time,
+// goroutines and garbage collection pauses, and, if IncludeHost is set, the host's load averages and the
+// IO of its disks and network interfaces.  Stats that can't be read are left out, after passing the error
+// to the ErrorHandler.
+type Collector struct {
+	// Dimensions are added to every datapoint
+	Dimensions map[string]string
+	// IncludeHost collects host stats too
+	IncludeHost bool
+	// ErrorHandler is called when a stat can't be read
+	ErrorHandler func(error) error
+
+	once sync.Once
+	proc *process.Process
+	err  error
+}
+
+var _ sfxclient.Collector = &Collector{}
+
+// New creates a Collector of the process's stats
+func New(dimensions map[string]string) *Collector {
+	return &Collector{
+		Dimensions:   dimensions,
+		ErrorHandler: sfxclient.DefaultErrorHandler,
+	}
+}
+
+// NewWithHost creates a Collector of the process's and the host's stats
+func NewWithHost(dimensions map[string]string) *Collector {
+	c := New(dimensions)
+	c.IncludeHost = true
+	return c
+}
+
+func (c *Collector) handle(err error, msg string) {
+	if c.ErrorHandler != nil {
+		_ = c.ErrorHandler(errors.Annotate(err, msg))
+	}
+}
+
+// Datapoints returns the process's stats, and the host's if IncludeHost is set
+func (c *Collector) Datapoints() []*datapoint.Datapoint {
+	dps := c.processDatapoints()
+	if c.IncludeHost {
+		dps = c.hostDatapoints(dps)
+	}
+	return dps
+}
+
+func (c *Collector) processDatapoints() []*datapoint.Datapoint {
+	var gc debug.GCStats
+	debug.ReadGCStats(&gc)
+	dps := []*datapoint.Datapoint{
+		sfxclient.Gauge("process.goroutines", c.Dimensions, int64(runtime.NumGoroutine())),
+		sfxclient.Cumulative("process.gc.count", c.Dimensions, gc.NumGC),
+		sfxclient.Cumulative("process.gc.pause_total_ns", c.Dimensions, gc.PauseTotal.Nanoseconds()),
+	}
+	if len(gc.Pause) > 0 {
+		dps = append(dps, sfxclient.Gauge("process.gc.last_pause_ns", c.Dimensions, gc.Pause[0].Nanoseconds()))
+	}
+	c.once.Do(func() {
+		c.proc, c.err = newProcess(int32(os.Getpid()))
+	})
+	if c.err != nil {
+		c.handle(c.err, "cannot find the process")
+		return dps
+	}
+	if mem, err := c.proc.MemoryInfo(); err != nil {
+		c.handle(err, "cannot read the process's memory")
+	} else {
+		dps = append(dps, sfxclient.Gauge("process.rss", c.Dimensions, int64(mem.RSS)))
+	}
+	if fds, err := c.proc.NumFDs(); err != nil {
+		c.handle(err, "cannot count the process's file descriptors")
+	} else {
+		dps = append(dps, sfxclient.Gauge("process.open_fds", c.Dimensions, int64(fds)))
+	}
+	if times, err := c.proc.Times(); err != nil {
+		c.handle(err, "cannot read the process's CPU time")
+	} else {
+		dps = append(dps,
+			sfxclient.CumulativeF("process.cpu.user_seconds", c.Dimensions, times.User),
+			sfxclient.CumulativeF("process.cpu.system_seconds", c.Dimensions, times.System),
+		)
+	}
+	return dps
+}
+
+func (c *Collector) hostDatapoints(dps []*datapoint.Datapoint) []*datapoint.Datapoint {
+	if avg, err := loadAvg(); err != nil {
+		c.handle(err, "cannot read the load average")
+	} else {
+		dps = append(dps,
+			sfxclient.GaugeF("host.load.1", c.Dimensions, avg.Load1),
+			sfxclient.GaugeF("host.load.5", c.Dimensions, avg.Load5),
+			sfxclient.GaugeF("host.load.15", c.Dimensions, avg.Load15),
+		)
+	}
+	if disks, err := diskIOCounters(); err != nil {
+		c.handle(err, "cannot read disk IO")
+	} else {
+		for name, d := range disks {
+			dims := datapoint.AddMaps(c.Dimensions, map[string]string{"device": name})
+			dps = append(dps,
+				sfxclient.Cumulative("host.disk.reads", dims, int64(d.ReadCount)),
+				sfxclient.Cumulative("host.disk.writes", dims, int64(d.WriteCount)),
+				sfxclient.Cumulative("host.disk.read_bytes", dims, int64(d.ReadBytes)),
+				sfxclient.Cumulative("host.disk.write_bytes", dims, int64(d.WriteBytes)),
+			)
+		}
+	}
+	if interfaces, err := netIOCounters(true); err != nil {
+		c.handle(err, "cannot read network IO")
+	} else {
+		for _, n := range interfaces {
+			dims := datapoint.AddMaps(c.Dimensions, map[string]string{"interface": n.Name})
+			dps = append(dps,
+				sfxclient.Cumulative("host.net.bytes_sent", dims, int64(n.BytesSent)),
+				sfxclient.Cumulative("host.net.bytes_recv", dims, int64(n.BytesRecv)),
+				sfxclient.Cumulative("host.net.packets_sent", dims, int64(n.PacketsSent)),
+				sfxclient.Cumulative("host.net.packets_recv", dims, int64(n.PacketsRecv)),
+				sfxclient.Cumulative("host.net.errors_in", dims, int64(n.Errin)),
+				sfxclient.Cumulative("host.net.errors_out", dims, int64(n.Errout)),
+			)
+		}
+	}
+	return dps
+}
@@ -0,0 +1,99 @@
+package procstats
+
+import (
+	"testing"
+
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/load"
+	"github.com/shirou/gopsutil/v3/net"
+	"github.com/shirou/gopsutil/v3/process"
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func findDatapoint(dps []*datapoint.Datapoint, metric string, dims map[string]string) *datapoint.Datapoint {
+	for _, dp := range dps {
+		if dp.Metric != metric {
+			continue
+		}
+		matches := true
+		for k, v := range dims {
+			matches = matches && dp.Dimensions[k] == v
+		}
+		if matches {
+			return dp
+		}
+	}
+	return nil
+}
+
+func TestCollector(t *testing.T) {
+	Convey("a process stats collector", t, func() {
+		var handled []error
+		c := New(map[string]string{"app": "test"})
+		c.ErrorHandler = func(err error) error {
+			handled = append(handled, err)
+			return nil
+		}
+		Convey("should collect the process's stats", func() {
+			dps := c.Datapoints()
+			So(handled, ShouldBeEmpty)
+			goroutines := findDatapoint(dps, "process.goroutines", nil)
+			So(goroutines.Dimensions, ShouldResemble, map[string]string{"app": "test"})
+			So(goroutines.Value.(datapoint.IntValue).Int(), ShouldBeGreaterThan, 0)
+			So(findDatapoint(dps, "process.rss", nil).Value.(datapoint.IntValue).Int(), ShouldBeGreaterThan, 0)
+			So(findDatapoint(dps, "process.open_fds", nil).Value.(datapoint.IntValue).Int(), ShouldBeGreaterThan, 0)
+			So(findDatapoint(dps, "process.cpu.user_seconds", nil).MetricType, ShouldEqual, datapoint.Counter)
+			So(findDatapoint(dps, "process.gc.pause_total_ns", nil).MetricType, ShouldEqual, datapoint.Counter)
+			So(findDatapoint(dps, "host.load.1", nil), ShouldBeNil)
+		})
+		Convey("should collect the host's stats if asked", func() {
+			defer func(l func() (*load.AvgStat, error), d func(...string) (map[string]disk.IOCountersStat, error), n func(bool) ([]net.IOCountersStat, error)) {
+				loadAvg, diskIOCounters, netIOCounters = l, d, n
+			}(loadAvg, diskIOCounters, netIOCounters)
+			loadAvg = func() (*load.AvgStat, error) {
+				return &load.AvgStat{Load1: 1.5, Load5: 1, Load15: 0.5}, nil
+			}
+			diskIOCounters = func(...string) (map[string]disk.IOCountersStat, error) {
+				return map[string]disk.IOCountersStat{"sda": {ReadBytes: 100}}, nil
+			}
+			netIOCounters = func(bool) ([]net.IOCountersStat, error) {
+				return []net.IOCountersStat{{Name: "eth0", BytesSent: 7}}, nil
+			}
+			c.IncludeHost = true
+			dps := c.Datapoints()
+			So(findDatapoint(dps, "host.load.1", nil).Value, ShouldResemble, datapoint.NewFloatValue(1.5))
+			readBytes := findDatapoint(dps, "host.disk.read_bytes", map[string]string{"device": "sda"})
+			So(readBytes.Value, ShouldResemble, datapoint.NewIntValue(100))
+			So(readBytes.Dimensions, ShouldResemble, map[string]string{"app": "test", "device": "sda"})
+			So(findDatapoint(dps, "host.net.bytes_sent", map[string]string{"interface": "eth0"}).Value, ShouldResemble, datapoint.NewIntValue(7))
+			Convey("leaving out what can't be read", func() {
+				errBad := errors.New("bad")
+				loadAvg = func() (*load.AvgStat, error) {
+					return nil, errBad
+				}
+				So(findDatapoint(c.Datapoints(), "host.load.1", nil), ShouldBeNil)
+				So(len(handled), ShouldEqual, 1)
+				So(errors.Cause(handled[0]), ShouldEqual, errBad)
+			})
+		})
+		Convey("should report not finding the process", func() {
+			defer func(f func(int32) (*process.Process, error)) {
+				newProcess = f
+			}(newProcess)
+			errBad := errors.New("no process")
+			newProcess = func(int32) (*process.Process, error) {
+				return nil, errBad
+			}
+			dps := c.Datapoints()
+			So(findDatapoint(dps, "process.goroutines", nil), ShouldNotBeNil)
+			So(findDatapoint(dps, "process.rss", nil), ShouldBeNil)
+			So(len(handled), ShouldEqual, 1)
+			So(errors.Cause(handled[0]), ShouldEqual, errBad)
+		})
+		Convey("should include the host when made with it", func() {
+			So(NewWithHost(nil).IncludeHost, ShouldBeTrue)
+		})
+	})
+}
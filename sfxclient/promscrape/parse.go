@@ -0,0 +1,228 @@
+// Package promscrape scrapes Prometheus /metrics endpoints and converts what it finds into datapoints,
+// making golib a lightweight bridge from Prometheus instrumented processes to any sfxclient.Sink.
+package promscrape
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/signalfx/golib/v3/errors"
+)
+
+// Type is the type of a metric family
+type Type string
+
+// The Prometheus metric types
+const (
+	Counter   Type = "counter"
+	Gauge     Type = "gauge"
+	Histogram Type = "histogram"
+	Summary   Type = "summary"
+	Untyped   Type = "untyped"
+)
+
+// Family is the samples of one metric
+type Family struct {
+	Name    string
+	Help    string
+	Type    Type
+	Samples []*Sample
+}
+
+// Sample is one line of the exposition format.  Histograms and summaries have samples named after the
+// family with a _bucket, _sum or _count suffix.
+type Sample struct {
+	Name   string
+	Labels map[string]string
+	Value  float64
+	// Timestamp is zero when the sample doesn't have one
+	Timestamp time.Time
+}
+
+// maxLineLength bounds each line of the exposition format
+const maxLineLength = 1 << 20
+
+// Parse reads families in the Prometheus text exposition format, in the order they first appear
+func Parse(r io.Reader) ([]*Family, error) {
+	p := parser{byName: make(map[string]*Family)}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 4096), maxLineLength)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if err := p.parseLine(strings.TrimSpace(scanner.Text())); err != nil {
+			return nil, errors.Annotatef(err, "line %d", line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Annotate(err, "cannot read metrics")
+	}
+	return p.families, nil
+}
+
+type parser struct {
+	families []*Family
+	byName   map[string]*Family
+}
+
+func (p *parser) family(name string) *Family {
+	f, exists := p.byName[name]
+	if !exists {
+		f = &Family{Name: name, Type: Untyped}
+		p.byName[name] = f
+		p.families = append(p.families, f)
+	}
+	return f
+}
+
+// familyOf finds the family a sample belongs to, stripping the suffixes histograms and summaries use
+func (p *parser) familyOf(sample string) *Family {
+	if f, exists := p.byName[sample]; exists {
+		return f
+	}
+	for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+		if !strings.HasSuffix(sample, suffix) {
+			continue
+		}
+		f, exists := p.byName[strings.TrimSuffix(sample, suffix)]
+		if exists && (f.Type == Histogram || (f.Type == Summary && suffix != "_bucket")) {
+			return f
+		}
+	}
+	return p.family(sample)
+}
+
+func (p *parser) parseLine(line string) error {
+	if line == "" {
+		return nil
+	}
+	if line[0] == '#' {
+		return p.parseComment(line)
+	}
+	s, err := parseSample(line)
+	if err != nil {
+		return err
+	}
+	f := p.familyOf(s.Name)
+	f.Samples = append(f.Samples, s)
+	return nil
+}
+
+// parseComment handles # HELP and # TYPE lines, ignoring other comments
+func (p *parser) parseComment(line string) error {
+	fields := strings.SplitN(strings.TrimSpace(line[1:]), " ", 3)
+	if len(fields) < 2 || (fields[0] != "HELP" && fields[0] != "TYPE") {
+		return nil
+	}
+	f := p.family(fields[1])
+	rest := ""
+	if len(fields) == 3 {
+		rest = strings.TrimSpace(fields[2])
+	}
+	if fields[0] == "HELP" {
+		f.Help = strings.NewReplacer(`\\`, `\`, `\n`, "\n").Replace(rest)
+		return nil
+	}
+	switch t := Type(rest); t {
+	case Counter, Gauge, Histogram, Summary, Untyped:
+		f.Type = t
+		return nil
+	default:
+		return errors.Errorf("unknown type %q for %s", rest, f.Name)
+	}
+}
+
+func parseSample(line string) (*Sample, error) {
+	end := strings.IndexAny(line, "{ \t")
+	if end <= 0 {
+		return nil, errors.Errorf("sample %q has no value", line)
+	}
+	s := &Sample{Name: line[:end], Labels: map[string]string{}}
+	rest := line[end:]
+	if rest[0] == '{' {
+		var err error
+		if rest, err = parseLabels(rest[1:], s.Labels); err != nil {
+			return nil, err
+		}
+	}
+	fields := strings.Fields(rest)
+	if len(fields) == 0 || len(fields) > 2 {
+		return nil, errors.Errorf("sample %s needs a value and optional timestamp", s.Name)
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return nil, errors.Annotatef(err, "invalid value for %s", s.Name)
+	}
+	s.Value = value
+	if len(fields) == 2 {
+		ms, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, errors.Annotatef(err, "invalid timestamp for %s", s.Name)
+		}
+		s.Timestamp = time.Unix(0, ms*int64(time.Millisecond))
+	}
+	return s, nil
+}
+
+// parseLabels parses name="value" pairs up to the closing brace into labels, returning what follows it
+func parseLabels(s string, labels map[string]string) (string, error) {
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if s == "" {
+			return "", errors.New("unterminated labels")
+		}
+		if s[0] == '}' {
+			return s[1:], nil
+		}
+		eq := strings.IndexByte(s, '=')
+		if eq <= 0 {
+			return "", errors.Errorf("invalid label in %q", s)
+		}
+		name := strings.TrimSpace(s[:eq])
+		s = strings.TrimLeft(s[eq+1:], " \t")
+		if s == "" || s[0] != '"' {
+			return "", errors.Errorf("label %s has an unquoted value", name)
+		}
+		value, n, err := parseQuoted(s[1:])
+		if err != nil {
+			return "", errors.Annotatef(err, "label %s", name)
+		}
+		labels[name] = value
+		s = strings.TrimLeft(s[1+n:], " \t")
+		if strings.HasPrefix(s, ",") {
+			s = s[1:]
+		}
+	}
+}
+
+// parseQuoted unescapes the label value at the start of s, returning it and the bytes used, including the
+// closing quote
+func parseQuoted(s string) (string, int, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"':
+			return b.String(), i + 1, nil
+		case '\\':
+			i++
+			if i == len(s) {
+				return "", 0, errors.New("unterminated escape")
+			}
+			switch s[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case '\\', '"':
+				b.WriteByte(s[i])
+			default:
+				b.WriteByte('\\')
+				b.WriteByte(s[i])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", 0, errors.New("unterminated value")
+}
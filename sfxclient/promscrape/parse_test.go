@@ -0,0 +1,100 @@
+package promscrape
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const exposition = `# HELP http_requests_total The total number of HTTP requests.
+# TYPE http_requests_total counter
+http_requests_total{method="post",code="200"} 1027 1395066363000
+http_requests_total{method="post",code="400"}    3 1395066363000
+
+# A normal comment
+msdos_file_access_time_seconds{path="C:\\DIR\\FILE.TXT",error="Cannot find file:\n\"FILE.TXT\""} 1.458255915e9
+metric_without_timestamp_and_labels 12.47
+# TYPE temperature gauge
+temperature{ room = "a" , } -Inf
+
+# HELP http_request_duration_seconds A histogram of the request duration.
+# TYPE http_request_duration_seconds histogram
+http_request_duration_seconds_bucket{le="0.05"} 24054
+http_request_duration_seconds_bucket{le="+Inf"} 144320
+http_request_duration_seconds_sum 53423
+http_request_duration_seconds_count 144320
+
+# TYPE rpc_duration_seconds summary
+rpc_duration_seconds{quantile="0.5"} 4773
+rpc_duration_seconds{quantile="0.99"} NaN
+rpc_duration_seconds_sum 1.7560473e+07
+rpc_duration_seconds_count 2693
+`
+
+func TestParse(t *testing.T) {
+	Convey("parsing the text exposition format", t, func() {
+		families, err := Parse(strings.NewReader(exposition))
+		So(err, ShouldBeNil)
+		So(len(families), ShouldEqual, 6)
+
+		Convey("should read counters with labels and timestamps", func() {
+			f := families[0]
+			So(f.Name, ShouldEqual, "http_requests_total")
+			So(f.Help, ShouldEqual, "The total number of HTTP requests.")
+			So(f.Type, ShouldEqual, Counter)
+			So(len(f.Samples), ShouldEqual, 2)
+			So(f.Samples[0].Labels, ShouldResemble, map[string]string{"method": "post", "code": "200"})
+			So(f.Samples[0].Value, ShouldEqual, 1027)
+			So(f.Samples[0].Timestamp.Equal(time.Unix(1395066363, 0)), ShouldBeTrue)
+			So(f.Samples[1].Value, ShouldEqual, 3)
+		})
+		Convey("should unescape label values and default to untyped", func() {
+			f := families[1]
+			So(f.Type, ShouldEqual, Untyped)
+			So(f.Samples[0].Labels, ShouldResemble, map[string]string{"path": `C:\DIR\FILE.TXT`, "error": "Cannot find file:\n\"FILE.TXT\""})
+			So(f.Samples[0].Timestamp.IsZero(), ShouldBeTrue)
+			So(families[2].Samples[0].Labels, ShouldBeEmpty)
+			So(families[2].Samples[0].Value, ShouldEqual, 12.47)
+		})
+		Convey("should allow spaces and trailing commas in labels", func() {
+			So(families[3].Samples[0].Labels, ShouldResemble, map[string]string{"room": "a"})
+			So(math.IsInf(families[3].Samples[0].Value, -1), ShouldBeTrue)
+		})
+		Convey("should group histogram and summary samples", func() {
+			So(families[4].Type, ShouldEqual, Histogram)
+			So(len(families[4].Samples), ShouldEqual, 4)
+			So(families[4].Samples[1].Labels["le"], ShouldEqual, "+Inf")
+			So(families[5].Type, ShouldEqual, Summary)
+			So(len(families[5].Samples), ShouldEqual, 4)
+			So(math.IsNaN(families[5].Samples[1].Value), ShouldBeTrue)
+		})
+	})
+	Convey("parsing invalid input should fail", t, func() {
+		for _, input := range []string{
+			"# TYPE a exotic",
+			"a",
+			"a b",
+			"a 1 b",
+			"a 1 2 3",
+			"{a=\"b\"} 1",
+			"a{b} 1",
+			"a{b=c} 1",
+			"a{b=\"c} 1",
+			"a{b=\"c\\",
+			"a{b=\"c\"",
+			strings.Repeat("a", maxLineLength+1),
+		} {
+			_, err := Parse(strings.NewReader(input))
+			So(err, ShouldNotBeNil)
+		}
+	})
+	Convey("unknown escapes and comments should be kept or ignored", t, func() {
+		families, err := Parse(strings.NewReader("#\n# TYPE\n# HELP a\na{b=\"\\t\"} 1\n"))
+		So(err, ShouldBeNil)
+		So(families[0].Type, ShouldEqual, Untyped)
+		So(families[0].Samples[0].Labels["b"], ShouldEqual, `\t`)
+	})
+}
@@ -0,0 +1,184 @@
+package promscrape
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/errors"
+	"github.com/signalfx/golib/v3/sfxclient"
+	"github.com/signalfx/golib/v3/timekeeper"
+)
+
+// DefaultInterval is how often a Scraper scrapes by default
+const DefaultInterval = time.Second * 10
+
+// maxBodyBytes bounds how much of a /metrics response is read
+const maxBodyBytes = 64 << 20
+
+// Converter turns families into datapoints
+type Converter struct {
+	// Prefix is prepended to every metric name
+	Prefix string
+	// Dimensions are added to every datapoint.  Labels of the same name win.
+	Dimensions map[string]string
+	// LabelToDimension maps a label name to the dimension to send it as.  Returning "" drops the label.  Nil
+	// sends labels unchanged
+	LabelToDimension func(label string) string
+}
+
+// Convert turns families into datapoints.  Counters and the _bucket, _sum and _count samples of histograms
+// and summaries become cumulative counters, keeping the le label of buckets.  Gauges, untyped metrics and
+// summary quantiles become gauges.  NaN and infinite values, which SignalFx can't store, are dropped.
+func (c *Converter) Convert(families []*Family) []*datapoint.Datapoint {
+	var dps []*datapoint.Datapoint
+	for _, f := range families {
+		for _, s := range f.Samples {
+			if math.IsNaN(s.Value) || math.IsInf(s.Value, 0) {
+				continue
+			}
+			mt := datapoint.Gauge
+			switch {
+			case f.Type == Counter:
+				mt = datapoint.Counter
+			case f.Type == Histogram || f.Type == Summary:
+				if s.Name != f.Name {
+					mt = datapoint.Counter
+				}
+			}
+			dps = append(dps, datapoint.New(c.Prefix+s.Name, c.dimensions(s.Labels), datapoint.NewFloatValue(s.Value), mt, s.Timestamp))
+		}
+	}
+	return dps
+}
+
+func (c *Converter) dimensions(labels map[string]string) map[string]string {
+	dims := make(map[string]string, len(c.Dimensions)+len(labels))
+	for k, v := range c.Dimensions {
+		dims[k] = v
+	}
+	for k, v := range labels {
+		if c.LabelToDimension != nil {
+			if k = c.LabelToDimension(k); k == "" {
+				continue
+			}
+		}
+		dims[k] = v
+	}
+	return dims
+}
+
+// Scraper scrapes a Prometheus endpoint on an interval, adding what it finds to a Sink.  It is also a
+// Collector of stats about itself.
+type Scraper struct {
+	Converter
+	// URL is the endpoint to scrape, like http://localhost:9100/metrics
+	URL    string
+	Client *http.Client
+	Sink   sfxclient.Sink
+	// Interval is how often Run scrapes
+	Interval time.Duration
+	Timer    timekeeper.TimeKeeper
+	// ErrorHandler is called when a scrape fails.  Run stops if it returns an error
+	ErrorHandler func(error) error
+
+	stats struct {
+		scrapes    int64
+		errors     int64
+		datapoints int64
+	}
+}
+
+var _ sfxclient.Collector = &Scraper{}
+
+// New creates a scraper of url that adds datapoints to sink every DefaultInterval
+func New(url string, sink sfxclient.Sink) *Scraper {
+	return &Scraper{
+		URL: url,
+		Client: &http.Client{
+			Timeout: sfxclient.DefaultTimeout,
+		},
+		Sink:         sink,
+		Interval:     DefaultInterval,
+		Timer:        timekeeper.RealTime{},
+		ErrorHandler: sfxclient.DefaultErrorHandler,
+	}
+}
+
+// Datapoints returns stats about the scraper
+func (s *Scraper) Datapoints() []*datapoint.Datapoint {
+	return []*datapoint.Datapoint{
+		sfxclient.Cumulative("total_prometheus_scrapes", s.Dimensions, atomic.LoadInt64(&s.stats.scrapes)),
+		sfxclient.Cumulative("total_prometheus_scrape_errors", s.Dimensions, atomic.LoadInt64(&s.stats.errors)),
+		sfxclient.Cumulative("total_prometheus_datapoints", s.Dimensions, atomic.LoadInt64(&s.stats.datapoints)),
+	}
+}
+
+// Scrape fetches and converts the endpoint once
+func (s *Scraper) Scrape(ctx context.Context) ([]*datapoint.Datapoint, error) {
+	atomic.AddInt64(&s.stats.scrapes, 1)
+	families, err := s.fetch(ctx)
+	if err != nil {
+		atomic.AddInt64(&s.stats.errors, 1)
+		return nil, errors.Annotatef(err, "cannot scrape %s", s.URL)
+	}
+	dps := s.Convert(families)
+	atomic.AddInt64(&s.stats.datapoints, int64(len(dps)))
+	return dps, nil
+}
+
+func (s *Scraper) fetch(ctx context.Context) ([]*Family, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/plain;version=0.0.4")
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("invalid status code %d", resp.StatusCode)
+	}
+	return Parse(io.LimitReader(resp.Body, maxBodyBytes))
+}
+
+// ScrapeOnce scrapes the endpoint and adds what it finds to the Sink
+func (s *Scraper) ScrapeOnce(ctx context.Context) error {
+	dps, err := s.Scrape(ctx)
+	if err != nil {
+		return err
+	}
+	if len(dps) == 0 {
+		return nil
+	}
+	return errors.Annotate(s.Sink.AddDatapoints(ctx, dps), "cannot add scraped datapoints")
+}
+
+// Run scrapes every Interval until ctx is done or the ErrorHandler returns an error.  This is intended to
+// be run inside a goroutine.
+func (s *Scraper) Run(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return errors.Annotate(ctx.Err(), "context closed")
+		case <-s.Timer.After(s.Interval):
+			if err := s.ScrapeOnce(ctx); err != nil {
+				if err2 := errors.Annotate(s.ErrorHandler(err), "error handler returned an error"); err2 != nil {
+					return err2
+				}
+			}
+		}
+	}
+}
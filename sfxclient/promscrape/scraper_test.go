@@ -0,0 +1,150 @@
+package promscrape
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/errors"
+	"github.com/signalfx/golib/v3/timekeeper/timekeepertest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type captureSink struct {
+	mu  sync.Mutex
+	dps []*datapoint.Datapoint
+	err error
+}
+
+func (c *captureSink) AddDatapoints(ctx context.Context, points []*datapoint.Datapoint) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dps = append(c.dps, points...)
+	return c.err
+}
+
+func (c *captureSink) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.dps)
+}
+
+func find(dps []*datapoint.Datapoint, metric string, dims map[string]string) *datapoint.Datapoint {
+	for _, dp := range dps {
+		if dp.Metric != metric {
+			continue
+		}
+		matches := true
+		for k, v := range dims {
+			if dp.Dimensions[k] != v {
+				matches = false
+			}
+		}
+		if matches {
+			return dp
+		}
+	}
+	return nil
+}
+
+func TestConverter(t *testing.T) {
+	Convey("converting families", t, func() {
+		families, err := Parse(strings.NewReader(exposition))
+		So(err, ShouldBeNil)
+		c := &Converter{
+			Prefix:     "prom.",
+			Dimensions: map[string]string{"host": "h", "code": "default"},
+			LabelToDimension: func(label string) string {
+				if label == "error" {
+					return ""
+				}
+				return "l_" + label
+			},
+		}
+		dps := c.Convert(families)
+		Convey("should map types", func() {
+			dp := find(dps, "prom.http_requests_total", map[string]string{"l_code": "400"})
+			So(dp.MetricType, ShouldEqual, datapoint.Counter)
+			So(dp.Value, ShouldResemble, datapoint.NewFloatValue(3))
+			So(dp.Dimensions, ShouldResemble, map[string]string{"host": "h", "code": "default", "l_code": "400", "l_method": "post"})
+			So(dp.Timestamp.Equal(time.Unix(1395066363, 0)), ShouldBeTrue)
+			So(find(dps, "prom.metric_without_timestamp_and_labels", nil).MetricType, ShouldEqual, datapoint.Gauge)
+			So(find(dps, "prom.http_request_duration_seconds_bucket", map[string]string{"l_le": "+Inf"}).MetricType, ShouldEqual, datapoint.Counter)
+			So(find(dps, "prom.http_request_duration_seconds_sum", nil).MetricType, ShouldEqual, datapoint.Counter)
+			So(find(dps, "prom.rpc_duration_seconds", map[string]string{"l_quantile": "0.5"}).MetricType, ShouldEqual, datapoint.Gauge)
+			So(find(dps, "prom.rpc_duration_seconds_count", nil).MetricType, ShouldEqual, datapoint.Counter)
+		})
+		Convey("should drop labels and values SignalFx can't store", func() {
+			_, exists := find(dps, "prom.msdos_file_access_time_seconds", nil).Dimensions["error"]
+			So(exists, ShouldBeFalse)
+			So(find(dps, "prom.temperature", nil), ShouldBeNil)
+			So(find(dps, "prom.rpc_duration_seconds", map[string]string{"l_quantile": "0.99"}), ShouldBeNil)
+			So(len(dps), ShouldEqual, 11)
+		})
+	})
+}
+
+func TestScraper(t *testing.T) {
+	Convey("a scraper", t, func() {
+		status := http.StatusOK
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			rw.WriteHeader(status)
+			_, _ = rw.Write([]byte(exposition))
+		}))
+		defer server.Close()
+		sink := &captureSink{}
+		s := New(server.URL+"/metrics", sink)
+		ctx := context.Background()
+		Convey("should scrape into the sink", func() {
+			So(s.ScrapeOnce(ctx), ShouldBeNil)
+			So(sink.len(), ShouldEqual, 11)
+			stats := s.Datapoints()
+			So(stats[0].Value, ShouldResemble, datapoint.NewIntValue(1))
+			So(stats[1].Value, ShouldResemble, datapoint.NewIntValue(0))
+			So(stats[2].Value, ShouldResemble, datapoint.NewIntValue(11))
+		})
+		Convey("should report failures", func() {
+			status = http.StatusNotFound
+			So(s.ScrapeOnce(ctx).Error(), ShouldContainSubstring, "404")
+			So(s.Datapoints()[1].Value, ShouldResemble, datapoint.NewIntValue(1))
+			s.URL = "%gh&%ij"
+			So(s.ScrapeOnce(ctx), ShouldNotBeNil)
+			s.URL = "http://127.0.0.1:1/metrics"
+			s.Client = nil
+			So(s.ScrapeOnce(ctx), ShouldNotBeNil)
+		})
+		Convey("should report sink errors", func() {
+			sink.err = errors.New("nope")
+			So(s.ScrapeOnce(ctx).Error(), ShouldContainSubstring, "nope")
+		})
+		Convey("should run on an interval until told to stop", func() {
+			clock := timekeepertest.NewStubClock(time.Now())
+			s.Timer = clock
+			s.Interval = time.Minute
+			ctx, cancel := context.WithCancel(ctx)
+			done := make(chan error)
+			go func() {
+				done <- s.Run(ctx)
+			}()
+			for sink.len() < 22 {
+				clock.Incr(time.Minute)
+				time.Sleep(time.Millisecond)
+			}
+			cancel()
+			So(errors.Tail(<-done), ShouldEqual, context.Canceled)
+		})
+		Convey("should stop running if the error handler says so", func() {
+			status = http.StatusNotFound
+			s.Interval = time.Millisecond
+			s.ErrorHandler = func(err error) error {
+				return err
+			}
+			So(s.Run(ctx).Error(), ShouldContainSubstring, "404")
+		})
+	})
+}
@@ -0,0 +1,100 @@
+package sfxclient
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// DefaultMaxRetryAfter is the longest workers wait to retry a throttled batch by default
+const DefaultMaxRetryAfter = time.Second * 30
+
+// RetryPolicy is how pipeline workers retry a batch that failed to emit.  The number of retries is still
+// the MaxRetry the pipeline was created with.  Batches throttled with a Retry-After header are retried
+// after the time asked for, with or without a RetryPolicy.
+type RetryPolicy struct {
+	// InitialBackoff is how long to wait before the first retry.  Zero retries right away, as workers do
+	// without a RetryPolicy.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the wait between retries.  Zero means no cap.
+	MaxBackoff time.Duration
+	// Multiplier grows the wait after each retry.  Values below 1 keep it at InitialBackoff.
+	Multiplier float64
+	// Jitter randomizes each wait by up to this fraction of it, in either direction, so workers that
+	// failed together don't retry together
+	Jitter float64
+	// AttemptTimeout is the deadline of each attempt to emit a batch.  Zero means no deadline.
+	AttemptTimeout time.Duration
+	// MaxRetryAfter is the longest workers wait to retry a batch throttled with a 429 and a Retry-After
+	// header.  Batches asked to wait longer aren't retried.  Zero means DefaultMaxRetryAfter, and a negative
+	// value doesn't retry throttled batches.
+	MaxRetryAfter time.Duration
+	// Retryable decides if a batch that failed with err, and the HTTP status code found in err or -1, is
+	// retried.  Defaults to retrying timeouts and errors without a status code.
+	Retryable func(status int, err error) bool
+}
+
+// DefaultRetryPolicy backs off exponentially from 100ms up to 10s with 20% jitter
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		InitialBackoff: time.Millisecond * 100,
+		MaxBackoff:     time.Second * 10,
+		Multiplier:     2,
+		Jitter:         0.2,
+	}
+}
+
+// Backoff returns how long to wait before retry number attempt, counting from zero
+func (r *RetryPolicy) Backoff(attempt int) time.Duration {
+	if r == nil || r.InitialBackoff <= 0 {
+		return 0
+	}
+	backoff := float64(r.InitialBackoff)
+	for i := 0; i < attempt && r.Multiplier > 1; i++ {
+		backoff *= r.Multiplier
+		if r.MaxBackoff > 0 && backoff >= float64(r.MaxBackoff) {
+			break
+		}
+	}
+	if r.MaxBackoff > 0 && backoff > float64(r.MaxBackoff) {
+		backoff = float64(r.MaxBackoff)
+	}
+	if r.Jitter > 0 {
+		backoff += backoff * r.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(backoff)
+}
+
+// retryAfter returns how long err, from a throttled request, asks to wait before retrying.  It returns
+// false if err isn't from a throttled request or asks to wait longer than MaxRetryAfter.
+func (r *RetryPolicy) retryAfter(err error) (time.Duration, bool) {
+	var throttled *TooManyRequestError
+	if !errors.As(err, &throttled) || throttled.RetryAfter <= 0 {
+		return 0, false
+	}
+	maxWait := DefaultMaxRetryAfter
+	if r != nil && r.MaxRetryAfter != 0 {
+		maxWait = r.MaxRetryAfter
+	}
+	if throttled.RetryAfter > maxWait {
+		return 0, false
+	}
+	return throttled.RetryAfter, true
+}
+
+// retryable is true if a batch failing with err and status should be retried
+func (r *RetryPolicy) retryable(status int, err error) bool {
+	if r == nil || r.Retryable == nil {
+		return isRetryableStatus(status)
+	}
+	return r.Retryable(status, err)
+}
+
+// attemptContext returns the context of a single attempt to emit a batch
+func (r *RetryPolicy) attemptContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if r == nil || r.AttemptTimeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, r.AttemptTimeout)
+}
@@ -0,0 +1,195 @@
+package sfxclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	Convey("A retry policy", t, func() {
+		r := &RetryPolicy{InitialBackoff: time.Millisecond * 100, MaxBackoff: time.Second, Multiplier: 2}
+		Convey("should back off exponentially up to MaxBackoff", func() {
+			So(r.Backoff(0), ShouldEqual, time.Millisecond*100)
+			So(r.Backoff(1), ShouldEqual, time.Millisecond*200)
+			So(r.Backoff(3), ShouldEqual, time.Millisecond*800)
+			So(r.Backoff(4), ShouldEqual, time.Second)
+			So(r.Backoff(100), ShouldEqual, time.Second)
+		})
+		Convey("should jitter each backoff", func() {
+			r.Jitter = 0.5
+			for i := 0; i < 100; i++ {
+				So(r.Backoff(0), ShouldBeBetweenOrEqual, time.Millisecond*50, time.Millisecond*150)
+			}
+		})
+		Convey("should not back off without an InitialBackoff", func() {
+			So((&RetryPolicy{}).Backoff(3), ShouldEqual, 0)
+			So((*RetryPolicy)(nil).Backoff(3), ShouldEqual, 0)
+		})
+		Convey("should retry timeouts by default", func() {
+			So(r.retryable(http.StatusGatewayTimeout, errors.New("timeout")), ShouldBeTrue)
+			So(r.retryable(http.StatusBadRequest, errors.New("bad")), ShouldBeFalse)
+			So((*RetryPolicy)(nil).retryable(-1, errors.New("unknown")), ShouldBeTrue)
+		})
+		Convey("should use Retryable when set", func() {
+			r.Retryable = func(status int, err error) bool {
+				return status == http.StatusServiceUnavailable
+			}
+			So(r.retryable(http.StatusServiceUnavailable, errors.New("unavailable")), ShouldBeTrue)
+			So(r.retryable(http.StatusGatewayTimeout, errors.New("timeout")), ShouldBeFalse)
+		})
+		Convey("should give each attempt a deadline", func() {
+			r.AttemptTimeout = time.Minute
+			ctx, cancel := r.attemptContext(context.Background())
+			defer cancel()
+			_, hasDeadline := ctx.Deadline()
+			So(hasDeadline, ShouldBeTrue)
+			ctx, cancel = (*RetryPolicy)(nil).attemptContext(context.Background())
+			defer cancel()
+			_, hasDeadline = ctx.Deadline()
+			So(hasDeadline, ShouldBeFalse)
+		})
+	})
+}
+
+func newRetryPipeline(retry *RetryPolicy, emitErr error) (*Pipeline[string], chan time.Time) {
+	attempts := make(chan time.Time, 100)
+	p := NewPipeline(&PipelineConfig[string]{
+		Name:               "log",
+		NumChannels:        1,
+		NumDrainingThreads: 1,
+		Buffer:             10,
+		BatchSize:          10,
+		MaxRetry:           3,
+		Retry:              retry,
+		ErrorHandler:       func(error) error { return nil },
+		NewEmitter: func() EmitFunc[string] {
+			return func(ctx context.Context, token Token, data []string) error {
+				if _, hasDeadline := ctx.Deadline(); !hasDeadline && retry != nil && retry.AttemptTimeout > 0 {
+					return errors.New("attempt has no deadline")
+				}
+				attempts <- time.Now()
+				return emitErr
+			}
+		},
+	})
+	return p, attempts
+}
+
+func TestPipelineRetryPolicy(t *testing.T) {
+	Convey("A pipeline with a retry policy", t, func() {
+		timeout := &SFXAPIError{StatusCode: http.StatusGatewayTimeout}
+		Convey("should wait between retries", func() {
+			p, attempts := newRetryPipeline(&RetryPolicy{InitialBackoff: time.Millisecond * 20, Multiplier: 2, AttemptTimeout: time.Second}, timeout)
+			So(p.AddWithToken(Token{Value: "abc"}, []string{"a"}), ShouldBeNil)
+			var times []time.Time
+			for i := 0; i < 4; i++ {
+				times = append(times, <-attempts)
+			}
+			So(p.Close(time.Second), ShouldBeNil)
+			So(times[1].Sub(times[0]), ShouldBeGreaterThanOrEqualTo, time.Millisecond*20)
+			So(times[2].Sub(times[1]), ShouldBeGreaterThanOrEqualTo, time.Millisecond*40)
+			So(times[3].Sub(times[2]), ShouldBeGreaterThanOrEqualTo, time.Millisecond*80)
+		})
+		Convey("should only retry what Retryable allows", func() {
+			p, attempts := newRetryPipeline(&RetryPolicy{Retryable: func(int, error) bool { return false }}, timeout)
+			So(p.AddWithToken(Token{Value: "abc"}, []string{"a"}), ShouldBeNil)
+			<-attempts
+			So(p.Close(time.Second), ShouldBeNil)
+			So(len(attempts), ShouldEqual, 0)
+		})
+		Convey("should stop backing off once Close stops waiting", func() {
+			p, attempts := newRetryPipeline(&RetryPolicy{InitialBackoff: time.Hour}, timeout)
+			So(p.AddWithToken(Token{Value: "abc"}, []string{"a"}), ShouldBeNil)
+			<-attempts
+			start := time.Now()
+			So(p.Close(time.Millisecond*100), ShouldNotBeNil)
+			So(time.Since(start), ShouldBeLessThan, time.Second)
+		})
+		Convey("should keep retrying while it drains", func() {
+			gate := make(chan struct{})
+			emitting := make(chan struct{}, 10)
+			var calls int64
+			p := NewPipeline(&PipelineConfig[string]{
+				Name:               "log",
+				NumChannels:        1,
+				NumDrainingThreads: 1,
+				Buffer:             10,
+				BatchSize:          1,
+				MaxRetry:           3,
+				Retry:              &RetryPolicy{InitialBackoff: time.Millisecond * 20},
+				ErrorHandler:       func(error) error { return nil },
+				NewEmitter: func() EmitFunc[string] {
+					return func(ctx context.Context, token Token, data []string) error {
+						switch atomic.AddInt64(&calls, 1) {
+						case 1:
+							emitting <- struct{}{}
+							<-gate
+						case 2:
+							return timeout
+						}
+						return nil
+					}
+				},
+			})
+			// the second batch waits in the channel until the pipeline is closing, then fails once
+			So(p.AddWithToken(Token{Value: "abc"}, []string{"a"}), ShouldBeNil)
+			<-emitting
+			So(p.AddWithToken(Token{Value: "abc"}, []string{"b"}), ShouldBeNil)
+			p.stop()
+			close(gate)
+			So(p.wait(time.After(time.Second*5)), ShouldEqual, 0)
+			So(atomic.LoadInt64(&calls), ShouldEqual, 3)
+			p.stopStats()
+		})
+	})
+}
+
+func TestAsyncMultiTokenSinkRetryPolicy(t *testing.T) {
+	Convey("An AsyncMultiTokenSink should pass its retry policy to its pipelines", t, func() {
+		policy := DefaultRetryPolicy()
+		s := NewAsyncMultiTokenSink(1, 1, 5, 25, "", "", "", "", newDefaultHTTPClient, nil, 1, WithRetryPolicy(policy))
+		So(s.datapoints.retry, ShouldEqual, policy)
+		So(s.events.retry, ShouldEqual, policy)
+		So(s.spans.retry, ShouldEqual, policy)
+		So(s.Close(), ShouldBeNil)
+	})
+}
+
+func TestRetryAfter(t *testing.T) {
+	Convey("Retrying throttled batches", t, func() {
+		throttled := &TooManyRequestError{RetryAfter: time.Second, Err: &SFXAPIError{StatusCode: http.StatusTooManyRequests}}
+		Convey("should wait as long as the response asks", func() {
+			wait, ok := (*RetryPolicy)(nil).retryAfter(throttled)
+			So(ok, ShouldBeTrue)
+			So(wait, ShouldEqual, time.Second)
+		})
+		Convey("should give up if asked to wait too long", func() {
+			_, ok := (&RetryPolicy{MaxRetryAfter: time.Millisecond}).retryAfter(throttled)
+			So(ok, ShouldBeFalse)
+			_, ok = (&RetryPolicy{MaxRetryAfter: -1}).retryAfter(throttled)
+			So(ok, ShouldBeFalse)
+		})
+		Convey("should ignore other errors", func() {
+			_, ok := (*RetryPolicy)(nil).retryAfter(&SFXAPIError{StatusCode: http.StatusTooManyRequests})
+			So(ok, ShouldBeFalse)
+		})
+		Convey("should happen in pipelines", func() {
+			throttled.RetryAfter = time.Millisecond * 30
+			p, attempts := newRetryPipeline(nil, throttled)
+			So(p.AddWithToken(Token{Value: "abc"}, []string{"a"}), ShouldBeNil)
+			first := <-attempts
+			second := <-attempts
+			So(second.Sub(first), ShouldBeGreaterThanOrEqualTo, time.Millisecond*30)
+			<-attempts
+			<-attempts
+			So(p.Close(time.Second), ShouldBeNil)
+			So(atomic.LoadInt64(&p.retries), ShouldEqual, 3)
+		})
+	})
+}
@@ -46,6 +46,9 @@ type RollingBucket struct {
 	Timer timekeeper.TimeKeeper
 	// IncludeSum turns on Sum and SumOfSquares
 	IncludeSum bool
+	// MaxExemplars is how many of the values added with AddWithExemplar each window samples to attach to
+	// its min, max and quantiles.  If zero, DefaultMaxExemplars are.
+	MaxExemplars int
 
 	// Inclusive
 	bucketStartTime time.Time
@@ -58,6 +61,8 @@ type RollingBucket struct {
 	min          float64
 	max          float64
 
+	exemplars exemplarSample
+
 	pointsToFlush []*datapoint.Datapoint
 	mu            sync.Mutex
 }
@@ -92,6 +97,8 @@ func (r *RollingBucket) flushPoints() []*datapoint.Datapoint {
 		for _, dp := range pointsToFlush {
 			dp.Timestamp = r.bucketEndTime
 		}
+		r.exemplars.attach(pointsToFlush)
+		r.exemplars.reset()
 		r.Hist.Reset()
 		return pointsToFlush
 	}
@@ -177,6 +184,25 @@ func (r *RollingBucket) Add(v float64) {
 // AddAt is like Add but also takes a time to pretend the value comes at.
 func (r *RollingBucket) AddAt(v float64, t time.Time) {
 	r.mu.Lock()
+	r.add(v, t)
+	r.mu.Unlock()
+}
+
+// AddWithExemplar is like Add, but the value was observed in the span spanID of the trace traceID.  The
+// quantiles of the window are reported with the exemplar of a value near them.
+func (r *RollingBucket) AddWithExemplar(v float64, traceID string, spanID string) {
+	r.AddAtWithExemplar(v, r.Timer.Now(), traceID, spanID)
+}
+
+// AddAtWithExemplar is like AddWithExemplar but also takes a time to pretend the value comes at.
+func (r *RollingBucket) AddAtWithExemplar(v float64, t time.Time, traceID string, spanID string) {
+	r.mu.Lock()
+	r.add(v, t)
+	r.exemplars.add(Exemplar{TraceID: traceID, SpanID: spanID, Value: v, Timestamp: t}, r.MaxExemplars)
+	r.mu.Unlock()
+}
+
+func (r *RollingBucket) add(v float64, t time.Time) {
 	r.updateTime(t)
 
 	if r.Hist.Count() == 0 {
@@ -191,6 +217,4 @@ func (r *RollingBucket) AddAt(v float64, t time.Time) {
 	r.sum += v
 	r.sumOfSquares += v * v
 	r.Hist.Add(v)
-
-	r.mu.Unlock()
 }
@@ -79,6 +79,31 @@ func TestRollingBucket(t *testing.T) {
 				dps := r.Datapoints()
 				So(len(dps), ShouldEqual, 3+len(r.Quantiles)+2)
 			})
+			Convey("Exemplars should be attached to values near them", func() {
+				r.AddWithExemplar(10, "fa281a8955571a3a", "acdfec5be6328c3a")
+				r.AddWithExemplar(99, "fa281a8955571a3a", "bcdfec5be6328c3a")
+				tk.Incr(r.BucketWidth)
+				dps := r.Datapoints()
+				So(Exemplars(dpNamed("mname.p25", dps)), ShouldResemble, []Exemplar{
+					{TraceID: "fa281a8955571a3a", SpanID: "acdfec5be6328c3a", Value: 10, Timestamp: tk.Now().Add(-r.BucketWidth)},
+				})
+				So(Exemplars(dpNamed("mname.p99", dps))[0].SpanID, ShouldEqual, "bcdfec5be6328c3a")
+				So(Exemplars(dpNamed("mname.max", dps))[0].SpanID, ShouldEqual, "bcdfec5be6328c3a")
+				So(Exemplars(dpNamed("mname.count", dps)), ShouldBeNil)
+				Convey("only for their window", func() {
+					r.Add(1)
+					tk.Incr(r.BucketWidth)
+					So(Exemplars(dpNamed("mname.p50", r.Datapoints())), ShouldBeNil)
+				})
+				Convey("up to MaxExemplars of them", func() {
+					r.MaxExemplars = 2
+					for i := 0; i < 100; i++ {
+						r.AddWithExemplar(float64(i), "fa281a8955571a3a", "acdfec5be6328c3a")
+					}
+					So(len(r.exemplars.exemplars), ShouldEqual, 2)
+					So(r.exemplars.seen, ShouldEqual, 100)
+				})
+			})
 			Convey("Max flush size should be respected", func() {
 				r.MaxFlushBufferSize = 1
 				tk.Incr(r.BucketWidth)
@@ -0,0 +1,165 @@
+package sfxclient
+
+import (
+	"encoding/json"
+	"expvar"
+	"math"
+	"runtime/metrics"
+	"strings"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+)
+
+// runtimeMetricReplacer turns runtime/metrics names, like /gc/heap/allocs:bytes, into metric names, like
+// go.gc.heap.allocs.bytes
+var runtimeMetricReplacer = strings.NewReplacer("/", ".", ":", ".", "-", "_")
+
+// RuntimeMetrics is a Collector of the process's own expvars, walked with expvar.Do and flattened the way
+// ExpvarScraper flattens them, and of the runtime/metrics the Go runtime supports.  Runtime metrics are
+// named after their runtime/metrics name, so /sched/goroutines:goroutines becomes
+// go.sched.goroutines.goroutines, and sent as cumulative counters if the runtime says they're cumulative
+// and as gauges if not.
+type RuntimeMetrics struct {
+	// Dimensions are added to every datapoint
+	Dimensions map[string]string
+	// Allow, if not empty, are glob patterns (see path.Match) of the only flattened expvar names and
+	// runtime/metrics names, like /gc/*:*, collected
+	Allow []string
+	// Deny are glob patterns of names never collected.  Deny wins over Allow
+	Deny []string
+	// Cumulatives are glob patterns of flattened expvar names that are sent as cumulative counters rather
+	// than gauges
+	Cumulatives []string
+	// MetricName maps a flattened expvar name or runtime/metrics name to the metric to send it as.
+	// Returning "" drops it.  Nil sends expvars unchanged and runtime metrics as described above
+	MetricName func(name string) string
+	// DisableExpvar stops expvars being collected
+	DisableExpvar bool
+	// DisableRuntimeMetrics stops runtime/metrics being collected
+	DisableRuntimeMetrics bool
+	// IncludeHistograms collects runtime/metrics histograms, like /gc/pauses:seconds, as histogram
+	// datapoints.  They have a lot of buckets, so aren't collected by default.
+	IncludeHistograms bool
+}
+
+var _ Collector = &RuntimeMetrics{}
+
+// NewRuntimeMetrics creates a collector of expvars and runtime/metrics that treats
+// DefaultExpvarCumulatives as counters
+func NewRuntimeMetrics(dimensions map[string]string) *RuntimeMetrics {
+	return &RuntimeMetrics{
+		Dimensions:  dimensions,
+		Cumulatives: DefaultExpvarCumulatives,
+	}
+}
+
+// AddRuntimeMetrics reports the process's expvars and runtime/metrics, with the given dimensions, returning
+// the collector so it can be removed again
+func (s *Scheduler) AddRuntimeMetrics(dimensions map[string]string) *RuntimeMetrics {
+	r := NewRuntimeMetrics(dimensions)
+	s.AddCallback(r)
+	return r
+}
+
+// Datapoints returns the expvars and runtime/metrics that are collected
+func (r *RuntimeMetrics) Datapoints() []*datapoint.Datapoint {
+	var dps []*datapoint.Datapoint
+	if !r.DisableExpvar {
+		dps = r.expvarDatapoints(dps)
+	}
+	if !r.DisableRuntimeMetrics {
+		dps = r.runtimeDatapoints(dps)
+	}
+	return dps
+}
+
+// expvarDatapoints appends the numbers in the published expvars to dps
+func (r *RuntimeMetrics) expvarDatapoints(dps []*datapoint.Datapoint) []*datapoint.Datapoint {
+	flattener := &ExpvarScraper{
+		Dimensions:  r.Dimensions,
+		Allow:       r.Allow,
+		Deny:        r.Deny,
+		Cumulatives: r.Cumulatives,
+		MetricName:  r.MetricName,
+	}
+	expvar.Do(func(kv expvar.KeyValue) {
+		dec := json.NewDecoder(strings.NewReader(kv.Value.String()))
+		dec.UseNumber()
+		var v interface{}
+		if err := dec.Decode(&v); err == nil {
+			dps = flattener.flatten(dps, kv.Key, v)
+		}
+	})
+	return dps
+}
+
+// runtimeDatapoints appends the supported runtime/metrics that are collected to dps
+func (r *RuntimeMetrics) runtimeDatapoints(dps []*datapoint.Datapoint) []*datapoint.Datapoint {
+	descriptions := metrics.All()
+	samples := make([]metrics.Sample, 0, len(descriptions))
+	cumulative := make(map[string]bool, len(descriptions))
+	for _, desc := range descriptions {
+		if desc.Kind == metrics.KindFloat64Histogram && !r.IncludeHistograms {
+			continue
+		}
+		if matchesAnyGlob(r.Deny, desc.Name) || (len(r.Allow) > 0 && !matchesAnyGlob(r.Allow, desc.Name)) {
+			continue
+		}
+		samples = append(samples, metrics.Sample{Name: desc.Name})
+		cumulative[desc.Name] = desc.Cumulative
+	}
+	metrics.Read(samples)
+	for _, sample := range samples {
+		metric := "go" + runtimeMetricReplacer.Replace(sample.Name)
+		if r.MetricName != nil {
+			if metric = r.MetricName(sample.Name); metric == "" {
+				continue
+			}
+		}
+		mt := datapoint.Gauge
+		if cumulative[sample.Name] {
+			mt = datapoint.Counter
+		}
+		var value datapoint.Value
+		switch sample.Value.Kind() {
+		case metrics.KindUint64:
+			value = datapoint.NewIntValue(int64(sample.Value.Uint64()))
+		case metrics.KindFloat64:
+			value = datapoint.NewFloatValue(sample.Value.Float64())
+		case metrics.KindFloat64Histogram:
+			hv, err := runtimeHistogram(sample.Value.Float64Histogram())
+			if err != nil {
+				continue
+			}
+			value = hv
+		default:
+			continue
+		}
+		dps = append(dps, datapoint.New(metric, r.Dimensions, value, mt, time.Time{}))
+	}
+	return dps
+}
+
+// runtimeHistogram converts a runtime/metrics histogram to a histogram value.  The runtime doesn't keep the
+// sum of a histogram, so it's estimated from the middle of each bucket, or its finite edge.
+func runtimeHistogram(h *metrics.Float64Histogram) (datapoint.HistogramValue, error) {
+	sum := 0.0
+	for i, count := range h.Counts {
+		if count == 0 {
+			continue
+		}
+		lower, upper := h.Buckets[i], h.Buckets[i+1]
+		mid := (lower + upper) / 2
+		switch {
+		case math.IsInf(lower, 0) && math.IsInf(upper, 0):
+			mid = 0
+		case math.IsInf(lower, 0):
+			mid = upper
+		case math.IsInf(upper, 0):
+			mid = lower
+		}
+		sum += mid * float64(count)
+	}
+	return datapoint.NewHistogramValue(h.Buckets[1:len(h.Buckets)-1], h.Counts, sum)
+}
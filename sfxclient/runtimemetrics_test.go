@@ -0,0 +1,82 @@
+package sfxclient
+
+import (
+	"expvar"
+	"math"
+	"runtime/metrics"
+	"testing"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRuntimeMetrics(t *testing.T) {
+	Convey("runtime metrics", t, func() {
+		if expvar.Get("sfxclient_test_requests") == nil {
+			expvar.NewInt("sfxclient_test_requests").Set(12)
+			cache := expvar.NewMap("sfxclient_test_cache")
+			cache.Add("hits", 7)
+			cache.Set("name", &expvar.String{})
+		}
+		r := NewRuntimeMetrics(map[string]string{"app": "test"})
+		Convey("should collect expvars", func() {
+			dps := r.Datapoints()
+			So(findDatapoint(dps, "sfxclient_test_requests").Value, ShouldResemble, datapoint.NewIntValue(12))
+			So(findDatapoint(dps, "sfxclient_test_requests").Dimensions, ShouldResemble, map[string]string{"app": "test"})
+			So(findDatapoint(dps, "sfxclient_test_cache.hits").Value, ShouldResemble, datapoint.NewIntValue(7))
+			So(findDatapoint(dps, "sfxclient_test_cache.name"), ShouldBeNil)
+			So(findDatapoint(dps, "memstats.NumGC").MetricType, ShouldEqual, datapoint.Counter)
+		})
+		Convey("should collect runtime metrics", func() {
+			dps := r.Datapoints()
+			goroutines := findDatapoint(dps, "go.sched.goroutines.goroutines")
+			So(goroutines.MetricType, ShouldEqual, datapoint.Gauge)
+			So(goroutines.Value.(datapoint.IntValue).Int(), ShouldBeGreaterThan, 0)
+			So(findDatapoint(dps, "go.gc.heap.allocs.bytes").MetricType, ShouldEqual, datapoint.Counter)
+			So(findDatapoint(dps, "go.gc.pauses.seconds"), ShouldBeNil)
+			Convey("and their histograms if asked", func() {
+				r.IncludeHistograms = true
+				r.DisableExpvar = true
+				dps := r.Datapoints()
+				So(findDatapoint(dps, "memstats.NumGC"), ShouldBeNil)
+				_, ok := findDatapoint(dps, "go.sched.latencies.seconds").Value.(datapoint.HistogramValue)
+				So(ok, ShouldBeTrue)
+			})
+		})
+		Convey("should filter and rename", func() {
+			r.Allow = []string{"sfxclient_test_*", "/sched/*"}
+			r.Deny = []string{"sfxclient_test_cache.*"}
+			r.MetricName = func(name string) string {
+				if name == "/sched/goroutines:goroutines" {
+					return "goroutines"
+				}
+				return ""
+			}
+			dps := r.Datapoints()
+			So(len(dps), ShouldEqual, 1)
+			So(dps[0].Metric, ShouldEqual, "goroutines")
+			Convey("or collect nothing", func() {
+				r.DisableExpvar = true
+				r.DisableRuntimeMetrics = true
+				So(r.Datapoints(), ShouldBeEmpty)
+			})
+		})
+		Convey("should be added to a scheduler in one call", func() {
+			s := NewScheduler()
+			r := s.AddRuntimeMetrics(nil)
+			So(len(s.CollectDatapoints()), ShouldBeGreaterThan, 0)
+			s.RemoveCallback(r)
+			So(len(s.CollectDatapoints()), ShouldEqual, 0)
+		})
+		Convey("should convert histograms estimating their sum", func() {
+			hv, err := runtimeHistogram(&metrics.Float64Histogram{
+				Counts:  []uint64{1, 2, 3},
+				Buckets: []float64{math.Inf(-1), 1, 3, math.Inf(1)},
+			})
+			So(err, ShouldBeNil)
+			So(hv.Bounds(), ShouldResemble, []float64{1, 3})
+			So(hv.Counts(), ShouldResemble, []uint64{1, 2, 3})
+			So(hv.Sum(), ShouldEqual, 1+2*2+3*3)
+		})
+	})
+}
@@ -0,0 +1,72 @@
+package sfxclient
+
+import (
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+)
+
+// ScopedScheduler registers collectors with a Scheduler, adding its dimensions to everything they report.
+// Libraries can use one to tag their collectors with their own subsystem without changing the default
+// dimensions of the scheduler they're given.
+type ScopedScheduler struct {
+	scheduler  *Scheduler
+	dimensions map[string]string
+}
+
+// WithDimensions returns a ScopedScheduler that adds dims to what collectors registered through it report.
+// Dimensions the datapoints already have are kept, and group default dimensions are added after dims.
+func (s *Scheduler) WithDimensions(dims map[string]string) *ScopedScheduler {
+	return &ScopedScheduler{
+		scheduler:  s,
+		dimensions: copyDimensions(dims),
+	}
+}
+
+// WithDimensions returns a ScopedScheduler that adds dims to the dimensions of this one
+func (c *ScopedScheduler) WithDimensions(dims map[string]string) *ScopedScheduler {
+	return &ScopedScheduler{
+		scheduler:  c.scheduler,
+		dimensions: datapoint.AddMaps(c.dimensions, copyDimensions(dims)),
+	}
+}
+
+// copyDimensions copies dims, so changing them after they're given to a scope doesn't change the scope
+func copyDimensions(dims map[string]string) map[string]string {
+	ret := make(map[string]string, len(dims))
+	for k, v := range dims {
+		ret[k] = v
+	}
+	return ret
+}
+
+// AddCallback adds a collector to the scheduler's default group.
+func (c *ScopedScheduler) AddCallback(db Collector) {
+	c.AddGroupedCallback(defaultCallbackGroup, db)
+}
+
+// AddGroupedCallback adds a collector to a specific group of the scheduler.
+func (c *ScopedScheduler) AddGroupedCallback(group string, db Collector) {
+	c.scheduler.addCallback(group, db, 0, c.dimensions)
+}
+
+// AddCallbackWithInterval adds a collector to the scheduler's default group that is reported every interval.
+func (c *ScopedScheduler) AddCallbackWithInterval(db Collector, interval time.Duration) {
+	c.AddGroupedCallbackWithInterval(defaultCallbackGroup, db, interval)
+}
+
+// AddGroupedCallbackWithInterval adds a collector to a specific group of the scheduler that is reported every
+// interval.
+func (c *ScopedScheduler) AddGroupedCallbackWithInterval(group string, db Collector, interval time.Duration) {
+	c.scheduler.addCallback(group, db, interval, c.dimensions)
+}
+
+// RemoveCallback removes a collector from the scheduler's default group.
+func (c *ScopedScheduler) RemoveCallback(db Collector) {
+	c.scheduler.RemoveCallback(db)
+}
+
+// RemoveGroupedCallback removes a collector from a specific group of the scheduler.
+func (c *ScopedScheduler) RemoveGroupedCallback(group string, db Collector) {
+	c.scheduler.RemoveGroupedCallback(group, db)
+}
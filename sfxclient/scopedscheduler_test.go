@@ -0,0 +1,55 @@
+package sfxclient
+
+import (
+	"testing"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestScopedScheduler(t *testing.T) {
+	Convey("A scheduler scoped with dimensions", t, func() {
+		s := NewScheduler()
+		s.DefaultDimensions(map[string]string{"host": "a", "subsystem": "global"})
+		dims := map[string]string{"subsystem": "cache"}
+		scope := s.WithDimensions(dims)
+		dims["subsystem"] = "changed"
+		collector := func(dims map[string]string) Collector {
+			return CollectorFunc(func() []*datapoint.Datapoint {
+				return []*datapoint.Datapoint{Gauge("g", dims, 1)}
+			})
+		}
+		collect := func() map[string]string {
+			dps := s.CollectDatapoints()
+			So(len(dps), ShouldEqual, 1)
+			return dps[0].Dimensions
+		}
+
+		Convey("should add its dimensions to what's registered through it", func() {
+			scope.AddCallback(collector(nil))
+			So(collect(), ShouldResemble, map[string]string{"host": "a", "subsystem": "cache"})
+		})
+		Convey("should keep the datapoints' own dimensions", func() {
+			scope.AddCallback(collector(map[string]string{"subsystem": "mine"}))
+			So(collect(), ShouldResemble, map[string]string{"host": "a", "subsystem": "mine"})
+		})
+		Convey("should nest", func() {
+			scope.WithDimensions(map[string]string{"shard": "1"}).AddGroupedCallback("cache", collector(nil))
+			So(collect(), ShouldResemble, map[string]string{"shard": "1", "subsystem": "cache"})
+		})
+		Convey("should not change the scheduler or what's registered with it", func() {
+			c := collector(nil)
+			scope.AddCallbackWithInterval(c, 0)
+			s.AddCallback(c)
+			So(collect(), ShouldResemble, map[string]string{"host": "a", "subsystem": "global"})
+		})
+		Convey("should remove", func() {
+			c := collector(nil)
+			scope.AddGroupedCallbackWithInterval("cache", c, 0)
+			scope.RemoveGroupedCallback("cache", c)
+			scope.AddCallback(c)
+			scope.RemoveCallback(c)
+			So(len(s.CollectDatapoints()), ShouldEqual, 0)
+		})
+	})
+}
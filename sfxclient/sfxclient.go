@@ -60,6 +60,7 @@ import (
 	"context"
 	"expvar"
 	"fmt"
+	"math/rand"
 	"reflect"
 	"strings"
 	"sync"
@@ -123,6 +124,57 @@ type callbackPair struct {
 	callbacks         map[Collector]struct{}
 	defaultDimensions map[string]string
 	expectedSize      int
+	// intervals are the collectors reported at an interval of their own rather than the scheduler's
+	intervals map[Collector]*collectorInterval
+	// dimensions are added to the datapoints of the collectors registered through a ScopedScheduler
+	dimensions map[Collector]map[string]string
+}
+
+// collectorInterval is when a collector with an interval of its own is next reported
+type collectorInterval struct {
+	interval time.Duration
+	next     time.Time
+}
+
+// collectorFilter picks the collectors of a group to collect from
+type collectorFilter func(c *callbackPair, callback Collector) bool
+
+// due is true if callback should be reported at now, moving its next report on if it has an interval of its
+// own.  Collectors without one are due when all is true.
+func (c *callbackPair) due(callback Collector, now time.Time, all bool) bool {
+	ci, exists := c.intervals[callback]
+	if !exists {
+		return all
+	}
+	if now.Before(ci.next) {
+		return false
+	}
+	ci.next = now.Add(ci.interval)
+	return true
+}
+
+// nextDue returns the soonest any collector with an interval of its own is due, starting the interval of
+// those that haven't been scheduled yet at now
+func (c *callbackPair) nextDue(now time.Time) (next time.Time, exists bool) {
+	for _, ci := range c.intervals {
+		if ci.next.IsZero() {
+			ci.next = now.Add(ci.interval)
+		}
+		if !exists || ci.next.Before(next) {
+			next, exists = ci.next, true
+		}
+	}
+	return next, exists
+}
+
+// addDimensions adds the dimensions callback was registered with to the datapoints it collected
+func (c *callbackPair) addDimensions(callback Collector, dps []*datapoint.Datapoint) []*datapoint.Datapoint {
+	if dims := c.dimensions[callback]; len(dims) > 0 {
+		for _, dp := range dps {
+			dp.Dimensions = datapoint.AddMaps(dims, dp.Dimensions)
+		}
+	}
+	return dps
 }
 
 func (c *callbackPair) insertTimeStamp(now time.Time, sendZeroTime bool, ret []*datapoint.Datapoint) {
@@ -137,25 +189,30 @@ func (c *callbackPair) insertTimeStamp(now time.Time, sendZeroTime bool, ret []*
 	c.expectedSize = len(ret)
 }
 
-func (c *callbackPair) getDatapoints(now time.Time, sendZeroTime bool) []*datapoint.Datapoint {
+func (c *callbackPair) getDatapoints(now time.Time, sendZeroTime bool, include collectorFilter, collect func(Collector) []*datapoint.Datapoint) []*datapoint.Datapoint {
 	ret := make([]*datapoint.Datapoint, 0, c.expectedSize)
 	for callback := range c.callbacks {
-		ret = append(ret, callback.Datapoints()...)
+		if include == nil || include(c, callback) {
+			ret = append(ret, c.addDimensions(callback, collect(callback))...)
+		}
 	}
 	c.insertTimeStamp(now, sendZeroTime, ret)
 	return ret
 }
 
-func (c *callbackPair) getDatapointsWithDebug(parentSpan opentracing.Span, now time.Time, sendZeroTime bool) []*datapoint.Datapoint {
+func (c *callbackPair) getDatapointsWithDebug(parentSpan opentracing.Span, now time.Time, sendZeroTime bool, include collectorFilter, collect func(Collector) []*datapoint.Datapoint) []*datapoint.Datapoint {
 	var (
 		buf bytes.Buffer
 		ret = make([]*datapoint.Datapoint, 0, c.expectedSize)
 	)
 
 	for callback := range c.callbacks {
+		if include != nil && !include(c, callback) {
+			continue
+		}
 		buf.WriteString(reflect.TypeOf(callback).String())
 		span := opentracing.GlobalTracer().StartSpan(buf.String(), opentracing.ChildOf(parentSpan.Context()))
-		ret = append(ret, callback.Datapoints()...)
+		ret = append(ret, c.addDimensions(callback, collect(callback))...)
 		span.Finish()
 		buf.Reset()
 	}
@@ -172,10 +229,19 @@ type Scheduler struct {
 	ErrorHandler       func(error) error
 	ReportingDelayNs   int64
 	ReportingTimeoutNs int64
+	// ReportingJitter spreads out the reports of schedulers started together, as a fraction of the
+	// reporting delay.  The first report comes up to this much of the delay late, and each one after it up
+	// to this much early or late.  Zero reports on the delay exactly, and it's at most 1.
+	ReportingJitter float64
+	// OnCollectorPanic, when set, is called with what a collector that panicked panicked with.  The
+	// collector's datapoints are left out of that report and the others are reported as usual.
+	OnCollectorPanic func(group string, collector Collector, recovered interface{})
 
 	callbackMutex      sync.Mutex
 	callbackMap        map[string]*callbackPair
 	previousDatapoints []*datapoint.Datapoint
+	panicsMutex        sync.Mutex
+	collectorPanics    map[collectorKey]*collectorPanics
 	stats              struct {
 		scheduledSleepCounts   int64
 		resetIntervalCounts    int64
@@ -210,31 +276,92 @@ func (s *Scheduler) Var() expvar.Var {
 func (s *Scheduler) CollectDatapoints() []*datapoint.Datapoint {
 	s.callbackMutex.Lock()
 	defer s.callbackMutex.Unlock()
-	datapoints := s.collectDatapoints()
+	datapoints := s.collectDatapoints(s.Timer.Now(), nil)
 	s.prependPrefix(datapoints)
 	return datapoints
 }
 
-// collectDatapoints gives a scheduler an external endpoint to be called and is not thread safe
-func (s *Scheduler) collectDatapoints() []*datapoint.Datapoint {
+// collectDatapoints collects from the collectors include picks, or all of them if it's nil, and is not
+// thread safe
+func (s *Scheduler) collectDatapoints(now time.Time, include collectorFilter) []*datapoint.Datapoint {
 	ret := make([]*datapoint.Datapoint, 0, len(s.previousDatapoints))
-	now := s.Timer.Now()
 	if s.debug {
 		parentSpan := opentracing.GlobalTracer().StartSpan("collect-datapoints")
 		for group, p := range s.callbackMap {
 			span := opentracing.GlobalTracer().StartSpan(group, opentracing.ChildOf(parentSpan.Context()))
-			ret = append(ret, p.getDatapointsWithDebug(span, now, s.SendZeroTime)...)
+			ret = append(ret, p.getDatapointsWithDebug(span, now, s.SendZeroTime, include, s.collector(group))...)
 			span.Finish()
 		}
 		parentSpan.Finish()
 	} else {
-		for _, p := range s.callbackMap {
-			ret = append(ret, p.getDatapoints(now, s.SendZeroTime)...)
+		for group, p := range s.callbackMap {
+			ret = append(ret, p.getDatapoints(now, s.SendZeroTime, include, s.collector(group))...)
 		}
 	}
 	return ret
 }
 
+// collectorKey names a collector in the scheduler's datapoints
+type collectorKey struct {
+	group     string
+	collector string
+}
+
+// collectorPanics are how often a collector panicked, and when it last did
+type collectorPanics struct {
+	count int64
+	last  time.Time
+}
+
+// collector returns what collects from the collectors of group, recovering from those that panic
+func (s *Scheduler) collector(group string) func(Collector) []*datapoint.Datapoint {
+	return func(callback Collector) (ret []*datapoint.Datapoint) {
+		defer func() {
+			if r := recover(); r != nil {
+				s.collectorPanicked(group, callback, r)
+				ret = nil
+			}
+		}()
+		return callback.Datapoints()
+	}
+}
+
+// collectorPanicked counts a collector panicking
+func (s *Scheduler) collectorPanicked(group string, callback Collector, recovered interface{}) {
+	s.panicsMutex.Lock()
+	if s.collectorPanics == nil {
+		s.collectorPanics = make(map[collectorKey]*collectorPanics)
+	}
+	key := collectorKey{group: group, collector: reflect.TypeOf(callback).String()}
+	panics, exists := s.collectorPanics[key]
+	if !exists {
+		panics = &collectorPanics{}
+		s.collectorPanics[key] = panics
+	}
+	panics.count++
+	panics.last = s.Timer.Now()
+	s.panicsMutex.Unlock()
+	if s.OnCollectorPanic != nil {
+		s.OnCollectorPanic(group, callback, recovered)
+	}
+}
+
+// Datapoints returns how often each collector panicked and when it last did, as unix seconds.  The
+// scheduler can be added to itself to report them.
+func (s *Scheduler) Datapoints() []*datapoint.Datapoint {
+	s.panicsMutex.Lock()
+	defer s.panicsMutex.Unlock()
+	ret := make([]*datapoint.Datapoint, 0, len(s.collectorPanics)*2)
+	for key, panics := range s.collectorPanics {
+		dims := map[string]string{"group": key.group, "collector": key.collector}
+		ret = append(ret,
+			Cumulative("total_collector_panics", dims, panics.count),
+			Gauge("collector_last_panic", dims, panics.last.Unix()),
+		)
+	}
+	return ret
+}
+
 // AddCallback adds a collector to the default group.
 func (s *Scheduler) AddCallback(db Collector) {
 	s.AddGroupedCallback(defaultCallbackGroup, db)
@@ -262,6 +389,24 @@ func (s *Scheduler) GroupedDefaultDimensions(group string, dims map[string]strin
 
 // AddGroupedCallback adds a collector to a specific group.
 func (s *Scheduler) AddGroupedCallback(group string, db Collector) {
+	s.addCallback(group, db, 0, nil)
+}
+
+// AddCallbackWithInterval adds a collector to the default group that is reported every interval instead of
+// at the scheduler's reporting delay, so cheap collectors can be reported often and expensive ones rarely.
+func (s *Scheduler) AddCallbackWithInterval(db Collector, interval time.Duration) {
+	s.AddGroupedCallbackWithInterval(defaultCallbackGroup, db, interval)
+}
+
+// AddGroupedCallbackWithInterval adds a collector to a specific group that is reported every interval
+// instead of at the scheduler's reporting delay.
+func (s *Scheduler) AddGroupedCallbackWithInterval(group string, db Collector, interval time.Duration) {
+	s.addCallback(group, db, interval, nil)
+}
+
+// addCallback adds a collector to group, reported every interval if it's positive and with dims added to
+// its datapoints if there are any.  Adding a collector again replaces its interval and dimensions.
+func (s *Scheduler) addCallback(group string, db Collector, interval time.Duration, dims map[string]string) {
 	s.callbackMutex.Lock()
 	defer s.callbackMutex.Unlock()
 	subgroup, exists := s.callbackMap[group]
@@ -273,6 +418,20 @@ func (s *Scheduler) AddGroupedCallback(group string, db Collector) {
 		s.callbackMap[group] = subgroup
 	}
 	subgroup.callbacks[db] = struct{}{}
+	delete(subgroup.intervals, db)
+	if interval > 0 {
+		if subgroup.intervals == nil {
+			subgroup.intervals = make(map[Collector]*collectorInterval)
+		}
+		subgroup.intervals[db] = &collectorInterval{interval: interval}
+	}
+	delete(subgroup.dimensions, db)
+	if len(dims) > 0 {
+		if subgroup.dimensions == nil {
+			subgroup.dimensions = make(map[Collector]map[string]string)
+		}
+		subgroup.dimensions[db] = dims
+	}
 }
 
 // RemoveCallback removes a collector from the default group.
@@ -286,6 +445,8 @@ func (s *Scheduler) RemoveGroupedCallback(group string, db Collector) {
 	defer s.callbackMutex.Unlock()
 	if g, exists := s.callbackMap[group]; exists {
 		delete(g.callbacks, db)
+		delete(g.intervals, db)
+		delete(g.dimensions, db)
 		if len(g.callbacks) == 0 {
 			delete(s.callbackMap, group)
 		}
@@ -294,17 +455,71 @@ func (s *Scheduler) RemoveGroupedCallback(group string, db Collector) {
 
 // ReportOnce will report any metrics saved in this reporter to SignalFx
 func (s *Scheduler) ReportOnce(ctx context.Context) error {
+	return s.report(ctx, s.Timer.Now(), nil, true)
+}
+
+// ReportNow collects from every collector and sends what they report right away, outside of the scheduled
+// reports, returning once it's sent
+func (s *Scheduler) ReportNow(ctx context.Context) error {
+	return s.ReportOnce(ctx)
+}
+
+// flusher is a sink that buffers what it's sent until it's flushed
+type flusher interface {
+	Flush(ctx context.Context) error
+}
+
+// Flush reports now and then flushes the sink if it has a Flush(ctx) error method, for a last report before
+// shutting down or a command line tool that reports once and exits
+func (s *Scheduler) Flush(ctx context.Context) error {
+	if err := s.ReportNow(ctx); err != nil {
+		return err
+	}
+	if f, ok := s.Sink.(flusher); ok {
+		return f.Flush(ctx)
+	}
+	return nil
+}
+
+// reportDue reports the collectors due at now: the ones with an interval of their own that has passed,
+// and when all is true every other one too
+func (s *Scheduler) reportDue(ctx context.Context, now time.Time, all bool) error {
+	return s.report(ctx, now, func(c *callbackPair, callback Collector) bool {
+		return c.due(callback, now, all)
+	}, all)
+}
+
+// report sends what the collectors include picks collect at now.  A report of every collector is kept for Var;
+// one of only some isn't sent at all if they have nothing to report.
+func (s *Scheduler) report(ctx context.Context, now time.Time, include collectorFilter, all bool) error {
 	datapoints := func() []*datapoint.Datapoint {
 		s.callbackMutex.Lock()
 		defer s.callbackMutex.Unlock()
-		datapoints := s.collectDatapoints()
-		s.previousDatapoints = datapoints
+		datapoints := s.collectDatapoints(now, include)
+		if all {
+			s.previousDatapoints = datapoints
+		}
 		return datapoints
 	}()
+	if !all && len(datapoints) == 0 {
+		return nil
+	}
 	s.prependPrefix(datapoints)
 	return s.Sink.AddDatapoints(ctx, datapoints)
 }
 
+// nextIntervalDue returns the soonest any collector with an interval of its own is due
+func (s *Scheduler) nextIntervalDue(now time.Time) (next time.Time, exists bool) {
+	s.callbackMutex.Lock()
+	defer s.callbackMutex.Unlock()
+	for _, p := range s.callbackMap {
+		if due, ok := p.nextDue(now); ok && (!exists || due.Before(next)) {
+			next, exists = due, true
+		}
+	}
+	return next, exists
+}
+
 // Add prefix to metrics if specified in scheduler
 func (s *Scheduler) prependPrefix(datapoints []*datapoint.Datapoint) {
 	if s.Prefix != "" {
@@ -332,6 +547,21 @@ func (s *Scheduler) Debug(debug bool) {
 	s.debug = debug
 }
 
+// jitter returns how far to move a report that's due after delay, see ReportingJitter
+func (s *Scheduler) jitter(delay time.Duration, first bool) time.Duration {
+	fraction := s.ReportingJitter
+	if fraction <= 0 {
+		return 0
+	}
+	if fraction > 1 {
+		fraction = 1
+	}
+	if first {
+		return time.Duration(float64(delay) * fraction * rand.Float64())
+	}
+	return time.Duration(float64(delay) * fraction * (2*rand.Float64() - 1))
+}
+
 func (s *Scheduler) reportingTimeoutHandler() {
 	atomic.AddInt64(&s.stats.reportingTimeoutCounts, 1)
 	_ = s.ErrorHandler(errors.New(fmt.Sprintln("reporting datapoints is not getting completed in allocated ns time",
@@ -342,14 +572,22 @@ func (s *Scheduler) reportingTimeoutHandler() {
 // be run inside a goroutine.
 func (s *Scheduler) Schedule(ctx context.Context) error {
 	lastReport := s.Timer.Now()
+	jitter := s.jitter(time.Duration(atomic.LoadInt64(&s.ReportingDelayNs)), true)
 	for {
 		reportingDelay := time.Duration(atomic.LoadInt64(&s.ReportingDelayNs))
-		wakeupTime := lastReport.Add(reportingDelay)
+		reportTime := lastReport.Add(reportingDelay + jitter)
 		now := s.Timer.Now()
-		if now.After(wakeupTime) {
-			wakeupTime = now.Add(reportingDelay)
+		if now.After(reportTime) {
+			reportTime = now.Add(reportingDelay + jitter)
 			atomic.AddInt64(&s.stats.resetIntervalCounts, 1)
 		}
+		wakeupTime := reportTime
+		if next, exists := s.nextIntervalDue(now); exists && next.Before(wakeupTime) {
+			wakeupTime = next
+			if wakeupTime.Before(now) {
+				wakeupTime = now
+			}
+		}
 		sleepTime := wakeupTime.Sub(now)
 
 		atomic.AddInt64(&s.stats.scheduledSleepCounts, 1)
@@ -357,9 +595,14 @@ func (s *Scheduler) Schedule(ctx context.Context) error {
 		case <-ctx.Done():
 			return errors.Annotate(ctx.Err(), "context closed")
 		case <-s.Timer.After(sleepTime):
-			lastReport = s.Timer.Now()
+			now = s.Timer.Now()
+			all := !now.Before(reportTime)
+			if all {
+				lastReport = now
+				jitter = s.jitter(reportingDelay, false)
+			}
 			rT := time.AfterFunc(time.Duration(atomic.LoadInt64(&s.ReportingTimeoutNs)), s.reportingTimeoutHandler)
-			if err := errors.Annotate(s.ReportOnce(ctx), "failed reporting single metric"); err != nil {
+			if err := errors.Annotate(s.reportDue(ctx, now, all), "failed reporting single metric"); err != nil {
 				if err2 := errors.Annotate(s.ErrorHandler(err), "error handler returned an error"); err2 != nil {
 					return err2
 				}
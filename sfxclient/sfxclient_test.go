@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -441,3 +442,235 @@ func BenchmarkScheduler_ReportOnce_With_Debug(b *testing.B) {
 		So(len(dps), ShouldEqual, 30*totalCb)
 	}
 }
+
+func TestSchedulerCallbackIntervals(t *testing.T) {
+	Convey("A scheduler with collectors at their own intervals", t, func() {
+		start := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+		tk := timekeepertest.NewStubClock(start)
+		sink := &testSink{lastDatapoints: make(chan []*datapoint.Datapoint, 10)}
+		s := NewScheduler()
+		s.Sink = sink
+		s.Timer = tk
+		s.ReportingDelay(time.Second * 20)
+		metric := func(name string) Collector {
+			return CollectorFunc(func() []*datapoint.Datapoint {
+				return []*datapoint.Datapoint{Gauge(name, nil, 1)}
+			})
+		}
+		metrics := func(dps []*datapoint.Datapoint) []string {
+			ret := make([]string, 0, len(dps))
+			for _, dp := range dps {
+				ret = append(ret, dp.Metric)
+			}
+			sort.Strings(ret)
+			return ret
+		}
+		cheap := metric("cheap")
+		expensive := metric("expensive")
+		s.AddCallback(metric("default"))
+		s.AddCallbackWithInterval(cheap, time.Second*10)
+		s.AddGroupedCallbackWithInterval("expensive", expensive, time.Minute*5)
+		ctx := context.Background()
+
+		Convey("should report each when it's due", func() {
+			next, exists := s.nextIntervalDue(start)
+			So(exists, ShouldBeTrue)
+			So(next, ShouldEqual, start.Add(time.Second*10))
+			So(s.reportDue(ctx, start.Add(time.Second*10), false), ShouldBeNil)
+			So(metrics(<-sink.lastDatapoints), ShouldResemble, []string{"cheap"})
+			So(s.reportDue(ctx, start.Add(time.Second*15), false), ShouldBeNil)
+			So(len(sink.lastDatapoints), ShouldEqual, 0)
+			So(s.reportDue(ctx, start.Add(time.Second*20), true), ShouldBeNil)
+			So(metrics(<-sink.lastDatapoints), ShouldResemble, []string{"cheap", "default"})
+			So(s.reportDue(ctx, start.Add(time.Minute*5), true), ShouldBeNil)
+			So(metrics(<-sink.lastDatapoints), ShouldResemble, []string{"cheap", "default", "expensive"})
+		})
+		Convey("should still report everything at once", func() {
+			So(s.ReportOnce(ctx), ShouldBeNil)
+			So(metrics(<-sink.lastDatapoints), ShouldResemble, []string{"cheap", "default", "expensive"})
+		})
+		Convey("should forget the interval of a collector added again or removed", func() {
+			s.AddCallback(cheap)
+			s.RemoveGroupedCallback("expensive", expensive)
+			_, exists := s.nextIntervalDue(start)
+			So(exists, ShouldBeFalse)
+		})
+		Convey("should wake up for collectors due before the next report", func() {
+			s.ReportingDelay(time.Hour)
+			s.RemoveCallback(cheap)
+			s.AddCallbackWithInterval(cheap, time.Second)
+			ctx, cancel := context.WithCancel(ctx)
+			defer cancel()
+			go func() {
+				_ = s.Schedule(ctx)
+			}()
+			var dps []*datapoint.Datapoint
+			for dps == nil {
+				select {
+				case dps = <-sink.lastDatapoints:
+				default:
+					tk.Incr(time.Millisecond * 100)
+					runtime.Gosched()
+				}
+			}
+			So(metrics(dps), ShouldResemble, []string{"cheap"})
+			So(tk.Now().Sub(start), ShouldBeLessThan, time.Minute)
+		})
+	})
+}
+
+func TestSchedulerJitter(t *testing.T) {
+	Convey("A scheduler with reporting jitter", t, func() {
+		s := NewScheduler()
+		delay := time.Second * 10
+		Convey("should report on the delay without it", func() {
+			So(s.jitter(delay, true), ShouldEqual, 0)
+			So(s.jitter(delay, false), ShouldEqual, 0)
+		})
+		Convey("should start late and report early or late", func() {
+			s.ReportingJitter = 0.2
+			var early, late bool
+			for i := 0; i < 1000; i++ {
+				first := s.jitter(delay, true)
+				So(first, ShouldBeBetweenOrEqual, 0, time.Second*2)
+				later := s.jitter(delay, false)
+				So(later, ShouldBeBetweenOrEqual, -time.Second*2, time.Second*2)
+				early = early || later < 0
+				late = late || later > 0
+			}
+			So(early && late, ShouldBeTrue)
+		})
+		Convey("should jitter by at most the whole delay", func() {
+			s.ReportingJitter = 5
+			for i := 0; i < 100; i++ {
+				So(s.jitter(delay, false), ShouldBeBetweenOrEqual, -delay, delay)
+			}
+		})
+		Convey("should delay the first report", func() {
+			tk := timekeepertest.NewStubClock(time.Now())
+			start := tk.Now()
+			sink := &testSink{lastDatapoints: make(chan []*datapoint.Datapoint, 1)}
+			s.Sink = sink
+			s.Timer = tk
+			s.ReportingDelay(delay)
+			s.ReportingJitter = 0.5
+			s.AddCallback(GoMetricsSource)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go func() {
+				_ = s.Schedule(ctx)
+			}()
+			for atomic.LoadInt64(&s.stats.scheduledSleepCounts) == 0 {
+				runtime.Gosched()
+			}
+			var reported bool
+			for !reported {
+				select {
+				case <-sink.lastDatapoints:
+					reported = true
+				default:
+					tk.Incr(time.Millisecond * 100)
+					runtime.Gosched()
+				}
+			}
+			So(tk.Now().Sub(start), ShouldBeBetweenOrEqual, delay, delay*3/2+time.Millisecond*100)
+		})
+	})
+}
+
+type panickingCollector struct{}
+
+func (panickingCollector) Datapoints() []*datapoint.Datapoint {
+	panic("bad plugin")
+}
+
+func TestSchedulerCollectorPanics(t *testing.T) {
+	Convey("A scheduler with a collector that panics", t, func() {
+		now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+		sink := &testSink{lastDatapoints: make(chan []*datapoint.Datapoint, 1)}
+		s := NewScheduler()
+		s.Sink = sink
+		s.Timer = timekeepertest.NewStubClock(now)
+		var recovered []interface{}
+		s.OnCollectorPanic = func(group string, collector Collector, r interface{}) {
+			So(group, ShouldEqual, "plugins")
+			So(collector, ShouldHaveSameTypeAs, panickingCollector{})
+			recovered = append(recovered, r)
+		}
+		s.AddCallback(CollectorFunc(func() []*datapoint.Datapoint {
+			return []*datapoint.Datapoint{Gauge("healthy", nil, 1)}
+		}))
+		s.AddGroupedCallback("plugins", panickingCollector{})
+
+		Convey("should report the other collectors", func() {
+			So(s.ReportOnce(context.Background()), ShouldBeNil)
+			dps := <-sink.lastDatapoints
+			So(len(dps), ShouldEqual, 1)
+			So(dps[0].Metric, ShouldEqual, "healthy")
+			So(recovered, ShouldResemble, []interface{}{"bad plugin"})
+		})
+		Convey("should count its panics", func() {
+			s.Debug(true)
+			So(len(s.CollectDatapoints()), ShouldEqual, 1)
+			So(len(s.CollectDatapoints()), ShouldEqual, 1)
+			counts := map[string]int64{}
+			for _, dp := range s.Datapoints() {
+				So(dp.Dimensions, ShouldResemble, map[string]string{"group": "plugins", "collector": "sfxclient.panickingCollector"})
+				counts[dp.Metric] = dp.Value.(datapoint.IntValue).Int()
+			}
+			So(counts, ShouldResemble, map[string]int64{"total_collector_panics": 2, "collector_last_panic": now.Unix()})
+			Convey("which it can report itself", func() {
+				s.AddCallback(s)
+				So(len(s.CollectDatapoints()), ShouldEqual, 3)
+			})
+		})
+	})
+}
+
+type flushingSink struct {
+	testSink
+	flushes int
+}
+
+func (f *flushingSink) Flush(ctx context.Context) error {
+	f.flushes++
+	return f.retErr
+}
+
+func TestSchedulerFlush(t *testing.T) {
+	Convey("A scheduler reporting on demand", t, func() {
+		ctx := context.Background()
+		s := NewScheduler()
+		s.AddCallback(CollectorFunc(func() []*datapoint.Datapoint {
+			return []*datapoint.Datapoint{Gauge("g", nil, 1)}
+		}))
+		s.AddCallbackWithInterval(CollectorFunc(func() []*datapoint.Datapoint {
+			return []*datapoint.Datapoint{Gauge("rare", nil, 1)}
+		}), time.Hour)
+		sink := &flushingSink{testSink: testSink{lastDatapoints: make(chan []*datapoint.Datapoint, 1)}}
+		s.Sink = sink
+
+		Convey("should report every collector now", func() {
+			So(s.ReportNow(ctx), ShouldBeNil)
+			So(len(<-sink.lastDatapoints), ShouldEqual, 2)
+			So(sink.flushes, ShouldEqual, 0)
+		})
+		Convey("should flush the sink after reporting", func() {
+			So(s.Flush(ctx), ShouldBeNil)
+			So(len(<-sink.lastDatapoints), ShouldEqual, 2)
+			So(sink.flushes, ShouldEqual, 1)
+			Convey("unless the report failed", func() {
+				sink.retErr = errors.New("nope")
+				So(s.Flush(ctx), ShouldEqual, sink.retErr)
+				<-sink.lastDatapoints
+				So(sink.flushes, ShouldEqual, 1)
+			})
+		})
+		Convey("should flush only sinks that can be", func() {
+			plain := &testSink{lastDatapoints: make(chan []*datapoint.Datapoint, 1)}
+			s.Sink = plain
+			So(s.Flush(ctx), ShouldBeNil)
+			So(len(<-plain.lastDatapoints), ShouldEqual, 2)
+		})
+	})
+}
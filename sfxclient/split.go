@@ -0,0 +1,78 @@
+package sfxclient
+
+import (
+	"context"
+	goerrors "errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/signalfx/golib/v3/errors"
+)
+
+// requestSplitter sends a slice of items in as many requests as it takes to keep each one under the sink's
+// MaxRequestItems and MaxRequestBytes
+type requestSplitter[T any] struct {
+	h           *HTTPSink
+	encode      func(items []T) ([]byte, error)
+	contentType string
+	endpoint    string
+	timeout     time.Duration
+	validator   responseValidator
+}
+
+// send sends items in requests of at most MaxRequestItems items whose encoded bodies are at most
+// MaxRequestBytes.  A request that's still too big, or that ingest rejects with 413, is halved until it's
+// a single item.  Each request succeeds or fails on its own, and the errors of the ones that failed are
+// returned together.
+func (s *requestSplitter[T]) send(ctx context.Context, items []T) error {
+	step := len(items)
+	if s.h.MaxRequestItems > 0 && s.h.MaxRequestItems < step {
+		step = s.h.MaxRequestItems
+	}
+	errs := make([]error, 0, (len(items)+step-1)/step)
+	for start := 0; start < len(items); start += step {
+		end := start + step
+		if end > len(items) {
+			end = len(items)
+		}
+		errs = append(errs, s.sendChunk(ctx, items, start, end))
+	}
+	return errors.NewMultiErr(errs)
+}
+
+// sendChunk sends items[start:end], halving it if it's too big
+func (s *requestSplitter[T]) sendChunk(ctx context.Context, items []T, start, end int) error {
+	body, err := s.encode(items[start:end])
+	if err != nil {
+		return errors.Annotate(err, "cannot encode into "+s.contentType)
+	}
+	single := end-start == 1
+	if single || s.h.MaxRequestBytes <= 0 || len(body) <= s.h.MaxRequestBytes {
+		err = s.h.doBottom(chunkContext(ctx, len(items), start, end), func() (io.Reader, bool, error) {
+			return s.h.getReader(body)
+		}, s.contentType, s.endpoint, s.timeout, s.validator)
+		if single || !entityTooLarge(err) {
+			return err
+		}
+	}
+	mid := start + (end-start)/2
+	return errors.NewMultiErr([]error{s.sendChunk(ctx, items, start, mid), s.sendChunk(ctx, items, mid, end)})
+}
+
+// chunkContext gives a chunk of a split request an idempotency key of its own, derived from the key on ctx
+// so a retry with the same context sends the same keys
+func chunkContext(ctx context.Context, total, start, end int) context.Context {
+	key, ok := IdempotencyKeyFromContext(ctx)
+	if !ok || (start == 0 && end == total) {
+		return ctx
+	}
+	return ContextWithIdempotencyKey(ctx, fmt.Sprintf("%s-%d-%d", key, start, end))
+}
+
+// entityTooLarge is true if ingest rejected a request for being too big
+func entityTooLarge(err error) bool {
+	var apiErr *SFXAPIError
+	return goerrors.As(err, &apiErr) && apiErr.StatusCode == http.StatusRequestEntityTooLarge
+}
@@ -0,0 +1,118 @@
+package sfxclient
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	sfxmodel "github.com/signalfx/com_signalfx_metrics_protobuf/model"
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/event"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestHTTPSinkSplitting(t *testing.T) {
+	Convey("An HTTPSink splitting requests", t, func() {
+		var mu sync.Mutex
+		var sizes []int
+		var keys []string
+		maxPoints := 1000
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			var msg sfxmodel.DataPointUploadMessage
+			if proto.Unmarshal(body, &msg) != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			if len(msg.Datapoints) > maxPoints {
+				w.WriteHeader(http.StatusRequestEntityTooLarge)
+				return
+			}
+			mu.Lock()
+			sizes = append(sizes, len(msg.Datapoints))
+			keys = append(keys, r.Header.Get(IdempotencyKeyHeaderName))
+			mu.Unlock()
+			_, _ = io.WriteString(w, respBodyStrOk)
+		}))
+		defer server.Close()
+		s := NewHTTPSink()
+		s.DatapointEndpoint = server.URL
+		s.DisableCompression = true
+		points := make([]*datapoint.Datapoint, 10)
+		for i := range points {
+			points[i] = GaugeF("g", nil, float64(i))
+		}
+		ctx := context.Background()
+		sent := func() []int {
+			mu.Lock()
+			defer mu.Unlock()
+			ret := append([]int(nil), sizes...)
+			sort.Ints(ret)
+			return ret
+		}
+
+		Convey("should send everything at once without limits", func() {
+			So(s.AddDatapoints(ctx, points), ShouldBeNil)
+			So(sent(), ShouldResemble, []int{10})
+		})
+		Convey("should split by count", func() {
+			s.MaxRequestItems = 4
+			So(s.AddDatapoints(ctx, points), ShouldBeNil)
+			So(sent(), ShouldResemble, []int{2, 4, 4})
+		})
+		Convey("should split by size", func() {
+			one, err := s.marshalDatapoints(points[:1])
+			So(err, ShouldBeNil)
+			s.MaxRequestBytes = len(one) * 3
+			So(s.AddDatapoints(ctx, points), ShouldBeNil)
+			So(sent(), ShouldResemble, []int{2, 2, 3, 3})
+		})
+		Convey("should split requests ingest says are too large", func() {
+			maxPoints = 3
+			So(s.AddDatapoints(ctx, points), ShouldBeNil)
+			So(sent(), ShouldResemble, []int{2, 2, 3, 3})
+		})
+		Convey("should return the errors of the requests that failed", func() {
+			maxPoints = 0
+			s.MaxRequestItems = 5
+			err := s.AddDatapoints(ctx, points)
+			So(err, ShouldNotBeNil)
+			So(len(sent()), ShouldEqual, 0)
+		})
+		Convey("should give each request its own idempotency key", func() {
+			s.IdempotencyKeyHeader = IdempotencyKeyHeaderName
+			s.MaxRequestItems = 5
+			So(s.AddDatapoints(ContextWithIdempotencyKey(ctx, "abc"), points), ShouldBeNil)
+			sort.Strings(keys)
+			So(keys, ShouldResemble, []string{"abc-0-5", "abc-5-10"})
+		})
+		Convey("should split events too", func() {
+			eventSizes := make(chan int, 3)
+			eventServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := ioutil.ReadAll(r.Body)
+				var msg sfxmodel.EventUploadMessage
+				_ = proto.Unmarshal(body, &msg)
+				eventSizes <- len(msg.Events)
+				_, _ = io.WriteString(w, respBodyStrOk)
+			}))
+			defer eventServer.Close()
+			s.EventEndpoint = eventServer.URL
+			s.MaxRequestItems = 2
+			events := []*event.Event{
+				event.New("a", event.USERDEFINED, nil, time.Time{}),
+				event.New("b", event.USERDEFINED, nil, time.Time{}),
+				event.New("c", event.USERDEFINED, nil, time.Time{}),
+			}
+			So(s.AddEvents(ctx, events), ShouldBeNil)
+			So(<-eventSizes, ShouldEqual, 2)
+			So(<-eventSizes, ShouldEqual, 1)
+		})
+	})
+}
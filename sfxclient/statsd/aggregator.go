@@ -0,0 +1,192 @@
+package statsd
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+)
+
+// DefaultPercentiles are the percentiles of timers sent by default
+var DefaultPercentiles = []float64{0.5, 0.9, 0.99}
+
+// maxTimerSamples bounds the samples kept per timer each flush
+const maxTimerSamples = 10000
+
+type key struct {
+	name string
+	tags string
+}
+
+// newKey makes a map key for name and tags, sorting the tags so order doesn't matter
+func newKey(name string, tags map[string]string) key {
+	if len(tags) == 0 {
+		return key{name: name}
+	}
+	pairs := make([]string, 0, len(tags))
+	for k, v := range tags {
+		pairs = append(pairs, k+":"+v)
+	}
+	sort.Strings(pairs)
+	return key{name: name, tags: strings.Join(pairs, ",")}
+}
+
+type timer struct {
+	tags    map[string]string
+	count   float64
+	sum     float64
+	samples []float64
+}
+
+type counter struct {
+	tags  map[string]string
+	value float64
+}
+
+type set struct {
+	tags    map[string]string
+	members map[string]struct{}
+}
+
+// Aggregator combines metrics between flushes.  Counters are summed, scaled up by their sample rate, and
+// sent as counts.  Gauges keep their last value and are sent every flush.  Timers, histograms and
+// distributions are sent as <name>.count, <name>.sum, <name>.min, <name>.max, <name>.mean and one
+// <name>.p<N> gauge per percentile.  Sets are sent as the number of unique members seen.
+type Aggregator struct {
+	// Percentiles of timers to send, between 0 and 1
+	Percentiles []float64
+	// Dimensions are added to every datapoint.  Tags of the same name win.
+	Dimensions map[string]string
+
+	mu       sync.Mutex
+	counters map[key]*counter
+	gauges   map[key]*counter
+	timers   map[key]*timer
+	sets     map[key]*set
+}
+
+// NewAggregator creates an aggregator sending DefaultPercentiles
+func NewAggregator() *Aggregator {
+	return &Aggregator{
+		Percentiles: DefaultPercentiles,
+		counters:    make(map[key]*counter),
+		gauges:      make(map[key]*counter),
+		timers:      make(map[key]*timer),
+		sets:        make(map[key]*set),
+	}
+}
+
+// Add aggregates m
+func (a *Aggregator) Add(m *Metric) {
+	k := newKey(m.Name, m.Tags)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	switch m.Type {
+	case Counter:
+		c, exists := a.counters[k]
+		if !exists {
+			c = &counter{tags: m.Tags}
+			a.counters[k] = c
+		}
+		c.value += m.Value / m.SampleRate
+	case Gauge:
+		g, exists := a.gauges[k]
+		if !exists {
+			g = &counter{tags: m.Tags}
+			a.gauges[k] = g
+		}
+		if m.Relative {
+			g.value += m.Value
+		} else {
+			g.value = m.Value
+		}
+	case Timer, Histogram, Distribution:
+		t, exists := a.timers[k]
+		if !exists {
+			t = &timer{tags: m.Tags}
+			a.timers[k] = t
+		}
+		t.count += 1 / m.SampleRate
+		t.sum += m.Value
+		if len(t.samples) < maxTimerSamples {
+			t.samples = append(t.samples, m.Value)
+		}
+	case Set:
+		s, exists := a.sets[k]
+		if !exists {
+			s = &set{tags: m.Tags, members: make(map[string]struct{})}
+			a.sets[k] = s
+		}
+		s.members[m.SetValue] = struct{}{}
+	}
+}
+
+// Flush returns the datapoints aggregated since the last flush, timestamped now, and starts over.  Gauges
+// are kept.
+func (a *Aggregator) Flush(now time.Time) []*datapoint.Datapoint {
+	a.mu.Lock()
+	counters, timers, sets := a.counters, a.timers, a.sets
+	a.counters, a.timers, a.sets = make(map[key]*counter), make(map[key]*timer), make(map[key]*set)
+	dps := make([]*datapoint.Datapoint, 0, len(counters)+len(a.gauges)+len(timers)*(5+len(a.Percentiles))+len(sets))
+	for k, g := range a.gauges {
+		dps = append(dps, a.datapoint(k.name, g.tags, g.value, datapoint.Gauge, now))
+	}
+	a.mu.Unlock()
+
+	for k, c := range counters {
+		dps = append(dps, a.datapoint(k.name, c.tags, c.value, datapoint.Count, now))
+	}
+	for k, s := range sets {
+		dps = append(dps, a.datapoint(k.name, s.tags, float64(len(s.members)), datapoint.Gauge, now))
+	}
+	for k, t := range timers {
+		dps = append(dps, a.timerDatapoints(k.name, t, now)...)
+	}
+	return dps
+}
+
+func (a *Aggregator) timerDatapoints(name string, t *timer, now time.Time) []*datapoint.Datapoint {
+	sort.Float64s(t.samples)
+	sampleSum := 0.0
+	for _, v := range t.samples {
+		sampleSum += v
+	}
+	dps := []*datapoint.Datapoint{
+		a.datapoint(name+".count", t.tags, t.count, datapoint.Count, now),
+		a.datapoint(name+".sum", t.tags, t.sum, datapoint.Count, now),
+		a.datapoint(name+".min", t.tags, t.samples[0], datapoint.Gauge, now),
+		a.datapoint(name+".max", t.tags, t.samples[len(t.samples)-1], datapoint.Gauge, now),
+		a.datapoint(name+".mean", t.tags, sampleSum/float64(len(t.samples)), datapoint.Gauge, now),
+	}
+	for _, p := range a.Percentiles {
+		i := int(math.Ceil(p*float64(len(t.samples)))) - 1
+		if i < 0 {
+			i = 0
+		}
+		if i >= len(t.samples) {
+			i = len(t.samples) - 1
+		}
+		suffix := ".p" + strconv.FormatFloat(p*100, 'f', -1, 64)
+		dps = append(dps, a.datapoint(name+suffix, t.tags, t.samples[i], datapoint.Gauge, now))
+	}
+	return dps
+}
+
+func (a *Aggregator) datapoint(name string, tags map[string]string, value float64, mt datapoint.MetricType, now time.Time) *datapoint.Datapoint {
+	dims := make(map[string]string, len(a.Dimensions)+len(tags))
+	for k, v := range a.Dimensions {
+		dims[k] = v
+	}
+	for k, v := range tags {
+		dims[k] = v
+	}
+	var dv datapoint.Value = datapoint.NewFloatValue(value)
+	if value == math.Trunc(value) && math.Abs(value) < 1<<53 {
+		dv = datapoint.NewIntValue(int64(value))
+	}
+	return datapoint.New(name, dims, dv, mt, now)
+}
@@ -0,0 +1,99 @@
+package statsd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func byMetric(dps []*datapoint.Datapoint) map[string]*datapoint.Datapoint {
+	ret := make(map[string]*datapoint.Datapoint, len(dps))
+	for _, dp := range dps {
+		ret[dp.Metric] = dp
+	}
+	return ret
+}
+
+func mustParse(lines ...string) []*Metric {
+	ret := make([]*Metric, 0, len(lines))
+	for _, line := range lines {
+		m, err := ParseLine(line)
+		if err != nil {
+			panic(err)
+		}
+		ret = append(ret, m)
+	}
+	return ret
+}
+
+func TestAggregator(t *testing.T) {
+	Convey("an aggregator", t, func() {
+		a := NewAggregator()
+		a.Dimensions = map[string]string{"host": "default", "app": "test"}
+		now := time.Unix(100, 0)
+		for _, m := range mustParse(
+			"hits:1|c", "hits:2|c|@0.5", "hits:1|c|#host:a",
+			"temp:10|g", "temp:+5|g", "temp:-1|g",
+			"users:a|s", "users:b|s", "users:a|s",
+			"lat:1|ms", "lat:2|ms", "lat:3|ms", "lat:4|ms|@0.5", "lat:10|d",
+		) {
+			a.Add(m)
+		}
+		dps := a.Flush(now)
+		Convey("should sum counters, scaled by sample rate, per tag set", func() {
+			var hits []*datapoint.Datapoint
+			for _, dp := range dps {
+				if dp.Metric == "hits" {
+					hits = append(hits, dp)
+				}
+			}
+			So(len(hits), ShouldEqual, 2)
+			for _, dp := range hits {
+				So(dp.MetricType, ShouldEqual, datapoint.Count)
+				So(dp.Timestamp, ShouldEqual, now)
+				if dp.Dimensions["host"] == "a" {
+					So(dp.Value, ShouldResemble, datapoint.NewIntValue(1))
+				} else {
+					So(dp.Value, ShouldResemble, datapoint.NewIntValue(5))
+					So(dp.Dimensions, ShouldResemble, map[string]string{"host": "default", "app": "test"})
+				}
+			}
+		})
+		m := byMetric(dps)
+		Convey("should apply relative gauges", func() {
+			So(m["temp"].Value, ShouldResemble, datapoint.NewIntValue(14))
+			So(m["temp"].MetricType, ShouldEqual, datapoint.Gauge)
+		})
+		Convey("should count unique set members", func() {
+			So(m["users"].Value, ShouldResemble, datapoint.NewIntValue(2))
+		})
+		Convey("should summarize timers", func() {
+			So(m["lat.count"].Value, ShouldResemble, datapoint.NewIntValue(6))
+			So(m["lat.count"].MetricType, ShouldEqual, datapoint.Count)
+			So(m["lat.sum"].Value, ShouldResemble, datapoint.NewIntValue(20))
+			So(m["lat.min"].Value, ShouldResemble, datapoint.NewIntValue(1))
+			So(m["lat.max"].Value, ShouldResemble, datapoint.NewIntValue(10))
+			So(m["lat.mean"].Value, ShouldResemble, datapoint.NewIntValue(4))
+			So(m["lat.p50"].Value, ShouldResemble, datapoint.NewIntValue(3))
+			So(m["lat.p90"].Value, ShouldResemble, datapoint.NewIntValue(10))
+			So(m["lat.p99"].Value, ShouldResemble, datapoint.NewIntValue(10))
+			So(len(dps), ShouldEqual, 12)
+		})
+		Convey("should keep only gauges after flushing", func() {
+			dps := a.Flush(now)
+			So(len(dps), ShouldEqual, 1)
+			So(dps[0].Metric, ShouldEqual, "temp")
+		})
+		Convey("should send fractional values as floats", func() {
+			a.Add(&Metric{Name: "f", Type: Gauge, Value: 0.25, SampleRate: 1})
+			a.Percentiles = []float64{0, 0.999}
+			a.Add(&Metric{Name: "t", Type: Timer, Value: 1, SampleRate: 1})
+			m := byMetric(a.Flush(now))
+			So(m["f"].Value, ShouldResemble, datapoint.NewFloatValue(0.25))
+			So(m["t.p0"], ShouldNotBeNil)
+			So(m["t.p99.9"], ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,91 @@
+// Package statsd is a local statsd endpoint.  Server listens over UDP and TCP for statsd and DogStatsD
+// lines, aggregates them each flush interval and adds the result to a sfxclient.Sink.
+package statsd
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/signalfx/golib/v3/errors"
+)
+
+// Type is the kind of a statsd metric
+type Type string
+
+// The statsd metric types.  Histograms and distributions are aggregated like timers
+const (
+	Counter      Type = "c"
+	Gauge        Type = "g"
+	Timer        Type = "ms"
+	Histogram    Type = "h"
+	Distribution Type = "d"
+	Set          Type = "s"
+)
+
+// Metric is one parsed statsd line
+type Metric struct {
+	Name string
+	Type Type
+	// Value is the number sent, for every type but Set
+	Value float64
+	// SetValue is the member sent for a Set
+	SetValue string
+	// Relative is true for gauges sent as +N or -N, which change the gauge rather than set it
+	Relative bool
+	// SampleRate is the @rate sent, or 1
+	SampleRate float64
+	// Tags are the DogStatsD #key:value tags.  Tags without a value are dropped
+	Tags map[string]string
+}
+
+// ParseLine parses a single line like name:value|type|@rate|#key:value,key2:value2
+func ParseLine(line string) (*Metric, error) {
+	colon := strings.IndexByte(line, ':')
+	if colon <= 0 {
+		return nil, errors.Errorf("line %q has no name", line)
+	}
+	parts := strings.Split(line[colon+1:], "|")
+	if len(parts) < 2 {
+		return nil, errors.Errorf("line %q has no type", line)
+	}
+	m := &Metric{Name: line[:colon], Type: Type(parts[1]), SampleRate: 1}
+	value := parts[0]
+	switch m.Type {
+	case Set:
+		m.SetValue = value
+	case Counter, Gauge, Timer, Histogram, Distribution:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, errors.Annotatef(err, "invalid value for %s", m.Name)
+		}
+		m.Value = f
+		m.Relative = m.Type == Gauge && (value[0] == '+' || value[0] == '-')
+	default:
+		return nil, errors.Errorf("unknown type %q for %s", parts[1], m.Name)
+	}
+	for _, part := range parts[2:] {
+		switch {
+		case strings.HasPrefix(part, "@"):
+			rate, err := strconv.ParseFloat(part[1:], 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return nil, errors.Errorf("invalid sample rate %q for %s", part, m.Name)
+			}
+			m.SampleRate = rate
+		case strings.HasPrefix(part, "#"):
+			m.Tags = parseTags(part[1:])
+		}
+	}
+	return m, nil
+}
+
+func parseTags(s string) map[string]string {
+	tags := make(map[string]string)
+	for _, tag := range strings.Split(s, ",") {
+		colon := strings.IndexByte(tag, ':')
+		if colon <= 0 || colon == len(tag)-1 {
+			continue
+		}
+		tags[tag[:colon]] = tag[colon+1:]
+	}
+	return tags
+}
@@ -0,0 +1,52 @@
+package statsd
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParseLine(t *testing.T) {
+	Convey("parsing statsd lines", t, func() {
+		Convey("should parse every type", func() {
+			m, err := ParseLine("page.views:1|c")
+			So(err, ShouldBeNil)
+			So(m, ShouldResemble, &Metric{Name: "page.views", Type: Counter, Value: 1, SampleRate: 1})
+			m, err = ParseLine("fuel.level:0.5|g")
+			So(err, ShouldBeNil)
+			So(m.Value, ShouldEqual, 0.5)
+			So(m.Relative, ShouldBeFalse)
+			m, err = ParseLine("fuel.level:-2|g")
+			So(err, ShouldBeNil)
+			So(m.Value, ShouldEqual, -2)
+			So(m.Relative, ShouldBeTrue)
+			m, err = ParseLine("song.length:240|h|@0.5")
+			So(err, ShouldBeNil)
+			So(m.Type, ShouldEqual, Histogram)
+			So(m.SampleRate, ShouldEqual, 0.5)
+			m, err = ParseLine("users.uniques:1234|s")
+			So(err, ShouldBeNil)
+			So(m.SetValue, ShouldEqual, "1234")
+		})
+		Convey("should parse DogStatsD tags", func() {
+			m, err := ParseLine("req.time:12|ms|@0.1|#env:prod,host:a,bare,:x,y:")
+			So(err, ShouldBeNil)
+			So(m.Type, ShouldEqual, Timer)
+			So(m.Tags, ShouldResemble, map[string]string{"env": "prod", "host": "a"})
+		})
+		Convey("should reject bad lines", func() {
+			for _, line := range []string{
+				"novalue",
+				":1|c",
+				"a:1",
+				"a:x|c",
+				"a:1|q",
+				"a:1|c|@2",
+				"a:1|c|@x",
+			} {
+				_, err := ParseLine(line)
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+}
@@ -0,0 +1,199 @@
+package statsd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/errors"
+	"github.com/signalfx/golib/v3/sfxclient"
+	"github.com/signalfx/golib/v3/timekeeper"
+)
+
+// DefaultFlushInterval is how often a Server flushes by default, matching statsd
+const DefaultFlushInterval = time.Second * 10
+
+// maxPacketSize is the largest UDP packet read
+const maxPacketSize = 65535
+
+// Server receives statsd lines over UDP and TCP and adds their aggregates to a Sink every FlushInterval.
+// It is also a Collector of stats about itself.
+type Server struct {
+	*Aggregator
+	Sink          sfxclient.Sink
+	FlushInterval time.Duration
+	Timer         timekeeper.TimeKeeper
+	// ErrorHandler is called when a flush fails.  Run stops if it returns an error
+	ErrorHandler func(error) error
+
+	mu        sync.Mutex
+	closers   []func() error
+	wg        sync.WaitGroup
+	closed    chan struct{}
+	closeOnce sync.Once
+	stats     struct {
+		lines       int64
+		parseErrors int64
+		flushes     int64
+	}
+}
+
+var _ sfxclient.Collector = &Server{}
+
+// NewServer creates a server adding to sink every DefaultFlushInterval.  Call ListenUDP or ListenTCP to
+// receive lines and Run to flush them.
+func NewServer(sink sfxclient.Sink) *Server {
+	return &Server{
+		Aggregator:    NewAggregator(),
+		Sink:          sink,
+		FlushInterval: DefaultFlushInterval,
+		Timer:         timekeeper.RealTime{},
+		ErrorHandler:  sfxclient.DefaultErrorHandler,
+		closed:        make(chan struct{}),
+	}
+}
+
+// ListenUDP receives packets of newline separated lines on addr, like ":8125", returning the address
+// listened on
+func (s *Server) ListenUDP(addr string) (net.Addr, error) {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, errors.Annotatef(err, "cannot listen on udp %s", addr)
+	}
+	s.addCloser(conn.Close)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		buf := make([]byte, maxPacketSize)
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			for _, line := range bytes.Split(buf[:n], []byte("\n")) {
+				s.handleLine(line)
+			}
+		}
+	}()
+	return conn.LocalAddr(), nil
+}
+
+// ListenTCP receives newline separated lines on connections to addr, returning the address listened on
+func (s *Server) ListenTCP(addr string) (net.Addr, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, errors.Annotatef(err, "cannot listen on tcp %s", addr)
+	}
+	s.addCloser(l.Close)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			s.wg.Add(1)
+			go s.serveConn(conn)
+		}
+	}()
+	return l.Addr(), nil
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer s.wg.Done()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-s.closed:
+		case <-done:
+		}
+		_ = conn.Close()
+	}()
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 4096), maxPacketSize)
+	for scanner.Scan() {
+		s.handleLine(scanner.Bytes())
+	}
+}
+
+func (s *Server) addCloser(f func() error) {
+	s.mu.Lock()
+	s.closers = append(s.closers, f)
+	s.mu.Unlock()
+}
+
+func (s *Server) handleLine(line []byte) {
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 {
+		return
+	}
+	atomic.AddInt64(&s.stats.lines, 1)
+	m, err := ParseLine(string(line))
+	if err != nil {
+		atomic.AddInt64(&s.stats.parseErrors, 1)
+		return
+	}
+	s.Add(m)
+}
+
+// Datapoints returns stats about the server
+func (s *Server) Datapoints() []*datapoint.Datapoint {
+	return []*datapoint.Datapoint{
+		sfxclient.Cumulative("total_statsd_lines", s.Dimensions, atomic.LoadInt64(&s.stats.lines)),
+		sfxclient.Cumulative("total_statsd_parse_errors", s.Dimensions, atomic.LoadInt64(&s.stats.parseErrors)),
+		sfxclient.Cumulative("total_statsd_flushes", s.Dimensions, atomic.LoadInt64(&s.stats.flushes)),
+	}
+}
+
+// Flush adds everything aggregated since the last flush to the Sink
+func (s *Server) Flush(ctx context.Context) error {
+	atomic.AddInt64(&s.stats.flushes, 1)
+	dps := s.Aggregator.Flush(s.Timer.Now())
+	if len(dps) == 0 {
+		return nil
+	}
+	return errors.Annotate(s.Sink.AddDatapoints(ctx, dps), "cannot flush statsd datapoints")
+}
+
+// Run flushes every FlushInterval until ctx is done, the server is closed or the ErrorHandler returns an
+// error.  This is intended to be run inside a goroutine.
+func (s *Server) Run(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return errors.Annotate(ctx.Err(), "context closed")
+		case <-s.closed:
+			return nil
+		case <-s.Timer.After(s.FlushInterval):
+			if err := s.Flush(ctx); err != nil {
+				if err2 := errors.Annotate(s.ErrorHandler(err), "error handler returned an error"); err2 != nil {
+					return err2
+				}
+			}
+		}
+	}
+}
+
+// Close stops listening and waits for connections to finish.  It doesn't flush.
+func (s *Server) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+	})
+	s.mu.Lock()
+	closers := s.closers
+	s.closers = nil
+	s.mu.Unlock()
+	errs := make([]error, 0, len(closers))
+	for _, c := range closers {
+		errs = append(errs, c())
+	}
+	s.wg.Wait()
+	return errors.NewMultiErr(errs)
+}
@@ -0,0 +1,131 @@
+package statsd
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	golibErrors "github.com/signalfx/golib/v3/errors"
+	"github.com/signalfx/golib/v3/timekeeper/timekeepertest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type captureSink struct {
+	mu  sync.Mutex
+	dps []*datapoint.Datapoint
+	err error
+}
+
+func (c *captureSink) AddDatapoints(ctx context.Context, points []*datapoint.Datapoint) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dps = append(c.dps, points...)
+	return c.err
+}
+
+func (c *captureSink) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.dps)
+}
+
+func TestServer(t *testing.T) {
+	Convey("a statsd server", t, func() {
+		sink := &captureSink{}
+		s := NewServer(sink)
+		clock := timekeepertest.NewStubClock(time.Unix(100, 0))
+		s.Timer = clock
+		ctx := context.Background()
+		// waitForLines waits until the server has handled n lines
+		waitForLines := func(n int64) {
+			for s.Datapoints()[0].Value.(datapoint.IntValue).Int() < n {
+				time.Sleep(time.Millisecond)
+			}
+		}
+		Convey("should receive lines over UDP", func() {
+			addr, err := s.ListenUDP("127.0.0.1:0")
+			So(err, ShouldBeNil)
+			conn, err := net.Dial("udp", addr.String())
+			So(err, ShouldBeNil)
+			_, err = conn.Write([]byte("a:1|c\na:2|c\n\nbad\n"))
+			So(err, ShouldBeNil)
+			So(conn.Close(), ShouldBeNil)
+			waitForLines(3)
+			So(s.Flush(ctx), ShouldBeNil)
+			So(sink.dps[0].Metric, ShouldEqual, "a")
+			So(sink.dps[0].Value, ShouldResemble, datapoint.NewIntValue(3))
+			So(sink.dps[0].Timestamp, ShouldEqual, clock.Now())
+			So(s.Datapoints()[1].Value, ShouldResemble, datapoint.NewIntValue(1))
+		})
+		Convey("should receive lines over TCP", func() {
+			addr, err := s.ListenTCP("127.0.0.1:0")
+			So(err, ShouldBeNil)
+			conn, err := net.Dial("tcp", addr.String())
+			So(err, ShouldBeNil)
+			_, err = conn.Write([]byte("g:5|g\ng:+1|g\n"))
+			So(err, ShouldBeNil)
+			waitForLines(2)
+			So(s.Flush(ctx), ShouldBeNil)
+			So(sink.dps[0].Value, ShouldResemble, datapoint.NewIntValue(6))
+			Convey("and close open connections", func() {
+				So(s.Close(), ShouldBeNil)
+				_, err := conn.Read(make([]byte, 1))
+				So(err, ShouldNotBeNil)
+			})
+		})
+		Convey("should fail to listen on bad addresses", func() {
+			_, err := s.ListenUDP("not an address")
+			So(err, ShouldNotBeNil)
+			_, err = s.ListenTCP("not an address")
+			So(err, ShouldNotBeNil)
+		})
+		Convey("should not call the sink with nothing to flush", func() {
+			So(s.Flush(ctx), ShouldBeNil)
+			So(sink.len(), ShouldEqual, 0)
+		})
+		Convey("should flush on an interval until closed", func() {
+			s.Add(&Metric{Name: "g", Type: Gauge, Value: 1, SampleRate: 1})
+			done := make(chan error)
+			go func() {
+				done <- s.Run(ctx)
+			}()
+			for sink.len() < 2 {
+				clock.Incr(s.FlushInterval)
+				time.Sleep(time.Millisecond)
+			}
+			So(s.Close(), ShouldBeNil)
+			So(<-done, ShouldBeNil)
+		})
+		Convey("should stop running when the context is done", func() {
+			ctx, cancel := context.WithCancel(ctx)
+			cancel()
+			So(golibErrors.Tail(s.Run(ctx)), ShouldEqual, context.Canceled)
+		})
+		Convey("should report flush errors", func() {
+			sink.err = errors.New("nope")
+			s.Add(&Metric{Name: "g", Type: Gauge, Value: 1, SampleRate: 1})
+			s.FlushInterval = time.Millisecond
+			s.Timer = timekeepertest.NewStubClock(time.Now())
+			var handled error
+			s.ErrorHandler = func(err error) error {
+				handled = err
+				return err
+			}
+			go func() {
+				for s.Datapoints()[2].Value.(datapoint.IntValue).Int() == 0 {
+					s.Timer.(*timekeepertest.StubClock).Incr(time.Millisecond)
+					time.Sleep(time.Millisecond)
+				}
+			}()
+			So(s.Run(ctx), ShouldNotBeNil)
+			So(handled.Error(), ShouldContainSubstring, "nope")
+		})
+		Reset(func() {
+			So(s.Close(), ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,235 @@
+package sfxclient
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/errors"
+	"github.com/signalfx/golib/v3/timekeeper"
+	"github.com/signalfx/golib/v3/trace"
+)
+
+const (
+	// DefaultTailSamplingWait is how long a TailSamplingSink buffers the spans of a trace by default
+	DefaultTailSamplingWait = time.Second * 10
+	// DefaultTailSamplingMaxTraces is how many traces a TailSamplingSink buffers at most by default
+	DefaultTailSamplingMaxTraces = 10000
+	// minTailSamplingTick is the least time Run waits between deciding traces, however short Wait is
+	minTailSamplingTick = time.Millisecond
+)
+
+// ErrInvalidTailSamplingWait is returned by TailSamplingSink.Run if Wait isn't positive
+var ErrInvalidTailSamplingWait = errors.New("tail sampling wait must be positive")
+
+// A TailSamplingPolicy decides whether to keep a whole trace, given the spans of it that were buffered
+type TailSamplingPolicy func(spans []*trace.Span) bool
+
+// ErrorPolicy keeps traces with a span tagged as an error
+func ErrorPolicy() TailSamplingPolicy {
+	return func(spans []*trace.Span) bool {
+		for _, s := range spans {
+			if v, exists := s.Tags[trace.ErrorTag]; exists && !strings.EqualFold(v, "false") {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// LatencyPolicy keeps traces with a span that took at least threshold
+func LatencyPolicy(threshold time.Duration) TailSamplingPolicy {
+	return func(spans []*trace.Span) bool {
+		for _, s := range spans {
+			if s.Duration != nil && time.Duration(*s.Duration)*time.Microsecond >= threshold {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// TagPolicy keeps traces with a span tagged key=value, or with the tag key at all if value is empty
+func TagPolicy(key string, value string) TailSamplingPolicy {
+	return func(spans []*trace.Span) bool {
+		for _, s := range spans {
+			if v, exists := s.Tags[key]; exists && (value == "" || v == value) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// pendingTrace is the spans of a trace buffered until it's decided
+type pendingTrace struct {
+	spans     []*trace.Span
+	firstSeen time.Time
+}
+
+// TailSamplingSink buffers spans by trace ID for Wait after the first span of a trace arrives, then
+// forwards the whole trace to the next sink if any of Policies keeps it, and drops it if not, so only
+// interesting traces are paid for.  Spans of a trace that arrive after it was decided start a new one.
+type TailSamplingSink struct {
+	// Wait is how long the spans of a trace are buffered before it's decided
+	Wait time.Duration
+	// MaxTraces is how many traces are buffered at most.  The oldest trace is decided early to make room
+	// for a new one past it.
+	MaxTraces int
+	// Policies keep a trace if any of them does
+	Policies []TailSamplingPolicy
+	Timer    timekeeper.TimeKeeper
+	// ErrorHandler is called when forwarding fails.  Run stops if it returns an error
+	ErrorHandler func(error) error
+
+	next trace.Sink
+
+	mu     sync.Mutex
+	traces map[string]*pendingTrace
+	// order is the IDs of traces in the order they were first seen, which is the order they're decided in
+	order []string
+
+	stats struct {
+		received      int64
+		keptTraces    int64
+		droppedTraces int64
+	}
+}
+
+var _ trace.Sink = &TailSamplingSink{}
+
+// NewTailSamplingSink creates a sink forwarding the traces any of policies keep to next
+func NewTailSamplingSink(next trace.Sink, policies ...TailSamplingPolicy) *TailSamplingSink {
+	return &TailSamplingSink{
+		Wait:         DefaultTailSamplingWait,
+		MaxTraces:    DefaultTailSamplingMaxTraces,
+		Policies:     policies,
+		Timer:        timekeeper.RealTime{},
+		ErrorHandler: DefaultErrorHandler,
+		next:         next,
+		traces:       make(map[string]*pendingTrace),
+	}
+}
+
+// AddSpans buffers spans until their traces are decided.  Only forwarding traces decided early, to make
+// room, can fail.
+func (t *TailSamplingSink) AddSpans(ctx context.Context, spans []*trace.Span) error {
+	atomic.AddInt64(&t.stats.received, int64(len(spans)))
+	now := t.Timer.Now()
+	var decided []*pendingTrace
+	t.mu.Lock()
+	for _, s := range spans {
+		pending, exists := t.traces[s.TraceID]
+		if !exists {
+			if t.MaxTraces > 0 && len(t.order) >= t.MaxTraces {
+				decided = append(decided, t.pop())
+			}
+			pending = &pendingTrace{firstSeen: now}
+			t.traces[s.TraceID] = pending
+			t.order = append(t.order, s.TraceID)
+		}
+		pending.spans = append(pending.spans, s)
+	}
+	t.mu.Unlock()
+	return t.forward(ctx, decided)
+}
+
+// pop removes the oldest trace.  t.mu must be held.
+func (t *TailSamplingSink) pop() *pendingTrace {
+	id := t.order[0]
+	t.order = t.order[1:]
+	pending := t.traces[id]
+	delete(t.traces, id)
+	return pending
+}
+
+// forward sends the spans of the traces the policies keep to the next sink
+func (t *TailSamplingSink) forward(ctx context.Context, traces []*pendingTrace) error {
+	var kept []*trace.Span
+	for _, pending := range traces {
+		if t.keep(pending.spans) {
+			atomic.AddInt64(&t.stats.keptTraces, 1)
+			kept = append(kept, pending.spans...)
+		} else {
+			atomic.AddInt64(&t.stats.droppedTraces, 1)
+		}
+	}
+	if len(kept) == 0 {
+		return nil
+	}
+	return errors.Annotate(t.next.AddSpans(ctx, kept), "cannot forward sampled traces")
+}
+
+func (t *TailSamplingSink) keep(spans []*trace.Span) bool {
+	for _, policy := range t.Policies {
+		if policy(spans) {
+			return true
+		}
+	}
+	return false
+}
+
+// decide removes the traces first seen before cutoff, or every trace if cutoff is zero, and forwards the
+// ones the policies keep
+func (t *TailSamplingSink) decide(ctx context.Context, cutoff time.Time) error {
+	var decided []*pendingTrace
+	t.mu.Lock()
+	for len(t.order) > 0 && (cutoff.IsZero() || t.traces[t.order[0]].firstSeen.Before(cutoff)) {
+		decided = append(decided, t.pop())
+	}
+	if len(t.order) == 0 {
+		t.order = nil
+	}
+	t.mu.Unlock()
+	return t.forward(ctx, decided)
+}
+
+// Flush decides every buffered trace now, however long it's been buffered
+func (t *TailSamplingSink) Flush(ctx context.Context) error {
+	return t.decide(ctx, time.Time{})
+}
+
+// Run decides traces once they've been buffered for Wait until ctx is done, deciding every trace left
+// then, or the ErrorHandler returns an error.  This is intended to be run inside a goroutine.  It returns
+// ErrInvalidTailSamplingWait right away if Wait isn't positive.
+func (t *TailSamplingSink) Run(ctx context.Context) error {
+	if t.Wait <= 0 {
+		return ErrInvalidTailSamplingWait
+	}
+	tick := t.Wait / 4
+	if tick < minTailSamplingTick {
+		tick = minTailSamplingTick
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			if err := t.Flush(context.Background()); err != nil {
+				_ = t.ErrorHandler(err)
+			}
+			return errors.Annotate(ctx.Err(), "context closed")
+		case <-t.Timer.After(tick):
+			if err := t.decide(ctx, t.Timer.Now().Add(-t.Wait)); err != nil {
+				if err2 := errors.Annotate(t.ErrorHandler(err), "error handler returned an error"); err2 != nil {
+					return err2
+				}
+			}
+		}
+	}
+}
+
+// Datapoints returns how many spans the sink received, how many traces it kept and dropped, and how many
+// it's buffering
+func (t *TailSamplingSink) Datapoints() []*datapoint.Datapoint {
+	t.mu.Lock()
+	buffered := len(t.order)
+	t.mu.Unlock()
+	return []*datapoint.Datapoint{
+		Cumulative("total_tail_sampling_spans_received", nil, atomic.LoadInt64(&t.stats.received)),
+		Cumulative("total_tail_sampling_traces_kept", nil, atomic.LoadInt64(&t.stats.keptTraces)),
+		Cumulative("total_tail_sampling_traces_dropped", nil, atomic.LoadInt64(&t.stats.droppedTraces)),
+		Gauge("tail_sampling_traces_buffered", nil, int64(buffered)),
+	}
+}
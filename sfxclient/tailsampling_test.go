@@ -0,0 +1,133 @@
+package sfxclient
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/errors"
+	"github.com/signalfx/golib/v3/pointer"
+	"github.com/signalfx/golib/v3/timekeeper/timekeepertest"
+	"github.com/signalfx/golib/v3/trace"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTailSamplingPolicies(t *testing.T) {
+	Convey("tail sampling policies", t, func() {
+		ok := &trace.Span{Tags: map[string]string{trace.ErrorTag: "false", "tier": "gold"}, Duration: pointer.Int64(1000)}
+		failed := &trace.Span{Tags: map[string]string{trace.ErrorTag: "true"}}
+		So(ErrorPolicy()([]*trace.Span{ok}), ShouldBeFalse)
+		So(ErrorPolicy()([]*trace.Span{ok, failed}), ShouldBeTrue)
+		So(LatencyPolicy(time.Millisecond)([]*trace.Span{failed, ok}), ShouldBeTrue)
+		So(LatencyPolicy(time.Second)([]*trace.Span{failed, ok}), ShouldBeFalse)
+		So(TagPolicy("tier", "gold")([]*trace.Span{ok}), ShouldBeTrue)
+		So(TagPolicy("tier", "")([]*trace.Span{ok}), ShouldBeTrue)
+		So(TagPolicy("tier", "silver")([]*trace.Span{ok}), ShouldBeFalse)
+	})
+}
+
+func TestTailSamplingSink(t *testing.T) {
+	Convey("a tail sampling sink", t, func() {
+		ctx := context.Background()
+		next := &recordingSink{}
+		clock := timekeepertest.NewStubClock(time.Now())
+		s := NewTailSamplingSink(next, ErrorPolicy())
+		s.Timer = clock
+		span := func(traceID string, isError bool) *trace.Span {
+			ret := &trace.Span{TraceID: traceID, ID: trace.NewID(), Tags: map[string]string{}}
+			if isError {
+				ret.Tags[trace.ErrorTag] = "true"
+			}
+			return ret
+		}
+		good, bad := span("good", false), span("bad", false)
+		So(s.AddSpans(ctx, []*trace.Span{good, bad}), ShouldBeNil)
+		clock.Incr(time.Second)
+		badError := span("bad", true)
+		So(s.AddSpans(ctx, []*trace.Span{badError}), ShouldBeNil)
+		So(len(next.spans), ShouldEqual, 0)
+		stat := func(i int) datapoint.Value {
+			return s.Datapoints()[i].Value
+		}
+		So(stat(3), ShouldResemble, datapoint.NewIntValue(2))
+
+		Convey("should forward whole traces the policies keep", func() {
+			So(s.Flush(ctx), ShouldBeNil)
+			So(next.spans, ShouldResemble, []*trace.Span{bad, badError})
+			So(stat(0), ShouldResemble, datapoint.NewIntValue(3))
+			So(stat(1), ShouldResemble, datapoint.NewIntValue(1))
+			So(stat(2), ShouldResemble, datapoint.NewIntValue(1))
+			So(stat(3), ShouldResemble, datapoint.NewIntValue(0))
+		})
+		Convey("should only decide traces buffered for the wait", func() {
+			So(s.AddSpans(ctx, []*trace.Span{span("new", true)}), ShouldBeNil)
+			So(s.decide(ctx, clock.Now().Add(-time.Second/2)), ShouldBeNil)
+			So(next.spans, ShouldResemble, []*trace.Span{bad, badError})
+			So(stat(3), ShouldResemble, datapoint.NewIntValue(1))
+		})
+		Convey("should decide the oldest trace early to make room", func() {
+			s.MaxTraces = 2
+			So(s.AddSpans(ctx, []*trace.Span{span("new", false)}), ShouldBeNil)
+			So(len(next.spans), ShouldEqual, 0)
+			So(s.AddSpans(ctx, []*trace.Span{span("newer", false)}), ShouldBeNil)
+			So(next.spans, ShouldResemble, []*trace.Span{bad, badError})
+		})
+		Convey("should annotate forwarding errors", func() {
+			errBad := errors.New("bad")
+			next.errs = []error{errBad}
+			So(errors.Cause(s.Flush(ctx)), ShouldEqual, errBad)
+		})
+		Convey("should run until the context is done", func() {
+			errBad := errors.New("bad")
+			next.errs = []error{errBad}
+			handled := make(chan error, 1)
+			s.ErrorHandler = func(err error) error {
+				handled <- err
+				return nil
+			}
+			runCtx, cancel := context.WithCancel(ctx)
+			done := make(chan error)
+			go func() {
+				done <- s.Run(runCtx)
+			}()
+			for len(handled) == 0 {
+				clock.Incr(s.Wait / 4)
+				runtime.Gosched()
+			}
+			So(errors.Cause(<-handled), ShouldEqual, errBad)
+			last := span("last", true)
+			So(s.AddSpans(ctx, []*trace.Span{last}), ShouldBeNil)
+			cancel()
+			So(errors.Cause(<-done), ShouldEqual, context.Canceled)
+			So(next.spans, ShouldResemble, []*trace.Span{last})
+		})
+		Convey("should refuse to run without a positive wait", func() {
+			for _, wait := range []time.Duration{0, -time.Second} {
+				s.Wait = wait
+				So(s.Run(ctx), ShouldEqual, ErrInvalidTailSamplingWait)
+			}
+		})
+		Convey("should stop running if the error handler says to", func() {
+			next.errs = []error{errors.New("bad")}
+			s.ErrorHandler = func(err error) error {
+				return err
+			}
+			done := make(chan error)
+			go func() {
+				done <- s.Run(ctx)
+			}()
+			for {
+				clock.Incr(s.Wait / 4)
+				select {
+				case err := <-done:
+					So(err, ShouldNotBeNil)
+					return
+				default:
+					runtime.Gosched()
+				}
+			}
+		})
+	})
+}
@@ -0,0 +1,88 @@
+package sfxclient
+
+import (
+	"math"
+	"sort"
+)
+
+// DefaultCompression bounds a t-digest to roughly this many centroids.  Higher is more accurate and
+// bigger.
+const DefaultCompression = 100
+
+// centroid is the mean of weight values close to each other
+type centroid struct {
+	mean   float64
+	weight float64
+}
+
+// tdigest estimates quantiles from centroids that are small near the tails and big in the middle, after
+// Dunning's merging t-digest.  It isn't thread safe.
+type tdigest struct {
+	compression float64
+	centroids   []centroid
+	total       float64
+}
+
+// add merges values into the digest
+func (t *tdigest) add(values []float64) {
+	if len(values) == 0 {
+		return
+	}
+	merged := make([]centroid, 0, len(t.centroids)+len(values))
+	merged = append(merged, t.centroids...)
+	for _, v := range values {
+		merged = append(merged, centroid{mean: v, weight: 1})
+	}
+	sort.Slice(merged, func(i, j int) bool {
+		return merged[i].mean < merged[j].mean
+	})
+	t.total += float64(len(values))
+	compression := t.compression
+	if compression <= 0 {
+		compression = DefaultCompression
+	}
+	// merging in place is safe: out never grows past the centroid being read
+	out := merged[:0]
+	cur := merged[0]
+	cumulative := 0.0
+	for _, c := range merged[1:] {
+		q := (cumulative + (cur.weight+c.weight)/2) / t.total
+		if cur.weight+c.weight <= 4*t.total*q*(1-q)/compression {
+			cur.weight += c.weight
+			cur.mean += (c.mean - cur.mean) * c.weight / cur.weight
+			continue
+		}
+		cumulative += cur.weight
+		out = append(out, cur)
+		cur = c
+	}
+	t.centroids = append(out, cur)
+}
+
+// quantile estimates the value q of the way through what's been added, interpolating between the centers
+// of centroids.  It's NaN if nothing has been.
+func (t *tdigest) quantile(q float64) float64 {
+	if len(t.centroids) == 0 {
+		return math.NaN()
+	}
+	target := q * t.total
+	cumulative := 0.0
+	for i, c := range t.centroids {
+		mid := cumulative + c.weight/2
+		if target < mid {
+			if i == 0 {
+				return c.mean
+			}
+			prev := t.centroids[i-1]
+			prevMid := cumulative - prev.weight/2
+			return prev.mean + (c.mean-prev.mean)*(target-prevMid)/(mid-prevMid)
+		}
+		cumulative += c.weight
+	}
+	return t.centroids[len(t.centroids)-1].mean
+}
+
+func (t *tdigest) reset() {
+	t.centroids = t.centroids[:0]
+	t.total = 0
+}
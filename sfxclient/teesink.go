@@ -0,0 +1,133 @@
+package sfxclient
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/errors"
+	"github.com/signalfx/golib/v3/event"
+	"github.com/signalfx/golib/v3/trace"
+)
+
+// TeeMode is when a TeeSink call fails
+type TeeMode int
+
+const (
+	// TeeAllMustSucceed fails a call if any downstream fails
+	TeeAllMustSucceed TeeMode = iota
+	// TeeBestEffort only fails a call if every downstream fails
+	TeeBestEffort
+)
+
+// the kinds of data a TeeSink counts
+const (
+	teeDatapoints = iota
+	teeEvents
+	teeSpans
+)
+
+var teeKinds = [...]string{teeDatapoints: "datapoints", teeEvents: "events", teeSpans: "spans"}
+
+// TeeSink sends everything to two or more downstream sinks at once, like SignalFx and an OpenTelemetry
+// collector during a migration.  Each downstream is sent to and counted independently, so one that is
+// slow or down doesn't hold up the others.
+type TeeSink struct {
+	Mode TeeMode
+	// ErrorHandler, when set, is called with every error a downstream returns
+	ErrorHandler func(downstream string, err error)
+
+	downstreams []*teeDownstream
+}
+
+type teeDownstream struct {
+	name   string
+	sink   FullSink
+	sent   [len(teeKinds)]int64
+	failed [len(teeKinds)]int64
+}
+
+// NewTeeSink creates a TeeSink that must succeed at sending to all of sinks, named by their position
+func NewTeeSink(sinks ...FullSink) *TeeSink {
+	t := &TeeSink{}
+	for i, sink := range sinks {
+		t.AddDownstream(strconv.Itoa(i), sink)
+	}
+	return t
+}
+
+// AddDownstream adds a sink to send to, named name in errors and datapoints.  It isn't safe to call once
+// the TeeSink is in use.
+func (t *TeeSink) AddDownstream(name string, sink FullSink) *TeeSink {
+	t.downstreams = append(t.downstreams, &teeDownstream{name: name, sink: sink})
+	return t
+}
+
+// AddDatapoints sends points to every downstream
+func (t *TeeSink) AddDatapoints(ctx context.Context, points []*datapoint.Datapoint) error {
+	return teeAdd(ctx, t, teeDatapoints, points, func(s FullSink) func(context.Context, []*datapoint.Datapoint) error {
+		return s.AddDatapoints
+	})
+}
+
+// AddEvents sends events to every downstream
+func (t *TeeSink) AddEvents(ctx context.Context, events []*event.Event) error {
+	return teeAdd(ctx, t, teeEvents, events, func(s FullSink) func(context.Context, []*event.Event) error {
+		return s.AddEvents
+	})
+}
+
+// AddSpans sends spans to every downstream
+func (t *TeeSink) AddSpans(ctx context.Context, spans []*trace.Span) error {
+	return teeAdd(ctx, t, teeSpans, spans, func(s FullSink) func(context.Context, []*trace.Span) error {
+		return s.AddSpans
+	})
+}
+
+// teeAdd sends items to every downstream in parallel, counting what each sent and failed to
+func teeAdd[T any](ctx context.Context, t *TeeSink, kind int, items []T, add func(FullSink) func(context.Context, []T) error) error {
+	errs := make([]error, len(t.downstreams))
+	var wg sync.WaitGroup
+	for i, d := range t.downstreams {
+		wg.Add(1)
+		go func(i int, d *teeDownstream) {
+			defer wg.Done()
+			if err := add(d.sink)(ctx, items); err != nil {
+				atomic.AddInt64(&d.failed[kind], int64(len(items)))
+				if t.ErrorHandler != nil {
+					t.ErrorHandler(d.name, err)
+				}
+				errs[i] = errors.Annotatef(err, "cannot send %s to %s", teeKinds[kind], d.name)
+				return
+			}
+			atomic.AddInt64(&d.sent[kind], int64(len(items)))
+		}(i, d)
+	}
+	wg.Wait()
+	err := errors.NewMultiErr(errs)
+	if t.Mode == TeeBestEffort {
+		for _, e := range errs {
+			if e == nil {
+				return nil
+			}
+		}
+	}
+	return err
+}
+
+// Datapoints returns how many datapoints, events and spans each downstream was sent and failed to be sent
+func (t *TeeSink) Datapoints() []*datapoint.Datapoint {
+	dps := make([]*datapoint.Datapoint, 0, len(t.downstreams)*len(teeKinds)*2)
+	for _, d := range t.downstreams {
+		dims := map[string]string{"downstream": d.name}
+		for kind, name := range teeKinds {
+			dps = append(dps,
+				Cumulative("total_tee_"+name+"_sent", dims, atomic.LoadInt64(&d.sent[kind])),
+				Cumulative("total_tee_"+name+"_failed", dims, atomic.LoadInt64(&d.failed[kind])),
+			)
+		}
+	}
+	return dps
+}
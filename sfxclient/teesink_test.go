@@ -0,0 +1,86 @@
+package sfxclient
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/errors"
+	"github.com/signalfx/golib/v3/event"
+	"github.com/signalfx/golib/v3/trace"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTeeSink(t *testing.T) {
+	Convey("A TeeSink", t, func() {
+		ctx := context.Background()
+		sfx := &recordingSink{}
+		otel := &recordingSink{}
+		tee := NewTeeSink().AddDownstream("sfx", sfx).AddDownstream("otel", otel)
+		var mu sync.Mutex
+		failures := make(map[string]int)
+		tee.ErrorHandler = func(downstream string, err error) {
+			mu.Lock()
+			failures[downstream]++
+			mu.Unlock()
+		}
+		points := []*datapoint.Datapoint{GaugeF("a", nil, 1), GaugeF("b", nil, 2)}
+		events := []*event.Event{event.New("e", event.USERDEFINED, nil, time.Time{})}
+		spans := []*trace.Span{{ID: "a"}}
+		counts := func() map[string]int64 {
+			ret := make(map[string]int64)
+			for _, dp := range tee.Datapoints() {
+				ret[dp.Metric+"."+dp.Dimensions["downstream"]] = dp.Value.(datapoint.IntValue).Int()
+			}
+			return ret
+		}
+
+		Convey("should send everything to every downstream", func() {
+			So(tee.AddDatapoints(ctx, points), ShouldBeNil)
+			So(tee.AddEvents(ctx, events), ShouldBeNil)
+			So(tee.AddSpans(ctx, spans), ShouldBeNil)
+			for _, sink := range []*recordingSink{sfx, otel} {
+				So(len(sink.points), ShouldEqual, 2)
+				So(len(sink.events), ShouldEqual, 1)
+				So(len(sink.spans), ShouldEqual, 1)
+			}
+			c := counts()
+			So(c["total_tee_datapoints_sent.sfx"], ShouldEqual, 2)
+			So(c["total_tee_events_sent.otel"], ShouldEqual, 1)
+			So(c["total_tee_spans_failed.otel"], ShouldEqual, 0)
+		})
+		Convey("when a downstream fails", func() {
+			otel.errs = []error{errors.New("collector down")}
+			Convey("should fail if all must succeed", func() {
+				err := tee.AddDatapoints(ctx, points)
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "collector down")
+				So(errors.Details(err), ShouldContainSubstring, "cannot send datapoints to otel")
+				So(len(sfx.points), ShouldEqual, 2)
+				c := counts()
+				So(c["total_tee_datapoints_sent.sfx"], ShouldEqual, 2)
+				So(c["total_tee_datapoints_failed.otel"], ShouldEqual, 2)
+				So(failures, ShouldResemble, map[string]int{"otel": 1})
+			})
+			Convey("should succeed if best effort", func() {
+				tee.Mode = TeeBestEffort
+				So(tee.AddDatapoints(ctx, points), ShouldBeNil)
+				Convey("unless every downstream fails", func() {
+					sfx.errs = []error{errors.New("ingest down")}
+					otel.errs = []error{errors.New("collector down")}
+					So(tee.AddSpans(ctx, spans), ShouldNotBeNil)
+					So(failures, ShouldResemble, map[string]int{"otel": 2, "sfx": 1})
+				})
+			})
+		})
+		Convey("should name unnamed downstreams by position", func() {
+			tee = NewTeeSink(sfx, otel)
+			So(tee.AddEvents(ctx, events), ShouldBeNil)
+			c := counts()
+			So(c["total_tee_events_sent.0"], ShouldEqual, 1)
+			So(c["total_tee_events_sent.1"], ShouldEqual, 1)
+		})
+	})
+}
@@ -0,0 +1,114 @@
+package sfxclient
+
+import (
+	"context"
+	"strings"
+
+	"github.com/signalfx/golib/v3/log"
+)
+
+// TokenKey and TokenSchemeKey are the log keys TokenLogExtractor logs a context's token under
+const (
+	TokenKey       = log.Key("token")
+	TokenSchemeKey = log.Key("token_scheme")
+)
+
+// TokenScheme is how a Token authenticates with SignalFx
+type TokenScheme int
+
+const (
+	// OrgTokenScheme is an organization access token, sent in the X-Sf-Token header
+	OrgTokenScheme TokenScheme = iota
+	// SessionTokenScheme is a user session token, sent in the X-Sf-Token header
+	SessionTokenScheme
+	// BearerTokenScheme is a token sent as "Authorization: Bearer <token>"
+	BearerTokenScheme
+)
+
+// AuthorizationHeaderName is the header bearer tokens are sent in by default
+const AuthorizationHeaderName = "Authorization"
+
+var tokenSchemeNames = map[TokenScheme]string{
+	OrgTokenScheme:     "org",
+	SessionTokenScheme: "session",
+	BearerTokenScheme:  "bearer",
+}
+
+func (s TokenScheme) String() string {
+	if name, exists := tokenSchemeNames[s]; exists {
+		return name
+	}
+	return "unknown"
+}
+
+var defaultAuthHeaders = map[TokenScheme]string{
+	OrgTokenScheme:     TokenHeaderName,
+	SessionTokenScheme: TokenHeaderName,
+	BearerTokenScheme:  AuthorizationHeaderName,
+}
+
+// Token is an auth token along with the scheme used to send it.  Metadata is free form information
+// about the token, like where it came from, and is never sent.
+type Token struct {
+	Value    string
+	Scheme   TokenScheme
+	Metadata map[string]string
+}
+
+// header returns the header name and value to send the token with.  headers overrides the default
+// header name of each scheme.
+func (t Token) header(headers map[TokenScheme]string) (string, string) {
+	name, exists := headers[t.Scheme]
+	if !exists {
+		name = defaultAuthHeaders[t.Scheme]
+	}
+	if name == "" {
+		name = TokenHeaderName
+	}
+	if t.Scheme == BearerTokenScheme && strings.EqualFold(name, AuthorizationHeaderName) {
+		return name, "Bearer " + t.Value
+	}
+	return name, t.Value
+}
+
+// ContextWithToken returns a copy of ctx that carries token
+func ContextWithToken(ctx context.Context, token Token) context.Context {
+	return context.WithValue(ctx, TokenCtxKey, token)
+}
+
+// TokenFromContext returns the Token stored on ctx by ContextWithToken.  For backwards compatibility a
+// string stored with the TokenCtxKey or TokenHeaderName keys is returned as an org token.
+func TokenFromContext(ctx context.Context) (Token, bool) {
+	switch t := ctx.Value(TokenCtxKey).(type) {
+	case Token:
+		return t, true
+	case *Token:
+		if t != nil {
+			return *t, true
+		}
+	case string:
+		return Token{Value: t}, true
+	}
+	if t, ok := ctx.Value(TokenHeaderName).(string); ok {
+		return Token{Value: t}, true
+	}
+	return Token{}, false
+}
+
+// Redacted returns the token's value with all but its last four characters masked, so it can be logged
+func (t Token) Redacted() string {
+	const shown = 4
+	if len(t.Value) <= shown {
+		return strings.Repeat("*", len(t.Value))
+	}
+	return strings.Repeat("*", len(t.Value)-shown) + t.Value[len(t.Value)-shown:]
+}
+
+// TokenLogExtractor is a log.ContextExtractor of the redacted token, and its scheme, stored on a context
+func TokenLogExtractor(ctx context.Context) []interface{} {
+	token, ok := TokenFromContext(ctx)
+	if !ok || token.Value == "" {
+		return nil
+	}
+	return []interface{}{TokenKey, token.Redacted(), TokenSchemeKey, token.Scheme.String()}
+}
@@ -0,0 +1,115 @@
+package sfxclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTokenFromContext(t *testing.T) {
+	Convey("TokenFromContext", t, func() {
+		Convey("should return tokens set with ContextWithToken", func() {
+			tok := Token{Value: "abc", Scheme: BearerTokenScheme, Metadata: map[string]string{"source": "test"}}
+			got, ok := TokenFromContext(ContextWithToken(context.Background(), tok))
+			So(ok, ShouldBeTrue)
+			So(got, ShouldResemble, tok)
+		})
+		Convey("should accept token pointers", func() {
+			got, ok := TokenFromContext(context.WithValue(context.Background(), TokenCtxKey, &Token{Value: "abc"}))
+			So(ok, ShouldBeTrue)
+			So(got.Value, ShouldEqual, "abc")
+		})
+		Convey("should return raw strings as org tokens", func() {
+			got, ok := TokenFromContext(context.WithValue(context.Background(), TokenCtxKey, "abc"))
+			So(ok, ShouldBeTrue)
+			So(got, ShouldResemble, Token{Value: "abc", Scheme: OrgTokenScheme})
+			// nolint:golint,staticcheck,revive
+			got, ok = TokenFromContext(context.WithValue(context.Background(), TokenHeaderName, "def"))
+			So(ok, ShouldBeTrue)
+			So(got.Value, ShouldEqual, "def")
+		})
+		Convey("should return false without a token", func() {
+			_, ok := TokenFromContext(context.Background())
+			So(ok, ShouldBeFalse)
+			_, ok = TokenFromContext(context.WithValue(context.Background(), TokenCtxKey, 1))
+			So(ok, ShouldBeFalse)
+		})
+	})
+}
+
+func TestTokenLogExtractor(t *testing.T) {
+	Convey("TokenLogExtractor", t, func() {
+		Convey("should log the token redacted", func() {
+			ctx := ContextWithToken(context.Background(), Token{Value: "abcdefgh", Scheme: BearerTokenScheme})
+			So(TokenLogExtractor(ctx), ShouldResemble, []interface{}{TokenKey, "****efgh", TokenSchemeKey, "bearer"})
+			So(Token{Value: "abc"}.Redacted(), ShouldEqual, "***")
+		})
+		Convey("should log nothing without a token", func() {
+			So(TokenLogExtractor(context.Background()), ShouldBeNil)
+		})
+	})
+}
+
+func TestTokenScheme(t *testing.T) {
+	Convey("token schemes should have names", t, func() {
+		So(OrgTokenScheme.String(), ShouldEqual, "org")
+		So(SessionTokenScheme.String(), ShouldEqual, "session")
+		So(BearerTokenScheme.String(), ShouldEqual, "bearer")
+		So(TokenScheme(-1).String(), ShouldEqual, "unknown")
+	})
+}
+
+func TestSetTokenHeaderSchemes(t *testing.T) {
+	Convey("setTokenHeader", t, func() {
+		h := NewHTTPSink()
+		h.AuthToken = "foo"
+		req := httptest.NewRequest(http.MethodPost, "/v2/datapoint", nil)
+		Convey("should send bearer tokens in the Authorization header", func() {
+			h.setTokenHeader(ContextWithToken(context.Background(), Token{Value: "bar", Scheme: BearerTokenScheme}), req)
+			So(req.Header.Get(AuthorizationHeaderName), ShouldEqual, "Bearer bar")
+			So(req.Header.Get(TokenHeaderName), ShouldEqual, "")
+		})
+		Convey("should send session tokens in X-Sf-Token", func() {
+			h.setTokenHeader(ContextWithToken(context.Background(), Token{Value: "bar", Scheme: SessionTokenScheme}), req)
+			So(req.Header.Get(TokenHeaderName), ShouldEqual, "bar")
+		})
+		Convey("should use the sink's scheme for AuthToken", func() {
+			h.AuthScheme = BearerTokenScheme
+			h.setTokenHeader(context.Background(), req)
+			So(req.Header.Get(AuthorizationHeaderName), ShouldEqual, "Bearer foo")
+		})
+		Convey("should let the sink pick the header per scheme", func() {
+			WithAuthHeader(BearerTokenScheme, "X-Custom-Auth")(h)
+			WithAuthHeader(OrgTokenScheme, AuthorizationHeaderName)(h)
+			h.setTokenHeader(ContextWithToken(context.Background(), Token{Value: "bar", Scheme: BearerTokenScheme}), req)
+			So(req.Header.Get("X-Custom-Auth"), ShouldEqual, "bar")
+			h.setTokenHeader(context.Background(), req)
+			So(req.Header.Get(AuthorizationHeaderName), ShouldEqual, "foo")
+		})
+	})
+}
+
+func TestAsyncMultiTokenSinkTokenSchemes(t *testing.T) {
+	Convey("an AsyncMultiTokenSink should send tokens with their scheme", t, func() {
+		var bearerRequests int64
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if req.Header.Get(AuthorizationHeaderName) == "Bearer abc" {
+				atomic.AddInt64(&bearerRequests, 1)
+			}
+			_, _ = rw.Write([]byte(`"OK"`))
+		}))
+		defer server.Close()
+		s := NewAsyncMultiTokenSink(1, 1, 5, 10, server.URL, server.URL, server.URL, "", newDefaultHTTPClient, nil, 0)
+		ctx := ContextWithToken(context.Background(), Token{Value: "abc", Scheme: BearerTokenScheme})
+		So(s.AddDatapoints(ctx, GoMetricsSource.Datapoints()), ShouldBeNil)
+		for atomic.LoadInt64(&bearerRequests) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		So(s.Close(), ShouldBeNil)
+	})
+}
@@ -0,0 +1,123 @@
+package sfxclient
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+)
+
+// tokenGauges tracks how many items each token has buffered in a pipeline and how its last batch went,
+// to show which token is backing up
+type tokenGauges struct {
+	name        string
+	defaultDims map[string]string
+
+	mu     sync.Mutex
+	tokens map[string]*tokenGauge
+	// maxTokens caps how many tokens are tracked, like the MaxStatsTokens of the status counts.  recent orders
+	// the tokens from most to least recently seen.
+	maxTokens int
+	recent    *list.List
+}
+
+type tokenGauge struct {
+	buffered    int64
+	lastSuccess time.Time
+	lastStatus  int
+	element     *list.Element
+}
+
+func newTokenGauges(name string, defaultDims map[string]string, maxTokens int) *tokenGauges {
+	return &tokenGauges{
+		name:        name,
+		defaultDims: defaultDims,
+		tokens:      make(map[string]*tokenGauge),
+		maxTokens:   maxTokens,
+		recent:      list.New(),
+	}
+}
+
+// get returns the gauges of token, marking it the most recently seen.  g.mu must be held.
+func (g *tokenGauges) get(token string) *tokenGauge {
+	t, exists := g.tokens[token]
+	if !exists {
+		t = &tokenGauge{lastStatus: -1}
+		g.tokens[token] = t
+		if g.maxTokens > 0 {
+			t.element = g.recent.PushFront(token)
+			g.evict()
+		}
+		return t
+	}
+	if t.element != nil {
+		g.recent.MoveToFront(t.element)
+	}
+	return t
+}
+
+// evict forgets a token once there are more than maxTokens, preferring the least recently seen token with
+// nothing buffered.  The newest token, at the front, is never evicted.  g.mu must be held.
+func (g *tokenGauges) evict() {
+	if g.recent.Len() <= g.maxTokens {
+		return
+	}
+	oldest := g.recent.Back()
+	for e := oldest; e != g.recent.Front(); e = e.Prev() {
+		if g.tokens[e.Value.(string)].buffered == 0 {
+			oldest = e
+			break
+		}
+	}
+	delete(g.tokens, g.recent.Remove(oldest).(string))
+}
+
+// buffer adds n to the items buffered for token.  n is negative when items leave the buffer.
+func (g *tokenGauges) buffer(token string, n int64) {
+	g.mu.Lock()
+	t := g.get(token)
+	t.buffered += n
+	if t.buffered < 0 {
+		// the token was forgotten while it had items buffered
+		t.buffered = 0
+	}
+	g.mu.Unlock()
+}
+
+// emitted records that n items of token were emitted with the HTTP status code status, or -1 if unknown
+func (g *tokenGauges) emitted(token string, n int64, status int, now time.Time) {
+	g.mu.Lock()
+	t := g.get(token)
+	t.buffered -= n
+	if t.buffered < 0 {
+		t.buffered = 0
+	}
+	t.lastStatus = status
+	if status >= 200 && status < 300 {
+		t.lastSuccess = now
+	}
+	g.mu.Unlock()
+}
+
+// Datapoints returns the items buffered, the time of the last successful emit in seconds since the epoch
+// and the last status code of each token
+func (g *tokenGauges) Datapoints() []*datapoint.Datapoint {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	dps := make([]*datapoint.Datapoint, 0, len(g.tokens)*3)
+	for token, t := range g.tokens {
+		dims := map[string]string{"token": token}
+		for k, v := range g.defaultDims {
+			dims[k] = v
+		}
+		dps = append(dps,
+			Gauge(fmt.Sprintf("total_%ss_buffered_by_token", g.name), dims, t.buffered),
+			Gauge(fmt.Sprintf("last_%s_status_by_token", g.name), dims, int64(t.lastStatus)))
+		if !t.lastSuccess.IsZero() {
+			dps = append(dps, Gauge(fmt.Sprintf("last_%s_success_by_token", g.name), dims, t.lastSuccess.Unix()))
+		}
+	}
+	return dps
+}
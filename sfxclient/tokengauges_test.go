@@ -0,0 +1,88 @@
+package sfxclient
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func tokenGaugeValues(dps []*datapoint.Datapoint) map[string]int64 {
+	values := map[string]int64{}
+	for _, dp := range dps {
+		if v, ok := dp.Value.(datapoint.IntValue); ok && dp.Dimensions["token"] != "" {
+			values[dp.Metric+":"+dp.Dimensions["token"]] = v.Int()
+		}
+	}
+	return values
+}
+
+func TestTokenGauges(t *testing.T) {
+	Convey("Token gauges", t, func() {
+		g := newTokenGauges("log", map[string]string{"a": "b"}, 0)
+		now := time.Unix(1000, 0)
+		g.buffer("abc", 3)
+		g.buffer("def", 2)
+		g.emitted("abc", 1, http.StatusOK, now)
+		g.emitted("def", 2, http.StatusTooManyRequests, now)
+		So(tokenGaugeValues(g.Datapoints()), ShouldResemble, map[string]int64{
+			"total_logs_buffered_by_token:abc": 2,
+			"last_log_status_by_token:abc":     http.StatusOK,
+			"last_log_success_by_token:abc":    1000,
+			"total_logs_buffered_by_token:def": 0,
+			"last_log_status_by_token:def":     http.StatusTooManyRequests,
+		})
+		So(g.Datapoints()[0].Dimensions["a"], ShouldEqual, "b")
+	})
+	Convey("Token gauges with a cap", t, func() {
+		g := newTokenGauges("log", nil, 2)
+		now := time.Unix(1000, 0)
+		Convey("should forget idle tokens first", func() {
+			g.buffer("busy", 3)
+			g.buffer("idle", 1)
+			g.emitted("idle", 1, http.StatusOK, now)
+			g.buffer("new", 1)
+			So(tokenGaugeValues(g.Datapoints()), ShouldResemble, map[string]int64{
+				"total_logs_buffered_by_token:busy": 3,
+				"last_log_status_by_token:busy":     -1,
+				"total_logs_buffered_by_token:new":  1,
+				"last_log_status_by_token:new":      -1,
+			})
+		})
+		Convey("should keep at most the cap when every token is busy", func() {
+			for i := 0; i < 10; i++ {
+				g.buffer(strconv.Itoa(i), 1)
+			}
+			So(len(g.tokens), ShouldEqual, 2)
+			So(g.recent.Len(), ShouldEqual, 2)
+			values := tokenGaugeValues(g.Datapoints())
+			So(values["total_logs_buffered_by_token:9"], ShouldEqual, 1)
+			So(values["total_logs_buffered_by_token:8"], ShouldEqual, 1)
+			Convey("and not go negative when a forgotten token emits", func() {
+				g.emitted("0", 1, http.StatusOK, now)
+				So(tokenGaugeValues(g.Datapoints())["total_logs_buffered_by_token:0"], ShouldEqual, 0)
+			})
+		})
+	})
+}
+
+func TestPipelineTokenGauges(t *testing.T) {
+	Convey("A pipeline should report what each token has buffered", t, func() {
+		p, batches := newStatsPipeline(false, 0)
+		So(p.AddWithToken(Token{Value: "abc"}, []string{"a", "b"}), ShouldBeNil)
+		<-batches
+		So(p.Close(time.Second), ShouldBeNil)
+		values := tokenGaugeValues(p.tokenGauges.Datapoints())
+		So(values["total_logs_buffered_by_token:abc"], ShouldEqual, 0)
+		So(values["last_log_status_by_token:abc"], ShouldEqual, http.StatusOK)
+		So(values["last_log_success_by_token:abc"], ShouldBeGreaterThan, 0)
+	})
+	Convey("A pipeline without detailed stats should not track tokens", t, func() {
+		p, _ := newStatsPipeline(true, 0)
+		So(p.tokenGauges, ShouldBeNil)
+		So(p.Close(time.Second), ShouldBeNil)
+	})
+}
@@ -0,0 +1,153 @@
+package sfxclient
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/timekeeper"
+)
+
+// TokenProvider resolves the token to send a datum with, as an alternative to putting the token on the
+// context.  datum is a single *datapoint.Datapoint, *event.Event or *trace.Span.
+type TokenProvider interface {
+	TokenFor(ctx context.Context, datum interface{}) (string, error)
+}
+
+// TokenProviderFunc turns a func into a TokenProvider
+type TokenProviderFunc func(ctx context.Context, datum interface{}) (string, error)
+
+// TokenFor calls f
+func (f TokenProviderFunc) TokenFor(ctx context.Context, datum interface{}) (string, error) {
+	return f(ctx, datum)
+}
+
+// tokenInvalidator is implemented by providers that want to know when a token they gave out is rejected
+type tokenInvalidator interface {
+	InvalidateToken(token string)
+}
+
+// DefaultTokenTTL is how long a CachingTokenProvider keeps a token by default
+const DefaultTokenTTL = time.Minute * 5
+
+// CachingTokenProvider is a TokenProvider that looks tokens up by a key, like a tenant ID, from a slow
+// source like a tenant registry or secret store, and caches them for TTL.  An expired token is looked up
+// again, but kept if the lookup fails, so an outage of the source doesn't stop data from being sent.
+// Tokens the backend rejects are dropped from the cache right away, so rotated tokens are picked up
+// without waiting for TTL.
+type CachingTokenProvider struct {
+	// Key returns the key of the token datum is sent with
+	Key func(ctx context.Context, datum interface{}) (string, error)
+	// Lookup returns the current token for key
+	Lookup func(ctx context.Context, key string) (string, error)
+	TTL    time.Duration
+	Timer  timekeeper.TimeKeeper
+
+	mu       sync.Mutex
+	entries  map[string]cachedToken
+	lookups  int64
+	failures int64
+}
+
+type cachedToken struct {
+	token   string
+	expires time.Time
+}
+
+// NewCachingTokenProvider creates a CachingTokenProvider that caches tokens for DefaultTokenTTL
+func NewCachingTokenProvider(key func(ctx context.Context, datum interface{}) (string, error), lookup func(ctx context.Context, key string) (string, error)) *CachingTokenProvider {
+	return &CachingTokenProvider{
+		Key:     key,
+		Lookup:  lookup,
+		TTL:     DefaultTokenTTL,
+		Timer:   timekeeper.RealTime{},
+		entries: make(map[string]cachedToken),
+	}
+}
+
+// TokenFor returns the cached token for datum's key, looking it up if it isn't cached or has expired
+func (c *CachingTokenProvider) TokenFor(ctx context.Context, datum interface{}) (string, error) {
+	key, err := c.Key(ctx, datum)
+	if err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	entry, exists := c.entries[key]
+	c.mu.Unlock()
+	now := c.Timer.Now()
+	if exists && now.Before(entry.expires) {
+		return entry.token, nil
+	}
+	token, err := c.Lookup(ctx, key)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lookups++
+	if err != nil {
+		c.failures++
+		if exists {
+			return entry.token, nil
+		}
+		return "", err
+	}
+	c.entries[key] = cachedToken{token: token, expires: now.Add(c.TTL)}
+	return token, nil
+}
+
+// Invalidate drops the cached token for key, so the next datum with that key looks it up again
+func (c *CachingTokenProvider) Invalidate(key string) {
+	c.mu.Lock()
+	delete(c.entries, key)
+	c.mu.Unlock()
+}
+
+// InvalidateToken drops token from the cache wherever it appears.  AsyncMultiTokenSink calls it when the
+// backend rejects token.
+func (c *CachingTokenProvider) InvalidateToken(token string) {
+	c.mu.Lock()
+	for key, entry := range c.entries {
+		if entry.token == token {
+			delete(c.entries, key)
+		}
+	}
+	c.mu.Unlock()
+}
+
+// Datapoints returns how many tokens are cached, and how many lookups were made and failed
+func (c *CachingTokenProvider) Datapoints() []*datapoint.Datapoint {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return []*datapoint.Datapoint{
+		Gauge("cached_tokens", nil, int64(len(c.entries))),
+		Cumulative("total_token_lookups", nil, c.lookups),
+		Cumulative("total_token_lookup_failures", nil, c.failures),
+	}
+}
+
+// addByToken resolves the token of each item in data with provider and adds the items in groups of the
+// same token, in the order each token was first seen.  Items whose token can't be resolved are dropped and
+// the first error resolving a token is returned.
+func addByToken[T any](ctx context.Context, provider TokenProvider, data []T, add func(token Token, data []T) error) error {
+	var tokens []string
+	groups := make(map[string][]T)
+	var firstErr error
+	for _, d := range data {
+		token, err := provider.TokenFor(ctx, d)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if _, exists := groups[token]; !exists {
+			tokens = append(tokens, token)
+		}
+		groups[token] = append(groups[token], d)
+	}
+	for _, token := range tokens {
+		if err := add(Token{Value: token}, groups[token]); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,217 @@
+package sfxclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/event"
+	"github.com/signalfx/golib/v3/timekeeper/timekeepertest"
+	"github.com/signalfx/golib/v3/trace"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// tenantKey keys datapoints, events and spans by their "tenant" dimension or tag
+func tenantKey(_ context.Context, datum interface{}) (string, error) {
+	var tenant string
+	switch d := datum.(type) {
+	case *datapoint.Datapoint:
+		tenant = d.Dimensions["tenant"]
+	case *event.Event:
+		tenant = d.Dimensions["tenant"]
+	case *trace.Span:
+		tenant = d.Tags["tenant"]
+	}
+	if tenant == "" {
+		return "", errors.New("no tenant")
+	}
+	return tenant, nil
+}
+
+func TestCachingTokenProvider(t *testing.T) {
+	Convey("A caching token provider", t, func() {
+		clock := timekeepertest.NewStubClock(time.Now())
+		registry := map[string]string{"a": "token-a1", "b": "token-b1"}
+		var lookups int
+		var lookupErr error
+		p := NewCachingTokenProvider(tenantKey, func(_ context.Context, key string) (string, error) {
+			lookups++
+			if lookupErr != nil {
+				return "", lookupErr
+			}
+			return registry[key], nil
+		})
+		p.Timer = clock
+		dp := Gauge("m", map[string]string{"tenant": "a"}, 1)
+
+		Convey("should look tokens up once", func() {
+			for i := 0; i < 3; i++ {
+				token, err := p.TokenFor(context.Background(), dp)
+				So(err, ShouldBeNil)
+				So(token, ShouldEqual, "token-a1")
+			}
+			So(lookups, ShouldEqual, 1)
+		})
+		Convey("should return errors from Key", func() {
+			_, err := p.TokenFor(context.Background(), Gauge("m", nil, 1))
+			So(err.Error(), ShouldEqual, "no tenant")
+		})
+		Convey("once a token is cached", func() {
+			_, _ = p.TokenFor(context.Background(), dp)
+			registry["a"] = "token-a2"
+			Convey("should refresh it when it expires", func() {
+				clock.Incr(DefaultTokenTTL)
+				token, _ := p.TokenFor(context.Background(), dp)
+				So(token, ShouldEqual, "token-a2")
+			})
+			Convey("should keep it when refreshing fails", func() {
+				clock.Incr(DefaultTokenTTL)
+				lookupErr = errors.New("registry is down")
+				token, err := p.TokenFor(context.Background(), dp)
+				So(err, ShouldBeNil)
+				So(token, ShouldEqual, "token-a1")
+				So(dpValues(p.Datapoints()), ShouldResemble, map[string]int64{
+					"cached_tokens":               1,
+					"total_token_lookups":         2,
+					"total_token_lookup_failures": 1,
+				})
+			})
+			Convey("should refresh it once it is rejected", func() {
+				p.InvalidateToken("token-a1")
+				token, _ := p.TokenFor(context.Background(), dp)
+				So(token, ShouldEqual, "token-a2")
+			})
+			Convey("should refresh it once its key is invalidated", func() {
+				p.Invalidate("a")
+				token, _ := p.TokenFor(context.Background(), dp)
+				So(token, ShouldEqual, "token-a2")
+			})
+		})
+		Convey("should return lookup errors when nothing is cached", func() {
+			lookupErr = errors.New("registry is down")
+			_, err := p.TokenFor(context.Background(), dp)
+			So(err, ShouldEqual, lookupErr)
+		})
+	})
+}
+
+func dpValues(dps []*datapoint.Datapoint) map[string]int64 {
+	values := make(map[string]int64, len(dps))
+	for _, dp := range dps {
+		if v, ok := dp.Value.(datapoint.IntValue); ok {
+			values[dp.Metric] = v.Int()
+		}
+	}
+	return values
+}
+
+func TestAddByToken(t *testing.T) {
+	Convey("addByToken should group data by token in order", t, func() {
+		provider := TokenProviderFunc(func(_ context.Context, datum interface{}) (string, error) {
+			if datum.(int) < 0 {
+				return "", errors.New("negative")
+			}
+			return []string{"even", "odd"}[datum.(int)%2], nil
+		})
+		var tokens []string
+		var groups [][]int
+		err := addByToken(context.Background(), provider, []int{1, 2, -1, 3, 4}, func(token Token, data []int) error {
+			tokens = append(tokens, token.Value)
+			groups = append(groups, data)
+			return nil
+		})
+		So(err.Error(), ShouldEqual, "negative")
+		So(tokens, ShouldResemble, []string{"odd", "even"})
+		So(groups, ShouldResemble, [][]int{{1, 3}, {2, 4}})
+	})
+}
+
+func TestAsyncMultiTokenSinkTokenProvider(t *testing.T) {
+	Convey("An AsyncMultiTokenSink with a token provider", t, func() {
+		var mu sync.Mutex
+		received := make(map[string]int)
+		requests := make(chan struct{}, 10)
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			token := req.Header.Get(TokenHeaderName)
+			mu.Lock()
+			received[token]++
+			mu.Unlock()
+			requests <- struct{}{}
+			if token == "revoked" {
+				rw.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, _ = rw.Write([]byte(`"OK"`))
+		}))
+		defer server.Close()
+		registry := map[string]string{"a": "token-a", "b": "revoked"}
+		var regMu sync.Mutex
+		provider := NewCachingTokenProvider(tenantKey, func(_ context.Context, key string) (string, error) {
+			regMu.Lock()
+			defer regMu.Unlock()
+			return registry[key], nil
+		})
+		s := NewAsyncMultiTokenSink(1, 1, 5, 5000, server.URL, server.URL, server.URL, "", nil, func(error) error { return nil }, 0, WithTokenProvider(provider))
+		s.ShutdownTimeout = time.Second
+		wait := func(n int) {
+			for i := 0; i < n; i++ {
+				select {
+				case <-requests:
+				case <-time.After(time.Second * 5):
+					return
+				}
+			}
+		}
+
+		dps := []*datapoint.Datapoint{
+			Gauge("m", map[string]string{"tenant": "a"}, 1),
+			Gauge("m", map[string]string{"tenant": "b"}, 1),
+			Gauge("m", map[string]string{"tenant": "a"}, 2),
+		}
+		So(s.AddDatapoints(context.Background(), dps), ShouldBeNil)
+		wait(2)
+		Convey("should send data with the provider's tokens", func() {
+			So(s.AddEvents(context.Background(), []*event.Event{event.New("e", event.USERDEFINED, map[string]string{"tenant": "a"}, time.Now())}), ShouldBeNil)
+			So(s.AddSpans(context.Background(), []*trace.Span{{TraceID: "1", ID: "1", Tags: map[string]string{"tenant": "a"}}}), ShouldBeNil)
+			wait(2)
+			So(s.Close(), ShouldBeNil)
+			mu.Lock()
+			defer mu.Unlock()
+			So(received, ShouldResemble, map[string]int{"token-a": 3, "revoked": 1})
+		})
+		Convey("should prefer the token on the context", func() {
+			ctx := ContextWithToken(context.Background(), Token{Value: "override"})
+			So(s.AddDatapoints(ctx, dps[:1]), ShouldBeNil)
+			wait(1)
+			So(s.Close(), ShouldBeNil)
+			mu.Lock()
+			defer mu.Unlock()
+			So(received["override"], ShouldEqual, 1)
+		})
+		Convey("should look up rejected tokens again", func() {
+			regMu.Lock()
+			registry["b"] = "token-b"
+			regMu.Unlock()
+			// the rejection is handled after the response is read, so wait for it to reach the provider
+			for i := 0; i < 100 && dpValues(provider.Datapoints())["cached_tokens"] != 1; i++ {
+				time.Sleep(time.Millisecond * 10)
+			}
+			So(s.AddDatapoints(context.Background(), dps[1:2]), ShouldBeNil)
+			wait(1)
+			So(s.Close(), ShouldBeNil)
+			mu.Lock()
+			defer mu.Unlock()
+			So(received["token-b"], ShouldEqual, 1)
+		})
+		Convey("should return errors resolving tokens", func() {
+			So(s.AddDatapoints(context.Background(), []*datapoint.Datapoint{Gauge("m", nil, 1)}).Error(), ShouldEqual, "no tenant")
+			So(s.Close(), ShouldBeNil)
+			So(dpValues(s.Datapoints())["total_token_lookups"], ShouldEqual, 2)
+		})
+	})
+}
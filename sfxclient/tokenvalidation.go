@@ -0,0 +1,239 @@
+package sfxclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/timekeeper"
+)
+
+// ErrInvalidToken is wrapped by the errors of data rejected because its token isn't valid
+var ErrInvalidToken = errors.New("invalid token")
+
+// TokenObfuscator turns a token into a form that is safe to put in error messages and dimensions
+type TokenObfuscator func(token string) string
+
+// HashToken obfuscates token as the first 16 hex characters of its SHA-256, which is stable, so a token's
+// stats and errors can still be told apart from other tokens'
+func HashToken(token string) string {
+	return getShaValue([]string{token})[:16]
+}
+
+// LastFourToken obfuscates token as its last four characters, which is how tokens are shown in the
+// SignalFx UI.  Tokens of four characters or less are hidden completely.
+func LastFourToken(token string) string {
+	if len(token) <= 4 {
+		return "****"
+	}
+	return "..." + token[len(token)-4:]
+}
+
+// obfuscateTokenDims returns dps with the token dimension of each obfuscated by obfuscate.  Datapoints
+// with a token get a copy of their dimensions, since collectors share dimension maps between datapoints.
+func obfuscateTokenDims(dps []*datapoint.Datapoint, obfuscate TokenObfuscator) []*datapoint.Datapoint {
+	if obfuscate == nil {
+		return dps
+	}
+	for _, dp := range dps {
+		token, exists := dp.Dimensions["token"]
+		if !exists {
+			continue
+		}
+		dims := make(map[string]string, len(dp.Dimensions))
+		for k, v := range dp.Dimensions {
+			dims[k] = v
+		}
+		dims["token"] = obfuscate(token)
+		dp.Dimensions = dims
+	}
+	return dps
+}
+
+// TokenValidator checks a token before data is accepted for it.  Errors for tokens that aren't valid wrap
+// ErrInvalidToken, and never contain the token.
+type TokenValidator interface {
+	ValidateToken(ctx context.Context, token string) error
+}
+
+// TokenValidatorFunc turns a func into a TokenValidator
+type TokenValidatorFunc func(ctx context.Context, token string) error
+
+// ValidateToken calls f
+func (f TokenValidatorFunc) ValidateToken(ctx context.Context, token string) error {
+	return f(ctx, token)
+}
+
+// DefaultMaxTokenLength is the longest token a FormatTokenValidator accepts by default
+const DefaultMaxTokenLength = 256
+
+// FormatTokenValidator rejects tokens that can't be SignalFx tokens because of their length or characters,
+// without calling SignalFx
+type FormatTokenValidator struct {
+	// MinLength is the shortest token accepted.  Zero accepts any token that isn't empty.
+	MinLength int
+	// MaxLength is the longest token accepted.  Zero means DefaultMaxTokenLength.
+	MaxLength int
+	// Allowed reports if r may be part of a token.  Defaults to the characters of base64 and JWT encoded
+	// tokens: letters, digits and -_.+/=
+	Allowed func(r rune) bool
+}
+
+func isTokenRune(r rune) bool {
+	switch {
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		return true
+	}
+	switch r {
+	case '-', '_', '.', '+', '/', '=':
+		return true
+	}
+	return false
+}
+
+// ValidateToken checks the length and characters of token
+func (v *FormatTokenValidator) ValidateToken(_ context.Context, token string) error {
+	minLength, maxLength, allowed := v.MinLength, v.MaxLength, v.Allowed
+	if minLength < 1 {
+		minLength = 1
+	}
+	if maxLength <= 0 {
+		maxLength = DefaultMaxTokenLength
+	}
+	if allowed == nil {
+		allowed = isTokenRune
+	}
+	length := utf8.RuneCountInString(token)
+	if length < minLength || length > maxLength {
+		return fmt.Errorf("%w: the token is %d characters long, it must be %d to %d", ErrInvalidToken, length, minLength, maxLength)
+	}
+	for i, r := range token {
+		if !allowed(r) {
+			return fmt.Errorf("%w: the token has a character that isn't allowed at byte %d", ErrInvalidToken, i)
+		}
+	}
+	return nil
+}
+
+// DefaultTokenValidationEndpoint is the SignalFx API endpoint HTTPTokenValidator checks tokens against by
+// default.  It accepts tokens with API access, so point the validator at another endpoint to validate
+// tokens that can only ingest.
+const DefaultTokenValidationEndpoint = "https://api.us0.signalfx.com/v2/organization"
+
+// DefaultTokenValidationTTL is how long an HTTPTokenValidator remembers a token's validation by default
+const DefaultTokenValidationTTL = time.Minute * 10
+
+// HTTPTokenValidator checks tokens by calling a SignalFx API endpoint with them, and caches the result for
+// TTL.  Tokens the endpoint answers with a 401 or 403 are invalid.  Any other failure accepts the token
+// without caching the result, so an outage of the API doesn't stop data from being sent.
+type HTTPTokenValidator struct {
+	// Endpoint is called with a GET and the token in the X-Sf-Token header
+	Endpoint string
+	Client   *http.Client
+	TTL      time.Duration
+	// Format, if set, is checked first so malformed tokens are rejected without calling Endpoint
+	Format *FormatTokenValidator
+	Timer  timekeeper.TimeKeeper
+
+	mu       sync.Mutex
+	results  map[string]tokenValidation
+	checks   int64
+	failures int64
+}
+
+type tokenValidation struct {
+	valid   bool
+	expires time.Time
+}
+
+// NewHTTPTokenValidator creates an HTTPTokenValidator that checks token formats and calls endpoint
+func NewHTTPTokenValidator(endpoint string, client *http.Client) *HTTPTokenValidator {
+	return &HTTPTokenValidator{
+		Endpoint: endpoint,
+		Client:   client,
+		TTL:      DefaultTokenValidationTTL,
+		Format:   &FormatTokenValidator{},
+		Timer:    timekeeper.RealTime{},
+		results:  make(map[string]tokenValidation),
+	}
+}
+
+// ValidateToken checks the format of token and whether Endpoint accepts it, if that isn't cached
+func (v *HTTPTokenValidator) ValidateToken(ctx context.Context, token string) error {
+	if v.Format != nil {
+		if err := v.Format.ValidateToken(ctx, token); err != nil {
+			return err
+		}
+	}
+	now := v.Timer.Now()
+	v.mu.Lock()
+	result, exists := v.results[token]
+	v.mu.Unlock()
+	if !exists || !now.Before(result.expires) {
+		valid, err := v.check(ctx, token)
+		v.mu.Lock()
+		v.checks++
+		if err != nil {
+			v.failures++
+			v.mu.Unlock()
+			return nil
+		}
+		result = tokenValidation{valid: valid, expires: now.Add(v.TTL)}
+		v.results[token] = result
+		v.mu.Unlock()
+	}
+	if !result.valid {
+		return fmt.Errorf("%w: %s rejected the token", ErrInvalidToken, v.Endpoint)
+	}
+	return nil
+}
+
+// check calls Endpoint with token and returns if it was accepted, or an error if that couldn't be told
+func (v *HTTPTokenValidator) check(ctx context.Context, token string) (bool, error) {
+	req, err := http.NewRequest(http.MethodGet, v.Endpoint, nil)
+	if err != nil {
+		return false, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set(TokenHeaderName, token)
+	client := v.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	_ = resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return false, nil
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return true, nil
+	}
+	return false, fmt.Errorf("unexpected status code %d validating a token", resp.StatusCode)
+}
+
+// InvalidateToken drops the cached validation of token, so it is checked again the next time it is used.
+// AsyncMultiTokenSink calls it when the backend rejects token.
+func (v *HTTPTokenValidator) InvalidateToken(token string) {
+	v.mu.Lock()
+	delete(v.results, token)
+	v.mu.Unlock()
+}
+
+// Datapoints returns how many validations are cached, and how many checks were made and failed
+func (v *HTTPTokenValidator) Datapoints() []*datapoint.Datapoint {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return []*datapoint.Datapoint{
+		Gauge("cached_token_validations", nil, int64(len(v.results))),
+		Cumulative("total_token_validations", nil, v.checks),
+		Cumulative("total_token_validation_failures", nil, v.failures),
+	}
+}
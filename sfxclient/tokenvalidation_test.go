@@ -0,0 +1,157 @@
+package sfxclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/timekeeper/timekeepertest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTokenObfuscators(t *testing.T) {
+	Convey("Token obfuscators", t, func() {
+		Convey("should hash tokens the same way every time", func() {
+			So(HashToken("abcdefgh"), ShouldEqual, HashToken("abcdefgh"))
+			So(HashToken("abcdefgh"), ShouldNotEqual, HashToken("abcdefgi"))
+			So(len(HashToken("abcdefgh")), ShouldEqual, 16)
+			So(HashToken("abcdefgh"), ShouldNotContainSubstring, "abcd")
+		})
+		Convey("should keep only the last four characters", func() {
+			So(LastFourToken("abcdefgh"), ShouldEqual, "...efgh")
+			So(LastFourToken("abcd"), ShouldEqual, "****")
+		})
+		Convey("should obfuscate the token dimension of copies of shared dimensions", func() {
+			dims := map[string]string{"token": "abcdefgh", "status": "OK"}
+			dps := obfuscateTokenDims([]*datapoint.Datapoint{Gauge("a", dims, 1), Gauge("b", dims, 1), Gauge("c", nil, 1)}, LastFourToken)
+			So(dps[0].Dimensions["token"], ShouldEqual, "...efgh")
+			So(dps[1].Dimensions["token"], ShouldEqual, "...efgh")
+			So(dps[1].Dimensions["status"], ShouldEqual, "OK")
+			So(dims["token"], ShouldEqual, "abcdefgh")
+		})
+	})
+}
+
+func TestFormatTokenValidator(t *testing.T) {
+	Convey("A format token validator", t, func() {
+		v := &FormatTokenValidator{}
+		ctx := context.Background()
+		Convey("should accept tokens that look like SignalFx tokens", func() {
+			So(v.ValidateToken(ctx, "AbC-12_3xYz"), ShouldBeNil)
+		})
+		Convey("should reject tokens with the wrong length without saying what they are", func() {
+			err := v.ValidateToken(ctx, "")
+			So(errors.Is(err, ErrInvalidToken), ShouldBeTrue)
+			v.MaxLength = 4
+			err = v.ValidateToken(ctx, "secret")
+			So(errors.Is(err, ErrInvalidToken), ShouldBeTrue)
+			So(err.Error(), ShouldNotContainSubstring, "secret")
+		})
+		Convey("should reject tokens with characters that aren't allowed", func() {
+			err := v.ValidateToken(ctx, "secret token")
+			So(errors.Is(err, ErrInvalidToken), ShouldBeTrue)
+			So(err.Error(), ShouldNotContainSubstring, "secret")
+			v.Allowed = func(r rune) bool { return true }
+			So(v.ValidateToken(ctx, "secret token"), ShouldBeNil)
+		})
+	})
+}
+
+func TestHTTPTokenValidator(t *testing.T) {
+	Convey("An HTTP token validator", t, func() {
+		var calls int64
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt64(&calls, 1)
+			switch r.Header.Get(TokenHeaderName) {
+			case "good":
+				w.WriteHeader(http.StatusOK)
+			case "bad":
+				w.WriteHeader(http.StatusUnauthorized)
+			default:
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		}))
+		defer server.Close()
+		clock := timekeepertest.NewStubClock(time.Now())
+		v := NewHTTPTokenValidator(server.URL, nil)
+		v.Timer = clock
+		ctx := context.Background()
+		Convey("should cache the tokens the endpoint accepts", func() {
+			So(v.ValidateToken(ctx, "good"), ShouldBeNil)
+			So(v.ValidateToken(ctx, "good"), ShouldBeNil)
+			So(atomic.LoadInt64(&calls), ShouldEqual, 1)
+			clock.Incr(DefaultTokenValidationTTL)
+			So(v.ValidateToken(ctx, "good"), ShouldBeNil)
+			So(atomic.LoadInt64(&calls), ShouldEqual, 2)
+		})
+		Convey("should reject and cache the tokens the endpoint rejects", func() {
+			err := v.ValidateToken(ctx, "bad")
+			So(errors.Is(err, ErrInvalidToken), ShouldBeTrue)
+			So(errors.Is(v.ValidateToken(ctx, "bad"), ErrInvalidToken), ShouldBeTrue)
+			So(atomic.LoadInt64(&calls), ShouldEqual, 1)
+			v.InvalidateToken("bad")
+			So(errors.Is(v.ValidateToken(ctx, "bad"), ErrInvalidToken), ShouldBeTrue)
+			So(atomic.LoadInt64(&calls), ShouldEqual, 2)
+		})
+		Convey("should accept tokens it can't check without caching them", func() {
+			So(v.ValidateToken(ctx, "unknown"), ShouldBeNil)
+			So(v.ValidateToken(ctx, "unknown"), ShouldBeNil)
+			So(atomic.LoadInt64(&calls), ShouldEqual, 2)
+			So(dpValues(v.Datapoints()), ShouldResemble, map[string]int64{
+				"cached_token_validations":        0,
+				"total_token_validations":         2,
+				"total_token_validation_failures": 2,
+			})
+		})
+		Convey("should reject malformed tokens without calling the endpoint", func() {
+			So(errors.Is(v.ValidateToken(ctx, "no spaces"), ErrInvalidToken), ShouldBeTrue)
+			So(atomic.LoadInt64(&calls), ShouldEqual, 0)
+		})
+	})
+}
+
+func TestAsyncMultiTokenSinkTokenValidation(t *testing.T) {
+	Convey("An AsyncMultiTokenSink", t, func() {
+		validator := TokenValidatorFunc(func(ctx context.Context, token string) error {
+			if strings.HasPrefix(token, "bad") {
+				return ErrInvalidToken
+			}
+			return nil
+		})
+		Convey("should reject data with invalid tokens without putting the token in the error", func() {
+			s := NewAsyncMultiTokenSink(1, 1, 5, 25, "", "", "", "", newDefaultHTTPClient, nil, 1, WithTokenValidator(validator))
+			err := s.AddDatapointsWithToken("badtoken", []*datapoint.Datapoint{GaugeF("a", nil, 1)})
+			So(errors.Is(err, ErrInvalidToken), ShouldBeTrue)
+			So(err.Error(), ShouldNotContainSubstring, "badtoken")
+			So(err.Error(), ShouldContainSubstring, HashToken("badtoken"))
+			err = s.AddEvents(context.WithValue(context.Background(), TokenCtxKey, "badtoken"), nil)
+			So(errors.Is(err, ErrInvalidToken), ShouldBeTrue)
+			So(s.AddSpansWithToken("goodtoken", nil), ShouldBeNil)
+			So(s.Close(), ShouldBeNil)
+		})
+		Convey("should obfuscate tokens in errors and stats", func() {
+			s := NewAsyncMultiTokenSink(1, 1, 5, 25, "", "", "", "", newDefaultHTTPClient, nil, 1, WithTokenValidator(validator), WithTokenObfuscator(LastFourToken))
+			err := s.AddDatapointsWithToken("badtoken", []*datapoint.Datapoint{GaugeF("a", nil, 1)})
+			So(err.Error(), ShouldContainSubstring, "...oken")
+			So(s.AddDatapointsWithToken("goodtoken", []*datapoint.Datapoint{GaugeF("a", nil, 1)}), ShouldBeNil)
+			var tokens []string
+			for _, dp := range s.Datapoints() {
+				if token, exists := dp.Dimensions["token"]; exists {
+					tokens = append(tokens, token)
+				}
+			}
+			So(tokens, ShouldNotBeEmpty)
+			for _, token := range tokens {
+				So(token, ShouldEqual, "...oken")
+			}
+			s.ShutdownTimeout = time.Millisecond * 100
+			_ = s.Close()
+		})
+	})
+}
@@ -0,0 +1,41 @@
+package sfxclient
+
+import (
+	"bytes"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/signalfx/golib/v3/errors"
+)
+
+// zstdCompressor compresses request bodies with zstd.  A zstd.Encoder can EncodeAll concurrently, so one
+// is shared by every request.
+type zstdCompressor struct {
+	encoder *zstd.Encoder
+}
+
+var _ Compressor = &zstdCompressor{}
+
+// NewZstdCompressor returns a Compressor that compresses request bodies with zstd at level, a zstd level
+// from 1 to 22 that is mapped to the closest level the encoder has.  Zero uses the encoder's default.
+func NewZstdCompressor(level int) (Compressor, error) {
+	var opts []zstd.EOption
+	if level != 0 {
+		opts = append(opts, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+	}
+	encoder, err := zstd.NewWriter(nil, opts...)
+	if err != nil {
+		return nil, errors.Annotate(err, "cannot create zstd encoder")
+	}
+	return &zstdCompressor{encoder: encoder}, nil
+}
+
+// ContentEncoding is zstd
+func (z *zstdCompressor) ContentEncoding() string {
+	return "zstd"
+}
+
+// Compress writes b compressed with zstd to dst
+func (z *zstdCompressor) Compress(dst *bytes.Buffer, b []byte) error {
+	_, err := dst.Write(z.encoder.EncodeAll(b, nil))
+	return err
+}
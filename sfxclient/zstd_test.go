@@ -0,0 +1,55 @@
+package sfxclient
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestZstdCompressor(t *testing.T) {
+	Convey("A zstd compressor", t, func() {
+		body := []byte(strings.Repeat(longTraceExample, 4))
+		decoder, err := zstd.NewReader(nil)
+		So(err, ShouldBeNil)
+		defer decoder.Close()
+		for _, level := range []int{0, 1, 3, 19} {
+			compressor, err := NewZstdCompressor(level)
+			So(err, ShouldBeNil)
+			So(compressor.ContentEncoding(), ShouldEqual, "zstd")
+			var buf bytes.Buffer
+			So(compressor.Compress(&buf, body), ShouldBeNil)
+			So(buf.Len(), ShouldBeLessThan, len(body))
+			decoded, err := decoder.DecodeAll(buf.Bytes(), nil)
+			So(err, ShouldBeNil)
+			So(decoded, ShouldResemble, body)
+		}
+		Convey("should be sent by an HTTPSink", func() {
+			encodings := make(chan string, 1)
+			bodies := make(chan []byte, 1)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				encodings <- r.Header.Get("Content-Encoding")
+				b, _ := ioutil.ReadAll(r.Body)
+				bodies <- b
+				_, _ = w.Write([]byte(`"OK"`))
+			}))
+			defer server.Close()
+			compressor, err := NewZstdCompressor(0)
+			So(err, ShouldBeNil)
+			sink := NewHTTPSink(WithCompressor(compressor))
+			encode := func() (io.Reader, bool, error) { return sink.getReader(body) }
+			So(sink.doBottom(context.Background(), encode, "application/json", server.URL, 0, func([]byte) error { return nil }), ShouldBeNil)
+			So(<-encodings, ShouldEqual, "zstd")
+			decoded, err := decoder.DecodeAll(<-bodies, nil)
+			So(err, ShouldBeNil)
+			So(decoded, ShouldResemble, body)
+		})
+	})
+}
@@ -0,0 +1,175 @@
+package trace
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// timeNow is how the spans StartSpan creates are timed, a var so tests can stub it
+var timeNow = time.Now
+
+// sinkHolder wraps the registered sink, since atomic.Value needs a consistent concrete type
+type sinkHolder struct {
+	sink Sink
+}
+
+var registeredSink atomic.Value
+
+// RegisterSink makes sink where spans created with StartSpan are added when they finish, unless they're
+// started WithSink.  Until a sink is registered those spans are dropped.
+func RegisterSink(sink Sink) {
+	registeredSink.Store(sinkHolder{sink: sink})
+}
+
+// RegisteredSink returns the sink registered with RegisterSink, or nil
+func RegisteredSink() Sink {
+	holder, _ := registeredSink.Load().(sinkHolder)
+	return holder.sink
+}
+
+// ActiveSpan is a span started with StartSpan that hasn't finished yet.  It's safe to use from multiple
+// goroutines.
+type ActiveSpan struct {
+	sink    Sink
+	sampler Sampler
+	start   time.Time
+
+	mu       sync.Mutex
+	span     *Span
+	finished bool
+}
+
+// SpanOption customizes a span started with StartSpan
+type SpanOption func(*ActiveSpan)
+
+// WithKind sets the kind of the span, like CLIENT or SERVER
+func WithKind(kind string) SpanOption {
+	return func(a *ActiveSpan) {
+		a.span.Kind = &kind
+	}
+}
+
+// WithServiceName sets the service name of the span's local endpoint
+func WithServiceName(serviceName string) SpanOption {
+	return func(a *ActiveSpan) {
+		a.span.LocalEndpoint = &Endpoint{ServiceName: &serviceName}
+	}
+}
+
+// WithTags sets tags on the span
+func WithTags(tags map[string]string) SpanOption {
+	return func(a *ActiveSpan) {
+		for k, v := range tags {
+			setTag(a.span, k, v)
+		}
+	}
+}
+
+// WithSink adds the span to sink when it finishes, instead of the registered sink
+func WithSink(sink Sink) SpanOption {
+	return func(a *ActiveSpan) {
+		a.sink = sink
+	}
+}
+
+// WithSampler decides whether the span is kept with sampler, once the other options are applied, unless
+// it follows its parent's decision.  Spans it drops aren't added to their sink, and their children are
+// dropped too.
+func WithSampler(sampler Sampler) SpanOption {
+	return func(a *ActiveSpan) {
+		a.sampler = sampler
+	}
+}
+
+// StartSpan starts timing a span called name, returning it and a copy of ctx that makes it the parent of
+// spans started with the copy.  The span is a child of the span on ctx, if there is one, following its
+// sampling decision and inheriting its local endpoint, and otherwise starts a new trace, sampled
+// WithSampler if it's given.
+func StartSpan(ctx context.Context, name string, opts ...SpanOption) (context.Context, *ActiveSpan) {
+	a := &ActiveSpan{
+		sink:  RegisteredSink(),
+		start: timeNow(),
+		span:  &Span{ID: NewID(), Name: &name},
+	}
+	if parent := SpanFromContext(ctx); parent != nil {
+		a.span.TraceID = parent.TraceID
+		a.span.ParentID = &parent.ID
+		a.span.LocalEndpoint = parent.LocalEndpoint
+		if sampled, decided := Sampled(parent); decided {
+			SetSampled(a.span, sampled)
+		}
+	} else {
+		a.span.TraceID = NewID()
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	if _, decided := Sampled(a.span); !decided && a.sampler != nil {
+		SetSampled(a.span, a.sampler.Sample(a.span))
+	}
+	return ContextWithSpan(ctx, a.span), a
+}
+
+// SetTag sets the tag key to value, returning a so calls can be chained
+func (a *ActiveSpan) SetTag(key string, value string) *ActiveSpan {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !a.finished {
+		setTag(a.span, key, value)
+	}
+	return a
+}
+
+// AddAnnotation records value, like an event that explains latency, as having happened now
+func (a *ActiveSpan) AddAnnotation(value string) *ActiveSpan {
+	ts := timeNow().UnixNano() / int64(time.Microsecond)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !a.finished {
+		a.span.Annotations = append(a.span.Annotations, &Annotation{Timestamp: &ts, Value: &value})
+	}
+	return a
+}
+
+// SetError marks the span as an error with DefaultStatusMapper, unless err is nil or ignored
+func (a *ActiveSpan) SetError(err error) *ActiveSpan {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !a.finished {
+		DefaultStatusMapper.ApplyError(a.span, err)
+	}
+	return a
+}
+
+// TraceID returns the ID of the span's trace
+func (a *ActiveSpan) TraceID() string {
+	return a.span.TraceID
+}
+
+// ID returns the span's ID
+func (a *ActiveSpan) ID() string {
+	return a.span.ID
+}
+
+// Finish stops timing the span and adds it to its sink, unless it wasn't sampled.  Only the first call
+// does anything, so it's safe to defer after finishing explicitly.
+func (a *ActiveSpan) Finish() error {
+	end := timeNow()
+	a.mu.Lock()
+	if a.finished {
+		a.mu.Unlock()
+		return nil
+	}
+	a.finished = true
+	ts := a.start.UnixNano() / int64(time.Microsecond)
+	duration := end.Sub(a.start).Microseconds()
+	a.span.Timestamp, a.span.Duration = &ts, &duration
+	a.mu.Unlock()
+	if sampled, decided := Sampled(a.span); (decided && !sampled) || a.sink == nil {
+		return nil
+	}
+	// the context the span was started with is often done by the time it finishes
+	return a.sink.AddSpans(context.Background(), []*Span{a.span})
+}
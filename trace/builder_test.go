@@ -0,0 +1,101 @@
+package trace
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestStartSpan(t *testing.T) {
+	Convey("starting spans", t, func() {
+		start := time.Unix(1600000000, 0)
+		now := start
+		timeNow = func() time.Time {
+			return now
+		}
+		defer func() {
+			timeNow = time.Now
+		}()
+		sink := &spanRecorder{}
+		RegisterSink(sink)
+		defer RegisterSink(nil)
+
+		ctx, root := StartSpan(context.Background(), "request", WithKind("SERVER"), WithServiceName("api"), WithTags(map[string]string{"env": "prod"}))
+		now = start.Add(time.Millisecond)
+		root.SetTag("user", "bob").AddAnnotation("parsed")
+		_, child := StartSpan(ctx, "query")
+		now = start.Add(3 * time.Millisecond)
+		child.SetError(errors.New("timeout"))
+		So(child.Finish(), ShouldBeNil)
+		So(root.Finish(), ShouldBeNil)
+
+		Convey("should record the spans when they finish", func() {
+			So(len(sink.spans), ShouldEqual, 2)
+			r, c := sink.spans[1], sink.spans[0]
+			So(*r.Name, ShouldEqual, "request")
+			So(*r.Kind, ShouldEqual, "SERVER")
+			So(*r.LocalEndpoint.ServiceName, ShouldEqual, "api")
+			So(r.Tags, ShouldResemble, map[string]string{"env": "prod", "user": "bob"})
+			So(r.ParentID, ShouldBeNil)
+			So(*r.Timestamp, ShouldEqual, start.UnixNano()/1000)
+			So(*r.Duration, ShouldEqual, 3000)
+			So(*r.Annotations[0].Value, ShouldEqual, "parsed")
+			So(*r.Annotations[0].Timestamp, ShouldEqual, *r.Timestamp+1000)
+			So(r.ID, ShouldEqual, root.ID())
+			So(r.TraceID, ShouldEqual, root.TraceID())
+
+			So(c.TraceID, ShouldEqual, r.TraceID)
+			So(*c.ParentID, ShouldEqual, r.ID)
+			So(*c.LocalEndpoint.ServiceName, ShouldEqual, "api")
+			So(c.Tags[ErrorTag], ShouldEqual, "true")
+			So(*c.Duration, ShouldEqual, 2000)
+		})
+		Convey("should only finish once", func() {
+			root.SetTag("late", "x").AddAnnotation("late").SetError(errors.New("late"))
+			So(root.Finish(), ShouldBeNil)
+			So(len(sink.spans), ShouldEqual, 2)
+			So(sink.spans[1].Tags["late"], ShouldEqual, "")
+		})
+		Convey("should follow the parent's sampling decision", func() {
+			parent := &Span{TraceID: NewID(), ID: NewID()}
+			SetSampled(parent, false)
+			_, s := StartSpan(ContextWithSpan(context.Background(), parent), "dropped")
+			So(s.Finish(), ShouldBeNil)
+			So(len(sink.spans), ShouldEqual, 2)
+		})
+		Convey("should sample root spans with a sampler", func() {
+			ctx, dropped := StartSpan(context.Background(), "dropped", WithSampler(NeverSample))
+			_, droppedChild := StartSpan(ctx, "dropped child", WithSampler(AlwaysSample))
+			So(droppedChild.Finish(), ShouldBeNil)
+			So(dropped.Finish(), ShouldBeNil)
+			So(len(sink.spans), ShouldEqual, 2)
+
+			var sampledName string
+			byName := SamplerFunc(func(s *Span) bool {
+				sampledName = *s.Name
+				return *s.Kind == "SERVER"
+			})
+			ctx, kept := StartSpan(context.Background(), "kept", WithSampler(byName), WithKind("SERVER"))
+			_, keptChild := StartSpan(ctx, "kept child", WithSampler(NeverSample))
+			So(keptChild.Finish(), ShouldBeNil)
+			So(kept.Finish(), ShouldBeNil)
+			So(sampledName, ShouldEqual, "kept")
+			So(len(sink.spans), ShouldEqual, 4)
+			sampled, decided := Sampled(sink.spans[3])
+			So(sampled && decided, ShouldBeTrue)
+		})
+		Convey("should add to the sink it's started with", func() {
+			other := &spanRecorder{}
+			_, s := StartSpan(context.Background(), "other", WithSink(other))
+			So(s.Finish(), ShouldBeNil)
+			So(len(other.spans), ShouldEqual, 1)
+			RegisterSink(nil)
+			So(RegisteredSink(), ShouldBeNil)
+			_, s = StartSpan(context.Background(), "unregistered")
+			So(s.Finish(), ShouldBeNil)
+		})
+	})
+}
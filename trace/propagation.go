@@ -0,0 +1,71 @@
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/signalfx/golib/v3/log"
+)
+
+// B3 headers propagate a span to the services it calls
+const (
+	B3TraceIDHeader      = "X-B3-TraceId"
+	B3SpanIDHeader       = "X-B3-SpanId"
+	B3ParentSpanIDHeader = "X-B3-ParentSpanId"
+	B3SampledHeader      = "X-B3-Sampled"
+)
+
+// TraceIDKey and SpanIDKey are the log keys LogExtractor logs a context's span under
+const (
+	TraceIDKey = log.Key("trace_id")
+	SpanIDKey  = log.Key("span_id")
+)
+
+type spanCtxKey struct{}
+
+// ContextWithSpan returns a copy of ctx that carries span, making it the parent of spans created with
+// the context
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanCtxKey{}, span)
+}
+
+// SpanFromContext returns the span stored on ctx by ContextWithSpan, or nil
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanCtxKey{}).(*Span)
+	return span
+}
+
+// NewID returns a random 64 bit span or trace ID as 16 hex characters
+func NewID() string {
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// InjectB3 sets the B3 headers that make span the parent of spans created by the receiver of h
+func InjectB3(h http.Header, span *Span) {
+	h.Set(B3TraceIDHeader, span.TraceID)
+	h.Set(B3SpanIDHeader, span.ID)
+	if span.ParentID != nil {
+		h.Set(B3ParentSpanIDHeader, *span.ParentID)
+	} else {
+		h.Del(B3ParentSpanIDHeader)
+	}
+	if sampled, decided := Sampled(span); decided && !sampled {
+		h.Set(B3SampledHeader, "0")
+	} else {
+		h.Set(B3SampledHeader, "1")
+	}
+}
+
+// LogExtractor is a log.ContextExtractor of the trace and span IDs of the span stored on a context with
+// ContextWithSpan
+func LogExtractor(ctx context.Context) []interface{} {
+	span := SpanFromContext(ctx)
+	if span == nil {
+		return nil
+	}
+	return []interface{}{TraceIDKey, span.TraceID, SpanIDKey, span.ID}
+}
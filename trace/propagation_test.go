@@ -0,0 +1,39 @@
+package trace
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPropagation(t *testing.T) {
+	Convey("spans", t, func() {
+		Convey("should be carried on contexts", func() {
+			So(SpanFromContext(context.Background()), ShouldBeNil)
+			span := &Span{ID: NewID()}
+			So(SpanFromContext(ContextWithSpan(context.Background(), span)), ShouldEqual, span)
+		})
+		Convey("should get random hex IDs", func() {
+			So(len(NewID()), ShouldEqual, 16)
+			So(NewID(), ShouldNotEqual, NewID())
+		})
+		Convey("should be injected as B3 headers", func() {
+			parent := "p"
+			h := http.Header{B3ParentSpanIDHeader: []string{"stale"}}
+			InjectB3(h, &Span{TraceID: "t", ID: "s"})
+			So(h.Get(B3TraceIDHeader), ShouldEqual, "t")
+			So(h.Get(B3SpanIDHeader), ShouldEqual, "s")
+			So(h.Get(B3ParentSpanIDHeader), ShouldEqual, "")
+			So(h.Get(B3SampledHeader), ShouldEqual, "1")
+			InjectB3(h, &Span{TraceID: "t", ID: "s", ParentID: &parent})
+			So(h.Get(B3ParentSpanIDHeader), ShouldEqual, "p")
+		})
+		Convey("should be logged with their trace and span IDs", func() {
+			So(LogExtractor(context.Background()), ShouldBeNil)
+			ctx := ContextWithSpan(context.Background(), &Span{TraceID: "t", ID: "s"})
+			So(LogExtractor(ctx), ShouldResemble, []interface{}{TraceIDKey, "t", SpanIDKey, "s"})
+		})
+	})
+}
@@ -0,0 +1,163 @@
+package trace
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/signalfx/golib/v3/timekeeper"
+)
+
+// A Sampler decides whether a new span is kept, before anything is buffered for it, so high traffic
+// services can control how many spans they send
+type Sampler interface {
+	Sample(span *Span) bool
+}
+
+// SamplerFunc is a func that is a Sampler
+type SamplerFunc func(span *Span) bool
+
+// Sample calls f
+func (f SamplerFunc) Sample(span *Span) bool {
+	return f(span)
+}
+
+// AlwaysSample keeps every span
+var AlwaysSample Sampler = SamplerFunc(func(*Span) bool { return true })
+
+// NeverSample drops every span
+var NeverSample Sampler = SamplerFunc(func(*Span) bool { return false })
+
+// sampledMeta is the span Meta key the sampling decision of a span is kept under
+type sampledMeta struct{}
+
+// SetSampled records whether span was sampled, so the spans created as its children can follow it and
+// B3 headers can propagate it
+func SetSampled(span *Span, sampled bool) {
+	if span.Meta == nil {
+		span.Meta = make(map[interface{}]interface{}, 1)
+	}
+	span.Meta[sampledMeta{}] = sampled
+}
+
+// Sampled returns whether span was sampled, and false for decided if no decision was recorded with
+// SetSampled
+func Sampled(span *Span) (sampled bool, decided bool) {
+	sampled, decided = span.Meta[sampledMeta{}].(bool)
+	return sampled, decided
+}
+
+// ProbabilitySampler keeps rate, [0 - 1.0], of traces.  The decision is made from the trace ID, so every
+// service using the same rate keeps or drops all the spans of a trace alike.
+func ProbabilitySampler(rate float64) Sampler {
+	return SamplerFunc(func(span *Span) bool {
+		// the top 53 bits convert to a float exactly
+		return float64(traceIDBits(span.TraceID)>>11) < rate*(1<<53)
+	})
+}
+
+// traceIDBits returns the low 64 bits of a hex trace ID, which are random, or a hash of IDs that aren't hex
+func traceIDBits(traceID string) uint64 {
+	low := traceID
+	if len(low) > 16 {
+		low = low[len(low)-16:]
+	}
+	if bits, err := strconv.ParseUint(low, 16, 64); err == nil {
+		return bits
+	}
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(traceID))
+	return h.Sum64()
+}
+
+// RateLimitingSampler keeps at most PerSecond spans a second, allowing bursts of up to a second's worth
+type RateLimitingSampler struct {
+	PerSecond  float64
+	TimeKeeper timekeeper.TimeKeeper
+
+	mu      sync.Mutex
+	credits float64
+	last    time.Time
+}
+
+// NewRateLimitingSampler creates a sampler keeping at most perSecond spans a second
+func NewRateLimitingSampler(perSecond float64) *RateLimitingSampler {
+	return &RateLimitingSampler{
+		PerSecond:  perSecond,
+		TimeKeeper: timekeeper.RealTime{},
+		credits:    perSecond,
+	}
+}
+
+// Sample keeps span if there's been time for another span since the last ones kept
+func (r *RateLimitingSampler) Sample(*Span) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.TimeKeeper.Now()
+	if !r.last.IsZero() {
+		r.credits = math.Min(r.PerSecond, r.credits+now.Sub(r.last).Seconds()*r.PerSecond)
+	}
+	r.last = now
+	if r.credits < 1 {
+		return false
+	}
+	r.credits--
+	return true
+}
+
+// ParentBased makes spans follow the decision recorded on them with SetSampled, usually copied from their
+// parent, so traces are kept or dropped whole.  Root decides spans with no decision recorded.
+func ParentBased(root Sampler) Sampler {
+	return SamplerFunc(func(span *Span) bool {
+		if sampled, decided := Sampled(span); decided {
+			return sampled
+		}
+		return root.Sample(span)
+	})
+}
+
+// SamplingSink forwards only the spans Sampler keeps to Next
+type SamplingSink struct {
+	Sampler Sampler
+	Next    Sink
+
+	dropped int64
+}
+
+// NewSamplingSink creates a sink forwarding the spans sampler keeps to next
+func NewSamplingSink(sampler Sampler, next Sink) *SamplingSink {
+	return &SamplingSink{Sampler: sampler, Next: next}
+}
+
+// Sampling is a MiddlewareConstructor that only forwards the spans sampler keeps
+func Sampling(sampler Sampler) MiddlewareConstructor {
+	return func(sendTo Sink) Sink {
+		return NewSamplingSink(sampler, sendTo)
+	}
+}
+
+// AddSpans forwards the spans that are sampled
+func (s *SamplingSink) AddSpans(ctx context.Context, spans []*Span) error {
+	kept := make([]*Span, 0, len(spans))
+	for _, span := range spans {
+		if s.Sampler.Sample(span) {
+			kept = append(kept, span)
+		}
+	}
+	if dropped := len(spans) - len(kept); dropped > 0 {
+		atomic.AddInt64(&s.dropped, int64(dropped))
+	}
+	if len(kept) == 0 {
+		return nil
+	}
+	return s.Next.AddSpans(ctx, kept)
+}
+
+// Dropped returns how many spans the sink hasn't forwarded
+func (s *SamplingSink) Dropped() int64 {
+	return atomic.LoadInt64(&s.dropped)
+}
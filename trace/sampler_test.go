@@ -0,0 +1,104 @@
+package trace
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/signalfx/golib/v3/timekeeper/timekeepertest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type spanRecorder struct {
+	spans []*Span
+}
+
+func (s *spanRecorder) AddSpans(ctx context.Context, spans []*Span) error {
+	s.spans = append(s.spans, spans...)
+	return nil
+}
+
+func TestSamplers(t *testing.T) {
+	Convey("samplers", t, func() {
+		span := &Span{TraceID: NewID(), ID: NewID()}
+		Convey("should always and never sample", func() {
+			So(AlwaysSample.Sample(span), ShouldBeTrue)
+			So(NeverSample.Sample(span), ShouldBeFalse)
+		})
+		Convey("should sample a fraction of traces by trace ID", func() {
+			half := ProbabilitySampler(.5)
+			kept := 0
+			for i := 0; i < 10000; i++ {
+				s := &Span{TraceID: NewID() + NewID()}
+				if half.Sample(s) {
+					kept++
+				}
+				So(half.Sample(&Span{TraceID: s.TraceID, ID: NewID()}), ShouldEqual, half.Sample(s))
+			}
+			So(kept, ShouldBeBetween, 4500, 5500)
+			So(ProbabilitySampler(1).Sample(&Span{TraceID: "ffffffffffffffff"}), ShouldBeTrue)
+			So(ProbabilitySampler(0).Sample(&Span{TraceID: "0000000000000000"}), ShouldBeFalse)
+			So(ProbabilitySampler(.5).Sample(&Span{TraceID: "7fffffffffffffff"}), ShouldBeTrue)
+			So(ProbabilitySampler(.5).Sample(&Span{TraceID: "8000000000000000"}), ShouldBeFalse)
+			notHex := &Span{TraceID: "not hex"}
+			So(half.Sample(notHex), ShouldEqual, half.Sample(notHex))
+		})
+		Convey("should limit the rate", func() {
+			clock := timekeepertest.NewStubClock(time.Now())
+			r := NewRateLimitingSampler(2)
+			r.TimeKeeper = clock
+			results := make([]bool, 0, 4)
+			for i := 0; i < 3; i++ {
+				results = append(results, r.Sample(span))
+			}
+			clock.Incr(time.Second / 2)
+			results = append(results, r.Sample(span), r.Sample(span))
+			clock.Incr(time.Hour)
+			results = append(results, r.Sample(span), r.Sample(span), r.Sample(span))
+			So(results, ShouldResemble, []bool{true, true, false, true, false, true, true, false})
+		})
+		Convey("should follow the parent's decision", func() {
+			p := ParentBased(NeverSample)
+			So(p.Sample(span), ShouldBeFalse)
+			SetSampled(span, true)
+			So(p.Sample(span), ShouldBeTrue)
+			sampled, decided := Sampled(span)
+			So(sampled && decided, ShouldBeTrue)
+			_, decided = Sampled(&Span{})
+			So(decided, ShouldBeFalse)
+			SetSampled(span, false)
+			h := http.Header{}
+			InjectB3(h, span)
+			So(h.Get(B3SampledHeader), ShouldEqual, "0")
+		})
+		Convey("should filter what a sink forwards", func() {
+			next := &spanRecorder{}
+			keepEven := SamplerFunc(func(s *Span) bool {
+				return len(s.ID)%2 == 0
+			})
+			sink := FromChain(next, Sampling(keepEven))
+			var spans []*Span
+			for i := 0; i < 4; i++ {
+				spans = append(spans, &Span{ID: fmt.Sprint(i * 5)})
+			}
+			So(sink.AddSpans(context.Background(), spans), ShouldBeNil)
+			So(next.spans, ShouldResemble, spans[2:])
+			So(sink.AddSpans(context.Background(), spans[:2]), ShouldBeNil)
+			So(sink.(*SamplingSink).Dropped(), ShouldEqual, 4)
+			So(len(next.spans), ShouldEqual, 2)
+		})
+		Convey("should sample the spans StartSpan adds to a sink", func() {
+			next := &spanRecorder{}
+			sink := NewSamplingSink(ParentBased(ProbabilitySampler(0)), next)
+			_, dropped := StartSpan(context.Background(), "dropped", WithSink(sink))
+			So(dropped.Finish(), ShouldBeNil)
+			_, kept := StartSpan(context.Background(), "kept", WithSink(sink), WithSampler(AlwaysSample))
+			So(kept.Finish(), ShouldBeNil)
+			So(len(next.spans), ShouldEqual, 1)
+			So(*next.spans[0].Name, ShouldEqual, "kept")
+			So(sink.Dropped(), ShouldEqual, 1)
+		})
+	})
+}
@@ -0,0 +1,107 @@
+package trace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"google.golang.org/grpc/codes"
+)
+
+// Tags describing how a span's request finished
+const (
+	ErrorTag          = "error"
+	ErrorKindTag      = "error.kind"
+	HTTPStatusCodeTag = "http.status_code"
+	GRPCStatusCodeTag = "rpc.grpc.status_code"
+)
+
+// StatusMapper decides the tags that describe how a span's request finished, so what counts as an error
+// span can match an organization's alerting rules.  The zero value marks HTTP 5xx statuses, non OK gRPC codes
+// and errors other than context.Canceled as errors.
+type StatusMapper struct {
+	// HTTPError is true for HTTP statuses that are errors.  Defaults to HTTPServerError
+	HTTPError func(status int) bool
+	// GRPCError is true for gRPC codes that are errors.  Defaults to any code but OK
+	GRPCError func(code codes.Code) bool
+	// IgnoreError is true for errors that shouldn't mark a span as an error.  Defaults to context.Canceled
+	IgnoreError func(err error) bool
+	// ErrorTags are extra tags for an error.  Defaults to the error's type in ErrorKindTag
+	ErrorTags func(err error) map[string]string
+}
+
+// DefaultStatusMapper is used when a nil StatusMapper is applied
+var DefaultStatusMapper = &StatusMapper{}
+
+// HTTPServerError is true for 5xx statuses, which are errors for the server of a request
+func HTTPServerError(status int) bool {
+	return status >= 500
+}
+
+// HTTPClientError is true for 4xx and 5xx statuses, which are errors for the client of a request
+func HTTPClientError(status int) bool {
+	return status >= 400
+}
+
+// ApplyHTTP tags span with status, marking it an error if the mapper says status is one
+func (m *StatusMapper) ApplyHTTP(span *Span, status int) {
+	if m == nil {
+		m = DefaultStatusMapper
+	}
+	isError := HTTPServerError
+	if m.HTTPError != nil {
+		isError = m.HTTPError
+	}
+	setTag(span, HTTPStatusCodeTag, strconv.Itoa(status))
+	if isError(status) {
+		setTag(span, ErrorTag, "true")
+	}
+}
+
+// ApplyGRPC tags span with code, marking it an error if the mapper says code is one
+func (m *StatusMapper) ApplyGRPC(span *Span, code codes.Code) {
+	if m == nil {
+		m = DefaultStatusMapper
+	}
+	setTag(span, GRPCStatusCodeTag, strconv.FormatUint(uint64(code), 10))
+	isError := code != codes.OK
+	if m.GRPCError != nil {
+		isError = m.GRPCError(code)
+	}
+	if isError {
+		setTag(span, ErrorTag, "true")
+	}
+}
+
+// ApplyError marks span as an error with the error's tags, unless err is nil or ignored
+func (m *StatusMapper) ApplyError(span *Span, err error) {
+	if m == nil {
+		m = DefaultStatusMapper
+	}
+	if err == nil {
+		return
+	}
+	if m.IgnoreError != nil {
+		if m.IgnoreError(err) {
+			return
+		}
+	} else if errors.Is(err, context.Canceled) {
+		return
+	}
+	setTag(span, ErrorTag, "true")
+	if m.ErrorTags == nil {
+		setTag(span, ErrorKindTag, fmt.Sprintf("%T", err))
+		return
+	}
+	for k, v := range m.ErrorTags(err) {
+		setTag(span, k, v)
+	}
+}
+
+func setTag(span *Span, key, value string) {
+	if span.Tags == nil {
+		span.Tags = make(map[string]string)
+	}
+	span.Tags[key] = value
+}
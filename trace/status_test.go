@@ -0,0 +1,66 @@
+package trace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"google.golang.org/grpc/codes"
+)
+
+func TestStatusMapper(t *testing.T) {
+	Convey("The default status mapper", t, func() {
+		var m *StatusMapper
+		span := &Span{}
+		Convey("should only mark 5xx HTTP statuses as errors", func() {
+			m.ApplyHTTP(span, http.StatusNotFound)
+			So(span.Tags, ShouldResemble, map[string]string{HTTPStatusCodeTag: "404"})
+			m.ApplyHTTP(span, http.StatusBadGateway)
+			So(span.Tags, ShouldResemble, map[string]string{HTTPStatusCodeTag: "502", ErrorTag: "true"})
+		})
+		Convey("should mark gRPC codes other than OK as errors", func() {
+			m.ApplyGRPC(span, codes.OK)
+			So(span.Tags, ShouldResemble, map[string]string{GRPCStatusCodeTag: "0"})
+			m.ApplyGRPC(span, codes.NotFound)
+			So(span.Tags, ShouldResemble, map[string]string{GRPCStatusCodeTag: "5", ErrorTag: "true"})
+		})
+		Convey("should tag errors with their type", func() {
+			m.ApplyError(span, nil)
+			So(span.Tags, ShouldBeNil)
+			m.ApplyError(span, fmt.Errorf("cancelled: %w", context.Canceled))
+			So(span.Tags, ShouldBeNil)
+			m.ApplyError(span, errors.New("nope"))
+			So(span.Tags, ShouldResemble, map[string]string{ErrorTag: "true", ErrorKindTag: "*errors.errorString"})
+		})
+	})
+	Convey("A custom status mapper", t, func() {
+		m := &StatusMapper{
+			HTTPError:   HTTPClientError,
+			GRPCError:   func(code codes.Code) bool { return code == codes.Internal },
+			IgnoreError: func(err error) bool { return err.Error() == "ignored" },
+			ErrorTags: func(err error) map[string]string {
+				return map[string]string{"error.message": err.Error()}
+			},
+		}
+		span := &Span{}
+		Convey("should use its HTTP mapping", func() {
+			m.ApplyHTTP(span, http.StatusNotFound)
+			So(span.Tags[ErrorTag], ShouldEqual, "true")
+		})
+		Convey("should use its gRPC mapping", func() {
+			m.ApplyGRPC(span, codes.NotFound)
+			So(span.Tags[ErrorTag], ShouldEqual, "")
+			m.ApplyGRPC(span, codes.Internal)
+			So(span.Tags[ErrorTag], ShouldEqual, "true")
+		})
+		Convey("should use its error mapping", func() {
+			m.ApplyError(span, errors.New("ignored"))
+			So(span.Tags, ShouldBeNil)
+			m.ApplyError(span, context.Canceled)
+			So(span.Tags, ShouldResemble, map[string]string{ErrorTag: "true", "error.message": "context canceled"})
+		})
+	})
+}
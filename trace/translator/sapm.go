@@ -0,0 +1,147 @@
+// Copyright 2019 Splunk, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package translator
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/gogo/protobuf/proto"
+	jaegerpb "github.com/jaegertracing/jaeger/model"
+	"github.com/signalfx/golib/v3/trace"
+	gen "github.com/signalfx/sapm-proto/gen"
+)
+
+// EncodeSAPM marshals spans as a SAPM PostSpansRequest, ordered by Canonicalize so the same spans always
+// encode the same way.  Spans with invalid IDs are left out and make it return a *spanfilter.Map along
+// with the others.
+func EncodeSAPM(spans []*trace.Span) ([]byte, error) {
+	sr, sm := SFXToSAPMPostRequest(spans)
+	Canonicalize(sr)
+	b, err := proto.Marshal(sr)
+	if err != nil {
+		return nil, err
+	}
+	if sm.CheckInvalid() {
+		return b, sm
+	}
+	return b, nil
+}
+
+// DecodeSAPM unmarshals a SAPM PostSpansRequest into spans in the SignalFx format
+func DecodeSAPM(b []byte) ([]*trace.Span, error) {
+	sr := &gen.PostSpansRequest{}
+	if err := proto.Unmarshal(b, sr); err != nil {
+		return nil, err
+	}
+	return SAPMPostRequestToSFX(sr), nil
+}
+
+// SAPMPostRequestToSFX converts the spans of every batch of sr to the SignalFx format
+func SAPMPostRequestToSFX(sr *gen.PostSpansRequest) []*trace.Span {
+	var spans []*trace.Span
+	for _, batch := range sr.Batches {
+		for _, span := range batch.Spans {
+			process := span.Process
+			if process == nil {
+				process = batch.Process
+			}
+			spans = append(spans, SFXSpanFromSAPMSpan(span, process))
+		}
+	}
+	return spans
+}
+
+// SFXSpanFromSAPMSpan converts a SAPM span, of process, to the SignalFx format, undoing what
+// SAPMSpanFromSFXSpan does.  The peer tags become the remote endpoint, the span.kind tag the kind, and the
+// process its local endpoint, with its ip tag as the endpoint's address and its other tags as span tags.
+func SFXSpanFromSAPMSpan(span *jaegerpb.Span, process *jaegerpb.Process) *trace.Span {
+	timestamp := span.StartTime.UnixNano() / int64(nanosInOneMicro)
+	duration := span.Duration.Microseconds()
+	sfxSpan := &trace.Span{
+		TraceID:   span.TraceID.String(),
+		ID:        span.SpanID.String(),
+		Name:      &span.OperationName,
+		Timestamp: &timestamp,
+		Duration:  &duration,
+		Tags:      make(map[string]string, len(span.Tags)),
+	}
+	if span.Flags.IsDebug() {
+		debug := true
+		sfxSpan.Debug = &debug
+	}
+	if parentID := span.ParentSpanID(); parentID != 0 {
+		parent := parentID.String()
+		sfxSpan.ParentID = &parent
+	}
+	remoteEndpoint := &trace.Endpoint{}
+	for i := range span.Tags {
+		kv := &span.Tags[i]
+		value := kv.AsString()
+		switch kv.Key {
+		case peerHostIPv4:
+			remoteEndpoint.Ipv4 = &value
+		case peerHostIPv6:
+			remoteEndpoint.Ipv6 = &value
+		case peerPort:
+			if port, err := strconv.ParseInt(value, 10, 32); err == nil {
+				p := int32(port)
+				remoteEndpoint.Port = &p
+			}
+		case spanKind:
+			kind := strings.ToUpper(value)
+			sfxSpan.Kind = &kind
+		default:
+			sfxSpan.Tags[kv.Key] = value
+		}
+	}
+	if *remoteEndpoint != (trace.Endpoint{}) {
+		sfxSpan.RemoteEndpoint = remoteEndpoint
+	}
+	if process != nil {
+		serviceName := process.ServiceName
+		sfxSpan.LocalEndpoint = &trace.Endpoint{ServiceName: &serviceName}
+		for i := range process.Tags {
+			kv := &process.Tags[i]
+			value := kv.AsString()
+			if kv.Key == tagIP {
+				sfxSpan.LocalEndpoint.Ipv4 = &value
+				continue
+			}
+			sfxSpan.Tags[kv.Key] = value
+		}
+	}
+	for _, log := range span.Logs {
+		ts := log.Timestamp.UnixNano() / int64(nanosInOneMicro)
+		value := annotationFromFields(log.Fields)
+		sfxSpan.Annotations = append(sfxSpan.Annotations, &trace.Annotation{Timestamp: &ts, Value: &value})
+	}
+	return sfxSpan
+}
+
+// annotationFromFields undoes FieldsFromJSONString, returning the value of an annotation field or the fields
+// as a JSON object
+func annotationFromFields(fields []jaegerpb.KeyValue) string {
+	if len(fields) == 1 && fields[0].Key == "annotation" {
+		return fields[0].AsString()
+	}
+	m := make(map[string]string, len(fields))
+	for i := range fields {
+		m[fields[i].Key] = fields[i].AsString()
+	}
+	b, _ := json.Marshal(m)
+	return string(b)
+}
@@ -0,0 +1,106 @@
+// Copyright 2019 Splunk, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package translator
+
+import (
+	"testing"
+
+	"github.com/signalfx/golib/v3/pointer"
+	"github.com/signalfx/golib/v3/sfxclient/spanfilter"
+	"github.com/signalfx/golib/v3/trace"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSAPMRoundTrip(t *testing.T) {
+	spans := []*trace.Span{
+		{
+			TraceID:        "fa281a8955571a3a",
+			ID:             "acdfec5be6328c3a",
+			ParentID:       pointer.String("bcdfec5be6328c3a"),
+			Name:           pointer.String("GET /users"),
+			Kind:           &ServerKind,
+			Timestamp:      pointer.Int64(1575986204988181),
+			Duration:       pointer.Int64(1500),
+			Debug:          pointer.Bool(true),
+			LocalEndpoint:  &trace.Endpoint{ServiceName: pointer.String("api"), Ipv4: pointer.String("10.0.0.1")},
+			RemoteEndpoint: &trace.Endpoint{Ipv4: pointer.String("10.0.0.2"), Port: pointer.Int32(5432)},
+			Annotations: []*trace.Annotation{
+				{Timestamp: pointer.Int64(1575986204988182), Value: pointer.String("sent")},
+				{Timestamp: pointer.Int64(1575986204988183), Value: pointer.String(`{"event":"retry"}`)},
+			},
+			Tags: map[string]string{"http.method": "GET", "hostname": "web-1"},
+		},
+		{
+			TraceID:       "00000000000000010000000000000002",
+			ID:            "0000000000000003",
+			Name:          pointer.String("query"),
+			LocalEndpoint: &trace.Endpoint{ServiceName: pointer.String("db")},
+		},
+	}
+	b, err := EncodeSAPM(spans)
+	require.NoError(t, err)
+	decoded, err := DecodeSAPM(b)
+	require.NoError(t, err)
+	require.Len(t, decoded, 2)
+	byService := map[string]*trace.Span{}
+	for _, s := range decoded {
+		byService[*s.LocalEndpoint.ServiceName] = s
+	}
+
+	api := byService["api"]
+	assert.Equal(t, spans[0].TraceID, api.TraceID)
+	assert.Equal(t, spans[0].ID, api.ID)
+	assert.Equal(t, *spans[0].ParentID, *api.ParentID)
+	assert.Equal(t, "GET /users", *api.Name)
+	assert.Equal(t, "SERVER", *api.Kind)
+	assert.Equal(t, *spans[0].Timestamp, *api.Timestamp)
+	assert.Equal(t, int64(1500), *api.Duration)
+	assert.True(t, *api.Debug)
+	assert.Equal(t, "10.0.0.1", *api.LocalEndpoint.Ipv4)
+	assert.Equal(t, spans[0].RemoteEndpoint, api.RemoteEndpoint)
+	assert.Equal(t, map[string]string{"http.method": "GET", "hostname": "web-1"}, api.Tags)
+	require.Len(t, api.Annotations, 2)
+	assert.Equal(t, "sent", *api.Annotations[0].Value)
+	assert.Equal(t, *spans[0].Annotations[0].Timestamp, *api.Annotations[0].Timestamp)
+	assert.Equal(t, `{"event":"retry"}`, *api.Annotations[1].Value)
+
+	db := byService["db"]
+	assert.Equal(t, spans[1].TraceID, db.TraceID)
+	assert.Nil(t, db.ParentID)
+	assert.Nil(t, db.Kind)
+	assert.Nil(t, db.RemoteEndpoint)
+	assert.Nil(t, db.Debug)
+
+	again, err := EncodeSAPM(decoded)
+	require.NoError(t, err)
+	redecoded, err := DecodeSAPM(again)
+	require.NoError(t, err)
+	assert.Len(t, redecoded, 2)
+}
+
+func TestSAPMInvalid(t *testing.T) {
+	b, err := EncodeSAPM([]*trace.Span{
+		{TraceID: "fa281a8955571a3a", ID: "acdfec5be6328c3a"},
+		{TraceID: "fa281a8955571a3a", ID: "not hex"},
+	})
+	require.True(t, spanfilter.IsMap(err))
+	decoded, err := DecodeSAPM(b)
+	require.NoError(t, err)
+	assert.Len(t, decoded, 1)
+
+	_, err = DecodeSAPM([]byte{0xff})
+	assert.Error(t, err)
+}
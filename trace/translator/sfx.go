@@ -15,6 +15,7 @@
 package translator
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"sort"
@@ -268,3 +269,22 @@ func sortTags(t []jaegerpb.KeyValue) {
 		return t[i].Key <= t[j].Key
 	})
 }
+
+// Canonicalize orders the batches of sr by their process and the tags of every span by key, so the same
+// spans always marshal to the same bytes
+func Canonicalize(sr *gen.PostSpansRequest) {
+	keys := make(map[*jaegerpb.Batch][32]byte, len(sr.Batches))
+	for _, b := range sr.Batches {
+		keys[b], _ = GenSpanBatcherBucketID(b.Process)
+		for _, s := range b.Spans {
+			sortTags(s.Tags)
+			if s.Process != nil {
+				sortTags(s.Process.Tags)
+			}
+		}
+	}
+	sort.SliceStable(sr.Batches, func(i, j int) bool {
+		ki, kj := keys[sr.Batches[i]], keys[sr.Batches[j]]
+		return bytes.Compare(ki[:], kj[:]) < 0
+	})
+}
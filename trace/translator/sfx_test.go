@@ -780,3 +780,28 @@ func BenchmarkSFXTagsToJaegerTags(b *testing.B) {
 		}
 	}
 }
+
+func TestCanonicalize(t *testing.T) {
+	spans := make([]*trace.Span, 0, 6)
+	for i, service := range []string{"c", "a", "b", "a", "c", "b"} {
+		spans = append(spans, &trace.Span{
+			TraceID:       "fa281a8955571a3a",
+			ID:            "acdfec5be6328c3" + string(rune('0'+i)),
+			Name:          pointer.String("get"),
+			LocalEndpoint: &trace.Endpoint{ServiceName: pointer.String(service)},
+			Tags:          map[string]string{"z": "1", "a": "2", "m": "3", "b": "4"},
+		})
+	}
+	first, _ := SFXToSAPMPostRequest(spans)
+	Canonicalize(first)
+	for i := 0; i < 10; i++ {
+		sr, _ := SFXToSAPMPostRequest(spans)
+		Canonicalize(sr)
+		require.Equal(t, first, sr)
+	}
+	for _, b := range first.Batches {
+		for _, s := range b.Spans {
+			assert.True(t, sort.SliceIsSorted(s.Tags, func(i, j int) bool { return s.Tags[i].Key < s.Tags[j].Key }))
+		}
+	}
+}
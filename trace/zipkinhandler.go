@@ -0,0 +1,238 @@
+package trace
+
+import (
+	"compress/gzip"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// DefaultZipkinMaxBodyBytes is the biggest request body a ZipkinHandler decodes by default
+const DefaultZipkinMaxBodyBytes = 10 << 20
+
+// zipkinKinds are the span kinds of the Zipkin proto3 Span.Kind enum, by value
+var zipkinKinds = []string{"", "CLIENT", "SERVER", "PRODUCER", "CONSUMER"}
+
+// ZipkinHandler is an http.Handler accepting the spans Zipkin v2 reporters post to /api/v2/spans, as JSON or,
+// with a Content-Type of application/x-protobuf, proto3, gzipped or not.  The spans are added to Sink, so
+// it can relay spans between Zipkin instrumented services and any sink.
+type ZipkinHandler struct {
+	Sink Sink
+	// MaxBodyBytes is the biggest request body decoded, after it's gunzipped
+	MaxBodyBytes int64
+}
+
+var _ http.Handler = &ZipkinHandler{}
+
+// NewZipkinHandler creates a handler adding the spans posted to it to sink
+func NewZipkinHandler(sink Sink) *ZipkinHandler {
+	return &ZipkinHandler{
+		Sink:         sink,
+		MaxBodyBytes: DefaultZipkinMaxBodyBytes,
+	}
+}
+
+// ServeHTTP decodes the spans posted and adds them to Sink, replying 202 Accepted once it has.  Bodies that
+// can't be decoded are a 400 Bad Request, and the sink failing a 500.
+func (z *ZipkinHandler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		rw.Header().Set("Allow", http.MethodPost)
+		http.Error(rw, "only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+	var body io.Reader = req.Body
+	if strings.EqualFold(req.Header.Get("Content-Encoding"), "gzip") {
+		gz, err := gzip.NewReader(req.Body)
+		if err != nil {
+			http.Error(rw, "invalid gzip body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer func() {
+			_ = gz.Close()
+		}()
+		body = gz
+	}
+	b, err := io.ReadAll(io.LimitReader(body, z.MaxBodyBytes+1))
+	if err != nil {
+		http.Error(rw, "cannot read body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if int64(len(b)) > z.MaxBodyBytes {
+		http.Error(rw, fmt.Sprintf("body is over the limit of %d bytes", z.MaxBodyBytes), http.StatusRequestEntityTooLarge)
+		return
+	}
+	var spans []*Span
+	if strings.HasPrefix(req.Header.Get("Content-Type"), "application/x-protobuf") {
+		spans, err = DecodeZipkinProto(b)
+	} else {
+		err = json.Unmarshal(b, &spans)
+	}
+	if err != nil {
+		http.Error(rw, "cannot decode spans: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(spans) > 0 {
+		if err := z.Sink.AddSpans(req.Context(), spans); err != nil {
+			http.Error(rw, "cannot add spans: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	rw.WriteHeader(http.StatusAccepted)
+}
+
+// zipkinFields calls f with each field of the protobuf message msg.  Varint and fixed64 values are passed
+// as v, and bytes as b.
+func zipkinFields(msg []byte, f func(num protowire.Number, v uint64, b []byte) error) error {
+	for len(msg) > 0 {
+		num, typ, n := protowire.ConsumeTag(msg)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		msg = msg[n:]
+		var v uint64
+		var b []byte
+		switch typ {
+		case protowire.VarintType:
+			v, n = protowire.ConsumeVarint(msg)
+		case protowire.Fixed64Type:
+			v, n = protowire.ConsumeFixed64(msg)
+		case protowire.BytesType:
+			b, n = protowire.ConsumeBytes(msg)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, msg)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		msg = msg[n:]
+		if err := f(num, v, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DecodeZipkinProto decodes a Zipkin proto3 ListOfSpans
+func DecodeZipkinProto(msg []byte) ([]*Span, error) {
+	var spans []*Span
+	err := zipkinFields(msg, func(num protowire.Number, _ uint64, b []byte) error {
+		if num != 1 {
+			return nil
+		}
+		span, err := decodeZipkinSpan(b)
+		spans = append(spans, span)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return spans, nil
+}
+
+func decodeZipkinSpan(msg []byte) (*Span, error) {
+	s := &Span{}
+	err := zipkinFields(msg, func(num protowire.Number, v uint64, b []byte) error {
+		switch num {
+		case 1:
+			s.TraceID = hex.EncodeToString(b)
+		case 2:
+			parentID := hex.EncodeToString(b)
+			s.ParentID = &parentID
+		case 3:
+			s.ID = hex.EncodeToString(b)
+		case 4:
+			if v > 0 && v < uint64(len(zipkinKinds)) {
+				s.Kind = &zipkinKinds[v]
+			}
+		case 5:
+			name := string(b)
+			s.Name = &name
+		case 6:
+			ts := int64(v)
+			s.Timestamp = &ts
+		case 7:
+			duration := int64(v)
+			s.Duration = &duration
+		case 8:
+			s.LocalEndpoint = &Endpoint{}
+			return decodeZipkinEndpoint(b, s.LocalEndpoint)
+		case 9:
+			s.RemoteEndpoint = &Endpoint{}
+			return decodeZipkinEndpoint(b, s.RemoteEndpoint)
+		case 10:
+			a := &Annotation{}
+			s.Annotations = append(s.Annotations, a)
+			return decodeZipkinAnnotation(b, a)
+		case 11:
+			return decodeZipkinTag(b, s)
+		case 12:
+			debug := v != 0
+			s.Debug = &debug
+		case 13:
+			shared := v != 0
+			s.Shared = &shared
+		}
+		return nil
+	})
+	return s, err
+}
+
+func decodeZipkinEndpoint(msg []byte, e *Endpoint) error {
+	return zipkinFields(msg, func(num protowire.Number, v uint64, b []byte) error {
+		switch num {
+		case 1:
+			serviceName := string(b)
+			e.ServiceName = &serviceName
+		case 2, 3:
+			ip := net.IP(b).String()
+			if num == 2 {
+				e.Ipv4 = &ip
+			} else {
+				e.Ipv6 = &ip
+			}
+		case 4:
+			port := int32(v)
+			e.Port = &port
+		}
+		return nil
+	})
+}
+
+func decodeZipkinAnnotation(msg []byte, a *Annotation) error {
+	return zipkinFields(msg, func(num protowire.Number, v uint64, b []byte) error {
+		switch num {
+		case 1:
+			ts := int64(v)
+			a.Timestamp = &ts
+		case 2:
+			value := string(b)
+			a.Value = &value
+		}
+		return nil
+	})
+}
+
+// decodeZipkinTag decodes a map entry of the tags of s
+func decodeZipkinTag(msg []byte, s *Span) error {
+	var key, value string
+	err := zipkinFields(msg, func(num protowire.Number, _ uint64, b []byte) error {
+		switch num {
+		case 1:
+			key = string(b)
+		case 2:
+			value = string(b)
+		}
+		return nil
+	})
+	if s.Tags == nil {
+		s.Tags = make(map[string]string)
+	}
+	s.Tags[key] = value
+	return err
+}
@@ -0,0 +1,119 @@
+package trace
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+type failingSink struct{}
+
+func (failingSink) AddSpans(ctx context.Context, spans []*Span) error {
+	return errors.New("full")
+}
+
+func TestZipkinHandler(t *testing.T) {
+	Convey("a zipkin handler", t, func() {
+		sink := &spanRecorder{}
+		h := NewZipkinHandler(sink)
+		post := func(body []byte, header map[string]string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodPost, "/api/v2/spans", bytes.NewReader(body))
+			for k, v := range header {
+				req.Header.Set(k, v)
+			}
+			rw := httptest.NewRecorder()
+			h.ServeHTTP(rw, req)
+			return rw
+		}
+		Convey("should accept JSON", func() {
+			So(post([]byte(ValidJSON), nil).Code, ShouldEqual, http.StatusAccepted)
+			So(len(sink.spans), ShouldEqual, 1)
+			So(*sink.spans[0].LocalEndpoint.ServiceName, ShouldEqual, "string")
+			So(sink.spans[0].Tags, ShouldNotBeEmpty)
+		})
+		Convey("should accept gzipped bodies", func() {
+			var buf bytes.Buffer
+			gz := gzip.NewWriter(&buf)
+			_, err := gz.Write([]byte(ValidJSON))
+			So(err, ShouldBeNil)
+			So(gz.Close(), ShouldBeNil)
+			So(post(buf.Bytes(), map[string]string{"Content-Encoding": "gzip"}).Code, ShouldEqual, http.StatusAccepted)
+			So(len(sink.spans), ShouldEqual, 1)
+			So(post([]byte(ValidJSON), map[string]string{"Content-Encoding": "gzip"}).Code, ShouldEqual, http.StatusBadRequest)
+		})
+		Convey("should accept proto3", func() {
+			message := func(b []byte, num protowire.Number, msg []byte) []byte {
+				b = protowire.AppendTag(b, num, protowire.BytesType)
+				return protowire.AppendBytes(b, msg)
+			}
+			varint := func(b []byte, num protowire.Number, v uint64) []byte {
+				b = protowire.AppendTag(b, num, protowire.VarintType)
+				return protowire.AppendVarint(b, v)
+			}
+			fixed := func(b []byte, num protowire.Number, v uint64) []byte {
+				b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+				return protowire.AppendFixed64(b, v)
+			}
+			span := message(nil, 1, []byte{0xfa, 0x28, 0x1a, 0x89, 0x55, 0x57, 0x1a, 0x3a})
+			span = message(span, 2, []byte{1, 2, 3, 4, 5, 6, 7, 8})
+			span = message(span, 3, []byte{0xac, 0xdf, 0xec, 0x5b, 0xe6, 0x32, 0x8c, 0x3a})
+			span = varint(span, 4, 2)
+			span = message(span, 5, []byte("GET"))
+			span = fixed(span, 6, 1000)
+			span = varint(span, 7, 5)
+			endpoint := message(nil, 1, []byte("api"))
+			endpoint = message(endpoint, 2, []byte{10, 0, 0, 1})
+			endpoint = varint(endpoint, 4, 8080)
+			span = message(span, 8, endpoint)
+			span = message(span, 9, message(nil, 3, make([]byte, 16)))
+			span = message(span, 10, message(fixed(nil, 1, 1002), 2, []byte("sent")))
+			span = message(span, 11, message(message(nil, 1, []byte("http.method")), 2, []byte("GET")))
+			span = varint(span, 12, 1)
+			span = varint(span, 13, 1)
+			span = protowire.AppendTag(span, 99, protowire.Fixed32Type)
+			span = protowire.AppendFixed32(span, 7)
+			body := message(nil, 1, span)
+			So(post(body, map[string]string{"Content-Type": "application/x-protobuf"}).Code, ShouldEqual, http.StatusAccepted)
+			So(len(sink.spans), ShouldEqual, 1)
+			s := sink.spans[0]
+			So(s.TraceID, ShouldEqual, "fa281a8955571a3a")
+			So(*s.ParentID, ShouldEqual, "0102030405060708")
+			So(s.ID, ShouldEqual, "acdfec5be6328c3a")
+			So(*s.Kind, ShouldEqual, "SERVER")
+			So(*s.Name, ShouldEqual, "GET")
+			So(*s.Timestamp, ShouldEqual, 1000)
+			So(*s.Duration, ShouldEqual, 5)
+			So(*s.LocalEndpoint.ServiceName, ShouldEqual, "api")
+			So(*s.LocalEndpoint.Ipv4, ShouldEqual, "10.0.0.1")
+			So(*s.LocalEndpoint.Port, ShouldEqual, 8080)
+			So(*s.RemoteEndpoint.Ipv6, ShouldEqual, "::")
+			So(*s.Annotations[0].Timestamp, ShouldEqual, 1002)
+			So(*s.Annotations[0].Value, ShouldEqual, "sent")
+			So(s.Tags, ShouldResemble, map[string]string{"http.method": "GET"})
+			So(*s.Debug && *s.Shared, ShouldBeTrue)
+
+			So(post(body[:len(body)-3], map[string]string{"Content-Type": "application/x-protobuf"}).Code, ShouldEqual, http.StatusBadRequest)
+		})
+		Convey("should reject what it can't take", func() {
+			So(post([]byte("not json"), nil).Code, ShouldEqual, http.StatusBadRequest)
+			h.MaxBodyBytes = 10
+			So(post([]byte(ValidJSON), nil).Code, ShouldEqual, http.StatusRequestEntityTooLarge)
+			rw := httptest.NewRecorder()
+			h.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/api/v2/spans", nil))
+			So(rw.Code, ShouldEqual, http.StatusMethodNotAllowed)
+			So(len(sink.spans), ShouldEqual, 0)
+		})
+		Convey("should fail when the sink does", func() {
+			h.Sink = failingSink{}
+			So(post([]byte(ValidJSON), nil).Code, ShouldEqual, http.StatusInternalServerError)
+			So(post([]byte("[]"), nil).Code, ShouldEqual, http.StatusAccepted)
+		})
+	})
+}
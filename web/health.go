@@ -0,0 +1,241 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/sfxclient"
+	"github.com/signalfx/golib/v3/timekeeper"
+)
+
+const (
+	// DefaultHealthCheckTimeout is how long a health check can take by default
+	DefaultHealthCheckTimeout = time.Second * 5
+	// DefaultHealthCheckCacheTTL is how long a health check's result is reused by default
+	DefaultHealthCheckCacheTTL = time.Second
+)
+
+const (
+	healthStatusOK     = "ok"
+	healthStatusFailed = "failed"
+)
+
+// HealthCheckFunc checks a subsystem, returning an error if it's unhealthy.  It should return once ctx is
+// done.
+type HealthCheckFunc func(ctx context.Context) error
+
+// HealthCheckResult is the last result of a health check
+type HealthCheckResult struct {
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	LatencyMs float64   `json:"latency_ms"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// HealthReport is the JSON body of the health handlers' responses
+type HealthReport struct {
+	Status string                       `json:"status"`
+	Checks map[string]HealthCheckResult `json:"checks"`
+}
+
+// HealthRegistry runs the health checks subsystems register and serves their results as JSON, with 200
+// when they all pass and 503 when any fail.  Liveness checks, served by LivenessHandler as /healthz, say
+// whether the process works at all; readiness checks, served along with the liveness checks by
+// ReadinessHandler as /readyz, say whether it can take traffic.  Checks run concurrently, each with its own
+// Timeout, and results are reused for CacheTTL so frequent probes don't overload what's checked.
+type HealthRegistry struct {
+	// Timeout is how long each check can take before it fails
+	Timeout time.Duration
+	// CacheTTL is how long a check's result is reused before the check runs again
+	CacheTTL time.Duration
+	// State, if set, fails readiness while the service isn't healthy, like during graceful shutdown
+	State *ServiceState
+	// Dimensions are added to every datapoint
+	Dimensions map[string]string
+	Timer      timekeeper.TimeKeeper
+
+	mu     sync.Mutex
+	checks map[string]*healthCheck
+}
+
+var _ sfxclient.Collector = &HealthRegistry{}
+
+type healthCheck struct {
+	name     string
+	check    HealthCheckFunc
+	liveness bool
+
+	// mu is held while the check runs, so concurrent probes wait for its result rather than running it again
+	mu     sync.Mutex
+	result *HealthCheckResult
+}
+
+// NewHealthRegistry creates a HealthRegistry with the default timeout and cache TTL
+func NewHealthRegistry() *HealthRegistry {
+	return &HealthRegistry{
+		Timeout:  DefaultHealthCheckTimeout,
+		CacheTTL: DefaultHealthCheckCacheTTL,
+		Timer:    timekeeper.RealTime{},
+		checks:   make(map[string]*healthCheck),
+	}
+}
+
+// AddLivenessCheck registers a check of whether the process works, replacing any check named name
+func (h *HealthRegistry) AddLivenessCheck(name string, check HealthCheckFunc) {
+	h.add(&healthCheck{name: name, check: check, liveness: true})
+}
+
+// AddReadinessCheck registers a check of whether the process can take traffic, replacing any check named
+// name
+func (h *HealthRegistry) AddReadinessCheck(name string, check HealthCheckFunc) {
+	h.add(&healthCheck{name: name, check: check})
+}
+
+func (h *HealthRegistry) add(c *healthCheck) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checks[c.name] = c
+}
+
+// RemoveCheck unregisters the check named name
+func (h *HealthRegistry) RemoveCheck(name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.checks, name)
+}
+
+// LivenessHandler serves the results of the liveness checks
+func (h *HealthRegistry) LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		h.serve(rw, h.Check(r.Context(), false))
+	})
+}
+
+// ReadinessHandler serves the results of the liveness and readiness checks
+func (h *HealthRegistry) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		h.serve(rw, h.Check(r.Context(), true))
+	})
+}
+
+// RegisterHandlers serves LivenessHandler as /healthz and ReadinessHandler as /readyz on mux
+func (h *HealthRegistry) RegisterHandlers(mux *http.ServeMux) {
+	mux.Handle("/healthz", h.LivenessHandler())
+	mux.Handle("/readyz", h.ReadinessHandler())
+}
+
+func (h *HealthRegistry) serve(rw http.ResponseWriter, report HealthReport) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Cache-Control", "no-store")
+	if report.Status != healthStatusOK {
+		rw.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(rw).Encode(report)
+}
+
+// Check runs the liveness checks, and the readiness checks too if readiness is true, returning their results
+func (h *HealthRegistry) Check(ctx context.Context, readiness bool) HealthReport {
+	checks := h.list(readiness)
+	report := HealthReport{Status: healthStatusOK, Checks: make(map[string]HealthCheckResult, len(checks)+1)}
+	results := make([]HealthCheckResult, len(checks))
+	wg := sync.WaitGroup{}
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c *healthCheck) {
+			defer wg.Done()
+			results[i] = h.run(ctx, c)
+		}(i, c)
+	}
+	wg.Wait()
+	for i, c := range checks {
+		report.Checks[c.name] = results[i]
+		if results[i].Status != healthStatusOK {
+			report.Status = healthStatusFailed
+		}
+	}
+	if readiness && h.State != nil && !h.State.IsHealthy() {
+		report.Status = healthStatusFailed
+		report.Checks["service_state"] = HealthCheckResult{Status: healthStatusFailed, Error: "service is not healthy", CheckedAt: h.Timer.Now()}
+	}
+	return report
+}
+
+// list returns the checks to run, sorted by name
+func (h *HealthRegistry) list(readiness bool) []*healthCheck {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ret := make([]*healthCheck, 0, len(h.checks))
+	for _, c := range h.checks {
+		if c.liveness || readiness {
+			ret = append(ret, c)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].name < ret[j].name
+	})
+	return ret
+}
+
+// run returns the cached result of c, or runs it if the result is too old
+func (h *HealthRegistry) run(ctx context.Context, c *healthCheck) HealthCheckResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	start := h.Timer.Now()
+	if c.result != nil && start.Sub(c.result.CheckedAt) < h.CacheTTL {
+		return *c.result
+	}
+	ctx, cancel := context.WithTimeout(ctx, h.Timeout)
+	defer cancel()
+	errs := make(chan error, 1)
+	go func() {
+		errs <- c.check(ctx)
+	}()
+	var err error
+	select {
+	case err = <-errs:
+	case <-ctx.Done():
+		err = fmt.Errorf("check did not finish: %v", ctx.Err())
+	}
+	result := &HealthCheckResult{
+		Status:    healthStatusOK,
+		LatencyMs: float64(h.Timer.Now().Sub(start)) / float64(time.Millisecond),
+		CheckedAt: start,
+	}
+	if err != nil {
+		result.Status = healthStatusFailed
+		result.Error = err.Error()
+	}
+	c.result = result
+	return *result
+}
+
+// Datapoints returns the status, 1 if it passed and 0 if it failed, and latency in milliseconds of the last
+// run of each check
+func (h *HealthRegistry) Datapoints() []*datapoint.Datapoint {
+	checks := h.list(true)
+	dps := make([]*datapoint.Datapoint, 0, len(checks)*2)
+	for _, c := range checks {
+		c.mu.Lock()
+		result := c.result
+		c.mu.Unlock()
+		if result == nil {
+			continue
+		}
+		status := int64(0)
+		if result.Status == healthStatusOK {
+			status = 1
+		}
+		dims := datapoint.AddMaps(h.Dimensions, map[string]string{"check": c.name})
+		dps = append(dps,
+			sfxclient.Gauge("health.check.status", dims, status),
+			sfxclient.GaugeF("health.check.latency", dims, result.LatencyMs),
+		)
+	}
+	return dps
+}
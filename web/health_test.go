@@ -0,0 +1,114 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/timekeeper/timekeepertest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestHealthRegistry(t *testing.T) {
+	Convey("a health registry", t, func() {
+		h := NewHealthRegistry()
+		tk := timekeepertest.NewStubClock(time.Unix(1600000000, 0))
+		h.Timer = tk
+		mux := http.NewServeMux()
+		h.RegisterHandlers(mux)
+		get := func(path string) (int, HealthReport) {
+			rw := httptest.NewRecorder()
+			mux.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, path, nil))
+			So(rw.Header().Get("Content-Type"), ShouldEqual, "application/json")
+			var report HealthReport
+			So(json.NewDecoder(rw.Body).Decode(&report), ShouldBeNil)
+			return rw.Code, report
+		}
+		var dbRuns int64
+		var dbErr atomic.Value
+		dbErr.Store("")
+		h.AddLivenessCheck("process", func(ctx context.Context) error {
+			return nil
+		})
+		h.AddReadinessCheck("db", func(ctx context.Context) error {
+			atomic.AddInt64(&dbRuns, 1)
+			if msg := dbErr.Load().(string); msg != "" {
+				return errors.New(msg)
+			}
+			return nil
+		})
+		Convey("should pass when every check passes", func() {
+			code, report := get("/readyz")
+			So(code, ShouldEqual, http.StatusOK)
+			So(report.Status, ShouldEqual, "ok")
+			So(report.Checks["db"].Status, ShouldEqual, "ok")
+			So(report.Checks["process"].Status, ShouldEqual, "ok")
+			So(report.Checks["db"].CheckedAt.Equal(tk.Now()), ShouldBeTrue)
+		})
+		Convey("should only run liveness checks for /healthz", func() {
+			dbErr.Store("db is down")
+			code, report := get("/healthz")
+			So(code, ShouldEqual, http.StatusOK)
+			So(len(report.Checks), ShouldEqual, 1)
+			So(atomic.LoadInt64(&dbRuns), ShouldEqual, 0)
+		})
+		Convey("should fail when a check fails", func() {
+			dbErr.Store("db is down")
+			code, report := get("/readyz")
+			So(code, ShouldEqual, http.StatusServiceUnavailable)
+			So(report.Status, ShouldEqual, "failed")
+			So(report.Checks["db"].Error, ShouldEqual, "db is down")
+		})
+		Convey("should reuse results until they're too old", func() {
+			get("/readyz")
+			get("/readyz")
+			So(atomic.LoadInt64(&dbRuns), ShouldEqual, 1)
+			tk.Incr(DefaultHealthCheckCacheTTL)
+			get("/readyz")
+			So(atomic.LoadInt64(&dbRuns), ShouldEqual, 2)
+		})
+		Convey("should fail checks that take too long", func() {
+			h.Timeout = time.Millisecond
+			h.AddReadinessCheck("slow", func(ctx context.Context) error {
+				<-ctx.Done()
+				time.Sleep(time.Millisecond * 10)
+				return nil
+			})
+			code, report := get("/readyz")
+			So(code, ShouldEqual, http.StatusServiceUnavailable)
+			So(report.Checks["slow"].Error, ShouldContainSubstring, "check did not finish")
+		})
+		Convey("should fail readiness while the service isn't healthy", func() {
+			h.State = &ServiceState{}
+			h.State.GracefulShutdown()
+			code, report := get("/readyz")
+			So(code, ShouldEqual, http.StatusServiceUnavailable)
+			So(report.Checks["service_state"].Status, ShouldEqual, "failed")
+			code, _ = get("/healthz")
+			So(code, ShouldEqual, http.StatusOK)
+		})
+		Convey("should report the last results", func() {
+			So(h.Datapoints(), ShouldBeEmpty)
+			dbErr.Store("db is down")
+			h.Check(context.Background(), true)
+			h.RemoveCheck("process")
+			dps := h.Datapoints()
+			So(len(dps), ShouldEqual, 2)
+			So(dps[0].Metric, ShouldEqual, "health.check.status")
+			So(dps[0].Dimensions, ShouldResemble, map[string]string{"check": "db"})
+			So(dps[0].Value, ShouldResemble, datapoint.NewIntValue(0))
+			So(dps[1].Metric, ShouldEqual, "health.check.latency")
+			h.AddReadinessCheck("db", func(ctx context.Context) error {
+				return nil
+			})
+			h.Check(context.Background(), true)
+			So(h.Datapoints()[0].Value, ShouldResemble, datapoint.NewIntValue(1))
+		})
+	})
+}
@@ -0,0 +1,64 @@
+package web
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/signalfx/golib/v3/log"
+	"github.com/signalfx/golib/v3/sfxclient"
+	"github.com/signalfx/golib/v3/trace"
+)
+
+// DefaultRequestIDHeader is the header RequestLogger reads request IDs from and returns them in
+const DefaultRequestIDHeader = "X-Request-Id"
+
+// RequestLogger stores a logger on the context of each request, so log.FromContext logs the request's
+// method, URL, remote address and ID, and what Extractors find on the context, without each handler adding
+// them.  The request ID is read from the HeaderName header, or generated if there isn't one, and returned in
+// it.
+type RequestLogger struct {
+	// Logger is logged to, or log.DefaultLogger if nil
+	Logger     log.Logger
+	HeaderName string
+	// Extractors are used by log.FromContext for contexts of the request, along with the registered ones
+	Extractors []log.ContextExtractor
+}
+
+// NewRequestLogger creates a RequestLogger that also logs the trace and span IDs, and redacted token, of
+// each request
+func NewRequestLogger(logger log.Logger) *RequestLogger {
+	return &RequestLogger{
+		Logger:     logger,
+		HeaderName: DefaultRequestIDHeader,
+		Extractors: []log.ContextExtractor{trace.LogExtractor, sfxclient.TokenLogExtractor},
+	}
+}
+
+// ServeHTTPC calls next with a context carrying the request ID, the logger and the extractors
+func (m *RequestLogger) ServeHTTPC(ctx context.Context, rw http.ResponseWriter, r *http.Request, next ContextHandler) {
+	var id string
+	if m.HeaderName != "" {
+		id = r.Header.Get(m.HeaderName)
+	}
+	if id == "" {
+		id = trace.NewID()
+	}
+	if m.HeaderName != "" {
+		rw.Header().Set(m.HeaderName, id)
+	}
+	logger := m.Logger
+	if logger == nil {
+		logger = log.DefaultLogger
+	}
+	ctx = log.ContextWithRequestID(ctx, id)
+	ctx = log.ContextWithExtractors(ctx, m.Extractors...)
+	ctx = log.ContextWithLogger(ctx, log.NewContext(logger).With("http_method", r.Method, "http_url", r.URL.String(), "http_remote_addr", r.RemoteAddr))
+	next.ServeHTTPC(ctx, rw, r)
+}
+
+// CreateMiddleware creates a handler that calls next as the next in the chain
+func (m *RequestLogger) CreateMiddleware(next ContextHandler) ContextHandler {
+	return HandlerFunc(func(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
+		m.ServeHTTPC(ctx, rw, r, next)
+	})
+}
@@ -0,0 +1,50 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/signalfx/golib/v3/log"
+	"github.com/signalfx/golib/v3/trace"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRequestLogger(t *testing.T) {
+	Convey("A request logger", t, func() {
+		out := log.NewChannelLogger(10, log.Panic)
+		var got context.Context
+		chain := NewHandler(context.Background(), HandlerFunc(func(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
+			got = ctx
+		})).Add(NewRequestLogger(out))
+		req := httptest.NewRequest(http.MethodGet, "/path", nil)
+		rw := httptest.NewRecorder()
+		Convey("should log request values from the handler's context", func() {
+			chain.ServeHTTPC(trace.ContextWithSpan(context.Background(), &trace.Span{TraceID: "t", ID: "s"}), rw, req)
+			id := rw.Header().Get(DefaultRequestIDHeader)
+			So(len(id), ShouldEqual, 16)
+			So(log.RequestIDFromContext(got), ShouldEqual, id)
+			log.FromContext(got).Log(log.Msg, "hi")
+			So(<-out.Out, ShouldResemble, []interface{}{
+				"http_method", http.MethodGet, "http_url", "/path", "http_remote_addr", req.RemoteAddr,
+				log.RequestIDKey, id, trace.TraceIDKey, "t", trace.SpanIDKey, "s", log.Msg, "hi",
+			})
+		})
+		Convey("should keep the request's ID", func() {
+			req.Header.Set(DefaultRequestIDHeader, "abc")
+			chain.ServeHTTPC(context.Background(), rw, req)
+			So(rw.Header().Get(DefaultRequestIDHeader), ShouldEqual, "abc")
+			So(log.RequestIDFromContext(got), ShouldEqual, "abc")
+		})
+		Convey("should default to the default logger", func() {
+			chain := NewHandler(context.Background(), HandlerFunc(func(ctx context.Context, rw http.ResponseWriter, r *http.Request) {
+				got = ctx
+			})).Add(&RequestLogger{})
+			chain.ServeHTTPC(context.Background(), rw, req)
+			So(rw.Header().Get(DefaultRequestIDHeader), ShouldEqual, "")
+			So(log.RequestIDFromContext(got), ShouldNotEqual, "")
+			So(log.FromContext(got).Logger, ShouldEqual, log.DefaultLogger)
+		})
+	})
+}
@@ -0,0 +1,295 @@
+package web
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/errors"
+	"github.com/signalfx/golib/v3/sfxclient"
+)
+
+// ErrRequestBodyTooLarge is returned reading a request body past the limit of a BodyLimiter
+var ErrRequestBodyTooLarge = errors.New("request body too large")
+
+// errorResponse is the JSON body of the errors the request body middleware responds with
+type errorResponse struct {
+	Error    string `json:"error"`
+	MaxBytes int64  `json:"max_bytes,omitempty"`
+}
+
+// writeJSONError responds with status and a JSON error message
+func writeJSONError(rw http.ResponseWriter, status int, resp errorResponse) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	_ = json.NewEncoder(rw).Encode(resp)
+}
+
+// BodyLimiter is a negroni handler that rejects requests with bodies over MaxBytes with 413 and a JSON
+// error.  Requests that say they're too large are rejected before they're handled.  Otherwise the body
+// returns ErrRequestBodyTooLarge once it's read past MaxBytes, the 413 is sent if the handler hasn't
+// responded yet, and anything it writes after is dropped.  Put it after a Decompressor to limit the size of
+// decompressed bodies.
+type BodyLimiter struct {
+	MaxBytes         int64
+	RejectedRequests int64
+}
+
+var (
+	_ HTTPConstructor     = (&BodyLimiter{}).Wrap
+	_ NextHTTP            = (&BodyLimiter{}).ServeHTTP
+	_ sfxclient.Collector = &BodyLimiter{}
+)
+
+// NewBodyLimiter creates a BodyLimiter rejecting bodies over maxBytes
+func NewBodyLimiter(maxBytes int64) *BodyLimiter {
+	return &BodyLimiter{MaxBytes: maxBytes}
+}
+
+// Wrap returns a handler that forwards calls to next and limits the bodies of the calls forwarded
+func (b *BodyLimiter) Wrap(next http.Handler) http.Handler {
+	f := func(w http.ResponseWriter, r *http.Request) {
+		b.ServeHTTP(w, r, next)
+	}
+	return http.HandlerFunc(f)
+}
+
+// ServeHTTP limits the body of the request handled by next
+func (b *BodyLimiter) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.Handler) {
+	if r.ContentLength > b.MaxBytes {
+		b.reject(rw)
+		return
+	}
+	if r.Body == nil || r.Body == http.NoBody {
+		next.ServeHTTP(rw, r)
+		return
+	}
+	lw := &limitedWriter{ResponseWriter: rw}
+	r.Body = &limitedBody{ReadCloser: r.Body, remaining: b.MaxBytes, exceeded: func() {
+		lw.mu.Lock()
+		defer lw.mu.Unlock()
+		if !lw.rejected && !lw.wroteHeader {
+			lw.rejected = true
+			b.reject(rw)
+		}
+	}}
+	next.ServeHTTP(lw, r)
+}
+
+func (b *BodyLimiter) reject(rw http.ResponseWriter) {
+	atomic.AddInt64(&b.RejectedRequests, 1)
+	writeJSONError(rw, http.StatusRequestEntityTooLarge, errorResponse{Error: ErrRequestBodyTooLarge.Error(), MaxBytes: b.MaxBytes})
+}
+
+// Datapoints returns how many requests were rejected
+func (b *BodyLimiter) Datapoints() []*datapoint.Datapoint {
+	return []*datapoint.Datapoint{
+		sfxclient.Cumulative("total_rejected_requests", nil, atomic.LoadInt64(&b.RejectedRequests)),
+	}
+}
+
+// limitedBody is a request body that can be read up to a limit
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+	exceeded  func()
+}
+
+func (l *limitedBody) Read(p []byte) (int, error) {
+	if l.remaining < 0 {
+		return 0, ErrRequestBodyTooLarge
+	}
+	// read one byte past the limit to know if the body is over it
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err := l.ReadCloser.Read(p)
+	if int64(n) > l.remaining {
+		n = int(l.remaining)
+		l.remaining = -1
+		l.exceeded()
+		return n, ErrRequestBodyTooLarge
+	}
+	l.remaining -= int64(n)
+	return n, err
+}
+
+// limitedWriter drops the response of a handler once its request is rejected
+type limitedWriter struct {
+	http.ResponseWriter
+	mu          sync.Mutex
+	wroteHeader bool
+	rejected    bool
+}
+
+func (l *limitedWriter) WriteHeader(status int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.rejected {
+		return
+	}
+	l.wroteHeader = true
+	l.ResponseWriter.WriteHeader(status)
+}
+
+func (l *limitedWriter) Write(b []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.rejected {
+		return 0, ErrRequestBodyTooLarge
+	}
+	l.wroteHeader = true
+	return l.ResponseWriter.Write(b)
+}
+
+// Flush flushes the wrapped writer, if it can be
+func (l *limitedWriter) Flush() {
+	if f, ok := l.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the wrapped writer, for http.ResponseController
+func (l *limitedWriter) Unwrap() http.ResponseWriter {
+	return l.ResponseWriter
+}
+
+// DefaultMaxZstdWindow is the largest zstd window a Decompressor accepts by default
+const DefaultMaxZstdWindow = 8 << 20
+
+// Decompressor is a negroni handler that decompresses gzip, deflate and zstd request bodies, so handlers
+// read them as if they were sent uncompressed.  Requests with other encodings are rejected with 415, and
+// ones whose gzip or deflate headers are invalid with 400, with a JSON error.  Bodies corrupt past that
+// return an error when they're read.
+type Decompressor struct {
+	// MaxZstdWindow is the largest window, the memory a zstd frame makes the decoder allocate, that's
+	// accepted, DefaultMaxZstdWindow if it's zero.  Frames asking for more return an error when they're
+	// read.  It's usually set to the MaxBytes of the BodyLimiter after the Decompressor.
+	MaxZstdWindow int64
+
+	mu           sync.Mutex
+	decompressed map[string]int64
+	rejected     int64
+}
+
+var (
+	_ HTTPConstructor     = (&Decompressor{}).Wrap
+	_ NextHTTP            = (&Decompressor{}).ServeHTTP
+	_ sfxclient.Collector = &Decompressor{}
+)
+
+// Wrap returns a handler that forwards calls to next and decompresses the bodies of the calls forwarded
+func (d *Decompressor) Wrap(next http.Handler) http.Handler {
+	f := func(w http.ResponseWriter, r *http.Request) {
+		d.ServeHTTP(w, r, next)
+	}
+	return http.HandlerFunc(f)
+}
+
+// ServeHTTP decompresses the body of the request handled by next
+func (d *Decompressor) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.Handler) {
+	encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+	if encoding == "" || encoding == "identity" || r.Body == nil || r.Body == http.NoBody {
+		next.ServeHTTP(rw, r)
+		return
+	}
+	body, err := decompressBody(encoding, r.Body, d.maxZstdWindow())
+	if err != nil {
+		d.mu.Lock()
+		d.rejected++
+		d.mu.Unlock()
+		if err == errUnsupportedEncoding {
+			writeJSONError(rw, http.StatusUnsupportedMediaType, errorResponse{Error: err.Error() + " " + encoding})
+			return
+		}
+		writeJSONError(rw, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+	d.mu.Lock()
+	if d.decompressed == nil {
+		d.decompressed = make(map[string]int64)
+	}
+	d.decompressed[encoding]++
+	d.mu.Unlock()
+	r.Body = body
+	r.Header.Del("Content-Encoding")
+	r.Header.Del("Content-Length")
+	r.ContentLength = -1
+	next.ServeHTTP(rw, r)
+}
+
+func (d *Decompressor) maxZstdWindow() uint64 {
+	switch {
+	case d.MaxZstdWindow <= 0:
+		return DefaultMaxZstdWindow
+	case d.MaxZstdWindow < zstd.MinWindowSize:
+		return zstd.MinWindowSize
+	}
+	return uint64(d.MaxZstdWindow)
+}
+
+// Datapoints returns how many requests were decompressed, by encoding, and how many were rejected
+func (d *Decompressor) Datapoints() []*datapoint.Datapoint {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	dps := make([]*datapoint.Datapoint, 0, len(d.decompressed)+1)
+	for encoding, count := range d.decompressed {
+		dps = append(dps, sfxclient.Cumulative("total_decompressed_requests", map[string]string{"encoding": encoding}, count))
+	}
+	return append(dps, sfxclient.Cumulative("total_decompression_failures", nil, d.rejected))
+}
+
+var errUnsupportedEncoding = errors.New("unsupported content encoding")
+
+// decompressBody returns body decompressed from encoding, with zstd windows no larger than maxWindow
+func decompressBody(encoding string, body io.ReadCloser, maxWindow uint64) (io.ReadCloser, error) {
+	switch encoding {
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, errors.Errorf("invalid gzip request body: %v", err)
+		}
+		return &decompressedBody{Reader: zr, closers: []io.Closer{zr, body}}, nil
+	case "deflate":
+		zr, err := zlib.NewReader(body)
+		if err != nil {
+			return nil, errors.Errorf("invalid deflate request body: %v", err)
+		}
+		return &decompressedBody{Reader: zr, closers: []io.Closer{zr, body}}, nil
+	case "zstd":
+		zr, err := zstd.NewReader(body, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxWindow(maxWindow), zstd.WithDecoderMaxMemory(maxWindow))
+		if err != nil {
+			return nil, errors.Errorf("invalid zstd request body: %v", err)
+		}
+		return &decompressedBody{Reader: zr, closers: []io.Closer{closerFunc(zr.Close), body}}, nil
+	}
+	return nil, errUnsupportedEncoding
+}
+
+// decompressedBody reads a decompressed body, closing the decompressor and the original body together
+type decompressedBody struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (d *decompressedBody) Close() error {
+	errs := make([]error, 0, len(d.closers))
+	for _, c := range d.closers {
+		errs = append(errs, c.Close())
+	}
+	return errors.NewMultiErr(errs)
+}
+
+type closerFunc func()
+
+func (c closerFunc) Close() error {
+	c()
+	return nil
+}
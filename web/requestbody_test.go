@@ -0,0 +1,143 @@
+package web
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/signalfx/golib/v3/datapoint"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBodyLimiter(t *testing.T) {
+	Convey("a body limiter", t, func() {
+		b := NewBodyLimiter(5)
+		var readErr error
+		handler := b.Wrap(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			var body []byte
+			body, readErr = io.ReadAll(r.Body)
+			if readErr != nil {
+				http.Error(rw, readErr.Error(), http.StatusBadRequest)
+				return
+			}
+			rw.(http.Flusher).Flush()
+			_, _ = rw.Write(body)
+		}))
+		request := func(body io.Reader, contentLength int64) *httptest.ResponseRecorder {
+			rw := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/", body)
+			req.ContentLength = contentLength
+			handler.ServeHTTP(rw, req)
+			return rw
+		}
+		Convey("should pass bodies under the limit", func() {
+			rw := request(strings.NewReader("12345"), -1)
+			So(rw.Code, ShouldEqual, http.StatusOK)
+			So(rw.Body.String(), ShouldEqual, "12345")
+			So(request(nil, 0).Code, ShouldEqual, http.StatusOK)
+			So(b.RejectedRequests, ShouldEqual, 0)
+		})
+		Convey("should reject requests that say they're too large", func() {
+			rw := request(strings.NewReader("123456"), 6)
+			So(rw.Code, ShouldEqual, http.StatusRequestEntityTooLarge)
+			So(rw.Header().Get("Content-Type"), ShouldEqual, "application/json")
+			So(rw.Body.String(), ShouldEqual, `{"error":"request body too large","max_bytes":5}`+"\n")
+			So(b.Datapoints()[0].Value, ShouldResemble, datapoint.NewIntValue(1))
+		})
+		Convey("should reject bodies read past the limit", func() {
+			rw := request(strings.NewReader("123456"), -1)
+			So(readErr, ShouldEqual, ErrRequestBodyTooLarge)
+			So(rw.Code, ShouldEqual, http.StatusRequestEntityTooLarge)
+			So(rw.Body.String(), ShouldEqual, `{"error":"request body too large","max_bytes":5}`+"\n")
+			So(b.RejectedRequests, ShouldEqual, 1)
+
+			body := &limitedBody{ReadCloser: io.NopCloser(strings.NewReader("123")), remaining: -1}
+			_, err := body.Read(make([]byte, 1))
+			So(err, ShouldEqual, ErrRequestBodyTooLarge)
+		})
+		Convey("should leave a started response alone", func() {
+			lw := &limitedWriter{ResponseWriter: httptest.NewRecorder()}
+			lw.WriteHeader(http.StatusAccepted)
+			So(lw.Unwrap().(*httptest.ResponseRecorder).Code, ShouldEqual, http.StatusAccepted)
+			lw.rejected = true
+			lw.WriteHeader(http.StatusOK)
+			_, err := lw.Write([]byte("dropped"))
+			So(err, ShouldEqual, ErrRequestBodyTooLarge)
+		})
+	})
+}
+
+func TestDecompressor(t *testing.T) {
+	Convey("a decompressor", t, func() {
+		d := &Decompressor{}
+		handler := d.Wrap(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			So(r.Header.Get("Content-Encoding"), ShouldEqual, "")
+			body, err := io.ReadAll(r.Body)
+			So(r.Body.Close(), ShouldBeNil)
+			if err != nil {
+				http.Error(rw, err.Error(), http.StatusBadRequest)
+				return
+			}
+			_, _ = rw.Write(body)
+		}))
+		request := func(encoding string, body []byte) *httptest.ResponseRecorder {
+			rw := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+			req.Header.Set("Content-Encoding", encoding)
+			handler.ServeHTTP(rw, req)
+			return rw
+		}
+		compress := func(newWriter func(io.Writer) io.WriteCloser) []byte {
+			buf := &bytes.Buffer{}
+			w := newWriter(buf)
+			_, err := w.Write([]byte("hello"))
+			So(err, ShouldBeNil)
+			So(w.Close(), ShouldBeNil)
+			return buf.Bytes()
+		}
+		Convey("should decompress bodies", func() {
+			So(request("gzip", compress(func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) })).Body.String(), ShouldEqual, "hello")
+			So(request("deflate", compress(func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) })).Body.String(), ShouldEqual, "hello")
+			So(request("zstd", compress(func(w io.Writer) io.WriteCloser {
+				zw, err := zstd.NewWriter(w)
+				So(err, ShouldBeNil)
+				return zw
+			})).Body.String(), ShouldEqual, "hello")
+			So(request("", []byte("plain")).Body.String(), ShouldEqual, "plain")
+			dps := d.Datapoints()
+			So(len(dps), ShouldEqual, 4)
+			for _, dp := range dps {
+				if dp.Metric == "total_decompressed_requests" {
+					So(dp.Value, ShouldResemble, datapoint.NewIntValue(1))
+				}
+			}
+		})
+		Convey("should reject bodies it can't decompress", func() {
+			rw := request("br", []byte("hello"))
+			So(rw.Code, ShouldEqual, http.StatusUnsupportedMediaType)
+			So(rw.Body.String(), ShouldEqual, `{"error":"unsupported content encoding br"}`+"\n")
+			for _, encoding := range []string{"gzip", "deflate", "zstd"} {
+				So(request(encoding, []byte("hello")).Code, ShouldEqual, http.StatusBadRequest)
+			}
+			dps := d.Datapoints()
+			So(dps[len(dps)-1].Value, ShouldResemble, datapoint.NewIntValue(3))
+		})
+		Convey("should reject zstd frames with windows over the limit", func() {
+			// a frame header asking for a 512MB window, then an empty last block
+			frame := []byte{0x28, 0xb5, 0x2f, 0xfd, 0x00, 19 << 3, 0x01, 0x00, 0x00}
+			rw := request("zstd", frame)
+			So(rw.Code, ShouldEqual, http.StatusBadRequest)
+			So(rw.Body.String(), ShouldContainSubstring, "window size exceeded")
+			d.MaxZstdWindow = 1
+			So(d.maxZstdWindow(), ShouldEqual, zstd.MinWindowSize)
+			frame[5] = 0
+			So(request("zstd", frame).Code, ShouldEqual, http.StatusOK)
+		})
+	})
+}
@@ -0,0 +1,240 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/sfxclient"
+)
+
+// DefaultRouteLatencyBounds are the upper bounds, in milliseconds, of the latency buckets RouteMetrics counts
+// requests in by default
+var DefaultRouteLatencyBounds = []float64{1, 2.5, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+// DefaultMaxRoutes is how many routes RouteMetrics tracks by default
+const DefaultMaxRoutes = 1000
+
+const (
+	// otherRoute is the route requests of untracked routes, and untracked methods, are counted under
+	otherRoute = "other"
+	// unknownRoute is the route of requests no route template was set for
+	unknownRoute = "unknown"
+)
+
+// RouteMetrics is a negroni handler, and a Collector, that tracks per route template, like /users/{id}
+// rather than the path requested: a cumulative count of requests by status class, like 2xx, a histogram of
+// their latency in milliseconds and the bytes of their responses.  Datapoints are reported as
+// http.server.requests, http.server.latency and http.server.response_bytes, with route and method dimensions.
+type RouteMetrics struct {
+	// Dimensions are added to every datapoint
+	Dimensions map[string]string
+	// LatencyBounds are the increasing upper bounds of the latency buckets, in milliseconds.  They can't change
+	// once requests are handled.
+	LatencyBounds []float64
+	// MaxRoutes caps how many routes and methods are tracked, so requests for made up paths can't make a
+	// server report unbounded series.  Requests past the cap are counted as the route "other".
+	MaxRoutes int
+	// Route returns the route template of requests handlers didn't set one for with SetRouteTemplate.  If
+	// it's nil, or returns "", the route is "unknown".
+	Route func(r *http.Request) string
+
+	mu     sync.Mutex
+	routes map[routeKey]*routeStats
+}
+
+var (
+	_ HTTPConstructor     = (&RouteMetrics{}).Wrap
+	_ NextHTTP            = (&RouteMetrics{}).ServeHTTP
+	_ sfxclient.Collector = &RouteMetrics{}
+)
+
+type routeKey struct {
+	route  string
+	method string
+}
+
+type routeStats struct {
+	requests      map[string]int64
+	latencyCounts []uint64
+	latencySum    float64
+	responseBytes int64
+}
+
+type routeTemplateKey struct{}
+
+// routeTemplate is where handlers put the route template of the request
+type routeTemplate struct {
+	template string
+}
+
+// NewRouteMetrics creates RouteMetrics with DefaultRouteLatencyBounds, reporting to scheduler if it isn't nil
+func NewRouteMetrics(scheduler *sfxclient.Scheduler, dimensions map[string]string) *RouteMetrics {
+	m := &RouteMetrics{
+		Dimensions:    dimensions,
+		LatencyBounds: DefaultRouteLatencyBounds,
+		MaxRoutes:     DefaultMaxRoutes,
+	}
+	if scheduler != nil {
+		scheduler.AddCallback(m)
+	}
+	return m
+}
+
+// SetRouteTemplate sets the route template RouteMetrics tracks the request as.  Routers, or handlers,
+// call it once they know the route.
+func SetRouteTemplate(r *http.Request, template string) {
+	if t, ok := r.Context().Value(routeTemplateKey{}).(*routeTemplate); ok {
+		t.template = template
+	}
+}
+
+// RouteTemplate returns a handler that sets the route template of requests to template, then calls next
+func RouteTemplate(template string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		SetRouteTemplate(r, template)
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// Wrap returns a handler that forwards calls to next and tracks the calls forwarded
+func (m *RouteMetrics) Wrap(next http.Handler) http.Handler {
+	f := func(w http.ResponseWriter, r *http.Request) {
+		m.ServeHTTP(w, r, next)
+	}
+	return http.HandlerFunc(f)
+}
+
+// ServeHTTP tracks the request handled by next
+func (m *RouteMetrics) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.Handler) {
+	template := &routeTemplate{}
+	r = r.WithContext(context.WithValue(r.Context(), routeTemplateKey{}, template))
+	recorder := &statusRecorder{ResponseWriter: rw}
+	start := time.Now()
+	next.ServeHTTP(recorder, r)
+	latency := float64(time.Since(start)) / float64(time.Millisecond)
+
+	route := template.template
+	if route == "" && m.Route != nil {
+		route = m.Route(r)
+	}
+	if route == "" {
+		route = unknownRoute
+	}
+	m.add(routeKey{route: route, method: routeMethod(r.Method)}, recorder.statusClass(), latency, recorder.bytes)
+}
+
+func (m *RouteMetrics) add(key routeKey, statusClass string, latency float64, bytes int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.route(key)
+	s.requests[statusClass]++
+	bucket := len(m.LatencyBounds)
+	for i, bound := range m.LatencyBounds {
+		if latency <= bound {
+			bucket = i
+			break
+		}
+	}
+	s.latencyCounts[bucket]++
+	s.latencySum += latency
+	s.responseBytes += bytes
+}
+
+// route returns the stats of key, or of the other route if there are too many.  m.mu must be held.
+func (m *RouteMetrics) route(key routeKey) *routeStats {
+	if m.routes == nil {
+		m.routes = make(map[routeKey]*routeStats)
+	}
+	s, exists := m.routes[key]
+	if exists {
+		return s
+	}
+	if m.MaxRoutes > 0 && len(m.routes) >= m.MaxRoutes {
+		key = routeKey{route: otherRoute, method: otherRoute}
+		if s, exists = m.routes[key]; exists {
+			return s
+		}
+	}
+	s = &routeStats{
+		requests:      make(map[string]int64),
+		latencyCounts: make([]uint64, len(m.LatencyBounds)+1),
+	}
+	m.routes[key] = s
+	return s
+}
+
+// Datapoints returns the stats of each route requested
+func (m *RouteMetrics) Datapoints() []*datapoint.Datapoint {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	dps := make([]*datapoint.Datapoint, 0, len(m.routes)*3)
+	for key, s := range m.routes {
+		dims := datapoint.AddMaps(m.Dimensions, map[string]string{"route": key.route, "method": key.method})
+		for class, count := range s.requests {
+			dps = append(dps, sfxclient.Cumulative("http.server.requests", datapoint.AddMaps(dims, map[string]string{"status_class": class}), count))
+		}
+		if latency, err := datapoint.NewHistogramValue(m.LatencyBounds, s.latencyCounts, s.latencySum); err == nil {
+			dps = append(dps, sfxclient.Histogram("http.server.latency", dims, latency))
+		}
+		dps = append(dps, sfxclient.Cumulative("http.server.response_bytes", dims, s.responseBytes))
+	}
+	return dps
+}
+
+// routeMethod returns method if it's a standard HTTP method, so made up methods can't add series
+func routeMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete,
+		http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return otherRoute
+}
+
+// statusRecorder remembers the status and counts the bytes of a response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	n, err := s.ResponseWriter.Write(b)
+	s.bytes += int64(n)
+	return n, err
+}
+
+// Flush flushes the wrapped writer, if it can be
+func (s *statusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the wrapped writer, for http.ResponseController
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// statusClass returns the class of the status, like 2xx.  A handler that wrote nothing responded 200.
+func (s *statusRecorder) statusClass() string {
+	status := s.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	return strconv.Itoa(status/100) + "xx"
+}
@@ -0,0 +1,87 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/sfxclient"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRouteMetrics(t *testing.T) {
+	Convey("route metrics", t, func() {
+		scheduler := sfxclient.NewScheduler()
+		m := NewRouteMetrics(scheduler, map[string]string{"app": "test"})
+		mux := http.NewServeMux()
+		mux.Handle("/users/", RouteTemplate("/users/{id}", http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			_, _ = rw.Write([]byte("user"))
+		})))
+		mux.Handle("/missing", http.NotFoundHandler())
+		handler := m.Wrap(mux)
+		request := func(method string, path string) *httptest.ResponseRecorder {
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, httptest.NewRequest(method, path, nil))
+			return rw
+		}
+		find := func(dps []*datapoint.Datapoint, metric string, dims map[string]string) *datapoint.Datapoint {
+			for _, dp := range dps {
+				if dp.Metric == metric && dp.Dimensions["route"] == dims["route"] && dp.Dimensions["method"] == dims["method"] && dp.Dimensions["status_class"] == dims["status_class"] {
+					return dp
+				}
+			}
+			return nil
+		}
+		Convey("should track requests by route template", func() {
+			So(request(http.MethodGet, "/users/1").Body.String(), ShouldEqual, "user")
+			request(http.MethodGet, "/users/2")
+			request(http.MethodGet, "/missing")
+			request("MADEUP", "/users/3")
+			dps := m.Datapoints()
+			ok := find(dps, "http.server.requests", map[string]string{"route": "/users/{id}", "method": "GET", "status_class": "2xx"})
+			So(ok.Value, ShouldResemble, datapoint.NewIntValue(2))
+			So(ok.MetricType, ShouldEqual, datapoint.Counter)
+			So(ok.Dimensions, ShouldResemble, map[string]string{"app": "test", "route": "/users/{id}", "method": "GET", "status_class": "2xx"})
+			So(find(dps, "http.server.requests", map[string]string{"route": "unknown", "method": "GET", "status_class": "4xx"}).Value, ShouldResemble, datapoint.NewIntValue(1))
+			So(find(dps, "http.server.requests", map[string]string{"route": "/users/{id}", "method": "other", "status_class": "2xx"}), ShouldNotBeNil)
+			So(find(dps, "http.server.response_bytes", map[string]string{"route": "/users/{id}", "method": "GET"}).Value, ShouldResemble, datapoint.NewIntValue(8))
+			latency := find(dps, "http.server.latency", map[string]string{"route": "/users/{id}", "method": "GET"}).Value.(datapoint.HistogramValue)
+			So(latency.Bounds(), ShouldResemble, DefaultRouteLatencyBounds)
+			So(latency.Count(), ShouldEqual, 2)
+			So(len(dps), ShouldEqual, 3*3)
+		})
+		Convey("should use Route when no template is set", func() {
+			m.Route = func(r *http.Request) string {
+				return "/route"
+			}
+			request(http.MethodPost, "/missing")
+			So(find(m.Datapoints(), "http.server.requests", map[string]string{"route": "/route", "method": "POST", "status_class": "4xx"}), ShouldNotBeNil)
+		})
+		Convey("should count routes past the cap as other", func() {
+			m.MaxRoutes = 1
+			request(http.MethodGet, "/users/1")
+			request(http.MethodGet, "/missing")
+			request(http.MethodPut, "/missing")
+			dps := m.Datapoints()
+			So(find(dps, "http.server.requests", map[string]string{"route": "other", "method": "other", "status_class": "4xx"}).Value, ShouldResemble, datapoint.NewIntValue(2))
+			So(len(dps), ShouldEqual, 2*3)
+		})
+		Convey("should record statuses and flushes", func() {
+			rw := httptest.NewRecorder()
+			recorder := &statusRecorder{ResponseWriter: rw}
+			So(recorder.statusClass(), ShouldEqual, "2xx")
+			recorder.WriteHeader(http.StatusServiceUnavailable)
+			recorder.WriteHeader(http.StatusOK)
+			recorder.Flush()
+			So(recorder.statusClass(), ShouldEqual, "5xx")
+			So(rw.Flushed, ShouldBeTrue)
+			So(recorder.Unwrap(), ShouldEqual, rw)
+			SetRouteTemplate(httptest.NewRequest(http.MethodGet, "/", nil), "/ignored")
+		})
+		Convey("should work without a scheduler", func() {
+			scheduler.RemoveCallback(m)
+			So(NewRouteMetrics(nil, nil).Datapoints(), ShouldBeEmpty)
+		})
+	})
+}
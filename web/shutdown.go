@@ -0,0 +1,126 @@
+package web
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/signalfx/golib/v3/errors"
+	"github.com/signalfx/golib/v3/sfxclient"
+)
+
+// DefaultShutdownDeadline is how long a ShutdownManager's shutdown can take by default
+const DefaultShutdownDeadline = time.Second * 30
+
+// drainPollInterval is how often outstanding requests are checked while they drain
+const drainPollInterval = time.Millisecond * 10
+
+// ShutdownManager shuts a server down in order, within an overall Deadline:
+//
+//  1. State is set to graceful shutdown, so health checks fail and load balancers stop sending requests
+//  2. after DrainDelay, to give load balancers time to notice, the Servers stop taking connections and wait
+//     for the requests they're handling
+//  3. the outstanding requests Counter counts, like hijacked connections and gRPC calls, are waited for
+//  4. the Scheduler reports one last time and flushes its sink
+//  5. the Closers, like sinks, are closed in order
+//
+// A step that fails, or runs out of time, doesn't stop the later ones: everything is given the chance to
+// clean up, and the errors are returned together.
+type ShutdownManager struct {
+	Servers   []*http.Server
+	State     *ServiceState
+	Counter   *RequestCounter
+	Scheduler *sfxclient.Scheduler
+	Closers   []io.Closer
+	// Deadline is how long the whole shutdown can take
+	Deadline time.Duration
+	// DrainDelay is how long to wait after failing health checks before the servers stop
+	DrainDelay time.Duration
+	// Signals are the signals WaitForSignal shuts down on
+	Signals []os.Signal
+
+	once sync.Once
+	err  error
+}
+
+// NewShutdownManager creates a ShutdownManager for servers that shuts down on SIGTERM and SIGINT within
+// DefaultShutdownDeadline
+func NewShutdownManager(servers ...*http.Server) *ShutdownManager {
+	return &ShutdownManager{
+		Servers:  servers,
+		Deadline: DefaultShutdownDeadline,
+		Signals:  []os.Signal{syscall.SIGTERM, os.Interrupt},
+	}
+}
+
+// WaitForSignal waits for one of the Signals, then shuts down.  It returns ctx's error without shutting
+// down if ctx is done first.
+func (m *ShutdownManager) WaitForSignal(ctx context.Context) error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, m.Signals...)
+	defer signal.Stop(signals)
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-signals:
+		return m.Shutdown(context.Background())
+	}
+}
+
+// Shutdown shuts down once, within the Deadline or until ctx is done.  Calling it again returns the error of
+// the first shutdown.
+func (m *ShutdownManager) Shutdown(ctx context.Context) error {
+	m.once.Do(func() {
+		if m.Deadline > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, m.Deadline)
+			defer cancel()
+		}
+		m.err = m.shutdown(ctx)
+	})
+	return m.err
+}
+
+func (m *ShutdownManager) shutdown(ctx context.Context) error {
+	var errs []error
+	if m.State != nil {
+		m.State.GracefulShutdown()
+	}
+	if m.DrainDelay > 0 {
+		select {
+		case <-ctx.Done():
+		case <-time.After(m.DrainDelay):
+		}
+	}
+	for _, server := range m.Servers {
+		errs = append(errs, errors.Annotatef(server.Shutdown(ctx), "cannot shut down server %s", server.Addr))
+	}
+	if m.Counter != nil {
+		errs = append(errs, m.drain(ctx))
+	}
+	if m.Scheduler != nil {
+		errs = append(errs, errors.Annotate(m.Scheduler.Flush(ctx), "cannot flush scheduler"))
+	}
+	for _, c := range m.Closers {
+		errs = append(errs, c.Close())
+	}
+	return errors.NewMultiErr(errs)
+}
+
+// drain waits for the requests the Counter counts to finish
+func (m *ShutdownManager) drain(ctx context.Context) error {
+	for atomic.LoadInt64(&m.Counter.ActiveConnections) > 0 {
+		select {
+		case <-ctx.Done():
+			return errors.Errorf("%d requests still outstanding: %v", atomic.LoadInt64(&m.Counter.ActiveConnections), ctx.Err())
+		case <-time.After(drainPollInterval):
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/sfxclient"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type shutdownSink struct {
+	mu     sync.Mutex
+	points []*datapoint.Datapoint
+	steps  *[]string
+}
+
+func (s *shutdownSink) AddDatapoints(ctx context.Context, points []*datapoint.Datapoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.points = append(s.points, points...)
+	*s.steps = append(*s.steps, "flush")
+	return nil
+}
+
+type shutdownCloser struct {
+	name  string
+	err   error
+	steps *[]string
+}
+
+func (c *shutdownCloser) Close() error {
+	*c.steps = append(*c.steps, c.name)
+	return c.err
+}
+
+func TestShutdownManager(t *testing.T) {
+	Convey("a shutdown manager", t, func() {
+		var steps []string
+		counter := &RequestCounter{}
+		release := make(chan struct{})
+		started := make(chan struct{})
+		server := &http.Server{Handler: counter.Wrap(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			close(started)
+			<-release
+			_, _ = rw.Write(RespOKByte)
+		}))}
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		So(err, ShouldBeNil)
+		go func() {
+			_ = server.Serve(l)
+		}()
+		scheduler := sfxclient.NewScheduler()
+		scheduler.Sink = &shutdownSink{steps: &steps}
+		scheduler.AddCallback(counter)
+		m := NewShutdownManager(server)
+		m.State = &ServiceState{}
+		m.Counter = counter
+		m.Scheduler = scheduler
+		m.Closers = []io.Closer{&shutdownCloser{name: "sink", steps: &steps}}
+
+		Convey("should drain requests, then flush and close", func() {
+			responses := make(chan error, 1)
+			go func() {
+				resp, err := http.Get("http://" + l.Addr().String())
+				if err == nil {
+					err = resp.Body.Close()
+				}
+				responses <- err
+			}()
+			<-started
+			shutdown := make(chan error, 1)
+			go func() {
+				shutdown <- m.Shutdown(context.Background())
+			}()
+			time.Sleep(time.Millisecond * 50)
+			So(m.State.IsInShutdown(), ShouldBeTrue)
+			So(atomic.LoadInt64(&counter.ActiveConnections), ShouldEqual, 1)
+			close(release)
+			So(<-responses, ShouldBeNil)
+			So(<-shutdown, ShouldBeNil)
+			So(steps, ShouldResemble, []string{"flush", "sink"})
+			So(m.Shutdown(context.Background()), ShouldBeNil)
+			So(steps, ShouldResemble, []string{"flush", "sink"})
+		})
+		Convey("should run every step even when they fail", func() {
+			close(release)
+			m.Deadline = time.Millisecond * 50
+			m.DrainDelay = time.Second
+			atomic.AddInt64(&counter.ActiveConnections, 1)
+			m.Closers = append(m.Closers, &shutdownCloser{name: "broken", err: errors.New("cannot close"), steps: &steps})
+			err := m.Shutdown(context.Background())
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "cannot close")
+			So(err.Error(), ShouldContainSubstring, "1 requests still outstanding")
+			So(steps, ShouldResemble, []string{"flush", "sink", "broken"})
+		})
+		Convey("should stop waiting for a signal when its context is done", func() {
+			close(release)
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			So(m.WaitForSignal(ctx), ShouldEqual, context.Canceled)
+			So(m.State.IsHealthy(), ShouldBeTrue)
+			So(server.Close(), ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,35 @@
+//go:build !windows
+// +build !windows
+
+package web
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestShutdownManagerSignal(t *testing.T) {
+	Convey("a shutdown manager should shut down on a signal", t, func() {
+		m := NewShutdownManager(&http.Server{})
+		m.Signals = []os.Signal{syscall.SIGUSR2}
+		m.State = &ServiceState{}
+		done := make(chan error, 1)
+		go func() {
+			done <- m.WaitForSignal(context.Background())
+		}()
+		select {
+		case err := <-done:
+			t.Fatalf("shut down before the signal: %v", err)
+		case <-time.After(time.Millisecond * 50):
+		}
+		So(syscall.Kill(os.Getpid(), syscall.SIGUSR2), ShouldBeNil)
+		So(<-done, ShouldBeNil)
+		So(m.State.IsInShutdown(), ShouldBeTrue)
+	})
+}
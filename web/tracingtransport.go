@@ -0,0 +1,154 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/timekeeper"
+	"github.com/signalfx/golib/v3/trace"
+)
+
+// clientKind is the kind of the spans TracingTransport creates
+const clientKind = "CLIENT"
+
+// TracingTransport is an http.RoundTripper that records a client span for each outgoing request into
+// Sink.  The span is a child of the span on the request's context, if there is one, and is propagated
+// to the server with B3 headers.  The span covers the time until response headers arrive.  Spans Sampler
+// drops are still propagated, as not sampled, but never added to Sink.
+type TracingTransport struct {
+	// Base sends the requests.  Defaults to http.DefaultTransport
+	Base http.RoundTripper
+	Sink trace.Sink
+	// ServiceName is the local service name of the spans
+	ServiceName string
+	// StatusMapper decides the status tags of the spans.  Defaults to marking 4xx and 5xx statuses as errors
+	StatusMapper *trace.StatusMapper
+	// Sampler decides which spans are recorded.  Defaults to following the parent span's decision, and
+	// keeping spans with no parent
+	Sampler    trace.Sampler
+	TimeKeeper timekeeper.TimeKeeper
+
+	spansAdded   int64
+	spansFailed  int64
+	spansDropped int64
+}
+
+var _ http.RoundTripper = &TracingTransport{}
+
+// clientStatusMapper is the StatusMapper of client spans
+var clientStatusMapper = &trace.StatusMapper{HTTPError: trace.HTTPClientError}
+
+// NewTracingTransport creates a transport that records spans from serviceName into sink, sending
+// requests with base
+func NewTracingTransport(base http.RoundTripper, sink trace.Sink, serviceName string) *TracingTransport {
+	return &TracingTransport{
+		Base:         base,
+		Sink:         sink,
+		ServiceName:  serviceName,
+		StatusMapper: clientStatusMapper,
+		TimeKeeper:   timekeeper.RealTime{},
+	}
+}
+
+// RoundTrip sends req with Base, recording a span for it.  req isn't modified: the propagation headers are
+// set on a copy.
+func (t *TracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	span := t.newSpan(req)
+	req = req.Clone(trace.ContextWithSpan(req.Context(), span))
+	trace.InjectB3(req.Header, span)
+
+	start := t.now()
+	resp, err := t.base().RoundTrip(req)
+	duration := t.now().Sub(start).Microseconds()
+	ts := start.UnixNano() / int64(time.Microsecond)
+	span.Timestamp, span.Duration = &ts, &duration
+
+	if sampled, _ := trace.Sampled(span); !sampled {
+		atomic.AddInt64(&t.spansDropped, 1)
+		return resp, err
+	}
+	mapper := t.StatusMapper
+	if mapper == nil {
+		mapper = clientStatusMapper
+	}
+	if err != nil {
+		mapper.ApplyError(span, err)
+	} else {
+		mapper.ApplyHTTP(span, resp.StatusCode)
+	}
+	t.addSpan(span)
+	return resp, err
+}
+
+func (t *TracingTransport) newSpan(req *http.Request) *trace.Span {
+	name, kind := req.Method, clientKind
+	span := &trace.Span{
+		ID:   trace.NewID(),
+		Name: &name,
+		Kind: &kind,
+		Tags: map[string]string{
+			"http.method": req.Method,
+			"http.url":    req.URL.Scheme + "://" + req.URL.Host + req.URL.Path,
+		},
+	}
+	if t.ServiceName != "" {
+		span.LocalEndpoint = &trace.Endpoint{ServiceName: &t.ServiceName}
+	}
+	if parent := trace.SpanFromContext(req.Context()); parent != nil {
+		span.TraceID = parent.TraceID
+		span.ParentID = &parent.ID
+		if sampled, decided := trace.Sampled(parent); decided {
+			trace.SetSampled(span, sampled)
+		}
+	} else {
+		span.TraceID = trace.NewID()
+	}
+	trace.SetSampled(span, t.sampler().Sample(span))
+	return span
+}
+
+func (t *TracingTransport) sampler() trace.Sampler {
+	if t.Sampler == nil {
+		return defaultSampler
+	}
+	return t.Sampler
+}
+
+// defaultSampler is the Sampler of transports without one
+var defaultSampler = trace.ParentBased(trace.AlwaysSample)
+
+func (t *TracingTransport) addSpan(span *trace.Span) {
+	// the request's context may be canceled as soon as the caller is done with the response
+	if err := t.Sink.AddSpans(context.Background(), []*trace.Span{span}); err != nil {
+		atomic.AddInt64(&t.spansFailed, 1)
+		return
+	}
+	atomic.AddInt64(&t.spansAdded, 1)
+}
+
+func (t *TracingTransport) base() http.RoundTripper {
+	if t.Base == nil {
+		return http.DefaultTransport
+	}
+	return t.Base
+}
+
+func (t *TracingTransport) now() time.Time {
+	if t.TimeKeeper == nil {
+		return time.Now()
+	}
+	return t.TimeKeeper.Now()
+}
+
+// Stats returns the number of spans the transport added to its sink, failed to, and didn't sample
+func (t *TracingTransport) Stats(dimensions map[string]string) []*datapoint.Datapoint {
+	now := t.now()
+	return []*datapoint.Datapoint{
+		datapoint.New("TracingTransport.spansAdded", dimensions, datapoint.NewIntValue(atomic.LoadInt64(&t.spansAdded)), datapoint.Counter, now),
+		datapoint.New("TracingTransport.spansFailed", dimensions, datapoint.NewIntValue(atomic.LoadInt64(&t.spansFailed)), datapoint.Counter, now),
+		datapoint.New("TracingTransport.spansDropped", dimensions, datapoint.NewIntValue(atomic.LoadInt64(&t.spansDropped)), datapoint.Counter, now),
+	}
+}
@@ -0,0 +1,117 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/signalfx/golib/v3/trace"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type spanCollector struct {
+	mu    sync.Mutex
+	spans []*trace.Span
+	err   error
+}
+
+func (s *spanCollector) AddSpans(ctx context.Context, spans []*trace.Span) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.spans = append(s.spans, spans...)
+	return s.err
+}
+
+func TestTracingTransport(t *testing.T) {
+	Convey("A tracing transport", t, func() {
+		var received http.Header
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			received = r.Header
+			if r.URL.Path == "/missing" {
+				rw.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		defer server.Close()
+		sink := &spanCollector{}
+		transport := NewTracingTransport(nil, sink, "myservice")
+		client := &http.Client{Transport: transport}
+
+		Convey("should record a client span and propagate it", func() {
+			resp, err := client.Get(server.URL + "/ok?q=secret")
+			So(err, ShouldBeNil)
+			So(resp.Body.Close(), ShouldBeNil)
+			So(len(sink.spans), ShouldEqual, 1)
+			span := sink.spans[0]
+			So(*span.Name, ShouldEqual, http.MethodGet)
+			So(*span.Kind, ShouldEqual, "CLIENT")
+			So(*span.LocalEndpoint.ServiceName, ShouldEqual, "myservice")
+			So(span.ParentID, ShouldBeNil)
+			So(*span.Duration, ShouldBeGreaterThanOrEqualTo, 0)
+			So(span.Tags["http.url"], ShouldEqual, server.URL+"/ok")
+			So(span.Tags[trace.HTTPStatusCodeTag], ShouldEqual, "200")
+			So(span.Tags[trace.ErrorTag], ShouldEqual, "")
+			So(received.Get(trace.B3TraceIDHeader), ShouldEqual, span.TraceID)
+			So(received.Get(trace.B3SpanIDHeader), ShouldEqual, span.ID)
+			So(transport.Stats(nil)[0].Value.String(), ShouldEqual, "1")
+		})
+		Convey("should continue the trace on the request's context", func() {
+			parent := &trace.Span{TraceID: trace.NewID(), ID: trace.NewID()}
+			req, err := http.NewRequestWithContext(trace.ContextWithSpan(context.Background(), parent), http.MethodGet, server.URL+"/missing", nil)
+			So(err, ShouldBeNil)
+			resp, err := client.Do(req)
+			So(err, ShouldBeNil)
+			So(resp.Body.Close(), ShouldBeNil)
+			So(req.Header.Get(trace.B3SpanIDHeader), ShouldEqual, "")
+			span := sink.spans[0]
+			So(span.TraceID, ShouldEqual, parent.TraceID)
+			So(*span.ParentID, ShouldEqual, parent.ID)
+			So(span.Tags[trace.ErrorTag], ShouldEqual, "true")
+			So(received.Get(trace.B3ParentSpanIDHeader), ShouldEqual, parent.ID)
+		})
+		Convey("should follow the parent's sampling decision", func() {
+			parent := &trace.Span{TraceID: trace.NewID(), ID: trace.NewID()}
+			trace.SetSampled(parent, false)
+			req, err := http.NewRequestWithContext(trace.ContextWithSpan(context.Background(), parent), http.MethodGet, server.URL, nil)
+			So(err, ShouldBeNil)
+			resp, err := client.Do(req)
+			So(err, ShouldBeNil)
+			So(resp.Body.Close(), ShouldBeNil)
+			So(len(sink.spans), ShouldEqual, 0)
+			So(received.Get(trace.B3SampledHeader), ShouldEqual, "0")
+			So(received.Get(trace.B3TraceIDHeader), ShouldEqual, parent.TraceID)
+			So(transport.Stats(nil)[2].Value.String(), ShouldEqual, "1")
+		})
+		Convey("should sample with the sampler", func() {
+			transport.Sampler = trace.NeverSample
+			resp, err := client.Get(server.URL)
+			So(err, ShouldBeNil)
+			So(resp.Body.Close(), ShouldBeNil)
+			So(len(sink.spans), ShouldEqual, 0)
+		})
+		Convey("should tag transport errors", func() {
+			transport.Base = roundTripFunc(func(*http.Request) (*http.Response, error) {
+				return nil, errors.New("unreachable")
+			})
+			_, err := client.Get(server.URL)
+			So(err, ShouldNotBeNil)
+			So(sink.spans[0].Tags[trace.ErrorTag], ShouldEqual, "true")
+			So(sink.spans[0].Tags[trace.HTTPStatusCodeTag], ShouldEqual, "")
+		})
+		Convey("should count spans the sink fails to add", func() {
+			sink.err = errors.New("full")
+			resp, err := client.Get(server.URL)
+			So(err, ShouldBeNil)
+			So(resp.Body.Close(), ShouldBeNil)
+			So(transport.Stats(nil)[1].Value.String(), ShouldEqual, "1")
+		})
+	})
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}